@@ -22,6 +22,8 @@ func main() {
 in a single Go binary. It reimplements features from Grafana OnCall
 and Grafana Agent with a modern, cloud-native architecture.`,
 		Version: fmt.Sprintf("%s (%s)", version, commit),
+		// main prints the error, so cobra mustn't as well
+		SilenceErrors: true,
 	}
 
 	// Add subcommands
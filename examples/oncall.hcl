@@ -8,6 +8,58 @@ oncall {
   # Supported: sqlite://, postgresql://
   database = "sqlite://oncall.db"
 
+  # API keys required on /api/v1. Omit to leave the API open. A key that
+  # comes out empty, e.g. from an unset variable, is an error.
+  # api_key "admin" {
+  #   key = env("ONCALL_ADMIN_KEY")
+  # }
+  #
+  # api_key "dashboard" {
+  #   key    = env("ONCALL_DASHBOARD_KEY")
+  #   scopes = ["read"] # read or write; write implies read
+  # }
+
+  # Slack app signing secret. Adds Acknowledge and Resolve buttons to Slack
+  # alerts; point the app's interactivity URL at /api/v1/slack/interactions.
+  slack_signing_secret = env("SLACK_SIGNING_SECRET")
+
+  # Signs webhook requests with an HMAC-SHA256 of the body, sent as
+  # X-Grafana-Ops-Signature: sha256=<hex>
+  webhook_signing_secret = env("WEBHOOK_SIGNING_SECRET")
+
+  # Alert webhook requests allowed per second from each client, and how
+  # many may come at once
+  webhook_rate_limit = 5
+  webhook_rate_burst = 50
+
+  # Notify again for alerts still firing after this long
+  dedup_interval = "4h"
+
+  # Escalate critical alerts twice as fast; other severities wait as
+  # their chain says
+  severity_multipliers = { critical = 0.5 }
+
+  # Go templates for the Slack summary line and the webhook "message"
+  # field, executed against .Alert, .Labels and .Annotations
+  slack_template   = "{{ .Alert.Severity | toUpper }}: {{ .Labels.alertname }} firing for {{ since .Alert.StartsAt | humanizeDuration }}"
+  webhook_template = "{{ .Labels.alertname }} is {{ .Alert.Status }}"
+
+  # Suppress a repeat notification for the same alert, channel, recipient
+  # and status sent within this window. Omit to send every one.
+  notify_dedup_window = "5m"
+
+  # Notification routes pick where alerts are sent by their labels. The
+  # route with the most matching labels wins; a route without match is the
+  # default. Targets are channel:recipient.
+  route {
+    match   = { team = "payments", severity = "critical" }
+    targets = ["slack:${env("SLACK_WEBHOOK_URL")}", "webhook:https://pager.example.com/payments"]
+  }
+
+  route {
+    targets = ["webhook:https://alerts.example.com/hook"]
+  }
+
   # Notification channels
   notification {
     # Slack notifications via webhook
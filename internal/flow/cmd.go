@@ -7,14 +7,27 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/config"
 	"github.com/vjranagit/grafana/internal/flow/engine"
+	"github.com/vjranagit/grafana/internal/logging"
+
+	// Register the built-in components
+	_ "github.com/vjranagit/grafana/internal/flow/component/discovery"
+	_ "github.com/vjranagit/grafana/internal/flow/component/loki"
+	_ "github.com/vjranagit/grafana/internal/flow/component/prometheus"
 )
 
 func NewCommand() *cobra.Command {
 	var configFile string
 	var debug bool
+	var healthWebhook string
+	var healthWebhookToken string
+	var healthWebhookHeaders map[string]string
+	var healthDebounce time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "flow",
@@ -27,9 +40,10 @@ Uses component-based pipeline architecture with HCL configuration.`,
 			if debug {
 				logLevel = slog.LevelDebug
 			}
-			logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 				Level: logLevel,
-			}))
+			})
+			logger := slog.New(logging.NewRedactingHandler(handler, logging.DefaultSensitiveKeys))
 			slog.SetDefault(logger)
 
 			// Load configuration
@@ -38,6 +52,12 @@ Uses component-based pipeline architecture with HCL configuration.`,
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
+			if healthWebhook != "" {
+				headers := healthHookHeaders(healthWebhookHeaders, healthWebhookToken, os.Getenv(healthWebhookTokenEnv))
+				cfg.HealthHook = engine.NewWebhookHealthHook(healthWebhook, headers)
+				cfg.HealthDebounce = healthDebounce
+			}
+
 			// Create engine
 			eng, err := engine.New(cfg)
 			if err != nil {
@@ -49,6 +69,21 @@ Uses component-based pipeline architecture with HCL configuration.`,
 				os.Interrupt, syscall.SIGTERM)
 			defer cancel()
 
+			// Reload the config on SIGHUP
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			defer signal.Stop(hup)
+			go func() {
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-hup:
+						reloadConfig(eng, configFile)
+					}
+				}
+			}()
+
 			// Start engine
 			slog.Info("starting flow engine")
 			if err := eng.Run(ctx); err != nil {
@@ -62,14 +97,57 @@ Uses component-based pipeline architecture with HCL configuration.`,
 	cmd.Flags().StringVarP(&configFile, "config", "c", "flow.hcl",
 		"Configuration file path")
 	cmd.Flags().BoolVar(&debug, "debug", false, "Enable debug logging")
+	cmd.Flags().StringVar(&healthWebhook, "health-webhook", "",
+		"Alert webhook to notify on component health changes, e.g. http://oncall:8080/api/v1/alerts/prometheus")
+	cmd.Flags().StringVar(&healthWebhookToken, "health-webhook-bearer-token", "",
+		"Bearer token sent to --health-webhook, e.g. an oncall API key (defaults to $"+healthWebhookTokenEnv+")")
+	cmd.Flags().StringToStringVar(&healthWebhookHeaders, "health-webhook-header", nil,
+		"Extra headers sent to --health-webhook, e.g. X-Tenant-ID=platform")
+	cmd.Flags().DurationVar(&healthDebounce, "health-debounce", time.Minute,
+		"How long a component health change must persist before it is reported")
+
+	cmd.AddCommand(newFmtCommand())
+	cmd.AddCommand(newConfigCommand())
 
 	return cmd
 }
 
+// healthWebhookTokenEnv holds the health webhook bearer token when the flag
+// isn't given, which keeps it out of the process list
+const healthWebhookTokenEnv = "FLOW_HEALTH_WEBHOOK_TOKEN"
+
+// healthHookHeaders returns the headers for health webhook requests: extra,
+// plus an Authorization header for token, or envToken if token is empty
+func healthHookHeaders(extra map[string]string, token, envToken string) map[string]string {
+	headers := make(map[string]string, len(extra)+1)
+	for name, value := range extra {
+		headers[name] = value
+	}
+	if token == "" {
+		token = envToken
+	}
+	if token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+	return headers
+}
+
+// reloadConfig applies the config at path to a running engine. An invalid
+// config is logged and the running one is kept.
+func reloadConfig(eng *engine.Engine, path string) {
+	slog.Info("reloading config", "path", path)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		slog.Error("failed to load config, keeping the running one", "error", err)
+		return
+	}
+	if err := eng.Reload(cfg); err != nil {
+		slog.Error("failed to reload config", "error", err)
+	}
+}
+
+// loadConfig parses the HCL config at path against the built-in
+// component types
 func loadConfig(path string) (*engine.Config, error) {
-	// For now, return default config
-	// TODO: Implement HCL parsing
-	return &engine.Config{
-		LogLevel: "info",
-	}, nil
+	return config.Load(path, component.DefaultRegistry)
 }
@@ -0,0 +1,157 @@
+package flow
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/config"
+	"github.com/vjranagit/grafana/internal/flow/engine"
+)
+
+type stubComponent struct {
+	id      string
+	exports map[string]interface{}
+}
+
+func (s *stubComponent) ID() string                      { return s.id }
+func (s *stubComponent) Run(ctx context.Context) error   { <-ctx.Done(); return nil }
+func (s *stubComponent) Exports() map[string]interface{} { return s.exports }
+func (s *stubComponent) Health() component.Health {
+	return component.Health{Status: component.StatusHealthy}
+}
+
+func stubRegistry() *component.Registry {
+	registry := component.NewRegistry()
+	for _, t := range []string{"test.source", "test.sink"} {
+		registry.Register(t, func(cfg component.Config) (component.Component, error) {
+			return &stubComponent{
+				id:      cfg.ID(),
+				exports: map[string]interface{}{"receiver": cfg.ID()},
+			}, nil
+		})
+	}
+	return registry
+}
+
+func TestConfig_BuildsGraph(t *testing.T) {
+	path := writeConfig(t, `
+test_source "default" {
+  forward_to = [test.sink.default.receiver]
+}
+
+test_sink "default" {}
+`)
+	registry := stubRegistry()
+	cfg, err := config.Load(path, registry)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.Registry = registry
+
+	eng, err := engine.New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	graph := eng.Graph()
+	if len(graph.Components()) != 2 {
+		t.Fatalf("expected 2 components, got %d", len(graph.Components()))
+	}
+	for _, id := range []string{"test.source.default", "test.sink.default"} {
+		if graph.GetComponent(id) == nil {
+			t.Errorf("expected %s in the graph", id)
+		}
+	}
+	deps := graph.Dependencies("test.source.default")
+	if len(deps) != 1 || deps[0] != "test.sink.default" {
+		t.Errorf("expected source to depend on sink, got %v", deps)
+	}
+	if deps := graph.Dependencies("test.sink.default"); len(deps) != 0 {
+		t.Errorf("expected sink to have no dependencies, got %v", deps)
+	}
+}
+
+func TestConfig_Errors(t *testing.T) {
+	registry := stubRegistry()
+
+	path := writeConfig(t, `unknown_thing "x" {}`)
+	if _, err := config.Load(path, registry); err == nil {
+		t.Error("expected error for unknown component type")
+	}
+
+	path = writeConfig(t, `
+test_source "default" {
+  forward_to = [test.sink.missing.receiver]
+}
+`)
+	_, err := config.Load(path, registry)
+	if err == nil || !strings.Contains(err.Error(), "undefined component") {
+		t.Errorf("expected undefined reference error, got %v", err)
+	}
+}
+
+func TestLoadConfig_BuiltinComponents(t *testing.T) {
+	path := writeConfig(t, `
+prometheus_scrape "default" {
+  targets = ["localhost:9090"]
+}
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Components) != 1 || cfg.Components[0].ID() != "prometheus.scrape.default" {
+		t.Fatalf("unexpected components %v", cfg.Components)
+	}
+}
+
+func TestReloadConfig_KeepsRunningConfigOnError(t *testing.T) {
+	path := writeConfig(t, `
+prometheus_scrape "default" {
+  targets = ["localhost:9090"]
+}
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eng, err := engine.New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scraper := eng.Graph().GetComponent("prometheus.scrape.default")
+
+	if err := os.WriteFile(path, []byte(`prometheus_scrape "default" {`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig(eng, path)
+
+	if eng.Graph().GetComponent("prometheus.scrape.default") != scraper {
+		t.Error("expected an unparsable config to leave the running components in place")
+	}
+}
+
+func TestHealthHookHeaders(t *testing.T) {
+	tests := []struct {
+		name            string
+		extra           map[string]string
+		token, envToken string
+		want            map[string]string
+	}{
+		{"none", nil, "", "", map[string]string{}},
+		{"flag", nil, "abc", "env", map[string]string{"Authorization": "Bearer abc"}},
+		{"env", nil, "", "env", map[string]string{"Authorization": "Bearer env"}},
+		{"extra", map[string]string{"X-Tenant-ID": "platform"}, "abc", "", map[string]string{"X-Tenant-ID": "platform", "Authorization": "Bearer abc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := healthHookHeaders(tt.extra, tt.token, tt.envToken); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package component
 
 import (
 	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Component represents a flow component (scraper, forwarder, etc.)
@@ -23,6 +26,49 @@ type Config struct {
 	Config map[string]interface{} // Type-specific config
 }
 
+// ID returns the unique identifier of the configured component
+func (c Config) ID() string {
+	return c.Type + "." + c.Name
+}
+
+// Exporter is implemented by components that expose values, such as a
+// receiver channel, for other components to reference in their config
+type Exporter interface {
+	Exports() map[string]interface{}
+}
+
+// MetricsProvider is implemented by components that expose Prometheus
+// metrics. The engine registers the collectors with an instance label
+// holding the component's ID, so several instances of a type can coexist.
+type MetricsProvider interface {
+	Collectors() []prometheus.Collector
+}
+
+// Reconfigurable is implemented by components that can apply a new config
+// while running. When a reload changes the config of a component that
+// isn't, it is stopped and a new instance is started in its place.
+type Reconfigurable interface {
+	Reconfigure(cfg Config) error
+}
+
+// Fatal is implemented by components whose failure must stop the engine
+// even when supervision would otherwise restart them
+type Fatal interface {
+	FailureIsFatal() bool
+}
+
+// Reference is a config value pointing at another component's export, e.g.
+// prometheus.remote_write.default.receiver. The engine replaces it with the
+// exported value before creating the referencing component.
+type Reference struct {
+	Component string // ID of the referenced component
+	Export    string // Name of the export
+}
+
+func (r Reference) String() string {
+	return r.Component + "." + r.Export
+}
+
 // Health represents component health status
 type Health struct {
 	Status  Status
@@ -57,6 +103,16 @@ func (r *Registry) Register(componentType string, factory Factory) {
 	r.factories[componentType] = factory
 }
 
+// Types returns the registered component types
+func (r *Registry) Types() []string {
+	types := make([]string, 0, len(r.factories))
+	for t := range r.factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
 func (r *Registry) Create(cfg Config) (Component, error) {
 	factory, ok := r.factories[cfg.Type]
 	if !ok {
@@ -0,0 +1,77 @@
+// Package discovery holds components that find scrape targets, such as
+// discovery.dns, and the Feed they share them through
+package discovery
+
+import (
+	"sync"
+)
+
+// AddressLabel holds a discovered target's host:port
+const AddressLabel = "__address__"
+
+// Target is a discovered target: its address under AddressLabel, plus
+// labels to attach to what is collected from it. Labels starting with __
+// describe the target, e.g. __meta_dns_name, and aren't attached.
+type Target map[string]string
+
+// Feed shares the targets a discovery component last found with the
+// components that reference its "targets" export. Each subscriber gets the
+// current set, then every set published after it; one that falls behind
+// only gets the latest. Published sets must not be modified.
+type Feed struct {
+	mu          sync.Mutex
+	targets     []Target
+	published   bool
+	subscribers map[chan []Target]struct{}
+}
+
+func NewFeed() *Feed {
+	return &Feed{subscribers: make(map[chan []Target]struct{})}
+}
+
+// Publish replaces the feed's targets and passes them to every subscriber
+func (f *Feed) Publish(targets []Target) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.targets = targets
+	f.published = true
+	for ch := range f.subscribers {
+		offer(ch, targets)
+	}
+}
+
+// Targets returns the last published targets
+func (f *Feed) Targets() []Target {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.targets
+}
+
+// Subscribe returns a channel receiving the feed's target sets, starting
+// with the current one if any has been published, and a function that
+// stops delivery to it
+func (f *Feed) Subscribe() (<-chan []Target, func()) {
+	ch := make(chan []Target, 1)
+
+	f.mu.Lock()
+	f.subscribers[ch] = struct{}{}
+	if f.published {
+		offer(ch, f.targets)
+	}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.subscribers, ch)
+	}
+}
+
+// offer puts targets on ch, replacing a set the subscriber hasn't read
+func offer(ch chan []Target, targets []Target) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- targets
+}
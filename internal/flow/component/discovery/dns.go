@@ -0,0 +1,253 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+func init() {
+	component.DefaultRegistry.Register("discovery.dns", NewDNS)
+}
+
+const defaultDNSRefreshInterval = 30 * time.Second
+
+// Resolver looks up DNS records. *net.Resolver implements it.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+// DNS implements component.Component for discovering targets from SRV, A
+// or AAAA records. It exports the targets found as "targets", for
+// prometheus.scrape to list in its own targets.
+type DNS struct {
+	id              string
+	names           []string
+	recordType      string
+	port            int
+	refreshInterval time.Duration
+	resolver        Resolver
+	feed            *Feed
+
+	mu     sync.Mutex
+	health component.Health
+
+	// found holds the targets last resolved for each name, kept when a
+	// later lookup of the name fails
+	found map[string][]Target
+
+	// Metrics
+	lookupFailures prometheus.Counter
+}
+
+func NewDNS(cfg component.Config) (component.Component, error) {
+	d := &DNS{
+		id:              cfg.ID(),
+		recordType:      "SRV",
+		refreshInterval: defaultDNSRefreshInterval,
+		resolver:        net.DefaultResolver,
+		feed:            NewFeed(),
+		found:           make(map[string][]Target),
+		health: component.Health{
+			Status:  component.StatusHealthy,
+			Message: "initialized",
+		},
+		lookupFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_discovery_dns_lookup_failures_total",
+			Help: "Total number of DNS lookups that failed",
+		}),
+	}
+
+	list, ok := cfg.Config["names"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s: names must be a non-empty list of DNS names", d.id)
+	}
+	for i, v := range list {
+		name, ok := v.(string)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s: names[%d] must be a non-empty string", d.id, i)
+		}
+		d.names = append(d.names, name)
+	}
+
+	if v, ok := cfg.Config["type"]; ok {
+		s, _ := v.(string)
+		switch strings.ToUpper(s) {
+		case "SRV", "A", "AAAA":
+			d.recordType = strings.ToUpper(s)
+		default:
+			return nil, fmt.Errorf("%s: type must be SRV, A or AAAA, got %v", d.id, v)
+		}
+	}
+
+	// SRV records carry their own port, which port overrides if set. A and
+	// AAAA records need one.
+	if v, ok := cfg.Config["port"]; ok {
+		n, ok := v.(int)
+		if !ok || n <= 0 || n > 65535 {
+			return nil, fmt.Errorf("%s: port must be a number between 1 and 65535", d.id)
+		}
+		d.port = n
+	}
+	if d.recordType != "SRV" && d.port == 0 {
+		return nil, fmt.Errorf("%s: port is required for %s records", d.id, d.recordType)
+	}
+
+	if v, ok := cfg.Config["refresh_interval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: refresh_interval must be a duration string such as \"30s\"", d.id)
+		}
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid refresh_interval: %w", d.id, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("%s: refresh_interval must be positive, got %s", d.id, s)
+		}
+		d.refreshInterval = interval
+	}
+
+	return d, nil
+}
+
+func (d *DNS) ID() string {
+	return d.id
+}
+
+func (d *DNS) Exports() map[string]interface{} {
+	return map[string]interface{}{"targets": d.feed}
+}
+
+func (d *DNS) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{d.lookupFailures}
+}
+
+// Run resolves the names at once and then every refresh_interval
+func (d *DNS) Run(ctx context.Context) error {
+	slog.Info("starting dns discovery",
+		"id", d.id,
+		"names", d.names,
+		"type", d.recordType,
+		"refresh_interval", d.refreshInterval)
+
+	ticker := time.NewTicker(d.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		d.refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("stopping dns discovery", "id", d.id)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh looks up every name and publishes the combined targets. A name
+// that fails to resolve keeps the targets last found for it.
+func (d *DNS) refresh(ctx context.Context) {
+	var failed []string
+	for _, name := range d.names {
+		targets, err := d.lookup(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Warn("dns lookup failed",
+				"id", d.id,
+				"name", name,
+				"type", d.recordType,
+				"error", err)
+			d.lookupFailures.Inc()
+			failed = append(failed, name)
+			continue
+		}
+		d.mu.Lock()
+		d.found[name] = targets
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	var targets []Target
+	for _, name := range d.names {
+		targets = append(targets, d.found[name]...)
+	}
+	if len(failed) > 0 {
+		d.health = component.Health{
+			Status:  component.StatusDegraded,
+			Message: fmt.Sprintf("failed to resolve %s, keeping last known targets", strings.Join(failed, ", ")),
+		}
+	} else {
+		d.health = component.Health{
+			Status:  component.StatusHealthy,
+			Message: fmt.Sprintf("discovered %d targets", len(targets)),
+		}
+	}
+	d.mu.Unlock()
+
+	d.feed.Publish(targets)
+}
+
+// lookup resolves name to targets, sorted by address
+func (d *DNS) lookup(ctx context.Context, name string) ([]Target, error) {
+	var targets []Target
+	switch d.recordType {
+	case "SRV":
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range records {
+			host := strings.TrimSuffix(srv.Target, ".")
+			port := int(srv.Port)
+			if d.port != 0 {
+				port = d.port
+			}
+			targets = append(targets, Target{
+				AddressLabel:                   net.JoinHostPort(host, strconv.Itoa(port)),
+				"__meta_dns_name":              name,
+				"__meta_dns_srv_record_target": srv.Target,
+				"__meta_dns_srv_record_port":   strconv.Itoa(int(srv.Port)),
+			})
+		}
+	default:
+		network := "ip4"
+		if d.recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := d.resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			targets = append(targets, Target{
+				AddressLabel:      net.JoinHostPort(ip.String(), strconv.Itoa(d.port)),
+				"__meta_dns_name": name,
+			})
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i][AddressLabel] < targets[j][AddressLabel]
+	})
+	return targets, nil
+}
+
+func (d *DNS) Health() component.Health {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.health
+}
@@ -0,0 +1,176 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// fakeResolver answers lookups from its records, or with err if set
+type fakeResolver struct {
+	mu  sync.Mutex
+	srv map[string][]*net.SRV
+	ips map[string][]net.IP
+	err error
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return name, r.srv[name], nil
+}
+
+func (r *fakeResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.ips[network+"/"+host], nil
+}
+
+func (r *fakeResolver) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+func newTestDNS(t *testing.T, config map[string]interface{}, resolver Resolver) *DNS {
+	t.Helper()
+	comp, err := NewDNS(component.Config{Type: "discovery.dns", Name: "test", Config: config})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d := comp.(*DNS)
+	d.resolver = resolver
+	return d
+}
+
+// receive waits for the next target set on ch
+func receive(t *testing.T, ch <-chan []Target) []Target {
+	t.Helper()
+	select {
+	case targets := <-ch:
+		return targets
+	case <-time.After(2 * time.Second):
+		t.Fatal("no targets were published")
+		return nil
+	}
+}
+
+func TestDNS_PropagatesTargets(t *testing.T) {
+	resolver := &fakeResolver{srv: map[string][]*net.SRV{
+		"_metrics._tcp.api.internal": {
+			{Target: "api-2.internal.", Port: 9100},
+			{Target: "api-1.internal.", Port: 9100},
+		},
+	}}
+	d := newTestDNS(t, map[string]interface{}{
+		"names":            []interface{}{"_metrics._tcp.api.internal"},
+		"refresh_interval": "10ms",
+	}, resolver)
+
+	feed := d.Exports()["targets"].(*Feed)
+	updates, unsubscribe := feed.Subscribe()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	want := []Target{
+		{
+			AddressLabel:                   "api-1.internal:9100",
+			"__meta_dns_name":              "_metrics._tcp.api.internal",
+			"__meta_dns_srv_record_target": "api-1.internal.",
+			"__meta_dns_srv_record_port":   "9100",
+		},
+		{
+			AddressLabel:                   "api-2.internal:9100",
+			"__meta_dns_name":              "_metrics._tcp.api.internal",
+			"__meta_dns_srv_record_target": "api-2.internal.",
+			"__meta_dns_srv_record_port":   "9100",
+		},
+	}
+	if got := receive(t, updates); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// A late subscriber gets the current set at once
+	late, unsubscribeLate := feed.Subscribe()
+	defer unsubscribeLate()
+	if got := receive(t, late); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected a late subscriber to get %v, got %v", want, got)
+	}
+
+	// Failed lookups keep the last known targets and degrade health
+	resolver.fail(errors.New("no such host"))
+	deadline := time.Now().Add(2 * time.Second)
+	for d.Health().Status != component.StatusDegraded {
+		if time.Now().After(deadline) {
+			t.Fatal("expected health to become degraded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := receive(t, updates); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the last known targets to be kept, got %v", got)
+	}
+
+	resolver.fail(nil)
+	for d.Health().Status != component.StatusHealthy {
+		if time.Now().After(deadline) {
+			t.Fatal("expected health to recover")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDNS_AddressRecords(t *testing.T) {
+	resolver := &fakeResolver{ips: map[string][]net.IP{
+		"ip4/node.internal": {net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1")},
+		"ip6/node.internal": {net.ParseIP("fd00::1")},
+	}}
+	for recordType, want := range map[string][]string{
+		"A":    {"10.0.0.1:9100", "10.0.0.2:9100"},
+		"AAAA": {"[fd00::1]:9100"},
+	} {
+		d := newTestDNS(t, map[string]interface{}{
+			"names": []interface{}{"node.internal"},
+			"type":  recordType,
+			"port":  9100,
+		}, resolver)
+		d.refresh(context.Background())
+
+		var got []string
+		for _, target := range d.feed.Targets() {
+			got = append(got, target[AddressLabel])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", recordType, want, got)
+		}
+	}
+}
+
+func TestNewDNS_InvalidConfig(t *testing.T) {
+	for name, config := range map[string]map[string]interface{}{
+		"no names":          {},
+		"empty name":        {"names": []interface{}{""}},
+		"unknown type":      {"names": []interface{}{"a"}, "type": "MX"},
+		"A without port":    {"names": []interface{}{"a"}, "type": "A"},
+		"port out of range": {"names": []interface{}{"a"}, "port": 70000},
+		"bad interval":      {"names": []interface{}{"a"}, "refresh_interval": "often"},
+	} {
+		if _, err := NewDNS(component.Config{Type: "discovery.dns", Name: "test", Config: config}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
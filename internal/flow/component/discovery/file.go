@@ -0,0 +1,293 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	component.DefaultRegistry.Register("discovery.file", NewFile)
+}
+
+const defaultFileRefreshInterval = 5 * time.Second
+
+// fileGroup is an entry of a file_sd file: targets sharing a set of labels
+type fileGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// File implements component.Component for discovering targets from files
+// in Prometheus's file_sd format, JSON or YAML by extension:
+//
+//	[{"targets": ["api-1:9100", "api-2:9100"], "labels": {"env": "prod"}}]
+//
+// Files are re-read every refresh_interval. It exports the targets found
+// as "targets", for prometheus.scrape to list in its own targets.
+type File struct {
+	id              string
+	files           []string
+	refreshInterval time.Duration
+	feed            *Feed
+
+	mu     sync.Mutex
+	health component.Health
+
+	// loaded holds each matched file's content as last read and the
+	// targets last parsed from it, kept when a later version is malformed
+	loaded map[string]*loadedFile
+
+	// Metrics
+	readFailures prometheus.Counter
+}
+
+type loadedFile struct {
+	content []byte
+	targets []Target
+	err     error
+}
+
+func NewFile(cfg component.Config) (component.Component, error) {
+	f := &File{
+		id:              cfg.ID(),
+		refreshInterval: defaultFileRefreshInterval,
+		feed:            NewFeed(),
+		loaded:          make(map[string]*loadedFile),
+		health: component.Health{
+			Status:  component.StatusHealthy,
+			Message: "initialized",
+		},
+		readFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_discovery_file_read_failures_total",
+			Help: "Total number of target files that could not be read or parsed",
+		}),
+	}
+
+	list, ok := cfg.Config["files"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s: files must be a non-empty list of file globs", f.id)
+	}
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("%s: files must be a non-empty list of file globs", f.id)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid file glob %q: %w", f.id, pattern, err)
+		}
+		if _, err := fileFormat(pattern); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.id, err)
+		}
+		f.files = append(f.files, pattern)
+	}
+
+	if v, ok := cfg.Config["refresh_interval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: refresh_interval must be a duration string such as \"5s\"", f.id)
+		}
+		interval, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid refresh_interval: %w", f.id, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("%s: refresh_interval must be positive, got %s", f.id, s)
+		}
+		f.refreshInterval = interval
+	}
+
+	return f, nil
+}
+
+// fileFormat returns "json" or "yaml" according to path's extension
+func fileFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json", nil
+	case ".yml", ".yaml":
+		return "yaml", nil
+	}
+	return "", fmt.Errorf("%s: target files must end in .json, .yml or .yaml", path)
+}
+
+func (f *File) ID() string {
+	return f.id
+}
+
+func (f *File) Exports() map[string]interface{} {
+	return map[string]interface{}{"targets": f.feed}
+}
+
+func (f *File) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{f.readFailures}
+}
+
+// Run reads the files at once and then every refresh_interval
+func (f *File) Run(ctx context.Context) error {
+	slog.Info("starting file discovery",
+		"id", f.id,
+		"files", f.files,
+		"refresh_interval", f.refreshInterval)
+
+	ticker := time.NewTicker(f.refreshInterval)
+	defer ticker.Stop()
+
+	f.refresh(true)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("stopping file discovery", "id", f.id)
+			return nil
+		case <-ticker.C:
+			f.refresh(false)
+		}
+	}
+}
+
+// refresh re-reads every matched file and publishes the combined targets
+// if any changed, or if force is set. A file that can't be read or parsed
+// keeps the targets last loaded from it; one that no longer matches
+// drops them.
+func (f *File) refresh(force bool) {
+	matched := make(map[string]bool)
+	for _, pattern := range f.files {
+		paths, _ := filepath.Glob(pattern)
+		for _, path := range paths {
+			matched[path] = true
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	changed := force
+	for path := range f.loaded {
+		if !matched[path] {
+			delete(f.loaded, path)
+			changed = true
+		}
+	}
+
+	for path := range matched {
+		loaded, ok := f.loaded[path]
+		if !ok {
+			loaded = &loadedFile{}
+			f.loaded[path] = loaded
+		}
+
+		content, err := os.ReadFile(path)
+		if err == nil && ok && loaded.err == nil && bytes.Equal(content, loaded.content) {
+			continue
+		}
+		var targets []Target
+		if err == nil {
+			targets, err = parseTargetFile(path, content)
+		}
+		if err != nil {
+			if loaded.err == nil || err.Error() != loaded.err.Error() {
+				slog.Warn("failed to load target file, keeping its previous targets",
+					"id", f.id,
+					"path", path,
+					"error", err)
+				f.readFailures.Inc()
+			}
+			loaded.err = err
+			continue
+		}
+
+		loaded.content = content
+		loaded.targets = targets
+		loaded.err = nil
+		changed = true
+	}
+
+	paths := make([]string, 0, len(f.loaded))
+	var failed []string
+	for path, loaded := range f.loaded {
+		paths = append(paths, path)
+		if loaded.err != nil {
+			failed = append(failed, path)
+		}
+	}
+	sort.Strings(paths)
+	sort.Strings(failed)
+
+	var targets []Target
+	for _, path := range paths {
+		targets = append(targets, f.loaded[path].targets...)
+	}
+	if len(failed) > 0 {
+		f.health = component.Health{
+			Status:  component.StatusDegraded,
+			Message: fmt.Sprintf("failed to load %s, keeping previous targets", strings.Join(failed, ", ")),
+		}
+	} else {
+		f.health = component.Health{
+			Status:  component.StatusHealthy,
+			Message: fmt.Sprintf("discovered %d targets from %d files", len(targets), len(paths)),
+		}
+	}
+
+	if changed {
+		slog.Debug("target files changed", "id", f.id, "targets", len(targets))
+		f.feed.Publish(targets)
+	}
+}
+
+// parseTargetFile reads the groups in a file_sd file. Each target gets
+// the labels of its group and the file's path as __meta_filepath.
+func parseTargetFile(path string, content []byte) ([]Target, error) {
+	format, err := fileFormat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []fileGroup
+	if format == "json" {
+		err = json.Unmarshal(content, &groups)
+	} else {
+		err = yaml.Unmarshal(content, &groups)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", format, err)
+	}
+
+	var targets []Target
+	for i, group := range groups {
+		for name := range group.Labels {
+			if name == "" || strings.HasPrefix(name, "__") {
+				return nil, fmt.Errorf("group %d: invalid label name %q", i, name)
+			}
+		}
+		for _, address := range group.Targets {
+			if address == "" {
+				return nil, fmt.Errorf("group %d: targets must be non-empty addresses", i)
+			}
+			target := Target{AddressLabel: address, "__meta_filepath": path}
+			for name, value := range group.Labels {
+				target[name] = value
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+func (f *File) Health() component.Health {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.health
+}
@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+func newTestFile(t *testing.T, files ...interface{}) *File {
+	t.Helper()
+	comp, err := NewFile(component.Config{
+		Type:   "discovery.file",
+		Name:   "test",
+		Config: map[string]interface{}{"files": files},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return comp.(*File)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFile_UpdatesTargets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cmdb.json")
+	writeFile(t, path, `[
+  {"targets": ["api-1:9100", "api-2:9100"], "labels": {"env": "prod"}},
+  {"targets": ["db-1:9187"]}
+]`)
+
+	f := newTestFile(t, filepath.Join(dir, "*.json"))
+	updates, unsubscribe := f.feed.Subscribe()
+	defer unsubscribe()
+
+	f.refresh(true)
+	want := []Target{
+		{AddressLabel: "api-1:9100", "__meta_filepath": path, "env": "prod"},
+		{AddressLabel: "api-2:9100", "__meta_filepath": path, "env": "prod"},
+		{AddressLabel: "db-1:9187", "__meta_filepath": path},
+	}
+	if got := receive(t, updates); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	writeFile(t, path, `[{"targets": ["api-3:9100"], "labels": {"env": "staging"}}]`)
+	f.refresh(false)
+	want = []Target{{AddressLabel: "api-3:9100", "__meta_filepath": path, "env": "staging"}}
+	if got := receive(t, updates); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the rewritten targets %v, got %v", want, got)
+	}
+
+	// A malformed rewrite keeps the targets and degrades health
+	writeFile(t, path, `[{"targets": ["api-4:9100"`)
+	f.refresh(false)
+	if got := f.feed.Targets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the previous targets to be kept, got %v", got)
+	}
+	if health := f.Health(); health.Status != component.StatusDegraded {
+		t.Errorf("expected degraded health, got %v", health)
+	}
+	select {
+	case got := <-updates:
+		t.Errorf("expected nothing published for a malformed file, got %v", got)
+	default:
+	}
+
+	// Removing the file drops its targets
+	os.Remove(path)
+	f.refresh(false)
+	if got := receive(t, updates); len(got) != 0 {
+		t.Errorf("expected no targets once the file is removed, got %v", got)
+	}
+	if health := f.Health(); health.Status != component.StatusHealthy {
+		t.Errorf("expected health to recover, got %v", health)
+	}
+}
+
+func TestFile_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yml")
+	writeFile(t, path, `
+- targets: ["node-1:9100"]
+  labels:
+    rack: r1
+`)
+
+	f := newTestFile(t, path)
+	f.refresh(true)
+	want := []Target{{AddressLabel: "node-1:9100", "__meta_filepath": path, "rack": "r1"}}
+	if got := f.feed.Targets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestNewFile_InvalidConfig(t *testing.T) {
+	for name, config := range map[string]map[string]interface{}{
+		"no files":       {},
+		"bad glob":       {"files": []interface{}{"[.json"}},
+		"unknown format": {"files": []interface{}{"targets.txt"}},
+		"bad interval":   {"files": []interface{}{"t.json"}, "refresh_interval": "0s"},
+	} {
+		if _, err := NewFile(component.Config{Type: "discovery.file", Name: "test", Config: config}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package httpclient builds HTTP clients from the basic_auth, bearer_token
+// and tls_config settings shared by components that talk to HTTP endpoints.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// BasicAuth holds credentials sent with every request
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// TLSConfig configures how the server certificate is verified and which
+// client certificate is presented
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// Config holds the authentication and TLS settings used to talk to an
+// HTTP endpoint
+type Config struct {
+	BasicAuth   *BasicAuth
+	BearerToken string
+	TLSConfig   *TLSConfig
+}
+
+// IsZero reports whether no settings are configured
+func (c Config) IsZero() bool {
+	return c.BasicAuth == nil && c.BearerToken == "" && c.TLSConfig == nil
+}
+
+// Merge returns c with any settings in override taking precedence
+func (c Config) Merge(override Config) Config {
+	if override.BasicAuth != nil {
+		c.BasicAuth = override.BasicAuth
+		c.BearerToken = ""
+	}
+	if override.BearerToken != "" {
+		c.BearerToken = override.BearerToken
+		c.BasicAuth = nil
+	}
+	if override.TLSConfig != nil {
+		c.TLSConfig = override.TLSConfig
+	}
+	return c
+}
+
+// Parse reads basic_auth, bearer_token and tls_config from a component's
+// raw config, ignoring any other keys:
+//
+//	basic_auth {
+//	  username = "scraper"
+//	  password = env("SCRAPE_PASSWORD")
+//	}
+//	tls_config {
+//	  ca_file = "/etc/ssl/internal-ca.pem"
+//	}
+func Parse(raw map[string]interface{}) (Config, error) {
+	var cfg Config
+
+	if v, ok := raw["basic_auth"]; ok {
+		block, err := singleBlock("basic_auth", v)
+		if err != nil {
+			return cfg, err
+		}
+		auth := &BasicAuth{}
+		for key, value := range block {
+			s, ok := value.(string)
+			if !ok {
+				return cfg, fmt.Errorf("basic_auth: %s must be a string", key)
+			}
+			switch key {
+			case "username":
+				auth.Username = s
+			case "password":
+				auth.Password = s
+			default:
+				return cfg, fmt.Errorf("basic_auth: unknown attribute %q", key)
+			}
+		}
+		if auth.Username == "" {
+			return cfg, fmt.Errorf("basic_auth: username is required")
+		}
+		cfg.BasicAuth = auth
+	}
+
+	if v, ok := raw["bearer_token"]; ok {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return cfg, fmt.Errorf("bearer_token must be a non-empty string")
+		}
+		cfg.BearerToken = s
+	}
+	if cfg.BasicAuth != nil && cfg.BearerToken != "" {
+		return cfg, fmt.Errorf("basic_auth and bearer_token are mutually exclusive")
+	}
+
+	if v, ok := raw["tls_config"]; ok {
+		block, err := singleBlock("tls_config", v)
+		if err != nil {
+			return cfg, err
+		}
+		tlsCfg := &TLSConfig{}
+		for key, value := range block {
+			if key == "insecure_skip_verify" {
+				b, ok := value.(bool)
+				if !ok {
+					return cfg, fmt.Errorf("tls_config: insecure_skip_verify must be a bool")
+				}
+				tlsCfg.InsecureSkipVerify = b
+				continue
+			}
+			s, ok := value.(string)
+			if !ok {
+				return cfg, fmt.Errorf("tls_config: %s must be a string", key)
+			}
+			switch key {
+			case "ca_file":
+				tlsCfg.CAFile = s
+			case "cert_file":
+				tlsCfg.CertFile = s
+			case "key_file":
+				tlsCfg.KeyFile = s
+			default:
+				return cfg, fmt.Errorf("tls_config: unknown attribute %q", key)
+			}
+		}
+		if (tlsCfg.CertFile == "") != (tlsCfg.KeyFile == "") {
+			return cfg, fmt.Errorf("tls_config: cert_file and key_file must be set together")
+		}
+		cfg.TLSConfig = tlsCfg
+	}
+
+	return cfg, nil
+}
+
+// singleBlock accepts either an object or a list holding one object, since
+// a nested HCL block is collected into a list
+func singleBlock(name string, v interface{}) (map[string]interface{}, error) {
+	if list, ok := v.([]interface{}); ok {
+		if len(list) != 1 {
+			return nil, fmt.Errorf("%s may only be set once", name)
+		}
+		v = list[0]
+	}
+	block, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a block", name)
+	}
+	return block, nil
+}
+
+// New builds a client that applies cfg's TLS settings and adds its
+// credentials to every request
+func New(cfg Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.TLSConfig != nil {
+		tlsCfg := &tls.Config{InsecureSkipVerify: cfg.TLSConfig.InsecureSkipVerify}
+		if cfg.TLSConfig.CAFile != "" {
+			pem, err := os.ReadFile(cfg.TLSConfig.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ca_file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("ca_file %s contains no certificates", cfg.TLSConfig.CAFile)
+			}
+			tlsCfg.RootCAs = pool
+		}
+		if cfg.TLSConfig.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.TLSConfig.CertFile, cfg.TLSConfig.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			tlsCfg.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+
+	var rt http.RoundTripper = transport
+	if cfg.BasicAuth != nil || cfg.BearerToken != "" {
+		rt = &authRoundTripper{base: transport, cfg: cfg}
+	}
+	return &http.Client{Transport: rt}, nil
+}
+
+// authRoundTripper sets the Authorization header on outgoing requests
+type authRoundTripper struct {
+	base http.RoundTripper
+	cfg  Config
+}
+
+func (a *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if a.cfg.BasicAuth != nil {
+		req.SetBasicAuth(a.cfg.BasicAuth.Username, a.cfg.BasicAuth.Password)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+a.cfg.BearerToken)
+	}
+	return a.base.RoundTrip(req)
+}
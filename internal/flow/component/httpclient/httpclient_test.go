@@ -0,0 +1,84 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		raw     map[string]interface{}
+		wantErr string
+	}{
+		{map[string]interface{}{"bearer_token": 42}, "bearer_token must be a non-empty string"},
+		{map[string]interface{}{"basic_auth": map[string]interface{}{"password": "x"}}, "username is required"},
+		{map[string]interface{}{
+			"basic_auth":   map[string]interface{}{"username": "a"},
+			"bearer_token": "t",
+		}, "mutually exclusive"},
+		{map[string]interface{}{"tls_config": map[string]interface{}{"cert_file": "c.pem"}}, "must be set together"},
+		{map[string]interface{}{"tls_config": map[string]interface{}{"insecure_skip_verify": "yes"}}, "must be a bool"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.raw)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v: expected error containing %q, got %v", tt.raw, tt.wantErr, err)
+		}
+	}
+}
+
+func TestParse_SingleBlockList(t *testing.T) {
+	// A nested HCL block arrives as a list holding one object
+	cfg, err := Parse(map[string]interface{}{
+		"basic_auth": []interface{}{map[string]interface{}{"username": "agent", "password": "pw"}},
+		"tls_config": []interface{}{map[string]interface{}{"insecure_skip_verify": true}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BasicAuth == nil || cfg.BasicAuth.Username != "agent" || !cfg.TLSConfig.InsecureSkipVerify {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	_, err = Parse(map[string]interface{}{
+		"basic_auth": []interface{}{map[string]interface{}{"username": "a"}, map[string]interface{}{"username": "b"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "may only be set once") {
+		t.Errorf("expected repeated block to be rejected, got %v", err)
+	}
+}
+
+func TestConfig_Merge(t *testing.T) {
+	base := Config{BearerToken: "base", TLSConfig: &TLSConfig{CAFile: "ca.pem"}}
+
+	merged := base.Merge(Config{BasicAuth: &BasicAuth{Username: "target"}})
+	if merged.BearerToken != "" || merged.BasicAuth.Username != "target" || merged.TLSConfig.CAFile != "ca.pem" {
+		t.Errorf("expected target basic auth to replace the token and keep TLS, got %+v", merged)
+	}
+	if !(Config{}).IsZero() || base.IsZero() {
+		t.Error("unexpected IsZero result")
+	}
+}
+
+func TestNew_SetsAuthorization(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	client, err := New(Config{BearerToken: "s3cret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if got != "Bearer s3cret" {
+		t.Errorf("expected bearer token header, got %q", got)
+	}
+}
@@ -0,0 +1,41 @@
+package loki
+
+import (
+	"errors"
+	"time"
+)
+
+// Entry is a single log line with the labels of the stream it belongs to
+type Entry struct {
+	Labels    map[string]string
+	Timestamp time.Time
+	Line      string
+}
+
+// Receiver accepts batches of log entries. Components that consume logs,
+// such as loki.write, export one as "receiver" so sources can list it in
+// their forward_to.
+type Receiver chan []Entry
+
+var errInvalidForwardTo = errors.New("forward_to must be a list of loki receivers")
+
+// parseForwardTo extracts the receivers referenced by a forward_to list
+func parseForwardTo(v interface{}) ([]Receiver, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errInvalidForwardTo
+	}
+
+	receivers := make([]Receiver, 0, len(list))
+	for _, item := range list {
+		r, ok := item.(Receiver)
+		if !ok {
+			return nil, errInvalidForwardTo
+		}
+		receivers = append(receivers, r)
+	}
+	return receivers, nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package loki
+
+import "os"
+
+// inode is unavailable on this platform, so stored positions are only
+// invalidated when a file shrinks below its recorded offset
+func inode(fi os.FileInfo) uint64 {
+	return 0
+}
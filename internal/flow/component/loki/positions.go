@@ -0,0 +1,104 @@
+package loki
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// position records how far a file has been read. Inode identifies the
+// file the offset belongs to, so a rotated file is read from the start.
+type position struct {
+	Offset int64  `json:"offset"`
+	Inode  uint64 `json:"inode"`
+}
+
+// positions tracks read offsets by path and persists them to a JSON file.
+// With no file configured offsets are only kept in memory.
+type positions struct {
+	path string
+
+	mu      sync.Mutex
+	offsets map[string]position
+	dirty   bool
+}
+
+func loadPositions(path string) (*positions, error) {
+	p := &positions{path: path, offsets: make(map[string]position)}
+	if path == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read positions file: %w", err)
+	}
+	if err := json.Unmarshal(data, &p.offsets); err != nil {
+		return nil, fmt.Errorf("invalid positions file %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p *positions) get(path string) (position, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pos, ok := p.offsets[path]
+	return pos, ok
+}
+
+func (p *positions) set(path string, pos position) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.offsets[path] != pos {
+		p.offsets[path] = pos
+		p.dirty = true
+	}
+}
+
+func (p *positions) remove(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.offsets[path]; ok {
+		delete(p.offsets, path)
+		p.dirty = true
+	}
+}
+
+// save writes the offsets if they changed since the last save. The file
+// is replaced atomically so a crash never leaves it half written.
+func (p *positions) save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.path == "" || !p.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(p.offsets)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write positions file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write positions file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write positions file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), p.path); err != nil {
+		return fmt.Errorf("failed to write positions file: %w", err)
+	}
+	p.dirty = false
+	return nil
+}
@@ -0,0 +1,336 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+func init() {
+	component.DefaultRegistry.Register("loki.source.file", NewFileSource)
+}
+
+const (
+	defaultPollInterval = time.Second
+
+	// readChunkSize is how much of a file is read at a time. A line longer
+	// than this is emitted in pieces.
+	readChunkSize = 64 << 10
+)
+
+// FileSource implements component.Component for tailing log files. Files
+// matching the configured globs are read from their stored offset, or
+// from the start when none is stored, and every appended line is forwarded
+// as an entry labelled with its filename.
+type FileSource struct {
+	id           string
+	paths        []string
+	labels       map[string]string
+	forwardTo    []Receiver
+	positions    *positions
+	pollInterval time.Duration
+
+	tailers map[string]*tailer
+
+	mu     sync.Mutex
+	health component.Health
+}
+
+// tailer follows one file path across rotations
+type tailer struct {
+	path   string
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+}
+
+func NewFileSource(cfg component.Config) (component.Component, error) {
+	s := &FileSource{
+		id:           cfg.ID(),
+		labels:       make(map[string]string),
+		pollInterval: defaultPollInterval,
+		tailers:      make(map[string]*tailer),
+		health: component.Health{
+			Status:  component.StatusHealthy,
+			Message: "initialized",
+		},
+	}
+
+	list, ok := cfg.Config["paths"].([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("%s: paths must be a non-empty list of file globs", s.id)
+	}
+	for _, item := range list {
+		pattern, ok := item.(string)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("%s: paths must be a non-empty list of file globs", s.id)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid path glob %q: %w", s.id, pattern, err)
+		}
+		s.paths = append(s.paths, pattern)
+	}
+
+	if v, ok := cfg.Config["labels"]; ok {
+		labels, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: labels must be an object of strings", s.id)
+		}
+		for name, value := range labels {
+			str, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: label %s must be a string", s.id, name)
+			}
+			if name == "" || strings.HasPrefix(name, "__") {
+				return nil, fmt.Errorf("%s: invalid label name %q", s.id, name)
+			}
+			s.labels[name] = str
+		}
+	}
+
+	positionsFile := ""
+	if v, ok := cfg.Config["positions_file"]; ok {
+		str, ok := v.(string)
+		if !ok || str == "" {
+			return nil, fmt.Errorf("%s: positions_file must be a non-empty string", s.id)
+		}
+		positionsFile = str
+	}
+	pos, err := loadPositions(positionsFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.id, err)
+	}
+	s.positions = pos
+
+	forwardTo, err := parseForwardTo(cfg.Config["forward_to"])
+	if err != nil {
+		return nil, err
+	}
+	s.forwardTo = forwardTo
+
+	return s, nil
+}
+
+func (s *FileSource) ID() string {
+	return s.id
+}
+
+func (s *FileSource) Run(ctx context.Context) error {
+	slog.Info("starting file source",
+		"id", s.id,
+		"paths", s.paths)
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+	defer s.stop()
+
+	s.poll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("stopping file source", "id", s.id)
+			return nil
+		case <-ticker.C:
+			s.poll(ctx)
+		}
+	}
+}
+
+// poll picks up files that started or stopped matching, forwards any new
+// lines and persists the resulting offsets
+func (s *FileSource) poll(ctx context.Context) {
+	matched := make(map[string]bool)
+	for _, pattern := range s.paths {
+		files, _ := filepath.Glob(pattern)
+		for _, f := range files {
+			matched[f] = true
+		}
+	}
+
+	for path, t := range s.tailers {
+		if !matched[path] {
+			slog.Debug("stopped tailing file", "id", s.id, "path", path)
+			t.file.Close()
+			delete(s.tailers, path)
+			s.positions.remove(path)
+		}
+	}
+
+	paths := make([]string, 0, len(matched))
+	for path := range matched {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var failures []string
+	for _, path := range paths {
+		if err := s.tail(ctx, path); err != nil {
+			slog.Warn("failed to tail file", "id", s.id, "path", path, "error", err)
+			failures = append(failures, path)
+		}
+	}
+
+	if err := s.positions.save(); err != nil {
+		slog.Error("failed to save positions", "id", s.id, "error", err)
+		failures = append(failures, "positions file")
+	}
+
+	if len(failures) > 0 {
+		s.setHealth(component.StatusDegraded, fmt.Sprintf("failed to read %s", strings.Join(failures, ", ")))
+	} else {
+		s.setHealth(component.StatusHealthy, fmt.Sprintf("tailing %d files", len(s.tailers)))
+	}
+}
+
+// tail forwards the lines appended to path since the last poll. When path
+// now names a different file the old one is drained before following the
+// new one from the start.
+func (s *FileSource) tail(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	t, ok := s.tailers[path]
+	if ok && !os.SameFile(t.info, info) {
+		slog.Debug("file rotated", "id", s.id, "path", path)
+		if err := s.forwardLines(ctx, t); err != nil {
+			return err
+		}
+		t.file.Close()
+		delete(s.tailers, path)
+		ok = false
+	}
+
+	if !ok {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		if info, err = file.Stat(); err != nil {
+			file.Close()
+			return err
+		}
+		t = &tailer{path: path, file: file, info: info}
+		if pos, found := s.positions.get(path); found && pos.Inode == inode(info) {
+			t.offset = pos.Offset
+		}
+		s.tailers[path] = t
+	}
+
+	if info.Size() < t.offset {
+		slog.Debug("file truncated", "id", s.id, "path", path)
+		t.offset = 0
+	}
+	t.info = info
+
+	return s.forwardLines(ctx, t)
+}
+
+// forwardLines reads complete lines from t's offset and forwards them.
+// A trailing partial line is left for the next poll. The stored offset
+// only advances once the lines are delivered, so lines still in flight at
+// shutdown are read again after a restart.
+func (s *FileSource) forwardLines(ctx context.Context, t *tailer) error {
+	start := t.offset
+	lines, err := t.readLines()
+	if len(lines) > 0 {
+		now := time.Now()
+		entries := make([]Entry, 0, len(lines))
+		for _, line := range lines {
+			labels := make(map[string]string, len(s.labels)+1)
+			for name, value := range s.labels {
+				labels[name] = value
+			}
+			labels["filename"] = t.path
+			entries = append(entries, Entry{Labels: labels, Timestamp: now, Line: line})
+		}
+		if !s.forward(ctx, entries) {
+			t.offset = start
+			return ctx.Err()
+		}
+	}
+	s.positions.set(t.path, position{Offset: t.offset, Inode: inode(t.info)})
+	return err
+}
+
+func (t *tailer) readLines() ([]string, error) {
+	var lines []string
+	buf := make([]byte, readChunkSize)
+	for {
+		n, err := t.file.ReadAt(buf, t.offset)
+		if err != nil && err != io.EOF {
+			return lines, err
+		}
+		data := buf[:n]
+
+		end := bytes.LastIndexByte(data, '\n')
+		if end < 0 {
+			if n == len(buf) {
+				// A line longer than the buffer is emitted in pieces
+				lines = append(lines, string(data))
+				t.offset += int64(n)
+				continue
+			}
+			return lines, nil
+		}
+
+		for _, line := range strings.Split(string(data[:end]), "\n") {
+			lines = append(lines, strings.TrimSuffix(line, "\r"))
+		}
+		t.offset += int64(end + 1)
+
+		if n < len(buf) {
+			return lines, nil
+		}
+	}
+}
+
+// forward sends a batch of entries to every downstream receiver and
+// reports whether all of them accepted it
+func (s *FileSource) forward(ctx context.Context, entries []Entry) bool {
+	for _, r := range s.forwardTo {
+		select {
+		case r <- entries:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// stop closes every open file and persists the final offsets
+func (s *FileSource) stop() {
+	for path, t := range s.tailers {
+		t.file.Close()
+		delete(s.tailers, path)
+	}
+	if err := s.positions.save(); err != nil {
+		slog.Error("failed to save positions", "id", s.id, "error", err)
+	}
+}
+
+func (s *FileSource) setHealth(status component.Status, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = component.Health{Status: status, Message: message}
+}
+
+func (s *FileSource) Health() component.Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
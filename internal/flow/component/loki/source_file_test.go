@@ -0,0 +1,204 @@
+package loki
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+func newTestFileSource(t *testing.T, config map[string]interface{}) (*FileSource, Receiver) {
+	t.Helper()
+	out := make(Receiver, 10)
+	config["forward_to"] = []interface{}{out}
+
+	c, err := NewFileSource(component.Config{Type: "loki.source.file", Name: "app", Config: config})
+	if err != nil {
+		t.Fatalf("failed to create file source: %v", err)
+	}
+	return c.(*FileSource), out
+}
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err := f.WriteString(line + "\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// received drains out and returns the lines of every entry
+func received(out Receiver) []string {
+	var lines []string
+	for {
+		select {
+		case entries := <-out:
+			for _, e := range entries {
+				lines = append(lines, e.Line)
+			}
+		default:
+			return lines
+		}
+	}
+}
+
+func TestFileSource_TailsWithLabels(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(t, path, "starting", "listening on :8080")
+
+	src, out := newTestFileSource(t, map[string]interface{}{
+		"paths":  []interface{}{filepath.Join(dir, "*.log")},
+		"labels": map[string]interface{}{"job": "app", "env": "prod"},
+	})
+	ctx := context.Background()
+
+	src.poll(ctx)
+	entries := <-out
+	if len(entries) != 2 || entries[0].Line != "starting" || entries[1].Line != "listening on :8080" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	wantLabels := map[string]string{"job": "app", "env": "prod", "filename": path}
+	if !reflect.DeepEqual(entries[0].Labels, wantLabels) {
+		t.Errorf("expected labels %v, got %v", wantLabels, entries[0].Labels)
+	}
+
+	// Only appended lines are forwarded, and a partial line waits for its
+	// newline
+	appendLines(t, path, "request served")
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("half a li")
+	f.Close()
+	src.poll(ctx)
+	if got := received(out); !reflect.DeepEqual(got, []string{"request served"}) {
+		t.Fatalf("expected only the appended line, got %v", got)
+	}
+
+	appendLines(t, path, "ne")
+	src.poll(ctx)
+	if got := received(out); !reflect.DeepEqual(got, []string{"half a line"}) {
+		t.Errorf("expected the completed line, got %v", got)
+	}
+}
+
+func TestFileSource_ResumesFromPositions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	positionsFile := filepath.Join(dir, "positions.json")
+	appendLines(t, path, "one", "two")
+
+	config := func() map[string]interface{} {
+		return map[string]interface{}{
+			"paths":          []interface{}{path},
+			"positions_file": positionsFile,
+		}
+	}
+
+	src, out := newTestFileSource(t, config())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- src.Run(ctx) }()
+
+	select {
+	case entries := <-out:
+		if len(entries) != 2 {
+			t.Fatalf("expected 2 entries, got %+v", entries)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for entries")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(positionsFile); err != nil {
+		t.Fatalf("expected positions file to be written: %v", err)
+	}
+
+	// A restarted source picks up after the stored offset
+	appendLines(t, path, "three")
+	restarted, out := newTestFileSource(t, config())
+	restarted.poll(context.Background())
+	if got := received(out); !reflect.DeepEqual(got, []string{"three"}) {
+		t.Errorf("expected to resume after the stored offset, got %v", got)
+	}
+}
+
+func TestFileSource_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(t, path, "before rotation")
+
+	src, out := newTestFileSource(t, map[string]interface{}{
+		"paths":          []interface{}{path},
+		"positions_file": filepath.Join(dir, "positions.json"),
+	})
+	ctx := context.Background()
+	src.poll(ctx)
+	received(out)
+
+	// Lines written just before the rename are drained from the old file,
+	// then the new file is read from the start
+	appendLines(t, path, "last old line")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, "first new line")
+
+	src.poll(ctx)
+	want := []string{"last old line", "first new line"}
+	if got := received(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFileSource_Truncation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(t, path, "a fairly long line", "another long line")
+
+	src, out := newTestFileSource(t, map[string]interface{}{"paths": []interface{}{path}})
+	ctx := context.Background()
+	src.poll(ctx)
+	received(out)
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLines(t, path, "fresh")
+	src.poll(ctx)
+	if got := received(out); !reflect.DeepEqual(got, []string{"fresh"}) {
+		t.Errorf("expected truncated file to be read from the start, got %v", got)
+	}
+}
+
+func TestNewFileSource_Config(t *testing.T) {
+	for name, tt := range map[string]struct {
+		config  map[string]interface{}
+		wantErr string
+	}{
+		"missing paths":   {map[string]interface{}{}, "paths must be a non-empty list"},
+		"bad glob":        {map[string]interface{}{"paths": []interface{}{"/var/log/["}}, "invalid path glob"},
+		"bad label":       {map[string]interface{}{"paths": []interface{}{"/tmp/x"}, "labels": map[string]interface{}{"job": 1}}, "label job must be a string"},
+		"reserved label":  {map[string]interface{}{"paths": []interface{}{"/tmp/x"}, "labels": map[string]interface{}{"__path__": "x"}}, "invalid label name"},
+		"bad forward_to":  {map[string]interface{}{"paths": []interface{}{"/tmp/x"}, "forward_to": []interface{}{"x"}}, "loki receivers"},
+		"empty positions": {map[string]interface{}{"paths": []interface{}{"/tmp/x"}, "positions_file": ""}, "positions_file must be"},
+	} {
+		_, err := NewFileSource(component.Config{Type: "loki.source.file", Name: "app", Config: tt.config})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/component/httpclient"
+)
+
+func init() {
+	component.DefaultRegistry.Register("loki.write", NewWriter)
+}
+
+const (
+	defaultBatchSize = 1000
+	defaultBatchWait = time.Second
+
+	// Failed pushes are retried with exponential backoff starting at
+	// defaultRetryBackoff, then the batch is dropped
+	defaultMaxRetries   = 5
+	defaultRetryBackoff = 500 * time.Millisecond
+
+	// receiverBuffer is how many batches sources can queue before
+	// forwarding blocks
+	receiverBuffer = 16
+
+	// shutdownFlushTimeout bounds the final flush when the writer stops
+	shutdownFlushTimeout = 5 * time.Second
+)
+
+// Writer implements component.Component for pushing log entries to Loki.
+// It exports a "receiver" that sources such as loki.source.file list in
+// their forward_to.
+type Writer struct {
+	id           string
+	endpoint     string
+	tenantID     string
+	batchSize    int
+	batchWait    time.Duration
+	maxRetries   int
+	retryBackoff time.Duration
+	receiver     Receiver
+	httpClient   *http.Client
+
+	mu     sync.Mutex
+	health component.Health
+
+	// Metrics
+	entriesSent    prometheus.Counter
+	entriesDropped prometheus.Counter
+}
+
+func NewWriter(cfg component.Config) (component.Component, error) {
+	w := &Writer{
+		id:           cfg.ID(),
+		batchSize:    defaultBatchSize,
+		batchWait:    defaultBatchWait,
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: defaultRetryBackoff,
+		receiver:     make(Receiver, receiverBuffer),
+		health: component.Health{
+			Status:  component.StatusHealthy,
+			Message: "initialized",
+		},
+		entriesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_loki_write_entries_total",
+			Help: "Total number of log entries pushed to Loki",
+		}),
+		entriesDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_loki_write_dropped_entries_total",
+			Help: "Total number of log entries dropped after failed pushes",
+		}),
+	}
+
+	endpoint, _ := cfg.Config["endpoint"].(string)
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("%s: endpoint must be an http or https URL", w.id)
+	}
+	w.endpoint = endpoint
+
+	if v, ok := cfg.Config["tenant_id"]; ok {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s: tenant_id must be a non-empty string", w.id)
+		}
+		w.tenantID = s
+	}
+	if v, ok := cfg.Config["batch_size"]; ok {
+		n, ok := v.(int)
+		if !ok || n <= 0 {
+			return nil, fmt.Errorf("%s: batch_size must be a positive number of entries", w.id)
+		}
+		w.batchSize = n
+	}
+	if v, ok := cfg.Config["batch_wait"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: batch_wait must be a duration string such as \"1s\"", w.id)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid batch_wait: %w", w.id, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("%s: batch_wait must be positive, got %s", w.id, s)
+		}
+		w.batchWait = d
+	}
+
+	clientConfig, err := httpclient.Parse(cfg.Config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", w.id, err)
+	}
+	w.httpClient, err = httpclient.New(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", w.id, err)
+	}
+
+	return w, nil
+}
+
+func (w *Writer) ID() string {
+	return w.id
+}
+
+func (w *Writer) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{w.entriesSent, w.entriesDropped}
+}
+
+func (w *Writer) Exports() map[string]interface{} {
+	return map[string]interface{}{"receiver": w.receiver}
+}
+
+// Run batches incoming entries and pushes a batch once it reaches
+// batch_size or batch_wait has passed. Pending entries are flushed when
+// ctx is cancelled.
+func (w *Writer) Run(ctx context.Context) error {
+	slog.Info("starting loki writer",
+		"id", w.id,
+		"endpoint", w.endpoint,
+		"batch_size", w.batchSize,
+		"batch_wait", w.batchWait)
+
+	ticker := time.NewTicker(w.batchWait)
+	defer ticker.Stop()
+
+	var pending []Entry
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			defer cancel()
+			for len(pending) > 0 {
+				n := min(len(pending), w.batchSize)
+				w.flush(flushCtx, pending[:n])
+				pending = pending[n:]
+			}
+			slog.Info("stopping loki writer", "id", w.id)
+			return nil
+		case entries := <-w.receiver:
+			pending = append(pending, entries...)
+			for len(pending) >= w.batchSize {
+				w.flush(ctx, pending[:w.batchSize])
+				pending = pending[w.batchSize:]
+			}
+		case <-ticker.C:
+			if len(pending) > 0 {
+				w.flush(ctx, pending)
+				pending = nil
+			}
+		}
+	}
+}
+
+// flush pushes one batch, dropping it if every attempt fails
+func (w *Writer) flush(ctx context.Context, batch []Entry) {
+	if err := w.send(ctx, batch); err != nil {
+		slog.Error("loki push failed, dropping entries",
+			"id", w.id,
+			"entries", len(batch),
+			"error", err)
+		w.entriesDropped.Add(float64(len(batch)))
+		w.setHealth(component.StatusDegraded, fmt.Sprintf("push failures: %s", err))
+		return
+	}
+	w.entriesSent.Add(float64(len(batch)))
+	w.setHealth(component.StatusHealthy, "pushing successfully")
+}
+
+// send posts batch to the endpoint, retrying network errors, 429 and 5xx
+// responses with exponential backoff
+func (w *Writer) send(ctx context.Context, batch []Entry) error {
+	body, err := json.Marshal(buildPushRequest(batch))
+	if err != nil {
+		return fmt.Errorf("failed to encode push: %w", err)
+	}
+	backoff := w.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.maxRetries {
+			return err
+		}
+
+		slog.Warn("retrying loki push",
+			"id", w.id,
+			"attempt", attempt+1,
+			"error", err)
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// post makes a single request and reports whether a failure is worth
+// retrying
+func (w *Writer) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.tenantID != "" {
+		req.Header.Set("X-Scope-OrgID", w.tenantID)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to push: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+	return retry, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+}
+
+func (w *Writer) setHealth(status component.Status, message string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.health = component.Health{Status: status, Message: message}
+}
+
+func (w *Writer) Health() component.Health {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.health
+}
+
+// pushRequest is Loki's JSON push format:
+//
+//	{"streams": [{"stream": {"job": "app"}, "values": [["<unix ns>", "line"]]}]}
+type pushRequest struct {
+	Streams []pushStream `json:"streams"`
+}
+
+type pushStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// buildPushRequest groups entries into one stream per label set. Streams
+// are ordered by label set and keep their entries in arrival order.
+func buildPushRequest(entries []Entry) pushRequest {
+	streams := make(map[string]*pushStream)
+	var keys []string
+	for _, e := range entries {
+		key := labelsKey(e.Labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &pushStream{Stream: e.Labels}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.Timestamp.UnixNano(), 10), e.Line})
+	}
+	sort.Strings(keys)
+
+	req := pushRequest{Streams: make([]pushStream, 0, len(keys))}
+	for _, key := range keys {
+		req.Streams = append(req.Streams, *streams[key])
+	}
+	return req
+}
+
+// labelsKey renders labels in Loki's selector syntax, e.g. {env="prod", job="app"}
+func labelsKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(labels[name])
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
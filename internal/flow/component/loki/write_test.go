@@ -0,0 +1,238 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// pushServer records the push requests it accepts
+type pushServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	pushes   []pushRequest
+	tenants  []string
+	statuses []int // responses to return before accepting, in order
+	attempts int
+}
+
+func newPushServer(t *testing.T, statuses ...int) *pushServer {
+	t.Helper()
+	s := &pushServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.attempts++
+
+		if r.URL.Path != "/loki/api/v1/push" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if len(s.statuses) > 0 {
+			status := s.statuses[0]
+			s.statuses = s.statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+
+		var push pushRequest
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.pushes = append(s.pushes, push)
+		s.tenants = append(s.tenants, r.Header.Get("X-Scope-OrgID"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestWriter(t *testing.T, config map[string]interface{}) *Writer {
+	t.Helper()
+	c, err := NewWriter(component.Config{Type: "loki.write", Name: "default", Config: config})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	w := c.(*Writer)
+	w.retryBackoff = time.Millisecond
+	return w
+}
+
+func counterValue(t *testing.T, c interface{ Write(*dto.Metric) error }) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestWriter_PushesStreams(t *testing.T) {
+	srv := newPushServer(t)
+	w := newTestWriter(t, map[string]interface{}{
+		"endpoint":  srv.URL + "/loki/api/v1/push",
+		"tenant_id": "team-a",
+	})
+
+	ts := time.Unix(1700000000, 5)
+	app := map[string]string{"job": "app", "filename": "/var/log/app.log"}
+	db := map[string]string{"job": "db"}
+	w.flush(context.Background(), []Entry{
+		{Labels: app, Timestamp: ts, Line: "starting"},
+		{Labels: db, Timestamp: ts, Line: "ready"},
+		{Labels: map[string]string{"filename": "/var/log/app.log", "job": "app"}, Timestamp: ts.Add(time.Second), Line: "listening"},
+	})
+
+	if len(srv.pushes) != 1 {
+		t.Fatalf("expected 1 push, got %d", len(srv.pushes))
+	}
+	if srv.tenants[0] != "team-a" {
+		t.Errorf("expected X-Scope-OrgID team-a, got %q", srv.tenants[0])
+	}
+
+	want := []pushStream{
+		{Stream: app, Values: [][2]string{{"1700000000000000005", "starting"}, {"1700000001000000005", "listening"}}},
+		{Stream: db, Values: [][2]string{{"1700000000000000005", "ready"}}},
+	}
+	if got := srv.pushes[0].Streams; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected streams %+v, got %+v", want, got)
+	}
+	if sent := counterValue(t, w.entriesSent); sent != 3 {
+		t.Errorf("expected 3 entries sent, got %v", sent)
+	}
+}
+
+func TestWriter_BatchesFromReceiver(t *testing.T) {
+	srv := newPushServer(t)
+	w := newTestWriter(t, map[string]interface{}{
+		"endpoint":   srv.URL + "/loki/api/v1/push",
+		"batch_size": 2,
+		"batch_wait": "1h",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	labels := map[string]string{"job": "app"}
+	w.Exports()["receiver"].(Receiver) <- []Entry{
+		{Labels: labels, Timestamp: time.Now(), Line: "one"},
+		{Labels: labels, Timestamp: time.Now(), Line: "two"},
+		{Labels: labels, Timestamp: time.Now(), Line: "three"},
+	}
+	for deadline := time.Now().Add(2 * time.Second); counterValue(t, w.entriesSent) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("full batch was not pushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The remainder is flushed on shutdown
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.pushes) != 2 || len(srv.pushes[0].Streams[0].Values) != 2 || len(srv.pushes[1].Streams[0].Values) != 1 {
+		t.Errorf("expected batches of 2 and 1 entries, got %+v", srv.pushes)
+	}
+}
+
+func TestWriter_RetriesThenSucceeds(t *testing.T) {
+	srv := newPushServer(t, http.StatusTooManyRequests, http.StatusServiceUnavailable)
+	w := newTestWriter(t, map[string]interface{}{"endpoint": srv.URL + "/loki/api/v1/push"})
+
+	w.flush(context.Background(), []Entry{{Labels: map[string]string{"job": "app"}, Line: "x"}})
+
+	if srv.attempts != 3 || len(srv.pushes) != 1 {
+		t.Errorf("expected push to succeed on the third attempt, got %d attempts and %d pushes", srv.attempts, len(srv.pushes))
+	}
+	if dropped := counterValue(t, w.entriesDropped); dropped != 0 {
+		t.Errorf("expected nothing dropped, got %v", dropped)
+	}
+}
+
+func TestWriter_DropsAfterRepeatedFailures(t *testing.T) {
+	statuses := make([]int, defaultMaxRetries+1)
+	for i := range statuses {
+		statuses[i] = http.StatusBadGateway
+	}
+	srv := newPushServer(t, statuses...)
+	w := newTestWriter(t, map[string]interface{}{"endpoint": srv.URL + "/loki/api/v1/push"})
+
+	labels := map[string]string{"job": "app"}
+	w.flush(context.Background(), []Entry{{Labels: labels, Line: "a"}, {Labels: labels, Line: "b"}})
+
+	if srv.attempts != defaultMaxRetries+1 {
+		t.Errorf("expected %d attempts, got %d", defaultMaxRetries+1, srv.attempts)
+	}
+	if dropped := counterValue(t, w.entriesDropped); dropped != 2 {
+		t.Errorf("expected 2 entries dropped, got %v", dropped)
+	}
+	if w.Health().Status != component.StatusDegraded {
+		t.Errorf("expected degraded, got %v", w.Health())
+	}
+}
+
+func TestWriter_DoesNotRetryClientErrors(t *testing.T) {
+	srv := newPushServer(t, http.StatusBadRequest)
+	w := newTestWriter(t, map[string]interface{}{"endpoint": srv.URL + "/loki/api/v1/push"})
+
+	w.flush(context.Background(), []Entry{{Labels: map[string]string{"job": "app"}, Line: "x"}})
+
+	if srv.attempts != 1 {
+		t.Errorf("expected a 400 not to be retried, got %d attempts", srv.attempts)
+	}
+	if dropped := counterValue(t, w.entriesDropped); dropped != 1 {
+		t.Errorf("expected 1 entry dropped, got %v", dropped)
+	}
+}
+
+func TestWriter_BasicAuth(t *testing.T) {
+	var user, password string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ = r.BasicAuth()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := newTestWriter(t, map[string]interface{}{
+		"endpoint":   srv.URL,
+		"basic_auth": []interface{}{map[string]interface{}{"username": "12345", "password": "token"}},
+	})
+	w.flush(context.Background(), []Entry{{Labels: map[string]string{"job": "app"}, Line: "x"}})
+
+	if user != "12345" || password != "token" {
+		t.Errorf("expected basic auth credentials, got %q/%q", user, password)
+	}
+}
+
+func TestNewWriter_Config(t *testing.T) {
+	for name, tt := range map[string]struct {
+		config  map[string]interface{}
+		wantErr string
+	}{
+		"missing endpoint": {map[string]interface{}{}, "endpoint must be an http or https URL"},
+		"bad batch_size":   {map[string]interface{}{"endpoint": "http://loki", "batch_size": -1}, "batch_size must be a positive"},
+		"bad batch_wait":   {map[string]interface{}{"endpoint": "http://loki", "batch_wait": "0s"}, "batch_wait must be positive"},
+		"empty tenant":     {map[string]interface{}{"endpoint": "http://loki", "tenant_id": ""}, "tenant_id must be"},
+	} {
+		_, err := NewWriter(component.Config{Type: "loki.write", Name: "default", Config: tt.config})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func init() {
+	component.DefaultRegistry.Register("prometheus.receive", NewReceiver)
+}
+
+const (
+	defaultReceiveAddress = ":9009"
+	defaultReceivePath    = "/api/v1/push"
+
+	// defaultMaxRequestSize caps the compressed body of a push
+	defaultMaxRequestSize = 10 << 20
+
+	// maxDecodedSize caps the uncompressed payload, so a small body can't
+	// claim a huge decoded length
+	maxDecodedSize = 64 << 20
+)
+
+// errPayloadTooLarge marks a push rejected for its size
+var errPayloadTooLarge = errors.New("payload too large")
+
+// RemoteWriteReceiver implements component.Component for accepting
+// Prometheus remote_write pushes. Each pushed series is forwarded
+// downstream the same way scraped samples are.
+type RemoteWriteReceiver struct {
+	id             string
+	address        string
+	path           string
+	maxRequestSize int64
+	forwardTo      []Receiver
+
+	mu     sync.Mutex
+	health component.Health
+}
+
+func NewReceiver(cfg component.Config) (component.Component, error) {
+	r := &RemoteWriteReceiver{
+		id:             cfg.ID(),
+		address:        defaultReceiveAddress,
+		path:           defaultReceivePath,
+		maxRequestSize: defaultMaxRequestSize,
+		health: component.Health{
+			Status:  component.StatusHealthy,
+			Message: "initialized",
+		},
+	}
+
+	if v, ok := cfg.Config["listen_address"]; ok {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s: listen_address must be a non-empty string", r.id)
+		}
+		r.address = s
+	}
+	if v, ok := cfg.Config["path"]; ok {
+		s, ok := v.(string)
+		if !ok || len(s) == 0 || s[0] != '/' {
+			return nil, fmt.Errorf("%s: path must start with /", r.id)
+		}
+		r.path = s
+	}
+	if v, ok := cfg.Config["max_request_size"]; ok {
+		n, ok := v.(int)
+		if !ok || n <= 0 {
+			return nil, fmt.Errorf("%s: max_request_size must be a positive number of bytes", r.id)
+		}
+		r.maxRequestSize = int64(n)
+	}
+
+	forwardTo, err := parseForwardTo(cfg.Config["forward_to"])
+	if err != nil {
+		return nil, err
+	}
+	r.forwardTo = forwardTo
+
+	return r, nil
+}
+
+func (r *RemoteWriteReceiver) ID() string {
+	return r.id
+}
+
+func (r *RemoteWriteReceiver) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(r.path, r)
+
+	srv := &http.Server{
+		Addr:              r.address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("starting remote write receiver",
+			"id", r.id,
+			"address", r.address,
+			"path", r.path)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		slog.Info("stopping remote write receiver", "id", r.id)
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		return fmt.Errorf("%s: %w", r.id, err)
+	}
+}
+
+// ServeHTTP handles a single remote_write push
+func (r *RemoteWriteReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	samples, err := r.decodeRequest(req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errPayloadTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		slog.Warn("rejected remote write push",
+			"id", r.id,
+			"remote_addr", req.RemoteAddr,
+			"error", err)
+		r.setHealth(component.StatusDegraded, fmt.Sprintf("rejected push: %s", err))
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	for _, receiver := range r.forwardTo {
+		select {
+		case receiver <- samples:
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	r.setHealth(component.StatusHealthy, "receiving successfully")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeRequest reads a snappy-compressed WriteRequest and flattens it
+// into samples
+func (r *RemoteWriteReceiver) decodeRequest(req *http.Request) ([]Sample, error) {
+	if enc := req.Header.Get("Content-Encoding"); enc != "" && enc != "snappy" {
+		return nil, fmt.Errorf("unsupported content encoding %q", enc)
+	}
+	if req.ContentLength > r.maxRequestSize {
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", errPayloadTooLarge, req.ContentLength, r.maxRequestSize)
+	}
+
+	compressed, err := io.ReadAll(io.LimitReader(req.Body, r.maxRequestSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if int64(len(compressed)) > r.maxRequestSize {
+		return nil, fmt.Errorf("%w: body exceeds %d bytes", errPayloadTooLarge, r.maxRequestSize)
+	}
+
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy payload: %w", err)
+	}
+	if n > maxDecodedSize {
+		return nil, fmt.Errorf("%w: decoded size %d exceeds %d", errPayloadTooLarge, n, maxDecodedSize)
+	}
+	payload, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy payload: %w", err)
+	}
+
+	return decodeWriteRequest(payload)
+}
+
+func (r *RemoteWriteReceiver) setHealth(status component.Status, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health = component.Health{Status: status, Message: message}
+}
+
+func (r *RemoteWriteReceiver) Health() component.Health {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.health
+}
+
+// decodeWriteRequest parses a prometheus.WriteRequest protobuf:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+//
+// Metadata and other fields are skipped. Every series must carry a
+// __name__ and unique, non-empty label names.
+func decodeWriteRequest(b []byte) ([]Sample, error) {
+	var samples []Sample
+	err := eachField(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		if typ != protowire.BytesType {
+			return fmt.Errorf("timeseries: unexpected wire type %d", typ)
+		}
+		series, err := decodeTimeSeries(v)
+		if err != nil {
+			return fmt.Errorf("timeseries %d: %w", len(samples), err)
+		}
+		samples = append(samples, series...)
+		return nil
+	})
+	return samples, err
+}
+
+func decodeTimeSeries(b []byte) ([]Sample, error) {
+	labels := make(map[string]string)
+	type point struct {
+		value     float64
+		timestamp int64
+	}
+	var points []point
+
+	err := eachField(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			if typ != protowire.BytesType {
+				return fmt.Errorf("label: unexpected wire type %d", typ)
+			}
+			var name, value string
+			err := eachField(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ != protowire.BytesType {
+					return nil
+				}
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if name == "" {
+				return fmt.Errorf("empty label name")
+			}
+			if _, dup := labels[name]; dup {
+				return fmt.Errorf("duplicate label %s", name)
+			}
+			labels[name] = value
+
+		case 2:
+			if typ != protowire.BytesType {
+				return fmt.Errorf("sample: unexpected wire type %d", typ)
+			}
+			var p point
+			err := eachField(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					bits, _ := protowire.ConsumeFixed64(v)
+					p.value = math.Float64frombits(bits)
+				case num == 2 && typ == protowire.VarintType:
+					ts, _ := protowire.ConsumeVarint(v)
+					p.timestamp = int64(ts)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			points = append(points, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if labels["__name__"] == "" {
+		return nil, fmt.Errorf("missing __name__ label")
+	}
+
+	samples := make([]Sample, 0, len(points))
+	for i, p := range points {
+		sampleLabels := labels
+		if i > 0 {
+			// Downstream components may modify labels in place
+			sampleLabels = make(map[string]string, len(labels))
+			for k, v := range labels {
+				sampleLabels[k] = v
+			}
+		}
+		samples = append(samples, Sample{Labels: sampleLabels, Value: p.value, Timestamp: p.timestamp})
+	}
+	return samples, nil
+}
+
+// eachField calls fn for every top-level field in a protobuf message. For
+// length-delimited fields v is the payload; for other types it is the raw
+// encoded value.
+func eachField(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("malformed protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("malformed protobuf: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
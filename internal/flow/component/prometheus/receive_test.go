@@ -0,0 +1,164 @@
+package prometheus
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testSeries struct {
+	labels  [][2]string
+	samples [][2]float64 // value, timestamp
+}
+
+// encodeWriteRequest builds a remote_write WriteRequest protobuf
+func encodeWriteRequest(series ...testSeries) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for _, l := range s.labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l[0])
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l[1])
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+		for _, p := range s.samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(p[0]))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(int64(p[1])))
+
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sample)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+func newTestReceiver(t *testing.T, config map[string]interface{}) (*RemoteWriteReceiver, Receiver) {
+	t.Helper()
+	out := make(Receiver, 1)
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	config["forward_to"] = []interface{}{out}
+
+	c, err := NewReceiver(component.Config{Type: "prometheus.receive", Name: "default", Config: config})
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+	return c.(*RemoteWriteReceiver), out
+}
+
+func push(r http.Handler, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/v1/push", bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestReceiver_IngestsRemoteWrite(t *testing.T) {
+	r, out := newTestReceiver(t, nil)
+
+	payload := encodeWriteRequest(
+		testSeries{
+			labels:  [][2]string{{"__name__", "http_requests_total"}, {"job", "api"}},
+			samples: [][2]float64{{10, 1700000000000}, {12, 1700000015000}},
+		},
+		testSeries{
+			labels:  [][2]string{{"__name__", "up"}, {"job", "api"}},
+			samples: [][2]float64{{1, 1700000000000}},
+		},
+	)
+
+	rec := push(r, snappy.Encode(nil, payload))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	got := <-out
+	want := []Sample{
+		{Labels: map[string]string{"__name__": "http_requests_total", "job": "api"}, Value: 10, Timestamp: 1700000000000},
+		{Labels: map[string]string{"__name__": "http_requests_total", "job": "api"}, Value: 12, Timestamp: 1700000015000},
+		{Labels: map[string]string{"__name__": "up", "job": "api"}, Value: 1, Timestamp: 1700000000000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if r.Health().Status != component.StatusHealthy {
+		t.Errorf("expected healthy, got %v", r.Health())
+	}
+}
+
+func TestReceiver_RejectsInvalidPayloads(t *testing.T) {
+	r, out := newTestReceiver(t, map[string]interface{}{"max_request_size": 64})
+
+	tests := []struct {
+		name string
+		body []byte
+		want int
+	}{
+		{"not snappy", []byte("hello"), http.StatusBadRequest},
+		{"not protobuf", snappy.Encode(nil, []byte{0xff, 0xff, 0xff}), http.StatusBadRequest},
+		{"missing metric name", snappy.Encode(nil, encodeWriteRequest(testSeries{
+			labels: [][2]string{{"job", "api"}}, samples: [][2]float64{{1, 0}},
+		})), http.StatusBadRequest},
+		{"duplicate label", snappy.Encode(nil, encodeWriteRequest(testSeries{
+			labels: [][2]string{{"__name__", "up"}, {"job", "a"}, {"job", "b"}}, samples: [][2]float64{{1, 0}},
+		})), http.StatusBadRequest},
+		{"oversized body", bytes.Repeat([]byte{0}, 65), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		if rec := push(r, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	select {
+	case samples := <-out:
+		t.Errorf("expected nothing forwarded, got %v", samples)
+	default:
+	}
+	if r.Health().Status != component.StatusDegraded {
+		t.Errorf("expected degraded after rejected pushes, got %v", r.Health())
+	}
+}
+
+func TestReceiver_RejectsOversizedDecodedPayload(t *testing.T) {
+	r, _ := newTestReceiver(t, nil)
+
+	// A valid snappy header claiming a decoded size beyond the limit
+	header := protowire.AppendVarint(nil, maxDecodedSize+1)
+	if rec := push(r, header); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReceiver_Config(t *testing.T) {
+	for name, config := range map[string]map[string]interface{}{
+		"empty address":     {"listen_address": ""},
+		"relative path":     {"path": "push"},
+		"negative max size": {"max_request_size": -1},
+		"string max size":   {"max_request_size": "10MB"},
+	} {
+		if _, err := NewReceiver(component.Config{Type: "prometheus.receive", Name: "default", Config: config}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Relabel actions, matching upstream Prometheus
+const (
+	RelabelReplace  = "replace"
+	RelabelKeep     = "keep"
+	RelabelDrop     = "drop"
+	RelabelLabelMap = "labelmap"
+)
+
+// RelabelConfig rewrites or filters samples by their labels. The values of
+// SourceLabels are joined with Separator and matched against Regex, which
+// is anchored at both ends.
+type RelabelConfig struct {
+	SourceLabels []string
+	Separator    string
+	Regex        *regexp.Regexp
+	Action       string
+	TargetLabel  string
+	Replacement  string
+}
+
+// parseRelabelConfigs reads relabel_config blocks:
+//
+//	relabel_config {
+//	  source_labels = ["__name__"]
+//	  regex         = "go_.*"
+//	  action        = "drop"
+//	}
+func parseRelabelConfigs(raw interface{}) ([]RelabelConfig, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("relabel_config must be a list of blocks")
+	}
+
+	configs := make([]RelabelConfig, 0, len(list))
+	for i, entry := range list {
+		block, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("relabel_config[%d]: expected a block", i)
+		}
+		rc, err := parseRelabelConfig(block)
+		if err != nil {
+			return nil, fmt.Errorf("relabel_config[%d]: %w", i, err)
+		}
+		configs = append(configs, rc)
+	}
+	return configs, nil
+}
+
+func parseRelabelConfig(block map[string]interface{}) (RelabelConfig, error) {
+	rc := RelabelConfig{
+		Separator:   ";",
+		Action:      RelabelReplace,
+		Replacement: "$1",
+	}
+	pattern := "(.*)"
+
+	for key, v := range block {
+		switch key {
+		case "source_labels":
+			list, ok := v.([]interface{})
+			if !ok {
+				return rc, fmt.Errorf("source_labels must be a list of strings")
+			}
+			for _, item := range list {
+				s, ok := item.(string)
+				if !ok {
+					return rc, fmt.Errorf("source_labels must be a list of strings")
+				}
+				rc.SourceLabels = append(rc.SourceLabels, s)
+			}
+		case "separator", "regex", "action", "target_label", "replacement":
+			s, ok := v.(string)
+			if !ok {
+				return rc, fmt.Errorf("%s must be a string", key)
+			}
+			switch key {
+			case "separator":
+				rc.Separator = s
+			case "regex":
+				pattern = s
+			case "action":
+				rc.Action = s
+			case "target_label":
+				rc.TargetLabel = s
+			case "replacement":
+				rc.Replacement = s
+			}
+		default:
+			return rc, fmt.Errorf("unknown attribute %q", key)
+		}
+	}
+
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return rc, fmt.Errorf("invalid regex: %w", err)
+	}
+	rc.Regex = re
+
+	switch rc.Action {
+	case RelabelReplace:
+		if rc.TargetLabel == "" {
+			return rc, fmt.Errorf("replace requires target_label")
+		}
+	case RelabelKeep, RelabelDrop:
+		if len(rc.SourceLabels) == 0 {
+			return rc, fmt.Errorf("%s requires source_labels", rc.Action)
+		}
+	case RelabelLabelMap:
+	default:
+		return rc, fmt.Errorf("unknown action %q", rc.Action)
+	}
+	return rc, nil
+}
+
+// relabel applies configs in order to every sample, returning the samples
+// that weren't dropped
+func relabel(samples []Sample, configs []RelabelConfig) []Sample {
+	if len(configs) == 0 {
+		return samples
+	}
+
+	kept := samples[:0]
+	for _, sample := range samples {
+		if relabelSample(sample.Labels, configs) {
+			kept = append(kept, sample)
+		}
+	}
+	return kept
+}
+
+// relabelSample rewrites labels in place and reports whether the sample
+// should be kept
+func relabelSample(labels map[string]string, configs []RelabelConfig) bool {
+	for _, rc := range configs {
+		values := make([]string, len(rc.SourceLabels))
+		for i, name := range rc.SourceLabels {
+			values[i] = labels[name]
+		}
+		value := strings.Join(values, rc.Separator)
+
+		switch rc.Action {
+		case RelabelKeep:
+			if !rc.Regex.MatchString(value) {
+				return false
+			}
+		case RelabelDrop:
+			if rc.Regex.MatchString(value) {
+				return false
+			}
+		case RelabelReplace:
+			match := rc.Regex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			result := string(rc.Regex.ExpandString(nil, rc.Replacement, value, match))
+			if result == "" {
+				delete(labels, rc.TargetLabel)
+			} else {
+				labels[rc.TargetLabel] = result
+			}
+		case RelabelLabelMap:
+			mapped := make(map[string]string)
+			for name, v := range labels {
+				if rc.Regex.MatchString(name) {
+					mapped[rc.Regex.ReplaceAllString(name, rc.Replacement)] = v
+				}
+			}
+			for name, v := range mapped {
+				labels[name] = v
+			}
+		}
+	}
+	return true
+}
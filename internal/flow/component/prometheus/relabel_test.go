@@ -0,0 +1,188 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+func testSamples() []Sample {
+	return []Sample{
+		{Labels: map[string]string{"__name__": "http_requests_total", "job": "api", "instance": "api-1:8080"}, Value: 10},
+		{Labels: map[string]string{"__name__": "go_goroutines", "job": "api", "instance": "api-1:8080"}, Value: 42},
+		{Labels: map[string]string{"__name__": "go_gc_duration_seconds", "job": "db", "instance": "db-1:9187"}, Value: 0.1},
+	}
+}
+
+func mustParseRelabel(t *testing.T, blocks ...map[string]interface{}) []RelabelConfig {
+	t.Helper()
+	raw := make([]interface{}, len(blocks))
+	for i, b := range blocks {
+		raw[i] = b
+	}
+	configs, err := parseRelabelConfigs(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return configs
+}
+
+func sampleNames(samples []Sample) []string {
+	names := make([]string, len(samples))
+	for i, s := range samples {
+		names[i] = s.Labels["__name__"]
+	}
+	return names
+}
+
+func TestRelabel_Drop(t *testing.T) {
+	configs := mustParseRelabel(t, map[string]interface{}{
+		"source_labels": []interface{}{"__name__"},
+		"regex":         "go_.*",
+		"action":        "drop",
+	})
+
+	got := sampleNames(relabel(testSamples(), configs))
+	if !reflect.DeepEqual(got, []string{"http_requests_total"}) {
+		t.Errorf("expected go_ metrics dropped, got %v", got)
+	}
+}
+
+func TestRelabel_Keep(t *testing.T) {
+	configs := mustParseRelabel(t, map[string]interface{}{
+		"source_labels": []interface{}{"job", "__name__"},
+		"regex":         "api;.*",
+		"action":        "keep",
+	})
+
+	got := sampleNames(relabel(testSamples(), configs))
+	if !reflect.DeepEqual(got, []string{"http_requests_total", "go_goroutines"}) {
+		t.Errorf("expected only api samples kept, got %v", got)
+	}
+}
+
+func TestRelabel_Replace(t *testing.T) {
+	configs := mustParseRelabel(t,
+		map[string]interface{}{
+			"source_labels": []interface{}{"instance"},
+			"regex":         "([^:]+):\\d+",
+			"target_label":  "host",
+		},
+		map[string]interface{}{
+			"source_labels": []interface{}{"job"},
+			"regex":         "db",
+			"target_label":  "team",
+			"replacement":   "storage",
+		},
+	)
+
+	samples := relabel(testSamples(), configs)
+	if len(samples) != 3 {
+		t.Fatalf("replace must not drop samples, got %d", len(samples))
+	}
+	if samples[0].Labels["host"] != "api-1" || samples[2].Labels["host"] != "db-1" {
+		t.Errorf("expected host from instance, got %v and %v", samples[0].Labels, samples[2].Labels)
+	}
+	if _, ok := samples[0].Labels["team"]; ok {
+		t.Errorf("non-matching sample must not get team, got %v", samples[0].Labels)
+	}
+	if samples[2].Labels["team"] != "storage" {
+		t.Errorf("expected team=storage, got %v", samples[2].Labels)
+	}
+}
+
+func TestRelabel_LabelMap(t *testing.T) {
+	configs := mustParseRelabel(t, map[string]interface{}{
+		"regex":  "__meta_(.+)",
+		"action": "labelmap",
+	})
+
+	samples := []Sample{{Labels: map[string]string{"__name__": "up", "__meta_zone": "eu-1"}}}
+	samples = relabel(samples, configs)
+	if samples[0].Labels["zone"] != "eu-1" {
+		t.Errorf("expected zone label mapped, got %v", samples[0].Labels)
+	}
+}
+
+func TestRelabel_ActionsInOrder(t *testing.T) {
+	// The replace runs first, so the drop sees the rewritten label
+	configs := mustParseRelabel(t,
+		map[string]interface{}{
+			"source_labels": []interface{}{"job"},
+			"regex":         "db",
+			"target_label":  "tier",
+			"replacement":   "internal",
+		},
+		map[string]interface{}{
+			"source_labels": []interface{}{"tier"},
+			"regex":         "internal",
+			"action":        "drop",
+		},
+	)
+
+	got := sampleNames(relabel(testSamples(), configs))
+	if !reflect.DeepEqual(got, []string{"http_requests_total", "go_goroutines"}) {
+		t.Errorf("expected db sample dropped, got %v", got)
+	}
+}
+
+func TestParseRelabelConfigs_Errors(t *testing.T) {
+	tests := []struct {
+		block   map[string]interface{}
+		wantErr string
+	}{
+		{map[string]interface{}{"action": "explode"}, "unknown action"},
+		{map[string]interface{}{"action": "drop"}, "drop requires source_labels"},
+		{map[string]interface{}{"source_labels": []interface{}{"job"}}, "replace requires target_label"},
+		{map[string]interface{}{"regex": "(", "action": "labelmap"}, "invalid regex"},
+		{map[string]interface{}{"modulus": 2}, "unknown attribute"},
+	}
+	for _, tt := range tests {
+		_, err := parseRelabelConfigs([]interface{}{tt.block})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v: expected error containing %q, got %v", tt.block, tt.wantErr, err)
+		}
+	}
+}
+
+func TestScraper_AppliesRelabelConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, "up 1\ngo_goroutines 12\n")
+	}))
+	defer srv.Close()
+
+	receiver := make(Receiver, 1)
+	comp, err := NewScraper(component.Config{
+		Type: "prometheus.scrape",
+		Name: "test",
+		Config: map[string]interface{}{
+			"forward_to": []interface{}{receiver},
+			"relabel_config": []interface{}{
+				map[string]interface{}{
+					"source_labels": []interface{}{"__name__"},
+					"regex":         "go_.*",
+					"action":        "drop",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	target := Target{Address: strings.TrimPrefix(srv.URL, "http://")}
+	if err := comp.(*Scraper).scrapeTarget(context.Background(), target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := sampleNames(<-receiver); !reflect.DeepEqual(got, []string{"up"}) {
+		t.Errorf("expected go_ metrics dropped before forwarding, got %v", got)
+	}
+}
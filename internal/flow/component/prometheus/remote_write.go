@@ -0,0 +1,297 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/component/httpclient"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func init() {
+	component.DefaultRegistry.Register("prometheus.remote_write", NewRemoteWriter)
+}
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = 5 * time.Second
+
+	// Failed sends are retried with exponential backoff starting at
+	// defaultRetryBackoff
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+
+	// receiverBuffer is how many batches producers can queue before
+	// forwarding blocks
+	receiverBuffer = 16
+
+	// shutdownFlushTimeout bounds the final flush when the writer stops
+	shutdownFlushTimeout = 5 * time.Second
+)
+
+// RemoteWriter implements component.Component for shipping samples to a
+// Prometheus remote_write endpoint. It exports a "receiver" that producers
+// such as prometheus.scrape list in their forward_to.
+type RemoteWriter struct {
+	id            string
+	endpoint      string
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	retryBackoff  time.Duration
+	receiver      Receiver
+	httpClient    *http.Client
+
+	mu     sync.Mutex
+	health component.Health
+
+	// Metrics
+	samplesSent  prometheus.Counter
+	sendFailures prometheus.Counter
+}
+
+func NewRemoteWriter(cfg component.Config) (component.Component, error) {
+	w := &RemoteWriter{
+		id:            cfg.ID(),
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		maxRetries:    defaultMaxRetries,
+		retryBackoff:  defaultRetryBackoff,
+		receiver:      make(Receiver, receiverBuffer),
+		health: component.Health{
+			Status:  component.StatusHealthy,
+			Message: "initialized",
+		},
+		samplesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_remote_write_samples_total",
+			Help: "Total number of samples sent to the remote_write endpoint",
+		}),
+		sendFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_remote_write_failures_total",
+			Help: "Total number of batches that could not be sent",
+		}),
+	}
+
+	endpoint, _ := cfg.Config["endpoint"].(string)
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf("%s: endpoint must be an http or https URL", w.id)
+	}
+	w.endpoint = endpoint
+
+	if v, ok := cfg.Config["batch_size"]; ok {
+		n, ok := v.(int)
+		if !ok || n <= 0 {
+			return nil, fmt.Errorf("%s: batch_size must be a positive number of samples", w.id)
+		}
+		w.batchSize = n
+	}
+	if v, ok := cfg.Config["flush_interval"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: flush_interval must be a duration string such as \"5s\"", w.id)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid flush_interval: %w", w.id, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("%s: flush_interval must be positive, got %s", w.id, s)
+		}
+		w.flushInterval = d
+	}
+
+	clientConfig, err := httpclient.Parse(cfg.Config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", w.id, err)
+	}
+	w.httpClient, err = httpclient.New(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", w.id, err)
+	}
+
+	return w, nil
+}
+
+func (w *RemoteWriter) ID() string {
+	return w.id
+}
+
+func (w *RemoteWriter) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{w.samplesSent, w.sendFailures}
+}
+
+func (w *RemoteWriter) Exports() map[string]interface{} {
+	return map[string]interface{}{"receiver": w.receiver}
+}
+
+// Run batches incoming samples and sends a batch once it reaches
+// batch_size or flush_interval has passed. Pending samples are flushed
+// when ctx is cancelled.
+func (w *RemoteWriter) Run(ctx context.Context) error {
+	slog.Info("starting remote writer",
+		"id", w.id,
+		"endpoint", w.endpoint,
+		"batch_size", w.batchSize,
+		"flush_interval", w.flushInterval)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	var pending []Sample
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+			defer cancel()
+			for len(pending) > 0 {
+				n := min(len(pending), w.batchSize)
+				w.flush(flushCtx, pending[:n])
+				pending = pending[n:]
+			}
+			slog.Info("stopping remote writer", "id", w.id)
+			return nil
+		case samples := <-w.receiver:
+			pending = append(pending, samples...)
+			for len(pending) >= w.batchSize {
+				w.flush(ctx, pending[:w.batchSize])
+				pending = pending[w.batchSize:]
+			}
+		case <-ticker.C:
+			if len(pending) > 0 {
+				w.flush(ctx, pending)
+				pending = nil
+			}
+		}
+	}
+}
+
+// flush sends one batch, recording the outcome in the writer's metrics
+// and health
+func (w *RemoteWriter) flush(ctx context.Context, batch []Sample) {
+	if err := w.send(ctx, batch); err != nil {
+		slog.Error("remote write failed",
+			"id", w.id,
+			"samples", len(batch),
+			"error", err)
+		w.sendFailures.Inc()
+		w.setHealth(component.StatusDegraded, fmt.Sprintf("remote write failures: %s", err))
+		return
+	}
+	w.samplesSent.Add(float64(len(batch)))
+	w.setHealth(component.StatusHealthy, "writing successfully")
+}
+
+// send posts batch to the endpoint, retrying network errors and 5xx
+// responses with exponential backoff
+func (w *RemoteWriter) send(ctx context.Context, batch []Sample) error {
+	body := snappy.Encode(nil, encodeSamples(batch))
+	backoff := w.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.maxRetries {
+			return err
+		}
+
+		slog.Warn("retrying remote write",
+			"id", w.id,
+			"attempt", attempt+1,
+			"error", err)
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// post makes a single request and reports whether a failure is worth
+// retrying
+func (w *RemoteWriter) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to send: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	return resp.StatusCode/100 == 5, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+}
+
+func (w *RemoteWriter) setHealth(status component.Status, message string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.health = component.Health{Status: status, Message: message}
+}
+
+func (w *RemoteWriter) Health() component.Health {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.health
+}
+
+// encodeSamples builds a WriteRequest protobuf, the inverse of
+// decodeWriteRequest, with one series per sample. Labels are sorted by
+// name as remote_write requires.
+func encodeSamples(samples []Sample) []byte {
+	var req []byte
+	for _, s := range samples {
+		names := make([]string, 0, len(s.Labels))
+		for name := range s.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var ts []byte
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, s.Labels[name])
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
@@ -0,0 +1,251 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// remoteWriteServer records the samples of every push it accepts
+type remoteWriteServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests [][]Sample
+	statuses []int // responses to return before accepting, in order
+	received chan struct{}
+}
+
+func newRemoteWriteServer(t *testing.T, statuses ...int) *remoteWriteServer {
+	t.Helper()
+	s := &remoteWriteServer{statuses: statuses, received: make(chan struct{}, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			http.Error(w, "bad headers", http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		if len(s.statuses) > 0 {
+			status := s.statuses[0]
+			s.statuses = s.statuses[1:]
+			s.mu.Unlock()
+			w.WriteHeader(status)
+			return
+		}
+		s.mu.Unlock()
+
+		compressed, _ := io.ReadAll(r.Body)
+		payload, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		samples, err := decodeWriteRequest(payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, samples)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		s.received <- struct{}{}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *remoteWriteServer) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a remote write request")
+	}
+}
+
+func (s *remoteWriteServer) batches() [][]Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]Sample(nil), s.requests...)
+}
+
+func newTestRemoteWriter(t *testing.T, config map[string]interface{}) *RemoteWriter {
+	t.Helper()
+	comp, err := NewRemoteWriter(component.Config{Type: "prometheus.remote_write", Name: "default", Config: config})
+	if err != nil {
+		t.Fatalf("failed to create remote writer: %v", err)
+	}
+	w := comp.(*RemoteWriter)
+	w.retryBackoff = time.Millisecond
+	return w
+}
+
+func counterValue(t *testing.T, c interface{ Write(*dto.Metric) error }) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestRemoteWriter_ShipsBatches(t *testing.T) {
+	srv := newRemoteWriteServer(t)
+	w := newTestRemoteWriter(t, map[string]interface{}{
+		"endpoint":       srv.URL + "/api/v1/write",
+		"batch_size":     2,
+		"flush_interval": "1h",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+
+	receiver := w.Exports()["receiver"].(Receiver)
+	receiver <- []Sample{
+		{Labels: map[string]string{"__name__": "up", "job": "api"}, Value: 1, Timestamp: 1000},
+		{Labels: map[string]string{"__name__": "up", "job": "db"}, Value: 0, Timestamp: 1000},
+		{Labels: map[string]string{"__name__": "http_requests_total", "code": "200"}, Value: 7, Timestamp: 2000},
+	}
+
+	// A full batch goes out immediately
+	srv.wait(t)
+	for deadline := time.Now().Add(2 * time.Second); counterValue(t, w.samplesSent) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("first batch was not recorded as sent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The remainder is flushed on shutdown
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	srv.wait(t)
+
+	batches := srv.batches()
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Fatalf("expected batches of 2 and 1 samples, got %v", batches)
+	}
+	if !reflect.DeepEqual(batches[0][1].Labels, map[string]string{"__name__": "up", "job": "db"}) || batches[0][1].Value != 0 {
+		t.Errorf("unexpected sample %+v", batches[0][1])
+	}
+	last := batches[1][0]
+	if last.Labels["code"] != "200" || last.Value != 7 || last.Timestamp != 2000 {
+		t.Errorf("unexpected sample %+v", last)
+	}
+	if sent := counterValue(t, w.samplesSent); sent != 3 {
+		t.Errorf("expected 3 samples sent, got %v", sent)
+	}
+}
+
+func TestRemoteWriter_FlushInterval(t *testing.T) {
+	srv := newRemoteWriteServer(t)
+	w := newTestRemoteWriter(t, map[string]interface{}{
+		"endpoint":       srv.URL,
+		"flush_interval": "20ms",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	w.receiver <- []Sample{{Labels: map[string]string{"__name__": "up"}, Value: 1}}
+	srv.wait(t)
+
+	if batches := srv.batches(); len(batches) != 1 || len(batches[0]) != 1 {
+		t.Errorf("expected the partial batch to be flushed, got %v", batches)
+	}
+}
+
+func TestRemoteWriter_RetriesServerErrors(t *testing.T) {
+	srv := newRemoteWriteServer(t, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	w := newTestRemoteWriter(t, map[string]interface{}{"endpoint": srv.URL})
+
+	batch := []Sample{{Labels: map[string]string{"__name__": "up"}, Value: 1}}
+	w.flush(context.Background(), batch)
+
+	if batches := srv.batches(); len(batches) != 1 {
+		t.Fatalf("expected the batch to arrive after retries, got %v", batches)
+	}
+	if failures := counterValue(t, w.sendFailures); failures != 0 {
+		t.Errorf("expected no failures after a successful retry, got %v", failures)
+	}
+	if w.Health().Status != component.StatusHealthy {
+		t.Errorf("expected healthy, got %v", w.Health())
+	}
+}
+
+func TestRemoteWriter_DoesNotRetryClientErrors(t *testing.T) {
+	srv := newRemoteWriteServer(t, http.StatusBadRequest)
+	w := newTestRemoteWriter(t, map[string]interface{}{"endpoint": srv.URL})
+
+	w.flush(context.Background(), []Sample{{Labels: map[string]string{"__name__": "up"}}})
+
+	if batches := srv.batches(); len(batches) != 0 {
+		t.Fatalf("expected 4xx not to be retried, got %v", batches)
+	}
+	if failures := counterValue(t, w.sendFailures); failures != 1 {
+		t.Errorf("expected 1 failure, got %v", failures)
+	}
+	if w.Health().Status != component.StatusDegraded {
+		t.Errorf("expected degraded, got %v", w.Health())
+	}
+}
+
+func TestRemoteWriter_BasicAuth(t *testing.T) {
+	var gotUser, gotPassword string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotPassword, _ = r.BasicAuth()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := newTestRemoteWriter(t, map[string]interface{}{
+		"endpoint": srv.URL,
+		"basic_auth": []interface{}{
+			map[string]interface{}{"username": "agent", "password": "hunter2"},
+		},
+	})
+	w.flush(context.Background(), []Sample{{Labels: map[string]string{"__name__": "up"}}})
+
+	if gotUser != "agent" || gotPassword != "hunter2" {
+		t.Errorf("expected basic auth credentials, got %q/%q", gotUser, gotPassword)
+	}
+}
+
+func TestNewRemoteWriter_Config(t *testing.T) {
+	for name, tt := range map[string]struct {
+		config  map[string]interface{}
+		wantErr string
+	}{
+		"missing endpoint":   {map[string]interface{}{}, "endpoint must be an http or https URL"},
+		"bad batch_size":     {map[string]interface{}{"endpoint": "http://x", "batch_size": 0}, "batch_size must be a positive"},
+		"bad flush_interval": {map[string]interface{}{"endpoint": "http://x", "flush_interval": "soon"}, "invalid flush_interval"},
+		"bad basic_auth":     {map[string]interface{}{"endpoint": "http://x", "basic_auth": "agent"}, "basic_auth must be a block"},
+	} {
+		_, err := NewRemoteWriter(component.Config{Type: "prometheus.remote_write", Name: "default", Config: tt.config})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", name, tt.wantErr, err)
+		}
+	}
+
+	w := newTestRemoteWriter(t, map[string]interface{}{"endpoint": "https://prometheus:9090/api/v1/write"})
+	if w.batchSize != defaultBatchSize || w.flushInterval != defaultFlushInterval {
+		t.Errorf("expected defaults, got batch_size %d flush_interval %s", w.batchSize, w.flushInterval)
+	}
+}
@@ -0,0 +1,71 @@
+package prometheus
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Sample is a single metric value produced by a scrape
+type Sample struct {
+	Labels    map[string]string
+	Value     float64
+	Timestamp int64 // Unix milliseconds
+}
+
+// Receiver accepts batches of samples. Components that consume samples,
+// such as prometheus.remote_write, export one as "receiver" so producers
+// can list it in their forward_to.
+type Receiver chan []Sample
+
+// parseForwardTo extracts the receivers referenced by a forward_to list
+func parseForwardTo(v interface{}) ([]Receiver, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, errInvalidForwardTo
+	}
+
+	receivers := make([]Receiver, 0, len(list))
+	for _, item := range list {
+		r, ok := item.(Receiver)
+		if !ok {
+			return nil, errInvalidForwardTo
+		}
+		receivers = append(receivers, r)
+	}
+	return receivers, nil
+}
+
+// staleNaNBits is the NaN Prometheus reserves for staleness markers
+const staleNaNBits = 0x7ff0000000000002
+
+// StaleNaN is the value of a staleness marker: a sample telling receivers
+// that its series ended rather than went quiet
+var StaleNaN = math.Float64frombits(staleNaNBits)
+
+// IsStaleNaN reports whether v is a staleness marker. It is a NaN, so it
+// can't be compared with ==.
+func IsStaleNaN(v float64) bool {
+	return math.Float64bits(v) == staleNaNBits
+}
+
+// seriesKey identifies a series by its label set
+func seriesKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(0xff)
+		b.WriteString(labels[name])
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
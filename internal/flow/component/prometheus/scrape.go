@@ -2,12 +2,20 @@ package prometheus
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/component/discovery"
+	"github.com/vjranagit/grafana/internal/flow/component/httpclient"
 )
 
 func init() {
@@ -16,52 +24,261 @@ func init() {
 
 // ScrapeConfig holds configuration for Prometheus scraping
 type ScrapeConfig struct {
-	Targets        []Target
+	Targets []Target
+
+	// Discovery holds the feeds of the discovery components whose
+	// targets are scraped alongside Targets
+	Discovery []*discovery.Feed
+
 	ScrapeInterval time.Duration
 	ScrapeTimeout  time.Duration
 	MetricsPath    string
+
+	// JobName is the job label of targets that don't set their own
+	JobName string
+
+	// HTTPClientConfig holds the credentials and TLS settings used for
+	// every target unless the target overrides them
+	HTTPClientConfig httpclient.Config
+
+	// RelabelConfigs are applied in order to every scraped sample
+	RelabelConfigs []RelabelConfig
+
+	// SampleLimit, LabelLimit and LabelValueLengthLimit reject a scrape
+	// that, after relabeling, has more samples, a sample with more labels,
+	// or a label value longer than they allow. Zero means no limit.
+	SampleLimit           int
+	LabelLimit            int
+	LabelValueLengthLimit int
 }
 
 // Target represents a scrape target
 type Target struct {
 	Address string
 	Labels  map[string]string
+
+	// HTTPClientConfig overrides the scrape-level settings for this target
+	HTTPClientConfig httpclient.Config
+
+	// client is built in NewScraper when the target has its own settings
+	client *http.Client
+}
+
+// parseScrapeDurations reads scrape_interval and scrape_timeout from raw,
+// keeping the defaults already in config for keys that aren't set
+func parseScrapeDurations(raw map[string]interface{}, config *ScrapeConfig) error {
+	for key, dst := range map[string]*time.Duration{
+		"scrape_interval": &config.ScrapeInterval,
+		"scrape_timeout":  &config.ScrapeTimeout,
+	} {
+		v, ok := raw[key]
+		if !ok {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a duration string such as \"30s\"", key)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", key, s)
+		}
+		*dst = d
+	}
+
+	if config.ScrapeTimeout > config.ScrapeInterval {
+		return fmt.Errorf("scrape_timeout (%s) must not exceed scrape_interval (%s)",
+			config.ScrapeTimeout, config.ScrapeInterval)
+	}
+	return nil
+}
+
+// parseScrapeLimits reads sample_limit, label_limit and
+// label_value_length_limit from raw
+func parseScrapeLimits(raw map[string]interface{}, config *ScrapeConfig) error {
+	for key, dst := range map[string]*int{
+		"sample_limit":             &config.SampleLimit,
+		"label_limit":              &config.LabelLimit,
+		"label_value_length_limit": &config.LabelValueLengthLimit,
+	} {
+		v, ok := raw[key]
+		if !ok {
+			continue
+		}
+		n, ok := v.(int)
+		if !ok || n < 0 {
+			return fmt.Errorf("%s must be a non-negative number, 0 for no limit", key)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+// errSampleLimit is returned for scrapes over their sample_limit
+var errSampleLimit = errors.New("sample limit exceeded")
+
+// checkLimits returns an error if samples exceed any of config's limits
+func checkLimits(samples []Sample, config ScrapeConfig) error {
+	if config.SampleLimit > 0 && len(samples) > config.SampleLimit {
+		return fmt.Errorf("%w: %d samples, limit %d", errSampleLimit, len(samples), config.SampleLimit)
+	}
+	if config.LabelLimit == 0 && config.LabelValueLengthLimit == 0 {
+		return nil
+	}
+	for _, sample := range samples {
+		if config.LabelLimit > 0 && len(sample.Labels) > config.LabelLimit {
+			return fmt.Errorf("label limit exceeded: %s has %d labels, limit %d",
+				sample.Labels["__name__"], len(sample.Labels), config.LabelLimit)
+		}
+		if config.LabelValueLengthLimit == 0 {
+			continue
+		}
+		for name, value := range sample.Labels {
+			if len(value) > config.LabelValueLengthLimit {
+				return fmt.Errorf("label value length limit exceeded: %s label %s is %d bytes, limit %d",
+					sample.Labels["__name__"], name, len(value), config.LabelValueLengthLimit)
+			}
+		}
+	}
+	return nil
+}
+
+// parseTargets reads the targets list. Each entry is either an address
+// string, an object carrying labels for that target's samples and,
+// optionally, its own basic_auth, bearer_token or tls_config, or the
+// targets export of a discovery component:
+//
+//	targets = [
+//	  "localhost:9090",
+//	  { address = "api:8080", labels = { job = "api" } },
+//	  { address = "https://db:9187/metrics", bearer_token = env("DB_TOKEN") },
+//	  discovery.dns.api.targets,
+//	]
+//
+// A discovery export can also be given on its own, without a list.
+func parseTargets(raw interface{}) ([]Target, []*discovery.Feed, error) {
+	if raw == nil {
+		return nil, nil, nil
+	}
+	if feed, ok := raw.(*discovery.Feed); ok {
+		return nil, []*discovery.Feed{feed}, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("targets must be a list")
+	}
+
+	targets := make([]Target, 0, len(list))
+	var feeds []*discovery.Feed
+	for i, entry := range list {
+		target := Target{Labels: make(map[string]string)}
+
+		switch v := entry.(type) {
+		case *discovery.Feed:
+			feeds = append(feeds, v)
+			continue
+		case string:
+			target.Address = v
+		case map[string]interface{}:
+			for key := range v {
+				switch key {
+				case "address", "labels", "basic_auth", "bearer_token", "tls_config":
+				default:
+					return nil, nil, fmt.Errorf("targets[%d]: unknown attribute %q", i, key)
+				}
+			}
+			target.Address, _ = v["address"].(string)
+
+			clientConfig, err := httpclient.Parse(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("targets[%d]: %w", i, err)
+			}
+			target.HTTPClientConfig = clientConfig
+
+			if rawLabels, ok := v["labels"]; ok {
+				labels, ok := rawLabels.(map[string]interface{})
+				if !ok {
+					return nil, nil, fmt.Errorf("targets[%d]: labels must be an object of strings", i)
+				}
+				for name, value := range labels {
+					s, ok := value.(string)
+					if !ok {
+						return nil, nil, fmt.Errorf("targets[%d]: label %s must be a string", i, name)
+					}
+					if name == "" || strings.HasPrefix(name, "__") {
+						return nil, nil, fmt.Errorf("targets[%d]: invalid label name %q", i, name)
+					}
+					target.Labels[name] = s
+				}
+			}
+		default:
+			return nil, nil, fmt.Errorf("targets[%d]: expected an address, { address, labels } or discovered targets", i)
+		}
+
+		if target.Address == "" {
+			return nil, nil, fmt.Errorf("targets[%d]: address must be a non-empty string", i)
+		}
+		targets = append(targets, target)
+	}
+	return targets, feeds, nil
 }
 
+// maxScrapeSize caps how much of a scrape response is read
+const maxScrapeSize = 16 << 20
+
+var errInvalidForwardTo = errors.New("forward_to must be a list of prometheus receivers")
+
 // Scraper implements component.Component for Prometheus scraping
 type Scraper struct {
-	id     string
-	config ScrapeConfig
+	id string
+
+	// mu guards health and the settings Reconfigure replaces
+	mu     sync.RWMutex
 	health component.Health
+	// targetErrors holds each target's error from the last scrape cycle,
+	// nil if it succeeded, by address
+	targetErrors map[string]error
+	config       ScrapeConfig
+	forwardTo    []Receiver
+	httpClient   *http.Client
+
+	// discovered holds the targets last received from each feed in
+	// config.Discovery
+	discovered map[*discovery.Feed][]Target
+
+	// reconfigured signals Run to pick up a new scrape interval
+	reconfigured chan struct{}
+
+	// seriesMu guards series, which holds the label sets last forwarded
+	// for each target by targetKey, so they can be marked stale once the
+	// target stops reporting them
+	seriesMu sync.Mutex
+	series   map[string]map[string]map[string]string
 
 	// Metrics
-	scrapesTotal   prometheus.Counter
-	scrapeFailures prometheus.Counter
+	scrapesTotal        prometheus.Counter
+	scrapeFailures      prometheus.Counter
+	staleSeries         prometheus.Counter
+	sampleLimitExceeded prometheus.Counter
 }
 
 func NewScraper(cfg component.Config) (component.Component, error) {
-	// Parse config (simplified)
-	config := ScrapeConfig{
-		ScrapeInterval: 30 * time.Second,
-		ScrapeTimeout:  10 * time.Second,
-		MetricsPath:    "/metrics",
-	}
-
-	// Extract targets from config
-	if targets, ok := cfg.Config["targets"].([]interface{}); ok {
-		for _, t := range targets {
-			if target, ok := t.(string); ok {
-				config.Targets = append(config.Targets, Target{
-					Address: target,
-					Labels:  make(map[string]string),
-				})
-			}
-		}
+	config, forwardTo, httpClient, err := parseScraper(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	s := &Scraper{
-		id:     fmt.Sprintf("%s.%s", cfg.Type, cfg.Name),
-		config: config,
+		id:           fmt.Sprintf("%s.%s", cfg.Type, cfg.Name),
+		config:       config,
+		forwardTo:    forwardTo,
+		httpClient:   httpClient,
+		discovered:   make(map[*discovery.Feed][]Target),
+		reconfigured: make(chan struct{}, 1),
+		series:       make(map[string]map[string]map[string]string),
 		health: component.Health{
 			Status:  component.StatusHealthy,
 			Message: "initialized",
@@ -74,66 +291,568 @@ func NewScraper(cfg component.Config) (component.Component, error) {
 			Name: "grafana_ops_scrape_failures_total",
 			Help: "Total number of scrape failures",
 		}),
+		staleSeries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_stale_series_total",
+			Help: "Total number of series marked stale because their target stopped reporting them",
+		}),
+		sampleLimitExceeded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "grafana_ops_scrapes_exceeded_sample_limit_total",
+			Help: "Total number of scrapes rejected for exceeding sample_limit",
+		}),
 	}
 
 	return s, nil
 }
 
+// Reconfigure applies a new config to a running scraper. In-flight scrapes
+// finish with the old settings and the next scrape uses the new targets.
+func (s *Scraper) Reconfigure(cfg component.Config) error {
+	config, forwardTo, httpClient, err := parseScraper(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.config = config
+	s.forwardTo = forwardTo
+	s.httpClient = httpClient
+	for feed := range s.discovered {
+		if !containsFeed(config.Discovery, feed) {
+			delete(s.discovered, feed)
+		}
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.reconfigured <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// parseScraper reads a scrape component's config and builds the clients
+// for its targets
+func parseScraper(cfg component.Config) (ScrapeConfig, []Receiver, *http.Client, error) {
+	config := ScrapeConfig{
+		ScrapeInterval: 30 * time.Second,
+		ScrapeTimeout:  10 * time.Second,
+		MetricsPath:    "/metrics",
+		JobName:        cfg.Name,
+	}
+
+	if v, ok := cfg.Config["job_name"]; ok {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: job_name must be a non-empty string", cfg.Type, cfg.Name)
+		}
+		config.JobName = s
+	}
+
+	targets, feeds, err := parseTargets(cfg.Config["targets"])
+	if err != nil {
+		return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: %w", cfg.Type, cfg.Name, err)
+	}
+	config.Targets = targets
+	config.Discovery = feeds
+
+	if err := parseScrapeDurations(cfg.Config, &config); err != nil {
+		return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: %w", cfg.Type, cfg.Name, err)
+	}
+	if err := parseScrapeLimits(cfg.Config, &config); err != nil {
+		return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: %w", cfg.Type, cfg.Name, err)
+	}
+
+	relabelConfigs, err := parseRelabelConfigs(cfg.Config["relabel_config"])
+	if err != nil {
+		return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: %w", cfg.Type, cfg.Name, err)
+	}
+	config.RelabelConfigs = relabelConfigs
+
+	clientConfig, err := httpclient.Parse(cfg.Config)
+	if err != nil {
+		return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: %w", cfg.Type, cfg.Name, err)
+	}
+	config.HTTPClientConfig = clientConfig
+
+	httpClient, err := httpclient.New(clientConfig)
+	if err != nil {
+		return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: %w", cfg.Type, cfg.Name, err)
+	}
+	for i, target := range config.Targets {
+		if target.HTTPClientConfig.IsZero() {
+			continue
+		}
+		client, err := httpclient.New(clientConfig.Merge(target.HTTPClientConfig))
+		if err != nil {
+			return ScrapeConfig{}, nil, nil, fmt.Errorf("%s.%s: target %s: %w", cfg.Type, cfg.Name, target.Address, err)
+		}
+		config.Targets[i].client = client
+	}
+
+	forwardTo, err := parseForwardTo(cfg.Config["forward_to"])
+	if err != nil {
+		return ScrapeConfig{}, nil, nil, err
+	}
+
+	return config, forwardTo, httpClient, nil
+}
+
 func (s *Scraper) ID() string {
 	return s.id
 }
 
+func (s *Scraper) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{s.scrapesTotal, s.scrapeFailures, s.staleSeries, s.sampleLimitExceeded}
+}
+
 func (s *Scraper) Run(ctx context.Context) error {
+	config := s.currentConfig()
 	slog.Info("starting prometheus scraper",
 		"id", s.id,
-		"targets", len(s.config.Targets),
-		"interval", s.config.ScrapeInterval)
+		"targets", len(config.Targets),
+		"interval", config.ScrapeInterval)
 
-	ticker := time.NewTicker(s.config.ScrapeInterval)
+	ticker := time.NewTicker(config.ScrapeInterval)
 	defer ticker.Stop()
 
+	stopWatching := s.watchDiscovery(ctx, config.Discovery)
+	defer func() { stopWatching() }()
+
 	for {
 		select {
 		case <-ctx.Done():
 			slog.Info("stopping prometheus scraper", "id", s.id)
 			return nil
+		case <-s.reconfigured:
+			config := s.currentConfig()
+			slog.Info("reconfigured prometheus scraper",
+				"id", s.id,
+				"targets", len(config.Targets),
+				"interval", config.ScrapeInterval)
+			ticker.Reset(config.ScrapeInterval)
+			stopWatching()
+			stopWatching = s.watchDiscovery(ctx, config.Discovery)
 		case <-ticker.C:
 			s.scrape(ctx)
 		}
 	}
 }
 
-func (s *Scraper) scrape(ctx context.Context) {
-	for _, target := range s.config.Targets {
-		go func(t Target) {
-			if err := s.scrapeTarget(ctx, t); err != nil {
+func (s *Scraper) currentConfig() ScrapeConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// watchDiscovery keeps the scraper's discovered targets up to date with
+// feeds until the returned function is called
+func (s *Scraper) watchDiscovery(ctx context.Context, feeds []*discovery.Feed) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for _, feed := range feeds {
+		updates, unsubscribe := feed.Subscribe()
+		wg.Add(1)
+		go func(feed *discovery.Feed) {
+			defer wg.Done()
+			defer unsubscribe()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case found := <-updates:
+					s.setDiscovered(feed, found)
+				}
+			}
+		}(feed)
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// setDiscovered replaces the targets from feed, unless a reconfiguration
+// has stopped the scraper using it
+func (s *Scraper) setDiscovered(feed *discovery.Feed, found []discovery.Target) {
+	targets := make([]Target, 0, len(found))
+	for _, t := range found {
+		address := t[discovery.AddressLabel]
+		if address == "" {
+			continue
+		}
+		// Labels such as __meta_dns_name are kept for relabeling
+		target := Target{Address: address, Labels: make(map[string]string)}
+		for name, value := range t {
+			if name != discovery.AddressLabel {
+				target.Labels[name] = value
+			}
+		}
+		targets = append(targets, target)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !containsFeed(s.config.Discovery, feed) {
+		return
+	}
+	s.discovered[feed] = targets
+	slog.Debug("discovered targets updated", "id", s.id, "targets", len(targets))
+}
+
+func containsFeed(feeds []*discovery.Feed, feed *discovery.Feed) bool {
+	for _, f := range feeds {
+		if f == feed {
+			return true
+		}
+	}
+	return false
+}
+
+// targets returns the static targets followed by the discovered ones
+func (s *Scraper) targets() (ScrapeConfig, []Target) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	targets := append([]Target(nil), s.config.Targets...)
+	for _, feed := range s.config.Discovery {
+		targets = append(targets, s.discovered[feed]...)
+	}
+	return s.config, targets
+}
+
+// scrape starts a scrape of every target and returns a channel closed once
+// they have all finished and the component's health reflects the cycle
+func (s *Scraper) scrape(ctx context.Context) <-chan struct{} {
+	config, targets := s.targets()
+	s.forward(ctx, s.staleDroppedTargets(targets))
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			scrapeCtx, cancel := context.WithTimeout(ctx, config.ScrapeTimeout)
+			defer cancel()
+
+			if err := s.scrapeTarget(scrapeCtx, t); err != nil {
 				slog.Error("scrape failed",
 					"id", s.id,
 					"target", t.Address,
 					"error", err)
+				// A failing target's series end, unless the scraper is stopping
+				if ctx.Err() == nil {
+					s.forward(ctx, s.staleTarget(targetKey(t)))
+				}
 				s.scrapeFailures.Inc()
-				s.health.Status = component.StatusDegraded
-				s.health.Message = fmt.Sprintf("scrape failures: %s", err)
+				errs[i] = err
 			} else {
 				s.scrapesTotal.Inc()
-				s.health.Status = component.StatusHealthy
-				s.health.Message = "scraping successfully"
 			}
-		}(target)
+		}(i, target)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+		s.recordHealth(targets, errs)
+	}()
+	return done
+}
+
+// recordHealth keeps the outcome of a scrape cycle for each target and
+// sets the component's health from all of them: degraded if any target
+// failed
+func (s *Scraper) recordHealth(targets []Target, errs []error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.targetErrors = make(map[string]error, len(targets))
+	var failures []string
+	for i, t := range targets {
+		s.targetErrors[t.Address] = errs[i]
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", t.Address, errs[i]))
+		}
 	}
+	if len(failures) > 0 {
+		s.health = component.Health{
+			Status:  component.StatusDegraded,
+			Message: fmt.Sprintf("scrape failures on %d of %d targets: %s", len(failures), len(targets), strings.Join(failures, "; ")),
+		}
+		return
+	}
+	s.health = component.Health{Status: component.StatusHealthy, Message: "scraping successfully"}
 }
 
 func (s *Scraper) scrapeTarget(ctx context.Context, target Target) error {
-	// TODO: Implement actual HTTP scraping
+	s.mu.RLock()
+	config, httpClient := s.config, s.httpClient
+	s.mu.RUnlock()
+
+	url := targetURL(target.Address, config.MetricsPath)
 	slog.Debug("scraping target",
 		"id", s.id,
 		"target", target.Address,
-		"path", s.config.MetricsPath)
+		"url", url)
 
-	// Placeholder - would use net/http to scrape Prometheus metrics
+	client := target.client
+	if client == nil {
+		client = httpClient
+	}
+	samples, format, err := s.fetchSamples(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	slog.Debug("scraped target",
+		"id", s.id,
+		"target", target.Address,
+		"format", format,
+		"samples", len(samples))
+
+	attached := target.attachedLabels(config.JobName)
+	for _, sample := range samples {
+		attachLabels(sample.Labels, attached)
+	}
+	samples = relabel(samples, config.RelabelConfigs)
+	for _, sample := range samples {
+		dropInternalLabels(sample.Labels)
+	}
+
+	// Nothing is forwarded from a scrape over its limits
+	if err := checkLimits(samples, config); err != nil {
+		if errors.Is(err, errSampleLimit) {
+			s.sampleLimitExceeded.Inc()
+		}
+		return err
+	}
+
+	// Series the target reported last time but not now have ended
+	samples = append(samples, s.staleSeriesOf(targetKey(target), samples)...)
+
+	s.forward(ctx, samples)
 	return nil
 }
 
+// reservedLabels are the target labels a sample's own labels can't
+// override
+var reservedLabels = map[string]bool{"job": true, "instance": true}
+
+// attachedLabels returns the labels the target attaches to its samples:
+// its own labels, job and instance unless it sets them, and __address__
+// for relabel rules to use
+func (t Target) attachedLabels(job string) map[string]string {
+	labels := make(map[string]string, len(t.Labels)+3)
+	for name, value := range t.Labels {
+		labels[name] = value
+	}
+	if _, ok := labels["job"]; !ok {
+		labels["job"] = job
+	}
+	if _, ok := labels["instance"]; !ok {
+		labels["instance"] = instanceOf(t.Address)
+	}
+	labels[discovery.AddressLabel] = t.Address
+	return labels
+}
+
+// instanceOf returns the host:port of an address, which may be a full URL
+func instanceOf(address string) string {
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		if u, err := url.Parse(address); err == nil && u.Host != "" {
+			return u.Host
+		}
+	}
+	return address
+}
+
+// attachLabels adds the target's labels to a sample's. Where both set a
+// label the sample's value wins, except for reserved and __ labels, where
+// the sample's value is kept as exported_<name>.
+func attachLabels(labels, attached map[string]string) {
+	for name, value := range attached {
+		existing, ok := labels[name]
+		if !ok {
+			labels[name] = value
+			continue
+		}
+		if existing == value || (!reservedLabels[name] && !strings.HasPrefix(name, "__")) {
+			continue
+		}
+
+		exported := "exported_" + name
+		for {
+			if _, taken := labels[exported]; !taken {
+				break
+			}
+			exported = "exported_" + exported
+		}
+		labels[exported] = existing
+		labels[name] = value
+	}
+}
+
+// dropInternalLabels removes the __ labels, such as __address__, that are
+// only there for relabeling, keeping the metric name
+func dropInternalLabels(labels map[string]string) {
+	for name := range labels {
+		if strings.HasPrefix(name, "__") && name != "__name__" {
+			delete(labels, name)
+		}
+	}
+}
+
+// targetKey identifies a target by its address and labels, so the same
+// address listed twice with different labels is tracked separately
+func targetKey(t Target) string {
+	return t.Address + "\xff" + seriesKey(t.Labels)
+}
+
+// staleSeriesOf records samples as the series the target with key
+// reports, and returns staleness markers for the series it reported last
+// time that samples lack
+func (s *Scraper) staleSeriesOf(key string, samples []Sample) []Sample {
+	current := make(map[string]map[string]string, len(samples))
+	for _, sample := range samples {
+		current[seriesKey(sample.Labels)] = sample.Labels
+	}
+
+	s.seriesMu.Lock()
+	previous := s.series[key]
+	s.series[key] = current
+	s.seriesMu.Unlock()
+
+	var ended []map[string]string
+	for k, labels := range previous {
+		if _, ok := current[k]; !ok {
+			ended = append(ended, labels)
+		}
+	}
+	return s.staleMarkers(ended)
+}
+
+// staleTarget forgets the target with key and returns staleness markers
+// for the series it last reported
+func (s *Scraper) staleTarget(key string) []Sample {
+	s.seriesMu.Lock()
+	previous := s.series[key]
+	delete(s.series, key)
+	s.seriesMu.Unlock()
+
+	ended := make([]map[string]string, 0, len(previous))
+	for _, labels := range previous {
+		ended = append(ended, labels)
+	}
+	return s.staleMarkers(ended)
+}
+
+// staleDroppedTargets forgets the targets no longer among targets and
+// returns staleness markers for the series they last reported
+func (s *Scraper) staleDroppedTargets(targets []Target) []Sample {
+	keep := make(map[string]bool, len(targets))
+	for _, t := range targets {
+		keep[targetKey(t)] = true
+	}
+
+	var ended []map[string]string
+	s.seriesMu.Lock()
+	for key, series := range s.series {
+		if keep[key] {
+			continue
+		}
+		for _, labels := range series {
+			ended = append(ended, labels)
+		}
+		delete(s.series, key)
+	}
+	s.seriesMu.Unlock()
+
+	return s.staleMarkers(ended)
+}
+
+// staleMarkers returns a staleness marker for each of the label sets
+func (s *Scraper) staleMarkers(ended []map[string]string) []Sample {
+	if len(ended) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	markers := make([]Sample, 0, len(ended))
+	for _, labels := range ended {
+		// Receivers own the label maps of samples already forwarded
+		copied := make(map[string]string, len(labels))
+		for name, value := range labels {
+			copied[name] = value
+		}
+		markers = append(markers, Sample{Labels: copied, Value: StaleNaN, Timestamp: now})
+	}
+	s.staleSeries.Add(float64(len(markers)))
+	return markers
+}
+
+// fetchSamples scrapes url, negotiating OpenMetrics where the target
+// supports it, and parses the response with the matching parser
+func (s *Scraper) fetchSamples(ctx context.Context, client *http.Client, url string) ([]Sample, exposition, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create scrape request: %w", err)
+	}
+	req.Header.Set("Accept", acceptHeader)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scrape: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("scrape returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScrapeSize+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read scrape response: %w", err)
+	}
+	if len(body) > maxScrapeSize {
+		return nil, 0, fmt.Errorf("scrape response exceeds %d bytes", maxScrapeSize)
+	}
+
+	format := detectFormat(resp.Header.Get("Content-Type"), body)
+	samples, err := parseExposition(format, body, time.Now().UnixMilli())
+	if err != nil {
+		return nil, format, fmt.Errorf("failed to parse %s response: %w", format, err)
+	}
+	return samples, format, nil
+}
+
+// targetURL builds the scrape URL for an address, which may be a bare
+// host:port or a full URL
+func targetURL(address, metricsPath string) string {
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		return address
+	}
+	return "http://" + address + metricsPath
+}
+
+// forward sends a batch of samples to every downstream receiver
+func (s *Scraper) forward(ctx context.Context, samples []Sample) {
+	if len(samples) == 0 {
+		return
+	}
+	s.mu.RLock()
+	forwardTo := s.forwardTo
+	s.mu.RUnlock()
+
+	for _, r := range forwardTo {
+		select {
+		case r <- samples:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (s *Scraper) Health() component.Health {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.health
 }
@@ -0,0 +1,122 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// newAuthServer starts a TLS server that only serves metrics to requests
+// carrying the given Authorization header
+func newAuthServer(t *testing.T, authorization string) (*httptest.Server, string) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, "up 1\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return srv, caFile
+}
+
+func newTestScraper(t *testing.T, raw map[string]interface{}) *Scraper {
+	t.Helper()
+	comp, err := NewScraper(component.Config{Type: "prometheus.scrape", Name: "test", Config: raw})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return comp.(*Scraper)
+}
+
+func TestScraper_BearerTokenOverTLS(t *testing.T) {
+	srv, caFile := newAuthServer(t, "Bearer s3cret")
+	tlsConfig := []interface{}{map[string]interface{}{"ca_file": caFile}}
+	target := Target{Address: srv.URL + "/metrics"}
+
+	unauthenticated := newTestScraper(t, map[string]interface{}{"tls_config": tlsConfig})
+	err := unauthenticated.scrapeTarget(context.Background(), target)
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("expected unauthenticated scrape to be rejected, got %v", err)
+	}
+
+	receiver := make(Receiver, 1)
+	scraper := newTestScraper(t, map[string]interface{}{
+		"tls_config":   tlsConfig,
+		"bearer_token": "s3cret",
+		"forward_to":   []interface{}{receiver},
+	})
+	if err := scraper.scrapeTarget(context.Background(), target); err != nil {
+		t.Fatalf("expected authenticated scrape to succeed, got %v", err)
+	}
+	if samples := <-receiver; len(samples) != 1 {
+		t.Errorf("expected 1 sample, got %d", len(samples))
+	}
+}
+
+func TestScraper_TLSVerification(t *testing.T) {
+	srv, _ := newAuthServer(t, "")
+	target := Target{Address: srv.URL + "/metrics"}
+
+	err := newTestScraper(t, nil).scrapeTarget(context.Background(), target)
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("expected certificate verification failure, got %v", err)
+	}
+
+	scraper := newTestScraper(t, map[string]interface{}{
+		"tls_config": []interface{}{map[string]interface{}{"insecure_skip_verify": true}},
+	})
+	if err := scraper.scrapeTarget(context.Background(), target); err != nil {
+		t.Errorf("expected insecure_skip_verify to accept the certificate, got %v", err)
+	}
+}
+
+func TestScraper_PerTargetBasicAuth(t *testing.T) {
+	srv, caFile := newAuthServer(t, "Basic c2NyYXBlcjpodW50ZXIy") // scraper:hunter2
+
+	scraper := newTestScraper(t, map[string]interface{}{
+		"tls_config":   []interface{}{map[string]interface{}{"ca_file": caFile}},
+		"bearer_token": "wrong",
+		"targets": []interface{}{
+			srv.URL + "/metrics",
+			map[string]interface{}{
+				"address":    srv.URL + "/metrics",
+				"basic_auth": map[string]interface{}{"username": "scraper", "password": "hunter2"},
+			},
+		},
+	})
+
+	if err := scraper.scrapeTarget(context.Background(), scraper.config.Targets[0]); err == nil {
+		t.Error("expected the scrape-level bearer token to be rejected")
+	}
+	if err := scraper.scrapeTarget(context.Background(), scraper.config.Targets[1]); err != nil {
+		t.Errorf("expected the target's basic auth to be used, got %v", err)
+	}
+}
+
+func TestNewScraper_UnreadableCAFile(t *testing.T) {
+	_, err := NewScraper(component.Config{
+		Type:   "prometheus.scrape",
+		Name:   "test",
+		Config: map[string]interface{}{"tls_config": map[string]interface{}{"ca_file": "/nonexistent/ca.pem"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "ca_file") {
+		t.Errorf("expected unreadable ca_file to fail at startup, got %v", err)
+	}
+}
@@ -0,0 +1,847 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/component/discovery"
+	"github.com/vjranagit/grafana/internal/flow/config"
+	"github.com/vjranagit/grafana/internal/flow/engine"
+)
+
+// fakeWriter stands in for a sample consumer such as remote_write
+type fakeWriter struct {
+	id       string
+	receiver Receiver
+}
+
+func (f *fakeWriter) ID() string                    { return f.id }
+func (f *fakeWriter) Run(ctx context.Context) error { <-ctx.Done(); return nil }
+func (f *fakeWriter) Health() component.Health {
+	return component.Health{Status: component.StatusHealthy}
+}
+func (f *fakeWriter) Exports() map[string]interface{} {
+	return map[string]interface{}{"receiver": f.receiver}
+}
+
+// fakeDiscovery stands in for a discovery component such as discovery.dns
+type fakeDiscovery struct {
+	id   string
+	feed *discovery.Feed
+}
+
+func (f *fakeDiscovery) ID() string                    { return f.id }
+func (f *fakeDiscovery) Run(ctx context.Context) error { <-ctx.Done(); return nil }
+func (f *fakeDiscovery) Health() component.Health {
+	return component.Health{Status: component.StatusHealthy}
+}
+func (f *fakeDiscovery) Exports() map[string]interface{} {
+	return map[string]interface{}{"targets": f.feed}
+}
+
+func TestScraper_ForwardToReference(t *testing.T) {
+	registry := component.NewRegistry()
+	registry.Register("prometheus.scrape", NewScraper)
+	registry.Register("prometheus.remote_write", func(cfg component.Config) (component.Component, error) {
+		return &fakeWriter{id: cfg.ID(), receiver: make(Receiver, 1)}, nil
+	})
+
+	cfg, err := config.Parse([]byte(`
+prometheus_scrape "app" {
+  targets    = ["localhost:9090"]
+  forward_to = [prometheus.remote_write.default.receiver]
+}
+
+prometheus_remote_write "default" {}
+`), "flow.hcl", registry)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	eng, err := engine.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+
+	deps := eng.Graph().Dependencies("prometheus.scrape.app")
+	if !reflect.DeepEqual(deps, []string{"prometheus.remote_write.default"}) {
+		t.Fatalf("expected edge to remote_write, got %v", deps)
+	}
+
+	scraper, ok := eng.Graph().GetComponent("prometheus.scrape.app").(*Scraper)
+	if !ok {
+		t.Fatal("scraper not registered in graph")
+	}
+	writer := eng.Graph().GetComponent("prometheus.remote_write.default").(*fakeWriter)
+
+	samples := []Sample{{Labels: map[string]string{"__name__": "up"}, Value: 1}}
+	scraper.forward(context.Background(), samples)
+
+	select {
+	case got := <-writer.receiver:
+		if !reflect.DeepEqual(got, samples) {
+			t.Errorf("expected %v, got %v", samples, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("samples did not reach the referenced receiver")
+	}
+}
+
+func TestNewScraper_InvalidForwardTo(t *testing.T) {
+	_, err := NewScraper(component.Config{
+		Type:   "prometheus.scrape",
+		Name:   "bad",
+		Config: map[string]interface{}{"forward_to": []interface{}{"not-a-receiver"}},
+	})
+	if err == nil {
+		t.Fatal("expected error for non-receiver forward_to")
+	}
+}
+
+func TestNewScraper_Durations(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       map[string]interface{}
+		wantInterval time.Duration
+		wantTimeout  time.Duration
+		wantErr      string
+	}{
+		{
+			name:         "defaults",
+			config:       map[string]interface{}{},
+			wantInterval: 30 * time.Second,
+			wantTimeout:  10 * time.Second,
+		},
+		{
+			name:         "both set",
+			config:       map[string]interface{}{"scrape_interval": "1m", "scrape_timeout": "45s"},
+			wantInterval: time.Minute,
+			wantTimeout:  45 * time.Second,
+		},
+		{
+			name:         "interval only keeps default timeout",
+			config:       map[string]interface{}{"scrape_interval": "15s"},
+			wantInterval: 15 * time.Second,
+			wantTimeout:  10 * time.Second,
+		},
+		{
+			name:         "timeout equal to interval",
+			config:       map[string]interface{}{"scrape_interval": "5s", "scrape_timeout": "5s"},
+			wantInterval: 5 * time.Second,
+			wantTimeout:  5 * time.Second,
+		},
+		{
+			name:    "timeout exceeds interval",
+			config:  map[string]interface{}{"scrape_interval": "10s", "scrape_timeout": "20s"},
+			wantErr: "scrape_timeout (20s) must not exceed scrape_interval (10s)",
+		},
+		{
+			name:    "default timeout exceeds short interval",
+			config:  map[string]interface{}{"scrape_interval": "5s"},
+			wantErr: "must not exceed scrape_interval",
+		},
+		{
+			name:    "invalid duration",
+			config:  map[string]interface{}{"scrape_interval": "often"},
+			wantErr: "invalid scrape_interval",
+		},
+		{
+			name:    "non-string duration",
+			config:  map[string]interface{}{"scrape_timeout": 10},
+			wantErr: "scrape_timeout must be a duration string",
+		},
+		{
+			name:    "negative duration",
+			config:  map[string]interface{}{"scrape_timeout": "-1s"},
+			wantErr: "scrape_timeout must be positive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comp, err := NewScraper(component.Config{Type: "prometheus.scrape", Name: "test", Config: tt.config})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			scraper := comp.(*Scraper)
+			if scraper.config.ScrapeInterval != tt.wantInterval {
+				t.Errorf("expected interval %s, got %s", tt.wantInterval, scraper.config.ScrapeInterval)
+			}
+			if scraper.config.ScrapeTimeout != tt.wantTimeout {
+				t.Errorf("expected timeout %s, got %s", tt.wantTimeout, scraper.config.ScrapeTimeout)
+			}
+		})
+	}
+}
+
+func TestScraper_ContentNegotiation(t *testing.T) {
+	const omBody = "# TYPE up gauge\nup 1 1700000000.25\n# EOF\n"
+	const promBody = "# TYPE up gauge\nup 1 1700000000250\n"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantFormat  exposition
+	}{
+		{"openmetrics target", "application/openmetrics-text; version=1.0.0; charset=utf-8", omBody, formatOpenMetrics},
+		{"legacy target", "text/plain; version=0.0.4; charset=utf-8", promBody, formatPrometheus},
+		{"no content type", "", omBody, formatOpenMetrics},
+		{"garbled content type", "text/;;", promBody, formatPrometheus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept")
+				// Suppress Go's automatic Content-Type sniffing
+				w.Header()["Content-Type"] = nil
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			comp, err := NewScraper(component.Config{Type: "prometheus.scrape", Name: "test"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			samples, format, err := comp.(*Scraper).fetchSamples(context.Background(), comp.(*Scraper).httpClient, srv.URL+"/metrics")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(accept, "application/openmetrics-text") {
+				t.Errorf("expected OpenMetrics to be preferred in Accept, got %q", accept)
+			}
+			if format != tt.wantFormat {
+				t.Errorf("expected %s parser, got %s", tt.wantFormat, format)
+			}
+			if len(samples) != 1 || samples[0].Timestamp != 1700000000250 {
+				t.Errorf("unexpected samples %+v", samples)
+			}
+		})
+	}
+}
+
+func TestScraper_ScrapeTargetForwardsSamples(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, "up 1\n")
+	}))
+	defer srv.Close()
+
+	receiver := make(Receiver, 1)
+	comp, err := NewScraper(component.Config{
+		Type:   "prometheus.scrape",
+		Name:   "test",
+		Config: map[string]interface{}{"forward_to": []interface{}{receiver}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	address := strings.TrimPrefix(srv.URL, "http://")
+	target := Target{Address: address, Labels: map[string]string{"job": "node"}}
+	if err := comp.(*Scraper).scrapeTarget(context.Background(), target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	samples := <-receiver
+	if len(samples) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(samples))
+	}
+	labels := samples[0].Labels
+	if labels["instance"] != address || labels["job"] != "node" || labels["__name__"] != "up" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+}
+
+func TestScraper_TargetLabelsFromConfig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, "http_requests_total{code=\"200\"} 7\n")
+	}))
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "http://")
+
+	registry := component.NewRegistry()
+	registry.Register("prometheus.scrape", NewScraper)
+	registry.Register("prometheus.remote_write", func(cfg component.Config) (component.Component, error) {
+		return &fakeWriter{id: cfg.ID(), receiver: make(Receiver, 1)}, nil
+	})
+
+	cfg, err := config.Parse([]byte(`
+prometheus_scrape "app" {
+  targets = [
+    "localhost:9100",
+    { address = "`+address+`", labels = { job = "api", env = "prod" } },
+  ]
+  forward_to = [prometheus.remote_write.default.receiver]
+}
+
+prometheus_remote_write "default" {}
+`), "flow.hcl", registry)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	eng, err := engine.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	scraper := eng.Graph().GetComponent("prometheus.scrape.app").(*Scraper)
+	writer := eng.Graph().GetComponent("prometheus.remote_write.default").(*fakeWriter)
+
+	want := []Target{
+		{Address: "localhost:9100", Labels: map[string]string{}},
+		{Address: address, Labels: map[string]string{"job": "api", "env": "prod"}},
+	}
+	if !reflect.DeepEqual(scraper.config.Targets, want) {
+		t.Fatalf("expected targets %v, got %v", want, scraper.config.Targets)
+	}
+
+	if err := scraper.scrapeTarget(context.Background(), scraper.config.Targets[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	samples := <-writer.receiver
+	if len(samples) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(samples))
+	}
+	wantLabels := map[string]string{
+		"__name__": "http_requests_total",
+		"code":     "200",
+		"instance": address,
+		"job":      "api",
+		"env":      "prod",
+	}
+	if !reflect.DeepEqual(samples[0].Labels, wantLabels) {
+		t.Errorf("expected labels %v, got %v", wantLabels, samples[0].Labels)
+	}
+}
+
+func TestNewScraper_InvalidTargets(t *testing.T) {
+	for name, targets := range map[string]interface{}{
+		"not a list":       "localhost:9090",
+		"number entry":     []interface{}{9090},
+		"missing address":  []interface{}{map[string]interface{}{"labels": map[string]interface{}{"job": "api"}}},
+		"unknown key":      []interface{}{map[string]interface{}{"address": "a:1", "label": map[string]interface{}{}}},
+		"non-string label": []interface{}{map[string]interface{}{"address": "a:1", "labels": map[string]interface{}{"port": 80}}},
+		"reserved label":   []interface{}{map[string]interface{}{"address": "a:1", "labels": map[string]interface{}{"__name__": "x"}}},
+	} {
+		_, err := NewScraper(component.Config{
+			Type:   "prometheus.scrape",
+			Name:   "test",
+			Config: map[string]interface{}{"targets": targets},
+		})
+		if err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestScraper_MetricsPerInstance(t *testing.T) {
+	registry := component.NewRegistry()
+	registry.Register("prometheus.scrape", NewScraper)
+
+	cfg, err := config.Parse([]byte(`
+prometheus_scrape "app" {
+  targets = ["localhost:9090"]
+}
+
+prometheus_scrape "node" {
+  targets = ["localhost:9100"]
+}
+`), "flow.hcl", registry)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	eng, err := engine.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	eng.Graph().GetComponent("prometheus.scrape.node").(*Scraper).scrapeFailures.Inc()
+
+	rec := httptest.NewRecorder()
+	eng.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	for _, line := range []string{
+		`grafana_ops_scrapes_total{instance="prometheus.scrape.app"} 0`,
+		`grafana_ops_scrapes_total{instance="prometheus.scrape.node"} 0`,
+		`grafana_ops_scrape_failures_total{instance="prometheus.scrape.app"} 0`,
+		`grafana_ops_scrape_failures_total{instance="prometheus.scrape.node"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("expected %q in metrics output:\n%s", line, rec.Body)
+		}
+	}
+}
+
+func TestScraper_ReloadSwapsTargets(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	newTarget := func(name string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[name]++
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			io.WriteString(w, "up 1\n")
+		}))
+		t.Cleanup(srv.Close)
+		return strings.TrimPrefix(srv.URL, "http://")
+	}
+	hitCount := func(name string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[name]
+	}
+	waitForHit := func(name string) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); hitCount(name) == 0; {
+			if time.Now().After(deadline) {
+				t.Fatalf("target %s was never scraped", name)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	oldTarget, newTargetAddr := newTarget("old"), newTarget("new")
+
+	registry := component.NewRegistry()
+	registry.Register("prometheus.scrape", NewScraper)
+	parse := func(target string) *engine.Config {
+		t.Helper()
+		cfg, err := config.Parse([]byte(`
+prometheus_scrape "app" {
+  targets         = ["`+target+`"]
+  scrape_interval = "20ms"
+  scrape_timeout  = "10ms"
+}
+`), "flow.hcl", registry)
+		if err != nil {
+			t.Fatalf("failed to parse config: %v", err)
+		}
+		return cfg
+	}
+
+	eng, err := engine.New(parse(oldTarget))
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go eng.Run(ctx)
+
+	waitForHit("old")
+	scraper := eng.Graph().GetComponent("prometheus.scrape.app")
+
+	if err := eng.Reload(parse(newTargetAddr)); err != nil {
+		t.Fatalf("unexpected reload error: %v", err)
+	}
+	waitForHit("new")
+
+	if eng.Graph().GetComponent("prometheus.scrape.app") != scraper {
+		t.Error("expected the scraper to be reconfigured in place")
+	}
+
+	// Allow a scrape that was in flight during the reload to land
+	time.Sleep(30 * time.Millisecond)
+	before := hitCount("old")
+	time.Sleep(100 * time.Millisecond)
+	if after := hitCount("old"); after != before {
+		t.Errorf("expected the old target to stop being scraped, got %d more scrapes", after-before)
+	}
+	if hitCount("new") < 2 {
+		t.Errorf("expected the new target to keep being scraped, got %d scrapes", hitCount("new"))
+	}
+}
+
+func TestScraper_DiscoveredTargets(t *testing.T) {
+	newTarget := func() string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			io.WriteString(w, "up 1\n")
+		}))
+		t.Cleanup(srv.Close)
+		return strings.TrimPrefix(srv.URL, "http://")
+	}
+	first, second := newTarget(), newTarget()
+
+	registry := component.NewRegistry()
+	registry.Register("prometheus.scrape", NewScraper)
+	registry.Register("prometheus.remote_write", func(cfg component.Config) (component.Component, error) {
+		return &fakeWriter{id: cfg.ID(), receiver: make(Receiver, 16)}, nil
+	})
+	registry.Register("discovery.dns", func(cfg component.Config) (component.Component, error) {
+		return &fakeDiscovery{id: cfg.ID(), feed: discovery.NewFeed()}, nil
+	})
+
+	cfg, err := config.Parse([]byte(`
+prometheus_scrape "app" {
+  targets         = discovery.dns.api.targets
+  scrape_interval = "20ms"
+  scrape_timeout  = "10ms"
+  forward_to      = [prometheus.remote_write.default.receiver]
+}
+
+discovery_dns "api" {}
+
+prometheus_remote_write "default" {}
+`), "flow.hcl", registry)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	eng, err := engine.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	feed := eng.Graph().GetComponent("discovery.dns.api").(*fakeDiscovery).feed
+	writer := eng.Graph().GetComponent("prometheus.remote_write.default").(*fakeWriter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go eng.Run(ctx)
+
+	// waitForInstance returns the labels of the first batch scraped from
+	// address, skipping batches from other targets
+	waitForInstance := func(address string) map[string]string {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			select {
+			case samples := <-writer.receiver:
+				if samples[0].Labels["instance"] == address {
+					return samples[0].Labels
+				}
+			case <-deadline:
+				t.Fatalf("discovered target %s was never scraped", address)
+			}
+		}
+	}
+
+	feed.Publish([]discovery.Target{{
+		discovery.AddressLabel: first,
+		"__meta_dns_name":      "api.internal",
+		"zone":                 "a",
+	}})
+	want := map[string]string{"__name__": "up", "instance": first, "job": "app", "zone": "a"}
+	if labels := waitForInstance(first); !reflect.DeepEqual(labels, want) {
+		t.Errorf("expected labels %v, got %v", want, labels)
+	}
+
+	feed.Publish([]discovery.Target{{discovery.AddressLabel: second}})
+	waitForInstance(second)
+}
+
+func TestScraper_StaleMarkers(t *testing.T) {
+	var failing sync.Map
+	newTarget := func(name, body string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := failing.Load(name); ok {
+				http.Error(w, "down", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			io.WriteString(w, body)
+		}))
+		t.Cleanup(srv.Close)
+		return strings.TrimPrefix(srv.URL, "http://")
+	}
+	api := newTarget("api", "up 1\nrequests_total{path=\"/\"} 3\n")
+	db := newTarget("db", "up 1\n")
+
+	receiver := make(Receiver, 16)
+	newConfig := func(targets ...interface{}) component.Config {
+		return component.Config{
+			Type:   "prometheus.scrape",
+			Name:   "test",
+			Config: map[string]interface{}{"targets": targets, "forward_to": []interface{}{receiver}},
+		}
+	}
+	comp, err := NewScraper(newConfig(api, db))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scraper := comp.(*Scraper)
+
+	// scrapeOnce runs a scrape cycle and returns the staleness markers it
+	// forwarded, by instance
+	scrapeOnce := func() map[string][]string {
+		t.Helper()
+		done := counterValue(t, scraper.scrapesTotal) + counterValue(t, scraper.scrapeFailures)
+		targets := len(scraper.currentConfig().Targets)
+		scraper.scrape(context.Background())
+		for deadline := time.Now().Add(2 * time.Second); counterValue(t, scraper.scrapesTotal)+counterValue(t, scraper.scrapeFailures) < done+float64(targets); {
+			if time.Now().After(deadline) {
+				t.Fatal("scrape cycle did not finish")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		stale := make(map[string][]string)
+		for {
+			select {
+			case samples := <-receiver:
+				for _, sample := range samples {
+					if IsStaleNaN(sample.Value) {
+						instance := sample.Labels["instance"]
+						stale[instance] = append(stale[instance], sample.Labels["__name__"])
+					}
+				}
+			default:
+				return stale
+			}
+		}
+	}
+
+	if stale := scrapeOnce(); len(stale) != 0 {
+		t.Fatalf("expected no staleness markers on the first scrape, got %v", stale)
+	}
+
+	// Dropping a target marks its series stale on the next cycle, once
+	if err := scraper.Reconfigure(newConfig(api)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stale := scrapeOnce(); !reflect.DeepEqual(stale, map[string][]string{db: {"up"}}) {
+		t.Errorf("expected the dropped target's series marked stale, got %v", stale)
+	}
+	if stale := scrapeOnce(); len(stale) != 0 {
+		t.Errorf("expected staleness markers only once, got %v", stale)
+	}
+
+	// So does a target that starts failing
+	failing.Store("api", true)
+	stale := scrapeOnce()
+	if names := stale[api]; len(stale) != 1 || len(names) != 2 {
+		t.Errorf("expected both series of the failing target marked stale, got %v", stale)
+	}
+	if stale := scrapeOnce(); len(stale) != 0 {
+		t.Errorf("expected staleness markers only once, got %v", stale)
+	}
+
+	if got := counterValue(t, scraper.staleSeries); got != 3 {
+		t.Errorf("expected 3 stale series counted, got %v", got)
+	}
+}
+
+func TestScraper_HealthAcrossTargets(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, "up 1\n")
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	good := strings.TrimPrefix(healthy.URL, "http://")
+	bad := strings.TrimPrefix(broken.URL, "http://")
+
+	receiver := make(Receiver, 64)
+	comp, err := NewScraper(component.Config{
+		Type:   "prometheus.scrape",
+		Name:   "test",
+		Config: map[string]interface{}{"targets": []interface{}{good, bad, good}, "forward_to": []interface{}{receiver}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scraper := comp.(*Scraper)
+
+	// However the targets finish, the failing one keeps the component
+	// degraded every cycle
+	for i := 0; i < 5; i++ {
+		<-scraper.scrape(context.Background())
+		for len(receiver) > 0 {
+			<-receiver
+		}
+		health := scraper.Health()
+		if health.Status != component.StatusDegraded || !strings.Contains(health.Message, bad) {
+			t.Fatalf("cycle %d: expected degraded health naming %s, got %+v", i, bad, health)
+		}
+	}
+	scraper.mu.RLock()
+	goodErr, badErr := scraper.targetErrors[good], scraper.targetErrors[bad]
+	scraper.mu.RUnlock()
+	if goodErr != nil || badErr == nil {
+		t.Errorf("expected only %s recorded as failing, got %v and %v", bad, goodErr, badErr)
+	}
+}
+
+func TestScraper_Limits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, "up 1\nrequests_total{path=\"/api/v1/alerts/bulk/resolve\"} 3\nrequests_total{path=\"/\"} 5\n")
+	}))
+	defer srv.Close()
+	target := Target{Address: strings.TrimPrefix(srv.URL, "http://"), Labels: map[string]string{}}
+
+	tests := []struct {
+		name       string
+		limits     map[string]interface{}
+		wantErr    string
+		wantLimits float64
+	}{
+		{name: "under the sample limit", limits: map[string]interface{}{"sample_limit": 3}},
+		{name: "over the sample limit", limits: map[string]interface{}{"sample_limit": 2}, wantErr: "sample limit exceeded: 3 samples, limit 2", wantLimits: 1},
+		{name: "within label limits", limits: map[string]interface{}{"label_limit": 4, "label_value_length_limit": 27}},
+		{name: "over the label limit", limits: map[string]interface{}{"label_limit": 3}, wantErr: "label limit exceeded: requests_total has 4 labels, limit 3"},
+		{name: "over the label value length limit", limits: map[string]interface{}{"label_value_length_limit": 26}, wantErr: "label path is 27 bytes, limit 26"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := make(Receiver, 1)
+			config := map[string]interface{}{"forward_to": []interface{}{receiver}}
+			for key, value := range tt.limits {
+				config[key] = value
+			}
+			comp, err := NewScraper(component.Config{Type: "prometheus.scrape", Name: "test", Config: config})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			scraper := comp.(*Scraper)
+
+			err = scraper.scrapeTarget(context.Background(), target)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if samples := <-receiver; len(samples) != 3 {
+					t.Errorf("expected all 3 samples forwarded, got %d", len(samples))
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			select {
+			case samples := <-receiver:
+				t.Errorf("expected nothing forwarded from a rejected scrape, got %v", samples)
+			default:
+			}
+			if got := counterValue(t, scraper.sampleLimitExceeded); got != tt.wantLimits {
+				t.Errorf("expected %v scrapes counted over the sample limit, got %v", tt.wantLimits, got)
+			}
+		})
+	}
+}
+
+func TestNewScraper_InvalidLimits(t *testing.T) {
+	for _, config := range []map[string]interface{}{
+		{"sample_limit": -1},
+		{"label_limit": "10"},
+		{"label_value_length_limit": 1.5},
+	} {
+		if _, err := NewScraper(component.Config{Type: "prometheus.scrape", Name: "test", Config: config}); err == nil {
+			t.Errorf("expected error for %v", config)
+		}
+	}
+}
+
+func TestScraper_TargetLabelPrecedence(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, `up{job="exporter",instance="10.0.0.1:80",env="metric",zone="m"} 1`+"\n")
+	}))
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "http://")
+
+	receiver := make(Receiver, 1)
+	comp, err := NewScraper(component.Config{
+		Type: "prometheus.scrape",
+		Name: "test",
+		Config: map[string]interface{}{
+			"job_name":   "node",
+			"forward_to": []interface{}{receiver},
+			"relabel_config": []interface{}{
+				map[string]interface{}{
+					"source_labels": []interface{}{"__address__"},
+					"regex":         `([^:]+):\d+`,
+					"target_label":  "host",
+				},
+				map[string]interface{}{
+					"source_labels": []interface{}{"__meta_dns_name"},
+					"target_label":  "service",
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// As discovered, with a __meta label for relabeling
+	target := Target{Address: address, Labels: map[string]string{
+		"env":             "prod",
+		"team":            "a",
+		"__meta_dns_name": "api.internal",
+	}}
+	if err := comp.(*Scraper).scrapeTarget(context.Background(), target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"__name__":          "up",
+		"job":               "node",
+		"exported_job":      "exporter",
+		"instance":          address,
+		"exported_instance": "10.0.0.1:80",
+		"env":               "metric",
+		"zone":              "m",
+		"team":              "a",
+		"host":              "127.0.0.1",
+		"service":           "api.internal",
+	}
+	if samples := <-receiver; !reflect.DeepEqual(samples[0].Labels, want) {
+		t.Errorf("expected labels %v, got %v", want, samples[0].Labels)
+	}
+}
+
+func TestTarget_AttachedLabels(t *testing.T) {
+	tests := []struct {
+		target Target
+		want   map[string]string
+	}{
+		{
+			target: Target{Address: "node:9100"},
+			want:   map[string]string{"job": "default", "instance": "node:9100", "__address__": "node:9100"},
+		},
+		{
+			target: Target{Address: "https://db:9187/metrics"},
+			want:   map[string]string{"job": "default", "instance": "db:9187", "__address__": "https://db:9187/metrics"},
+		},
+		{
+			target: Target{Address: "api:8080", Labels: map[string]string{"job": "api", "instance": "api-1"}},
+			want:   map[string]string{"job": "api", "instance": "api-1", "__address__": "api:8080"},
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.target.attachedLabels("default"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.target.Address, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package prometheus
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// exposition identifies a metrics text format
+type exposition int
+
+const (
+	formatPrometheus exposition = iota
+	formatOpenMetrics
+)
+
+func (f exposition) String() string {
+	if f == formatOpenMetrics {
+		return "openmetrics"
+	}
+	return "prometheus"
+}
+
+// acceptHeader prefers OpenMetrics and falls back to the classic text format
+const acceptHeader = "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
+// detectFormat picks the parser for a scrape response from its
+// Content-Type, sniffing the body when the header is missing or unusable.
+// OpenMetrics bodies always end with "# EOF".
+func detectFormat(contentType string, body []byte) exposition {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case "application/openmetrics-text":
+			return formatOpenMetrics
+		case "text/plain":
+			return formatPrometheus
+		}
+	}
+
+	if bytes.HasSuffix(bytes.TrimRight(body, "\n"), []byte("# EOF")) {
+		return formatOpenMetrics
+	}
+	return formatPrometheus
+}
+
+// parseExposition parses a scrape body in the given format. Samples without
+// an explicit timestamp get defaultTimestamp (Unix milliseconds). The
+// OpenMetrics parser additionally enforces the "# EOF" terminator, accepts
+// fractional-second timestamps, checks samples against the TYPE and UNIT
+// of their family, validates and skips exemplars, and drops the _created
+// series of counters, histograms and summaries, which hold creation times
+// rather than values.
+func parseExposition(format exposition, body []byte, defaultTimestamp int64) ([]Sample, error) {
+	var samples []Sample
+	sawEOF := false
+	families := make(map[string]*metricFamily)
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		if sawEOF {
+			return nil, fmt.Errorf("line %d: content after # EOF", lineNo)
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if format != formatOpenMetrics {
+				// HELP, TYPE and plain comments carry no samples
+				continue
+			}
+			if line == "# EOF" {
+				sawEOF = true
+				continue
+			}
+			if err := parseMetadata(line, families); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			continue
+		}
+
+		sample, exemplar, err := parseSampleLine(format, line, defaultTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if format == formatOpenMetrics {
+			keep, err := checkFamily(sample.Labels["__name__"], exemplar, families)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if !keep {
+				continue
+			}
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if format == formatOpenMetrics && !sawEOF {
+		return nil, fmt.Errorf("openmetrics exposition is missing # EOF")
+	}
+	return samples, nil
+}
+
+// parseSampleLine parses `name{label="value",...} value [timestamp]`,
+// followed in OpenMetrics by an optional exemplar, which is validated and
+// reported but not returned
+func parseSampleLine(format exposition, line string, defaultTimestamp int64) (Sample, bool, error) {
+	end := 0
+	for end < len(line) && isMetricNameChar(line[end], end == 0) {
+		end++
+	}
+	if end == 0 {
+		return Sample{}, false, fmt.Errorf("invalid metric name in %q", line)
+	}
+
+	labels := map[string]string{"__name__": line[:end]}
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		n, err := parseLabels(rest, labels)
+		if err != nil {
+			return Sample{}, false, err
+		}
+		rest = rest[n:]
+	}
+
+	exemplar := false
+	if format == formatOpenMetrics {
+		// Exemplars follow the sample after " # "
+		if i := strings.Index(rest, " # "); i >= 0 {
+			if err := parseExemplar(rest[i+3:]); err != nil {
+				return Sample{}, false, err
+			}
+			rest = rest[:i]
+			exemplar = true
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return Sample{}, false, fmt.Errorf("expected value and optional timestamp in %q", line)
+	}
+
+	value, err := parseValue(fields[0])
+	if err != nil {
+		return Sample{}, false, err
+	}
+
+	timestamp := defaultTimestamp
+	if len(fields) == 2 {
+		timestamp, err = parseTimestamp(format, fields[1])
+		if err != nil {
+			return Sample{}, false, err
+		}
+	}
+
+	return Sample{Labels: labels, Value: value, Timestamp: timestamp}, exemplar, nil
+}
+
+// maxExemplarLabelRunes caps the combined length of an exemplar's label
+// names and values, as OpenMetrics requires
+const maxExemplarLabelRunes = 128
+
+// parseExemplar validates an OpenMetrics exemplar:
+// `{label="value",...} value [timestamp]`
+func parseExemplar(s string) error {
+	if !strings.HasPrefix(s, "{") {
+		return fmt.Errorf("exemplar must start with a label set")
+	}
+	labels := make(map[string]string)
+	n, err := parseLabels(s, labels)
+	if err != nil {
+		return fmt.Errorf("exemplar: %w", err)
+	}
+	runes := 0
+	for name, value := range labels {
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	if runes > maxExemplarLabelRunes {
+		return fmt.Errorf("exemplar labels exceed %d characters", maxExemplarLabelRunes)
+	}
+
+	fields := strings.Fields(s[n:])
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("exemplar: expected value and optional timestamp")
+	}
+	if _, err := parseValue(fields[0]); err != nil {
+		return fmt.Errorf("exemplar: %w", err)
+	}
+	if len(fields) == 2 {
+		if _, err := parseTimestamp(formatOpenMetrics, fields[1]); err != nil {
+			return fmt.Errorf("exemplar: %w", err)
+		}
+	}
+	return nil
+}
+
+// metricFamily is the metadata an OpenMetrics exposition declared for a
+// metric family
+type metricFamily struct {
+	typ  string
+	unit string
+
+	// sampled is set once a sample of the family is seen, after which
+	// its metadata can't change
+	sampled bool
+}
+
+// openMetricsSuffixes lists the sample name suffixes each OpenMetrics
+// type allows, "" being the family name itself
+var openMetricsSuffixes = map[string][]string{
+	"counter":        {"_total", "_created"},
+	"gauge":          {""},
+	"histogram":      {"_bucket", "_count", "_sum", "_created"},
+	"gaugehistogram": {"_bucket", "_gcount", "_gsum"},
+	"summary":        {"", "_count", "_sum", "_created"},
+	"info":           {"_info"},
+	"stateset":       {""},
+	"unknown":        {""},
+}
+
+// parseMetadata records a `# TYPE`, `# UNIT` or `# HELP` line in families
+func parseMetadata(line string, families map[string]*metricFamily) error {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 || fields[0] != "#" {
+		return fmt.Errorf("invalid comment %q", line)
+	}
+	keyword, name := fields[1], fields[2]
+	value := ""
+	if len(fields) == 4 {
+		value = fields[3]
+	}
+
+	family, ok := families[name]
+	if !ok {
+		family = &metricFamily{}
+		families[name] = family
+	}
+
+	switch keyword {
+	case "HELP":
+		return nil
+	case "TYPE":
+		if _, known := openMetricsSuffixes[value]; !known {
+			return fmt.Errorf("unknown type %q for %s", value, name)
+		}
+		if family.typ != "" {
+			return fmt.Errorf("duplicate TYPE for %s", name)
+		}
+		if family.sampled {
+			return fmt.Errorf("TYPE for %s follows its samples", name)
+		}
+		family.typ = value
+	case "UNIT":
+		if family.unit != "" {
+			return fmt.Errorf("duplicate UNIT for %s", name)
+		}
+		if family.sampled {
+			return fmt.Errorf("UNIT for %s follows its samples", name)
+		}
+		if value == "" || !strings.HasSuffix(name, "_"+value) {
+			return fmt.Errorf("metric %s must end in its unit %q", name, value)
+		}
+		family.unit = value
+	default:
+		return fmt.Errorf("unknown metadata %q", keyword)
+	}
+	return nil
+}
+
+// familySuffixes are the suffixes a sample name may add to its family's
+// name, tried in order
+var familySuffixes = []string{"", "_total", "_created", "_bucket", "_count", "_sum", "_gcount", "_gsum", "_info"}
+
+// checkFamily finds the typed family of an OpenMetrics sample and reports
+// whether the sample is kept. Samples of typed families must use one of
+// the type's suffixes, and only counter totals and histogram buckets may
+// carry exemplars.
+func checkFamily(name string, exemplar bool, families map[string]*metricFamily) (bool, error) {
+	var misnamed *metricFamily
+	for _, suffix := range familySuffixes {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		family, ok := families[strings.TrimSuffix(name, suffix)]
+		if !ok || family.typ == "" {
+			continue
+		}
+		if !allowsSuffix(family.typ, suffix) {
+			if suffix == "" {
+				misnamed = family
+			}
+			continue
+		}
+
+		family.sampled = true
+		if exemplar && suffix != "_total" && suffix != "_bucket" {
+			return false, fmt.Errorf("%s: exemplars are only allowed on counter totals and histogram buckets", name)
+		}
+		return suffix != "_created", nil
+	}
+
+	if misnamed != nil {
+		return false, fmt.Errorf("%s: a %s's samples must end in one of %s",
+			name, misnamed.typ, strings.Join(openMetricsSuffixes[misnamed.typ], ", "))
+	}
+	if family, ok := families[name]; ok {
+		family.sampled = true
+	}
+	return true, nil
+}
+
+func allowsSuffix(typ, suffix string) bool {
+	for _, s := range openMetricsSuffixes[typ] {
+		if s == suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLabels parses a {...} label set at the start of s into labels and
+// returns the number of bytes consumed
+func parseLabels(s string, labels map[string]string) (int, error) {
+	i := 1 // skip '{'
+	for {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) {
+			return 0, fmt.Errorf("unterminated label set")
+		}
+		if s[i] == '}' {
+			return i + 1, nil
+		}
+
+		start := i
+		for i < len(s) && isLabelNameChar(s[i], i == start) {
+			i++
+		}
+		name := s[start:i]
+		if name == "" || i >= len(s) || s[i] != '=' {
+			return 0, fmt.Errorf("invalid label name at %q", s[start:])
+		}
+		i++
+		if i >= len(s) || s[i] != '"' {
+			return 0, fmt.Errorf("label %s: expected quoted value", name)
+		}
+		i++
+
+		var value strings.Builder
+		for {
+			if i >= len(s) {
+				return 0, fmt.Errorf("label %s: unterminated value", name)
+			}
+			c := s[i]
+			if c == '"' {
+				i++
+				break
+			}
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case '\\', '"':
+					value.WriteByte(s[i])
+				default:
+					return 0, fmt.Errorf("label %s: invalid escape \\%c", name, s[i])
+				}
+				i++
+				continue
+			}
+			value.WriteByte(c)
+			i++
+		}
+		if _, dup := labels[name]; dup {
+			return 0, fmt.Errorf("duplicate label %s", name)
+		}
+		labels[name] = value.String()
+
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		switch {
+		case i < len(s) && s[i] == ',':
+			i++
+		case i < len(s) && s[i] == '}':
+		case i >= len(s):
+			return 0, fmt.Errorf("unterminated label set")
+		default:
+			return 0, fmt.Errorf("expected , or } after label %s", name)
+		}
+	}
+}
+
+func parseValue(s string) (float64, error) {
+	switch s {
+	case "+Inf", "Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// parseTimestamp converts a sample timestamp to Unix milliseconds. The
+// Prometheus format uses integer milliseconds, OpenMetrics uses seconds
+// with an optional fraction.
+func parseTimestamp(format exposition, s string) (int64, error) {
+	if format == formatOpenMetrics {
+		secs, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		return int64(math.Round(secs * 1000)), nil
+	}
+
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return ms, nil
+}
+
+func isMetricNameChar(c byte, first bool) bool {
+	return c == ':' || isLabelNameChar(c, first)
+}
+
+func isLabelNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
@@ -0,0 +1,169 @@
+package prometheus
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExposition_Prometheus(t *testing.T) {
+	body := `# HELP http_requests_total Total requests
+# TYPE http_requests_total counter
+http_requests_total{method="GET",path="/api \"v1\"\\"} 1027 1700000000123
+http_requests_total{method="POST",} 3
+up 1
+
+node_load1 +Inf
+`
+	samples, err := parseExposition(formatPrometheus, []byte(body), 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("expected 4 samples, got %d", len(samples))
+	}
+
+	expected := Sample{
+		Labels:    map[string]string{"__name__": "http_requests_total", "method": "GET", "path": `/api "v1"\`},
+		Value:     1027,
+		Timestamp: 1700000000123,
+	}
+	if !reflect.DeepEqual(samples[0], expected) {
+		t.Errorf("expected %+v, got %+v", expected, samples[0])
+	}
+	if samples[1].Labels["method"] != "POST" || samples[1].Timestamp != 42 {
+		t.Errorf("expected default timestamp and trailing comma to parse, got %+v", samples[1])
+	}
+	if !math.IsInf(samples[3].Value, 1) {
+		t.Errorf("expected +Inf, got %v", samples[3].Value)
+	}
+}
+
+func TestParseExposition_OpenMetrics(t *testing.T) {
+	body := `# TYPE request_seconds histogram
+# UNIT request_seconds seconds
+request_seconds_bucket{le="0.5"} 12 1700000000.5 # {trace_id="abc"} 0.3 1700000000.1
+request_seconds_count 14
+# EOF
+`
+	samples, err := parseExposition(formatOpenMetrics, []byte(body), 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 samples, got %d", len(samples))
+	}
+	if samples[0].Timestamp != 1700000000500 {
+		t.Errorf("expected fractional seconds converted to ms, got %d", samples[0].Timestamp)
+	}
+	if samples[0].Value != 12 || samples[0].Labels["le"] != "0.5" {
+		t.Errorf("unexpected sample %+v", samples[0])
+	}
+}
+
+func TestParseExposition_OpenMetricsFamilies(t *testing.T) {
+	body := `# HELP http_requests Requests served
+# TYPE http_requests counter
+http_requests_total{code="200"} 1027 # {trace_id="4bf92f3577b34da6"} 1 1700000000.123
+http_requests_created{code="200"} 1699990000.5
+# TYPE build info
+build_info{version="1.2.0"} 1
+# TYPE rpc_duration_seconds summary
+# UNIT rpc_duration_seconds seconds
+rpc_duration_seconds{quantile="0.99"} 0.25
+rpc_duration_seconds_sum 17.5
+rpc_duration_seconds_count 70
+rpc_duration_seconds_created 1699990000
+queue_depth 3
+# EOF
+`
+	samples, err := parseExposition(formatOpenMetrics, []byte(body), 42)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, s := range samples {
+		names = append(names, s.Labels["__name__"])
+	}
+	want := []string{
+		"http_requests_total",
+		"build_info",
+		"rpc_duration_seconds",
+		"rpc_duration_seconds_sum",
+		"rpc_duration_seconds_count",
+		"queue_depth",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected %v with _created series dropped, got %v", want, names)
+	}
+	if samples[0].Value != 1027 || samples[0].Labels["code"] != "200" || len(samples[0].Labels) != 2 {
+		t.Errorf("expected the exemplar to be left off the sample, got %+v", samples[0])
+	}
+}
+
+func TestParseExposition_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format exposition
+		body   string
+		want   string
+	}{
+		{"missing eof", formatOpenMetrics, "up 1\n", "missing # EOF"},
+		{"content after eof", formatOpenMetrics, "up 1\n# EOF\nup 2\n", "content after # EOF"},
+		{"bad value", formatPrometheus, "up one\n", "invalid value"},
+		{"unterminated labels", formatPrometheus, `up{job="x"`, "unterminated label set"},
+		{"missing comma", formatPrometheus, `up{job="x" env="y"} 1`, "expected , or }"},
+		{"duplicate label", formatPrometheus, `up{job="a",job="b"} 1`, "duplicate label"},
+		{"float timestamp in prometheus", formatPrometheus, "up 1 1700000000.5\n", "invalid timestamp"},
+		{"bad name", formatPrometheus, "1up 1\n", "invalid metric name"},
+		{"unknown type", formatOpenMetrics, "# TYPE up untyped\nup 1\n# EOF\n", "unknown type"},
+		{"duplicate type", formatOpenMetrics, "# TYPE up gauge\n# TYPE up gauge\nup 1\n# EOF\n", "duplicate TYPE"},
+		{"type after samples", formatOpenMetrics, "# UNIT up_seconds seconds\nup_seconds 1\n# TYPE up_seconds gauge\n# EOF\n", "TYPE for up_seconds follows its samples"},
+		{"unit after samples", formatOpenMetrics, "# TYPE up_seconds gauge\nup_seconds 1\n# UNIT up_seconds seconds\n# EOF\n", "follows its samples"},
+		{"unit not in name", formatOpenMetrics, "# UNIT latency seconds\nlatency 1\n# EOF\n", "must end in its unit"},
+		{"counter without total", formatOpenMetrics, "# TYPE requests counter\nrequests 1\n# EOF\n", "must end in one of _total, _created"},
+		{"exemplar on gauge", formatOpenMetrics, "# TYPE temp gauge\ntemp 1 # {id=\"a\"} 1\n# EOF\n", "exemplars are only allowed"},
+		{"malformed exemplar", formatOpenMetrics, "# TYPE req counter\nreq_total 1 # id=a 1\n# EOF\n", "exemplar must start with a label set"},
+		{"exemplar without value", formatOpenMetrics, "# TYPE req counter\nreq_total 1 # {id=\"a\"}\n# EOF\n", "exemplar: expected value"},
+		{"long exemplar", formatOpenMetrics, "# TYPE req counter\nreq_total 1 # {id=\"" + strings.Repeat("a", 127) + "\"} 1\n# EOF\n", "exceed 128 characters"},
+		{"unknown metadata", formatOpenMetrics, "# FOO up\nup 1\n# EOF\n", "unknown metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExposition(tt.format, []byte(tt.body), 0)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	omBody := []byte("up 1\n# EOF\n")
+	promBody := []byte("up 1\n")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        exposition
+	}{
+		{"openmetrics header", "application/openmetrics-text; version=1.0.0; charset=utf-8", promBody, formatOpenMetrics},
+		{"prometheus header", "text/plain; version=0.0.4; charset=utf-8", omBody, formatPrometheus},
+		{"missing header sniffs openmetrics", "", omBody, formatOpenMetrics},
+		{"missing header sniffs prometheus", "", promBody, formatPrometheus},
+		{"garbled header sniffs", "text/;;;", omBody, formatOpenMetrics},
+		{"unrelated header sniffs", "application/octet-stream", promBody, formatPrometheus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectFormat(tt.contentType, tt.body); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
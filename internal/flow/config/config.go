@@ -0,0 +1,382 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/engine"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// referenceType wraps component.Reference values so they can flow through
+// HCL expression evaluation
+var referenceType = cty.Capsule("reference", reflect.TypeOf(component.Reference{}))
+
+// Load reads and parses the flow configuration file at path
+func Load(path string, registry *component.Registry) (*engine.Config, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(src, path, registry)
+}
+
+// Parse parses a flow configuration. Each component is a block whose type
+// is the component type with dots replaced by underscores:
+//
+//	prometheus_scrape "default" {
+//	  targets    = ["localhost:9090"]
+//	  forward_to = [prometheus.remote_write.default.receiver]
+//	}
+//
+// Components reference each other's exports as <type>.<name>.<export>,
+// using either the dotted or underscored type. References are kept as
+// component.Reference values for the engine to resolve.
+func Parse(src []byte, filename string, registry *component.Registry) (*engine.Config, error) {
+	if registry == nil {
+		registry = component.DefaultRegistry
+	}
+
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	body := file.Body.(*hclsyntax.Body)
+
+	// HCL identifiers can't contain dots, so block types use underscores
+	blockTypes := make(map[string]string)
+	for _, t := range registry.Types() {
+		blockTypes[strings.ReplaceAll(t, ".", "_")] = t
+	}
+
+	cfg := &engine.Config{
+		LogLevel: "info",
+		Registry: registry,
+	}
+
+	type pending struct {
+		cfg   component.Config
+		block *hclsyntax.Block
+	}
+	var blocks []pending
+
+	for _, attr := range body.Attributes {
+		return nil, fmt.Errorf("%s: unexpected top-level attribute %q", attr.SrcRange, attr.Name)
+	}
+
+	for _, block := range body.Blocks {
+		if block.Type == "flow" {
+			if err := parseFlowBlock(block, cfg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		componentType, ok := blockTypes[block.Type]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown component type %q", block.TypeRange, block.Type)
+		}
+		if len(block.Labels) != 1 {
+			return nil, fmt.Errorf("%s: component %q requires exactly one name label", block.TypeRange, block.Type)
+		}
+
+		blocks = append(blocks, pending{
+			cfg: component.Config{
+				Type: componentType,
+				Name: block.Labels[0],
+			},
+			block: block,
+		})
+	}
+
+	declared := make(map[string]component.Config, len(blocks))
+	for _, b := range blocks {
+		declared[b.cfg.ID()] = b.cfg
+	}
+
+	for _, b := range blocks {
+		values, err := blockValues(b.block.Body, func(t hcl.Traversal) (cty.Value, error) {
+			return resolveTraversal(t, declared, registry)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", b.block.Type, b.cfg.Name, err)
+		}
+		b.cfg.Config = values
+		cfg.Components = append(cfg.Components, b.cfg)
+	}
+
+	return cfg, nil
+}
+
+func parseFlowBlock(block *hclsyntax.Block, cfg *engine.Config) error {
+	values, err := blockValues(block.Body, nil)
+	if err != nil {
+		return fmt.Errorf("flow: %w", err)
+	}
+	if v, ok := values["log_level"].(string); ok {
+		cfg.LogLevel = v
+	}
+	if v, ok := values["http_listen_address"]; ok {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return fmt.Errorf("flow: http_listen_address must be a non-empty string")
+		}
+		cfg.HTTPListenAddress = s
+	}
+	if v, ok := values["max_restarts"]; ok {
+		n, ok := v.(int)
+		if !ok || n < 0 {
+			return fmt.Errorf("flow: max_restarts must be a non-negative number")
+		}
+		cfg.MaxRestarts = n
+	}
+	for key, dst := range map[string]*time.Duration{
+		"restart_backoff":     &cfg.RestartBackoff,
+		"max_restart_backoff": &cfg.MaxRestartBackoff,
+	} {
+		v, ok := values[key]
+		if !ok {
+			continue
+		}
+		s, _ := v.(string)
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("flow: %s must be a positive duration such as \"1s\"", key)
+		}
+		*dst = d
+	}
+	return nil
+}
+
+// resolveTraversal turns a reference such as
+// prometheus.remote_write.default.receiver into a capsule holding the
+// corresponding component.Reference
+func resolveTraversal(t hcl.Traversal, declared map[string]component.Config, registry *component.Registry) (cty.Value, error) {
+	parts := []string{t.RootName()}
+	for _, step := range t[1:] {
+		attr, ok := step.(hcl.TraverseAttr)
+		if !ok {
+			return cty.NilVal, fmt.Errorf("%s: unsupported reference syntax", t.SourceRange())
+		}
+		parts = append(parts, attr.Name)
+	}
+	path := strings.Join(parts, ".")
+
+	// Longest matching component ID wins, trying both type spellings
+	var match component.Config
+	var rest []string
+	for _, c := range declared {
+		for _, prefix := range []string{c.ID(), strings.ReplaceAll(c.Type, ".", "_") + "." + c.Name} {
+			if path == prefix || strings.HasPrefix(path, prefix+".") {
+				if match.Type == "" || len(c.ID()) > len(match.ID()) {
+					match = c
+					rest = strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, prefix), "."), ".")
+				}
+			}
+		}
+	}
+
+	if match.Type == "" {
+		if isComponentNamespace(parts[0], registry) {
+			return cty.NilVal, fmt.Errorf("%s: reference to undefined component %q", t.SourceRange(), path)
+		}
+		return cty.NilVal, fmt.Errorf("%s: unknown variable %q", t.SourceRange(), path)
+	}
+	if len(rest) != 1 || rest[0] == "" {
+		return cty.NilVal, fmt.Errorf("%s: reference %q must name exactly one export of %s", t.SourceRange(), path, match.ID())
+	}
+
+	ref := component.Reference{Component: match.ID(), Export: rest[0]}
+	return cty.CapsuleVal(referenceType, &ref), nil
+}
+
+// isComponentNamespace reports whether name is the first segment of a
+// registered component type in either spelling
+func isComponentNamespace(name string, registry *component.Registry) bool {
+	for _, t := range registry.Types() {
+		if strings.SplitN(t, ".", 2)[0] == name || strings.ReplaceAll(t, ".", "_") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// blockValues evaluates the attributes and nested blocks of body into a
+// generic map. Nested blocks are collected into a list under their type so
+// repeated blocks such as relabel_config are preserved in order.
+func blockValues(body *hclsyntax.Body, resolve func(hcl.Traversal) (cty.Value, error)) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	names := make([]string, 0, len(body.Attributes))
+	for name := range body.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		attr := body.Attributes[name]
+		ctx, err := evalContext(attr.Expr, resolve)
+		if err != nil {
+			return nil, err
+		}
+
+		val, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		goVal, err := toGo(val)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", attr.SrcRange, err)
+		}
+		values[name] = goVal
+	}
+
+	for _, block := range body.Blocks {
+		if len(block.Labels) > 0 {
+			return nil, fmt.Errorf("%s: nested block %q does not take labels", block.TypeRange, block.Type)
+		}
+		nested, err := blockValues(block.Body, resolve)
+		if err != nil {
+			return nil, err
+		}
+		list, _ := values[block.Type].([]interface{})
+		values[block.Type] = append(list, nested)
+	}
+
+	return values, nil
+}
+
+// evalContext builds the variables an expression references, nesting each
+// resolved reference under its traversal path
+func evalContext(expr hcl.Expression, resolve func(hcl.Traversal) (cty.Value, error)) (*hcl.EvalContext, error) {
+	ctx := &hcl.EvalContext{
+		Functions: functions(),
+	}
+
+	traversals := expr.Variables()
+	if len(traversals) == 0 {
+		return ctx, nil
+	}
+	if resolve == nil {
+		return nil, fmt.Errorf("%s: references are not allowed here", traversals[0].SourceRange())
+	}
+
+	tree := make(map[string]interface{})
+	for _, t := range traversals {
+		val, err := resolve(t)
+		if err != nil {
+			return nil, err
+		}
+
+		node := tree
+		names := []string{t.RootName()}
+		for _, step := range t[1:] {
+			names = append(names, step.(hcl.TraverseAttr).Name)
+		}
+		for _, name := range names[:len(names)-1] {
+			child, ok := node[name].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[name] = child
+			}
+			node = child
+		}
+		node[names[len(names)-1]] = val
+	}
+
+	ctx.Variables = make(map[string]cty.Value, len(tree))
+	for name, node := range tree {
+		ctx.Variables[name] = treeValue(node)
+	}
+	return ctx, nil
+}
+
+func treeValue(node interface{}) cty.Value {
+	if val, ok := node.(cty.Value); ok {
+		return val
+	}
+	attrs := make(map[string]cty.Value)
+	for name, child := range node.(map[string]interface{}) {
+		attrs[name] = treeValue(child)
+	}
+	return cty.ObjectVal(attrs)
+}
+
+func functions() map[string]function.Function {
+	return map[string]function.Function{
+		"env": function.New(&function.Spec{
+			Params: []function.Parameter{{Name: "name", Type: cty.String}},
+			Type:   function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				return cty.StringVal(os.Getenv(args[0].AsString())), nil
+			},
+		}),
+		"concat": stdlib.ConcatFunc,
+		"lower":  stdlib.LowerFunc,
+		"upper":  stdlib.UpperFunc,
+	}
+}
+
+// toGo converts an evaluated HCL value into plain Go values: strings,
+// ints or float64s, bools, []interface{}, map[string]interface{}, and
+// component.Reference for references
+func toGo(val cty.Value) (interface{}, error) {
+	if val.IsNull() {
+		return nil, nil
+	}
+	if !val.IsKnown() {
+		return nil, fmt.Errorf("value is not known")
+	}
+
+	ty := val.Type()
+	switch {
+	case ty == referenceType:
+		return *val.EncapsulatedValue().(*component.Reference), nil
+	case ty == cty.String:
+		return val.AsString(), nil
+	case ty == cty.Bool:
+		return val.True(), nil
+	case ty == cty.Number:
+		bf := val.AsBigFloat()
+		if bf.IsInt() {
+			i, _ := bf.Int64()
+			return int(i), nil
+		}
+		f, _ := bf.Float64()
+		return f, nil
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
+		list := make([]interface{}, 0, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			v, err := toGo(elem)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case ty.IsMapType() || ty.IsObjectType():
+		m := make(map[string]interface{}, val.LengthInt())
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			v, err := toGo(elem)
+			if err != nil {
+				return nil, err
+			}
+			m[key.AsString()] = v
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value type %s", ty.FriendlyName())
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+type fakeComponent struct {
+	id string
+}
+
+func (f *fakeComponent) ID() string                    { return f.id }
+func (f *fakeComponent) Run(ctx context.Context) error { <-ctx.Done(); return nil }
+func (f *fakeComponent) Health() component.Health {
+	return component.Health{Status: component.StatusHealthy}
+}
+
+func testRegistry() *component.Registry {
+	registry := component.NewRegistry()
+	for _, t := range []string{"prometheus.scrape", "prometheus.remote_write"} {
+		registry.Register(t, func(cfg component.Config) (component.Component, error) {
+			return &fakeComponent{id: cfg.ID()}, nil
+		})
+	}
+	return registry
+}
+
+func TestParse_References(t *testing.T) {
+	src := `
+flow {
+  log_level = "debug"
+}
+
+prometheus_scrape "default" {
+  targets         = ["localhost:9090", "localhost:9100"]
+  scrape_interval = "15s"
+  forward_to      = [prometheus.remote_write.primary.receiver, prometheus_remote_write.backup.receiver]
+
+  relabel_config {
+    action = "drop"
+  }
+}
+
+prometheus_remote_write "primary" {
+  endpoint   = "http://prometheus:9090/api/v1/write"
+  batch_size = 500
+}
+
+prometheus_remote_write "backup" {
+  endpoint = "http://backup:9090/api/v1/write"
+}
+`
+	cfg, err := Parse([]byte(src), "flow.hcl", testRegistry())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.LogLevel != "debug" {
+		t.Errorf("expected log level debug, got %s", cfg.LogLevel)
+	}
+	if len(cfg.Components) != 3 {
+		t.Fatalf("expected 3 components, got %d", len(cfg.Components))
+	}
+
+	scrape := cfg.Components[0]
+	if scrape.ID() != "prometheus.scrape.default" {
+		t.Fatalf("expected scrape component first, got %s", scrape.ID())
+	}
+
+	forwardTo, ok := scrape.Config["forward_to"].([]interface{})
+	if !ok || len(forwardTo) != 2 {
+		t.Fatalf("expected 2 forward_to entries, got %#v", scrape.Config["forward_to"])
+	}
+	expected := []component.Reference{
+		{Component: "prometheus.remote_write.primary", Export: "receiver"},
+		{Component: "prometheus.remote_write.backup", Export: "receiver"},
+	}
+	for i, ref := range expected {
+		if forwardTo[i] != ref {
+			t.Errorf("forward_to[%d]: expected %v, got %#v", i, ref, forwardTo[i])
+		}
+	}
+
+	targets, _ := scrape.Config["targets"].([]interface{})
+	if len(targets) != 2 || targets[0] != "localhost:9090" {
+		t.Errorf("unexpected targets %#v", scrape.Config["targets"])
+	}
+
+	relabel, _ := scrape.Config["relabel_config"].([]interface{})
+	if len(relabel) != 1 {
+		t.Errorf("expected nested block to be collected into a list, got %#v", scrape.Config["relabel_config"])
+	}
+
+	if cfg.Components[1].Config["batch_size"] != 500 {
+		t.Errorf("expected integer batch_size, got %#v", cfg.Components[1].Config["batch_size"])
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "unknown component type",
+			src:  `loki_source_journal "x" {}`,
+			want: `unknown component type "loki_source_journal"`,
+		},
+		{
+			name: "undefined reference",
+			src: `prometheus_scrape "x" {
+  forward_to = [prometheus.remote_write.missing.receiver]
+}`,
+			want: "reference to undefined component",
+		},
+		{
+			name: "reference without export",
+			src: `prometheus_scrape "x" {
+  forward_to = [prometheus.remote_write.y]
+}
+prometheus_remote_write "y" {}`,
+			want: "must name exactly one export",
+		},
+		{
+			name: "missing label",
+			src:  `prometheus_scrape {}`,
+			want: "requires exactly one name label",
+		},
+		{
+			name: "negative max_restarts",
+			src:  `flow { max_restarts = -1 }`,
+			want: "max_restarts must be a non-negative number",
+		},
+		{
+			name: "invalid restart_backoff",
+			src:  `flow { restart_backoff = "soon" }`,
+			want: "restart_backoff must be a positive duration",
+		},
+		{
+			name: "syntax error",
+			src:  `prometheus_scrape "x" {`,
+			want: "flow.hcl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src), "flow.hcl", testRegistry())
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParse_FlowBlock(t *testing.T) {
+	cfg, err := Parse([]byte(`flow {
+  http_listen_address = "127.0.0.1:12345"
+  max_restarts        = 5
+  restart_backoff     = "2s"
+  max_restart_backoff = "30s"
+}`), "flow.hcl", testRegistry())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.MaxRestarts != 5 || cfg.RestartBackoff != 2*time.Second || cfg.MaxRestartBackoff != 30*time.Second {
+		t.Errorf("unexpected supervision settings %d %s %s", cfg.MaxRestarts, cfg.RestartBackoff, cfg.MaxRestartBackoff)
+	}
+	if cfg.HTTPListenAddress != "127.0.0.1:12345" {
+		t.Errorf("expected http_listen_address, got %q", cfg.HTTPListenAddress)
+	}
+}
+
+func TestParse_EnvFunction(t *testing.T) {
+	t.Setenv("REMOTE_WRITE_URL", "http://example:9090/api/v1/write")
+
+	cfg, err := Parse([]byte(`prometheus_remote_write "x" {
+  endpoint = env("REMOTE_WRITE_URL")
+}`), "flow.hcl", testRegistry())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := cfg.Components[0].Config["endpoint"]; got != "http://example:9090/api/v1/write" {
+		t.Errorf("expected endpoint from env, got %v", got)
+	}
+}
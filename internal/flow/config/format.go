@@ -0,0 +1,17 @@
+package config
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// Format returns src in canonical HCL layout: consistent indentation,
+// aligned equals signs and normalized spacing. It fails on syntax errors
+// rather than formatting a broken file.
+func Format(src []byte, filename string) ([]byte, error) {
+	if _, diags := hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1}); diags.HasErrors() {
+		return nil, diags
+	}
+	return hclwrite.Format(src), nil
+}
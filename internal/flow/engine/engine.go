@@ -2,10 +2,16 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/vjranagit/grafana/internal/flow/component"
 	"golang.org/x/sync/errgroup"
 )
@@ -13,86 +19,481 @@ import (
 type Config struct {
 	LogLevel   string
 	Components []component.Config
+
+	// Registry used to create components, defaults to
+	// component.DefaultRegistry
+	Registry *component.Registry
+
+	// HealthHook, if set, is called when a component's health status
+	// changes and the new status has held for HealthDebounce
+	HealthHook          HealthHook
+	HealthCheckInterval time.Duration
+	HealthDebounce      time.Duration
+
+	// MaxRestarts is how many times a component whose Run fails is
+	// restarted before its failure stops the engine. Zero disables
+	// supervision, so the first failure stops the engine. Restarts back
+	// off exponentially from RestartBackoff up to MaxRestartBackoff.
+	MaxRestarts       int
+	RestartBackoff    time.Duration
+	MaxRestartBackoff time.Duration
+
+	// HTTPListenAddress, if set, serves /-/healthy and /components on
+	// that address
+	HTTPListenAddress string
 }
 
 type Engine struct {
-	cfg        *Config
-	components []component.Component
-	graph      *Graph
+	cfg   *Config
+	graph *Graph
+
+	// configs holds each component's config as written, before references
+	// are resolved, so a reload can tell which components changed
+	configs map[string]component.Config
+
+	// registry holds the metrics of every component
+	registry *prometheus.Registry
+
+	// reloadMu serialises reloads
+	reloadMu sync.Mutex
+
+	// mu guards the running state below. runCtx is only set while Run is
+	// running.
+	mu      sync.Mutex
+	runCtx  context.Context
+	running map[string]*runningComponent
+	errCh   chan error
+}
+
+// runningComponent tracks a started component so it can be stopped on its
+// own during a reload
+type runningComponent struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped atomic.Bool
 }
 
 func New(cfg *Config) (*Engine, error) {
 	eng := &Engine{
-		cfg:   cfg,
-		graph: NewGraph(),
+		cfg:      cfg,
+		graph:    NewGraph(),
+		configs:  make(map[string]component.Config),
+		registry: prometheus.NewRegistry(),
+		running:  make(map[string]*runningComponent),
 	}
 
 	// Build component graph
-	if err := eng.buildGraph(); err != nil {
+	plan, err := eng.build(cfg.Components)
+	if err != nil {
 		return nil, fmt.Errorf("failed to build component graph: %w", err)
 	}
+	if err := eng.apply(plan); err != nil {
+		return nil, err
+	}
 
 	return eng, nil
 }
 
-func (e *Engine) buildGraph() error {
-	// TODO: Parse HCL config and instantiate components
-	// For now, return empty graph
+// Validate checks cfg the way New would: every referenced component is
+// declared, the graph has no cycles and each component accepts its config.
+// Components are instantiated but never run.
+func Validate(cfg *Config) error {
+	eng := &Engine{
+		cfg:     cfg,
+		graph:   NewGraph(),
+		configs: make(map[string]component.Config),
+	}
+	if _, err := eng.build(cfg.Components); err != nil {
+		return fmt.Errorf("failed to build component graph: %w", err)
+	}
 	return nil
 }
 
-func (e *Engine) Run(ctx context.Context) error {
-	slog.Info("starting flow engine", "components", len(e.components))
+// buildPlan is a component graph instantiated from a config, along with
+// how it differs from the engine's current graph
+type buildPlan struct {
+	graph   *Graph
+	configs map[string]component.Config
+	order   []string
+
+	// created holds the IDs of new instances, which replace any current
+	// component with the same ID. reconfigure holds the resolved config of
+	// current components that apply their change in place.
+	created     map[string]bool
+	reconfigure map[string]component.Config
+}
+
+// build adds every configured component to a new graph with edges to the
+// components it references, then instantiates them in dependency order so
+// references can be resolved to the exports of already-instantiated
+// components. A current component is reused when neither its config nor
+// the exports it references changed.
+func (e *Engine) build(components []component.Config) (*buildPlan, error) {
+	registry := e.cfg.Registry
+	if registry == nil {
+		registry = component.DefaultRegistry
+	}
+
+	plan := &buildPlan{
+		graph:       NewGraph(),
+		configs:     make(map[string]component.Config, len(components)),
+		created:     make(map[string]bool),
+		reconfigure: make(map[string]component.Config),
+	}
+	for _, cfg := range components {
+		if _, exists := plan.configs[cfg.ID()]; exists {
+			return nil, fmt.Errorf("duplicate component %s", cfg.ID())
+		}
+		plan.configs[cfg.ID()] = cfg
+	}
+
+	for id, cfg := range plan.configs {
+		var dependsOn []string
+		for _, ref := range findReferences(cfg.Config) {
+			if _, ok := plan.configs[ref.Component]; !ok {
+				return nil, fmt.Errorf("component %s references undefined component %s", id, ref.Component)
+			}
+			dependsOn = append(dependsOn, ref.Component)
+		}
+		plan.graph.AddNode(id, dependsOn)
+		plan.graph.setType(id, cfg.Type)
+	}
+
+	order, err := plan.graph.TopologicalSort()
+	if err != nil {
+		return nil, err
+	}
+	plan.order = order
+
+	exports := make(map[string]map[string]interface{})
+	for _, id := range order {
+		cfg := plan.configs[id]
+
+		resolved, err := resolveReferences(cfg.Config, exports)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", id, err)
+		}
+		cfg.Config, _ = resolved.(map[string]interface{})
+
+		current := e.graph.GetComponent(id)
+		previous, existed := e.configs[id]
+		sameType := current != nil && existed && previous.Type == cfg.Type
+
+		var comp component.Component
+		if sameType && reflect.DeepEqual(previous.Config, plan.configs[id].Config) && !plan.dependsOnCreated(id) {
+			comp = current
+		} else {
+			// Creating an instance validates the config even when the
+			// current component is reconfigured in its place
+			created, err := registry.Create(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create component %s: %w", id, err)
+			}
+			if _, ok := current.(component.Reconfigurable); ok && sameType {
+				comp = current
+				plan.reconfigure[id] = cfg
+			} else {
+				comp = created
+				plan.created[id] = true
+			}
+		}
+
+		plan.graph.AddComponent(id, comp)
+		if exporter, ok := comp.(component.Exporter); ok {
+			exports[id] = exporter.Exports()
+		}
+	}
 
+	return plan, nil
+}
+
+// dependsOnCreated reports whether id references a newly created
+// component, whose exports differ from the one it replaces
+func (p *buildPlan) dependsOnCreated(id string) bool {
+	for _, dep := range p.graph.Dependencies(id) {
+		if p.created[dep] {
+			return true
+		}
+	}
+	return false
+}
+
+// apply makes plan the engine's graph. Removed and replaced components are
+// stopped, dependents first, changed components are reconfigured, and new
+// instances are started if the engine is running.
+func (e *Engine) apply(plan *buildPlan) error {
+	current, err := e.graph.TopologicalSort()
+	if err != nil {
+		return err
+	}
+	for i := len(current) - 1; i >= 0; i-- {
+		id := current[i]
+		if _, kept := plan.configs[id]; kept && !plan.created[id] {
+			continue
+		}
+		e.stop(id)
+		if comp := e.graph.GetComponent(id); comp != nil {
+			e.unregisterMetrics(id, comp)
+		}
+		slog.Info("stopped component", "id", id)
+	}
+
+	var errs []error
+	for _, id := range plan.order {
+		cfg, ok := plan.reconfigure[id]
+		if !ok {
+			continue
+		}
+		if err := plan.graph.GetComponent(id).(component.Reconfigurable).Reconfigure(cfg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to reconfigure component %s: %w", id, err))
+			continue
+		}
+		slog.Info("reconfigured component", "id", id)
+	}
+
+	for _, id := range plan.order {
+		if !plan.created[id] {
+			continue
+		}
+		if err := e.registerMetrics(id, plan.graph.GetComponent(id)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	e.graph.replace(plan.graph, plan.created)
+	e.configs = plan.configs
+
+	for _, id := range plan.order {
+		if plan.created[id] {
+			e.start(id, plan.graph.GetComponent(id))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (e *Engine) registerMetrics(id string, comp component.Component) error {
+	provider, ok := comp.(component.MetricsProvider)
+	if !ok {
+		return nil
+	}
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels{"instance": id}, e.registry)
+	for _, c := range provider.Collectors() {
+		if err := registerer.Register(c); err != nil {
+			return fmt.Errorf("failed to register metrics of component %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) unregisterMetrics(id string, comp component.Component) {
+	provider, ok := comp.(component.MetricsProvider)
+	if !ok {
+		return
+	}
+	registerer := prometheus.WrapRegistererWith(prometheus.Labels{"instance": id}, e.registry)
+	for _, c := range provider.Collectors() {
+		registerer.Unregister(c)
+	}
+}
+
+// findReferences returns every component.Reference nested in v
+func findReferences(v interface{}) []component.Reference {
+	switch val := v.(type) {
+	case component.Reference:
+		return []component.Reference{val}
+	case map[string]interface{}:
+		var refs []component.Reference
+		for _, item := range val {
+			refs = append(refs, findReferences(item)...)
+		}
+		return refs
+	case []interface{}:
+		var refs []component.Reference
+		for _, item := range val {
+			refs = append(refs, findReferences(item)...)
+		}
+		return refs
+	}
+	return nil
+}
+
+// resolveReferences returns a copy of v with every component.Reference
+// replaced by the value the referenced component exports
+func resolveReferences(v interface{}, exports map[string]map[string]interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case component.Reference:
+		exported, ok := exports[val.Component][val.Export]
+		if !ok {
+			return nil, fmt.Errorf("component %s has no export %q", val.Component, val.Export)
+		}
+		return exported, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			resolved, err := resolveReferences(item, exports)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			resolved, err := resolveReferences(item, exports)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// Registry returns the registry holding the components' metrics
+func (e *Engine) Registry() *prometheus.Registry {
+	return e.registry
+}
+
+// Graph returns the engine's component graph
+func (e *Engine) Graph() *Graph {
+	return e.graph
+}
+
+func (e *Engine) Run(ctx context.Context) error {
 	// Topological sort to determine component start order
 	startOrder, err := e.graph.TopologicalSort()
 	if err != nil {
 		return fmt.Errorf("failed to sort components: %w", err)
 	}
+	slog.Info("starting flow engine", "components", len(startOrder))
 
-	// Start components in order
-	g, ctx := errgroup.WithContext(ctx)
-	var mu sync.Mutex
-	startedComponents := make([]component.Component, 0, len(startOrder))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e.mu.Lock()
+	e.runCtx = ctx
+	e.errCh = make(chan error, 1)
+	errCh := e.errCh
+	e.mu.Unlock()
 
+	// Start components in order
 	for _, nodeID := range startOrder {
-		comp := e.graph.GetComponent(nodeID)
-		if comp == nil {
-			continue
+		if comp := e.graph.GetComponent(nodeID); comp != nil {
+			e.start(nodeID, comp)
 		}
+	}
 
-		mu.Lock()
-		startedComponents = append(startedComponents, comp)
-		mu.Unlock()
+	g, gctx := errgroup.WithContext(ctx)
+	if e.cfg.HTTPListenAddress != "" {
+		g.Go(func() error {
+			return e.serveHTTP(gctx)
+		})
+	}
 
+	if e.cfg.HealthHook != nil {
+		monitor := newHealthMonitor(e.graph, e.cfg.HealthHook, e.cfg.HealthCheckInterval, e.cfg.HealthDebounce)
 		g.Go(func() error {
-			slog.Debug("starting component", "id", comp.ID())
-			if err := comp.Run(ctx); err != nil {
-				return fmt.Errorf("component %s failed: %w", comp.ID(), err)
-			}
-			return nil
+			return monitor.Run(gctx)
 		})
 	}
 
 	// Wait for shutdown or error
-	if err := g.Wait(); err != nil {
-		slog.Error("engine error", "error", err)
-		return err
+	var runErr error
+	select {
+	case <-gctx.Done():
+	case runErr = <-errCh:
+	}
+	cancel()
+	e.stopAll()
+	if err := g.Wait(); err != nil && runErr == nil {
+		runErr = err
+	}
+	if runErr == nil {
+		select {
+		case runErr = <-errCh:
+		default:
+		}
+	}
+
+	if runErr != nil {
+		slog.Error("engine error", "error", runErr)
+		return runErr
 	}
 
 	slog.Info("flow engine stopped")
 	return nil
 }
 
+// start runs comp under supervision if the engine is running. A failure
+// that isn't the result of stopping the component stops the engine.
+func (e *Engine) start(id string, comp component.Component) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.runCtx == nil || e.runCtx.Err() != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(e.runCtx)
+	rc := &runningComponent{cancel: cancel, done: make(chan struct{})}
+	e.running[id] = rc
+	errCh := e.errCh
+
+	go func() {
+		defer close(rc.done)
+		slog.Debug("starting component", "id", id)
+		if err := e.supervise(ctx, comp); err != nil && !rc.stopped.Load() {
+			select {
+			case errCh <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// stop cancels a running component and waits for its Run to return
+func (e *Engine) stop(id string) {
+	e.mu.Lock()
+	rc, ok := e.running[id]
+	delete(e.running, id)
+	e.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	rc.stopped.Store(true)
+	rc.cancel()
+	<-rc.done
+}
+
+// stopAll waits for every component to return once the run context is
+// cancelled
+func (e *Engine) stopAll() {
+	e.mu.Lock()
+	running := e.running
+	e.running = make(map[string]*runningComponent)
+	e.runCtx = nil
+	e.mu.Unlock()
+
+	for _, rc := range running {
+		rc.cancel()
+		<-rc.done
+	}
+}
+
 // Graph represents the component dependency graph
 type Graph struct {
 	nodes      map[string]*Node
 	components map[string]component.Component
+	types      map[string]string
+	restarts   map[string]*restartState
 	mu         sync.RWMutex
 }
 
 type Node struct {
-	ID       string
+	ID        string
 	DependsOn []string
 }
 
@@ -100,6 +501,8 @@ func NewGraph() *Graph {
 	return &Graph{
 		nodes:      make(map[string]*Node),
 		components: make(map[string]component.Component),
+		types:      make(map[string]string),
+		restarts:   make(map[string]*restartState),
 	}
 }
 
@@ -107,7 +510,7 @@ func (g *Graph) AddNode(id string, dependsOn []string) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	g.nodes[id] = &Node{
-		ID:       id,
+		ID:        id,
 		DependsOn: dependsOn,
 	}
 }
@@ -118,18 +521,77 @@ func (g *Graph) AddComponent(id string, comp component.Component) {
 	g.components[id] = comp
 }
 
+func (g *Graph) setType(id, componentType string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.types[id] = componentType
+}
+
+// Type returns the component type of id
+func (g *Graph) Type(id string) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.types[id]
+}
+
+// replace swaps in the nodes and components of from, keeping the restart
+// history of components that carry over unchanged
+func (g *Graph) replace(from *Graph, created map[string]bool) {
+	from.mu.RLock()
+	defer from.mu.RUnlock()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nodes = from.nodes
+	g.components = from.components
+	g.types = from.types
+	for id := range g.restarts {
+		if _, kept := g.components[id]; !kept || created[id] {
+			delete(g.restarts, id)
+		}
+	}
+}
+
 func (g *Graph) GetComponent(id string) component.Component {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 	return g.components[id]
 }
 
+// Components returns the graph's components keyed by ID
+func (g *Graph) Components() map[string]component.Component {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	components := make(map[string]component.Component, len(g.components))
+	for id, comp := range g.components {
+		components[id] = comp
+	}
+	return components
+}
+
+// Dependencies returns the IDs of the components id depends on
+func (g *Graph) Dependencies(id string) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	node, ok := g.nodes[id]
+	if !ok {
+		return nil
+	}
+	return append([]string(nil), node.DependsOn...)
+}
+
+// TopologicalSort orders the graph so every component comes after its
+// dependencies. Node IDs and each node's dependencies are visited in
+// lexical order, so the result is stable for a given graph.
 func (g *Graph) TopologicalSort() ([]string, error) {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
 
 	// Simple topological sort using DFS
 	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
 	result := make([]string, 0, len(g.nodes))
 
 	var visit func(string) error
@@ -137,7 +599,14 @@ func (g *Graph) TopologicalSort() ([]string, error) {
 		if visited[id] {
 			return nil
 		}
-		visited[id] = true
+		if visiting[id] {
+			return fmt.Errorf("dependency cycle detected at component %s", id)
+		}
+		visiting[id] = true
+		defer func() {
+			visiting[id] = false
+			visited[id] = true
+		}()
 
 		node, ok := g.nodes[id]
 		if !ok {
@@ -145,7 +614,9 @@ func (g *Graph) TopologicalSort() ([]string, error) {
 		}
 
 		// Visit dependencies first
-		for _, dep := range node.DependsOn {
+		deps := append([]string(nil), node.DependsOn...)
+		sort.Strings(deps)
+		for _, dep := range deps {
 			if err := visit(dep); err != nil {
 				return err
 			}
@@ -155,7 +626,13 @@ func (g *Graph) TopologicalSort() ([]string, error) {
 		return nil
 	}
 
+	ids := make([]string, 0, len(g.nodes))
 	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
 		if err := visit(id); err != nil {
 			return nil, err
 		}
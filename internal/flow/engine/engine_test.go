@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func buildTestGraph() *Graph {
+	graph := NewGraph()
+	graph.AddNode("prometheus.scrape.web", []string{"prometheus.remote_write.default", "prometheus.relabel.web"})
+	graph.AddNode("prometheus.relabel.web", []string{"prometheus.remote_write.default"})
+	graph.AddNode("prometheus.remote_write.default", nil)
+	graph.AddNode("prometheus.receive.agents", []string{"prometheus.remote_write.default"})
+	graph.AddNode("prometheus.scrape.api", nil)
+	return graph
+}
+
+func TestTopologicalSort_Deterministic(t *testing.T) {
+	first, err := buildTestGraph().TopologicalSort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		order, err := buildTestGraph().TopologicalSort()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(order, first) {
+			t.Fatalf("order changed between runs: %v vs %v", first, order)
+		}
+	}
+
+	expected := []string{
+		"prometheus.remote_write.default",
+		"prometheus.receive.agents",
+		"prometheus.relabel.web",
+		"prometheus.scrape.api",
+		"prometheus.scrape.web",
+	}
+	if !reflect.DeepEqual(first, expected) {
+		t.Errorf("expected %v, got %v", expected, first)
+	}
+}
+
+func TestTopologicalSort_LexicalTieBreak(t *testing.T) {
+	graph := NewGraph()
+	for _, id := range []string{"c", "a", "d", "b"} {
+		graph.AddNode(id, nil)
+	}
+
+	order, err := graph.TopologicalSort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected %v, got %v", expected, order)
+	}
+}
+
+func TestTopologicalSort_Cycle(t *testing.T) {
+	graph := NewGraph()
+	graph.AddNode("a", []string{"b"})
+	graph.AddNode("b", []string{"a"})
+
+	if _, err := graph.TopologicalSort(); err == nil {
+		t.Error("expected cycle error")
+	}
+}
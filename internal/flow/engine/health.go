@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// HealthTransition describes a component settling into a new health status
+type HealthTransition struct {
+	Component string
+	From      component.Status
+	To        component.Status
+	Message   string
+	At        time.Time
+}
+
+// HealthHook is called for every debounced health transition
+type HealthHook func(HealthTransition)
+
+// healthMonitor polls component health and reports a transition only once
+// the new status has held for the debounce period, so a component flapping
+// between healthy and degraded doesn't page anyone
+type healthMonitor struct {
+	graph    *Graph
+	hook     HealthHook
+	interval time.Duration
+	debounce time.Duration
+
+	states map[string]*healthState
+}
+
+type healthState struct {
+	reported     component.Status
+	pending      component.Status
+	pendingSince time.Time
+}
+
+func newHealthMonitor(graph *Graph, hook HealthHook, interval, debounce time.Duration) *healthMonitor {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	if debounce < 0 {
+		debounce = 0
+	}
+	return &healthMonitor{
+		graph:    graph,
+		hook:     hook,
+		interval: interval,
+		debounce: debounce,
+		states:   make(map[string]*healthState),
+	}
+}
+
+func (m *healthMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			m.check(now)
+		}
+	}
+}
+
+// check samples every component once. Components start out healthy.
+func (m *healthMonitor) check(now time.Time) {
+	for id := range m.graph.Components() {
+		health := m.graph.Health(id)
+
+		state, ok := m.states[id]
+		if !ok {
+			state = &healthState{reported: component.StatusHealthy}
+			m.states[id] = state
+		}
+
+		if health.Status == state.reported {
+			state.pending = ""
+			continue
+		}
+		if health.Status != state.pending {
+			state.pending = health.Status
+			state.pendingSince = now
+		}
+		if now.Sub(state.pendingSince) < m.debounce {
+			continue
+		}
+
+		transition := HealthTransition{
+			Component: id,
+			From:      state.reported,
+			To:        health.Status,
+			Message:   health.Message,
+			At:        now,
+		}
+		state.reported = health.Status
+		state.pending = ""
+
+		slog.Info("component health changed",
+			"component", id,
+			"from", transition.From,
+			"to", transition.To,
+			"message", transition.Message)
+		m.hook(transition)
+	}
+}
+
+// NewWebhookHealthHook returns a hook that reports transitions to an
+// Alertmanager-style webhook such as the oncall /api/v1/alerts/prometheus
+// receiver. A component leaving healthy fires an alert and returning to
+// healthy resolves it. headers, such as Authorization for a receiver that
+// requires an API key, are set on every request.
+func NewWebhookHealthHook(url string, headers map[string]string) HealthHook {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return func(t HealthTransition) {
+		status := "firing"
+		if t.To == component.StatusHealthy {
+			status = "resolved"
+		}
+
+		alert := map[string]interface{}{
+			"status": status,
+			"labels": map[string]string{
+				"alertname": "FlowComponentUnhealthy",
+				"component": t.Component,
+				"severity":  "warning",
+			},
+			"annotations": map[string]string{
+				"summary":     fmt.Sprintf("Flow component %s is %s", t.Component, t.To),
+				"description": t.Message,
+			},
+		}
+		if status == "resolved" {
+			alert["endsAt"] = t.At
+		} else {
+			alert["startsAt"] = t.At
+		}
+
+		payload, err := json.Marshal(map[string]interface{}{
+			"status": status,
+			"alerts": []interface{}{alert},
+		})
+		if err != nil {
+			slog.Error("failed to encode health alert", "error", err)
+			return
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			slog.Error("failed to build health alert request", "error", err)
+			return
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			slog.Error("failed to send health alert",
+				"component", t.Component,
+				"error", err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			slog.Error("health alert rejected",
+				"component", t.Component,
+				"status", resp.StatusCode)
+		}
+	}
+}
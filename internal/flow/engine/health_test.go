@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+type fakeComponent struct {
+	id     string
+	mu     sync.Mutex
+	health component.Health
+}
+
+func (f *fakeComponent) ID() string                    { return f.id }
+func (f *fakeComponent) Run(ctx context.Context) error { <-ctx.Done(); return nil }
+
+func (f *fakeComponent) Health() component.Health {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.health
+}
+
+func (f *fakeComponent) setStatus(status component.Status) {
+	f.mu.Lock()
+	f.health = component.Health{Status: status, Message: string(status)}
+	f.mu.Unlock()
+}
+
+func TestHealthMonitor_Transitions(t *testing.T) {
+	comp := &fakeComponent{id: "prometheus.scrape.default"}
+	comp.setStatus(component.StatusHealthy)
+
+	graph := NewGraph()
+	graph.AddComponent(comp.ID(), comp)
+
+	var transitions []HealthTransition
+	monitor := newHealthMonitor(graph, func(t HealthTransition) {
+		transitions = append(transitions, t)
+	}, time.Second, 30*time.Second)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := func(status component.Status, d time.Duration) {
+		comp.setStatus(status)
+		now = now.Add(d)
+		monitor.check(now)
+	}
+
+	step(component.StatusHealthy, 0)
+	step(component.StatusUnhealthy, 10*time.Second)
+	step(component.StatusUnhealthy, 10*time.Second)
+	if len(transitions) != 0 {
+		t.Fatalf("expected no transition before debounce elapsed, got %v", transitions)
+	}
+
+	step(component.StatusUnhealthy, 25*time.Second)
+	step(component.StatusUnhealthy, 60*time.Second)
+	if len(transitions) != 1 {
+		t.Fatalf("expected exactly one transition to unhealthy, got %d", len(transitions))
+	}
+	if transitions[0].From != component.StatusHealthy || transitions[0].To != component.StatusUnhealthy {
+		t.Errorf("unexpected transition %+v", transitions[0])
+	}
+
+	step(component.StatusHealthy, 10*time.Second)
+	step(component.StatusHealthy, 30*time.Second)
+	if len(transitions) != 2 {
+		t.Fatalf("expected recovery to fire again, got %d transitions", len(transitions))
+	}
+	if transitions[1].To != component.StatusHealthy {
+		t.Errorf("expected recovery transition, got %+v", transitions[1])
+	}
+}
+
+func TestHealthMonitor_DebouncesFlapping(t *testing.T) {
+	comp := &fakeComponent{id: "prometheus.scrape.flappy"}
+	graph := NewGraph()
+	graph.AddComponent(comp.ID(), comp)
+
+	fired := 0
+	monitor := newHealthMonitor(graph, func(HealthTransition) { fired++ }, time.Second, 30*time.Second)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			comp.setStatus(component.StatusDegraded)
+		} else {
+			comp.setStatus(component.StatusHealthy)
+		}
+		now = now.Add(15 * time.Second)
+		monitor.check(now)
+	}
+
+	if fired != 0 {
+		t.Errorf("expected flapping to be debounced, hook fired %d times", fired)
+	}
+}
+
+func TestWebhookHealthHook(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	hook := NewWebhookHealthHook(srv.URL, map[string]string{"Authorization": "Bearer secret"})
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hook(HealthTransition{Component: "prometheus.scrape.default", From: component.StatusHealthy, To: component.StatusUnhealthy, At: at})
+	hook(HealthTransition{Component: "prometheus.scrape.default", From: component.StatusUnhealthy, To: component.StatusHealthy, At: at})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("expected 2 webhook calls, got %d", len(received))
+	}
+	if received[0]["status"] != "firing" || received[1]["status"] != "resolved" {
+		t.Errorf("expected firing then resolved, got %v and %v", received[0]["status"], received[1]["status"])
+	}
+
+	alert := received[0]["alerts"].([]interface{})[0].(map[string]interface{})
+	labels := alert["labels"].(map[string]interface{})
+	if labels["component"] != "prometheus.scrape.default" {
+		t.Errorf("expected component label, got %v", labels)
+	}
+}
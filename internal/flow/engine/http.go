@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// ComponentStatus is a component's entry in the /components response
+type ComponentStatus struct {
+	ID     string       `json:"id"`
+	Type   string       `json:"type"`
+	Health HealthStatus `json:"health"`
+}
+
+// HealthStatus is the JSON form of component.Health
+type HealthStatus struct {
+	Status  component.Status `json:"status"`
+	Message string           `json:"message"`
+}
+
+// Handler serves the engine's status endpoints:
+//
+//	GET /-/healthy   200 unless a component is unhealthy, then 503
+//	GET /components  every component's ID, type and health
+//	GET /metrics     the components' metrics in Prometheus format
+func (e *Engine) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/-/healthy", e.handleHealthy)
+	mux.HandleFunc("/components", e.handleComponents)
+	mux.Handle("/metrics", promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+func (e *Engine) serveHTTP(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              e.cfg.HTTPListenAddress,
+		Handler:           e.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		slog.Info("starting flow status server", "address", e.cfg.HTTPListenAddress)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		return fmt.Errorf("status server: %w", err)
+	}
+}
+
+// componentStatuses returns the status of every component ordered by ID
+func (e *Engine) componentStatuses() []ComponentStatus {
+	components := e.graph.Components()
+	statuses := make([]ComponentStatus, 0, len(components))
+	for id := range components {
+		health := e.graph.Health(id)
+		statuses = append(statuses, ComponentStatus{
+			ID:     id,
+			Type:   e.graph.Type(id),
+			Health: HealthStatus{Status: health.Status, Message: health.Message},
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].ID < statuses[j].ID })
+	return statuses
+}
+
+func (e *Engine) handleHealthy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var unhealthy []string
+	for _, status := range e.componentStatuses() {
+		if status.Health.Status == component.StatusUnhealthy {
+			unhealthy = append(unhealthy, status.ID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(unhealthy) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "unhealthy components: %s\n", strings.Join(unhealthy, ", "))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (e *Engine) handleComponents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"components": e.componentStatuses(),
+	})
+}
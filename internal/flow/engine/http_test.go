@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+func newStatusEngine(statuses map[string]component.Status) *Engine {
+	eng := &Engine{cfg: &Config{}, graph: NewGraph(), registry: prometheus.NewRegistry()}
+	for id, status := range statuses {
+		comp := &fakeComponent{id: id}
+		comp.setStatus(status)
+		eng.graph.AddNode(id, nil)
+		eng.graph.AddComponent(id, comp)
+		eng.graph.setType(id, id[:strings.LastIndex(id, ".")])
+	}
+	return eng
+}
+
+func getStatus(eng *Engine, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	eng.Handler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec
+}
+
+func TestHandler_Healthy(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses map[string]component.Status
+		want     int
+	}{
+		{
+			name: "all healthy",
+			statuses: map[string]component.Status{
+				"prometheus.scrape.default":       component.StatusHealthy,
+				"prometheus.remote_write.default": component.StatusHealthy,
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "degraded is still healthy",
+			statuses: map[string]component.Status{
+				"prometheus.scrape.default":       component.StatusDegraded,
+				"prometheus.remote_write.default": component.StatusHealthy,
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "one unhealthy",
+			statuses: map[string]component.Status{
+				"prometheus.scrape.default":       component.StatusHealthy,
+				"prometheus.remote_write.default": component.StatusUnhealthy,
+			},
+			want: http.StatusServiceUnavailable,
+		},
+		{
+			name: "no components",
+			want: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getStatus(newStatusEngine(tt.statuses), "/-/healthy")
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+			if tt.want == http.StatusServiceUnavailable && !strings.Contains(rec.Body.String(), "prometheus.remote_write.default") {
+				t.Errorf("expected unhealthy component in body, got %q", rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandler_Components(t *testing.T) {
+	eng := newStatusEngine(map[string]component.Status{
+		"prometheus.scrape.default":       component.StatusDegraded,
+		"prometheus.remote_write.default": component.StatusHealthy,
+		"loki.source.file.app":            component.StatusUnhealthy,
+	})
+
+	rec := getStatus(eng, "/components")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+
+	var body struct {
+		Components []ComponentStatus `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	want := []ComponentStatus{
+		{ID: "loki.source.file.app", Type: "loki.source.file", Health: HealthStatus{Status: component.StatusUnhealthy, Message: "unhealthy"}},
+		{ID: "prometheus.remote_write.default", Type: "prometheus.remote_write", Health: HealthStatus{Status: component.StatusHealthy, Message: "healthy"}},
+		{ID: "prometheus.scrape.default", Type: "prometheus.scrape", Health: HealthStatus{Status: component.StatusDegraded, Message: "degraded"}},
+	}
+	if !reflect.DeepEqual(body.Components, want) {
+		t.Errorf("expected %+v, got %+v", want, body.Components)
+	}
+}
+
+func TestHandler_MethodNotAllowed(t *testing.T) {
+	eng := newStatusEngine(nil)
+	for _, path := range []string{"/-/healthy", "/components"} {
+		rec := httptest.NewRecorder()
+		eng.Handler().ServeHTTP(rec, httptest.NewRequest("POST", path, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s: expected 405, got %d", path, rec.Code)
+		}
+	}
+}
+
+// meteredComponent exposes a counter that every instance names the same
+type meteredComponent struct {
+	fakeComponent
+	events prometheus.Counter
+}
+
+func (m *meteredComponent) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.events}
+}
+
+func TestHandler_Metrics(t *testing.T) {
+	registry := component.NewRegistry()
+	registry.Register("test.metered", func(cfg component.Config) (component.Component, error) {
+		return &meteredComponent{
+			fakeComponent: fakeComponent{id: cfg.ID()},
+			events: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "test_events_total",
+				Help: "Events seen",
+			}),
+		}, nil
+	})
+
+	eng, err := New(&Config{
+		Registry: registry,
+		Components: []component.Config{
+			{Type: "test.metered", Name: "a"},
+			{Type: "test.metered", Name: "b"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("registering the same metric for two instances must not fail: %v", err)
+	}
+	eng.Graph().GetComponent("test.metered.b").(*meteredComponent).events.Add(3)
+
+	rec := getStatus(eng, "/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	for _, line := range []string{
+		`test_events_total{instance="test.metered.a"} 0`,
+		`test_events_total{instance="test.metered.b"} 3`,
+	} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("expected %q in metrics output:\n%s", line, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Reload applies the components of cfg to the engine. Components whose
+// config and referenced exports are unchanged keep running, changed
+// components that implement component.Reconfigurable are updated in place,
+// and the rest are stopped and replaced by new instances. A config that
+// fails to build is rejected and leaves the running components untouched.
+// Settings other than the components keep their startup values.
+func (e *Engine) Reload(cfg *Config) error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	plan, err := e.build(cfg.Components)
+	if err != nil {
+		return fmt.Errorf("failed to build component graph: %w", err)
+	}
+
+	var removed int
+	for id := range e.configs {
+		if _, kept := plan.configs[id]; !kept {
+			removed++
+		}
+	}
+
+	err = e.apply(plan)
+	e.cfg.Components = cfg.Components
+
+	slog.Info("reloaded flow config",
+		"components", len(plan.order),
+		"created", len(plan.created),
+		"reconfigured", len(plan.reconfigure),
+		"removed", removed)
+	return err
+}
@@ -0,0 +1,276 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// reloadComponent records its lifecycle. Instances of test.sink export a
+// receiver unique to the instance.
+type reloadComponent struct {
+	id       string
+	receiver chan struct{}
+
+	mu           sync.Mutex
+	config       map[string]interface{}
+	running      bool
+	runs         int
+	reconfigured int
+}
+
+func (c *reloadComponent) ID() string { return c.id }
+
+func (c *reloadComponent) Run(ctx context.Context) error {
+	c.mu.Lock()
+	c.running = true
+	c.runs++
+	c.mu.Unlock()
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	c.running = false
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *reloadComponent) Health() component.Health {
+	return component.Health{Status: component.StatusHealthy}
+}
+
+func (c *reloadComponent) isRunning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+func (c *reloadComponent) runCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.runs
+}
+
+type sinkComponent struct{ *reloadComponent }
+
+func (s sinkComponent) Exports() map[string]interface{} {
+	return map[string]interface{}{"receiver": s.receiver}
+}
+
+type tunableComponent struct{ *reloadComponent }
+
+func (t tunableComponent) Reconfigure(cfg component.Config) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.config = cfg.Config
+	t.reconfigured++
+	return nil
+}
+
+func reloadRegistry() *component.Registry {
+	registry := component.NewRegistry()
+	newComponent := func(cfg component.Config) *reloadComponent {
+		return &reloadComponent{id: cfg.ID(), config: cfg.Config, receiver: make(chan struct{})}
+	}
+	registry.Register("test.sink", func(cfg component.Config) (component.Component, error) {
+		return sinkComponent{newComponent(cfg)}, nil
+	})
+	registry.Register("test.source", func(cfg component.Config) (component.Component, error) {
+		return newComponent(cfg), nil
+	})
+	registry.Register("test.tunable", func(cfg component.Config) (component.Component, error) {
+		if cfg.Config["invalid"] != nil {
+			return nil, errors.New("invalid setting")
+		}
+		return tunableComponent{newComponent(cfg)}, nil
+	})
+	return registry
+}
+
+func sinkConfig(name, setting string) component.Config {
+	return component.Config{Type: "test.sink", Name: name, Config: map[string]interface{}{"setting": setting}}
+}
+
+func sourceConfig(name, sink string) component.Config {
+	return component.Config{Type: "test.source", Name: name, Config: map[string]interface{}{
+		"forward_to": []interface{}{component.Reference{Component: "test.sink." + sink, Export: "receiver"}},
+	}}
+}
+
+func tunableConfig(name, setting string) component.Config {
+	return component.Config{Type: "test.tunable", Name: name, Config: map[string]interface{}{"setting": setting}}
+}
+
+// startReloadEngine runs an engine with components until the test ends
+func startReloadEngine(t *testing.T, components ...component.Config) *Engine {
+	t.Helper()
+	eng, err := New(&Config{Registry: reloadRegistry(), Components: components})
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- eng.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("engine error: %v", err)
+		}
+	})
+
+	for _, cfg := range components {
+		waitRunning(t, eng, cfg.ID())
+	}
+	return eng
+}
+
+// lifecycle returns the recorder behind a component in the graph
+func lifecycle(eng *Engine, id string) *reloadComponent {
+	switch c := eng.Graph().GetComponent(id).(type) {
+	case sinkComponent:
+		return c.reloadComponent
+	case tunableComponent:
+		return c.reloadComponent
+	case *reloadComponent:
+		return c
+	}
+	return nil
+}
+
+func waitRunning(t *testing.T, eng *Engine, id string) *reloadComponent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if c := lifecycle(eng, id); c != nil && c.isRunning() {
+			return c
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("component %s is not running", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEngine_ReloadKeepsUnchangedComponents(t *testing.T) {
+	eng := startReloadEngine(t, sinkConfig("out", "a"), sourceConfig("in", "out"))
+	sink := lifecycle(eng, "test.sink.out")
+	source := lifecycle(eng, "test.source.in")
+
+	err := eng.Reload(&Config{Components: []component.Config{
+		sinkConfig("out", "a"), sourceConfig("in", "out"), sourceConfig("extra", "out"),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waitRunning(t, eng, "test.source.extra")
+	if lifecycle(eng, "test.sink.out") != sink || lifecycle(eng, "test.source.in") != source {
+		t.Fatal("expected unchanged components to be kept")
+	}
+	if !sink.isRunning() || !source.isRunning() || sink.runCount() != 1 || source.runCount() != 1 {
+		t.Errorf("expected unchanged components to keep running without a restart")
+	}
+}
+
+func TestEngine_ReloadRecreatesChangedComponents(t *testing.T) {
+	eng := startReloadEngine(t, sinkConfig("out", "a"), sourceConfig("in", "out"), sinkConfig("other", "a"))
+	oldSink := lifecycle(eng, "test.sink.out")
+	oldSource := lifecycle(eng, "test.source.in")
+	other := lifecycle(eng, "test.sink.other")
+
+	// The source's config is unchanged, but the sink it references is
+	// replaced, so it must be recreated to pick up the new receiver
+	err := eng.Reload(&Config{Components: []component.Config{
+		sinkConfig("out", "b"), sourceConfig("in", "out"), sinkConfig("other", "a"),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newSink := waitRunning(t, eng, "test.sink.out")
+	newSource := waitRunning(t, eng, "test.source.in")
+	if newSink == oldSink || newSource == oldSource {
+		t.Fatal("expected changed components to be replaced")
+	}
+	if oldSink.isRunning() || oldSource.isRunning() {
+		t.Error("expected replaced components to be stopped")
+	}
+	if lifecycle(eng, "test.sink.other") != other || !other.isRunning() {
+		t.Error("expected the unrelated component to keep running")
+	}
+	refs, _ := newSource.config["forward_to"].([]interface{})
+	if len(refs) != 1 || refs[0] != newSink.receiver {
+		t.Errorf("expected the source to reference the new sink's receiver")
+	}
+}
+
+func TestEngine_ReloadReconfiguresInPlace(t *testing.T) {
+	eng := startReloadEngine(t, tunableConfig("t", "a"))
+	tunable := lifecycle(eng, "test.tunable.t")
+
+	if err := eng.Reload(&Config{Components: []component.Config{tunableConfig("t", "b")}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if lifecycle(eng, "test.tunable.t") != tunable {
+		t.Fatal("expected the reconfigurable component to be kept")
+	}
+	tunable.mu.Lock()
+	defer tunable.mu.Unlock()
+	if tunable.reconfigured != 1 || tunable.config["setting"] != "b" || tunable.runs != 1 || !tunable.running {
+		t.Errorf("expected an in-place update without a restart, got reconfigured=%d config=%v runs=%d",
+			tunable.reconfigured, tunable.config, tunable.runs)
+	}
+}
+
+func TestEngine_ReloadRemovesComponents(t *testing.T) {
+	eng := startReloadEngine(t, sinkConfig("out", "a"), sourceConfig("in", "out"))
+	source := lifecycle(eng, "test.source.in")
+
+	if err := eng.Reload(&Config{Components: []component.Config{sinkConfig("out", "a")}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if source.isRunning() {
+		t.Error("expected the removed component to be stopped")
+	}
+	if eng.Graph().GetComponent("test.source.in") != nil {
+		t.Error("expected the removed component to leave the graph")
+	}
+}
+
+func TestEngine_ReloadRejectsInvalidConfig(t *testing.T) {
+	eng := startReloadEngine(t, sinkConfig("out", "a"), tunableConfig("t", "a"))
+	sink := lifecycle(eng, "test.sink.out")
+	tunable := lifecycle(eng, "test.tunable.t")
+
+	invalid := map[string][]component.Config{
+		"unknown type":         {{Type: "test.missing", Name: "x"}},
+		"undefined reference":  {sinkConfig("out", "b"), sourceConfig("in", "nowhere")},
+		"invalid reconfigure":  {sinkConfig("out", "b"), {Type: "test.tunable", Name: "t", Config: map[string]interface{}{"invalid": true}}},
+		"duplicate components": {sinkConfig("out", "b"), sinkConfig("out", "c")},
+	}
+	for name, components := range invalid {
+		if err := eng.Reload(&Config{Components: components}); err == nil {
+			t.Errorf("%s: expected reload to be rejected", name)
+		}
+	}
+
+	if lifecycle(eng, "test.sink.out") != sink || !sink.isRunning() || sink.runCount() != 1 {
+		t.Error("expected the running sink to be untouched")
+	}
+	tunable.mu.Lock()
+	defer tunable.mu.Unlock()
+	if tunable.reconfigured != 0 || tunable.config["setting"] != "a" {
+		t.Error("expected the running tunable component to be untouched")
+	}
+	if !strings.Contains(eng.Graph().Type("test.sink.out"), "test.sink") {
+		t.Error("expected the graph to keep the running config")
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+const (
+	defaultRestartBackoff    = time.Second
+	defaultMaxRestartBackoff = time.Minute
+)
+
+// restartState records a supervised component's restarts. err is the
+// failure it is waiting to be restarted after, if any.
+type restartState struct {
+	count int
+	err   error
+}
+
+// supervise runs comp, restarting it with capped exponential backoff
+// while it fails and has restarts left. The returned error stops the
+// engine.
+func (e *Engine) supervise(ctx context.Context, comp component.Component) error {
+	backoff := e.cfg.RestartBackoff
+	if backoff <= 0 {
+		backoff = defaultRestartBackoff
+	}
+	maxBackoff := e.cfg.MaxRestartBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxRestartBackoff
+	}
+
+	for restarts := 0; ; restarts++ {
+		err := comp.Run(ctx)
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("component %s failed: %w", comp.ID(), err)
+
+		if ctx.Err() != nil || restarts >= e.cfg.MaxRestarts {
+			return err
+		}
+		if fatal, ok := comp.(component.Fatal); ok && fatal.FailureIsFatal() {
+			return err
+		}
+
+		slog.Warn("restarting failed component",
+			"id", comp.ID(),
+			"restart", restarts+1,
+			"max_restarts", e.cfg.MaxRestarts,
+			"backoff", backoff,
+			"error", err)
+		e.graph.setFailure(comp.ID(), err)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+		e.graph.recordRestart(comp.ID())
+	}
+}
+
+func (g *Graph) setFailure(id string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state, ok := g.restarts[id]
+	if !ok {
+		state = &restartState{}
+		g.restarts[id] = state
+	}
+	state.err = err
+}
+
+func (g *Graph) recordRestart(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	state := g.restarts[id]
+	state.count++
+	state.err = nil
+}
+
+// Restarts returns how many times the component has been restarted
+func (g *Graph) Restarts(id string) int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if state, ok := g.restarts[id]; ok {
+		return state.count
+	}
+	return 0
+}
+
+// Health returns the component's health, accounting for supervision: a
+// component waiting to be restarted is unhealthy, and a restarted one
+// reports its restart count in the message
+func (g *Graph) Health(id string) component.Health {
+	comp := g.GetComponent(id)
+	if comp == nil {
+		return component.Health{Status: component.StatusUnhealthy, Message: "unknown component"}
+	}
+	health := comp.Health()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	state, ok := g.restarts[id]
+	if !ok {
+		return health
+	}
+	if state.err != nil {
+		health = component.Health{
+			Status:  component.StatusUnhealthy,
+			Message: fmt.Sprintf("waiting to restart: %s", state.err),
+		}
+	}
+	if state.count > 0 {
+		health.Message = fmt.Sprintf("%s (restarted %d times)", health.Message, state.count)
+	}
+	return health
+}
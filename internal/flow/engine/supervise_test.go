@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/flow/component"
+)
+
+// flakyComponent fails its first failures runs, then runs until cancelled
+type flakyComponent struct {
+	id       string
+	failures int
+	fatal    bool
+
+	mu   sync.Mutex
+	runs int
+}
+
+func (f *flakyComponent) ID() string { return f.id }
+
+func (f *flakyComponent) Run(ctx context.Context) error {
+	f.mu.Lock()
+	f.runs++
+	run := f.runs
+	f.mu.Unlock()
+
+	if run <= f.failures {
+		return errors.New("connection refused")
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (f *flakyComponent) Health() component.Health {
+	return component.Health{Status: component.StatusHealthy, Message: "running"}
+}
+
+func (f *flakyComponent) FailureIsFatal() bool { return f.fatal }
+
+func (f *flakyComponent) runCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.runs
+}
+
+func newSupervisedEngine(comp component.Component, maxRestarts int) *Engine {
+	graph := NewGraph()
+	graph.AddNode(comp.ID(), nil)
+	graph.AddComponent(comp.ID(), comp)
+	return &Engine{
+		cfg: &Config{
+			MaxRestarts:       maxRestarts,
+			RestartBackoff:    time.Millisecond,
+			MaxRestartBackoff: 5 * time.Millisecond,
+		},
+		graph:   graph,
+		running: make(map[string]*runningComponent),
+	}
+}
+
+func TestEngine_RestartsFailedComponent(t *testing.T) {
+	comp := &flakyComponent{id: "loki.write.default", failures: 2}
+	eng := newSupervisedEngine(comp, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- eng.Run(ctx) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for comp.runCount() < 3 || eng.Graph().Restarts(comp.ID()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 runs, got %d", comp.runCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("engine stopped after restarts: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	health := eng.Graph().Health(comp.ID())
+	if health.Status != component.StatusHealthy || health.Message != "running (restarted 2 times)" {
+		t.Errorf("expected restart count in health, got %+v", health)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEngine_StopsAfterMaxRestarts(t *testing.T) {
+	comp := &flakyComponent{id: "loki.write.default", failures: 10}
+	eng := newSupervisedEngine(comp, 2)
+
+	err := eng.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "component loki.write.default failed") {
+		t.Fatalf("expected component failure, got %v", err)
+	}
+	if comp.runCount() != 3 {
+		t.Errorf("expected the first run and 2 restarts, got %d runs", comp.runCount())
+	}
+}
+
+func TestEngine_FatalComponentNotRestarted(t *testing.T) {
+	comp := &flakyComponent{id: "prometheus.receive.agents", failures: 1, fatal: true}
+	eng := newSupervisedEngine(comp, 5)
+
+	if err := eng.Run(context.Background()); err == nil {
+		t.Fatal("expected fatal component failure to stop the engine")
+	}
+	if comp.runCount() != 1 {
+		t.Errorf("expected no restarts, got %d runs", comp.runCount())
+	}
+}
+
+func TestEngine_NoSupervisionByDefault(t *testing.T) {
+	comp := &flakyComponent{id: "prometheus.scrape.default", failures: 1}
+	eng := newSupervisedEngine(comp, 0)
+
+	if err := eng.Run(context.Background()); err == nil {
+		t.Fatal("expected the first failure to stop the engine")
+	}
+	if comp.runCount() != 1 {
+		t.Errorf("expected no restarts, got %d runs", comp.runCount())
+	}
+}
+
+func TestGraph_HealthWhileWaitingToRestart(t *testing.T) {
+	comp := &flakyComponent{id: "loki.write.default"}
+	graph := NewGraph()
+	graph.AddComponent(comp.ID(), comp)
+
+	graph.setFailure(comp.ID(), errors.New("component loki.write.default failed: boom"))
+	health := graph.Health(comp.ID())
+	if health.Status != component.StatusUnhealthy || !strings.Contains(health.Message, "waiting to restart") {
+		t.Errorf("expected unhealthy while waiting, got %+v", health)
+	}
+
+	graph.recordRestart(comp.ID())
+	if health := graph.Health(comp.ID()); health.Status != component.StatusHealthy {
+		t.Errorf("expected component health after restart, got %+v", health)
+	}
+}
@@ -0,0 +1,65 @@
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vjranagit/grafana/internal/flow/config"
+)
+
+func newFmtCommand() *cobra.Command {
+	var configFile string
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "fmt",
+		Short: "Rewrite a flow config in canonical format",
+		Long: `Parse the flow configuration and rewrite it in canonical HCL format.
+With --check the file is left untouched and the command fails if it
+isn't already formatted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return formatFile(configFile, check, cmd.OutOrStdout())
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "flow.hcl",
+		"Configuration file path")
+	cmd.Flags().BoolVar(&check, "check", false,
+		"Fail if the file is not formatted instead of rewriting it")
+
+	return cmd
+}
+
+// formatFile formats the config at path in place, or with check only
+// reports whether it would change
+func formatFile(path string, check bool, out io.Writer) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := config.Format(src, path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(src, formatted) {
+		return nil
+	}
+
+	if check {
+		return fmt.Errorf("%s is not formatted, run grafana-ops flow fmt -c %s", path, path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, formatted, info.Mode().Perm()); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, path)
+	return nil
+}
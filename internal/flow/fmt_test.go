@@ -0,0 +1,88 @@
+package flow
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const unformattedConfig = `flow {
+log_level="debug"
+}
+
+prometheus_scrape "default" {
+    targets = ["localhost:9090"]
+  scrape_interval   =   "15s"
+  forward_to = [prometheus.remote_write.default.receiver]
+}
+`
+
+func writeConfig(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "flow.hcl")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFormatFile_Idempotent(t *testing.T) {
+	path := writeConfig(t, unformattedConfig)
+
+	var out bytes.Buffer
+	if err := formatFile(path, false, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != path {
+		t.Errorf("expected rewritten file to be reported, got %q", out.String())
+	}
+
+	first, _ := os.ReadFile(path)
+	if !strings.Contains(string(first), "  log_level = \"debug\"") {
+		t.Errorf("expected indented attribute, got:\n%s", first)
+	}
+	if !strings.Contains(string(first), "  targets         = [\"localhost:9090\"]") {
+		t.Errorf("expected aligned attributes, got:\n%s", first)
+	}
+
+	out.Reset()
+	if err := formatFile(path, false, &out); err != nil {
+		t.Fatalf("unexpected error on second run: %v", err)
+	}
+	second, _ := os.ReadFile(path)
+	if !bytes.Equal(first, second) {
+		t.Errorf("formatting is not idempotent:\n%s\nvs\n%s", first, second)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output for an already formatted file, got %q", out.String())
+	}
+}
+
+func TestFormatFile_Check(t *testing.T) {
+	path := writeConfig(t, unformattedConfig)
+
+	if err := formatFile(path, true, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected --check to fail on unformatted input")
+	}
+	src, _ := os.ReadFile(path)
+	if string(src) != unformattedConfig {
+		t.Error("expected --check to leave the file untouched")
+	}
+
+	if err := formatFile(path, false, &bytes.Buffer{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := formatFile(path, true, &bytes.Buffer{}); err != nil {
+		t.Errorf("expected --check to pass after formatting, got %v", err)
+	}
+}
+
+func TestFormatFile_SyntaxError(t *testing.T) {
+	path := writeConfig(t, "prometheus_scrape \"default\" {\n  targets = [\n")
+
+	if err := formatFile(path, false, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected syntax error")
+	}
+}
@@ -0,0 +1,77 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/spf13/cobra"
+	"github.com/vjranagit/grafana/internal/flow/component"
+	"github.com/vjranagit/grafana/internal/flow/config"
+	"github.com/vjranagit/grafana/internal/flow/engine"
+)
+
+// errInvalidConfig is returned by config validate after the problems it
+// found have been printed
+var errInvalidConfig = errors.New("config is invalid")
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with flow config files",
+	}
+	cmd.AddCommand(newValidateCommand())
+	return cmd
+}
+
+func newValidateCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check a flow config without starting the agent",
+		Long: `Parse the flow config, instantiate its components without running them
+and check the component graph for undefined references and cycles. Prints
+OK or the problems found, and exits non-zero if there are any.`,
+		// The problems are printed above and main reports the error
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateConfig(cmd.OutOrStdout(), configFile, component.DefaultRegistry)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "flow.hcl",
+		"Configuration file path")
+
+	return cmd
+}
+
+// validateConfig checks the config at path against registry and prints the
+// result to out
+func validateConfig(out io.Writer, path string, registry *component.Registry) error {
+	err := checkConfig(path, registry)
+	if err == nil {
+		fmt.Fprintln(out, "OK")
+		return nil
+	}
+	var diags hcl.Diagnostics
+	if errors.As(err, &diags) {
+		// Syntax errors come as diagnostics, each with its file and line
+		for _, diag := range diags {
+			fmt.Fprintln(out, diag.Error())
+		}
+	} else {
+		fmt.Fprintln(out, err)
+	}
+	return errInvalidConfig
+}
+
+func checkConfig(path string, registry *component.Registry) error {
+	cfg, err := config.Load(path, registry)
+	if err != nil {
+		return err
+	}
+	return engine.Validate(cfg)
+}
@@ -0,0 +1,100 @@
+package flow
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig_OK(t *testing.T) {
+	path := writeConfig(t, `
+test_source "default" {
+  forward_to = [test.sink.default.receiver]
+}
+
+test_sink "default" {}
+`)
+	var out bytes.Buffer
+	if err := validateConfig(&out, path, stubRegistry()); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out.String())
+	}
+	if out.String() != "OK\n" {
+		t.Errorf("expected OK, got %q", out.String())
+	}
+}
+
+func TestValidateConfig_UnknownComponentType(t *testing.T) {
+	path := writeConfig(t, `
+test_sink "default" {}
+
+test_unknown "x" {}
+`)
+	var out bytes.Buffer
+	if err := validateConfig(&out, path, stubRegistry()); !errors.Is(err, errInvalidConfig) {
+		t.Fatalf("expected errInvalidConfig, got %v", err)
+	}
+	if !strings.Contains(out.String(), path+":4,") || !strings.Contains(out.String(), `unknown component type "test_unknown"`) {
+		t.Errorf("expected the unknown type reported with its line, got %q", out.String())
+	}
+}
+
+func TestValidateConfig_Cycle(t *testing.T) {
+	path := writeConfig(t, `
+test_source "default" {
+  forward_to = [test.sink.default.receiver]
+}
+
+test_sink "default" {
+  forward_to = [test.source.default.receiver]
+}
+`)
+	var out bytes.Buffer
+	if err := validateConfig(&out, path, stubRegistry()); err == nil {
+		t.Fatal("expected the cycle to be reported")
+	}
+	if !strings.Contains(out.String(), "cycle") {
+		t.Errorf("expected a cycle error, got %q", out.String())
+	}
+}
+
+func TestValidateConfig_SyntaxError(t *testing.T) {
+	path := writeConfig(t, "test_sink \"default\" {\n  x =\n}\n")
+	var out bytes.Buffer
+	if err := validateConfig(&out, path, stubRegistry()); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if !strings.HasPrefix(out.String(), path+":2,") {
+		t.Errorf("expected the problem to point at line 2, got %q", out.String())
+	}
+}
+
+func TestValidateCommand_Example(t *testing.T) {
+	var out, errOut bytes.Buffer
+	cmd := newValidateCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetArgs([]string{"-c", filepath.Join("..", "..", "examples", "flow.hcl")})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected the example config to validate, got %v:\n%s", err, out.String())
+	}
+	if out.String() != "OK\n" {
+		t.Errorf("expected OK, got %q", out.String())
+	}
+}
+
+func TestValidateCommand_PrintsProblemsOnce(t *testing.T) {
+	path := writeConfig(t, `test_unknown "x" {}`)
+	var out, errOut bytes.Buffer
+	cmd := newValidateCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetArgs([]string{"-c", path})
+	if err := cmd.Execute(); !errors.Is(err, errInvalidConfig) {
+		t.Fatalf("expected errInvalidConfig, got %v", err)
+	}
+	if strings.Count(out.String(), "unknown component type") != 1 || errOut.Len() != 0 {
+		t.Errorf("expected the problem once and nothing else, got %q and %q", out.String(), errOut.String())
+	}
+}
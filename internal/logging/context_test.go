@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewContextHandler(NewRedactingHandler(slog.NewJSONHandler(&buf, nil), DefaultSensitiveKeys)))
+
+	ctx := WithAttrs(context.Background(), slog.String("request_id", "req-1"), slog.String("recipient", "secret"))
+	ctx = WithAttrs(ctx, slog.String("fingerprint", "fp1"))
+	logger.InfoContext(ctx, "alert stored", "status", "firing")
+
+	record := decodeRecord(t, &buf)
+	if record["request_id"] != "req-1" || record["fingerprint"] != "fp1" || record["status"] != "firing" {
+		t.Errorf("expected the context's attrs alongside the record's, got %v", record)
+	}
+	if record["recipient"] != RedactedValue {
+		t.Errorf("expected context attrs to be redacted too, got %v", record["recipient"])
+	}
+
+	// Later attrs replace earlier ones of the same key, and the record's
+	// own win over the context's
+	buf.Reset()
+	ctx = WithAttrs(ctx, slog.String("fingerprint", "fp2"))
+	logger.InfoContext(ctx, "alert stored", "request_id", "explicit")
+	record = decodeRecord(t, &buf)
+	if record["fingerprint"] != "fp2" || record["request_id"] != "explicit" {
+		t.Errorf("unexpected attrs %v", record)
+	}
+	if n := len(Attrs(ctx)); n != 3 {
+		t.Errorf("expected 3 context attrs, got %d", n)
+	}
+
+	buf.Reset()
+	logger.Info("no context")
+	if record := decodeRecord(t, &buf); record["request_id"] != nil {
+		t.Errorf("expected no context attrs without a context, got %v", record)
+	}
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(NewRedactingHandler(slog.NewJSONHandler(buf, nil), DefaultSensitiveKeys))
+}
+
+func decodeRecord(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to decode log record %q: %v", buf.String(), err)
+	}
+	return record
+}
+
+func TestRedactingHandler_RecordAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf)
+
+	logger.Info("webhook notification sent successfully",
+		"recipient", "https://hooks.example.com/secret-token",
+		"Authorization", "Bearer abc123",
+		"alert", "fp1")
+
+	record := decodeRecord(t, &buf)
+	if record["recipient"] != RedactedValue {
+		t.Errorf("expected recipient to be redacted, got %v", record["recipient"])
+	}
+	if record["Authorization"] != RedactedValue {
+		t.Errorf("expected Authorization to be redacted, got %v", record["Authorization"])
+	}
+	if record["alert"] != "fp1" {
+		t.Errorf("expected non-sensitive attr to be kept, got %v", record["alert"])
+	}
+	if strings.Contains(buf.String(), "secret-token") {
+		t.Errorf("secret leaked into log output: %s", buf.String())
+	}
+}
+
+func TestRedactingHandler_WithAttrsAndGroups(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf).With("webhook_url", "https://hooks.example.com/T0/B0/xyz")
+
+	logger.Info("sending",
+		slog.Group("request",
+			slog.String("authorization", "Basic dXNlcjpwYXNz"),
+			slog.String("method", "POST")))
+
+	record := decodeRecord(t, &buf)
+	if record["webhook_url"] != RedactedValue {
+		t.Errorf("expected webhook_url from With to be redacted, got %v", record["webhook_url"])
+	}
+
+	request, ok := record["request"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected request group, got %v", record["request"])
+	}
+	if request["authorization"] != RedactedValue {
+		t.Errorf("expected nested authorization to be redacted, got %v", request["authorization"])
+	}
+	if request["method"] != "POST" {
+		t.Errorf("expected nested method to be kept, got %v", request["method"])
+	}
+}
+
+func TestRedactingHandler_WithGroup(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf).WithGroup("notifier")
+
+	logger.Info("sent", "recipient", "alice@example.com", "channel", "email")
+
+	record := decodeRecord(t, &buf)
+	group, ok := record["notifier"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected notifier group, got %v", record)
+	}
+	if group["recipient"] != RedactedValue {
+		t.Errorf("expected recipient to be redacted, got %v", group["recipient"])
+	}
+	if group["channel"] != "email" {
+		t.Errorf("expected channel to be kept, got %v", group["channel"])
+	}
+}
@@ -1,27 +1,44 @@
 package api
 
 import (
+	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
+	"net/url"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/vjranagit/grafana/internal/logging"
 	"github.com/vjranagit/grafana/internal/oncall/models"
 	"github.com/vjranagit/grafana/internal/oncall/store"
 )
 
 // PrometheusWebhook represents the AlertManager webhook format
+// (version 4). The group's common labels and annotations are defaults for
+// each alert's own.
 type PrometheusWebhook struct {
-	Version  string            `json:"version"`
-	GroupKey string            `json:"groupKey"`
-	Status   string            `json:"status"`
-	Alerts   []PrometheusAlert `json:"alerts"`
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []PrometheusAlert `json:"alerts"`
 }
 
+// AnnotationAlertmanagerURL is the annotation holding the URL of the
+// Alertmanager that sent an alert, for linking back to it
+const AnnotationAlertmanagerURL = "alertmanager_url"
+
 type PrometheusAlert struct {
 	Status       string            `json:"status"`
 	Labels       map[string]string `json:"labels"`
@@ -31,21 +48,214 @@ type PrometheusAlert struct {
 	GeneratorURL string            `json:"generatorURL"`
 }
 
+// GrafanaWebhook represents the Grafana unified alerting webhook format.
+// One notification can carry both firing and resolved alerts; the group
+// Status is "firing" if any of them still are.
+type GrafanaWebhook struct {
+	Receiver string         `json:"receiver"`
+	Status   string         `json:"status"`
+	OrgID    int64          `json:"orgId"`
+	GroupKey string         `json:"groupKey"`
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Alerts   []GrafanaAlert `json:"alerts"`
+}
+
+type GrafanaAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	DashboardURL string            `json:"dashboardURL"`
+	PanelURL     string            `json:"panelURL"`
+	ImageURL     string            `json:"imageURL"`
+	// ValueString describes the query values that fired the alert, e.g.
+	// "[ var='A' labels={instance=db-1} value=97.2 ]"
+	ValueString string `json:"valueString"`
+}
+
+// imageAnnotation carries screenshot URLs. Grafana sets it when image
+// rendering is enabled; other sources can set it to attach images too.
+const imageAnnotation = "__grafana_image__"
+
+// Annotations that keep Grafana's links and query values with the alert so
+// notifiers can link back to the dashboard it came from
+const (
+	dashboardURLAnnotation = "dashboard_url"
+	panelURLAnnotation     = "panel_url"
+	valueStringAnnotation  = "value_string"
+)
+
+// Dispatcher hands newly firing alerts to escalation and reports their
+// resolution. escalation.Dispatcher implements it.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, alert *models.AlertGroup) bool
+	Resolve(ctx context.Context, alert *models.AlertGroup)
+}
+
 // AlertProcessor handles alert ingestion and processing
 type AlertProcessor struct {
-	store *store.Store
+	store      *store.Store
+	events     *EventHub
+	dispatcher Dispatcher
+	labels     *LabelFilter
+	ingestion  *IngestionRate
+
+	// maxAnnotationLength caps annotation values in bytes; zero is
+	// unlimited
+	maxAnnotationLength int
+
+	// defaultChain is the escalation chain attached to alerts that don't
+	// arrive through an integration with one; nil attaches none
+	defaultChain *int64
+
+	// dedupInterval is how long resends of a still-firing alert are
+	// deduplicated before it notifies again; zero notifies only when it
+	// starts firing
+	dedupInterval time.Duration
+
+	// testAlerts schedules the auto-resolve of injected test alerts
+	testAlerts *TestAlerts
 }
 
 func NewAlertProcessor(st *store.Store) *AlertProcessor {
-	return &AlertProcessor{store: st}
+	return &AlertProcessor{
+		store:      st,
+		events:     NewEventHub(),
+		testAlerts: NewTestAlerts(),
+	}
+}
+
+// SetDispatcher routes alerts that start firing to escalation. Pass nil
+// to only store them.
+func (p *AlertProcessor) SetDispatcher(d Dispatcher) {
+	p.dispatcher = d
+}
+
+// SetLabelFilter drops labels matching filter from incoming alerts before
+// they are fingerprinted. Pass nil to keep every label.
+func (p *AlertProcessor) SetLabelFilter(filter *LabelFilter) {
+	p.labels = filter
+}
+
+// SetMaxAnnotationLength truncates annotation values longer than n bytes
+// before they are stored, marking them with TruncatedMarker. Zero or less
+// keeps annotations whole.
+func (p *AlertProcessor) SetMaxAnnotationLength(n int) {
+	p.maxAnnotationLength = n
+}
+
+// SetDefaultEscalationChain attaches chain id to alerts whose integration
+// doesn't name a chain, and to those sent without an integration. Zero or
+// less attaches none, leaving escalation to route them by label.
+func (p *AlertProcessor) SetDefaultEscalationChain(id int64) {
+	p.defaultChain = nil
+	if id > 0 {
+		p.defaultChain = &id
+	}
+}
+
+// SetDedupInterval makes an alert that keeps firing notify again once d
+// has passed since its last notification, however often it is resent in
+// between. Zero or less only notifies when an alert starts firing.
+func (p *AlertProcessor) SetDedupInterval(d time.Duration) {
+	p.dedupInterval = d
+}
+
+// SetTestAlerts schedules the auto-resolve of test alerts with t, so its
+// owner can stop them
+func (p *AlertProcessor) SetTestAlerts(t *TestAlerts) {
+	p.testAlerts = t
+}
+
+// SetIngestionRate counts received alerts in rate. Replayed webhooks are
+// not counted. Pass nil to stop counting.
+func (p *AlertProcessor) SetIngestionRate(rate *IngestionRate) {
+	p.ingestion = rate
 }
 
 // ProcessPrometheusWebhook processes Prometheus AlertManager webhook
 func (p *AlertProcessor) ProcessPrometheusWebhook(webhook *PrometheusWebhook) ([]*models.AlertGroup, error) {
+	return p.ProcessPrometheusWebhookFor(context.Background(), nil, webhook)
+}
+
+// ProcessPrometheusWebhookFor processes an Alertmanager webhook received
+// through integration, which may be nil, attaching its escalation chain.
+// ctx carries the request's log attributes on to the alerts'
+// notifications.
+func (p *AlertProcessor) ProcessPrometheusWebhookFor(ctx context.Context, integration *models.Integration, webhook *PrometheusWebhook) ([]*models.AlertGroup, error) {
+	return p.processAlerts(ctx, webhook, SourcePrometheus, p.chainFor(integration), false)
+}
+
+// chainFor returns the escalation chain for alerts from integration: its
+// own if it has one, otherwise the default
+func (p *AlertProcessor) chainFor(integration *models.Integration) *int64 {
+	if integration != nil && integration.EscalationChainID != nil {
+		return integration.EscalationChainID
+	}
+	return p.defaultChain
+}
+
+// Integrations alerts arrive from, as recorded in AlertGroup.Sources
+const (
+	SourcePrometheus = "prometheus"
+	SourceGrafana    = "grafana"
+)
+
+// processAlerts stores the webhook's alerts, as reported by source, and
+// attaches chainID, if not nil, as their escalation chain. An
+// alert whose fingerprint is already stored is updated in place: labels
+// and annotations are merged into the stored ones, the latest report
+// winning on conflicts, so an issue reported by several integrations stays
+// one alert that records each of them.
+//
+// With replay set, firing alerts are dispatched even if already firing, so
+// a replayed payload goes through the current routing rather than being
+// treated as a resend. Acknowledged alerts are left with whoever acked
+// them.
+//
+// Each alert is logged, dispatched and notified with ctx plus its
+// fingerprint as log attributes, so its trail can be followed.
+func (p *AlertProcessor) processAlerts(ctx context.Context, webhook *PrometheusWebhook, source string, chainID *int64, replay bool) ([]*models.AlertGroup, error) {
+	// Alerts already received are stored even if the sender hangs up
+	ctx = context.WithoutCancel(ctx)
 	var alertGroups []*models.AlertGroup
+	if !replay {
+		p.ingestion.Add(len(webhook.Alerts))
+	}
 
 	for _, alert := range webhook.Alerts {
+		alert.Labels = mergeLabels(webhook.CommonLabels, alert.Labels)
+		alert.Annotations = mergeLabels(webhook.CommonAnnotations, alert.Annotations)
+		if webhook.ExternalURL != "" && alert.Annotations[AnnotationAlertmanagerURL] == "" {
+			alert.Annotations = mergeLabels(alert.Annotations, map[string]string{AnnotationAlertmanagerURL: webhook.ExternalURL})
+		}
+
+		// Filter first so the fingerprint and stored labels agree
+		alert.Labels = p.labels.Apply(alert.Labels)
 		fingerprint := generateFingerprint(alert.Labels)
+		alertCtx := logging.WithAttrs(ctx, slog.String("fingerprint", fingerprint))
+
+		stored, err := p.loadStored(ctx, fingerprint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load stored alert: %w", err)
+		}
+
+		// Images are taken before truncation so long URL lists survive
+		images := alertImages(alert.Annotations)
+		alert.Annotations = truncateAnnotations(alert.Annotations, p.maxAnnotationLength)
+		sources := []string{source}
+		if stored != nil {
+			alert.Labels = mergeLabels(stored.labels, alert.Labels)
+			alert.Annotations = mergeLabels(stored.annotations, alert.Annotations)
+			if len(images) == 0 {
+				images = stored.images
+			}
+			sources = addSource(stored.sources, source)
+		}
 
 		severity := alert.Labels["severity"]
 		if severity == "" {
@@ -61,23 +271,98 @@ func (p *AlertProcessor) ProcessPrometheusWebhook(webhook *PrometheusWebhook) ([
 
 		labelsJSON, _ := json.Marshal(alert.Labels)
 		annotationsJSON, _ := json.Marshal(alert.Annotations)
+		imagesJSON, _ := json.Marshal(images)
+		sourcesJSON, _ := json.Marshal(sources)
 
+		now := time.Now()
 		alertGroup := &models.AlertGroup{
-			Fingerprint: fingerprint,
-			Status:      alert.Status,
-			Severity:    severity,
-			Summary:     summary,
-			Description: description,
-			Labels:      alert.Labels,
-			Annotations: alert.Annotations,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
+			Fingerprint:       fingerprint,
+			Status:            alert.Status,
+			Severity:          severity,
+			Summary:           summary,
+			Description:       description,
+			Labels:            alert.Labels,
+			Annotations:       alert.Annotations,
+			Images:            images,
+			Sources:           sources,
+			StartsAt:          alert.StartsAt,
+			EscalationChainID: chainID,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		if alert.Status == "resolved" && !alert.EndsAt.IsZero() {
+			endsAt := alert.EndsAt.UTC()
+			alertGroup.EndsAt = &endsAt
+		}
+
+		// Only a change into firing starts escalation, and only a change
+		// out of it sends resolve notifications, not every resend
+		var previousStatus string
+		var lastNotified time.Time
+		if stored != nil {
+			previousStatus = stored.status
+			lastNotified = stored.notifiedAt.Time
 		}
 
 		// Store or update alert in database
-		if err := p.upsertAlert(alertGroup, labelsJSON, annotationsJSON); err != nil {
+		applied, err := p.upsertAlert(alertCtx, alertGroup, labelsJSON, annotationsJSON, imagesJSON, sourcesJSON)
+		if err != nil {
 			return nil, fmt.Errorf("failed to store alert: %w", err)
 		}
+		if !applied {
+			slog.InfoContext(alertCtx, "ignoring out-of-order alert update",
+				"status", alert.Status,
+				"current_status", alertGroup.Status)
+			if !lastNotified.IsZero() {
+				alertGroup.NotifiedAt = &lastNotified
+			}
+		} else {
+			if alertGroup.Status != previousStatus {
+				err := store.RetryBusy(alertCtx, func() error {
+					return p.store.Alerts().RecordEvent(alertCtx, alertGroup.ID, previousStatus, alertGroup.Status, source, now)
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			wasActive := previousStatus == "firing" || previousStatus == "acknowledged"
+			redispatch := replay && previousStatus != "acknowledged"
+			dispatch := alertGroup.Status == "firing" &&
+				(!wasActive || redispatch || p.dedupElapsed(previousStatus, lastNotified, now))
+			resolve := alertGroup.Status == "resolved" && wasActive
+
+			// Record the notification before anyone else sees the alert
+			if dispatch || resolve {
+				alertGroup.Notify = true
+				if err := p.markNotified(alertCtx, alertGroup, now); err != nil {
+					return nil, err
+				}
+			} else if !lastNotified.IsZero() {
+				alertGroup.NotifiedAt = &lastNotified
+			}
+
+			level := slog.LevelDebug
+			if alertGroup.Notify {
+				level = slog.LevelInfo
+			}
+			slog.Log(alertCtx, level, "alert processed",
+				"alert_id", alertGroup.ID,
+				"source", source,
+				"status", alertGroup.Status,
+				"previous_status", previousStatus,
+				"notify", alertGroup.Notify)
+
+			p.events.Publish(alertGroup)
+			if p.dispatcher != nil {
+				switch {
+				case dispatch:
+					p.dispatcher.Dispatch(alertCtx, alertGroup)
+				case resolve:
+					p.dispatcher.Resolve(alertCtx, alertGroup)
+				}
+			}
+		}
 
 		alertGroups = append(alertGroups, alertGroup)
 	}
@@ -85,6 +370,261 @@ func (p *AlertProcessor) ProcessPrometheusWebhook(webhook *PrometheusWebhook) ([
 	return alertGroups, nil
 }
 
+// dedupElapsed reports whether an alert still firing since its last
+// notification at lastNotified is due to notify again. Acknowledged alerts
+// stay quiet until they resolve.
+func (p *AlertProcessor) dedupElapsed(previousStatus string, lastNotified, now time.Time) bool {
+	if p.dedupInterval <= 0 || previousStatus != "firing" {
+		return false
+	}
+	return lastNotified.IsZero() || now.Sub(lastNotified) >= p.dedupInterval
+}
+
+// markNotified records now as the alert's last notification
+func (p *AlertProcessor) markNotified(ctx context.Context, alert *models.AlertGroup, now time.Time) error {
+	now = now.UTC()
+	err := store.RetryBusy(ctx, func() error {
+		_, err := p.store.DB().ExecContext(ctx, `UPDATE alert_groups SET notified_at = ? WHERE id = ?`, now, alert.ID)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record notification: %w", err)
+	}
+	alert.NotifiedAt = &now
+	return nil
+}
+
+// ProcessGrafanaWebhook processes a Grafana unified alerting webhook. Each
+// alert carries its own status; alerts without one take the group status.
+func (p *AlertProcessor) ProcessGrafanaWebhook(webhook *GrafanaWebhook) ([]*models.AlertGroup, error) {
+	return p.ProcessGrafanaWebhookFor(context.Background(), nil, webhook)
+}
+
+// ProcessGrafanaWebhookFor processes a Grafana webhook received through
+// integration, which may be nil, attaching its escalation chain
+func (p *AlertProcessor) ProcessGrafanaWebhookFor(ctx context.Context, integration *models.Integration, webhook *GrafanaWebhook) ([]*models.AlertGroup, error) {
+	return p.processAlerts(ctx, grafanaToPrometheus(webhook), SourceGrafana, p.chainFor(integration), false)
+}
+
+// grafanaToPrometheus converts a Grafana webhook to the Alertmanager format
+// the processor stores
+func grafanaToPrometheus(webhook *GrafanaWebhook) *PrometheusWebhook {
+	converted := &PrometheusWebhook{
+		GroupKey: webhook.GroupKey,
+		Status:   webhook.Status,
+		Alerts:   make([]PrometheusAlert, 0, len(webhook.Alerts)),
+	}
+
+	for _, alert := range webhook.Alerts {
+		status := alert.Status
+		if status == "" {
+			status = webhook.Status
+		}
+
+		endsAt := alert.EndsAt
+		if status == "resolved" && endsAt.IsZero() {
+			endsAt = time.Now().UTC()
+		}
+
+		annotations := withAnnotations(alert.Annotations, map[string]string{
+			imageAnnotation:        alert.ImageURL,
+			dashboardURLAnnotation: alert.DashboardURL,
+			panelURLAnnotation:     alert.PanelURL,
+			valueStringAnnotation:  alert.ValueString,
+		})
+
+		converted.Alerts = append(converted.Alerts, PrometheusAlert{
+			Status:       status,
+			Labels:       alert.Labels,
+			Annotations:  annotations,
+			StartsAt:     alert.StartsAt,
+			EndsAt:       endsAt,
+			GeneratorURL: alert.GeneratorURL,
+		})
+	}
+
+	return converted
+}
+
+// withAnnotations returns annotations with the non-empty extra values added.
+// Annotations the sender set themselves win. The original map is left
+// untouched.
+func withAnnotations(annotations, extra map[string]string) map[string]string {
+	var merged map[string]string
+	for k, v := range extra {
+		if v == "" || annotations[k] != "" {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string]string, len(annotations)+len(extra))
+			for k, v := range annotations {
+				merged[k] = v
+			}
+		}
+		merged[k] = v
+	}
+	if merged == nil {
+		return annotations
+	}
+	return merged
+}
+
+// ReplayWebhook re-runs a stored raw webhook payload from source
+// ("prometheus" or "grafana") through the current label filtering and
+// routing. integration, which may be nil, is the one the payload came
+// through, so its alerts keep that integration's escalation chain.
+func (p *AlertProcessor) ReplayWebhook(ctx context.Context, source string, integration *models.Integration, payload []byte) ([]*models.AlertGroup, error) {
+	switch source {
+	case SourcePrometheus:
+		var webhook PrometheusWebhook
+		if err := json.Unmarshal(payload, &webhook); err != nil {
+			return nil, fmt.Errorf("failed to decode stored payload: %w", err)
+		}
+		return p.processAlerts(ctx, &webhook, source, p.chainFor(integration), true)
+	case SourceGrafana:
+		var webhook GrafanaWebhook
+		if err := json.Unmarshal(payload, &webhook); err != nil {
+			return nil, fmt.Errorf("failed to decode stored payload: %w", err)
+		}
+		return p.processAlerts(ctx, grafanaToPrometheus(&webhook), source, p.chainFor(integration), true)
+	default:
+		return nil, fmt.Errorf("cannot replay webhooks from %q", source)
+	}
+}
+
+// TruncatedMarker is appended to annotation values cut short by the
+// annotation length limit
+const TruncatedMarker = "...truncated"
+
+// truncateAnnotations returns annotations with every value longer than max
+// bytes cut to max, on a UTF-8 boundary, and marked with TruncatedMarker.
+// The map is returned as is when nothing needs cutting.
+func truncateAnnotations(annotations map[string]string, max int) map[string]string {
+	if max <= 0 {
+		return annotations
+	}
+
+	var truncated map[string]string
+	for name, value := range annotations {
+		if len(value) <= max {
+			continue
+		}
+		if truncated == nil {
+			truncated = make(map[string]string, len(annotations))
+			for k, v := range annotations {
+				truncated[k] = v
+			}
+		}
+
+		cut := max
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		truncated[name] = value[:cut] + TruncatedMarker
+		slog.Debug("truncated alert annotation",
+			"annotation", name,
+			"length", len(value),
+			"max", max)
+	}
+
+	if truncated == nil {
+		return annotations
+	}
+	return truncated
+}
+
+// alertImages extracts the http(s) image URLs from an alert's annotations.
+// The annotation may hold several URLs separated by whitespace or commas.
+func alertImages(annotations map[string]string) []string {
+	var images []string
+	seen := make(map[string]bool)
+	for _, field := range strings.FieldsFunc(annotations[imageAnnotation], func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		u, err := url.Parse(field)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		if !seen[field] {
+			seen[field] = true
+			images = append(images, field)
+		}
+	}
+	return images
+}
+
+// storedAlert is the part of an existing alert_groups row an update
+// builds on
+type storedAlert struct {
+	status      string
+	notifiedAt  sql.NullTime
+	labels      map[string]string
+	annotations map[string]string
+	images      []string
+	sources     []string
+}
+
+// loadStored returns the stored alert with fingerprint, or nil if there is
+// none
+func (p *AlertProcessor) loadStored(ctx context.Context, fingerprint string) (*storedAlert, error) {
+	var stored storedAlert
+	var labels, annotations, images, sources []byte
+	err := p.store.DB().QueryRowContext(ctx,
+		`SELECT status, notified_at, labels, annotations, images, sources FROM alert_groups WHERE fingerprint = ?`,
+		fingerprint,
+	).Scan(&stored.status, &stored.notifiedAt, &labels, &annotations, &images, &sources)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []struct {
+		raw  []byte
+		dest interface{}
+	}{
+		{labels, &stored.labels},
+		{annotations, &stored.annotations},
+		{images, &stored.images},
+		{sources, &stored.sources},
+	} {
+		if len(field.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(field.raw, field.dest); err != nil {
+			return nil, err
+		}
+	}
+	return &stored, nil
+}
+
+// mergeLabels returns stored overlaid with incoming. Neither map is
+// modified.
+func mergeLabels(stored, incoming map[string]string) map[string]string {
+	if len(stored) == 0 {
+		return incoming
+	}
+	merged := make(map[string]string, len(stored)+len(incoming))
+	for k, v := range stored {
+		merged[k] = v
+	}
+	for k, v := range incoming {
+		merged[k] = v
+	}
+	return merged
+}
+
+// addSource returns sources with source appended if it isn't there yet
+func addSource(sources []string, source string) []string {
+	for _, s := range sources {
+		if s == source {
+			return sources
+		}
+	}
+	return append(append([]string(nil), sources...), source)
+}
+
 // generateFingerprint creates a unique fingerprint from alert labels
 func generateFingerprint(labels map[string]string) string {
 	// Sort labels for consistent fingerprinting
@@ -108,32 +648,347 @@ func generateFingerprint(labels map[string]string) string {
 	return fmt.Sprintf("%x", hash[:8]) // Use first 8 bytes for readability
 }
 
-func (p *AlertProcessor) upsertAlert(alert *models.AlertGroup, labelsJSON, annotationsJSON []byte) error {
+// eventTime returns the timestamp that orders an alert update relative to
+// others for the same fingerprint: when it started firing, or when it was
+// resolved. Webhooks can be delivered out of order, so arrival time is not
+// a reliable sequence.
+func eventTime(alert *models.AlertGroup) time.Time {
+	if alert.Status == "resolved" && alert.EndsAt != nil {
+		return alert.EndsAt.UTC()
+	}
+	if !alert.StartsAt.IsZero() {
+		return alert.StartsAt.UTC()
+	}
+	return alert.UpdatedAt.UTC()
+}
+
+// upsertAlert stores the alert unless the stored row already reflects a
+// newer event, in which case alert is refreshed from the stored row and
+// false is returned. A resend of an acknowledged alert, firing since the
+// same time, stays acknowledged; alert.Status reports the stored status.
+func (p *AlertProcessor) upsertAlert(ctx context.Context, alert *models.AlertGroup, labelsJSON, annotationsJSON, imagesJSON, sourcesJSON []byte) (bool, error) {
 	query := `
-		INSERT INTO alert_groups (fingerprint, status, severity, summary, description, labels, annotations, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO alert_groups (fingerprint, status, severity, summary, description, labels, annotations, images, sources, escalation_chain_id, starts_at, ends_at, last_event_at, firing_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CASE WHEN ? = 'firing' THEN 1 ELSE 0 END, ?, ?)
 		ON CONFLICT(fingerprint) DO UPDATE SET
-			status = excluded.status,
+			status = CASE
+				WHEN alert_groups.status = 'acknowledged' AND excluded.status = 'firing'
+					AND alert_groups.starts_at = excluded.starts_at THEN alert_groups.status
+				ELSE excluded.status
+			END,
 			severity = excluded.severity,
 			summary = excluded.summary,
 			description = excluded.description,
 			labels = excluded.labels,
 			annotations = excluded.annotations,
-			updated_at = excluded.updated_at
-		RETURNING id
+			images = excluded.images,
+			sources = excluded.sources,
+			escalation_chain_id = COALESCE(excluded.escalation_chain_id, alert_groups.escalation_chain_id),
+			starts_at = excluded.starts_at,
+			ends_at = excluded.ends_at,
+			last_event_at = excluded.last_event_at,
+			updated_at = excluded.updated_at,
+			firing_count = alert_groups.firing_count +
+				CASE WHEN alert_groups.status = 'resolved' AND excluded.status = 'firing' THEN 1 ELSE 0 END
+		WHERE alert_groups.last_event_at IS NULL OR excluded.last_event_at >= alert_groups.last_event_at
+		RETURNING id, status, firing_count, escalation_chain_id
 	`
 
-	err := p.store.DB().QueryRow(query,
-		alert.Fingerprint,
-		alert.Status,
-		alert.Severity,
-		alert.Summary,
-		alert.Description,
-		labelsJSON,
-		annotationsJSON,
-		alert.CreatedAt,
-		alert.UpdatedAt,
-	).Scan(&alert.ID)
-
-	return err
+	var chainID sql.NullInt64
+	err := store.RetryBusy(ctx, func() error {
+		return p.store.DB().QueryRowContext(ctx, query,
+			alert.Fingerprint,
+			alert.Status,
+			alert.Severity,
+			alert.Summary,
+			alert.Description,
+			labelsJSON,
+			annotationsJSON,
+			imagesJSON,
+			sourcesJSON,
+			alert.EscalationChainID,
+			alert.StartsAt.UTC(),
+			alert.EndsAt,
+			eventTime(alert),
+			alert.Status,
+			alert.CreatedAt,
+			alert.UpdatedAt,
+		).Scan(&alert.ID, &alert.Status, &alert.FiringCount, &chainID)
+	})
+	if err == nil {
+		alert.EscalationChainID = nil
+		if chainID.Valid {
+			alert.EscalationChainID = &chainID.Int64
+		}
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	// The conflicting row has a newer event; report its state instead
+	stored, err := p.store.Alerts().GetByFingerprint(ctx, alert.Fingerprint)
+	if err != nil {
+		return false, err
+	}
+	alert.ID = stored.ID
+	alert.Status = stored.Status
+	alert.StartsAt = stored.StartsAt
+	alert.EndsAt = stored.EndsAt
+	alert.FiringCount = stored.FiringCount
+
+	return false, nil
+}
+
+// ActiveAlerts returns all alerts that are not resolved, oldest update first
+func (p *AlertProcessor) ActiveAlerts(ctx context.Context) ([]*models.AlertGroup, error) {
+	return p.store.Alerts().List(ctx, store.AlertFilter{
+		Unresolved: true,
+		SortBy:     store.AlertSortOldestUpdate,
+		Limit:      -1,
+	})
+}
+
+// GetAlert loads an alert by ID, returning sql.ErrNoRows if it doesn't exist
+func (p *AlertProcessor) GetAlert(ctx context.Context, id int64) (*models.AlertGroup, error) {
+	return p.store.Alerts().GetByID(ctx, id)
+}
+
+// AlertFilter narrows down ListAlerts results
+type AlertFilter = store.AlertFilter
+
+// ListAlerts returns alerts matching filter
+func (p *AlertProcessor) ListAlerts(ctx context.Context, filter AlertFilter) ([]*models.AlertGroup, error) {
+	return p.store.Alerts().List(ctx, filter)
+}
+
+// ResolveMatching resolves every unresolved alert whose labels satisfy
+// matchers and records an audit entry for actor, all in one transaction.
+// Their escalations are told to send resolve notifications, as Resolve
+// does. It returns the resolved alerts.
+func (p *AlertProcessor) ResolveMatching(ctx context.Context, matchers []LabelMatcher, selector, actor string) ([]*models.AlertGroup, error) {
+	tx, err := p.store.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	alerts := p.store.Alerts().WithTx(tx)
+
+	active, err := alerts.List(ctx, store.AlertFilter{Unresolved: true, Limit: -1})
+	if err != nil {
+		return nil, err
+	}
+	var matched []*models.AlertGroup
+	for _, alert := range active {
+		if !MatchAll(matchers, alert.Labels) {
+			continue
+		}
+		resolved, err := alerts.Transition(ctx, alert.ID, "resolved", actor)
+		if err != nil {
+			return nil, err
+		}
+		matched = append(matched, resolved)
+	}
+
+	now := time.Now().UTC()
+	details, _ := json.Marshal(map[string]interface{}{
+		"selector": selector,
+		"count":    len(matched),
+	})
+	_, err = tx.ExecContext(ctx, `INSERT INTO audit_log (action, actor, details, created_at) VALUES (?, ?, ?, ?)`,
+		"alerts.resolve_all", actor, details, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, alert := range matched {
+		p.events.Publish(alert)
+		if p.dispatcher != nil {
+			p.dispatcher.Resolve(ctx, alert)
+		}
+	}
+
+	return matched, nil
+}
+
+// AlertSelector picks the alerts a bulk action applies to: those in IDs
+// or, when IDs is empty, every unresolved alert whose labels match
+// Matchers
+type AlertSelector struct {
+	IDs      []int64
+	Matchers []LabelMatcher
+}
+
+// TransitionMany acknowledges or resolves the alerts sel picks, in one
+// transaction with an audit entry. Resolved alerts have their escalations
+// told to send resolve notifications, as Resolve does. It returns the
+// updated alerts and the selected IDs skipped because they have resolved
+// or don't exist.
+func (p *AlertProcessor) TransitionMany(ctx context.Context, sel AlertSelector, status, actor string) ([]*models.AlertGroup, []int64, error) {
+	tx, err := p.store.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	alerts := p.store.Alerts().WithTx(tx)
+
+	ids := sel.IDs
+	if len(ids) == 0 {
+		active, err := alerts.List(ctx, store.AlertFilter{Unresolved: true, Limit: -1})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, alert := range active {
+			if MatchAll(sel.Matchers, alert.Labels) {
+				ids = append(ids, alert.ID)
+			}
+		}
+	}
+
+	updated, skipped, err := alerts.TransitionMany(ctx, ids, status, actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	action := "alerts.bulk_acknowledge"
+	if status == "resolved" {
+		action = "alerts.bulk_resolve"
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"count":   len(updated),
+		"skipped": len(skipped),
+	})
+	_, err = tx.ExecContext(ctx, `INSERT INTO audit_log (action, actor, details, created_at) VALUES (?, ?, ?, ?)`,
+		action, actor, details, time.Now().UTC())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, alert := range updated {
+		p.events.Publish(alert)
+		if status == "resolved" && p.dispatcher != nil {
+			p.dispatcher.Resolve(ctx, alert)
+		}
+	}
+	return updated, skipped, nil
+}
+
+// ErrAlertResolved is returned when acting on an alert that has already
+// resolved
+var ErrAlertResolved = store.ErrAlertResolved
+
+// Acknowledge marks alert id as acknowledged by actor and, if note is not
+// empty, attaches it to the alert. Both happen in one transaction so an ack
+// is never recorded without the context the responder gave. It returns
+// sql.ErrNoRows if the alert doesn't exist and ErrAlertResolved if it has
+// resolved.
+func (p *AlertProcessor) Acknowledge(ctx context.Context, id int64, actor, note string) (*models.AlertGroup, *models.AlertNote, error) {
+	tx, err := p.store.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	alert, err := p.store.Alerts().WithTx(tx).Transition(ctx, id, "acknowledged", actor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var alertNote *models.AlertNote
+	if note != "" {
+		alertNote = &models.AlertNote{AlertGroupID: id, Author: actor, Text: note, CreatedAt: alert.UpdatedAt}
+		err = tx.QueryRowContext(ctx, `INSERT INTO alert_notes (alert_group_id, author, text, created_at) VALUES (?, ?, ?, ?) RETURNING id`,
+			id, actor, note, alert.UpdatedAt).Scan(&alertNote.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to add note: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	p.events.Publish(alert)
+	return alert, alertNote, nil
+}
+
+// RelatedAlert is an alert ranked by how many labels it shares with another
+type RelatedAlert struct {
+	*models.AlertGroup
+	SharedLabels int `json:"shared_labels"`
+}
+
+// Resolve marks alert id as resolved on behalf of actor and tells its
+// escalation, if any, to send resolve notifications. Resolving an alert that
+// already is returns it unchanged. It returns sql.ErrNoRows if the alert
+// doesn't exist.
+func (p *AlertProcessor) Resolve(ctx context.Context, id int64, actor string) (*models.AlertGroup, error) {
+	alerts := p.store.Alerts()
+	alert, err := alerts.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if alert.Status == "resolved" {
+		return alert, nil
+	}
+	if alert, err = alerts.Transition(ctx, id, "resolved", actor); err != nil {
+		return nil, err
+	}
+
+	p.events.Publish(alert)
+	if p.dispatcher != nil {
+		p.dispatcher.Resolve(ctx, alert)
+	}
+	return alert, nil
+}
+
+// RelatedAlerts returns alerts that started within window of alert id and
+// share at least minShared label pairs with it, most shared labels first.
+// It returns sql.ErrNoRows if the alert doesn't exist.
+func (p *AlertProcessor) RelatedAlerts(ctx context.Context, id int64, minShared int, window time.Duration) ([]RelatedAlert, error) {
+	alert, err := p.GetAlert(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := p.store.Alerts().List(ctx, store.AlertFilter{
+		StartedFrom: alert.StartsAt.Add(-window),
+		StartedTo:   alert.StartsAt.Add(window),
+		Limit:       -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	related := []RelatedAlert{}
+	for _, candidate := range candidates {
+		if candidate.ID == id {
+			continue
+		}
+		shared := 0
+		for name, value := range alert.Labels {
+			if v, ok := candidate.Labels[name]; ok && v == value {
+				shared++
+			}
+		}
+		if shared >= minShared {
+			related = append(related, RelatedAlert{AlertGroup: candidate, SharedLabels: shared})
+		}
+	}
+
+	sort.SliceStable(related, func(i, j int) bool {
+		if related[i].SharedLabels != related[j].SharedLabels {
+			return related[i].SharedLabels > related[j].SharedLabels
+		}
+		return related[i].StartsAt.After(related[j].StartsAt)
+	})
+	return related, nil
 }
@@ -1,8 +1,22 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+	"github.com/vjranagit/grafana/internal/oncall/store"
 )
 
 func TestGenerateFingerprint(t *testing.T) {
@@ -30,9 +44,9 @@ func TestGenerateFingerprint(t *testing.T) {
 		{
 			name: "ignore internal labels",
 			labels: map[string]string{
-				"alertname":    "HighCPU",
-				"instance":     "server1",
-				"__replica__":  "1", // Should be ignored (starts with __)
+				"alertname":   "HighCPU",
+				"instance":    "server1",
+				"__replica__": "1", // Should be ignored (starts with __)
 			},
 		},
 	}
@@ -136,27 +150,181 @@ func TestProcessPrometheusWebhook(t *testing.T) {
 		},
 	}
 
-	// Note: This test requires a real database connection
-	// For unit testing, we'd want to mock the store
-	// For now, we'll test the processing logic without DB
-	
-	processor := &AlertProcessor{}
-	
-	// Test that we can process without crashing
-	// (DB operations would fail, but logic is tested)
+	processor := NewAlertProcessor(newTestStore(t))
+
 	alerts, err := processor.ProcessPrometheusWebhook(webhook)
-	
-	// We expect an error because store is nil
-	if err == nil {
-		t.Log("Note: This test needs a mock store for full testing")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alert groups, got %d", len(alerts))
 	}
-	
-	// But alerts should be constructed properly before DB operation
-	if len(webhook.Alerts) != 2 {
-		t.Errorf("expected 2 alerts in webhook, got %d", len(webhook.Alerts))
+	for _, alert := range alerts {
+		if alert.ID == 0 {
+			t.Errorf("expected alert %s to be stored with an ID", alert.Fingerprint)
+		}
+	}
+	if alerts[0].Severity != "critical" {
+		t.Errorf("expected severity critical, got %s", alerts[0].Severity)
+	}
+	if alerts[1].Description != "" {
+		t.Errorf("expected empty description, got %q", alerts[1].Description)
 	}
-	
-	_ = alerts // Suppress unused warning
+}
+
+func TestProcessPrometheusWebhook_CommonLabels(t *testing.T) {
+	webhook := &PrometheusWebhook{
+		Version:           "4",
+		Status:            "firing",
+		GroupLabels:       map[string]string{"alertname": "DiskFull"},
+		CommonLabels:      map[string]string{"alertname": "DiskFull", "severity": "critical"},
+		CommonAnnotations: map[string]string{"summary": "Disk almost full"},
+		ExternalURL:       "http://alertmanager.example.com:9093",
+		Alerts: []PrometheusAlert{
+			{Status: "firing", Labels: map[string]string{"alertname": "DiskFull", "instance": "db-1"}, StartsAt: time.Now()},
+			{
+				Status:      "firing",
+				Labels:      map[string]string{"alertname": "DiskFull", "instance": "db-2"},
+				Annotations: map[string]string{"summary": "Disk on db-2 almost full"},
+				StartsAt:    time.Now(),
+			},
+		},
+	}
+
+	alerts, err := NewAlertProcessor(newTestStore(t)).ProcessPrometheusWebhook(webhook)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alert groups, got %d", len(alerts))
+	}
+	for _, alert := range alerts {
+		if alert.Severity != "critical" || alert.Labels["severity"] != "critical" {
+			t.Errorf("expected %s to inherit severity critical, got %q", alert.Labels["instance"], alert.Severity)
+		}
+		if alert.Annotations[AnnotationAlertmanagerURL] != "http://alertmanager.example.com:9093" {
+			t.Errorf("expected the Alertmanager URL annotation, got %v", alert.Annotations)
+		}
+	}
+	if alerts[0].Summary != "Disk almost full" {
+		t.Errorf("expected the common summary, got %q", alerts[0].Summary)
+	}
+	// The alert's own annotations win over the common ones
+	if alerts[1].Summary != "Disk on db-2 almost full" {
+		t.Errorf("expected the alert's own summary, got %q", alerts[1].Summary)
+	}
+	if alerts[0].Fingerprint == alerts[1].Fingerprint {
+		t.Error("expected alerts differing by instance to stay separate")
+	}
+}
+
+func TestProcessPrometheusWebhook_OutOfOrder(t *testing.T) {
+	labels := map[string]string{
+		"alertname": "HighCPU",
+		"instance":  "server1",
+	}
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	firing := func(startsAt time.Time) PrometheusAlert {
+		return PrometheusAlert{Status: "firing", Labels: labels, StartsAt: startsAt}
+	}
+	resolved := func(startsAt, endsAt time.Time) PrometheusAlert {
+		return PrometheusAlert{Status: "resolved", Labels: labels, StartsAt: startsAt, EndsAt: endsAt}
+	}
+
+	tests := []struct {
+		name     string
+		delivery []PrometheusAlert
+		expected string
+	}{
+		{
+			name: "in order",
+			delivery: []PrometheusAlert{
+				firing(t0),
+				resolved(t0, t0.Add(5*time.Minute)),
+			},
+			expected: "resolved",
+		},
+		{
+			name: "resolved arrives before its firing",
+			delivery: []PrometheusAlert{
+				resolved(t0, t0.Add(5*time.Minute)),
+				firing(t0),
+			},
+			expected: "resolved",
+		},
+		{
+			name: "stale resolved arrives after newer firing",
+			delivery: []PrometheusAlert{
+				firing(t0.Add(10 * time.Minute)),
+				resolved(t0, t0.Add(5*time.Minute)),
+			},
+			expected: "firing",
+		},
+		{
+			name: "refiring after resolution",
+			delivery: []PrometheusAlert{
+				firing(t0),
+				resolved(t0, t0.Add(5*time.Minute)),
+				firing(t0.Add(10 * time.Minute)),
+			},
+			expected: "firing",
+		},
+		{
+			name: "repeated firing keeps updating",
+			delivery: []PrometheusAlert{
+				firing(t0),
+				firing(t0),
+			},
+			expected: "firing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newTestStore(t)
+			processor := NewAlertProcessor(st)
+
+			var last *models.AlertGroup
+			for _, alert := range tt.delivery {
+				groups, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+					Status: alert.Status,
+					Alerts: []PrometheusAlert{alert},
+				})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				last = groups[0]
+			}
+
+			if last.Status != tt.expected {
+				t.Errorf("expected returned status %s, got %s", tt.expected, last.Status)
+			}
+
+			var stored string
+			err := st.DB().QueryRow(`SELECT status FROM alert_groups WHERE fingerprint = ?`,
+				last.Fingerprint).Scan(&stored)
+			if err != nil {
+				t.Fatalf("failed to load alert: %v", err)
+			}
+			if stored != tt.expected {
+				t.Errorf("expected stored status %s, got %s", tt.expected, stored)
+			}
+		})
+	}
+}
+
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+
+	st, err := store.New("sqlite://" + filepath.Join(t.TempDir(), "oncall.db"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	return st
 }
 
 func TestGenerateFingerprint_Severity(t *testing.T) {
@@ -180,3 +348,606 @@ func TestGenerateFingerprint_Severity(t *testing.T) {
 		t.Errorf("severity change should not affect fingerprint, got %s and %s", fp1, fp2)
 	}
 }
+
+func TestProcessPrometheusWebhook_FiringCount(t *testing.T) {
+	processor := NewAlertProcessor(newTestStore(t))
+	labels := map[string]string{"alertname": "DiskFull", "instance": "db1"}
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	deliveries := []struct {
+		alert    PrometheusAlert
+		expected int
+	}{
+		{PrometheusAlert{Status: "firing", Labels: labels, StartsAt: t0}, 1},
+		// Alertmanager re-sends the same firing alert periodically
+		{PrometheusAlert{Status: "firing", Labels: labels, StartsAt: t0}, 1},
+		{PrometheusAlert{Status: "firing", Labels: labels, StartsAt: t0}, 1},
+		{PrometheusAlert{Status: "resolved", Labels: labels, StartsAt: t0, EndsAt: t0.Add(time.Minute)}, 1},
+		{PrometheusAlert{Status: "firing", Labels: labels, StartsAt: t0.Add(time.Hour)}, 2},
+		{PrometheusAlert{Status: "firing", Labels: labels, StartsAt: t0.Add(time.Hour)}, 2},
+		{PrometheusAlert{Status: "resolved", Labels: labels, StartsAt: t0.Add(time.Hour), EndsAt: t0.Add(2 * time.Hour)}, 2},
+		{PrometheusAlert{Status: "firing", Labels: labels, StartsAt: t0.Add(3 * time.Hour)}, 3},
+	}
+
+	for i, d := range deliveries {
+		groups, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{Alerts: []PrometheusAlert{d.alert}})
+		if err != nil {
+			t.Fatalf("delivery %d: unexpected error: %v", i, err)
+		}
+		if groups[0].FiringCount != d.expected {
+			t.Errorf("delivery %d (%s): expected firing count %d, got %d",
+				i, d.alert.Status, d.expected, groups[0].FiringCount)
+		}
+	}
+}
+
+func TestAlertImages(t *testing.T) {
+	tests := []struct {
+		annotation string
+		want       []string
+	}{
+		{"", nil},
+		{"https://grafana.example.com/render/a.png", []string{"https://grafana.example.com/render/a.png"}},
+		{"https://a.example.com/1.png, http://b.example.com/2.png https://a.example.com/1.png",
+			[]string{"https://a.example.com/1.png", "http://b.example.com/2.png"}},
+		{"file:///etc/passwd javascript:alert(1) not-a-url", nil},
+	}
+	for _, tt := range tests {
+		got := alertImages(map[string]string{imageAnnotation: tt.annotation})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.annotation, tt.want, got)
+		}
+	}
+}
+
+func TestProcessWebhook_ImageRendersInSlack(t *testing.T) {
+	processor := NewAlertProcessor(newTestStore(t))
+
+	image := "https://grafana.example.com/render/d-solo/abc.png"
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Status: "firing",
+		Alerts: []PrometheusAlert{{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "HighCPU"},
+			Annotations: map[string]string{"summary": "CPU is high", imageAnnotation: image},
+			StartsAt:    time.Now(),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stored, err := processor.GetAlert(context.Background(), alerts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Images, []string{image}) {
+		t.Fatalf("expected stored images [%s], got %v", image, stored.Images)
+	}
+
+	received := make(chan notifier.SlackMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg notifier.SlackMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer server.Close()
+
+	if err := notifier.NewSlackNotifier(server.URL).Send(context.Background(), stored, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg := <-received
+	var found bool
+	for _, block := range msg.Blocks {
+		if block.Type == "image" && block.ImageURL == image {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an image block for %s, got %+v", image, msg.Blocks)
+	}
+}
+
+func TestProcessGrafanaWebhook_ImageURL(t *testing.T) {
+	processor := NewAlertProcessor(newTestStore(t))
+
+	alerts, err := processor.ProcessGrafanaWebhook(&GrafanaWebhook{
+		Status: "firing",
+		Alerts: []GrafanaAlert{{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "HighCPU"},
+			StartsAt: time.Now(),
+			ImageURL: "https://grafana.example.com/render/panel.png",
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(alerts[0].Images, []string{"https://grafana.example.com/render/panel.png"}) {
+		t.Errorf("expected imageURL to be stored as an image, got %v", alerts[0].Images)
+	}
+}
+
+func TestProcessGrafanaWebhook_Links(t *testing.T) {
+	processor := NewAlertProcessor(newTestStore(t))
+
+	// Trimmed from a Grafana 10 contact point test notification
+	payload := `{
+		"receiver": "oncall",
+		"status": "firing",
+		"orgId": 1,
+		"groupKey": "{}/{alertname=\"HighLatency\"}:{alertname=\"HighLatency\"}",
+		"title": "[FIRING:1] HighLatency (api)",
+		"alerts": [{
+			"status": "firing",
+			"labels": {"alertname": "HighLatency", "service": "api", "severity": "warning"},
+			"annotations": {"summary": "p99 latency above 500ms"},
+			"startsAt": "2024-03-04T09:00:00Z",
+			"endsAt": "0001-01-01T00:00:00Z",
+			"generatorURL": "https://grafana.example.com/alerting/grafana/abc/view",
+			"fingerprint": "2f7c3d0c1e5a9b11",
+			"dashboardURL": "https://grafana.example.com/d/api-latency",
+			"panelURL": "https://grafana.example.com/d/api-latency?viewPanel=4",
+			"valueString": "[ var='A' labels={service=api} value=0.73 ]"
+		}]
+	}`
+	var webhook GrafanaWebhook
+	if err := json.Unmarshal([]byte(payload), &webhook); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := processor.ProcessGrafanaWebhook(&webhook)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts))
+	}
+	stored, err := processor.GetAlert(context.Background(), alerts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"summary":              "p99 latency above 500ms",
+		dashboardURLAnnotation: "https://grafana.example.com/d/api-latency",
+		panelURLAnnotation:     "https://grafana.example.com/d/api-latency?viewPanel=4",
+		valueStringAnnotation:  "[ var='A' labels={service=api} value=0.73 ]",
+	}
+	if !reflect.DeepEqual(stored.Annotations, want) {
+		t.Errorf("expected annotations %v, got %v", want, stored.Annotations)
+	}
+	if stored.Summary != "p99 latency above 500ms" || stored.Severity != "warning" {
+		t.Errorf("unexpected summary %q or severity %q", stored.Summary, stored.Severity)
+	}
+	// Fingerprinted from labels like Prometheus alerts, not Grafana's own
+	if want := generateFingerprint(webhook.Alerts[0].Labels); stored.Fingerprint != want {
+		t.Errorf("expected fingerprint %s, got %s", want, stored.Fingerprint)
+	}
+	if webhook.Alerts[0].Annotations[dashboardURLAnnotation] != "" {
+		t.Error("expected the webhook's own annotations left untouched")
+	}
+}
+
+func TestProcessWebhook_DedupInterval(t *testing.T) {
+	st := newTestStore(t)
+	processor := NewAlertProcessor(st)
+	dispatcher := &dispatchRecorder{}
+	processor.SetDispatcher(dispatcher)
+	processor.SetDedupInterval(time.Hour)
+
+	startsAt := time.Now().Add(-time.Minute)
+	deliver := func(status string) *models.AlertGroup {
+		t.Helper()
+		alert := PrometheusAlert{Status: status, Labels: map[string]string{"alertname": "HighCPU"}, StartsAt: startsAt}
+		if status == "resolved" {
+			alert.EndsAt = time.Now()
+		}
+		alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{Alerts: []PrometheusAlert{alert}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return alerts[0]
+	}
+
+	first := deliver("firing")
+	if !first.Notify || first.NotifiedAt == nil {
+		t.Fatalf("expected a newly firing alert to notify, got %+v", first)
+	}
+
+	// Alertmanager resending the group every few minutes
+	for i := 0; i < 5; i++ {
+		if resend := deliver("firing"); resend.Notify {
+			t.Fatalf("resend %d: expected to be deduplicated", i)
+		}
+	}
+	if len(dispatcher.dispatched) != 1 {
+		t.Errorf("expected a single dispatch for rapid resends, got %d", len(dispatcher.dispatched))
+	}
+
+	// Once the window has passed the next resend notifies again
+	if _, err := st.DB().Exec(`UPDATE alert_groups SET notified_at = ? WHERE id = ?`,
+		time.Now().Add(-2*time.Hour).UTC(), first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if again := deliver("firing"); !again.Notify {
+		t.Error("expected a resend after the dedup window to notify")
+	}
+	if deliver("firing").Notify {
+		t.Error("expected the window to restart after notifying")
+	}
+	if len(dispatcher.dispatched) != 2 {
+		t.Errorf("expected 2 dispatches, got %d", len(dispatcher.dispatched))
+	}
+
+	// Resolving always notifies, even inside the window
+	if resolved := deliver("resolved"); !resolved.Notify {
+		t.Error("expected the resolve to notify")
+	}
+	if len(dispatcher.resolved) != 1 {
+		t.Errorf("expected 1 resolve, got %d", len(dispatcher.resolved))
+	}
+	stored, err := processor.GetAlert(context.Background(), first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.NotifiedAt == nil {
+		t.Error("expected notified_at to be stored")
+	}
+}
+
+func TestProcessWebhook_DedupAcknowledged(t *testing.T) {
+	st := newTestStore(t)
+	processor := NewAlertProcessor(st)
+	processor.SetDedupInterval(time.Minute)
+
+	webhook := &PrometheusWebhook{Alerts: []PrometheusAlert{{
+		Status: "firing", Labels: map[string]string{"alertname": "HighCPU"}, StartsAt: time.Now(),
+	}}}
+	alerts, err := processor.ProcessPrometheusWebhook(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := processor.Acknowledge(context.Background(), alerts[0].ID, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+	st.DB().Exec(`UPDATE alert_groups SET notified_at = ?`, time.Now().Add(-time.Hour).UTC())
+
+	// Someone is on it, so the elapsed window doesn't page again
+	alerts, err = processor.ProcessPrometheusWebhook(webhook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts[0].Notify {
+		t.Error("expected an acknowledged alert not to notify on resend")
+	}
+
+	// Without a dedup interval resends never notify
+	processor.SetDedupInterval(0)
+	st.DB().Exec(`UPDATE alert_groups SET status = 'firing'`)
+	if alerts, _ = processor.ProcessPrometheusWebhook(webhook); alerts[0].Notify {
+		t.Error("expected resends to be deduplicated without an interval")
+	}
+}
+
+func TestProcessWebhook_ResendKeepsAcknowledged(t *testing.T) {
+	st := newTestStore(t)
+	processor := NewAlertProcessor(st)
+	dispatcher := &dispatchRecorder{}
+	processor.SetDispatcher(dispatcher)
+
+	startsAt := time.Now().Add(-time.Minute).UTC()
+	webhook := func(startsAt time.Time) *PrometheusWebhook {
+		return &PrometheusWebhook{Alerts: []PrometheusAlert{{
+			Status: "firing", Labels: map[string]string{"alertname": "HighCPU"}, StartsAt: startsAt,
+		}}}
+	}
+	alerts, err := processor.ProcessPrometheusWebhook(webhook(startsAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := alerts[0].ID
+	if _, _, err := processor.Acknowledge(context.Background(), id, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alertmanager resends the group while it keeps firing
+	alerts, err = processor.ProcessPrometheusWebhook(webhook(startsAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts[0].Status != "acknowledged" || alerts[0].Notify {
+		t.Errorf("expected the resend to stay acknowledged without notifying, got status %q notify %v",
+			alerts[0].Status, alerts[0].Notify)
+	}
+	stored, err := processor.GetAlert(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "acknowledged" {
+		t.Errorf("expected stored status acknowledged, got %q", stored.Status)
+	}
+	if len(dispatcher.dispatched) != 1 {
+		t.Errorf("expected only the first firing to dispatch, got %d", len(dispatcher.dispatched))
+	}
+
+	// Firing again from a later start is a new occurrence
+	alerts, err = processor.ProcessPrometheusWebhook(webhook(startsAt.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts[0].Status != "firing" {
+		t.Errorf("expected a new occurrence to fire, got %q", alerts[0].Status)
+	}
+}
+
+func TestLabelFilter_Apply(t *testing.T) {
+	labels := map[string]string{
+		"alertname":  "HighCPU",
+		"instance":   "server1",
+		"team":       "platform",
+		"user_email": "alice@example.com",
+		"user_id":    "42",
+	}
+
+	tests := []struct {
+		name   string
+		filter *LabelFilter
+		want   []string
+	}{
+		{"nil filter", nil, []string{"alertname", "instance", "team", "user_email", "user_id"}},
+		{"deny exact", &LabelFilter{Deny: []string{"user_email"}}, []string{"alertname", "instance", "team", "user_id"}},
+		{"deny glob", &LabelFilter{Deny: []string{"user_*"}}, []string{"alertname", "instance", "team"}},
+		{"allow keeps alertname", &LabelFilter{Allow: []string{"team"}}, []string{"alertname", "team"}},
+		{"deny wins over allow", &LabelFilter{Allow: []string{"team", "user_*"}, Deny: []string{"user_email"}}, []string{"alertname", "team", "user_id"}},
+	}
+	for _, tt := range tests {
+		got := tt.filter.Apply(labels)
+		var names []string
+		for name := range got {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, names)
+		}
+	}
+
+	if len(labels) != 5 {
+		t.Error("expected Apply to leave the input untouched")
+	}
+
+	drill := (&LabelFilter{Allow: []string{"team"}}).Apply(map[string]string{"test": "true", "drill_id": "1", "host": "db1"})
+	if !reflect.DeepEqual(drill, map[string]string{"test": "true", "drill_id": "1"}) {
+		t.Errorf("expected the allow list to keep test alert labels, got %v", drill)
+	}
+
+	if _, err := NewLabelFilter(nil, []string{"user_["}); err == nil {
+		t.Error("expected invalid pattern to be rejected")
+	}
+}
+
+func TestProcessPrometheusWebhook_LabelFilter(t *testing.T) {
+	processor := NewAlertProcessor(newTestStore(t))
+	filter, err := NewLabelFilter(nil, []string{"user_email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor.SetLabelFilter(filter)
+
+	send := func(email string) *models.AlertGroup {
+		alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+			Alerts: []PrometheusAlert{{
+				Status:   "firing",
+				Labels:   map[string]string{"alertname": "LoginFailures", "service": "auth", "user_email": email},
+				StartsAt: time.Now(),
+			}},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return alerts[0]
+	}
+
+	first := send("alice@example.com")
+	second := send("bob@example.com")
+
+	want := generateFingerprint(map[string]string{"alertname": "LoginFailures", "service": "auth"})
+	if first.Fingerprint != want {
+		t.Errorf("expected fingerprint computed on filtered labels %s, got %s", want, first.Fingerprint)
+	}
+	if second.ID != first.ID {
+		t.Errorf("expected alerts differing only in a denied label to merge, got ids %d and %d", first.ID, second.ID)
+	}
+
+	stored, err := processor.GetAlert(context.Background(), first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stored.Labels["user_email"]; ok {
+		t.Errorf("expected user_email stripped from stored labels, got %v", stored.Labels)
+	}
+	if stored.Labels["service"] != "auth" {
+		t.Errorf("expected other labels kept, got %v", stored.Labels)
+	}
+}
+
+func TestTruncateAnnotations(t *testing.T) {
+	annotations := map[string]string{"summary": "short", "valueString": "héllo wörld"}
+
+	if got := truncateAnnotations(annotations, 0); !reflect.DeepEqual(got, annotations) {
+		t.Errorf("expected no limit to keep annotations, got %v", got)
+	}
+	if got := truncateAnnotations(annotations, 64); !reflect.DeepEqual(got, annotations) {
+		t.Errorf("expected short annotations untouched, got %v", got)
+	}
+
+	// Byte 2 falls inside "é", so the cut backs up to the rune start
+	got := truncateAnnotations(annotations, 2)
+	want := map[string]string{"summary": "sh" + TruncatedMarker, "valueString": "h" + TruncatedMarker}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if annotations["valueString"] != "héllo wörld" {
+		t.Error("expected the input map to be left alone")
+	}
+}
+
+func TestProcessWebhook_TruncatesAnnotations(t *testing.T) {
+	st := newTestStore(t)
+	processor := NewAlertProcessor(st)
+	processor.SetMaxAnnotationLength(32)
+
+	huge := strings.Repeat("[ var='B' labels={instance=db1} value=97.3 ], ", 200)
+	alerts, err := processor.ProcessGrafanaWebhook(&GrafanaWebhook{
+		Status: "firing",
+		Alerts: []GrafanaAlert{{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "DiskFull"},
+			Annotations: map[string]string{"summary": "Disk almost full", "valueString": huge},
+			StartsAt:    time.Now(),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stored, err := processor.GetAlert(context.Background(), alerts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := huge[:32] + TruncatedMarker; stored.Annotations["valueString"] != want {
+		t.Errorf("expected truncated valueString %q, got %q", want, stored.Annotations["valueString"])
+	}
+	if stored.Annotations["summary"] != "Disk almost full" || stored.Summary != "Disk almost full" {
+		t.Errorf("expected the short summary untouched, got %q / %q", stored.Annotations["summary"], stored.Summary)
+	}
+}
+
+func TestProcessWebhook_DedupAcrossIntegrations(t *testing.T) {
+	processor := NewAlertProcessor(newTestStore(t))
+	startsAt := time.Now().Add(-time.Minute)
+
+	first, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Status: "firing",
+		Alerts: []PrometheusAlert{{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "HighCPU", "instance": "web-1", "severity": "warning"},
+			Annotations: map[string]string{"summary": "CPU is high", "runbook_url": "https://runbooks.example.com/cpu"},
+			StartsAt:    startsAt,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	second, err := processor.ProcessGrafanaWebhook(&GrafanaWebhook{
+		Status: "firing",
+		Alerts: []GrafanaAlert{{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "HighCPU", "instance": "web-1", "severity": "critical"},
+			Annotations: map[string]string{"summary": "CPU above 95%", "dashboard": "https://grafana.example.com/d/cpu"},
+			StartsAt:    startsAt,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if first[0].ID != second[0].ID {
+		t.Fatalf("expected both integrations to update alert %d, got %d", first[0].ID, second[0].ID)
+	}
+	all, err := processor.ListAlerts(context.Background(), AlertFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(all))
+	}
+
+	stored := all[0]
+	if want := []string{SourcePrometheus, SourceGrafana}; !reflect.DeepEqual(stored.Sources, want) {
+		t.Errorf("expected sources %v, got %v", want, stored.Sources)
+	}
+	wantAnnotations := map[string]string{
+		"summary":     "CPU above 95%",
+		"runbook_url": "https://runbooks.example.com/cpu",
+		"dashboard":   "https://grafana.example.com/d/cpu",
+	}
+	if !reflect.DeepEqual(stored.Annotations, wantAnnotations) {
+		t.Errorf("expected merged annotations %v, got %v", wantAnnotations, stored.Annotations)
+	}
+	if stored.Severity != "critical" || stored.Summary != "CPU above 95%" {
+		t.Errorf("expected the latest report to win on conflicts, got severity %q summary %q", stored.Severity, stored.Summary)
+	}
+
+	// Another report from a known source doesn't list it twice
+	if _, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Status: "firing",
+		Alerts: []PrometheusAlert{{
+			Status:   "firing",
+			Labels:   map[string]string{"alertname": "HighCPU", "instance": "web-1"},
+			StartsAt: startsAt,
+		}},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored, err = processor.GetAlert(context.Background(), first[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Sources) != 2 {
+		t.Errorf("expected sources to stay deduplicated, got %v", stored.Sources)
+	}
+}
+
+func TestUpsertAlert_ConcurrentWriters(t *testing.T) {
+	// Two stores on one file contend for SQLite's lock the way two
+	// processes would; each store already serializes its own writers
+	path := filepath.Join(t.TempDir(), "oncall.db")
+	var processors []*AlertProcessor
+	for i := 0; i < 2; i++ {
+		st, err := store.New("sqlite://" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { st.Close() })
+		processors = append(processors, NewAlertProcessor(st))
+	}
+
+	const writers, alertsEach = 8, 25
+	errs := make(chan error, 2*writers*alertsEach)
+	var wg sync.WaitGroup
+	for _, p := range processors {
+		for w := 0; w < writers; w++ {
+			wg.Add(1)
+			go func(p *AlertProcessor, w int) {
+				defer wg.Done()
+				for i := 0; i < alertsEach; i++ {
+					alert := &models.AlertGroup{
+						Fingerprint: fmt.Sprintf("fp-%d-%d", w, i%5),
+						Status:      "firing",
+						StartsAt:    time.Now(),
+						CreatedAt:   time.Now(),
+						UpdatedAt:   time.Now(),
+					}
+					if _, err := p.upsertAlert(context.Background(), alert, []byte("{}"), []byte("{}"), []byte("[]"), []byte("[]")); err != nil {
+						errs <- err
+					}
+				}
+			}(p, w)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("unexpected error from concurrent upsert: %v", err)
+	}
+	var count int
+	processors[0].store.DB().QueryRow(`SELECT COUNT(*) FROM alert_groups`).Scan(&count)
+	if count != writers*5 {
+		t.Errorf("expected %d alerts, got %d", writers*5, count)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	requireKey, err := RequireAPIKey([]APIKey{
+		{Name: "admin", Key: "admin-key"},
+		{Name: "dashboard", Key: "read-key", Scopes: []string{ScopeRead}},
+		{Name: "ci", Key: "write-key", Scopes: []string{ScopeWrite}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := requireKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		want   int
+	}{
+		{"no key", "GET", "", "", http.StatusUnauthorized},
+		{"unknown key", "GET", "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "GET", "Authorization", "Basic admin-key", http.StatusUnauthorized},
+		{"bearer", "GET", "Authorization", "Bearer admin-key", http.StatusOK},
+		{"lowercase bearer", "POST", "Authorization", "bearer admin-key", http.StatusOK},
+		{"x-api-key", "POST", "X-API-Key", "admin-key", http.StatusOK},
+		{"read key reads", "GET", "X-API-Key", "read-key", http.StatusOK},
+		{"read key writes", "POST", "X-API-Key", "read-key", http.StatusForbidden},
+		{"read key deletes", "DELETE", "Authorization", "Bearer read-key", http.StatusForbidden},
+		{"write key reads", "GET", "X-API-Key", "write-key", http.StatusOK},
+		{"write key writes", "PUT", "X-API-Key", "write-key", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/alerts", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate header on 401")
+			}
+		})
+	}
+}
+
+func TestRequireAPIKey_InvalidKeys(t *testing.T) {
+	tests := map[string][]APIKey{
+		"empty key":     {{Name: "a"}},
+		"duplicate key": {{Name: "a", Key: "k"}, {Name: "b", Key: "k"}},
+		"unknown scope": {{Name: "a", Key: "k", Scopes: []string{"admin"}}},
+	}
+	for name, keys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := RequireAPIKey(keys); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
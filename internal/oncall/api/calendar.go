@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/importer"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+const (
+	// maxCalendarImport caps the iCalendar feeds importSchedule reads
+	maxCalendarImport = 5 << 20
+
+	// calendarHorizon is how far ahead the calendar export lists shifts
+	calendarHorizon = 60 * 24 * time.Hour
+
+	// calendarLookback is how far back the export looks for the start of
+	// the shift in progress, so its event keeps the same start and UID
+	// from one fetch to the next
+	calendarLookback = 7 * 24 * time.Hour
+)
+
+// getScheduleCalendar serves the schedule's shifts over the next 60 days as
+// an RFC 5545 iCalendar file that calendar apps can subscribe to
+func (h *handlers) getScheduleCalendar(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	now := time.Now().UTC()
+	shifts, err := schedule.Shifts(now.Add(-calendarLookback), now.Add(calendarHorizon))
+	if err != nil {
+		slog.Error("failed to project shifts", "schedule", schedule.ID, "error", err)
+		http.Error(w, "failed to project shifts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="schedule-%d.ics"`, schedule.ID))
+	writeCalendar(w, schedule, shifts, loc, now)
+}
+
+// importSchedule creates a schedule from the iCalendar feed in the request
+// body, such as a PagerDuty schedule export, with the optional "name" and
+// "timezone" query parameters in place of the feed's own. Shifts forming a
+// rotation become a layer; otherwise each becomes an override.
+func (h *handlers) importSchedule(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCalendarImport+1))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxCalendarImport {
+		http.Error(w, "calendar too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	cal, err := importer.Parse(bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, "invalid calendar: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if name := r.URL.Query().Get("name"); name != "" {
+		cal.Name = name
+	}
+	if tz := r.URL.Query().Get("timezone"); tz != "" {
+		cal.Timezone = tz
+	}
+
+	schedule, err := importer.BuildSchedule(cal)
+	if err != nil {
+		http.Error(w, "failed to import calendar: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validateSchedule(w, schedule) {
+		return
+	}
+
+	overrides := schedule.Overrides
+	schedule.Overrides = nil
+	if err := h.store.CreateSchedule(r.Context(), schedule); err != nil {
+		slog.ErrorContext(r.Context(), "failed to create imported schedule", "error", err)
+		http.Error(w, "failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+	for i := range overrides {
+		overrides[i].ScheduleID = schedule.ID
+		if err := h.store.CreateOverride(r.Context(), &overrides[i]); err != nil {
+			slog.ErrorContext(r.Context(), "failed to create imported override", "schedule", schedule.ID, "error", err)
+			// Don't leave a partial import behind
+			if err := h.store.DeleteSchedule(r.Context(), schedule.ID); err != nil {
+				slog.ErrorContext(r.Context(), "failed to remove partial import", "schedule", schedule.ID, "error", err)
+			}
+			http.Error(w, "failed to create schedule", http.StatusInternalServerError)
+			return
+		}
+	}
+	schedule.Overrides = overrides
+
+	slog.InfoContext(r.Context(), "imported schedule",
+		"schedule", schedule.ID,
+		"shifts", len(cal.Events),
+		"layers", len(schedule.Layers),
+		"overrides", len(schedule.Overrides))
+	respondJSON(w, http.StatusCreated, schedule)
+}
+
+// writeCalendar writes one VEVENT per shift that hasn't ended by now. Times
+// carry the schedule's IANA zone as TZID, which calendar apps resolve
+// themselves, so no VTIMEZONE is included.
+func writeCalendar(w io.Writer, schedule *models.Schedule, shifts []models.OnCallShift, loc *time.Location, now time.Time) {
+	c := &icsWriter{w: w}
+	c.line("BEGIN:VCALENDAR")
+	c.line("VERSION:2.0")
+	c.line("PRODID:-//grafana-ops//oncall//EN")
+	c.line("CALSCALE:GREGORIAN")
+	c.line("METHOD:PUBLISH")
+	c.line("X-WR-CALNAME:" + icsText("On-call: "+schedule.Name))
+	if loc != time.UTC {
+		c.line("X-WR-TIMEZONE:" + loc.String())
+	}
+
+	for _, shift := range shifts {
+		if !shift.End.After(now) {
+			continue
+		}
+		c.line("BEGIN:VEVENT")
+		c.line("UID:" + shiftUID(schedule.ID, shift))
+		c.line("DTSTAMP:" + now.UTC().Format("20060102T150405Z"))
+		c.line("DTSTART" + icsTime(shift.Start, loc))
+		c.line("DTEND" + icsTime(shift.End, loc))
+		c.line("SUMMARY:" + icsText("On-call: "+shift.User))
+		c.line(icsAttendee(shift.User))
+		if shift.OverrideID != nil {
+			c.line("DESCRIPTION:" + icsText("Override of the "+schedule.Name+" rotation"))
+		}
+		c.line("TRANSP:TRANSPARENT")
+		c.line("END:VEVENT")
+	}
+
+	c.line("END:VCALENDAR")
+}
+
+// shiftUID identifies a shift by what put the user on call and when it
+// starts, so refetching the calendar updates events rather than adding
+// new ones
+func shiftUID(scheduleID int64, shift models.OnCallShift) string {
+	source := "rotation"
+	switch {
+	case shift.OverrideID != nil:
+		source = fmt.Sprintf("override-%d", *shift.OverrideID)
+	case shift.LayerID != nil:
+		source = fmt.Sprintf("layer-%d", *shift.LayerID)
+	}
+	return fmt.Sprintf("schedule-%d-%s-%d@grafana-ops", scheduleID, source, shift.Start.Unix())
+}
+
+// icsTime formats t as a property value suffix, e.g.
+// ";TZID=Europe/Berlin:20240304T090000", or ":20240304T080000Z" in UTC
+func icsTime(t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return ":" + t.UTC().Format("20060102T150405Z")
+	}
+	return ";TZID=" + loc.String() + ":" + t.In(loc).Format("20060102T150405")
+}
+
+// icsAttendee names user as the event's attendee. Users that aren't email
+// addresses get a placeholder URI, since the value must be one.
+func icsAttendee(user string) string {
+	address := "urn:x-grafana-ops:user:" + user
+	if strings.Contains(user, "@") {
+		address = "mailto:" + user
+	}
+	return "ATTENDEE;CN=" + icsParam(user) + ";ROLE=REQ-PARTICIPANT:" + address
+}
+
+// icsText escapes a TEXT property value
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icsParam quotes a parameter value if it contains characters that would
+// otherwise end it. Double quotes can't be escaped and are dropped.
+func icsParam(s string) string {
+	s = strings.ReplaceAll(s, `"`, "")
+	if strings.ContainsAny(s, ";:,") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// icsWriter writes content lines, folding them at 75 octets as RFC 5545
+// requires
+type icsWriter struct {
+	w io.Writer
+}
+
+func (c *icsWriter) line(s string) {
+	const limit = 75
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	io.WriteString(c.w, b.String())
+}
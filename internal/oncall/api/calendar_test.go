@@ -0,0 +1,250 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// parseICS unfolds content lines and returns the properties of each VEVENT
+// keyed by name, parameters included, e.g. "DTSTART;TZID=Europe/Berlin"
+func parseICS(t *testing.T, body string) []map[string]string {
+	t.Helper()
+	if !strings.HasSuffix(body, "\r\n") {
+		t.Fatal("expected CRLF line endings")
+	}
+	unfolded := strings.ReplaceAll(body, "\r\n ", "")
+
+	var events []map[string]string
+	var event map[string]string
+	for _, line := range strings.Split(strings.TrimSuffix(unfolded, "\r\n"), "\r\n") {
+		switch line {
+		case "BEGIN:VEVENT":
+			event = map[string]string{}
+			continue
+		case "END:VEVENT":
+			events = append(events, event)
+			event = nil
+			continue
+		}
+		if event == nil {
+			continue
+		}
+		// The name ends at the first colon outside a quoted parameter
+		quoted := false
+		for i, r := range line {
+			if r == '"' {
+				quoted = !quoted
+			}
+			if r == ':' && !quoted {
+				event[line[:i]] = line[i+1:]
+				break
+			}
+		}
+	}
+	return events
+}
+
+func TestGetScheduleCalendar(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	// Daily handoffs at 09:00 Berlin time
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	now := time.Now().In(loc)
+	start := time.Date(now.Year(), now.Month(), now.Day(), 9, 0, 0, 0, loc).AddDate(0, 0, -1)
+	schedule := &models.Schedule{
+		Name:     "Platform",
+		Timezone: "Europe/Berlin",
+		Layers: []models.Layer{
+			{Name: "primary", RotationType: "daily", RotationStart: start, Users: []string{"alice@example.com", "bob"}},
+		},
+	}
+	if err := st.CreateSchedule(context.Background(), schedule); err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+
+	fetch := func() (*httptest.ResponseRecorder, []map[string]string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/schedules/%d/calendar.ics", schedule.ID), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec, parseICS(t, rec.Body.String())
+	}
+
+	rec, events := fetch()
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("expected text/calendar, got %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, fmt.Sprintf(`filename="schedule-%d.ics"`, schedule.ID)) {
+		t.Errorf("expected a filename, got %q", cd)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n") || !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+		t.Errorf("expected a VCALENDAR, got:\n%s", body)
+	}
+
+	// The shift in progress plus one per day of the horizon, give or take
+	// one depending on the time of day
+	days := int(calendarHorizon / (24 * time.Hour))
+	if len(events) < days || len(events) > days+1 {
+		t.Fatalf("expected about %d events, got %d", days, len(events))
+	}
+
+	// The shift in progress is listed from its real start, not from now
+	first := events[0]
+	var wantUser, wantAttendee string
+	currentStart := start
+	if now.Before(start.AddDate(0, 0, 1)) {
+		wantUser, wantAttendee = "alice@example.com", "ATTENDEE;CN=alice@example.com;ROLE=REQ-PARTICIPANT"
+	} else {
+		currentStart = start.AddDate(0, 0, 1)
+		wantUser, wantAttendee = "bob", "ATTENDEE;CN=bob;ROLE=REQ-PARTICIPANT"
+	}
+	if first["SUMMARY"] != "On-call: "+wantUser {
+		t.Errorf("expected summary for %s, got %q", wantUser, first["SUMMARY"])
+	}
+	if _, ok := first[wantAttendee]; !ok {
+		t.Errorf("expected attendee %s, got %v", wantUser, first)
+	}
+	if got := first["DTSTART;TZID=Europe/Berlin"]; got != currentStart.Format("20060102T150405") {
+		t.Errorf("expected local start %s, got %q", currentStart.Format("20060102T150405"), got)
+	}
+	if got := first["DTEND;TZID=Europe/Berlin"]; got != currentStart.AddDate(0, 0, 1).Format("20060102T150405") {
+		t.Errorf("expected local end at the next 09:00, got %q", got)
+	}
+
+	// UIDs are unique and stable across fetches
+	seen := map[string]bool{}
+	for _, event := range events {
+		if event["UID"] == "" || seen[event["UID"]] {
+			t.Errorf("expected a unique UID, got %q", event["UID"])
+		}
+		seen[event["UID"]] = true
+	}
+	if _, again := fetch(); again[1]["UID"] != events[1]["UID"] {
+		t.Errorf("expected stable UIDs, got %q then %q", events[1]["UID"], again[1]["UID"])
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/schedules/99/calendar.ics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown schedule, got %d", rec.Code)
+	}
+}
+
+func TestICSWriter_FoldsAndEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	c := &icsWriter{w: &buf}
+	c.line("SUMMARY:" + icsText("On-call: "+strings.Repeat("ü", 60)+", a; b\\c"))
+
+	out := buf.String()
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("expected lines of at most 75 octets, got %d", len(line))
+		}
+	}
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.HasSuffix(unfolded, `\, a\; b\\c`+"\r\n") {
+		t.Errorf("expected escaped text, got %q", unfolded)
+	}
+}
+
+// weeklyFeed hands a weekly rotation between alice, bob and carol on
+// Mondays at 09:00 New York time, across the March DST change
+const weeklyFeed = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"X-WR-CALNAME:Platform Primary\r\n" +
+	"BEGIN:VEVENT\r\nDTSTART;TZID=America/New_York:20240226T090000\r\nDTEND;TZID=America/New_York:20240304T090000\r\n" +
+	"ATTENDEE;CN=Alice:mailto:alice@example.com\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nDTSTART;TZID=America/New_York:20240304T090000\r\nDTEND;TZID=America/New_York:20240311T090000\r\n" +
+	"ATTENDEE;CN=Bob:mailto:bob@example.com\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nDTSTART;TZID=America/New_York:20240311T090000\r\nDTEND;TZID=America/New_York:20240318T090000\r\n" +
+	"ATTENDEE;CN=Carol:mailto:carol@example.com\r\nEND:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nDTSTART;TZID=America/New_York:20240318T090000\r\nDTEND;TZID=America/New_York:20240325T090000\r\n" +
+	"ATTENDEE;CN=Alice:mailto:alice@example.com\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestImportSchedule(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	post := func(query, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/schedules/import"+query, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post("", weeklyFeed)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created models.Schedule
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rotation is persisted as a weekly layer
+	schedule, err := st.GetSchedule(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("failed to load imported schedule: %v", err)
+	}
+	if schedule.Name != "Platform Primary" || schedule.Timezone != "America/New_York" || len(schedule.Layers) != 1 {
+		t.Fatalf("unexpected schedule %+v", schedule)
+	}
+	layer := schedule.Layers[0]
+	if layer.RotationType != "weekly" || !layer.RotationStart.Equal(time.Date(2024, 2, 26, 9, 0, 0, 0, ny)) {
+		t.Errorf("expected a weekly rotation from the first shift, got %+v", layer)
+	}
+	if want := []string{"alice@example.com", "bob@example.com", "carol@example.com"}; !reflect.DeepEqual(layer.Users, want) {
+		t.Errorf("expected users %v, got %v", want, layer.Users)
+	}
+
+	// Shifts that don't form a rotation are persisted as overrides
+	gappy := strings.Replace(weeklyFeed, "20240311T090000\r\nDTEND", "20240312T090000\r\nDTEND", 1)
+	rec = post("?name=Ad+hoc&timezone=UTC", gappy)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	schedule, err = st.GetSchedule(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("failed to load imported schedule: %v", err)
+	}
+	if schedule.Name != "Ad hoc" || schedule.Timezone != "UTC" || len(schedule.Layers) != 0 || len(schedule.Overrides) != 4 {
+		t.Errorf("expected the overrides under the given name and timezone, got %+v", schedule)
+	}
+
+	for _, tt := range []struct {
+		name, query, body string
+	}{
+		{"not a calendar", "", "BEGIN:VCALENDAR\nnonsense\nEND:VCALENDAR\n"},
+		{"no events", "", "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"},
+		{"unknown timezone", "?timezone=Mars/Phobos", weeklyFeed},
+	} {
+		if rec := post(tt.query, tt.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"path"
+)
+
+// LabelFilter drops alert labels before they are fingerprinted and
+// stored, keeping high-cardinality or sensitive values such as user_email
+// out of the database. Patterns use path.Match syntax, e.g. "user_*".
+//
+// Changing the filter changes the fingerprint of affected alerts, so an
+// alert already stored under the old label set will be tracked as a new
+// one once the filter is applied.
+type LabelFilter struct {
+	// Allow, if not empty, keeps only matching labels. alertname is always
+	// kept since alerts are identified and summarized by it, as are the
+	// test and drill_id labels that mark test alerts.
+	Allow []string
+	// Deny drops matching labels, even if allowed
+	Deny []string
+}
+
+// NewLabelFilter validates the patterns and returns a filter
+func NewLabelFilter(allow, deny []string) (*LabelFilter, error) {
+	for _, pattern := range append(append([]string(nil), allow...), deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid label pattern %q: %w", pattern, err)
+		}
+	}
+	return &LabelFilter{Allow: allow, Deny: deny}, nil
+}
+
+// Apply returns a copy of labels without the filtered ones. A nil filter
+// returns labels unchanged.
+func (f *LabelFilter) Apply(labels map[string]string) map[string]string {
+	if f == nil || (len(f.Allow) == 0 && len(f.Deny) == 0) {
+		return labels
+	}
+
+	filtered := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if f.keep(name) {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+func (f *LabelFilter) keep(name string) bool {
+	if matchAny(f.Deny, name) {
+		return false
+	}
+	if len(f.Allow) == 0 || name == "alertname" || matchAny(f.Allow, name) {
+		return true
+	}
+	for _, label := range testAlertLabels {
+		if name == label {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIngestionWindow is the span IngestionRate averages over
+const DefaultIngestionWindow = time.Minute
+
+// IngestionRate counts received alerts in one-second buckets and reports
+// the average rate over a sliding window
+type IngestionRate struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[int64]int // unix second -> alerts
+}
+
+func NewIngestionRate(window time.Duration) *IngestionRate {
+	if window < time.Second {
+		window = DefaultIngestionWindow
+	}
+	return &IngestionRate{
+		window:  window,
+		now:     time.Now,
+		buckets: make(map[int64]int),
+	}
+}
+
+// Add records n alerts received now. It is a no-op on a nil receiver.
+func (r *IngestionRate) Add(n int) {
+	if r == nil || n <= 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now().Unix()
+	r.buckets[now] += n
+	r.prune(now)
+}
+
+// PerSecond returns the average number of alerts received per second
+// over the window
+func (r *IngestionRate) PerSecond() float64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune(r.now().Unix())
+
+	total := 0
+	for _, n := range r.buckets {
+		total += n
+	}
+	return float64(total) / r.window.Seconds()
+}
+
+func (r *IngestionRate) prune(now int64) {
+	oldest := now - int64(r.window/time.Second)
+	for sec := range r.buckets {
+		if sec <= oldest {
+			delete(r.buckets, sec)
+		}
+	}
+}
+
+// EscalationLoad reports escalations in progress. escalation.Dispatcher
+// implements it.
+type EscalationLoad interface {
+	ActiveEscalations() int
+}
+
+// NotificationLoad reports queued notification sends. notifier.Pool
+// implements it.
+type NotificationLoad interface {
+	QueueDepths() map[string]int
+	Backlog() int
+}
+
+// LoadSources feeds GET /debug/load. Unset sources report zero.
+type LoadSources struct {
+	Ingestion     *IngestionRate
+	Escalations   EscalationLoad
+	Notifications NotificationLoad
+}
+
+// LoadReport is the body of GET /debug/load. Field names are stable so
+// operators and autoscalers can depend on them.
+type LoadReport struct {
+	// IngestionRate is alerts received per second, averaged over
+	// IngestionWindowSeconds
+	IngestionRate          float64 `json:"ingestion_rate"`
+	IngestionWindowSeconds float64 `json:"ingestion_window_seconds"`
+	// QueueDepths is the number of queued notification sends per channel
+	QueueDepths map[string]int `json:"queue_depths"`
+	// ActiveEscalations is the number of escalation chains running
+	ActiveEscalations int `json:"active_escalations"`
+	// NotificationBacklog is queued plus in-flight notification sends
+	NotificationBacklog int       `json:"notification_backlog"`
+	Timestamp           time.Time `json:"timestamp"`
+}
+
+// Report collects the current load
+func (s LoadSources) Report() LoadReport {
+	report := LoadReport{
+		QueueDepths: map[string]int{},
+		Timestamp:   time.Now().UTC(),
+	}
+	if s.Ingestion != nil {
+		report.IngestionRate = s.Ingestion.PerSecond()
+		report.IngestionWindowSeconds = s.Ingestion.window.Seconds()
+	}
+	if s.Escalations != nil {
+		report.ActiveEscalations = s.Escalations.ActiveEscalations()
+	}
+	if s.Notifications != nil {
+		for channel, depth := range s.Notifications.QueueDepths() {
+			report.QueueDepths[channel] = depth
+		}
+		report.NotificationBacklog = s.Notifications.Backlog()
+	}
+	return report
+}
+
+// LoadHandler serves GET /debug/load
+func LoadHandler(sources LoadSources) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		respondJSON(w, http.StatusOK, sources.Report())
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeEscalations int
+
+func (f fakeEscalations) ActiveEscalations() int { return int(f) }
+
+type fakeNotifications struct {
+	depths  map[string]int
+	backlog int
+}
+
+func (f fakeNotifications) QueueDepths() map[string]int { return f.depths }
+func (f fakeNotifications) Backlog() int                { return f.backlog }
+
+func TestIngestionRate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	rate := NewIngestionRate(10 * time.Second)
+	rate.now = func() time.Time { return now }
+
+	rate.Add(20)
+	now = now.Add(5 * time.Second)
+	rate.Add(10)
+	if got := rate.PerSecond(); got != 3 {
+		t.Errorf("expected 3/s, got %v", got)
+	}
+
+	// The first batch falls out of the window
+	now = now.Add(6 * time.Second)
+	if got := rate.PerSecond(); got != 1 {
+		t.Errorf("expected 1/s, got %v", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := rate.PerSecond(); got != 0 {
+		t.Errorf("expected 0/s, got %v", got)
+	}
+
+	var unset *IngestionRate
+	unset.Add(5)
+	if got := unset.PerSecond(); got != 0 {
+		t.Errorf("expected nil rate to report 0, got %v", got)
+	}
+}
+
+func TestLoadHandler(t *testing.T) {
+	st := newTestStore(t)
+	rate := NewIngestionRate(DefaultIngestionWindow)
+	router := NewRouterWithOptions(st, RouterOptions{IngestionRate: rate})
+
+	body := `{"alerts":[
+		{"status":"firing","labels":{"alertname":"A"}},
+		{"status":"firing","labels":{"alertname":"B"}},
+		{"status":"firing","labels":{"alertname":"C"}}
+	]}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/prometheus", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	handler := LoadHandler(LoadSources{
+		Ingestion:   rate,
+		Escalations: fakeEscalations(4),
+		Notifications: fakeNotifications{
+			depths:  map[string]int{"slack": 2, "webhook": 5},
+			backlog: 9,
+		},
+	})
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/debug/load", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var report LoadReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if want := 3 / DefaultIngestionWindow.Seconds(); math.Abs(report.IngestionRate-want) > 1e-9 {
+		t.Errorf("expected ingestion rate %v, got %v", want, report.IngestionRate)
+	}
+	if report.IngestionWindowSeconds != 60 {
+		t.Errorf("expected 60s window, got %v", report.IngestionWindowSeconds)
+	}
+	if report.ActiveEscalations != 4 {
+		t.Errorf("expected 4 active escalations, got %d", report.ActiveEscalations)
+	}
+	if report.NotificationBacklog != 9 {
+		t.Errorf("expected backlog of 9, got %d", report.NotificationBacklog)
+	}
+	if want := map[string]int{"slack": 2, "webhook": 5}; !reflect.DeepEqual(report.QueueDepths, want) {
+		t.Errorf("expected queue depths %v, got %v", want, report.QueueDepths)
+	}
+}
+
+func TestLoadHandler_NoSources(t *testing.T) {
+	rec := httptest.NewRecorder()
+	LoadHandler(LoadSources{})(rec, httptest.NewRequest("GET", "/debug/load", nil))
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &fields); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	for _, key := range []string{"ingestion_rate", "queue_depths", "active_escalations", "notification_backlog"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("expected %s in report %v", key, fields)
+		}
+	}
+	if depths, _ := fields["queue_depths"].(map[string]interface{}); depths == nil {
+		t.Errorf("expected queue_depths to be an empty object, got %v", fields["queue_depths"])
+	}
+}
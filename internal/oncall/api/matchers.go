@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LabelMatcher matches a single label, like a Prometheus selector term
+type LabelMatcher struct {
+	Name  string
+	Op    string // =, !=, =~, !~
+	Value string
+	re    *regexp.Regexp
+}
+
+// Matches reports whether labels satisfy the matcher. A missing label is
+// treated as an empty value, as in Prometheus.
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	v := labels[m.Name]
+	switch m.Op {
+	case "=":
+		return v == m.Value
+	case "!=":
+		return v != m.Value
+	case "=~":
+		return m.re.MatchString(v)
+	case "!~":
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+// MatchAll reports whether labels satisfy every matcher
+func MatchAll(matchers []LabelMatcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMatchers parses a selector such as {cluster="staging", job=~"api.*"}.
+// The surrounding braces are optional.
+func ParseMatchers(selector string) ([]LabelMatcher, error) {
+	s := strings.TrimSpace(selector)
+	s = strings.TrimPrefix(s, "{")
+	s = strings.TrimSuffix(s, "}")
+
+	var matchers []LabelMatcher
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			break
+		}
+
+		nameEnd := strings.IndexAny(s, "=!")
+		if nameEnd <= 0 {
+			return nil, fmt.Errorf("invalid matcher %q: expected label name", s)
+		}
+		m := LabelMatcher{Name: strings.TrimSpace(s[:nameEnd])}
+		s = s[nameEnd:]
+
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(s, op) {
+				m.Op = op
+				break
+			}
+		}
+		if m.Op == "" {
+			return nil, fmt.Errorf("invalid operator for label %q", m.Name)
+		}
+		s = strings.TrimLeft(s[len(m.Op):], " \t")
+
+		if !strings.HasPrefix(s, `"`) {
+			return nil, fmt.Errorf("value for label %q must be quoted", m.Name)
+		}
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for label %q: %w", m.Name, err)
+		}
+		m.Value, _ = strconv.Unquote(quoted)
+		s = s[len(quoted):]
+
+		if m.Op == "=~" || m.Op == "!~" {
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex for label %q: %w", m.Name, err)
+			}
+			m.re = re
+		}
+
+		matchers = append(matchers, m)
+	}
+
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("selector must contain at least one matcher")
+	}
+	return matchers, nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import "testing"
+
+func TestParseMatchers(t *testing.T) {
+	matchers, err := ParseMatchers(`{cluster="staging", job=~"api.*", env!="prod", team!~"db|infra"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matchers) != 4 {
+		t.Fatalf("expected 4 matchers, got %d", len(matchers))
+	}
+
+	tests := []struct {
+		labels   map[string]string
+		expected bool
+	}{
+		{map[string]string{"cluster": "staging", "job": "api-server", "env": "dev", "team": "web"}, true},
+		{map[string]string{"cluster": "prod", "job": "api-server"}, false},
+		{map[string]string{"cluster": "staging", "job": "worker"}, false},
+		{map[string]string{"cluster": "staging", "job": "api", "env": "prod"}, false},
+		{map[string]string{"cluster": "staging", "job": "api", "team": "db"}, false},
+		// Regexes are anchored
+		{map[string]string{"cluster": "staging", "job": "my-api"}, false},
+	}
+	for _, tt := range tests {
+		if got := MatchAll(matchers, tt.labels); got != tt.expected {
+			t.Errorf("labels %v: expected %v, got %v", tt.labels, tt.expected, got)
+		}
+	}
+}
+
+func TestParseMatchers_Errors(t *testing.T) {
+	for _, selector := range []string{
+		``,
+		`{}`,
+		`{cluster=staging}`,
+		`{cluster~"x"}`,
+		`{="x"}`,
+		`{job=~"("}`,
+		`{cluster="unterminated}`,
+	} {
+		if _, err := ParseMatchers(selector); err == nil {
+			t.Errorf("expected error for selector %q", selector)
+		}
+	}
+}
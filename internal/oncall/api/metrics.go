@@ -0,0 +1,19 @@
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var webhookDecodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "oncall_webhook_decode_errors_total",
+	Help: "Total number of webhook payloads that could not be decoded",
+}, []string{"source"})
+
+var webhookRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "oncall_webhook_rate_limited_total",
+	Help: "Total number of webhook requests rejected by the rate limit",
+})
+
+func init() {
+	prometheus.MustRegister(webhookDecodeErrors, webhookRateLimited)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+)
+
+type failingNotifier struct{ err error }
+
+func (n failingNotifier) Channel() string { return "webhook" }
+
+func (n failingNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	return n.err
+}
+
+func newNotifierTestRouter(t *testing.T) (http.Handler, *recordingNotifier) {
+	t.Helper()
+	slack := &recordingNotifier{}
+	manager := notifier.NewManager()
+	manager.Register(slack)
+	manager.Register(failingNotifier{err: errors.New("webhook returned status 403")})
+	return NewRouterWithOptions(newTestStore(t), RouterOptions{Notifiers: manager}), slack
+}
+
+func postNotifierTest(router http.Handler, channel, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/notifiers/"+channel+"/test", strings.NewReader(body)))
+	return rec
+}
+
+func TestTestNotifier_Success(t *testing.T) {
+	router, slack := newNotifierTestRouter(t)
+
+	rec := postNotifierTest(router, "slack", `{"recipient": "https://hooks.slack.com/services/T0/B0/x"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result NotifierTestResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Error != "" || result.Channel != "slack" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if got := slack.recipients(); len(got) != 1 || got[0] != "https://hooks.slack.com/services/T0/B0/x" {
+		t.Fatalf("expected one send to the recipient, got %v", got)
+	}
+	sent := slack.sent[0]
+	if !strings.Contains(sent.Summary, "TEST") || sent.Labels["test"] != "true" || sent.ID != 0 {
+		t.Errorf("expected a synthetic alert marked TEST, got %+v", sent)
+	}
+}
+
+func TestTestNotifier_Failure(t *testing.T) {
+	router, _ := newNotifierTestRouter(t)
+
+	rec := postNotifierTest(router, "webhook", `{"recipient": "https://hooks.example.com"}`)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result NotifierTestResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Success || result.Error != "webhook returned status 403" {
+		t.Errorf("expected the notifier's error, got %+v", result)
+	}
+}
+
+func TestTestNotifier_UnknownChannel(t *testing.T) {
+	router, _ := newNotifierTestRouter(t)
+	if rec := postNotifierTest(router, "pagerduty", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown channel, got %d", rec.Code)
+	}
+
+	// Without notifiers there are no channels at all
+	router = NewRouter(newTestStore(t))
+	if rec := postNotifierTest(router, "slack", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without notifiers, got %d", rec.Code)
+	}
+}
+
+func TestTestNotifier_InvalidBody(t *testing.T) {
+	router, _ := newNotifierTestRouter(t)
+	if rec := postNotifierTest(router, "slack", `{`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,415 @@
+package api
+
+import (
+	"encoding/json"
+	"go/token"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// apiOperation documents one route in the OpenAPI spec. Request and
+// Response are values of the JSON bodies' types, from which their schemas
+// are derived; nil means no JSON body.
+type apiOperation struct {
+	Method   string
+	Path     string
+	Tag      string
+	Summary  string
+	Query    []apiParam
+	Request  interface{}
+	Status   int
+	Response interface{}
+	// ContentType is the response media type when it isn't JSON
+	ContentType string
+	// RequestContentType, if set, documents a request body of that media
+	// type instead of JSON Request
+	RequestContentType string
+}
+
+type apiParam struct {
+	Name        string
+	Type        string // string, integer or boolean
+	Format      string
+	Description string
+}
+
+// Response bodies that aren't a model of their own
+type (
+	webhookReceived struct {
+		Status        string `json:"status"`
+		AlertsCount   int    `json:"alerts_count"`
+		WebhookStatus string `json:"webhook_status,omitempty"`
+		FiringCount   int    `json:"firing_count,omitempty"`
+		ResolvedCount int    `json:"resolved_count,omitempty"`
+		// WebhookID is set when the payload was stored for replay
+		WebhookID int64 `json:"webhook_id,omitempty"`
+	}
+	alertResponse struct {
+		Alert *models.AlertGroup `json:"alert"`
+		Note  *models.AlertNote  `json:"note,omitempty"`
+	}
+	validationErrorResponse struct {
+		Error  string              `json:"error"`
+		Fields []models.FieldError `json:"fields"`
+	}
+	currentOnCallResponse struct {
+		ScheduleID  int64             `json:"schedule_id"`
+		OnCallUser  string            `json:"oncall_user"`
+		OnCall      map[string]string `json:"oncall"`
+		LayerID     *int64            `json:"layer_id"`
+		OverrideID  *int64            `json:"override_id"`
+		NextHandoff *time.Time        `json:"next_handoff"`
+		At          time.Time         `json:"at"`
+	}
+	upcomingOnCallResponse struct {
+		ScheduleID int64                `json:"schedule_id"`
+		From       time.Time            `json:"from"`
+		To         time.Time            `json:"to"`
+		Shifts     []models.OnCallShift `json:"shifts"`
+	}
+	coverageGapsResponse struct {
+		ScheduleID int64          `json:"schedule_id"`
+		From       time.Time      `json:"from"`
+		To         time.Time      `json:"to"`
+		Gaps       []models.Shift `json:"gaps"`
+	}
+	reprocessResponse struct {
+		WebhookID   int64                `json:"webhook_id"`
+		Source      string               `json:"source"`
+		AlertsCount int                  `json:"alerts_count"`
+		Alerts      []*models.AlertGroup `json:"alerts"`
+	}
+	resolveAllResponse struct {
+		Resolved int     `json:"resolved"`
+		IDs      []int64 `json:"ids"`
+	}
+	testAlertResponse struct {
+		Alert      *models.AlertGroup `json:"alert"`
+		ResolvesAt time.Time          `json:"resolves_at"`
+	}
+	actorRequest struct {
+		// Actor is used when the X-User header isn't set
+		Actor string `json:"actor,omitempty"`
+		Note  string `json:"note,omitempty"`
+	}
+	resolveAllRequest struct {
+		Matcher string `json:"matcher"`
+		Actor   string `json:"actor,omitempty"`
+	}
+	createIntegrationRequest struct {
+		Name              string            `json:"name"`
+		Type              string            `json:"type"`
+		Config            map[string]string `json:"config,omitempty"`
+		EscalationChainID *int64            `json:"escalation_chain_id,omitempty"`
+	}
+)
+
+func rfc3339Param(name, description string) apiParam {
+	return apiParam{Name: name, Type: "string", Format: "date-time", Description: description}
+}
+
+// apiOperations lists every route NewRouterWithOptions serves. A test
+// checks it against the router so the spec can't fall behind.
+var apiOperations = []apiOperation{
+	{Method: "GET", Path: "/openapi.json", Tag: "meta", Summary: "This OpenAPI document", Status: http.StatusOK, Response: map[string]interface{}{}},
+
+	{Method: "GET", Path: "/schedules", Tag: "schedules", Summary: "List schedules", Status: http.StatusOK, Response: []models.Schedule{}},
+	{Method: "POST", Path: "/schedules", Tag: "schedules", Summary: "Create a schedule with its layers", Request: models.Schedule{}, Status: http.StatusCreated, Response: models.Schedule{}},
+	{Method: "POST", Path: "/schedules/import", Tag: "schedules", Summary: "Create a schedule from an iCalendar feed, e.g. a PagerDuty export",
+		Query: []apiParam{
+			{Name: "name", Type: "string", Description: "Schedule name instead of the feed's"},
+			{Name: "timezone", Type: "string", Description: "Schedule timezone instead of the feed's"},
+		},
+		RequestContentType: "text/calendar", Status: http.StatusCreated, Response: models.Schedule{}},
+	{Method: "GET", Path: "/schedules/{id}", Tag: "schedules", Summary: "Get a schedule", Status: http.StatusOK, Response: models.Schedule{}},
+	{Method: "PUT", Path: "/schedules/{id}", Tag: "schedules", Summary: "Replace a schedule", Request: models.Schedule{}, Status: http.StatusOK, Response: models.Schedule{}},
+	{Method: "DELETE", Path: "/schedules/{id}", Tag: "schedules", Summary: "Delete a schedule", Status: http.StatusNoContent},
+	{Method: "GET", Path: "/schedules/{id}/oncall", Tag: "schedules", Summary: "Who is on call and the next handoff",
+		Query:  []apiParam{rfc3339Param("at", "Time to look up instead of now")},
+		Status: http.StatusOK, Response: currentOnCallResponse{}},
+	{Method: "GET", Path: "/schedules/{id}/oncall/upcoming", Tag: "schedules", Summary: "Upcoming on-call shifts",
+		Query: []apiParam{
+			rfc3339Param("from", "Start of the projection, default now"),
+			{Name: "days", Type: "integer", Description: "Days to project, default 14, at most 90"},
+		},
+		Status: http.StatusOK, Response: upcomingOnCallResponse{}},
+	{Method: "GET", Path: "/schedules/{id}/overrides", Tag: "schedules", Summary: "List a schedule's overrides", Status: http.StatusOK, Response: []models.Override{}},
+	{Method: "POST", Path: "/schedules/{id}/overrides", Tag: "schedules", Summary: "Put a user on call for a span", Request: models.Override{}, Status: http.StatusCreated, Response: models.Override{}},
+	{Method: "GET", Path: "/schedules/{id}/gaps", Tag: "schedules", Summary: "Spans with nobody on call",
+		Query: []apiParam{
+			rfc3339Param("from", "Start of the range, default now"),
+			rfc3339Param("to", "End of the range, default 7 days after from"),
+		},
+		Status: http.StatusOK, Response: coverageGapsResponse{}},
+	{Method: "GET", Path: "/schedules/{id}/calendar.ics", Tag: "schedules", Summary: "iCalendar feed of the schedule's shifts", Status: http.StatusOK, ContentType: "text/calendar"},
+
+	{Method: "GET", Path: "/escalations", Tag: "escalations", Summary: "List escalation chains", Status: http.StatusOK, Response: []models.EscalationChain{}},
+	{Method: "POST", Path: "/escalations", Tag: "escalations", Summary: "Create an escalation chain", Request: models.EscalationChain{}, Status: http.StatusCreated, Response: map[string]string{}},
+	{Method: "GET", Path: "/escalations/{id}", Tag: "escalations", Summary: "Get an escalation chain", Status: http.StatusOK, Response: map[string]string{}},
+	{Method: "PUT", Path: "/escalations/{id}", Tag: "escalations", Summary: "Replace an escalation chain", Request: models.EscalationChain{}, Status: http.StatusOK, Response: map[string]string{}},
+	{Method: "DELETE", Path: "/escalations/{id}", Tag: "escalations", Summary: "Delete an escalation chain", Status: http.StatusNoContent},
+
+	{Method: "POST", Path: "/alerts/prometheus", Tag: "alerts", Summary: "Receive an Alertmanager webhook",
+		Query:   []apiParam{{Name: "integration_id", Type: "integer", Description: "Integration the webhook came through"}},
+		Request: PrometheusWebhook{}, Status: http.StatusOK, Response: webhookReceived{}},
+	{Method: "POST", Path: "/alerts/grafana", Tag: "alerts", Summary: "Receive a Grafana unified alerting webhook",
+		Query:   []apiParam{{Name: "integration_id", Type: "integer", Description: "Integration the webhook came through"}},
+		Request: GrafanaWebhook{}, Status: http.StatusOK, Response: webhookReceived{}},
+	{Method: "POST", Path: "/alerts/webhook", Tag: "alerts", Summary: "Generic webhooks; not supported yet", Request: map[string]interface{}{}, Status: http.StatusNotImplemented},
+	{Method: "POST", Path: "/alerts/integrations/{token}", Tag: "alerts", Summary: "Receive a webhook through an integration's URL, in the integration's format",
+		Request: map[string]interface{}{}, Status: http.StatusOK, Response: webhookReceived{}},
+	{Method: "GET", Path: "/alerts", Tag: "alerts", Summary: "List alerts",
+		Query: []apiParam{
+			{Name: "status", Type: "string", Description: "firing, acknowledged or resolved"},
+			{Name: "severity", Type: "string"},
+			{Name: "sort", Type: "string", Description: "updated_at or firing_count"},
+			{Name: "min_firing_count", Type: "integer"},
+			{Name: "limit", Type: "integer"},
+		},
+		Status: http.StatusOK, Response: []models.AlertGroup{}},
+	{Method: "GET", Path: "/alerts/stream", Tag: "alerts", Summary: "Alert updates as Server-Sent Events", Status: http.StatusOK, ContentType: "text/event-stream"},
+	{Method: "POST", Path: "/alerts/resolve-all", Tag: "alerts", Summary: "Resolve every active alert matching a label selector", Request: resolveAllRequest{}, Status: http.StatusOK, Response: resolveAllResponse{}},
+	{Method: "POST", Path: "/alerts/acknowledge", Tag: "alerts", Summary: "Acknowledge the listed alerts, or every unresolved alert with the given labels", Request: bulkTransitionRequest{}, Status: http.StatusOK, Response: bulkTransitionResponse{}},
+	{Method: "POST", Path: "/alerts/resolve", Tag: "alerts", Summary: "Resolve the listed alerts, or every unresolved alert with the given labels", Request: bulkTransitionRequest{}, Status: http.StatusOK, Response: bulkTransitionResponse{}},
+	{Method: "POST", Path: "/alerts/test", Tag: "alerts", Summary: "Inject a synthetic alert that resolves itself", Request: testAlertRequest{}, Status: http.StatusCreated, Response: testAlertResponse{}},
+	{Method: "POST", Path: "/alerts/reprocess/{webhookId}", Tag: "alerts", Summary: "Replay a stored webhook", Status: http.StatusOK, Response: reprocessResponse{}},
+	{Method: "GET", Path: "/alerts/{id}", Tag: "alerts", Summary: "Get an alert", Status: http.StatusOK, Response: models.AlertGroup{}},
+	{Method: "GET", Path: "/alerts/{id}/related", Tag: "alerts", Summary: "Alerts sharing labels with an alert",
+		Query: []apiParam{
+			{Name: "min_shared", Type: "integer", Description: "Labels an alert must share, default 2"},
+			{Name: "window", Type: "string", Description: "Go duration around the alert's start, default 1h"},
+		},
+		Status: http.StatusOK, Response: []RelatedAlert{}},
+	{Method: "GET", Path: "/alerts/{id}/history", Tag: "alerts", Summary: "An alert's status changes, oldest first", Status: http.StatusOK, Response: []models.AlertEvent{}},
+	{Method: "POST", Path: "/alerts/{id}/acknowledge", Tag: "alerts", Summary: "Acknowledge an alert, optionally with a note", Request: actorRequest{}, Status: http.StatusOK, Response: alertResponse{}},
+	{Method: "POST", Path: "/alerts/{id}/resolve", Tag: "alerts", Summary: "Resolve an alert", Status: http.StatusOK, Response: alertResponse{}},
+
+	{Method: "GET", Path: "/stats", Tag: "meta", Summary: "Alert and schedule counts for dashboards", Status: http.StatusOK, Response: StatsReport{}},
+	{Method: "POST", Path: "/notifiers/{channel}/test", Tag: "meta", Summary: "Send a test notification on a channel", Request: notifierTestRequest{}, Status: http.StatusOK, Response: NotifierTestResult{}},
+	{Method: "POST", Path: "/slack/interactions", Tag: "meta", Summary: "Slack button clicks; served when a Slack signing secret is configured", Status: http.StatusOK, Response: slackMessageUpdate{}},
+
+	{Method: "GET", Path: "/integrations", Tag: "integrations", Summary: "List integrations", Status: http.StatusOK, Response: []models.Integration{}},
+	{Method: "POST", Path: "/integrations", Tag: "integrations", Summary: "Create an integration and its webhook token", Request: createIntegrationRequest{}, Status: http.StatusCreated, Response: models.Integration{}},
+	{Method: "GET", Path: "/integrations/{id}", Tag: "integrations", Summary: "Get an integration", Status: http.StatusOK, Response: models.Integration{}},
+	{Method: "DELETE", Path: "/integrations/{id}", Tag: "integrations", Summary: "Delete an integration", Status: http.StatusNoContent},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+// getOpenAPISpec serves the OpenAPI 3 description of this API
+func (h *handlers) getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		openAPIJSON, _ = json.Marshal(openAPISpec(apiOperations))
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
+
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openAPISpec builds the OpenAPI 3.0 document for ops
+func openAPISpec(ops []apiOperation) map[string]interface{} {
+	schemas := schemaSet{}
+	paths := map[string]map[string]interface{}{}
+
+	for _, op := range ops {
+		var params []interface{}
+		for _, m := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			typ := "string"
+			if m[1] == "id" || strings.HasSuffix(m[1], "Id") {
+				typ = "integer"
+			}
+			params = append(params, map[string]interface{}{
+				"name": m[1], "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": typ},
+			})
+		}
+		for _, q := range op.Query {
+			schema := map[string]interface{}{"type": q.Type}
+			if q.Format != "" {
+				schema["format"] = q.Format
+			}
+			param := map[string]interface{}{"name": q.Name, "in": "query", "schema": schema}
+			if q.Description != "" {
+				param["description"] = q.Description
+			}
+			params = append(params, param)
+		}
+
+		response := map[string]interface{}{"description": http.StatusText(op.Status)}
+		switch {
+		case op.ContentType != "":
+			response["content"] = map[string]interface{}{
+				op.ContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+			}
+		case op.Response != nil:
+			response["content"] = jsonContent(schemas.of(reflect.TypeOf(op.Response)))
+		}
+
+		operation := map[string]interface{}{
+			"summary":     op.Summary,
+			"operationId": operationID(op),
+			"tags":        []string{op.Tag},
+			"responses": map[string]interface{}{
+				strconv.Itoa(op.Status): response,
+				"default":               map[string]interface{}{"description": "Error, as a plain text message"},
+			},
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		switch {
+		case op.RequestContentType != "":
+			operation["requestBody"] = map[string]interface{}{
+				"content": map[string]interface{}{
+					op.RequestContentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+				},
+			}
+		case op.Request != nil:
+			operation["requestBody"] = map[string]interface{}{
+				"content": jsonContent(schemas.of(reflect.TypeOf(op.Request))),
+			}
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "grafana-ops oncall API",
+			"version": "1",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		// Keys are only required when the server is configured with some
+		"security": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"apiKey": []string{}},
+		},
+	}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+// operationID names op from its method and path, e.g. getSchedulesIdOncall
+func operationID(op apiOperation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, part := range strings.FieldsFunc(op.Path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '.'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// schemaSet collects the component schemas of exported named structs, which
+// other schemas refer to by name
+type schemaSet map[string]interface{}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// of returns the schema for t, adding the named structs it uses to s
+func (s schemaSet) of(t reflect.Type) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := s.of(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			// $ref can't have siblings in OpenAPI 3.0
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Struct:
+		if !token.IsExported(t.Name()) {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			// Claim the name first so recursive types terminate
+			s[t.Name()] = nil
+			s[t.Name()] = s.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// object returns the inline object schema for struct t, with the fields
+// encoding/json would write. Embedded structs without a JSON name have
+// their fields promoted.
+func (s schemaSet) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	s.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (s schemaSet) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.addFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+	}
+}
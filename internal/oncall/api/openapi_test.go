@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	router := NewRouterWithOptions(newTestStore(t), RouterOptions{SlackSigningSecret: "secret"})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("spec isn't valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.0") {
+		t.Errorf("expected an OpenAPI 3.0 document, got version %q", spec.OpenAPI)
+	}
+	for _, path := range []string{"/schedules", "/schedules/{id}/oncall", "/alerts/{id}/history", "/integrations"} {
+		if spec.Paths[path] == nil {
+			t.Errorf("expected %s in the spec", path)
+		}
+	}
+
+	// Every route the router serves is documented
+	err := chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		if _, ok := spec.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("%s %s is missing from the spec", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every schema reference resolves
+	for _, ref := range schemaRefs(rec.Body.String()) {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if spec.Components.Schemas[name] == nil {
+			t.Errorf("unresolved reference %s", ref)
+		}
+	}
+	if spec.Components.Schemas["AlertGroup"] == nil {
+		t.Error("expected the AlertGroup model among the schemas")
+	}
+}
+
+func schemaRefs(body string) []string {
+	var refs []string
+	for _, part := range strings.Split(body, `"$ref":"`)[1:] {
+		refs = append(refs, part[:strings.Index(part, `"`)])
+	}
+	return refs
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// What a RateLimiter keys its buckets by
+const (
+	// RateLimitByIP gives each client address its own bucket
+	RateLimitByIP = "ip"
+	// RateLimitByIntegration gives each integration its own bucket, taken
+	// from the integration URL token or integration_id parameter. Requests
+	// naming no integration fall back to their client address.
+	RateLimitByIntegration = "integration"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled are
+// dropped
+const rateLimitSweepInterval = time.Minute
+
+// RateLimiter is a token bucket limiter for the alert webhook receivers.
+// Each key gets Burst requests at once, refilled at Rate per second.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	by    string
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second with
+// bursts of burst, keyed by RateLimitByIP or RateLimitByIntegration. A
+// burst below 1 is raised to 1.
+func NewRateLimiter(rate float64, burst int, by string) (*RateLimiter, error) {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, fmt.Errorf("invalid rate limit %v: must be positive", rate)
+	}
+	if by != RateLimitByIP && by != RateLimitByIntegration {
+		return nil, fmt.Errorf("invalid rate limit key %q (want %s or %s)",
+			by, RateLimitByIP, RateLimitByIntegration)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		by:      by,
+		now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}, nil
+}
+
+// Middleware rejects requests over the limit with 429 and a Retry-After
+// header. A nil limiter lets everything through.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.key(r)
+		if wait, ok := l.allow(key); !ok {
+			webhookRateLimited.Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *RateLimiter) key(r *http.Request) string {
+	if l.by == RateLimitByIntegration {
+		if token := chi.URLParam(r, "token"); token != "" {
+			return "token:" + token
+		}
+		if id := r.URL.Query().Get("integration_id"); id != "" {
+			return "integration:" + id
+		}
+	}
+	// RemoteAddr is a bare IP once middleware.RealIP has replaced it
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// allow takes a token from key's bucket. Without one it returns how long
+// until the next is available.
+func (l *RateLimiter) allow(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return max(wait, time.Second), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep drops buckets that would be full by now, so clients that stop
+// sending don't hold memory
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRateLimiter(t *testing.T, rate float64, burst int, by string) (*RateLimiter, *time.Time) {
+	t.Helper()
+	l, err := NewRateLimiter(rate, burst, by)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func postWebhook(router http.Handler, path, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(`{"status": "firing", "alerts": []}`))
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRateLimiter_BurstAndRecovery(t *testing.T) {
+	limiter, now := newTestRateLimiter(t, 1, 3, RateLimitByIP)
+	router := NewRouterWithOptions(newTestStore(t), RouterOptions{WebhookRateLimit: limiter})
+
+	for i := 0; i < 3; i++ {
+		if rec := postWebhook(router, "/alerts/prometheus", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200 within the burst, got %d", i, rec.Code)
+		}
+	}
+	rec := postWebhook(router, "/alerts/prometheus", "10.0.0.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 past the burst, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After 1, got %q", got)
+	}
+	if rec := postWebhook(router, "/alerts/grafana", "10.0.0.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the limit to cover every receiver, got %d", rec.Code)
+	}
+
+	// Another client has its own bucket
+	if rec := postWebhook(router, "/alerts/prometheus", "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("expected another client to be unaffected, got %d", rec.Code)
+	}
+
+	// Reads are never limited
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/alerts", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected reads to be unaffected, got %d", rec.Code)
+	}
+
+	// One token refills per second
+	*now = now.Add(time.Second)
+	if rec := postWebhook(router, "/alerts/prometheus", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 after a token refilled, got %d", rec.Code)
+	}
+	if rec := postWebhook(router, "/alerts/prometheus", "10.0.0.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the refilled token is spent, got %d", rec.Code)
+	}
+
+	// The bucket never holds more than the burst
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		postWebhook(router, "/alerts/prometheus", "10.0.0.1:1234")
+	}
+	if rec := postWebhook(router, "/alerts/prometheus", "10.0.0.1:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 past the burst after a long pause, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiter_ByIntegration(t *testing.T) {
+	limiter, _ := newTestRateLimiter(t, 0.5, 1, RateLimitByIntegration)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	if rec := postWebhook(handler, "/alerts/prometheus?integration_id=1", "10.0.0.1:1"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	rec := postWebhook(handler, "/alerts/prometheus?integration_id=1", "10.0.0.2:1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected one bucket per integration across clients, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("expected Retry-After 2 at half a request per second, got %q", got)
+	}
+	if rec := postWebhook(handler, "/alerts/prometheus?integration_id=2", "10.0.0.1:1"); rec.Code != http.StatusOK {
+		t.Errorf("expected another integration to be unaffected, got %d", rec.Code)
+	}
+	// Without an integration the client address is the key
+	if rec := postWebhook(handler, "/alerts/prometheus", "10.0.0.1:1"); rec.Code != http.StatusOK {
+		t.Errorf("expected a request without an integration to use its own bucket, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiter_SweepsIdleBuckets(t *testing.T) {
+	limiter, now := newTestRateLimiter(t, 1, 2, RateLimitByIP)
+	limiter.allow("ip:10.0.0.1")
+	limiter.allow("ip:10.0.0.2")
+
+	*now = now.Add(rateLimitSweepInterval)
+	limiter.allow("ip:10.0.0.3")
+	if len(limiter.buckets) != 1 {
+		t.Errorf("expected refilled buckets to be dropped, got %d", len(limiter.buckets))
+	}
+}
+
+func TestNewRateLimiter_Invalid(t *testing.T) {
+	if _, err := NewRateLimiter(0, 1, RateLimitByIP); err == nil {
+		t.Error("expected an error for a zero rate")
+	}
+	if _, err := NewRateLimiter(1, 1, "user"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
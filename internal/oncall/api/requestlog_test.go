@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/vjranagit/grafana/internal/logging"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+)
+
+// captureLogs sends the default logger's records, with their context
+// attrs, to the returned function's result until the test ends
+func captureLogs(t *testing.T) func() []map[string]interface{} {
+	t.Helper()
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	previous := slog.Default()
+	handler := slog.NewJSONHandler(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	}), &slog.HandlerOptions{Level: slog.LevelDebug})
+	slog.SetDefault(slog.New(logging.NewContextHandler(handler)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return func() []map[string]interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		var records []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("failed to decode log line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// notifyingDispatcher sends every dispatched alert through a notifier
+// Manager, as escalation would
+type notifyingDispatcher struct {
+	manager *notifier.Manager
+}
+
+func (d notifyingDispatcher) Dispatch(ctx context.Context, alert *models.AlertGroup) bool {
+	d.manager.Send(ctx, "slack", alert, "#oncall")
+	return true
+}
+
+func (d notifyingDispatcher) Resolve(ctx context.Context, alert *models.AlertGroup) {}
+
+func TestLogRequests_CorrelatesAlertLogs(t *testing.T) {
+	logs := captureLogs(t)
+
+	manager := notifier.NewManager()
+	manager.Register(&recordingNotifier{})
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(LogRequests)
+	r.Mount("/", NewRouterWithOptions(newTestStore(t), RouterOptions{
+		Dispatcher: notifyingDispatcher{manager: manager},
+	}))
+
+	body := `{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "DiskFull"}}]}`
+	req := httptest.NewRequest("POST", "/alerts/prometheus", strings.NewReader(body))
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	fingerprint := generateFingerprint(map[string]string{"alertname": "DiskFull"})
+
+	messages := map[string]map[string]interface{}{}
+	for _, record := range logs() {
+		msg := record["msg"].(string)
+		messages[msg] = record
+		if record["request_id"] != "req-42" {
+			t.Errorf("expected %q to carry the request ID, got %v", msg, record)
+		}
+	}
+
+	// The alert's own lines, from the processor down to the notifier,
+	// carry its fingerprint too
+	for _, msg := range []string{"alert processed", "sending notification"} {
+		record, ok := messages[msg]
+		if !ok {
+			t.Errorf("expected %q to be logged", msg)
+			continue
+		}
+		if record["fingerprint"] != fingerprint {
+			t.Errorf("expected %q to carry fingerprint %s, got %v", msg, fingerprint, record["fingerprint"])
+		}
+	}
+
+	request, ok := messages["http request"]
+	if !ok {
+		t.Fatal("expected the request to be logged")
+	}
+	if request["method"] != "POST" || request["path"] != "/alerts/prometheus" || request["status"] != float64(http.StatusOK) {
+		t.Errorf("unexpected request log %v", request)
+	}
+}
@@ -1,30 +1,118 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
 	"github.com/vjranagit/grafana/internal/oncall/store"
 )
 
 func NewRouter(st *store.Store) chi.Router {
+	return NewRouterWithDispatcher(st, nil)
+}
+
+// NewRouterWithDispatcher is like NewRouter but hands alerts that start
+// firing to dispatcher for escalation
+func NewRouterWithDispatcher(st *store.Store, dispatcher Dispatcher) chi.Router {
+	return NewRouterWithOptions(st, RouterOptions{Dispatcher: dispatcher})
+}
+
+// RouterOptions configures alert processing for NewRouterWithOptions
+type RouterOptions struct {
+	// Dispatcher, if set, receives alerts that start firing or resolve
+	Dispatcher Dispatcher
+	// LabelFilter, if set, drops alert labels before storage
+	LabelFilter *LabelFilter
+	// StoreWebhooks keeps raw Prometheus and Grafana webhook payloads so
+	// they can be replayed with POST /alerts/reprocess/{webhookId}
+	StoreWebhooks bool
+	// StoreDeadLetters keeps webhook payloads that fail to decode in the
+	// dead_letter table for inspection
+	StoreDeadLetters bool
+	// MaxWebhookBytes caps the size of alert webhook bodies; larger ones
+	// get 413. Zero uses DefaultMaxWebhookBytes.
+	MaxWebhookBytes int64
+	// MaxAnnotationLength, if positive, truncates longer annotation values
+	MaxAnnotationLength int
+	// IngestionRate, if set, counts received alerts for GET /debug/load
+	IngestionRate *IngestionRate
+	// TestAlerts, if set, tracks the auto-resolves of POST /alerts/test
+	// so the caller can stop them on shutdown
+	TestAlerts *TestAlerts
+	// DefaultEscalationChain, if positive, is attached to alerts whose
+	// integration has no chain of its own
+	DefaultEscalationChain int64
+	// DedupInterval, if positive, lets alerts that keep firing notify
+	// again this long after their last notification
+	DedupInterval time.Duration
+	// WebhookRateLimit, if set, limits requests to the alert webhook
+	// receivers. Other endpoints are not limited.
+	WebhookRateLimit *RateLimiter
+	// Notifiers, if set, are the channels POST /notifiers/{channel}/test
+	// can send through
+	Notifiers *notifier.Manager
+	// SlackSigningSecret, if set, enables POST /slack/interactions for
+	// Slack button clicks, which must be signed with it
+	SlackSigningSecret string
+}
+
+// DefaultMaxWebhookBytes is the alert webhook body limit when
+// RouterOptions.MaxWebhookBytes is zero
+const DefaultMaxWebhookBytes = 5 << 20
+
+func NewRouterWithOptions(st *store.Store, opts RouterOptions) chi.Router {
 	r := chi.NewRouter()
 
 	h := &handlers{
-		store:          st,
-		alertProcessor: NewAlertProcessor(st),
+		store:            st,
+		alertProcessor:   NewAlertProcessor(st),
+		storeWebhooks:    opts.StoreWebhooks,
+		storeDeadLetters: opts.StoreDeadLetters,
+		maxWebhookBytes:  opts.MaxWebhookBytes,
+		startedAt:        time.Now(),
+
+		notifiers:          opts.Notifiers,
+		slackSigningSecret: opts.SlackSigningSecret,
+	}
+	if opts.Dispatcher != nil {
+		h.alertProcessor.SetDispatcher(opts.Dispatcher)
 	}
+	h.alertProcessor.SetLabelFilter(opts.LabelFilter)
+	h.alertProcessor.SetIngestionRate(opts.IngestionRate)
+	if opts.TestAlerts != nil {
+		h.alertProcessor.SetTestAlerts(opts.TestAlerts)
+	}
+	h.alertProcessor.SetMaxAnnotationLength(opts.MaxAnnotationLength)
+	h.alertProcessor.SetDedupInterval(opts.DedupInterval)
+	h.alertProcessor.SetDefaultEscalationChain(opts.DefaultEscalationChain)
+
+	r.Get("/openapi.json", h.getOpenAPISpec)
 
 	// Schedules
 	r.Route("/schedules", func(r chi.Router) {
 		r.Get("/", h.listSchedules)
 		r.Post("/", h.createSchedule)
+		r.Post("/import", h.importSchedule)
 		r.Get("/{id}", h.getSchedule)
 		r.Put("/{id}", h.updateSchedule)
 		r.Delete("/{id}", h.deleteSchedule)
 		r.Get("/{id}/oncall", h.getCurrentOnCall)
+		r.Get("/{id}/oncall/upcoming", h.getUpcomingOnCall)
+		r.Get("/{id}/overrides", h.listOverrides)
+		r.Post("/{id}/overrides", h.createOverride)
+		r.Get("/{id}/gaps", h.getCoverageGaps)
+		r.Get("/{id}/calendar.ics", h.getScheduleCalendar)
 	})
 
 	// Escalation Chains
@@ -38,15 +126,36 @@ func NewRouter(st *store.Store) chi.Router {
 
 	// Alerts (webhook receivers)
 	r.Route("/alerts", func(r chi.Router) {
-		r.Post("/prometheus", h.receivePrometheusAlert)
-		r.Post("/grafana", h.receiveGrafanaAlert)
-		r.Post("/webhook", h.receiveWebhookAlert)
+		limited := r.With(opts.WebhookRateLimit.Middleware)
+		limited.Post("/prometheus", h.receivePrometheusAlert)
+		limited.Post("/grafana", h.receiveGrafanaAlert)
+		limited.Post("/webhook", h.receiveWebhookAlert)
+		limited.Post("/integrations/{token}", h.receiveIntegrationAlert)
 		r.Get("/", h.listAlerts)
+		r.Get("/stream", h.streamAlerts)
+		r.Post("/resolve-all", h.resolveAllAlerts)
+		r.Post("/acknowledge", h.bulkTransition("acknowledged"))
+		r.Post("/resolve", h.bulkTransition("resolved"))
+		r.Post("/test", h.createTestAlert)
+		r.Post("/reprocess/{webhookId}", h.reprocessWebhook)
 		r.Get("/{id}", h.getAlert)
+		r.Get("/{id}/related", h.getRelatedAlerts)
+		r.Get("/{id}/history", h.getAlertHistory)
 		r.Post("/{id}/acknowledge", h.acknowledgeAlert)
 		r.Post("/{id}/resolve", h.resolveAlert)
 	})
 
+	// Summary counts for dashboards
+	r.Get("/stats", h.getStats)
+
+	// Test sends to check notifier credentials
+	r.Post("/notifiers/{channel}/test", h.testNotifier)
+
+	// Slack interactive messages
+	if opts.SlackSigningSecret != "" {
+		r.Post("/slack/interactions", h.slackInteraction)
+	}
+
 	// Integrations
 	r.Route("/integrations", func(r chi.Router) {
 		r.Get("/", h.listIntegrations)
@@ -61,36 +170,339 @@ func NewRouter(st *store.Store) chi.Router {
 type handlers struct {
 	store          *store.Store
 	alertProcessor *AlertProcessor
+	storeWebhooks  bool
+	// storeDeadLetters keeps payloads that fail to decode
+	storeDeadLetters bool
+	maxWebhookBytes  int64
+	// startedAt is reported as uptime by GET /stats
+	startedAt time.Time
+	// notifiers serves POST /notifiers/{channel}/test; nil has no channels
+	notifiers *notifier.Manager
+	// slackSigningSecret verifies POST /slack/interactions requests
+	slackSigningSecret string
 }
 
-// Placeholder handlers - to be implemented
 func (h *handlers) listSchedules(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, []interface{}{})
+	schedules, err := h.store.ListSchedules(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list schedules", "error", err)
+		http.Error(w, "failed to list schedules", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, schedules)
 }
 
 func (h *handlers) createSchedule(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusCreated, map[string]string{"status": "created"})
+	var schedule models.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !validateSchedule(w, &schedule) {
+		return
+	}
+
+	if err := h.store.CreateSchedule(r.Context(), &schedule); err != nil {
+		slog.ErrorContext(r.Context(), "failed to create schedule", "error", err)
+		http.Error(w, "failed to create schedule", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, schedule)
+}
+
+// validateSchedule checks a schedule from a request body and normalizes
+// its timezone. If it's invalid it writes a 400 listing the problems by
+// field and reports false.
+func validateSchedule(w http.ResponseWriter, schedule *models.Schedule) bool {
+	if err := schedule.Validate(); err != nil {
+		var fields models.ValidationError
+		errors.As(err, &fields)
+		respondJSON(w, http.StatusBadRequest, validationErrorResponse{
+			Error:  "invalid schedule",
+			Fields: fields,
+		})
+		return false
+	}
+
+	// Validate has checked the timezone
+	schedule.Timezone, _ = models.NormalizeTimezone(schedule.Timezone)
+	return true
 }
 
 func (h *handlers) getSchedule(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{"id": chi.URLParam(r, "id")})
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, schedule)
+}
+
+// loadSchedule fetches the schedule named by the {id} URL parameter,
+// writing an error response if it can't
+func (h *handlers) loadSchedule(w http.ResponseWriter, r *http.Request) (*models.Schedule, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid schedule id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	schedule, err := h.store.GetSchedule(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get schedule", "id", id, "error", err)
+		http.Error(w, "failed to get schedule", http.StatusInternalServerError)
+		return nil, false
+	}
+	return schedule, true
 }
 
 func (h *handlers) updateSchedule(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{"status": "updated"})
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid schedule id", http.StatusBadRequest)
+		return
+	}
+
+	var schedule models.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	schedule.ID = id
+
+	if !validateSchedule(w, &schedule) {
+		return
+	}
+
+	err = h.store.UpdateSchedule(r.Context(), &schedule)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update schedule", "id", id, "error", err)
+		http.Error(w, "failed to update schedule", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, schedule)
 }
 
 func (h *handlers) deleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid schedule id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.DeleteSchedule(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete schedule", "id", id, "error", err)
+		http.Error(w, "failed to delete schedule", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// getCurrentOnCall resolves who is on call now, or at the RFC 3339 time in
+// the optional "at" query parameter, with overrides and restrictions applied.
+// oncall_user is the primary; oncall maps each filled role to its user.
 func (h *handlers) getCurrentOnCall(w http.ResponseWriter, r *http.Request) {
+	at := time.Now().UTC()
+	if v := r.URL.Query().Get("at"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid at: expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		at = parsed
+	}
+
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	oncall, err := schedule.OnCallAt(at)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to resolve on-call user", "schedule", schedule.ID, "error", err)
+		http.Error(w, "failed to resolve on-call user", http.StatusInternalServerError)
+		return
+	}
+	roles, err := schedule.GetCurrentOnCall(at)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to resolve on-call roles", "schedule", schedule.ID, "error", err)
+		http.Error(w, "failed to resolve on-call user", http.StatusInternalServerError)
+		return
+	}
+	nextHandoff, err := schedule.NextHandoff(at)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to project next handoff", "schedule", schedule.ID, "error", err)
+		http.Error(w, "failed to resolve on-call user", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"schedule_id":  schedule.ID,
+		"oncall_user":  oncall.User,
+		"oncall":       roles,
+		"layer_id":     oncall.LayerID,
+		"override_id":  oncall.OverrideID,
+		"next_handoff": nextHandoff,
+		"at":           at,
+	})
+}
+
+// Bounds of the "days" parameter of getUpcomingOnCall
+const (
+	defaultUpcomingDays = 14
+	maxUpcomingDays     = int(models.MaxProjection / (24 * time.Hour))
+)
+
+// getUpcomingOnCall lists the on-call shifts over the next "days" days
+// (default 14, at most 90) from now, or from the RFC 3339 time in the
+// optional "from" query parameter
+func (h *handlers) getUpcomingOnCall(w http.ResponseWriter, r *http.Request) {
+	from := time.Now().UTC()
+	if v := r.URL.Query().Get("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from: expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	days := defaultUpcomingDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUpcomingDays {
+			http.Error(w, fmt.Sprintf("invalid days: expected 1 to %d", maxUpcomingDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	to := from.Add(time.Duration(days) * 24 * time.Hour)
+
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	shifts, err := schedule.Shifts(from, to)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to project shifts", "schedule", schedule.ID, "error", err)
+		http.Error(w, "failed to project shifts", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"schedule_id": schedule.ID,
+		"from":        from,
+		"to":          to,
+		"shifts":      shifts,
+	})
+}
+
+// getCoverageGaps lists the spans between the "from" and "to" query
+// parameters (RFC 3339, defaulting to the next 7 days) with nobody on call
+func (h *handlers) getCoverageGaps(w http.ResponseWriter, r *http.Request) {
+	from := time.Now().UTC()
+	to := from.AddDate(0, 0, 7)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := r.URL.Query().Get(name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid "+name+": expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		*dst = parsed
+	}
+
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	gaps, err := schedule.Gaps(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"schedule_id": chi.URLParam(r, "id"),
-		"oncall_user": "user123",
+		"schedule_id": schedule.ID,
+		"from":        from,
+		"to":          to,
+		"gaps":        gaps,
 	})
 }
 
+func (h *handlers) createOverride(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid schedule id", http.StatusBadRequest)
+		return
+	}
+
+	var override models.Override
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if override.User == "" {
+		http.Error(w, "user is required", http.StatusBadRequest)
+		return
+	}
+	if !override.End.After(override.Start) {
+		http.Error(w, "end must be after start", http.StatusBadRequest)
+		return
+	}
+	override.ScheduleID = id
+
+	err = h.store.CreateOverride(r.Context(), &override)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create override", "schedule", id, "error", err)
+		http.Error(w, "failed to create override", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, override)
+}
+
+// listOverrides returns a schedule's overrides, past and future, ordered
+// by start time
+func (h *handlers) listOverrides(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := h.loadSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	overrides := schedule.Overrides
+	if overrides == nil {
+		overrides = []models.Override{}
+	}
+	respondJSON(w, http.StatusOK, overrides)
+}
+
+// Placeholder handlers - to be implemented
 func (h *handlers) listEscalationChains(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, []interface{}{})
 }
@@ -113,74 +525,722 @@ func (h *handlers) deleteEscalationChain(w http.ResponseWriter, r *http.Request)
 
 // Real implementation for Prometheus alerts
 func (h *handlers) receivePrometheusAlert(w http.ResponseWriter, r *http.Request) {
+	integration, ok := h.queryIntegration(w, r)
+	if !ok {
+		return
+	}
+	h.handlePrometheusWebhook(w, r, integration)
+}
+
+// handlePrometheusWebhook ingests an Alertmanager webhook received through
+// integration, which may be nil
+func (h *handlers) handlePrometheusWebhook(w http.ResponseWriter, r *http.Request, integration *models.Integration) {
 	var webhook PrometheusWebhook
-	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
-		slog.Error("failed to decode prometheus webhook", "error", err)
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+	webhookID, ok := h.decodeWebhook(w, r, SourcePrometheus, integration, &webhook)
+	if !ok {
 		return
 	}
 
-	slog.Info("received prometheus webhook",
+	slog.InfoContext(r.Context(), "received prometheus webhook",
 		"status", webhook.Status,
 		"alerts", len(webhook.Alerts))
 
-	alertGroups, err := h.alertProcessor.ProcessPrometheusWebhook(&webhook)
+	alertGroups, err := h.alertProcessor.ProcessPrometheusWebhookFor(r.Context(), integration, &webhook)
 	if err != nil {
-		slog.Error("failed to process alerts", "error", err)
+		slog.ErrorContext(r.Context(), "failed to process alerts", "error", err)
 		http.Error(w, "failed to process alerts", http.StatusInternalServerError)
 		return
 	}
 
-	slog.Info("processed alerts",
+	slog.InfoContext(r.Context(), "processed alerts",
 		"count", len(alertGroups),
 		"status", webhook.Status)
 
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"status":        "received",
-		"alerts_count":  len(alertGroups),
+	resp := map[string]interface{}{
+		"status":         "received",
+		"alerts_count":   len(alertGroups),
 		"webhook_status": webhook.Status,
-	})
+	}
+	if webhookID != 0 {
+		resp["webhook_id"] = webhookID
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// decodeWebhook decodes a webhook body into v. On failure it counts the
+// error, keeps the raw payload in the dead letter table if enabled and
+// responds 400, or 413 for a body over the size limit. When webhooks are
+// stored for replay it returns the stored payload's ID; integration, which
+// may be nil, is stored with it.
+func (h *handlers) decodeWebhook(w http.ResponseWriter, r *http.Request, source string, integration *models.Integration, v interface{}) (int64, bool) {
+	limit := h.maxWebhookBytes
+	if limit <= 0 {
+		limit = DefaultMaxWebhookBytes
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		webhookDecodeErrors.WithLabelValues(source).Inc()
+		slog.ErrorContext(r.Context(), "webhook body too large",
+			"source", source,
+			"remote_addr", r.RemoteAddr,
+			"limit", limit)
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return 0, false
+	}
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err == nil {
+		if !h.storeWebhooks {
+			return 0, true
+		}
+		var integrationID *int64
+		if integration != nil {
+			integrationID = &integration.ID
+		}
+		id, err := h.store.InsertWebhookPayload(r.Context(), source, integrationID, body)
+		if err != nil {
+			// Replay is a convenience; don't drop the alerts over it
+			slog.ErrorContext(r.Context(), "failed to store webhook payload", "source", source, "error", err)
+		}
+		return id, true
+	}
+
+	webhookDecodeErrors.WithLabelValues(source).Inc()
+	slog.ErrorContext(r.Context(), "failed to decode webhook",
+		"source", source,
+		"remote_addr", r.RemoteAddr,
+		"error", err)
+
+	if h.storeDeadLetters {
+		if dlErr := h.store.InsertDeadLetter(r.Context(), source, body, err.Error()); dlErr != nil {
+			slog.ErrorContext(r.Context(), "failed to store dead letter", "source", source, "error", dlErr)
+		}
+	}
+
+	http.Error(w, "invalid request body", http.StatusBadRequest)
+	return 0, false
 }
 
 func (h *handlers) receiveGrafanaAlert(w http.ResponseWriter, r *http.Request) {
-	// TODO: Parse Grafana alert webhook format
-	respondJSON(w, http.StatusOK, map[string]string{"status": "received"})
+	integration, ok := h.queryIntegration(w, r)
+	if !ok {
+		return
+	}
+	h.handleGrafanaWebhook(w, r, integration)
+}
+
+// handleGrafanaWebhook ingests a Grafana webhook received through
+// integration, which may be nil
+func (h *handlers) handleGrafanaWebhook(w http.ResponseWriter, r *http.Request, integration *models.Integration) {
+	var webhook GrafanaWebhook
+	webhookID, ok := h.decodeWebhook(w, r, SourceGrafana, integration, &webhook)
+	if !ok {
+		return
+	}
+
+	slog.InfoContext(r.Context(), "received grafana webhook",
+		"status", webhook.Status,
+		"receiver", webhook.Receiver,
+		"alerts", len(webhook.Alerts))
+
+	alertGroups, err := h.alertProcessor.ProcessGrafanaWebhookFor(r.Context(), integration, &webhook)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to process alerts", "error", err)
+		http.Error(w, "failed to process alerts", http.StatusInternalServerError)
+		return
+	}
+
+	firing, resolved := 0, 0
+	for _, alert := range alertGroups {
+		if alert.Status == "resolved" {
+			resolved++
+		} else {
+			firing++
+		}
+	}
+
+	slog.InfoContext(r.Context(), "processed alerts",
+		"count", len(alertGroups),
+		"firing", firing,
+		"resolved", resolved)
+
+	resp := map[string]interface{}{
+		"status":         "received",
+		"alerts_count":   len(alertGroups),
+		"firing_count":   firing,
+		"resolved_count": resolved,
+	}
+	if webhookID != 0 {
+		resp["webhook_id"] = webhookID
+	}
+	respondJSON(w, http.StatusOK, resp)
 }
 
+// reprocessWebhook replays a stored webhook payload through the current
+// processing, e.g. after fixing a routing rule
+func (h *handlers) reprocessWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "webhookId"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	stored, err := h.store.GetWebhookPayload(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load webhook payload", "id", id, "error", err)
+		http.Error(w, "failed to load webhook", http.StatusInternalServerError)
+		return
+	}
+	source := stored.Source
+
+	// Replay through the integration the webhook arrived on, so its alerts
+	// keep that integration's chain
+	var integration *models.Integration
+	if stored.IntegrationID != nil {
+		integration, err = h.store.GetIntegration(r.Context(), *stored.IntegrationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "the webhook's integration has been deleted", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to load integration", "id", *stored.IntegrationID, "error", err)
+			http.Error(w, "failed to load integration", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	alertGroups, err := h.alertProcessor.ReplayWebhook(r.Context(), source, integration, stored.Payload)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to reprocess webhook", "id", id, "source", source, "error", err)
+		http.Error(w, "failed to reprocess webhook", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "reprocessed webhook",
+		"id", id,
+		"source", source,
+		"count", len(alertGroups))
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"webhook_id":   id,
+		"source":       source,
+		"alerts_count": len(alertGroups),
+		"alerts":       alertGroups,
+	})
+}
+
+// receiveIntegrationAlert accepts alerts at an integration's own URL,
+// /alerts/integrations/{token}, in the format its type expects
+func (h *handlers) receiveIntegrationAlert(w http.ResponseWriter, r *http.Request) {
+	integration, err := h.store.GetIntegrationByToken(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "integration not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load integration", "error", err)
+		http.Error(w, "failed to load integration", http.StatusInternalServerError)
+		return
+	}
+
+	switch integration.Type {
+	case models.IntegrationPrometheus:
+		h.handlePrometheusWebhook(w, r, integration)
+	case models.IntegrationGrafana:
+		h.handleGrafanaWebhook(w, r, integration)
+	default:
+		h.receiveWebhookAlert(w, r)
+	}
+}
+
+// queryIntegration loads the integration named by the optional
+// integration_id query parameter, writing an error response if it can't.
+// It returns nil without one.
+func (h *handlers) queryIntegration(w http.ResponseWriter, r *http.Request) (*models.Integration, bool) {
+	v := r.URL.Query().Get("integration_id")
+	if v == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid integration_id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	integration, err := h.store.GetIntegration(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "integration not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load integration", "id", id, "error", err)
+		http.Error(w, "failed to load integration", http.StatusInternalServerError)
+		return nil, false
+	}
+	return integration, true
+}
+
+// receiveWebhookAlert answers generic webhooks, whose format isn't parsed
+// yet, with 501 so senders don't take them as delivered
 func (h *handlers) receiveWebhookAlert(w http.ResponseWriter, r *http.Request) {
 	// TODO: Parse generic webhook format
-	respondJSON(w, http.StatusOK, map[string]string{"status": "received"})
+	http.Error(w, "generic webhook alerts are not supported yet", http.StatusNotImplemented)
 }
 
 func (h *handlers) listAlerts(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, []interface{}{})
+	query := r.URL.Query()
+	filter := AlertFilter{
+		Status:   query.Get("status"),
+		Severity: query.Get("severity"),
+		SortBy:   query.Get("sort"),
+	}
+	if filter.SortBy != "" && filter.SortBy != "updated_at" && filter.SortBy != "firing_count" {
+		http.Error(w, "sort must be updated_at or firing_count", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("min_firing_count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid min_firing_count", http.StatusBadRequest)
+			return
+		}
+		filter.MinFiringCount = n
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	alerts, err := h.alertProcessor.ListAlerts(r.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list alerts", "error", err)
+		http.Error(w, "failed to list alerts", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, alerts)
 }
 
+// getAlert returns the stored alert. IDs that aren't integers can't name an
+// alert, so they get the same JSON 404 as unknown ones.
 func (h *handlers) getAlert(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{"id": chi.URLParam(r, "id")})
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "alert not found"})
+		return
+	}
+
+	alert, err := h.alertProcessor.GetAlert(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondJSON(w, http.StatusNotFound, map[string]string{"error": "alert not found"})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load alert", "id", id, "error", err)
+		http.Error(w, "failed to load alert", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, alert)
+}
+
+// getAlertHistory lists the alert's status changes, oldest first
+func (h *handlers) getAlertHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid alert id", http.StatusBadRequest)
+		return
+	}
+
+	alerts := h.store.Alerts()
+	if _, err := alerts.GetByID(r.Context(), id); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get alert", "id", id, "error", err)
+		http.Error(w, "failed to get alert", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := alerts.History(r.Context(), id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get alert history", "id", id, "error", err)
+		http.Error(w, "failed to get alert history", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, events)
+}
+
+// getRelatedAlerts lists alerts sharing at least min_shared labels (default
+// 2) with the alert and starting within window (default 1h) of it
+func (h *handlers) getRelatedAlerts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid alert id", http.StatusBadRequest)
+		return
+	}
+
+	minShared := 2
+	if v := r.URL.Query().Get("min_shared"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid min_shared", http.StatusBadRequest)
+			return
+		}
+		minShared = n
+	}
+
+	window := time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	related, err := h.alertProcessor.RelatedAlerts(r.Context(), id, minShared, window)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to find related alerts", "id", id, "error", err)
+		http.Error(w, "failed to find related alerts", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, related)
 }
 
+// maxNoteLength bounds the note a responder can attach to an ack
+const maxNoteLength = 4096
+
 func (h *handlers) acknowledgeAlert(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{"status": "acknowledged"})
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid alert id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Actor string `json:"actor"`
+		Note  string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	actor := r.Header.Get("X-User")
+	if actor == "" {
+		actor = req.Actor
+	}
+	if actor == "" {
+		http.Error(w, "actor is required (X-User header or actor field)", http.StatusBadRequest)
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+	if len(note) > maxNoteLength {
+		http.Error(w, fmt.Sprintf("note exceeds %d bytes", maxNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	alert, alertNote, err := h.alertProcessor.Acknowledge(r.Context(), id, actor, note)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrAlertResolved):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to acknowledge alert", "id", id, "error", err)
+		http.Error(w, "failed to acknowledge alert", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "alert acknowledged",
+		"alert", alert.Fingerprint,
+		"actor", actor,
+		"with_note", alertNote != nil)
+
+	resp := map[string]interface{}{"alert": alert}
+	if alertNote != nil {
+		resp["note"] = alertNote
+	}
+	respondJSON(w, http.StatusOK, resp)
 }
 
 func (h *handlers) resolveAlert(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{"status": "resolved"})
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid alert id", http.StatusBadRequest)
+		return
+	}
+
+	actor := r.Header.Get("X-User")
+	alert, err := h.alertProcessor.Resolve(r.Context(), id, actor)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to resolve alert", "id", id, "error", err)
+		http.Error(w, "failed to resolve alert", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "alert resolved",
+		"alert", alert.Fingerprint,
+		"actor", actor)
+	respondJSON(w, http.StatusOK, map[string]interface{}{"alert": alert})
+}
+
+// resolveAllAlerts resolves every active alert matching a label selector,
+// e.g. after a large incident or when decommissioning a cluster
+func (h *handlers) resolveAllAlerts(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Matcher string `json:"matcher"`
+		Actor   string `json:"actor"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	matchers, err := ParseMatchers(req.Matcher)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	actor := r.Header.Get("X-User")
+	if actor == "" {
+		actor = req.Actor
+	}
+	if actor == "" {
+		http.Error(w, "actor is required (X-User header or actor field)", http.StatusBadRequest)
+		return
+	}
+
+	resolved, err := h.alertProcessor.ResolveMatching(r.Context(), matchers, req.Matcher, actor)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to resolve alerts", "matcher", req.Matcher, "error", err)
+		http.Error(w, "failed to resolve alerts", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "resolved matching alerts",
+		"matcher", req.Matcher,
+		"actor", actor,
+		"count", len(resolved))
+
+	ids := make([]int64, len(resolved))
+	for i, alert := range resolved {
+		ids[i] = alert.ID
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"resolved": len(resolved),
+		"ids":      ids,
+	})
+}
+
+// maxBulkAlertIDs bounds the IDs one bulk acknowledge or resolve can list
+const maxBulkAlertIDs = 1000
+
+// bulkTransitionRequest selects alerts by IDs or by exact label values
+type bulkTransitionRequest struct {
+	IDs           []int64           `json:"ids,omitempty"`
+	LabelMatchers map[string]string `json:"label_matchers,omitempty"`
+	Actor         string            `json:"actor,omitempty"`
+}
+
+// bulkTransitionResponse reports the alerts a bulk action changed and the
+// requested IDs it skipped
+type bulkTransitionResponse struct {
+	Count   int     `json:"count"`
+	IDs     []int64 `json:"ids"`
+	Skipped []int64 `json:"skipped"`
+}
+
+// bulkTransition returns the handler that acknowledges or resolves many
+// alerts at once, for big incidents
+func (h *handlers) bulkTransition(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req bulkTransitionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		var sel AlertSelector
+		switch {
+		case len(req.IDs) > 0 && len(req.LabelMatchers) > 0:
+			http.Error(w, "set either ids or label_matchers, not both", http.StatusBadRequest)
+			return
+		case len(req.IDs) > maxBulkAlertIDs:
+			http.Error(w, fmt.Sprintf("at most %d ids can be given", maxBulkAlertIDs), http.StatusBadRequest)
+			return
+		case len(req.IDs) > 0:
+			sel.IDs = req.IDs
+		case len(req.LabelMatchers) > 0:
+			for name, value := range req.LabelMatchers {
+				sel.Matchers = append(sel.Matchers, LabelMatcher{Name: name, Op: "=", Value: value})
+			}
+		default:
+			http.Error(w, "ids or label_matchers is required", http.StatusBadRequest)
+			return
+		}
+
+		actor := r.Header.Get("X-User")
+		if actor == "" {
+			actor = req.Actor
+		}
+		if actor == "" && status == "acknowledged" {
+			http.Error(w, "actor is required (X-User header or actor field)", http.StatusBadRequest)
+			return
+		}
+
+		updated, skipped, err := h.alertProcessor.TransitionMany(r.Context(), sel, status, actor)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to update alerts", "status", status, "error", err)
+			http.Error(w, "failed to update alerts", http.StatusInternalServerError)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "bulk alert update",
+			"status", status,
+			"actor", actor,
+			"count", len(updated),
+			"skipped", len(skipped))
+
+		resp := bulkTransitionResponse{Count: len(updated), IDs: []int64{}, Skipped: []int64{}}
+		for _, alert := range updated {
+			resp.IDs = append(resp.IDs, alert.ID)
+		}
+		if skipped != nil {
+			resp.Skipped = skipped
+		}
+		respondJSON(w, http.StatusOK, resp)
+	}
 }
 
 func (h *handlers) listIntegrations(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, []interface{}{})
+	integrations, err := h.store.ListIntegrations(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list integrations", "error", err)
+		http.Error(w, "failed to list integrations", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, http.StatusOK, integrations)
 }
 
 func (h *handlers) createIntegration(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusCreated, map[string]string{"status": "created"})
+	var req struct {
+		Name              string            `json:"name"`
+		Type              string            `json:"type"`
+		Config            map[string]string `json:"config"`
+		EscalationChainID *int64            `json:"escalation_chain_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	switch req.Type {
+	case models.IntegrationPrometheus, models.IntegrationGrafana, models.IntegrationWebhook:
+	default:
+		http.Error(w, "type must be prometheus, grafana or webhook", http.StatusBadRequest)
+		return
+	}
+	if req.EscalationChainID != nil {
+		_, err := h.store.GetEscalationChain(r.Context(), *req.EscalationChainID)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, fmt.Sprintf("escalation chain %d does not exist", *req.EscalationChainID), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to load escalation chain", "id", *req.EscalationChainID, "error", err)
+			http.Error(w, "failed to create integration", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.Config == nil {
+		req.Config = map[string]string{}
+	}
+
+	integration := &models.Integration{
+		Name:              req.Name,
+		Type:              req.Type,
+		Config:            req.Config,
+		EscalationChainID: req.EscalationChainID,
+	}
+	if err := h.store.CreateIntegration(r.Context(), integration); err != nil {
+		slog.ErrorContext(r.Context(), "failed to create integration", "error", err)
+		http.Error(w, "failed to create integration", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, integration)
 }
 
 func (h *handlers) getIntegration(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, http.StatusOK, map[string]string{"id": chi.URLParam(r, "id")})
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid integration id", http.StatusBadRequest)
+		return
+	}
+
+	integration, err := h.store.GetIntegration(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "integration not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load integration", "id", id, "error", err)
+		http.Error(w, "failed to load integration", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, integration)
 }
 
 func (h *handlers) deleteIntegration(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid integration id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.DeleteIntegration(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "integration not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete integration", "id", id, "error", err)
+		http.Error(w, "failed to delete integration", http.StatusInternalServerError)
+		return
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -0,0 +1,1769 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/vjranagit/grafana/internal/oncall/escalation"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+	"github.com/vjranagit/grafana/internal/oncall/store"
+)
+
+func TestAlertHandlers_FiringCount(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	flap := map[string]string{"alertname": "Flapping"}
+	steady := map[string]string{"alertname": "Steady"}
+
+	deliveries := []PrometheusAlert{
+		{Status: "firing", Labels: steady, StartsAt: t0},
+		{Status: "firing", Labels: flap, StartsAt: t0},
+		{Status: "resolved", Labels: flap, StartsAt: t0, EndsAt: t0.Add(time.Minute)},
+		{Status: "firing", Labels: flap, StartsAt: t0.Add(time.Hour)},
+		{Status: "firing", Labels: steady, StartsAt: t0},
+	}
+	for _, alert := range deliveries {
+		if _, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{Alerts: []PrometheusAlert{alert}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/alerts?sort=firing_count", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var alerts []models.AlertGroup
+	if err := json.NewDecoder(rec.Body).Decode(&alerts); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(alerts))
+	}
+	if alerts[0].Summary != "Flapping" || alerts[0].FiringCount != 2 {
+		t.Errorf("expected noisiest alert Flapping with count 2 first, got %s with %d",
+			alerts[0].Summary, alerts[0].FiringCount)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/alerts?min_firing_count=2", nil))
+	alerts = nil
+	json.NewDecoder(rec.Body).Decode(&alerts)
+	if len(alerts) != 1 || alerts[0].Summary != "Flapping" {
+		t.Errorf("expected only Flapping with min_firing_count=2, got %v", alerts)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/alerts/%d", alerts[0].ID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var detail models.AlertGroup
+	json.NewDecoder(rec.Body).Decode(&detail)
+	if detail.FiringCount != 2 {
+		t.Errorf("expected firing count 2 in detail, got %d", detail.FiringCount)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/alerts?sort=bogus", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown sort, got %d", rec.Code)
+	}
+}
+
+func TestGetAlert(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{{
+			Status:      "firing",
+			Labels:      map[string]string{"alertname": "DiskFull", "severity": "critical", "instance": "db-1"},
+			Annotations: map[string]string{"summary": "Disk almost full", "runbook_url": "https://runbooks.example.com/disk"},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := alerts[0].ID
+	if _, _, err := processor.Acknowledge(context.Background(), id, "alice", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/alerts/%d", id), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var alert models.AlertGroup
+	if err := json.NewDecoder(rec.Body).Decode(&alert); err != nil {
+		t.Fatal(err)
+	}
+
+	if alert.ID != id || alert.Status != "acknowledged" || alert.Severity != "critical" {
+		t.Errorf("unexpected alert %+v", alert)
+	}
+	wantLabels := map[string]string{"alertname": "DiskFull", "severity": "critical", "instance": "db-1"}
+	if !reflect.DeepEqual(alert.Labels, wantLabels) {
+		t.Errorf("expected labels %v, got %v", wantLabels, alert.Labels)
+	}
+	if alert.Annotations["runbook_url"] != "https://runbooks.example.com/disk" || alert.Summary != "Disk almost full" {
+		t.Errorf("unexpected annotations %v (summary %q)", alert.Annotations, alert.Summary)
+	}
+	if alert.AcknowledgedBy == nil || *alert.AcknowledgedBy != "alice" || alert.AcknowledgedAt == nil {
+		t.Errorf("expected acknowledgement by alice, got %v at %v", alert.AcknowledgedBy, alert.AcknowledgedAt)
+	}
+	if alert.ResolvedAt != nil {
+		t.Errorf("expected no resolution time, got %v", alert.ResolvedAt)
+	}
+
+	for _, path := range []string{"/alerts/999", "/alerts/abc"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var body map[string]string
+		if rec.Code != http.StatusNotFound || json.NewDecoder(rec.Body).Decode(&body) != nil || body["error"] == "" {
+			t.Errorf("%s: expected 404 with a JSON error, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestScheduleHandlers_Timezone(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	tests := []struct {
+		name       string
+		timezone   string
+		expectCode int
+		expectTZ   string
+	}{
+		{name: "valid zone", timezone: "America/New_York", expectCode: http.StatusCreated, expectTZ: "America/New_York"},
+		{name: "alias is normalized", timezone: "US/Pacific", expectCode: http.StatusCreated, expectTZ: "America/Los_Angeles"},
+		{name: "unknown zone", timezone: "Mars/Phobos", expectCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"name": "Platform", "timezone": %q}`, tt.timezone)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("POST", "/schedules", strings.NewReader(body)))
+
+			if rec.Code != tt.expectCode {
+				t.Fatalf("expected %d, got %d: %s", tt.expectCode, rec.Code, rec.Body.String())
+			}
+			if tt.expectCode != http.StatusCreated {
+				return
+			}
+
+			var schedule models.Schedule
+			json.NewDecoder(rec.Body).Decode(&schedule)
+			if schedule.ID == 0 {
+				t.Error("expected schedule to be stored with an ID")
+			}
+			if schedule.Timezone != tt.expectTZ {
+				t.Errorf("expected timezone %q, got %q", tt.expectTZ, schedule.Timezone)
+			}
+		})
+	}
+
+	// Updates are validated too
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("PUT", "/schedules/1",
+		strings.NewReader(`{"name": "Platform", "timezone": "Mars/Phobos"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 updating to unknown zone, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("PUT", "/schedules/1",
+		strings.NewReader(`{"name": "Platform", "timezone": "Europe/London"}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 updating to valid zone, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("PUT", "/schedules/999",
+		strings.NewReader(`{"name": "Missing", "timezone": "UTC"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 updating unknown schedule, got %d", rec.Code)
+	}
+}
+
+func TestScheduleHandlers_Validation(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/schedules", strings.NewReader(`{"name": "Platform", "timezone": "UTC"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	invalid := `{
+		"name": "Platform",
+		"timezone": "Mars/Phobos",
+		"layers": [{"name": "Nights", "rotation_type": "custom", "rotation_start": "2024-01-01T09:00:00Z",
+			"users": ["alice", "alice"]}]
+	}`
+	for _, req := range []struct{ method, path string }{{"POST", "/schedules"}, {"PUT", "/schedules/1"}} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(req.method, req.path, strings.NewReader(invalid)))
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: expected 400, got %d: %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+
+		var resp struct {
+			Error  string              `json:"error"`
+			Fields []models.FieldError `json:"fields"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		var fields []string
+		for _, f := range resp.Fields {
+			fields = append(fields, f.Field)
+		}
+		want := []string{"timezone", "layers[0].duration_hours", "layers[0].users[1]"}
+		if resp.Error == "" || !reflect.DeepEqual(fields, want) {
+			t.Errorf("%s %s: expected errors for %v, got %+v", req.method, req.path, want, resp)
+		}
+	}
+
+	// The rejected update left the schedule alone
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/schedules/1", nil))
+	var schedule models.Schedule
+	json.NewDecoder(rec.Body).Decode(&schedule)
+	if schedule.Timezone != "UTC" || len(schedule.Layers) != 0 {
+		t.Errorf("expected the schedule unchanged, got %+v", schedule)
+	}
+}
+
+func TestScheduleHandlers_CRUD(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/schedules", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Fatalf("expected an empty list, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/schedules", strings.NewReader(`{
+		"name": "Platform",
+		"timezone": "UTC",
+		"layers": [{"name": "Week", "rotation_type": "weekly", "rotation_start": "2024-01-01T09:00:00Z",
+			"duration_hours": 168, "users": ["alice", "bob"]}]
+	}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created models.Schedule
+	json.NewDecoder(rec.Body).Decode(&created)
+	if created.ID == 0 || len(created.Layers) != 1 || created.Layers[0].ID == 0 {
+		t.Fatalf("expected the schedule and layer stored with IDs, got %+v", created)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/schedules", nil))
+	var listed []models.Schedule
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].ID != created.ID || len(listed[0].Layers) != 1 ||
+		!reflect.DeepEqual(listed[0].Layers[0].Users, []string{"alice", "bob"}) {
+		t.Errorf("unexpected list %+v", listed)
+	}
+
+	path := fmt.Sprintf("/schedules/%d", created.ID)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("DELETE", path, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", path, nil),
+		httptest.NewRequest("DELETE", path, nil),
+	} {
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404 after delete, got %d", req.Method, path, rec.Code)
+		}
+	}
+}
+
+func TestResolveAllAlerts(t *testing.T) {
+	st := newTestStore(t)
+	dispatcher := &dispatchRecorder{}
+	router := NewRouterWithDispatcher(st, dispatcher)
+	processor := NewAlertProcessor(st)
+
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{
+			{Status: "firing", Labels: map[string]string{"alertname": "A", "cluster": "staging"}},
+			{Status: "firing", Labels: map[string]string{"alertname": "B", "cluster": "staging"}},
+			{Status: "firing", Labels: map[string]string{"alertname": "C", "cluster": "production"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/alerts/resolve-all",
+		strings.NewReader(`{"matcher": "{cluster=\"staging\"}"}`))
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Resolved int `json:"resolved"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Resolved != 2 {
+		t.Errorf("expected 2 alerts resolved, got %d", resp.Resolved)
+	}
+
+	// Their escalations stop and send resolve notifications
+	resolved := append([]int64(nil), dispatcher.resolved...)
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i] < resolved[j] })
+	if want := []int64{alerts[0].ID, alerts[1].ID}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("expected the dispatcher to resolve %v, got %v", want, resolved)
+	}
+
+	statuses := map[string]string{}
+	rows, err := st.DB().Query(`SELECT summary, status FROM alert_groups`)
+	if err != nil {
+		t.Fatalf("failed to query alerts: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var summary, status string
+		rows.Scan(&summary, &status)
+		statuses[summary] = status
+	}
+	expected := map[string]string{"A": "resolved", "B": "resolved", "C": "firing"}
+	for name, status := range expected {
+		if statuses[name] != status {
+			t.Errorf("expected alert %s to be %s, got %s", name, status, statuses[name])
+		}
+	}
+
+	var actor, details string
+	err = st.DB().QueryRow(`SELECT actor, details FROM audit_log WHERE action = 'alerts.resolve_all'`).
+		Scan(&actor, &details)
+	if err != nil {
+		t.Fatalf("expected audit entry: %v", err)
+	}
+	if actor != "alice" || !strings.Contains(details, `"count":2`) {
+		t.Errorf("unexpected audit entry actor=%s details=%s", actor, details)
+	}
+}
+
+func TestResolveAllAlerts_Validation(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	for name, body := range map[string]string{
+		"bad matcher": `{"matcher": "cluster", "actor": "alice"}`,
+		"no actor":    `{"matcher": "{cluster=\"staging\"}"}`,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/resolve-all", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+}
+
+// alertIDs maps the alerts' summaries to their IDs
+func alertIDs(t *testing.T, st *store.Store) map[string]int64 {
+	t.Helper()
+	alerts, err := st.Alerts().List(context.Background(), store.AlertFilter{Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]int64{}
+	for _, alert := range alerts {
+		ids[alert.Summary] = alert.ID
+	}
+	return ids
+}
+
+func postBulk(t *testing.T, router http.Handler, path, body string) bulkTransitionResponse {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp bulkTransitionResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestBulkTransition_IDs(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	_, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{
+			{Status: "firing", Labels: map[string]string{"alertname": "A"}},
+			{Status: "firing", Labels: map[string]string{"alertname": "B"}},
+			{Status: "firing", Labels: map[string]string{"alertname": "C"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := alertIDs(t, st)
+	if _, err := processor.Resolve(context.Background(), ids["C"], ""); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := postBulk(t, router, "/alerts/acknowledge",
+		fmt.Sprintf(`{"ids": [%d, %d, %d]}`, ids["A"], ids["B"], ids["C"]))
+	if resp.Count != 2 || !reflect.DeepEqual(resp.IDs, []int64{ids["A"], ids["B"]}) {
+		t.Errorf("expected A and B acknowledged, got %+v", resp)
+	}
+	if !reflect.DeepEqual(resp.Skipped, []int64{ids["C"]}) {
+		t.Errorf("expected the resolved alert skipped, got %v", resp.Skipped)
+	}
+	for _, name := range []string{"A", "B"} {
+		alert, _ := st.Alerts().GetByID(context.Background(), ids[name])
+		if alert.Status != "acknowledged" || *alert.AcknowledgedBy != "alice" {
+			t.Errorf("expected %s acknowledged by alice, got %+v", name, alert)
+		}
+	}
+
+	resp = postBulk(t, router, "/alerts/resolve", fmt.Sprintf(`{"ids": [%d]}`, ids["A"]))
+	if resp.Count != 1 || len(resp.Skipped) != 0 {
+		t.Errorf("expected A resolved, got %+v", resp)
+	}
+	if status, _ := st.AlertStatus(context.Background(), ids["A"]); status != "resolved" {
+		t.Errorf("expected A resolved, got %s", status)
+	}
+
+	var count int
+	st.DB().QueryRow(`SELECT COUNT(*) FROM audit_log WHERE action LIKE 'alerts.bulk_%'`).Scan(&count)
+	if count != 2 {
+		t.Errorf("expected an audit entry per bulk action, got %d", count)
+	}
+}
+
+func TestBulkTransition_LabelMatchers(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	_, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{
+			{Status: "firing", Labels: map[string]string{"alertname": "A", "cluster": "staging", "team": "db"}},
+			{Status: "firing", Labels: map[string]string{"alertname": "B", "cluster": "staging", "team": "web"}},
+			{Status: "firing", Labels: map[string]string{"alertname": "C", "cluster": "production", "team": "db"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := alertIDs(t, st)
+
+	resp := postBulk(t, router, "/alerts/resolve", `{"label_matchers": {"cluster": "staging", "team": "db"}}`)
+	if resp.Count != 1 || !reflect.DeepEqual(resp.IDs, []int64{ids["A"]}) {
+		t.Errorf("expected only A resolved, got %+v", resp)
+	}
+
+	resp = postBulk(t, router, "/alerts/acknowledge", `{"label_matchers": {"cluster": "staging"}}`)
+	if resp.Count != 1 || !reflect.DeepEqual(resp.IDs, []int64{ids["B"]}) {
+		t.Errorf("expected only B acknowledged, the resolved A left alone, got %+v", resp)
+	}
+	if status, _ := st.AlertStatus(context.Background(), ids["C"]); status != "firing" {
+		t.Errorf("expected C to stay firing, got %s", status)
+	}
+}
+
+func TestBulkTransition_Validation(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	for name, tc := range map[string]struct{ path, body string }{
+		"no selector":    {"/alerts/resolve", `{"actor": "alice"}`},
+		"both selectors": {"/alerts/resolve", `{"ids": [1], "label_matchers": {"team": "db"}, "actor": "alice"}`},
+		"no actor":       {"/alerts/acknowledge", `{"ids": [1]}`},
+		"bad body":       {"/alerts/acknowledge", `[1, 2]`},
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", tc.path, strings.NewReader(tc.body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rec.Code)
+		}
+	}
+}
+
+func TestReceivePrometheusAlert_DecodeFailure(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouterWithOptions(st, RouterOptions{StoreDeadLetters: true})
+
+	counter := webhookDecodeErrors.WithLabelValues("prometheus")
+	before := counterValue(t, counter)
+
+	payload := `{"status": "firing", "alerts": [` + strings.Repeat("x", store.MaxDeadLetterPayload)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/prometheus", strings.NewReader(payload)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	if got := counterValue(t, counter); got != before+1 {
+		t.Errorf("expected decode error counter to increment to %v, got %v", before+1, got)
+	}
+
+	var source, stored, reason string
+	err := st.DB().QueryRow(`SELECT source, payload, error FROM dead_letter`).Scan(&source, &stored, &reason)
+	if err != nil {
+		t.Fatalf("expected dead letter row: %v", err)
+	}
+	if source != "prometheus" || reason == "" {
+		t.Errorf("unexpected dead letter row: source=%q error=%q", source, reason)
+	}
+	if len(stored) != store.MaxDeadLetterPayload || !strings.HasPrefix(payload, stored) {
+		t.Errorf("expected payload truncated to %d bytes, got %d", store.MaxDeadLetterPayload, len(stored))
+	}
+}
+
+func TestReceivePrometheusAlert_NoDeadLettersByDefault(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/prometheus", strings.NewReader(`{"status": `)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	var count int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM dead_letter`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no dead letters unless enabled, got %d", count)
+	}
+}
+
+func TestReceivePrometheusAlert_BodyTooLarge(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouterWithOptions(st, RouterOptions{StoreDeadLetters: true, MaxWebhookBytes: 64})
+
+	payload := `{"status": "firing", "alerts": [{"labels": {"alertname": "` + strings.Repeat("x", 100) + `"}}]}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/prometheus", strings.NewReader(payload)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", rec.Code)
+	}
+
+	var count int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM alert_groups`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected the oversized webhook to be dropped, got %d alerts", count)
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("failed to read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestGetCurrentOnCall_Handoffs(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	schedule := &models.Schedule{
+		Name:     "Platform",
+		Timezone: "Europe/Berlin",
+		Layers: []models.Layer{
+			// Weekday business hours in Berlin, ahead of the daily rotation
+			{Name: "office", RotationType: "weekly", RotationStart: start, Users: []string{"olga"},
+				Restrictions: []models.Restriction{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}}},
+			{Name: "daily", RotationType: "daily", RotationStart: start, Users: []string{"alice", "bob", "carol"}},
+		},
+	}
+	if err := st.CreateSchedule(context.Background(), schedule); err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	office, daily := schedule.Layers[0].ID, schedule.Layers[1].ID
+
+	type response struct {
+		ScheduleID  int64      `json:"schedule_id"`
+		User        string     `json:"oncall_user"`
+		LayerID     *int64     `json:"layer_id"`
+		NextHandoff *time.Time `json:"next_handoff"`
+	}
+	get := func(path string) (int, response) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var resp response
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	tests := []struct {
+		at          string
+		user        string
+		layer       int64
+		nextHandoff string
+	}{
+		// Saturday: no office hours, sixth day of the rotation
+		{"2024-01-06T12:00:00Z", "carol", daily, "2024-01-07T09:00:00Z"},
+		// Monday 10:00 Berlin is 09:00 UTC; office hours end 17:00 Berlin
+		{"2024-01-08T09:00:00Z", "olga", office, "2024-01-08T16:00:00Z"},
+		// Monday evening falls back to the rotation until the 09:00 UTC handoff
+		{"2024-01-08T20:00:00Z", "bob", daily, "2024-01-09T08:00:00Z"},
+	}
+	for _, tt := range tests {
+		code, resp := get(fmt.Sprintf("/schedules/%d/oncall?at=%s", schedule.ID, tt.at))
+		if code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.at, code)
+		}
+		if resp.ScheduleID != schedule.ID || resp.User != tt.user {
+			t.Errorf("%s: expected %s on call, got %+v", tt.at, tt.user, resp)
+		}
+		if resp.LayerID == nil || *resp.LayerID != tt.layer {
+			t.Errorf("%s: expected layer %d, got %v", tt.at, tt.layer, resp.LayerID)
+		}
+		want, _ := time.Parse(time.RFC3339, tt.nextHandoff)
+		if resp.NextHandoff == nil || !resp.NextHandoff.Equal(want) {
+			t.Errorf("%s: expected next handoff %s, got %v", tt.at, tt.nextHandoff, resp.NextHandoff)
+		}
+	}
+
+	if code, _ := get("/schedules/999/oncall"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown schedule, got %d", code)
+	}
+
+	empty := &models.Schedule{Name: "Empty", Timezone: "UTC"}
+	if err := st.CreateSchedule(context.Background(), empty); err != nil {
+		t.Fatal(err)
+	}
+	code, resp := get(fmt.Sprintf("/schedules/%d/oncall", empty.ID))
+	if code != http.StatusOK || resp.User != "" || resp.LayerID != nil || resp.NextHandoff != nil {
+		t.Errorf("expected 200 with nobody on call, got %d %+v", code, resp)
+	}
+}
+
+func TestGetCurrentOnCall_FutureOverride(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	now := time.Now().UTC()
+	schedule := &models.Schedule{
+		Name:     "Platform",
+		Timezone: "UTC",
+		Layers: []models.Layer{
+			{Name: "primary", RotationType: "weekly", RotationStart: now.AddDate(0, -1, 0), Users: []string{"alice"}},
+		},
+	}
+	if err := st.CreateSchedule(context.Background(), schedule); err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+
+	vacationStart := now.AddDate(0, 0, 7).Truncate(time.Hour)
+	body := fmt.Sprintf(`{"user": "bob", "start": %q, "end": %q}`,
+		vacationStart.Format(time.RFC3339), vacationStart.Add(24*time.Hour).Format(time.RFC3339))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", fmt.Sprintf("/schedules/%d/overrides", schedule.ID), strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	oncall := func(query string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/schedules/%d/oncall%s", schedule.ID, query), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			User string `json:"oncall_user"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp.User
+	}
+
+	if got := oncall(""); got != "alice" {
+		t.Errorf("expected alice on call now, got %q", got)
+	}
+	if got := oncall("?at=" + vacationStart.Add(time.Hour).Format(time.RFC3339)); got != "bob" {
+		t.Errorf("expected override user bob during the future override, got %q", got)
+	}
+	if got := oncall("?at=" + vacationStart.Add(48*time.Hour).Format(time.RFC3339)); got != "alice" {
+		t.Errorf("expected alice after the override ends, got %q", got)
+	}
+}
+
+func TestGetCurrentOnCall_Roles(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	body := fmt.Sprintf(`{"name": "Platform", "timezone": "UTC", "layers": [
+		{"name": "primary", "rotation_type": "weekly", "rotation_start": %q, "users": ["alice"]},
+		{"name": "shadow", "rotation_type": "weekly", "rotation_start": %q, "users": ["bob"], "role": "secondary"}
+	]}`, start.Format(time.RFC3339), start.Format(time.RFC3339))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/schedules", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var schedule models.Schedule
+	if err := json.NewDecoder(rec.Body).Decode(&schedule); err != nil {
+		t.Fatal(err)
+	}
+	if schedule.Layers[0].Role != models.RolePrimary {
+		t.Errorf("expected an unset role to default to primary, got %q", schedule.Layers[0].Role)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/schedules/%d/oncall?at=2024-01-03T12:00:00Z", schedule.ID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		User   string            `json:"oncall_user"`
+		OnCall map[string]string `json:"oncall"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := map[string]string{"primary": "alice", "secondary": "bob"}
+	if resp.User != "alice" || !reflect.DeepEqual(resp.OnCall, want) {
+		t.Errorf("expected alice as primary and %v by role, got %+v", want, resp)
+	}
+
+	invalid := `{"name": "Bad", "timezone": "UTC", "layers": [{"name": "x", "rotation_type": "daily", "users": ["a"], "role": "tertiary"}]}`
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/schedules", strings.NewReader(invalid)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid role") {
+		t.Errorf("expected 400 for an unknown role, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListOverrides(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	schedule := &models.Schedule{Name: "Platform", Timezone: "UTC"}
+	if err := st.CreateSchedule(context.Background(), schedule); err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	path := fmt.Sprintf("/schedules/%d/overrides", schedule.ID)
+
+	list := func() []models.Override {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var overrides []models.Override
+		if err := json.NewDecoder(rec.Body).Decode(&overrides); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return overrides
+	}
+
+	if overrides := list(); overrides == nil || len(overrides) != 0 {
+		t.Errorf("expected an empty list, got %v", overrides)
+	}
+
+	for _, body := range []string{
+		`{"user": "carol", "start": "2030-01-10T00:00:00Z", "end": "2030-01-11T00:00:00Z"}`,
+		`{"user": "bob", "start": "2030-01-01T00:00:00Z", "end": "2030-01-02T00:00:00Z"}`,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	overrides := list()
+	if len(overrides) != 2 || overrides[0].User != "bob" || overrides[1].User != "carol" {
+		t.Errorf("expected overrides for bob then carol, got %+v", overrides)
+	}
+	if overrides[0].ScheduleID != schedule.ID || overrides[0].ID == 0 {
+		t.Errorf("expected stored override IDs, got %+v", overrides[0])
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/schedules/99/overrides", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown schedule, got %d", rec.Code)
+	}
+}
+
+func TestGetUpcomingOnCall(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	start := time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	schedule := &models.Schedule{
+		Name:     "Platform",
+		Timezone: "UTC",
+		Layers: []models.Layer{
+			{Name: "primary", RotationType: "weekly", RotationStart: start, Users: []string{"alice", "bob", "carol"}},
+		},
+	}
+	empty := &models.Schedule{Name: "Empty", Timezone: "UTC"}
+	for _, s := range []*models.Schedule{schedule, empty} {
+		if err := st.CreateSchedule(context.Background(), s); err != nil {
+			t.Fatalf("failed to create schedule: %v", err)
+		}
+	}
+
+	upcoming := func(id int64, query string) (int, []models.OnCallShift) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/schedules/%d/oncall/upcoming%s", id, query), nil))
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+		var resp struct {
+			Shifts []models.OnCallShift `json:"shifts"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return rec.Code, resp.Shifts
+	}
+
+	// From mid-week, 21 days cover the rest of bob's week, carol's and
+	// alice's, and the start of bob's next one
+	from := start.AddDate(0, 0, 10)
+	_, shifts := upcoming(schedule.ID, "?days=21&from="+from.Format(time.RFC3339))
+	expected := []struct {
+		user       string
+		start, end time.Time
+	}{
+		{"bob", from, start.AddDate(0, 0, 14)},
+		{"carol", start.AddDate(0, 0, 14), start.AddDate(0, 0, 21)},
+		{"alice", start.AddDate(0, 0, 21), start.AddDate(0, 0, 28)},
+		{"bob", start.AddDate(0, 0, 28), from.AddDate(0, 0, 21)},
+	}
+	if len(shifts) != len(expected) {
+		t.Fatalf("expected %d shifts, got %+v", len(expected), shifts)
+	}
+	for i, want := range expected {
+		got := shifts[i]
+		if got.User != want.user || !got.Start.Equal(want.start) || !got.End.Equal(want.end) {
+			t.Errorf("shift %d: expected %s %s-%s, got %s %s-%s", i, want.user, want.start, want.end, got.User, got.Start, got.End)
+		}
+		if got.LayerID == nil || *got.LayerID != schedule.Layers[0].ID {
+			t.Errorf("shift %d: expected layer %d, got %v", i, schedule.Layers[0].ID, got.LayerID)
+		}
+	}
+
+	if code, shifts := upcoming(empty.ID, ""); code != http.StatusOK || shifts == nil || len(shifts) != 0 {
+		t.Errorf("expected an empty list for an empty schedule, got %d %v", code, shifts)
+	}
+	for _, query := range []string{"?days=0", "?days=91", "?days=two", "?from=tomorrow"} {
+		if code, _ := upcoming(schedule.ID, query); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, code)
+		}
+	}
+	if code, _ := upcoming(99, ""); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown schedule, got %d", code)
+	}
+}
+
+func TestOverrideHandlers_Validation(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"unknown schedule", "/schedules/99/overrides", `{"user": "bob", "start": "2030-01-01T00:00:00Z", "end": "2030-01-02T00:00:00Z"}`, http.StatusNotFound},
+		{"missing user", "/schedules/1/overrides", `{"start": "2030-01-01T00:00:00Z", "end": "2030-01-02T00:00:00Z"}`, http.StatusBadRequest},
+		{"end before start", "/schedules/1/overrides", `{"user": "bob", "start": "2030-01-02T00:00:00Z", "end": "2030-01-01T00:00:00Z"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.want {
+				t.Errorf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/schedules/1/oncall?at=tomorrow", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid at, got %d", rec.Code)
+	}
+}
+
+func TestGetCoverageGaps(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	restricted := &models.Schedule{
+		Name: "Business hours",
+		Layers: []models.Layer{{
+			Name: "primary", RotationType: "daily", RotationStart: start, Users: []string{"alice"},
+			Restrictions: []models.Restriction{{Start: "09:00", End: "17:00"}},
+		}},
+	}
+	covered := &models.Schedule{
+		Name:   "24x7",
+		Layers: []models.Layer{{Name: "primary", RotationType: "daily", RotationStart: start, Users: []string{"bob"}}},
+	}
+	for _, s := range []*models.Schedule{restricted, covered} {
+		if err := st.CreateSchedule(context.Background(), s); err != nil {
+			t.Fatalf("failed to create schedule: %v", err)
+		}
+	}
+
+	gaps := func(id int64) []models.Shift {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		url := fmt.Sprintf("/schedules/%d/gaps?from=2024-03-04T00:00:00Z&to=2024-03-05T00:00:00Z", id)
+		router.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Gaps []models.Shift `json:"gaps"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp.Gaps
+	}
+
+	got := gaps(restricted.ID)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 gaps around business hours, got %v", got)
+	}
+	if !got[0].End.Equal(start.Add(9*time.Hour)) || !got[1].Start.Equal(start.Add(17*time.Hour)) {
+		t.Errorf("unexpected gaps %v", got)
+	}
+
+	if got := gaps(covered.ID); len(got) != 0 {
+		t.Errorf("expected no gaps for fully covered schedule, got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/schedules/%d/gaps?from=2024-03-05T00:00:00Z&to=2024-03-04T00:00:00Z", covered.ID), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for inverted range, got %d", rec.Code)
+	}
+}
+
+func TestGetRelatedAlerts(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	t0 := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	alerts := []PrometheusAlert{
+		{Status: "firing", StartsAt: t0, Labels: map[string]string{
+			"alertname": "HighLatency", "cluster": "prod", "namespace": "checkout", "service": "api"}},
+		// Three shared labels
+		{Status: "firing", StartsAt: t0.Add(5 * time.Minute), Labels: map[string]string{
+			"alertname": "HighErrorRate", "cluster": "prod", "namespace": "checkout", "service": "api"}},
+		// Two shared labels
+		{Status: "firing", StartsAt: t0.Add(10 * time.Minute), Labels: map[string]string{
+			"alertname": "PodRestarts", "cluster": "prod", "namespace": "checkout", "service": "worker"}},
+		// One shared label, below the threshold
+		{Status: "firing", StartsAt: t0.Add(time.Minute), Labels: map[string]string{
+			"alertname": "DiskFull", "cluster": "prod", "namespace": "storage"}},
+		// Shares everything but starts outside the window
+		{Status: "firing", StartsAt: t0.Add(3 * time.Hour), Labels: map[string]string{
+			"alertname": "HighLatency", "cluster": "prod", "namespace": "checkout", "service": "web"}},
+	}
+	if _, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{Alerts: alerts}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/alerts/1/related?min_shared=2&window=1h", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var related []struct {
+		models.AlertGroup
+		SharedLabels int `json:"shared_labels"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&related); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if len(related) != 2 {
+		t.Fatalf("expected 2 related alerts, got %d", len(related))
+	}
+	if related[0].Labels["alertname"] != "HighErrorRate" || related[0].SharedLabels != 3 {
+		t.Errorf("expected HighErrorRate with 3 shared labels first, got %s with %d",
+			related[0].Labels["alertname"], related[0].SharedLabels)
+	}
+	if related[1].Labels["alertname"] != "PodRestarts" || related[1].SharedLabels != 2 {
+		t.Errorf("expected PodRestarts with 2 shared labels second, got %s with %d",
+			related[1].Labels["alertname"], related[1].SharedLabels)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/alerts/999/related", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown alert, got %d", rec.Code)
+	}
+}
+
+func TestReceiveGrafanaAlert_MixedStatuses(t *testing.T) {
+	st := newTestStore(t)
+
+	slack := &recordingNotifier{}
+	manager := notifier.NewManager()
+	manager.Register(slack)
+
+	chain := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#incidents"},
+	}}
+	dispatcher := escalation.NewDispatcher(escalation.NewRouter(nil, chain), escalation.NewEngine(manager, st))
+	defer dispatcher.Close()
+
+	router := NewRouterWithDispatcher(st, dispatcher)
+	post := func(body string) map[string]interface{} {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/grafana", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	post(`{"receiver": "oncall", "status": "firing", "alerts": [
+		{"status": "firing", "labels": {"alertname": "DiskFull", "instance": "db1"}, "startsAt": "2024-01-01T10:00:00Z"},
+		{"status": "firing", "labels": {"alertname": "DiskFull", "instance": "db2"}, "startsAt": "2024-01-01T10:00:00Z"}
+	]}`)
+	waitUntil(t, func() bool { return len(slack.recipients()) == 2 })
+
+	// db1 recovers, db2 keeps firing and db3 is new. The db3 alert has no
+	// status of its own and takes the group's.
+	resp := post(`{"receiver": "oncall", "status": "firing", "alerts": [
+		{"status": "resolved", "labels": {"alertname": "DiskFull", "instance": "db1"}, "startsAt": "2024-01-01T10:00:00Z", "endsAt": "2024-01-01T10:30:00Z"},
+		{"status": "firing", "labels": {"alertname": "DiskFull", "instance": "db2"}, "startsAt": "2024-01-01T10:00:00Z"},
+		{"labels": {"alertname": "DiskFull", "instance": "db3"}, "startsAt": "2024-01-01T10:20:00Z"}
+	]}`)
+	if resp["firing_count"] != float64(2) || resp["resolved_count"] != float64(1) {
+		t.Errorf("expected 2 firing and 1 resolved, got %v", resp)
+	}
+
+	processor := NewAlertProcessor(st)
+	want := map[string]string{"db1": "resolved", "db2": "firing", "db3": "firing"}
+	alerts, err := processor.ListAlerts(context.Background(), AlertFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != len(want) {
+		t.Fatalf("expected %d alerts, got %d", len(want), len(alerts))
+	}
+	for _, alert := range alerts {
+		instance := alert.Labels["instance"]
+		if alert.Status != want[instance] {
+			t.Errorf("%s: expected %s, got %s", instance, want[instance], alert.Status)
+		}
+		if instance == "db1" && (alert.EndsAt == nil || !alert.EndsAt.Equal(time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))) {
+			t.Errorf("db1: expected ends_at from payload, got %v", alert.EndsAt)
+		}
+	}
+
+	// db3 pages, db1 sends a resolve notice and db2 stays quiet
+	waitUntil(t, func() bool { return len(slack.recipients()) == 4 })
+	time.Sleep(50 * time.Millisecond)
+
+	slack.mu.Lock()
+	defer slack.mu.Unlock()
+	if len(slack.sent) != 4 {
+		t.Fatalf("expected 4 notifications, got %d", len(slack.sent))
+	}
+	var resolved []string
+	for _, alert := range slack.sent[2:] {
+		if alert.Status == "resolved" {
+			resolved = append(resolved, alert.Labels["instance"])
+		}
+	}
+	if len(resolved) != 1 || resolved[0] != "db1" {
+		t.Errorf("expected a resolve notification for db1 only, got %v", resolved)
+	}
+}
+
+func TestReceiveGrafanaAlert_ResolvedGroup(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	post := func(body string) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/grafana", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	post(`{"status": "firing", "alerts": [{"labels": {"alertname": "HighLatency"}, "startsAt": "2024-01-01T10:00:00Z"}]}`)
+	post(`{"status": "resolved", "alerts": [{"labels": {"alertname": "HighLatency"}, "startsAt": "2024-01-01T10:00:00Z"}]}`)
+
+	alerts, err := NewAlertProcessor(st).ListAlerts(context.Background(), AlertFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Status != "resolved" {
+		t.Fatalf("expected the alert resolved, got %+v", alerts)
+	}
+	if alerts[0].EndsAt == nil {
+		t.Error("expected ends_at to default when Grafana omits it")
+	}
+}
+
+func TestAcknowledgeAlert_WithNote(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := alerts[0].ID
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/acknowledge", id),
+		strings.NewReader(`{"note": "  Looking into it, disk cleanup running  "}`))
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Alert models.AlertGroup `json:"alert"`
+		Note  models.AlertNote  `json:"note"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Alert.Status != "acknowledged" || resp.Alert.AcknowledgedBy == nil || *resp.Alert.AcknowledgedBy != "alice" {
+		t.Errorf("unexpected alert in response %+v", resp.Alert)
+	}
+	if resp.Note.ID == 0 || resp.Note.Author != "alice" || resp.Note.Text != "Looking into it, disk cleanup running" {
+		t.Errorf("unexpected note in response %+v", resp.Note)
+	}
+
+	stored, err := processor.GetAlert(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "acknowledged" || stored.AcknowledgedAt == nil {
+		t.Errorf("expected stored alert acknowledged, got %+v", stored)
+	}
+	var notes int
+	st.DB().QueryRow(`SELECT COUNT(*) FROM alert_notes WHERE alert_group_id = ?`, id).Scan(&notes)
+	if notes != 1 {
+		t.Errorf("expected 1 note, got %d", notes)
+	}
+
+	// Without a note only the ack is recorded
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/acknowledge", id),
+		strings.NewReader(`{"actor": "bob"}`)))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"note"`) {
+		t.Errorf("expected ack without note, got %d: %s", rec.Code, rec.Body.String())
+	}
+	st.DB().QueryRow(`SELECT COUNT(*) FROM alert_notes WHERE alert_group_id = ?`, id).Scan(&notes)
+	if notes != 1 {
+		t.Errorf("expected still 1 note, got %d", notes)
+	}
+}
+
+func TestGetAlertHistory(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := alerts[0].ID
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/acknowledge", id), nil)
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/resolve", id), nil)
+	req.Header.Set("X-User", "bob")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/alerts/%d/history", id), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var events []models.AlertEvent
+	if err := json.NewDecoder(rec.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	if e := events[0]; e.FromStatus != "" || e.ToStatus != "firing" || e.Actor != SourcePrometheus {
+		t.Errorf("expected the alert created firing by prometheus, got %+v", e)
+	}
+	if e := events[1]; e.FromStatus != "firing" || e.ToStatus != "acknowledged" || e.Actor != "alice" {
+		t.Errorf("expected alice's ack, got %+v", e)
+	}
+	if e := events[2]; e.FromStatus != "acknowledged" || e.ToStatus != "resolved" || e.Actor != "bob" {
+		t.Errorf("expected bob's resolve, got %+v", e)
+	}
+	if events[1].At.Before(events[0].At) {
+		t.Errorf("expected events oldest first, got %+v", events)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/alerts/%d/history", id+100), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing alert, got %d", rec.Code)
+	}
+}
+
+func TestAcknowledgeAlert_NoteFailureRollsBack(t *testing.T) {
+	st := newTestStore(t)
+	processor := NewAlertProcessor(st)
+
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := alerts[0].ID
+
+	// Make the note insert fail after the ack update has run
+	if _, err := st.DB().Exec(`DROP TABLE alert_notes`); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/acknowledge", id),
+		strings.NewReader(`{"note": "on it"}`))
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	NewRouter(st).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	stored, err := processor.GetAlert(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "firing" || stored.AcknowledgedBy != nil {
+		t.Errorf("expected ack rolled back, got status %s acknowledged_by %v", stored.Status, stored.AcknowledgedBy)
+	}
+}
+
+func TestAcknowledgeAlert_Validation(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	processor := NewAlertProcessor(st)
+
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{
+			{Status: "firing", Labels: map[string]string{"alertname": "A"}},
+			{Status: "resolved", Labels: map[string]string{"alertname": "B"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"no actor", fmt.Sprintf("/alerts/%d/acknowledge", alerts[0].ID), `{"note": "x"}`, http.StatusBadRequest},
+		{"note too long", fmt.Sprintf("/alerts/%d/acknowledge", alerts[0].ID), `{"actor": "alice", "note": "` + strings.Repeat("x", maxNoteLength+1) + `"}`, http.StatusBadRequest},
+		{"unknown alert", "/alerts/999/acknowledge", `{"actor": "alice"}`, http.StatusNotFound},
+		{"resolved alert", fmt.Sprintf("/alerts/%d/acknowledge", alerts[1].ID), `{"actor": "alice"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// dispatchRecorder is a Dispatcher that records the IDs of the alerts it
+// is handed
+type dispatchRecorder struct {
+	dispatched []int64
+	resolved   []int64
+}
+
+func (d *dispatchRecorder) Dispatch(ctx context.Context, alert *models.AlertGroup) bool {
+	d.dispatched = append(d.dispatched, alert.ID)
+	return true
+}
+
+func (d *dispatchRecorder) Resolve(ctx context.Context, alert *models.AlertGroup) {
+	d.resolved = append(d.resolved, alert.ID)
+}
+
+func TestResolveAlert(t *testing.T) {
+	st := newTestStore(t)
+	dispatcher := &dispatchRecorder{}
+	router := NewRouterWithOptions(st, RouterOptions{Dispatcher: dispatcher})
+	processor := NewAlertProcessor(st)
+
+	alerts, err := processor.ProcessPrometheusWebhook(&PrometheusWebhook{
+		Alerts: []PrometheusAlert{{Status: "firing", Labels: map[string]string{"alertname": "DiskFull"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := alerts[0].ID
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/resolve", id), nil)
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Alert models.AlertGroup `json:"alert"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Alert.ID != id || resp.Alert.Status != "resolved" || resp.Alert.ResolvedAt == nil {
+		t.Errorf("unexpected alert in response %+v", resp.Alert)
+	}
+
+	stored, err := processor.GetAlert(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "resolved" || stored.ResolvedAt == nil || stored.UpdatedAt.Before(*stored.ResolvedAt) {
+		t.Errorf("expected stored alert resolved, got %+v", stored)
+	}
+	if !reflect.DeepEqual(dispatcher.resolved, []int64{id}) {
+		t.Errorf("expected escalation told about the resolve, got %v", dispatcher.resolved)
+	}
+
+	// Resolving again changes nothing and doesn't notify twice
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/resolve", id), nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for an already resolved alert, got %d", rec.Code)
+	}
+	if len(dispatcher.resolved) != 1 {
+		t.Errorf("expected a single resolve notification, got %v", dispatcher.resolved)
+	}
+
+	// A resolved alert can no longer be acknowledged
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", fmt.Sprintf("/alerts/%d/acknowledge", id),
+		strings.NewReader(`{"actor": "alice"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 acknowledging a resolved alert, got %d", rec.Code)
+	}
+
+	for path, want := range map[string]int{
+		"/alerts/999/resolve": http.StatusNotFound,
+		"/alerts/abc/resolve": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestReprocessWebhook_AppliesNewRouting(t *testing.T) {
+	st := newTestStore(t)
+
+	slack := &recordingNotifier{}
+	manager := notifier.NewManager()
+	manager.Register(slack)
+	engine := escalation.NewEngine(manager, st)
+
+	chain := func(id int64, target string) *models.EscalationChain {
+		return &models.EscalationChain{ID: id, Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:" + target},
+		}}
+	}
+
+	// Before the fix every alert falls through to #general
+	before := escalation.NewDispatcher(escalation.NewRouter(nil, chain(1, "#general")), engine)
+	defer before.Close()
+	router := NewRouterWithOptions(st, RouterOptions{Dispatcher: before, StoreWebhooks: true})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/prometheus", strings.NewReader(
+		`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "ReplicationLag", "team": "database"}}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var received struct {
+		WebhookID int64 `json:"webhook_id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&received)
+	if received.WebhookID == 0 {
+		t.Fatal("expected the payload to be stored")
+	}
+	waitUntil(t, func() bool { return len(slack.recipients()) == 1 })
+
+	// The fixed routing sends database alerts to their own channel
+	after := escalation.NewDispatcher(escalation.NewRouter([]escalation.Route{
+		{Matchers: map[string]string{"team": "database"}, Chain: chain(2, "#db-oncall")},
+	}, chain(1, "#general")), engine)
+	defer after.Close()
+	router = NewRouterWithOptions(st, RouterOptions{Dispatcher: after, StoreWebhooks: true})
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", fmt.Sprintf("/alerts/reprocess/%d", received.WebhookID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Source      string `json:"source"`
+		AlertsCount int    `json:"alerts_count"`
+	}
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.Source != "prometheus" || resp.AlertsCount != 1 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	waitUntil(t, func() bool { return len(slack.recipients()) == 2 })
+	if got := slack.recipients(); got[1] != "#db-oncall" {
+		t.Errorf("expected replay routed to #db-oncall, got %v", got)
+	}
+
+	var alerts int
+	st.DB().QueryRow(`SELECT COUNT(*) FROM alert_groups`).Scan(&alerts)
+	if alerts != 1 {
+		t.Errorf("expected replay to update the existing alert, got %d alerts", alerts)
+	}
+}
+
+func TestReprocessWebhook_KeepsIntegrationChain(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	var chains []*models.EscalationChain
+	for _, name := range []string{"default", "database"} {
+		chain := &models.EscalationChain{Name: name}
+		if err := st.CreateEscalationChain(ctx, chain); err != nil {
+			t.Fatal(err)
+		}
+		chains = append(chains, chain)
+	}
+	fallback, database := chains[0], chains[1]
+	integration := &models.Integration{Name: "db-alertmanager", Type: models.IntegrationPrometheus, EscalationChainID: &database.ID}
+	if err := st.CreateIntegration(ctx, integration); err != nil {
+		t.Fatal(err)
+	}
+
+	router := NewRouterWithOptions(st, RouterOptions{StoreWebhooks: true, DefaultEscalationChain: fallback.ID})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/integrations/"+integration.Token, strings.NewReader(
+		`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "ReplicationLag"}}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var received struct {
+		WebhookID int64 `json:"webhook_id"`
+	}
+	json.NewDecoder(rec.Body).Decode(&received)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", fmt.Sprintf("/alerts/reprocess/%d", received.WebhookID), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var chainID int64
+	if err := st.DB().QueryRow(`SELECT escalation_chain_id FROM alert_groups`).Scan(&chainID); err != nil {
+		t.Fatal(err)
+	}
+	if chainID != database.ID {
+		t.Errorf("expected the replay to keep the integration's chain %d, got %d", database.ID, chainID)
+	}
+
+	// Without its integration the replay can't pick the right chain
+	if err := st.DeleteIntegration(ctx, integration.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", fmt.Sprintf("/alerts/reprocess/%d", received.WebhookID), nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 replaying through a deleted integration, got %d", rec.Code)
+	}
+}
+
+func TestReprocessWebhook_NotStored(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/prometheus", strings.NewReader(
+		`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "A"}}]}`)))
+	if strings.Contains(rec.Body.String(), "webhook_id") {
+		t.Errorf("expected payloads not stored by default, got %s", rec.Body.String())
+	}
+	var stored int
+	st.DB().QueryRow(`SELECT COUNT(*) FROM webhook_payloads`).Scan(&stored)
+	if stored != 0 {
+		t.Errorf("expected no stored payloads, got %d", stored)
+	}
+
+	for path, want := range map[string]int{
+		"/alerts/reprocess/1":   http.StatusNotFound,
+		"/alerts/reprocess/abc": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", path, nil))
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestIntegrationHandlers(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+
+	chain := &models.EscalationChain{Name: "Default"}
+	if err := st.CreateEscalationChain(context.Background(), chain); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do("POST", "/integrations", fmt.Sprintf(
+		`{"name": "prod-alertmanager", "type": "prometheus", "config": {"cluster": "prod"}, "escalation_chain_id": %d}`, chain.ID))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created models.Integration
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == 0 || created.Token == "" || created.Config["cluster"] != "prod" ||
+		created.EscalationChainID == nil || *created.EscalationChainID != chain.ID {
+		t.Errorf("unexpected created integration %+v", created)
+	}
+
+	rec = do("GET", fmt.Sprintf("/integrations/%d", created.ID), "")
+	var got models.Integration
+	json.NewDecoder(rec.Body).Decode(&got)
+	if rec.Code != http.StatusOK || got.Token != created.Token || got.Name != "prod-alertmanager" {
+		t.Errorf("expected the created integration back, got %d %+v", rec.Code, got)
+	}
+
+	if rec := do("POST", "/integrations", `{"name": "grafana", "type": "grafana"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = do("GET", "/integrations", "")
+	var list []models.Integration
+	json.NewDecoder(rec.Body).Decode(&list)
+	if len(list) != 2 || list[0].Name != "grafana" {
+		t.Errorf("expected 2 integrations, grafana first, got %+v", list)
+	}
+
+	if rec := do("DELETE", fmt.Sprintf("/integrations/%d", created.ID), ""); rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if rec := do("GET", fmt.Sprintf("/integrations/%d", created.ID), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rec.Code)
+	}
+	if rec := do("DELETE", fmt.Sprintf("/integrations/%d", created.ID), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting twice, got %d", rec.Code)
+	}
+}
+
+func TestCreateIntegration_Validation(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid json", `{`},
+		{"missing name", `{"type": "prometheus"}`},
+		{"unknown type", `{"name": "x", "type": "datadog"}`},
+		{"unknown chain", `{"name": "x", "type": "webhook", "escalation_chain_id": 999}`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/integrations", strings.NewReader(tt.body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d: %s", tt.name, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestReceiveAlert_IntegrationRouting(t *testing.T) {
+	st := newTestStore(t)
+	ctx := context.Background()
+
+	newChain := func(target string) *models.EscalationChain {
+		chain := &models.EscalationChain{Name: target, Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:" + target},
+		}}
+		if err := st.CreateEscalationChain(ctx, chain); err != nil {
+			t.Fatal(err)
+		}
+		return chain
+	}
+	fallback := newChain("#general")
+	database := newChain("#database")
+
+	withChain := &models.Integration{Name: "db-alertmanager", Type: models.IntegrationPrometheus, EscalationChainID: &database.ID}
+	withoutChain := &models.Integration{Name: "grafana", Type: models.IntegrationGrafana}
+	generic := &models.Integration{Name: "custom", Type: models.IntegrationWebhook}
+	for _, integration := range []*models.Integration{withChain, withoutChain, generic} {
+		if err := st.CreateIntegration(ctx, integration); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slack := &recordingNotifier{}
+	manager := notifier.NewManager()
+	manager.Register(slack)
+	dispatcher := escalation.NewDispatcher(escalation.NewRouter(nil, fallback), escalation.NewEngine(manager, st))
+	dispatcher.SetChainSource(st)
+	defer dispatcher.Close()
+
+	router := NewRouterWithOptions(st, RouterOptions{Dispatcher: dispatcher, DefaultEscalationChain: fallback.ID})
+	post := func(path, body string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return rec.Code
+	}
+	chainOf := func(alertname string) int64 {
+		t.Helper()
+		var id sql.NullInt64
+		if err := st.DB().QueryRow(`SELECT escalation_chain_id FROM alert_groups WHERE summary = ?`, alertname).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id.Int64
+	}
+
+	// The integration's own chain
+	code := post(fmt.Sprintf("/alerts/prometheus?integration_id=%d", withChain.ID),
+		`{"alerts": [{"status": "firing", "labels": {"alertname": "ReplicationLag"}}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	waitUntil(t, func() bool { return len(slack.recipients()) == 1 })
+	if got := chainOf("ReplicationLag"); got != database.ID {
+		t.Errorf("expected chain %d from the integration, got %d", database.ID, got)
+	}
+
+	// An integration without a chain, posting to its own URL, gets the default
+	code = post("/alerts/integrations/"+withoutChain.Token,
+		`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "HighLatency"}}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	waitUntil(t, func() bool { return len(slack.recipients()) == 2 })
+	if got := chainOf("HighLatency"); got != fallback.ID {
+		t.Errorf("expected default chain %d, got %d", fallback.ID, got)
+	}
+
+	if got := slack.recipients(); !reflect.DeepEqual(got, []string{"#database", "#general"}) {
+		t.Errorf("expected each alert escalated by its chain, got %v", got)
+	}
+
+	for path, want := range map[string]int{
+		"/alerts/prometheus?integration_id=999": http.StatusNotFound,
+		"/alerts/prometheus?integration_id=abc": http.StatusBadRequest,
+		"/alerts/integrations/unknown-token":    http.StatusNotFound,
+		// Generic webhooks aren't parsed, so they must not look delivered
+		"/alerts/integrations/" + generic.Token: http.StatusNotImplemented,
+		"/alerts/webhook":                       http.StatusNotImplemented,
+	} {
+		if code := post(path, `{"alerts": []}`); code != want {
+			t.Errorf("%s: expected %d, got %d", path, want, code)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+)
+
+// slackSignatureMaxAge is how old a signed Slack request may be before it
+// is rejected as a possible replay
+const slackSignatureMaxAge = 5 * time.Minute
+
+// maxSlackPayload caps the interaction request bodies read
+const maxSlackPayload = 1 << 20
+
+// verifySlackSignature checks body against the X-Slack-Signature and
+// X-Slack-Request-Timestamp headers, see
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	ts := header.Get("X-Slack-Request-Timestamp")
+	sig := header.Get("X-Slack-Signature")
+	if ts == "" || sig == "" {
+		return errors.New("missing slack signature")
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid slack request timestamp %q", ts)
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > slackSignatureMaxAge || age < -slackSignatureMaxAge {
+		return errors.New("slack request timestamp is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", ts)
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(sig)) {
+		return errors.New("slack signature mismatch")
+	}
+	return nil
+}
+
+// slackInteraction is the part of a block_actions payload the handler
+// reads
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		Name     string `json:"name"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+	Message     struct {
+		Text   string            `json:"text"`
+		Blocks []json.RawMessage `json:"blocks"`
+	} `json:"message"`
+}
+
+// slackMessageUpdate replaces the message a button was clicked on
+type slackMessageUpdate struct {
+	ReplaceOriginal bool          `json:"replace_original"`
+	Text            string        `json:"text"`
+	Blocks          []interface{} `json:"blocks"`
+}
+
+// slackInteraction handles Acknowledge and Resolve button clicks on alert
+// messages sent by an interactive notifier.SlackNotifier. It replies with
+// the message minus its buttons plus who acted, both in the response and
+// through the payload's response_url, which is what Slack displays.
+func (h *handlers) slackInteraction(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSlackPayload))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if err := verifySlackSignature(h.slackSigningSecret, r.Header, body, time.Now()); err != nil {
+		slog.Warn("rejected slack interaction", "error", err)
+		http.Error(w, "invalid slack signature", http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	var payload slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		http.Error(w, "invalid interaction payload", http.StatusBadRequest)
+		return
+	}
+	if payload.Type != "block_actions" {
+		// Other interaction types aren't used, but Slack expects a 200
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var action, fingerprint string
+	for _, a := range payload.Actions {
+		if a.ActionID == notifier.SlackActionAcknowledge || a.ActionID == notifier.SlackActionResolve {
+			action, fingerprint = a.ActionID, a.Value
+			break
+		}
+	}
+	if action == "" {
+		http.Error(w, "no alert action in payload", http.StatusBadRequest)
+		return
+	}
+
+	actor := payload.User.Username
+	if actor == "" {
+		actor = payload.User.Name
+	}
+	if actor == "" {
+		actor = payload.User.ID
+	}
+
+	alert, err := h.store.Alerts().GetByFingerprint(r.Context(), fingerprint)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "alert not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to get alert", "fingerprint", fingerprint, "error", err)
+		http.Error(w, "failed to get alert", http.StatusInternalServerError)
+		return
+	}
+
+	verb := "Acknowledged"
+	if action == notifier.SlackActionAcknowledge {
+		alert, _, err = h.alertProcessor.Acknowledge(r.Context(), alert.ID, actor, "")
+	} else {
+		verb = "Resolved"
+		alert, err = h.alertProcessor.Resolve(r.Context(), alert.ID, actor)
+	}
+	switch {
+	case errors.Is(err, ErrAlertResolved):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.Error("failed to update alert from slack", "fingerprint", fingerprint, "action", action, "error", err)
+		http.Error(w, "failed to update alert", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("alert updated from slack", "id", alert.ID, "status", alert.Status, "actor", actor)
+
+	who := actor
+	if payload.User.ID != "" {
+		who = "<@" + payload.User.ID + ">"
+	}
+	update := slackUpdate(payload, fmt.Sprintf("%s by %s at %s", verb, who, alert.UpdatedAt.UTC().Format("15:04 UTC")))
+	if payload.ResponseURL != "" {
+		go postSlackUpdate(payload.ResponseURL, update)
+	}
+	respondJSON(w, http.StatusOK, update)
+}
+
+// slackUpdate returns the interaction's message with its actions blocks
+// replaced by a context line
+func slackUpdate(payload slackInteraction, status string) slackMessageUpdate {
+	update := slackMessageUpdate{ReplaceOriginal: true, Text: payload.Message.Text}
+	for _, raw := range payload.Message.Blocks {
+		var block struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(raw, &block) == nil && block.Type == "actions" {
+			continue
+		}
+		update.Blocks = append(update.Blocks, raw)
+	}
+	update.Blocks = append(update.Blocks, map[string]interface{}{
+		"type":     "context",
+		"elements": []map[string]string{{"type": "mrkdwn", "text": status}},
+	})
+	return update
+}
+
+func postSlackUpdate(responseURL string, update slackMessageUpdate) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		slog.Error("failed to encode slack update", "error", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("failed to create slack update request", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Warn("failed to update slack message", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("slack rejected message update", "status", resp.StatusCode)
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+	"github.com/vjranagit/grafana/internal/oncall/store"
+)
+
+const testSlackSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+func signSlack(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("payload=%7B%7D")
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	header := func(ts, sig string) http.Header {
+		h := http.Header{}
+		h.Set("X-Slack-Request-Timestamp", ts)
+		h.Set("X-Slack-Signature", sig)
+		return h
+	}
+
+	if err := verifySlackSignature(testSlackSecret, header(ts, signSlack(testSlackSecret, ts, body)), body, now); err != nil {
+		t.Errorf("expected a valid signature, got %v", err)
+	}
+
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	for name, h := range map[string]http.Header{
+		"missing":      {},
+		"wrong secret": header(ts, signSlack("other", ts, body)),
+		"stale":        header(stale, signSlack(testSlackSecret, stale, body)),
+		"bad time":     header("soon", signSlack(testSlackSecret, "soon", body)),
+	} {
+		if err := verifySlackSignature(testSlackSecret, h, body, now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := verifySlackSignature(testSlackSecret, header(ts, signSlack(testSlackSecret, ts, body)), []byte("payload=tampered"), now); err == nil {
+		t.Error("expected a tampered body to fail")
+	}
+}
+
+// slackClick builds a signed interaction request for a button on fingerprint
+func slackClick(t *testing.T, secret, actionID, fingerprint string) *http.Request {
+	t.Helper()
+	payload, err := json.Marshal(map[string]interface{}{
+		"type":    "block_actions",
+		"user":    map[string]string{"id": "U123", "username": "alice"},
+		"actions": []map[string]string{{"action_id": actionID, "value": fingerprint}},
+		"message": map[string]interface{}{
+			"text": "High latency",
+			"blocks": []map[string]interface{}{
+				{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": "High latency"}},
+				{"type": "actions", "block_id": "oncall_actions"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := url.Values{"payload": {string(payload)}}.Encode()
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req := httptest.NewRequest("POST", "/slack/interactions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", signSlack(secret, ts, []byte(body)))
+	return req
+}
+
+func newSlackTestRouter(t *testing.T) (chi.Router, *store.Store) {
+	t.Helper()
+	st := newTestStore(t)
+	now := time.Now().UTC()
+	if _, err := st.DB().Exec(`INSERT INTO alert_groups (fingerprint, status, summary, starts_at, created_at, updated_at)
+		VALUES ('abc123', 'firing', 'High latency', ?, ?, ?)`, now, now, now); err != nil {
+		t.Fatal(err)
+	}
+	return NewRouterWithOptions(st, RouterOptions{SlackSigningSecret: testSlackSecret}), st
+}
+
+func TestSlackInteraction_Acknowledge(t *testing.T) {
+	router, st := newSlackTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, slackClick(t, testSlackSecret, notifier.SlackActionAcknowledge, "abc123"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	alert, err := st.Alerts().GetByFingerprint(context.Background(), "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.Status != "acknowledged" || alert.AcknowledgedBy == nil || *alert.AcknowledgedBy != "alice" {
+		t.Errorf("expected the alert acknowledged by alice, got %+v", alert)
+	}
+
+	var update struct {
+		ReplaceOriginal bool `json:"replace_original"`
+		Blocks          []struct {
+			Type     string `json:"type"`
+			Elements []struct {
+				Text string `json:"text"`
+			} `json:"elements"`
+		} `json:"blocks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &update); err != nil {
+		t.Fatal(err)
+	}
+	if !update.ReplaceOriginal || len(update.Blocks) != 2 {
+		t.Fatalf("expected the section plus a context block, got %s", rec.Body.String())
+	}
+	last := update.Blocks[1]
+	if last.Type != "context" || len(last.Elements) != 1 || !strings.HasPrefix(last.Elements[0].Text, "Acknowledged by <@U123> at ") {
+		t.Errorf("expected who acknowledged in place of the buttons, got %s", rec.Body.String())
+	}
+}
+
+func TestSlackInteraction_Resolve(t *testing.T) {
+	router, st := newSlackTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, slackClick(t, testSlackSecret, notifier.SlackActionResolve, "abc123"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	alert, err := st.Alerts().GetByFingerprint(context.Background(), "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.Status != "resolved" {
+		t.Errorf("expected the alert resolved, got %s", alert.Status)
+	}
+	events, err := st.Alerts().History(context.Background(), alert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := events[len(events)-1]; e.ToStatus != "resolved" || e.Actor != "alice" {
+		t.Errorf("expected the resolve recorded for the clicking user, got %+v", e)
+	}
+	var update slackMessageUpdate
+	if err := json.Unmarshal(rec.Body.Bytes(), &update); err != nil {
+		t.Fatal(err)
+	}
+	if len(update.Blocks) != 2 || !strings.Contains(fmt.Sprint(update.Blocks[1]), "Resolved by <@U123>") {
+		t.Errorf("expected who resolved in place of the buttons, got %s", rec.Body.String())
+	}
+}
+
+func TestSlackInteraction_RejectsBadSignature(t *testing.T) {
+	router, st := newSlackTestRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, slackClick(t, "wrong-secret", notifier.SlackActionAcknowledge, "abc123"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rec.Code)
+	}
+	alert, err := st.Alerts().GetByFingerprint(context.Background(), "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.Status != "firing" {
+		t.Errorf("expected the alert untouched, got %s", alert.Status)
+	}
+}
+
+func TestSlackInteraction_DisabledWithoutSecret(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, slackClick(t, "", notifier.SlackActionAcknowledge, "abc123"))
+	if rec.Code == http.StatusOK {
+		t.Errorf("expected the endpoint to be off without a signing secret")
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AlertStats summarizes the stored alerts
+type AlertStats struct {
+	Total      int            `json:"total"`
+	ByStatus   map[string]int `json:"by_status"`
+	BySeverity map[string]int `json:"by_severity"`
+	// FiringUnacknowledged is the number of alerts nobody has acknowledged
+	// yet
+	FiringUnacknowledged int `json:"firing_unacknowledged"`
+	// OldestUnacknowledgedSeconds is how long the longest-firing
+	// unacknowledged alert has been firing, omitted when none is
+	OldestUnacknowledgedSeconds *float64 `json:"oldest_unacknowledged_seconds,omitempty"`
+}
+
+// StatsReport is the body of GET /stats
+type StatsReport struct {
+	Alerts        AlertStats `json:"alerts"`
+	Schedules     int        `json:"schedules"`
+	UptimeSeconds float64    `json:"uptime_seconds"`
+	Timestamp     time.Time  `json:"timestamp"`
+}
+
+// getStats serves GET /stats from aggregate queries, without loading
+// alerts
+func (h *handlers) getStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	alerts := h.store.Alerts()
+	now := time.Now().UTC()
+	report := StatsReport{
+		UptimeSeconds: now.Sub(h.startedAt).Seconds(),
+		Timestamp:     now,
+	}
+
+	var err error
+	if report.Alerts.ByStatus, err = alerts.CountByStatus(ctx); err != nil {
+		h.statsError(w, err)
+		return
+	}
+	if report.Alerts.BySeverity, err = alerts.CountBySeverity(ctx); err != nil {
+		h.statsError(w, err)
+		return
+	}
+	oldest, err := alerts.OldestUnacknowledged(ctx)
+	if err != nil {
+		h.statsError(w, err)
+		return
+	}
+	if report.Schedules, err = h.store.CountSchedules(ctx); err != nil {
+		h.statsError(w, err)
+		return
+	}
+
+	for _, n := range report.Alerts.ByStatus {
+		report.Alerts.Total += n
+	}
+	report.Alerts.FiringUnacknowledged = report.Alerts.ByStatus["firing"]
+	if !oldest.IsZero() {
+		age := now.Sub(oldest).Seconds()
+		report.Alerts.OldestUnacknowledgedSeconds = &age
+	}
+
+	respondJSON(w, http.StatusOK, report)
+}
+
+func (h *handlers) statsError(w http.ResponseWriter, err error) {
+	slog.Error("failed to collect stats", "error", err)
+	http.Error(w, "failed to collect stats", http.StatusInternalServerError)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func TestGetStats(t *testing.T) {
+	st := newTestStore(t)
+	router := NewRouter(st)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	for _, a := range []struct {
+		fingerprint, status, severity string
+		startedAgo                    time.Duration
+	}{
+		{"a", "firing", "critical", 2 * time.Hour},
+		{"b", "firing", "warning", 30 * time.Minute},
+		{"c", "acknowledged", "critical", 5 * time.Hour},
+		{"d", "resolved", "critical", 10 * time.Hour},
+		{"e", "resolved", "", time.Hour},
+	} {
+		_, err := st.DB().Exec(`INSERT INTO alert_groups (fingerprint, status, severity, starts_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, a.fingerprint, a.status, a.severity, now.Add(-a.startedAgo), now, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"primary", "secondary"} {
+		if err := st.CreateSchedule(ctx, &models.Schedule{Name: name, Timezone: "UTC"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report StatsReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Alerts.Total != 5 || report.Schedules != 2 || report.Alerts.FiringUnacknowledged != 2 {
+		t.Errorf("unexpected totals %+v", report)
+	}
+	if want := map[string]int{"firing": 2, "acknowledged": 1, "resolved": 2}; !reflect.DeepEqual(report.Alerts.ByStatus, want) {
+		t.Errorf("expected by_status %v, got %v", want, report.Alerts.ByStatus)
+	}
+	if want := map[string]int{"critical": 3, "warning": 1, "": 1}; !reflect.DeepEqual(report.Alerts.BySeverity, want) {
+		t.Errorf("expected by_severity %v, got %v", want, report.Alerts.BySeverity)
+	}
+	// The acknowledged alert is older but no longer counts
+	age := report.Alerts.OldestUnacknowledgedSeconds
+	if age == nil || *age < (2*time.Hour).Seconds() || *age > (2*time.Hour+time.Minute).Seconds() {
+		t.Errorf("expected the oldest unacknowledged alert to be about 2h old, got %v", age)
+	}
+	if report.UptimeSeconds < 0 {
+		t.Errorf("expected a non-negative uptime, got %v", report.UptimeSeconds)
+	}
+}
+
+func TestGetStats_Empty(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	alerts := body["alerts"].(map[string]interface{})
+	if alerts["total"] != float64(0) || body["schedules"] != float64(0) {
+		t.Errorf("expected zero counts, got %v", body)
+	}
+	if _, ok := alerts["oldest_unacknowledged_seconds"]; ok {
+		t.Errorf("expected no oldest alert age without firing alerts, got %v", alerts)
+	}
+}
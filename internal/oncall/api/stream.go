@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// EventAlert is the SSE event name used for alert updates
+const EventAlert = "alert"
+
+// EventHub fans out alert updates to stream subscribers
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan *models.AlertGroup]struct{}
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{
+		subscribers: make(map[chan *models.AlertGroup]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber. The returned function must be
+// called to release it.
+func (h *EventHub) Subscribe() (<-chan *models.AlertGroup, func()) {
+	ch := make(chan *models.AlertGroup, 64)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Publish sends a copy of the alert to every subscriber. Slow subscribers
+// miss events rather than blocking alert ingestion.
+func (h *EventHub) Publish(alert *models.AlertGroup) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		event := *alert
+		select {
+		case ch <- &event:
+		default:
+			slog.Warn("dropping alert event for slow subscriber", "alert", alert.Fingerprint)
+		}
+	}
+}
+
+// streamAlerts serves alert updates as Server-Sent Events, starting with a
+// snapshot of all unresolved alerts.
+func (h *handlers) streamAlerts(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.alertProcessor.events.Subscribe()
+	defer unsubscribe()
+
+	active, err := h.alertProcessor.ActiveAlerts(r.Context())
+	if err != nil {
+		slog.Error("failed to load active alerts", "error", err)
+		http.Error(w, "failed to load alerts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, alert := range active {
+		if err := writeEvent(w, EventAlert, alert); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case alert := <-events:
+			if err := writeEvent(w, EventAlert, alert); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
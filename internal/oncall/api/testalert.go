@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+const (
+	defaultTestAlertTTL = 5 * time.Minute
+	maxTestAlertTTL     = time.Hour
+)
+
+// testAlertLabels are set on every test alert and kept by label filters
+// whatever their allow list
+var testAlertLabels = []string{"test", "drill_id"}
+
+// TestAlerts tracks the pending auto-resolves of injected test alerts so
+// they can be stopped on shutdown
+type TestAlerts struct {
+	mu      sync.Mutex
+	timers  map[string]*time.Timer // by drill_id
+	stopped bool
+}
+
+func NewTestAlerts() *TestAlerts {
+	return &TestAlerts{timers: make(map[string]*time.Timer)}
+}
+
+// schedule calls resolve after ttl unless Stop is called first
+func (t *TestAlerts) schedule(drillID string, ttl time.Duration, resolve func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	t.timers[drillID] = time.AfterFunc(ttl, func() {
+		t.mu.Lock()
+		_, pending := t.timers[drillID]
+		delete(t.timers, drillID)
+		t.mu.Unlock()
+		if pending {
+			resolve()
+		}
+	})
+}
+
+// Pending returns how many test alerts are waiting to be resolved
+func (t *TestAlerts) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.timers)
+}
+
+// Stop cancels the pending auto-resolves, and any scheduled later, and
+// returns the drill IDs of the test alerts left firing
+func (t *TestAlerts) Stop() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	drills := make([]string, 0, len(t.timers))
+	for drillID, timer := range t.timers {
+		timer.Stop()
+		drills = append(drills, drillID)
+	}
+	t.timers = make(map[string]*time.Timer)
+	sort.Strings(drills)
+	return drills
+}
+
+// InjectTestAlert fires a synthetic alert through the normal ingestion path,
+// so it is routed, escalated and notified like a real one, and resolves it
+// after ttl. The alert carries test="true" so responders can tell it's a
+// drill, and a unique drill_id so repeated drills don't merge.
+func (p *AlertProcessor) InjectTestAlert(ctx context.Context, severity, summary string, labels map[string]string, ttl time.Duration) (*models.AlertGroup, error) {
+	alertLabels := map[string]string{"alertname": "TestAlert"}
+	for name, value := range labels {
+		alertLabels[name] = value
+	}
+	alertLabels["test"] = "true"
+	alertLabels["severity"] = severity
+	alertLabels["drill_id"] = strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	alert := PrometheusAlert{
+		Status:   "firing",
+		Labels:   alertLabels,
+		StartsAt: time.Now().UTC(),
+		Annotations: map[string]string{
+			"summary":     summary,
+			"description": "Synthetic alert raised for an on-call drill",
+		},
+	}
+
+	groups, err := p.ProcessPrometheusWebhookFor(ctx, nil, &PrometheusWebhook{Status: "firing", Alerts: []PrometheusAlert{alert}})
+	if err != nil {
+		return nil, err
+	}
+
+	// The resolve outlives the request but keeps its log attributes
+	resolveCtx := context.WithoutCancel(ctx)
+	p.testAlerts.schedule(alertLabels["drill_id"], ttl, func() {
+		resolved := alert
+		resolved.Status = "resolved"
+		resolved.EndsAt = time.Now().UTC()
+		if _, err := p.ProcessPrometheusWebhookFor(resolveCtx, nil, &PrometheusWebhook{Status: "resolved", Alerts: []PrometheusAlert{resolved}}); err != nil {
+			slog.ErrorContext(resolveCtx, "failed to auto-resolve test alert",
+				"drill_id", alertLabels["drill_id"],
+				"error", err)
+		}
+	})
+
+	return groups[0], nil
+}
+
+type testAlertRequest struct {
+	Severity string            `json:"severity"`
+	Summary  string            `json:"summary"`
+	Labels   map[string]string `json:"labels"`
+	TTL      string            `json:"ttl"`
+}
+
+func (h *handlers) createTestAlert(w http.ResponseWriter, r *http.Request) {
+	var req testAlertRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.Severity == "" {
+		req.Severity = "warning"
+	}
+	if req.Summary == "" {
+		req.Summary = "Test alert"
+	}
+
+	ttl := defaultTestAlertTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > maxTestAlertTTL {
+			http.Error(w, fmt.Sprintf("invalid ttl: expected a duration up to %s", maxTestAlertTTL), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+
+	alert, err := h.alertProcessor.InjectTestAlert(r.Context(), req.Severity, req.Summary, req.Labels, ttl)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to inject test alert", "error", err)
+		http.Error(w, "failed to inject test alert", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "injected test alert",
+		"alert", alert.Fingerprint,
+		"severity", req.Severity,
+		"ttl", ttl)
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"alert":       alert,
+		"resolves_at": time.Now().Add(ttl).UTC(),
+	})
+}
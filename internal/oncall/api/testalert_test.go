@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/escalation"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+)
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []*models.AlertGroup
+	to   []string
+}
+
+func (n *recordingNotifier) Channel() string { return "slack" }
+
+func (n *recordingNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, alert)
+	n.to = append(n.to, recipient)
+	return nil
+}
+
+func (n *recordingNotifier) recipients() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.to...)
+}
+
+func TestCreateTestAlert_EndToEnd(t *testing.T) {
+	st := newTestStore(t)
+
+	slack := &recordingNotifier{}
+	manager := notifier.NewManager()
+	manager.Register(slack)
+
+	drills := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#drills"},
+	}}
+	fallback := &models.EscalationChain{ID: 2, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#incidents"},
+	}}
+	dispatcher := escalation.NewDispatcher(
+		escalation.NewRouter([]escalation.Route{{Matchers: map[string]string{"test": "true"}, Chain: drills}}, fallback),
+		escalation.NewEngine(manager, st),
+	)
+	defer dispatcher.Close()
+
+	router := NewRouterWithDispatcher(st, dispatcher)
+
+	body := `{"severity": "critical", "labels": {"team": "platform"}, "ttl": "200ms"}`
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/test", strings.NewReader(body)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Alert models.AlertGroup `json:"alert"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	alert := resp.Alert
+	if alert.Labels["test"] != "true" || alert.Labels["team"] != "platform" || alert.Severity != "critical" {
+		t.Errorf("unexpected test alert %+v", alert)
+	}
+
+	waitUntil(t, func() bool { return len(slack.recipients()) > 0 })
+	if got := slack.recipients(); len(got) != 1 || got[0] != "#drills" {
+		t.Errorf("expected test alert routed to #drills, got %v", got)
+	}
+
+	processor := NewAlertProcessor(st)
+	waitUntil(t, func() bool {
+		stored, err := processor.GetAlert(context.Background(), alert.ID)
+		return err == nil && stored.Status == "resolved"
+	})
+}
+
+func TestCreateTestAlert_InvalidTTL(t *testing.T) {
+	router := NewRouter(newTestStore(t))
+
+	for _, ttl := range []string{"soon", "-1s", "48h"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/test", strings.NewReader(`{"ttl": "`+ttl+`"}`)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("ttl %q: expected 400, got %d", ttl, rec.Code)
+		}
+	}
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCreateTestAlert_AllowListKeepsTestLabels(t *testing.T) {
+	router := NewRouterWithOptions(newTestStore(t), RouterOptions{LabelFilter: &LabelFilter{Allow: []string{"team"}}})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/test", strings.NewReader(`{"labels": {"team": "platform", "host": "db1"}}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Alert models.AlertGroup `json:"alert"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	labels := resp.Alert.Labels
+	if labels["test"] != "true" || labels["drill_id"] == "" || labels["team"] != "platform" {
+		t.Errorf("expected the test and drill_id labels to survive the allow list, got %v", labels)
+	}
+	if _, ok := labels["host"]; ok {
+		t.Errorf("expected other labels to be filtered, got %v", labels)
+	}
+}
+
+func TestTestAlerts_Stop(t *testing.T) {
+	st := newTestStore(t)
+	testAlerts := NewTestAlerts()
+	router := NewRouterWithOptions(st, RouterOptions{TestAlerts: testAlerts})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/alerts/test", strings.NewReader(`{"ttl": "50ms"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Alert models.AlertGroup `json:"alert"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if testAlerts.Pending() != 1 {
+		t.Fatalf("expected one pending auto-resolve, got %d", testAlerts.Pending())
+	}
+	drills := testAlerts.Stop()
+	if len(drills) != 1 || drills[0] != resp.Alert.Labels["drill_id"] {
+		t.Errorf("expected the drill left firing to be reported, got %v", drills)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	stored, err := NewAlertProcessor(st).GetAlert(context.Background(), resp.Alert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "firing" {
+		t.Errorf("expected the stopped auto-resolve not to run, got %q", stored.Status)
+	}
+}
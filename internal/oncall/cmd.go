@@ -9,6 +9,7 @@ import (
 	"syscall"
 
 	"github.com/spf13/cobra"
+	"github.com/vjranagit/grafana/internal/logging"
 	"github.com/vjranagit/grafana/internal/oncall/server"
 )
 
@@ -20,16 +21,18 @@ func NewCommand() *cobra.Command {
 		Use:   "oncall",
 		Short: "On-call management server",
 		Long: `Start the on-call management server for schedule management,
-alert routing, and escalation policies.`,
+alert routing, and escalation policies. Server settings come from the
+oncall block of the config file.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Setup logging
 			logLevel := slog.LevelInfo
 			if debug {
 				logLevel = slog.LevelDebug
 			}
-			logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 				Level: logLevel,
-			}))
+			})
+			logger := slog.New(logging.NewContextHandler(logging.NewRedactingHandler(handler, logging.DefaultSensitiveKeys)))
 			slog.SetDefault(logger)
 
 			// Load configuration
@@ -63,14 +66,11 @@ alert routing, and escalation policies.`,
 		"Configuration file path")
 	cmd.Flags().BoolVar(&debug, "debug", false, "Enable debug logging")
 
-	return cmd
-}
+	cmd.AddCommand(newWatchCommand())
+	cmd.AddCommand(newDoctorCommand())
+	cmd.AddCommand(newWhoIsOnCallCommand())
+	cmd.AddCommand(newImportCommand())
+	cmd.AddCommand(newConfigCommand())
 
-func loadConfig(path string) (*server.Config, error) {
-	// For now, return default config
-	// TODO: Implement HCL parsing
-	return &server.Config{
-		Listen:   ":8080",
-		Database: "sqlite://oncall.db",
-	}, nil
+	return cmd
 }
@@ -0,0 +1,328 @@
+package oncall
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/vjranagit/grafana/internal/oncall/api"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+	"github.com/vjranagit/grafana/internal/oncall/server"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// loadConfig reads the oncall block of the HCL config at path, the only
+// source of server settings. A missing file gives the defaults. Settings
+// the server doesn't support yet, such as notification, are ignored.
+func loadConfig(path string) (*server.Config, error) {
+	cfg := &server.Config{
+		Listen:               ":8080",
+		Database:             "sqlite://oncall.db",
+		WebhookPoolStrategy:  notifier.BalanceRoundRobin,
+		WebhookRateBurst:     20,
+		WebhookRateLimitBy:   api.RateLimitByIP,
+		NotifyThrottleWindow: notifier.DefaultThrottleWindow,
+		NotifyWorkers:        notifier.DefaultAsyncWorkers,
+		NotifyQueueSize:      notifier.DefaultAsyncQueueSize,
+	}
+
+	src, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := parseConfig(src, path, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var oncallSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "oncall"}},
+}
+
+var oncallBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "listen"},
+		{Name: "database"},
+		{Name: "allow_labels"},
+		{Name: "deny_labels"},
+		{Name: "store_webhooks"},
+		{Name: "store_dead_letters"},
+		{Name: "max_webhook_bytes"},
+		{Name: "max_annotation_length"},
+		{Name: "dedup_interval"},
+		{Name: "default_escalation_chain"},
+		{Name: "webhook_pool"},
+		{Name: "webhook_pool_strategy"},
+		{Name: "user_channels"},
+		{Name: "default_user_channel"},
+		{Name: "severity_multipliers"},
+		{Name: "webhook_rate_limit"},
+		{Name: "webhook_rate_burst"},
+		{Name: "webhook_rate_limit_by"},
+		{Name: "notify_throttle_limit"},
+		{Name: "notify_throttle_window"},
+		{Name: "notify_dedup_window"},
+		{Name: "notify_workers"},
+		{Name: "notify_queue_size"},
+		{Name: "slack_signing_secret"},
+		{Name: "webhook_signing_secret"},
+		{Name: "webhook_headers"},
+		{Name: "telegram_bot_token"},
+		{Name: "slack_template"},
+		{Name: "webhook_template"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "api_key", LabelNames: []string{"name"}},
+		{Type: "route"},
+	},
+}
+
+var apiKeySchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "key", Required: true},
+		{Name: "scopes"},
+	},
+}
+
+var routeSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "match"},
+		{Name: "targets", Required: true},
+	},
+}
+
+// evalContext lets config values read environment variables with env()
+var evalContext = &hcl.EvalContext{
+	Functions: map[string]function.Function{
+		"env": function.New(&function.Spec{
+			Params: []function.Parameter{{Name: "name", Type: cty.String}},
+			Type:   function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+				return cty.StringVal(os.Getenv(args[0].AsString())), nil
+			},
+		}),
+	},
+}
+
+// parseConfig applies the settings in src to cfg
+func parseConfig(src []byte, filename string, cfg *server.Config) error {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return diags
+	}
+	content, _, diags := file.Body.PartialContent(oncallSchema)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, block := range content.Blocks {
+		oncall, _, diags := block.Body.PartialContent(oncallBlockSchema)
+		if diags.HasErrors() {
+			return diags
+		}
+		settings := configSettings(cfg)
+		for _, schema := range oncallBlockSchema.Attributes {
+			attr, ok := oncall.Attributes[schema.Name]
+			if !ok {
+				continue
+			}
+			var err error
+			switch target := settings[schema.Name].(type) {
+			case *time.Duration:
+				err = decodeDuration(attr, target)
+			case *[]notifier.Endpoint:
+				err = decodeEndpoints(attr, target)
+			case *map[string]float64:
+				err = decodeMultipliers(attr, target)
+			default:
+				err = decodeAttr(attr, target)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for _, block := range oncall.Blocks {
+			switch block.Type {
+			case "api_key":
+				key, err := parseAPIKey(block)
+				if err != nil {
+					return err
+				}
+				cfg.APIKeys = append(cfg.APIKeys, key)
+			case "route":
+				route, err := parseRoute(block)
+				if err != nil {
+					return err
+				}
+				cfg.Routes = append(cfg.Routes, route)
+			}
+		}
+	}
+	return nil
+}
+
+// configSettings maps the attributes of the oncall block to the fields of
+// cfg they set
+func configSettings(cfg *server.Config) map[string]interface{} {
+	return map[string]interface{}{
+		"listen":                   &cfg.Listen,
+		"database":                 &cfg.Database,
+		"allow_labels":             &cfg.AllowLabels,
+		"deny_labels":              &cfg.DenyLabels,
+		"store_webhooks":           &cfg.StoreWebhooks,
+		"store_dead_letters":       &cfg.StoreDeadLetters,
+		"max_webhook_bytes":        &cfg.MaxWebhookBytes,
+		"max_annotation_length":    &cfg.MaxAnnotationLength,
+		"dedup_interval":           &cfg.DedupInterval,
+		"default_escalation_chain": &cfg.DefaultEscalationChain,
+		"webhook_pool":             &cfg.WebhookPool,
+		"webhook_pool_strategy":    &cfg.WebhookPoolStrategy,
+		"user_channels":            &cfg.UserChannels,
+		"default_user_channel":     &cfg.DefaultUserChannel,
+		"severity_multipliers":     &cfg.SeverityMultipliers,
+		"webhook_rate_limit":       &cfg.WebhookRateLimit,
+		"webhook_rate_burst":       &cfg.WebhookRateBurst,
+		"webhook_rate_limit_by":    &cfg.WebhookRateLimitBy,
+		"notify_throttle_limit":    &cfg.NotifyThrottleLimit,
+		"notify_throttle_window":   &cfg.NotifyThrottleWindow,
+		"notify_dedup_window":      &cfg.NotifyDedupWindow,
+		"notify_workers":           &cfg.NotifyWorkers,
+		"notify_queue_size":        &cfg.NotifyQueueSize,
+		"slack_signing_secret":     &cfg.SlackSigningSecret,
+		"webhook_signing_secret":   &cfg.WebhookSigningSecret,
+		"webhook_headers":          &cfg.WebhookHeaders,
+		"telegram_bot_token":       &cfg.TelegramBotToken,
+		"slack_template":           &cfg.SlackTemplate,
+		"webhook_template":         &cfg.WebhookTemplate,
+	}
+}
+
+func parseAPIKey(block *hcl.Block) (api.APIKey, error) {
+	key := api.APIKey{Name: block.Labels[0]}
+	content, diags := block.Body.Content(apiKeySchema)
+	if diags.HasErrors() {
+		return key, diags
+	}
+	if err := decodeAttr(content.Attributes["key"], &key.Key); err != nil {
+		return key, err
+	}
+	if key.Key == "" {
+		return key, fmt.Errorf("%s: api key %q is empty", content.Attributes["key"].Range, key.Name)
+	}
+	if attr, ok := content.Attributes["scopes"]; ok {
+		if err := decodeAttr(attr, &key.Scopes); err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+// parseRoute reads a route block. Without match it is the default route.
+func parseRoute(block *hcl.Block) (notifier.Route, error) {
+	var route notifier.Route
+	content, diags := block.Body.Content(routeSchema)
+	if diags.HasErrors() {
+		return route, diags
+	}
+	if attr, ok := content.Attributes["match"]; ok {
+		if err := decodeAttr(attr, &route.Matchers); err != nil {
+			return route, err
+		}
+	}
+
+	attr := content.Attributes["targets"]
+	var targets []string
+	if err := decodeAttr(attr, &targets); err != nil {
+		return route, err
+	}
+	if len(targets) == 0 {
+		return route, fmt.Errorf("%s: route has no targets", attr.Range)
+	}
+	for _, raw := range targets {
+		target, err := notifier.ParseTarget(raw)
+		if err != nil {
+			return route, fmt.Errorf("%s: %w", attr.Range, err)
+		}
+		route.Targets = append(route.Targets, target)
+	}
+	return route, nil
+}
+
+// decodeDuration reads a Go duration string such as "5m"
+func decodeDuration(attr *hcl.Attribute, target *time.Duration) error {
+	var raw string
+	if err := decodeAttr(attr, &raw); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return fmt.Errorf("%s: %s: invalid duration %q", attr.Range, attr.Name, raw)
+	}
+	*target = d
+	return nil
+}
+
+// decodeEndpoints reads a list of receiver URLs, each optionally suffixed
+// ;weight, see notifier.ParseEndpoint
+func decodeEndpoints(attr *hcl.Attribute, target *[]notifier.Endpoint) error {
+	var raw []string
+	if err := decodeAttr(attr, &raw); err != nil {
+		return err
+	}
+	endpoints := make([]notifier.Endpoint, 0, len(raw))
+	for _, r := range raw {
+		endpoint, err := notifier.ParseEndpoint(r)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", attr.Range, attr.Name, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	*target = endpoints
+	return nil
+}
+
+// decodeMultipliers reads a map of positive factors such as
+// { critical = 0.5 }
+func decodeMultipliers(attr *hcl.Attribute, target *map[string]float64) error {
+	var multipliers map[string]float64
+	if err := decodeAttr(attr, &multipliers); err != nil {
+		return err
+	}
+	for key, m := range multipliers {
+		if m <= 0 {
+			return fmt.Errorf("%s: %s: %s must be positive, got %v", attr.Range, attr.Name, key, m)
+		}
+	}
+	*target = multipliers
+	return nil
+}
+
+func decodeAttr(attr *hcl.Attribute, target interface{}) error {
+	value, diags := attr.Expr.Value(evalContext)
+	if diags.HasErrors() {
+		return diags
+	}
+	ty, err := gocty.ImpliedType(target)
+	if err != nil {
+		return err
+	}
+	// Converting first turns tuple literals such as ["read"] into lists
+	value, err = convert.Convert(value, ty)
+	if err == nil {
+		err = gocty.FromCtyValue(value, target)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", attr.Range, attr.Name, err)
+	}
+	return nil
+}
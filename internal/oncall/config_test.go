@@ -0,0 +1,228 @@
+package oncall
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/api"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+)
+
+func writeConfig(t *testing.T, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "oncall.hcl")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig_MissingFile(t *testing.T) {
+	cfg, err := loadConfig(filepath.Join(t.TempDir(), "oncall.hcl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":8080" || cfg.Database != "sqlite://oncall.db" || cfg.APIKeys != nil {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+	if cfg.WebhookRateBurst != 20 || cfg.WebhookRateLimitBy != api.RateLimitByIP ||
+		cfg.NotifyWorkers != notifier.DefaultAsyncWorkers || cfg.NotifyQueueSize != notifier.DefaultAsyncQueueSize {
+		t.Errorf("expected the default rate limit and queue settings, got %+v", cfg)
+	}
+}
+
+func TestLoadConfig_ServerSettings(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, `
+oncall {
+  allow_labels             = ["team", "env"]
+  deny_labels              = ["user_*"]
+  store_webhooks           = true
+  store_dead_letters       = true
+  max_webhook_bytes        = 1048576
+  max_annotation_length    = 2048
+  dedup_interval           = "4h"
+  default_escalation_chain = 3
+  webhook_pool             = ["https://hooks-1.example.com/alert", "https://hooks-2.example.com/alert;2"]
+  webhook_pool_strategy    = "weighted"
+  user_channels            = { alice = "webhook-pool" }
+  default_user_channel     = "webhook"
+  severity_multipliers     = { critical = 0.5, info = 2 }
+  webhook_rate_limit       = 5.5
+  webhook_rate_burst       = 50
+  webhook_rate_limit_by    = "integration"
+  notify_throttle_limit    = 5
+  notify_throttle_window   = "2m"
+  notify_workers           = 8
+  notify_queue_size        = 500
+}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cfg.AllowLabels, []string{"team", "env"}) || !reflect.DeepEqual(cfg.DenyLabels, []string{"user_*"}) {
+		t.Errorf("unexpected label filters %v %v", cfg.AllowLabels, cfg.DenyLabels)
+	}
+	if !cfg.StoreDeadLetters || cfg.MaxWebhookBytes != 1<<20 {
+		t.Errorf("unexpected webhook limits %+v", cfg)
+	}
+	if !cfg.StoreWebhooks || cfg.MaxAnnotationLength != 2048 || cfg.DedupInterval != 4*time.Hour || cfg.DefaultEscalationChain != 3 {
+		t.Errorf("unexpected alert settings %+v", cfg)
+	}
+	if len(cfg.WebhookPool) != 2 || cfg.WebhookPool[1].Weight != 2 || cfg.WebhookPoolStrategy != notifier.BalanceWeighted {
+		t.Errorf("unexpected webhook pool %+v %q", cfg.WebhookPool, cfg.WebhookPoolStrategy)
+	}
+	if cfg.UserChannels["alice"] != "webhook-pool" || cfg.DefaultUserChannel != "webhook" {
+		t.Errorf("unexpected user channels %v %q", cfg.UserChannels, cfg.DefaultUserChannel)
+	}
+	if !reflect.DeepEqual(cfg.SeverityMultipliers, map[string]float64{"critical": 0.5, "info": 2}) {
+		t.Errorf("unexpected severity multipliers %v", cfg.SeverityMultipliers)
+	}
+	if cfg.WebhookRateLimit != 5.5 || cfg.WebhookRateBurst != 50 || cfg.WebhookRateLimitBy != api.RateLimitByIntegration {
+		t.Errorf("unexpected webhook rate limit %v/%d by %q", cfg.WebhookRateLimit, cfg.WebhookRateBurst, cfg.WebhookRateLimitBy)
+	}
+	if cfg.NotifyThrottleLimit != 5 || cfg.NotifyThrottleWindow != 2*time.Minute || cfg.NotifyWorkers != 8 || cfg.NotifyQueueSize != 500 {
+		t.Errorf("unexpected notification settings %+v", cfg)
+	}
+}
+
+func TestLoadConfig_APIKeys(t *testing.T) {
+	t.Setenv("ONCALL_TEST_KEY", "from-env")
+	path := writeConfig(t, `
+oncall {
+  listen = ":9090"
+  slack_signing_secret = "signing"
+  webhook_signing_secret = "webhook-signing"
+  webhook_headers = { "X-Tenant-ID" = "payments" }
+  telegram_bot_token = "123:telegram"
+
+  notification {
+    slack {
+      webhook_url = env("SLACK_WEBHOOK_URL")
+    }
+  }
+
+  api_key "admin" {
+    key = env("ONCALL_TEST_KEY")
+  }
+
+  api_key "dashboard" {
+    key    = "read-only"
+    scopes = ["read"]
+  }
+}
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":9090" || cfg.Database != "sqlite://oncall.db" || cfg.SlackSigningSecret != "signing" ||
+		cfg.WebhookSigningSecret != "webhook-signing" || cfg.WebhookHeaders["X-Tenant-ID"] != "payments" ||
+		cfg.TelegramBotToken != "123:telegram" {
+		t.Errorf("unexpected listen, database, secrets or webhook headers: %+v", cfg)
+	}
+	want := []api.APIKey{
+		{Name: "admin", Key: "from-env"},
+		{Name: "dashboard", Key: "read-only", Scopes: []string{"read"}},
+	}
+	if !reflect.DeepEqual(cfg.APIKeys, want) {
+		t.Errorf("expected %+v, got %+v", want, cfg.APIKeys)
+	}
+}
+
+func TestLoadConfig_Routes(t *testing.T) {
+	path := writeConfig(t, `
+oncall {
+  route {
+    match   = { team = "payments", severity = "critical" }
+    targets = ["slack:https://hooks.slack.com/payments", "email:payments-oncall@example.com"]
+  }
+
+  route {
+    targets = ["webhook:https://alerts.example.com/hook"]
+  }
+}
+`)
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []notifier.Route{
+		{
+			Matchers: map[string]string{"team": "payments", "severity": "critical"},
+			Targets: []notifier.Target{
+				{Channel: "slack", Recipient: "https://hooks.slack.com/payments"},
+				{Channel: "email", Recipient: "payments-oncall@example.com"},
+			},
+		},
+		{Targets: []notifier.Target{{Channel: "webhook", Recipient: "https://alerts.example.com/hook"}}},
+	}
+	if !reflect.DeepEqual(cfg.Routes, want) {
+		t.Errorf("expected %+v, got %+v", want, cfg.Routes)
+	}
+}
+
+func TestLoadConfig_NotifyDedupWindow(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, `oncall { notify_dedup_window = "2m" }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.NotifyDedupWindow != 2*time.Minute {
+		t.Errorf("expected a 2m dedup window, got %s", cfg.NotifyDedupWindow)
+	}
+}
+
+func TestLoadConfig_Templates(t *testing.T) {
+	cfg, err := loadConfig(writeConfig(t, `oncall {
+  slack_template   = "{{ .Alert.Severity | toUpper }}: {{ .Labels.alertname }}"
+  webhook_template = "{{ .Labels.alertname }} is {{ .Alert.Status }}"
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SlackTemplate != "{{ .Alert.Severity | toUpper }}: {{ .Labels.alertname }}" {
+		t.Errorf("unexpected slack template %q", cfg.SlackTemplate)
+	}
+	if cfg.WebhookTemplate != "{{ .Labels.alertname }} is {{ .Alert.Status }}" {
+		t.Errorf("unexpected webhook template %q", cfg.WebhookTemplate)
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := map[string]string{
+		"syntax":      `oncall {`,
+		"missing key": `oncall { api_key "a" {} }`,
+		"unset env":   `oncall { api_key "a" { key = env("ONCALL_TEST_UNSET") } }`,
+		"bad scopes":  `oncall { api_key "a" { key = "k" scopes = "read" } }`,
+		"no targets":  `oncall { route { targets = [] } }`,
+		"bad target":  `oncall { route { targets = ["slack"] } }`,
+		"bad match":   `oncall { route { match = "team" targets = ["slack:x"] } }`,
+		"bad window":  `oncall { notify_dedup_window = "5 minutes" }`,
+		"bad burst":   `oncall { webhook_rate_burst = "lots" }`,
+		"bad factor":  `oncall { severity_multipliers = { critical = 0 } }`,
+		"bad pool":    `oncall { webhook_pool = ["https://hooks.example.com;x"] }`,
+	}
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadConfig(writeConfig(t, src)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Example(t *testing.T) {
+	cfg, err := loadConfig("../../examples/oncall.hcl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":8080" {
+		t.Errorf("expected the example's listen address, got %q", cfg.Listen)
+	}
+	if len(cfg.Routes) == 0 || cfg.WebhookRateLimit != 5 {
+		t.Errorf("expected the example's routes and settings, got %+v", cfg)
+	}
+}
@@ -0,0 +1,310 @@
+package oncall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/cobra"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/store"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// errChecksFailed is returned by doctor when any check fails, after the
+// report has been printed
+var errChecksFailed = errors.New("one or more checks failed")
+
+func newDoctorCommand() *cobra.Command {
+	var configFile string
+	var targets []string
+	var defaultChain int64
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check connectivity to the database and notification backends",
+		Long: `Run preflight checks: database connectivity and schema, reachability
+of notification targets, and presence of the environment variables the
+config file references. Exits non-zero if any check fails.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig(configFile)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			if defaultChain == 0 {
+				defaultChain = cfg.DefaultEscalationChain
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			d := doctor{
+				openStore: store.New,
+				client:    &http.Client{Timeout: timeout},
+				lookupEnv: os.LookupEnv,
+			}
+			results := d.run(ctx, doctorOptions{
+				database:     cfg.Database,
+				configFile:   configFile,
+				targets:      targets,
+				defaultChain: defaultChain,
+			})
+			return printReport(cmd.OutOrStdout(), results)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "oncall.hcl",
+		"Configuration file path")
+	cmd.Flags().StringSliceVar(&targets, "target", nil,
+		"Notification targets to probe, e.g. webhook:https://example.com/hook (comma-separated)")
+	cmd.Flags().Int64Var(&defaultChain, "default-escalation-chain", 0,
+		"Also probe the targets of this escalation chain (defaults to the config's default_escalation_chain)")
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second,
+		"Overall time limit for the checks")
+
+	return cmd
+}
+
+// checkResult is one line of the doctor report. A check with neither an
+// error nor Skipped set passed.
+type checkResult struct {
+	Name    string
+	Detail  string
+	Err     error
+	Skipped bool
+}
+
+type doctorOptions struct {
+	database     string
+	configFile   string
+	targets      []string
+	defaultChain int64
+}
+
+// doctor runs the preflight checks. Its dependencies are fields so tests
+// can swap them out.
+type doctor struct {
+	openStore func(dsn string) (*store.Store, error)
+	client    *http.Client
+	lookupEnv func(key string) (string, bool)
+}
+
+func (d doctor) run(ctx context.Context, opts doctorOptions) []checkResult {
+	result, st := d.checkDatabase(ctx, opts.database)
+	results := []checkResult{result}
+
+	targets := append([]string(nil), opts.targets...)
+	if opts.defaultChain != 0 {
+		chainTargets, result := chainTargets(ctx, st, opts.defaultChain)
+		if result != nil {
+			results = append(results, *result)
+		}
+		targets = append(targets, chainTargets...)
+	}
+	if st != nil {
+		st.Close()
+	}
+
+	for _, target := range targets {
+		results = append(results, d.checkTarget(ctx, target))
+	}
+
+	return append(results, d.checkEnv(opts.configFile)...)
+}
+
+// checkDatabase opens the store, which applies migrations, and confirms the
+// schema is complete. The store is returned open on success.
+func (d doctor) checkDatabase(ctx context.Context, dsn string) (checkResult, *store.Store) {
+	result := checkResult{Name: "database", Detail: dsn}
+
+	st, err := d.openStore(dsn)
+	if err != nil {
+		result.Err = err
+		return result, nil
+	}
+	if err := st.DB().PingContext(ctx); err != nil {
+		st.Close()
+		result.Err = fmt.Errorf("ping failed: %w", err)
+		return result, nil
+	}
+
+	missing, err := st.MissingTables(ctx)
+	if err != nil {
+		st.Close()
+		result.Err = err
+		return result, nil
+	}
+	if len(missing) > 0 {
+		st.Close()
+		result.Err = fmt.Errorf("schema incomplete, missing tables: %s", strings.Join(missing, ", "))
+		return result, nil
+	}
+
+	version, err := st.SchemaVersion(ctx)
+	if err != nil {
+		st.Close()
+		result.Err = err
+		return result, nil
+	}
+	result.Detail += fmt.Sprintf(": connected, schema up to date (version %d)", version)
+	return result, st
+}
+
+// chainTargets returns the notify targets of an escalation chain. A failed
+// lookup is reported as a check result.
+func chainTargets(ctx context.Context, st *store.Store, chainID int64) ([]string, *checkResult) {
+	result := &checkResult{Name: fmt.Sprintf("escalation chain %d", chainID)}
+	if st == nil {
+		result.Skipped = true
+		result.Detail = "database unavailable"
+		return nil, result
+	}
+
+	chain, err := st.GetEscalationChain(ctx, chainID)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to load: %w", err)
+		return nil, result
+	}
+
+	var targets []string
+	for _, policy := range chain.Policies {
+		if policy.PolicyType == models.PolicyNotifyUser || policy.PolicyType == models.PolicyNotifyChannel {
+			targets = append(targets, policy.Target)
+		}
+	}
+	return targets, nil
+}
+
+// checkTarget probes a "channel:recipient" target. HTTP recipients pass if
+// the server answers at all below 500; other channels have no probe.
+func (d doctor) checkTarget(ctx context.Context, target string) checkResult {
+	// Notification URLs often embed credentials, so only the channel and
+	// host are shown
+	result := checkResult{Name: "notifier"}
+
+	channel, recipient, ok := strings.Cut(target, ":")
+	if !ok || channel == "" {
+		result.Err = fmt.Errorf("invalid target, expected channel:recipient")
+		return result
+	}
+	result.Name = "notifier " + channel
+
+	if !strings.HasPrefix(recipient, "http://") && !strings.HasPrefix(recipient, "https://") {
+		result.Skipped = true
+		result.Detail = fmt.Sprintf("no reachability check for %s recipients", channel)
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, recipient, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Detail = req.URL.Host
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		result.Err = fmt.Errorf("unreachable: %w", err)
+		return result
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		result.Err = fmt.Errorf("%s answered with status %d", req.URL.Host, resp.StatusCode)
+		return result
+	}
+	result.Detail = fmt.Sprintf("%s reachable (status %d)", req.URL.Host, resp.StatusCode)
+	return result
+}
+
+// checkEnv reports whether every environment variable the config file
+// reads through env("NAME") is set. These hold webhook URLs and API keys.
+func (d doctor) checkEnv(configFile string) []checkResult {
+	src, err := os.ReadFile(configFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return []checkResult{{Name: "config", Detail: configFile + " not found, skipping env checks", Skipped: true}}
+	}
+	if err != nil {
+		return []checkResult{{Name: "config", Err: err}}
+	}
+
+	names, err := envReferences(src, configFile)
+	if err != nil {
+		return []checkResult{{Name: "config", Err: err}}
+	}
+
+	var results []checkResult
+	for _, name := range names {
+		result := checkResult{Name: "env " + name, Detail: "set"}
+		if value, ok := d.lookupEnv(name); !ok || value == "" {
+			result.Detail = ""
+			result.Err = fmt.Errorf("not set")
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// envReferences returns the sorted, unique names passed as literals to
+// env() in an HCL config
+func envReferences(src []byte, filename string) ([]string, error) {
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	seen := make(map[string]bool)
+	hclsyntax.VisitAll(file.Body.(*hclsyntax.Body), func(node hclsyntax.Node) hcl.Diagnostics {
+		call, ok := node.(*hclsyntax.FunctionCallExpr)
+		if !ok || call.Name != "env" || len(call.Args) != 1 {
+			return nil
+		}
+		value, diags := call.Args[0].Value(nil)
+		if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+			return nil
+		}
+		seen[value.AsString()] = true
+		return nil
+	})
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// printReport writes one line per check and returns errChecksFailed if any
+// check failed
+func printReport(out io.Writer, results []checkResult) error {
+	failed := 0
+	for _, r := range results {
+		status, detail := "PASS", r.Detail
+		switch {
+		case r.Err != nil:
+			status, detail = "FAIL", r.Err.Error()
+			failed++
+		case r.Skipped:
+			status = "SKIP"
+		}
+		fmt.Fprintf(out, "%-4s  %-28s %s\n", status, r.Name, detail)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(out, "\n%d of %d checks failed\n", failed, len(results))
+		return errChecksFailed
+	}
+	fmt.Fprintf(out, "\nall %d checks passed\n", len(results))
+	return nil
+}
@@ -0,0 +1,189 @@
+package oncall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/store"
+)
+
+func testDoctor() doctor {
+	return doctor{
+		openStore: store.New,
+		client:    http.DefaultClient,
+		lookupEnv: func(string) (string, bool) { return "", false },
+	}
+}
+
+func TestDoctor_CheckDatabase(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+
+	result, st := testDoctor().checkDatabase(context.Background(), dsn)
+	if result.Err != nil {
+		t.Fatalf("expected database check to pass, got %v", result.Err)
+	}
+	if st == nil {
+		t.Fatal("expected open store on success")
+	}
+	st.Close()
+
+	d := testDoctor()
+	d.openStore = func(string) (*store.Store, error) { return nil, errors.New("connection refused") }
+	result, st = d.checkDatabase(context.Background(), dsn)
+	if result.Err == nil || st != nil {
+		t.Errorf("expected failure without store, got err=%v store=%v", result.Err, st)
+	}
+}
+
+func TestDoctor_CheckTarget(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("expected HEAD probe, got %s", r.Method)
+		}
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer ok.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	tests := []struct {
+		target  string
+		fail    bool
+		skipped bool
+	}{
+		{target: "webhook:" + ok.URL + "/hook"},
+		{target: "slack:" + broken.URL, fail: true},
+		{target: "webhook:" + closedURL, fail: true},
+		{target: "email:oncall@example.com", skipped: true},
+		{target: "no-channel", fail: true},
+	}
+
+	d := testDoctor()
+	for _, tt := range tests {
+		result := d.checkTarget(context.Background(), tt.target)
+		if (result.Err != nil) != tt.fail {
+			t.Errorf("%s: expected fail=%v, got err=%v", tt.target, tt.fail, result.Err)
+		}
+		if result.Skipped != tt.skipped {
+			t.Errorf("%s: expected skipped=%v, got %v", tt.target, tt.skipped, result.Skipped)
+		}
+	}
+}
+
+func TestDoctor_ChainTargets(t *testing.T) {
+	st, err := store.New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	ctx := context.Background()
+	chain := &models.EscalationChain{
+		Name: "primary",
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:https://hooks.example.com/a"},
+			{StepNumber: 2, PolicyType: models.PolicyWait, WaitSeconds: 60},
+			{StepNumber: 3, PolicyType: models.PolicyNotifyUser, Target: "email:alice@example.com"},
+		},
+	}
+	if err := st.CreateEscalationChain(ctx, chain); err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+
+	targets, result := chainTargets(ctx, st, chain.ID)
+	if result != nil {
+		t.Fatalf("expected no failure, got %+v", result)
+	}
+	if got := strings.Join(targets, ","); got != "slack:https://hooks.example.com/a,email:alice@example.com" {
+		t.Errorf("unexpected targets %s", got)
+	}
+
+	if _, result := chainTargets(ctx, st, 999); result == nil || result.Err == nil {
+		t.Error("expected failure for missing chain")
+	}
+	if _, result := chainTargets(ctx, nil, chain.ID); result == nil || !result.Skipped {
+		t.Error("expected skip without a database")
+	}
+}
+
+func TestDoctor_CheckEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oncall.hcl")
+	config := `
+notifier "slack" {
+  webhook_url = env("SLACK_WEBHOOK_URL")
+}
+
+notifier "email" {
+  password = env("SMTP_PASS")
+  username = env("SLACK_WEBHOOK_URL") == "" ? "a" : "b"
+}
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := testDoctor()
+	d.lookupEnv = func(key string) (string, bool) {
+		if key == "SLACK_WEBHOOK_URL" {
+			return "https://hooks.example.com", true
+		}
+		return "", false
+	}
+
+	results := d.checkEnv(path)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 env checks, got %+v", results)
+	}
+	if results[0].Name != "env SLACK_WEBHOOK_URL" || results[0].Err != nil {
+		t.Errorf("expected SLACK_WEBHOOK_URL to pass, got %+v", results[0])
+	}
+	if results[1].Name != "env SMTP_PASS" || results[1].Err == nil {
+		t.Errorf("expected SMTP_PASS to fail, got %+v", results[1])
+	}
+
+	results = d.checkEnv(filepath.Join(t.TempDir(), "missing.hcl"))
+	if len(results) != 1 || !results[0].Skipped {
+		t.Errorf("expected missing config to be skipped, got %+v", results)
+	}
+}
+
+func TestPrintReport(t *testing.T) {
+	var out bytes.Buffer
+	err := printReport(&out, []checkResult{
+		{Name: "database", Detail: "connected"},
+		{Name: "notifier email", Skipped: true},
+	})
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if !strings.Contains(out.String(), "all 2 checks passed") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+
+	out.Reset()
+	err = printReport(&out, []checkResult{
+		{Name: "database", Detail: "connected"},
+		{Name: "env SMTP_PASS", Err: errors.New("not set")},
+	})
+	if !errors.Is(err, errChecksFailed) {
+		t.Errorf("expected errChecksFailed, got %v", err)
+	}
+	if !strings.Contains(out.String(), "FAIL  env SMTP_PASS") {
+		t.Errorf("expected failure line, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,279 @@
+package escalation
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/vjranagit/grafana/internal/logging"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// Route sends alerts whose labels include every Matchers pair to Chain
+type Route struct {
+	Matchers map[string]string
+	Chain    *models.EscalationChain
+}
+
+// Router picks the escalation chain for an alert. Routes are tried in
+// order and the fallback chain, if any, catches everything else.
+type Router struct {
+	routes   []Route
+	fallback *models.EscalationChain
+}
+
+func NewRouter(routes []Route, fallback *models.EscalationChain) *Router {
+	return &Router{routes: routes, fallback: fallback}
+}
+
+// Match returns the chain for alert, or nil if nothing routes it
+func (r *Router) Match(alert *models.AlertGroup) *models.EscalationChain {
+	for _, route := range r.routes {
+		matched := true
+		for name, value := range route.Matchers {
+			if alert.Labels[name] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route.Chain
+		}
+	}
+	return r.fallback
+}
+
+// Chain returns the routed or fallback chain with the given ID, or nil
+func (r *Router) Chain(id int64) *models.EscalationChain {
+	for _, route := range r.routes {
+		if route.Chain != nil && route.Chain.ID == id {
+			return route.Chain
+		}
+	}
+	if r.fallback != nil && r.fallback.ID == id {
+		return r.fallback
+	}
+	return nil
+}
+
+// ChainSource loads escalation chains by ID. store.Store implements it.
+type ChainSource interface {
+	GetEscalationChain(ctx context.Context, id int64) (*models.EscalationChain, error)
+}
+
+// Dispatcher routes firing alerts and runs their escalation chains in the
+// background until the alert is handled or the dispatcher is closed. Each
+// alert has at most one escalation running at a time.
+type Dispatcher struct {
+	router *Router
+	engine *Engine
+	chains ChainSource
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[int64]struct{} // alert IDs with an escalation running
+}
+
+func NewDispatcher(router *Router, engine *Engine) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		router:  router,
+		engine:  engine,
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[int64]struct{}),
+	}
+}
+
+// SetChainSource lets alerts that name their escalation chain, such as
+// those from an integration with one, use chains the router doesn't know
+func (d *Dispatcher) SetChainSource(chains ChainSource) {
+	d.chains = chains
+}
+
+// Dispatch starts escalating alert and reports whether a chain matched.
+// An alert with an EscalationChainID runs that chain; others are routed by
+// their labels. An alert already escalating, e.g. one re-fired after the
+// dedup interval, keeps its running escalation instead of starting another. The escalation outlives ctx but logs with its attributes,
+// e.g. the request ID of the webhook that fired the alert.
+func (d *Dispatcher) Dispatch(ctx context.Context, alert *models.AlertGroup) bool {
+	chain := d.router.Match(alert)
+	if alert.EscalationChainID != nil {
+		if named := d.chainByID(*alert.EscalationChainID); named != nil {
+			chain = named
+		} else {
+			slog.WarnContext(ctx, "alert names an unknown escalation chain, routing by labels",
+				"alert", alert.Fingerprint,
+				"chain", *alert.EscalationChainID)
+		}
+	}
+	if chain == nil {
+		slog.WarnContext(ctx, "no escalation chain matches alert",
+			"alert", alert.Fingerprint)
+		return false
+	}
+
+	d.start(ctx, alert, chain, 0)
+	return true
+}
+
+// Resume restarts the escalations recorded in the engine's progress store
+// for alerts still firing, each from the step it was on when the previous
+// process stopped. It returns the number resumed. Progress for handled
+// alerts and for chains the router no longer knows is dropped.
+func (d *Dispatcher) Resume(ctx context.Context) (int, error) {
+	if d.engine.progress == nil {
+		return 0, nil
+	}
+
+	pending, err := d.engine.progress.ListEscalationProgress(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load escalation progress: %w", err)
+	}
+
+	resumed := 0
+	for _, p := range pending {
+		chain := d.chainByID(p.ChainID)
+		if chain == nil || p.Alert == nil {
+			slog.Warn("dropping escalation progress for unknown chain",
+				"alert_group", p.AlertGroupID,
+				"chain", p.ChainID)
+			if err := d.engine.progress.DeleteEscalationProgress(ctx, p.AlertGroupID); err != nil {
+				return resumed, err
+			}
+			continue
+		}
+
+		// Alerts handled while the server was down need no escalation
+		handled, err := d.engine.isHandled(ctx, p.Alert)
+		if err != nil {
+			return resumed, err
+		}
+		if handled {
+			if err := d.engine.progress.DeleteEscalationProgress(ctx, p.AlertGroupID); err != nil {
+				return resumed, err
+			}
+			continue
+		}
+
+		if !d.start(ctx, p.Alert, chain, p.NextStep) {
+			continue
+		}
+		slog.Info("resuming escalation",
+			"alert", p.Alert.Fingerprint,
+			"chain", chain.ID,
+			"step", p.NextStep)
+		resumed++
+	}
+	return resumed, nil
+}
+
+// chainByID returns the chain with the given ID from the router or, failing
+// that, the chain source. It returns nil if neither has it.
+func (d *Dispatcher) chainByID(id int64) *models.EscalationChain {
+	if chain := d.router.Chain(id); chain != nil {
+		return chain
+	}
+	if d.chains == nil {
+		return nil
+	}
+	chain, err := d.chains.GetEscalationChain(d.ctx, id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("failed to load escalation chain", "chain", id, "error", err)
+		}
+		return nil
+	}
+	return chain
+}
+
+// escalationContext returns the context alert's escalation runs with: the
+// dispatcher's, so Close stops it, with the log attributes of ctx and the
+// alert's fingerprint
+func (d *Dispatcher) escalationContext(ctx context.Context, alert *models.AlertGroup) context.Context {
+	escalation := logging.WithAttrs(d.ctx, logging.Attrs(ctx)...)
+	return logging.WithAttrs(escalation, slog.String("fingerprint", alert.Fingerprint))
+}
+
+// start runs chain for alert in the background from step number from. It
+// reports false, starting nothing, if alert is already escalating.
+func (d *Dispatcher) start(ctx context.Context, alert *models.AlertGroup, chain *models.EscalationChain, from int) bool {
+	ctx = d.escalationContext(ctx, alert)
+
+	d.mu.Lock()
+	if _, ok := d.running[alert.ID]; ok {
+		d.mu.Unlock()
+		slog.DebugContext(ctx, "alert is already escalating",
+			"alert", alert.Fingerprint,
+			"chain", chain.ID)
+		return false
+	}
+	d.running[alert.ID] = struct{}{}
+	d.wg.Add(1)
+	d.mu.Unlock()
+
+	go func() {
+		defer d.wg.Done()
+		defer func() {
+			d.mu.Lock()
+			delete(d.running, alert.ID)
+			d.mu.Unlock()
+		}()
+		if err := d.engine.runFrom(ctx, alert, chain, from); err != nil && d.ctx.Err() == nil {
+			slog.ErrorContext(ctx, "escalation failed",
+				"alert", alert.Fingerprint,
+				"chain", chain.ID,
+				"error", err)
+		}
+	}()
+	return true
+}
+
+// Resolve sends resolve notifications for alert to everyone its
+// escalation paged. A running escalation stops on its own once it sees
+// the stored status.
+func (d *Dispatcher) Resolve(ctx context.Context, alert *models.AlertGroup) {
+	ctx = d.escalationContext(ctx, alert)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.engine.Resolve(ctx, alert)
+	}()
+}
+
+// ActiveEscalations returns the number of escalation chains still running
+func (d *Dispatcher) ActiveEscalations() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.running)
+}
+
+// Close stops running escalations and waits for them to exit
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// Shutdown stops running escalations like Close, but waits for them to
+// checkpoint their progress only until ctx is done
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
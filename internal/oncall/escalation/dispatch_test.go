@@ -0,0 +1,287 @@
+package escalation
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func TestRouter_Match(t *testing.T) {
+	database := &models.EscalationChain{ID: 1}
+	critical := &models.EscalationChain{ID: 2}
+	fallback := &models.EscalationChain{ID: 3}
+
+	router := NewRouter([]Route{
+		{Matchers: map[string]string{"team": "database"}, Chain: database},
+		{Matchers: map[string]string{"severity": "critical"}, Chain: critical},
+	}, fallback)
+
+	tests := []struct {
+		labels map[string]string
+		want   *models.EscalationChain
+	}{
+		{map[string]string{"team": "database", "severity": "critical"}, database},
+		{map[string]string{"team": "web", "severity": "critical"}, critical},
+		{map[string]string{"team": "web"}, fallback},
+	}
+	for _, tt := range tests {
+		if got := router.Match(&models.AlertGroup{Labels: tt.labels}); got != tt.want {
+			t.Errorf("labels %v: expected chain %d, got %v", tt.labels, tt.want.ID, got)
+		}
+	}
+
+	if NewRouter(nil, nil).Match(&models.AlertGroup{}) != nil {
+		t.Error("expected no chain without routes or fallback")
+	}
+}
+
+func TestDispatcher_ActiveEscalations(t *testing.T) {
+	status := &mockStatus{status: "firing"}
+	engine := NewEngine(&mockSender{}, status)
+	chain := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyWait, WaitSeconds: 3600},
+	}}
+	d := NewDispatcher(NewRouter(nil, chain), engine)
+
+	for i := 0; i < 2; i++ {
+		if !d.Dispatch(context.Background(), &models.AlertGroup{ID: int64(i + 1), Severity: "warning"}) {
+			t.Fatal("expected the fallback chain to match")
+		}
+	}
+	if got := d.ActiveEscalations(); got != 2 {
+		t.Errorf("expected 2 active escalations, got %d", got)
+	}
+
+	d.Close()
+	if got := d.ActiveEscalations(); got != 0 {
+		t.Errorf("expected no active escalations after close, got %d", got)
+	}
+}
+
+func TestDispatcher_SkipsRunningEscalation(t *testing.T) {
+	sender := &mockSender{}
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+	chain := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#general"},
+		{StepNumber: 2, PolicyType: models.PolicyWait, WaitSeconds: 3600},
+	}}
+	d := NewDispatcher(NewRouter(nil, chain), engine)
+	defer d.Close()
+
+	alert := &models.AlertGroup{ID: 1, Fingerprint: "a", Severity: "warning"}
+	for i := 0; i < 3; i++ {
+		if !d.Dispatch(context.Background(), alert) {
+			t.Fatal("expected the fallback chain to match")
+		}
+	}
+	if got := d.ActiveEscalations(); got != 1 {
+		t.Errorf("expected 1 active escalation, got %d", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(sender.recipients()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := sender.recipients(); len(got) != 1 {
+		t.Errorf("expected one page, got %v", got)
+	}
+}
+
+func TestDispatcher_RedispatchAfterEscalationEnds(t *testing.T) {
+	sender := &mockSender{}
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+	chain := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#general"},
+	}}
+	d := NewDispatcher(NewRouter(nil, chain), engine)
+	defer d.Close()
+
+	alert := &models.AlertGroup{ID: 1, Fingerprint: "a", Severity: "warning"}
+	for i := 0; i < 2; i++ {
+		d.Dispatch(context.Background(), alert)
+		deadline := time.Now().Add(time.Second)
+		for d.ActiveEscalations() > 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	if got := sender.recipients(); len(got) != 2 {
+		t.Errorf("expected a page per finished escalation, got %v", got)
+	}
+}
+
+func TestDispatcher_Resume(t *testing.T) {
+	sender := &mockSender{}
+	progress := newMockProgress()
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+	engine.SetProgressStore(progress)
+
+	chain := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "email:alice"},
+		{StepNumber: 2, PolicyType: models.PolicyWait, WaitSeconds: 60},
+		{StepNumber: 3, PolicyType: models.PolicyNotifyUser, Target: "email:bob"},
+	}}
+	ctx := context.Background()
+	progress.SaveEscalationProgress(ctx, &models.EscalationProgress{
+		AlertGroupID: 1, ChainID: 1, NextStep: 3, Alert: &models.AlertGroup{ID: 1, Fingerprint: "a"},
+	})
+	progress.SaveEscalationProgress(ctx, &models.EscalationProgress{
+		AlertGroupID: 2, ChainID: 99, NextStep: 1, Alert: &models.AlertGroup{ID: 2, Fingerprint: "b"},
+	})
+
+	d := NewDispatcher(NewRouter(nil, chain), engine)
+	resumed, err := d.Resume(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for d.ActiveEscalations() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	d.Close()
+
+	if resumed != 1 {
+		t.Errorf("expected 1 resumed escalation, got %d", resumed)
+	}
+	// Steps before the saved one aren't repeated
+	if got := sender.recipients(); !reflect.DeepEqual(got, []string{"email:bob"}) {
+		t.Errorf("expected only step 3 to run, got %v", got)
+	}
+	if progress.get(1) != nil {
+		t.Error("expected resumed escalation to clear its progress")
+	}
+	if progress.get(2) != nil {
+		t.Error("expected progress for an unknown chain to be dropped")
+	}
+}
+
+func TestDispatcher_ShutdownCheckpointsAndResumes(t *testing.T) {
+	sender := &mockSender{}
+	progress := newMockProgress()
+	paged := make(chan struct{}, 1)
+	sender.onSend = func(string) { paged <- struct{}{} }
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+	engine.SetProgressStore(progress)
+
+	chain := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "email:alice"},
+		{StepNumber: 2, PolicyType: models.PolicyWait, WaitSeconds: 3600},
+		{StepNumber: 3, PolicyType: models.PolicyNotifyUser, Target: "email:bob"},
+	}}
+	d := NewDispatcher(NewRouter(nil, chain), engine)
+	d.Dispatch(context.Background(), &models.AlertGroup{ID: 1, Fingerprint: "a", Severity: "warning"})
+	<-paged
+	// Let the escalation reach the wait before shutting down mid-wait
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("expected escalations to checkpoint before the deadline, got %v", err)
+	}
+	if p := progress.get(1); p == nil || p.NextStep != 2 {
+		t.Fatalf("expected the interrupted wait checkpointed as the next step, got %+v", p)
+	}
+
+	// A restarted server picks up at the wait, shortened here so the test
+	// doesn't take an hour, and doesn't page alice again
+	restarted := newTestEngine(sender, &mockStatus{status: "firing"})
+	restarted.SetProgressStore(progress)
+	short := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		chain.Policies[0],
+		{StepNumber: 2, PolicyType: models.PolicyWait, WaitSeconds: 0},
+		chain.Policies[2],
+	}}
+	d = NewDispatcher(NewRouter(nil, short), restarted)
+	if resumed, err := d.Resume(context.Background()); err != nil || resumed != 1 {
+		t.Fatalf("expected 1 resumed escalation, got %d, %v", resumed, err)
+	}
+	<-paged
+	d.Close()
+
+	if got := sender.recipients(); !reflect.DeepEqual(got, []string{"email:alice", "email:bob"}) {
+		t.Errorf("expected alice then bob paged once each, got %v", got)
+	}
+	if progress.get(1) != nil {
+		t.Error("expected the resumed escalation to clear its progress")
+	}
+}
+
+func TestDispatcher_ResumeSkipsHandledAlerts(t *testing.T) {
+	sender := &mockSender{}
+	progress := newMockProgress()
+	engine := newTestEngine(sender, &mockStatus{status: "resolved"})
+	engine.SetProgressStore(progress)
+
+	chain := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "email:alice"},
+	}}
+	progress.SaveEscalationProgress(context.Background(), &models.EscalationProgress{
+		AlertGroupID: 1, ChainID: 1, NextStep: 1, Alert: &models.AlertGroup{ID: 1, Fingerprint: "a"},
+	})
+
+	d := NewDispatcher(NewRouter(nil, chain), engine)
+	defer d.Close()
+	resumed, err := d.Resume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed != 0 || progress.get(1) != nil {
+		t.Errorf("expected the resolved alert's progress dropped, resumed %d", resumed)
+	}
+	if got := sender.recipients(); len(got) != 0 {
+		t.Errorf("expected nobody paged, got %v", got)
+	}
+}
+
+// mockChains serves escalation chains by ID
+type mockChains map[int64]*models.EscalationChain
+
+func (m mockChains) GetEscalationChain(ctx context.Context, id int64) (*models.EscalationChain, error) {
+	chain, ok := m[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return chain, nil
+}
+
+func TestDispatcher_NamedChain(t *testing.T) {
+	sender := &mockSender{}
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+
+	fallback := &models.EscalationChain{ID: 1, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#general"},
+	}}
+	database := &models.EscalationChain{ID: 2, Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#database"},
+	}}
+	d := NewDispatcher(NewRouter(nil, fallback), engine)
+	d.SetChainSource(mockChains{2: database})
+
+	run := func(alert *models.AlertGroup) {
+		t.Helper()
+		if !d.Dispatch(context.Background(), alert) {
+			t.Fatal("expected a chain to match")
+		}
+		deadline := time.Now().Add(time.Second)
+		for d.ActiveEscalations() > 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	named, unknown := int64(2), int64(99)
+	run(&models.AlertGroup{ID: 1, EscalationChainID: &named})
+	run(&models.AlertGroup{ID: 2, EscalationChainID: &unknown})
+	run(&models.AlertGroup{ID: 3})
+	d.Close()
+
+	// An unknown chain falls back to label routing
+	want := []string{"slack:#database", "slack:#general", "slack:#general"}
+	if got := sender.recipients(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
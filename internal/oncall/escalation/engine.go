@@ -0,0 +1,447 @@
+package escalation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// Sender dispatches a notification on a channel. notifier.Manager
+// implements it.
+type Sender interface {
+	Send(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error
+}
+
+// StatusSource reports the current status of an alert. store.Store
+// implements it.
+type StatusSource interface {
+	AlertStatus(ctx context.Context, alertID int64) (string, error)
+}
+
+// ProgressStore persists how far each escalation has got so a restarted
+// server can resume it. store.Store implements it.
+type ProgressStore interface {
+	SaveEscalationProgress(ctx context.Context, progress *models.EscalationProgress) error
+	DeleteEscalationProgress(ctx context.Context, alertGroupID int64) error
+	ListEscalationProgress(ctx context.Context) ([]*models.EscalationProgress, error)
+}
+
+// ScheduleSource loads on-call schedules for notify_schedule steps.
+// store.Store implements it.
+type ScheduleSource interface {
+	GetSchedule(ctx context.Context, id int64) (*models.Schedule, error)
+}
+
+// DefaultUserChannel is the channel a new Engine pages an on-call user with
+// no preferred channel set on, see SetDefaultUserChannel
+const DefaultUserChannel = "email"
+
+// checkpointTimeout bounds saving an interrupted escalation's progress
+const checkpointTimeout = 5 * time.Second
+
+// Engine walks escalation chains for firing alerts
+type Engine struct {
+	sender       Sender
+	status       StatusSource
+	pollInterval time.Duration
+	multipliers  map[string]float64
+	progress     ProgressStore
+	schedules    ScheduleSource
+	userChannels map[string]string
+	// defaultChannel pages users missing from userChannels; empty skips them
+	defaultChannel string
+
+	// notified tracks the targets paged for each alert fingerprint so they
+	// can be told when it resolves
+	mu       sync.Mutex
+	notified map[string][]string
+}
+
+func NewEngine(sender Sender, status StatusSource) *Engine {
+	return &Engine{
+		sender:       sender,
+		status:       status,
+		pollInterval: 5 * time.Second,
+		notified:     make(map[string][]string),
+
+		defaultChannel: DefaultUserChannel,
+	}
+}
+
+// SetSeverityMultipliers scales wait steps by alert severity so one chain
+// can escalate critical alerts faster than the rest, e.g. {"critical": 0.5}.
+// Severities not listed, and every severity by default, wait exactly as
+// configured.
+func (e *Engine) SetSeverityMultipliers(multipliers map[string]float64) {
+	e.multipliers = multipliers
+}
+
+// SetProgressStore persists escalation progress to progress before each
+// step. Without one, escalations in flight are lost on restart.
+func (e *Engine) SetProgressStore(progress ProgressStore) {
+	e.progress = progress
+}
+
+// SetSchedules lets notify_schedule steps look up who is on call. Without
+// it those steps are skipped.
+func (e *Engine) SetSchedules(schedules ScheduleSource) {
+	e.schedules = schedules
+}
+
+// SetUserChannels sets the channel each user prefers to be paged on by
+// notify_schedule steps, keyed by user ID. Users not listed are paged on
+// the default user channel.
+func (e *Engine) SetUserChannels(channels map[string]string) {
+	e.userChannels = channels
+}
+
+// SetDefaultUserChannel sets the channel notify_schedule steps page users
+// without a channel of their own on. Empty skips those steps for them.
+func (e *Engine) SetDefaultUserChannel(channel string) {
+	e.defaultChannel = channel
+}
+
+// effectiveWait returns the wait for policy scaled by the alert's severity
+func (e *Engine) effectiveWait(alert *models.AlertGroup, policy models.EscalationPolicy) time.Duration {
+	wait := time.Duration(policy.WaitSeconds) * time.Second
+	if m, ok := e.multipliers[alert.Severity]; ok && m > 0 {
+		wait = time.Duration(float64(wait) * m)
+	}
+	return wait
+}
+
+// Run executes the chain's policies in step order for alert. It returns
+// early once the alert is acknowledged or resolved, and when ctx is
+// cancelled.
+func (e *Engine) Run(ctx context.Context, alert *models.AlertGroup, chain *models.EscalationChain) error {
+	return e.runFrom(ctx, alert, chain, 0)
+}
+
+// runFrom runs the chain's policies from step number from onwards. Progress
+// is saved before each step and cleared once the escalation finishes, but
+// kept when ctx is cancelled so a restart picks up after the last completed
+// step: an interrupted wait starts over, while a notify step interrupted
+// during its ack window isn't paged again.
+func (e *Engine) runFrom(ctx context.Context, alert *models.AlertGroup, chain *models.EscalationChain, from int) error {
+	finished, err := e.runPolicies(ctx, alert, chain, from)
+	if finished {
+		e.clearProgress(alert)
+	}
+	return err
+}
+
+// runPolicies walks the policies and reports whether the escalation is over,
+// either completed or stopped because the alert was handled
+func (e *Engine) runPolicies(ctx context.Context, alert *models.AlertGroup, chain *models.EscalationChain, from int) (bool, error) {
+	policies := make([]models.EscalationPolicy, len(chain.Policies))
+	copy(policies, chain.Policies)
+	sort.SliceStable(policies, func(i, j int) bool {
+		return policies[i].StepNumber < policies[j].StepNumber
+	})
+
+	for i, policy := range policies {
+		if policy.StepNumber < from {
+			continue
+		}
+
+		handled, err := e.isHandled(ctx, alert)
+		if err != nil {
+			return false, err
+		}
+		if handled {
+			slog.InfoContext(ctx, "stopping escalation, alert handled",
+				"alert", alert.Fingerprint,
+				"chain", chain.ID,
+				"step", policy.StepNumber)
+			return true, nil
+		}
+		e.saveProgress(ctx, alert, chain, policy.StepNumber)
+
+		switch policy.PolicyType {
+		case models.PolicyWait:
+			if err := sleep(ctx, e.effectiveWait(alert, policy)); err != nil {
+				// The wait didn't complete, so a restart waits again
+				e.checkpoint(ctx, alert, chain, policy.StepNumber)
+				return false, err
+			}
+
+		case models.PolicyNotifyUser, models.PolicyNotifyChannel, models.PolicyNotifySchedule:
+			target := policy.Target
+			if policy.PolicyType == models.PolicyNotifySchedule {
+				var ok bool
+				if target, ok = e.oncallTarget(ctx, policy); !ok {
+					continue
+				}
+			}
+			e.notify(ctx, alert, policy.StepNumber, target)
+
+			if policy.AckTimeoutSeconds > 0 {
+				acked, err := e.waitForAck(ctx, alert, time.Duration(policy.AckTimeoutSeconds)*time.Second)
+				if err != nil {
+					if ctx.Err() == nil {
+						return false, err
+					}
+					// The page went out, so a restart moves on rather than
+					// paging again
+					if i+1 == len(policies) {
+						return true, err
+					}
+					e.checkpoint(ctx, alert, chain, policies[i+1].StepNumber)
+					return false, err
+				}
+				if acked {
+					slog.InfoContext(ctx, "stopping escalation, alert handled within ack window",
+						"alert", alert.Fingerprint,
+						"chain", chain.ID,
+						"step", policy.StepNumber)
+					return true, nil
+				}
+			}
+
+		default:
+			slog.WarnContext(ctx, "skipping unknown escalation policy type",
+				"type", policy.PolicyType,
+				"chain", chain.ID,
+				"step", policy.StepNumber)
+		}
+	}
+
+	return true, nil
+}
+
+// saveProgress records step as the next one to run for alert. Failures are
+// logged rather than stopping the escalation, which matters more than
+// being able to resume it.
+func (e *Engine) saveProgress(ctx context.Context, alert *models.AlertGroup, chain *models.EscalationChain, step int) {
+	if e.progress == nil {
+		return
+	}
+	err := e.progress.SaveEscalationProgress(ctx, &models.EscalationProgress{
+		AlertGroupID: alert.ID,
+		ChainID:      chain.ID,
+		NextStep:     step,
+		Alert:        alert,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to save escalation progress",
+			"alert", alert.Fingerprint,
+			"step", step,
+			"error", err)
+	}
+}
+
+// checkpoint saves step as the next one to run for an escalation stopped by
+// ctx being cancelled, typically on shutdown. The save itself gets
+// checkpointTimeout since ctx is already done.
+func (e *Engine) checkpoint(ctx context.Context, alert *models.AlertGroup, chain *models.EscalationChain, step int) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), checkpointTimeout)
+	defer cancel()
+	e.saveProgress(ctx, alert, chain, step)
+}
+
+func (e *Engine) clearProgress(alert *models.AlertGroup) {
+	if e.progress == nil {
+		return
+	}
+	// The escalation is over even if ctx was cancelled on the way out
+	if err := e.progress.DeleteEscalationProgress(context.Background(), alert.ID); err != nil {
+		slog.Warn("failed to clear escalation progress",
+			"alert", alert.Fingerprint,
+			"error", err)
+	}
+}
+
+// notify pages target for a notify step. Delivery failures are logged
+// rather than aborting the chain so later steps still get a chance to
+// reach someone.
+func (e *Engine) notify(ctx context.Context, alert *models.AlertGroup, step int, target string) {
+	channel, recipient, err := parseTarget(target)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid escalation target",
+			"step", step,
+			"error", err)
+		return
+	}
+
+	if err := e.sender.Send(ctx, channel, alert, recipient); err != nil {
+		slog.ErrorContext(ctx, "escalation notification failed",
+			"alert", alert.Fingerprint,
+			"step", step,
+			"channel", channel,
+			"error", err)
+		return
+	}
+	e.recordNotified(alert.Fingerprint, target)
+}
+
+// oncallTarget resolves a notify_schedule step to a "channel:user" target
+// for whoever is on call now. The step's target is a schedule ID, paging
+// the primary, or "ID:role" to page another role. It reports false, after
+// logging why, when there is nobody to page and the step should be
+// skipped.
+func (e *Engine) oncallTarget(ctx context.Context, policy models.EscalationPolicy) (string, bool) {
+	if e.schedules == nil {
+		slog.WarnContext(ctx, "skipping notify_schedule step, no schedule source",
+			"step", policy.StepNumber)
+		return "", false
+	}
+
+	id, role, err := parseScheduleTarget(policy.Target)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid escalation target",
+			"step", policy.StepNumber,
+			"error", err)
+		return "", false
+	}
+
+	schedule, err := e.schedules.GetSchedule(ctx, id)
+	if err != nil {
+		slog.WarnContext(ctx, "skipping notify_schedule step, failed to load schedule",
+			"step", policy.StepNumber,
+			"schedule", id,
+			"error", err)
+		return "", false
+	}
+
+	oncall, err := schedule.RoleOnCallAt(time.Now(), role)
+	if err != nil {
+		slog.WarnContext(ctx, "skipping notify_schedule step, failed to resolve on-call",
+			"step", policy.StepNumber,
+			"schedule", id,
+			"role", role,
+			"error", err)
+		return "", false
+	}
+	user := oncall.User
+	if user == "" {
+		slog.WarnContext(ctx, "skipping notify_schedule step, nobody is on call",
+			"step", policy.StepNumber,
+			"schedule", id,
+			"role", role)
+		return "", false
+	}
+
+	channel := e.userChannels[user]
+	if channel == "" {
+		channel = e.defaultChannel
+	}
+	if channel == "" {
+		slog.WarnContext(ctx, "skipping notify_schedule step, no channel to page the on-call user on",
+			"step", policy.StepNumber,
+			"schedule", id,
+			"user", user)
+		return "", false
+	}
+	return channel + ":" + user, true
+}
+
+// parseScheduleTarget splits a notify_schedule target, "ID" or "ID:role",
+// into the schedule ID and role, defaulting to the primary
+func parseScheduleTarget(target string) (int64, string, error) {
+	idPart, role, hasRole := strings.Cut(target, ":")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid schedule ID %q", idPart)
+	}
+	if !hasRole {
+		return id, models.RolePrimary, nil
+	}
+	if !models.ValidRole(role) {
+		return 0, "", fmt.Errorf("invalid on-call role %q (want %s)", role, strings.Join(models.Roles, " or "))
+	}
+	return id, role, nil
+}
+
+func (e *Engine) recordNotified(fingerprint, target string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, t := range e.notified[fingerprint] {
+		if t == target {
+			return
+		}
+	}
+	e.notified[fingerprint] = append(e.notified[fingerprint], target)
+}
+
+// Resolve tells every target paged for alert that it has resolved and
+// forgets them. Alerts that never paged anyone send nothing.
+func (e *Engine) Resolve(ctx context.Context, alert *models.AlertGroup) {
+	e.mu.Lock()
+	targets := e.notified[alert.Fingerprint]
+	delete(e.notified, alert.Fingerprint)
+	e.mu.Unlock()
+
+	for _, target := range targets {
+		channel, recipient, err := parseTarget(target)
+		if err != nil {
+			continue
+		}
+		if err := e.sender.Send(ctx, channel, alert, recipient); err != nil {
+			slog.ErrorContext(ctx, "resolve notification failed",
+				"alert", alert.Fingerprint,
+				"channel", channel,
+				"error", err)
+		}
+	}
+}
+
+// waitForAck polls the alert status until it is handled or timeout elapses
+func (e *Engine) waitForAck(ctx context.Context, alert *models.AlertGroup, timeout time.Duration) (bool, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-deadline.C:
+			// One last look so an ack right at the deadline still counts
+			return e.isHandled(ctx, alert)
+		case <-ticker.C:
+			handled, err := e.isHandled(ctx, alert)
+			if err != nil || handled {
+				return handled, err
+			}
+		}
+	}
+}
+
+func (e *Engine) isHandled(ctx context.Context, alert *models.AlertGroup) (bool, error) {
+	status, err := e.status.AlertStatus(ctx, alert.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check alert status: %w", err)
+	}
+	return status == "acknowledged" || status == "resolved", nil
+}
+
+// parseTarget splits a "channel:recipient" target such as "slack:#incidents"
+func parseTarget(target string) (string, string, error) {
+	channel, recipient, ok := strings.Cut(target, ":")
+	if !ok || channel == "" {
+		return "", "", fmt.Errorf("invalid target %q: expected channel:recipient", target)
+	}
+	return channel, recipient, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,482 @@
+package escalation
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+type mockSender struct {
+	mu     sync.Mutex
+	sent   []string
+	onSend func(recipient string)
+}
+
+func (m *mockSender) Send(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, channel+":"+recipient)
+	m.mu.Unlock()
+	if m.onSend != nil {
+		m.onSend(recipient)
+	}
+	return nil
+}
+
+func (m *mockSender) recipients() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.sent...)
+}
+
+type mockStatus struct {
+	mu     sync.Mutex
+	status string
+}
+
+func (m *mockStatus) AlertStatus(ctx context.Context, alertID int64) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status, nil
+}
+
+func (m *mockStatus) set(status string) {
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+}
+
+// mockProgress is an in-memory ProgressStore
+type mockProgress struct {
+	mu    sync.Mutex
+	saved map[int64]*models.EscalationProgress
+}
+
+func newMockProgress() *mockProgress {
+	return &mockProgress{saved: make(map[int64]*models.EscalationProgress)}
+}
+
+func (m *mockProgress) SaveEscalationProgress(ctx context.Context, p *models.EscalationProgress) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *p
+	m.saved[p.AlertGroupID] = &saved
+	return nil
+}
+
+func (m *mockProgress) DeleteEscalationProgress(ctx context.Context, alertGroupID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.saved, alertGroupID)
+	return nil
+}
+
+func (m *mockProgress) ListEscalationProgress(ctx context.Context) ([]*models.EscalationProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []*models.EscalationProgress
+	for _, p := range m.saved {
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+func (m *mockProgress) get(alertGroupID int64) *models.EscalationProgress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saved[alertGroupID]
+}
+
+func newTestEngine(sender Sender, status StatusSource) *Engine {
+	e := NewEngine(sender, status)
+	e.pollInterval = 10 * time.Millisecond
+	return e
+}
+
+func TestEngine_RunStepOrder(t *testing.T) {
+	sender := &mockSender{}
+	status := &mockStatus{status: "firing"}
+	engine := newTestEngine(sender, status)
+
+	chain := &models.EscalationChain{
+		ID: 1,
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 3, PolicyType: models.PolicyNotifyChannel, Target: "email:oncall@example.com"},
+			{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "slack:alice"},
+			{StepNumber: 2, PolicyType: models.PolicyWait, WaitSeconds: 0},
+		},
+	}
+
+	if err := engine.Run(context.Background(), &models.AlertGroup{ID: 1}, chain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"slack:alice", "email:oncall@example.com"}
+	if got := sender.recipients(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected sends %v, got %v", expected, got)
+	}
+}
+
+func TestEngine_AckWithinWindowHalts(t *testing.T) {
+	status := &mockStatus{status: "firing"}
+	sender := &mockSender{
+		onSend: func(recipient string) {
+			// Responder acks shortly after being paged
+			time.AfterFunc(50*time.Millisecond, func() { status.set("acknowledged") })
+		},
+	}
+	engine := newTestEngine(sender, status)
+
+	chain := &models.EscalationChain{
+		ID: 1,
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "slack:alice", AckTimeoutSeconds: 5},
+			{StepNumber: 2, PolicyType: models.PolicyNotifyUser, Target: "slack:bob"},
+		},
+	}
+
+	start := time.Now()
+	if err := engine.Run(context.Background(), &models.AlertGroup{ID: 1}, chain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := sender.recipients(); !reflect.DeepEqual(got, []string{"slack:alice"}) {
+		t.Errorf("expected only alice to be paged, got %v", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected escalation to stop as soon as acked, took %s", elapsed)
+	}
+}
+
+func TestEngine_AckAfterWindowProceeds(t *testing.T) {
+	status := &mockStatus{status: "firing"}
+	sender := &mockSender{}
+	sender.onSend = func(recipient string) {
+		// Alice never responds in time; bob acks once paged
+		if recipient == "bob" {
+			status.set("acknowledged")
+		}
+	}
+	engine := newTestEngine(sender, status)
+
+	chain := &models.EscalationChain{
+		ID: 1,
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "slack:alice", AckTimeoutSeconds: 1},
+			{StepNumber: 2, PolicyType: models.PolicyNotifyUser, Target: "slack:bob", AckTimeoutSeconds: 1},
+			{StepNumber: 3, PolicyType: models.PolicyNotifyChannel, Target: "slack:#incidents"},
+		},
+	}
+
+	start := time.Now()
+	if err := engine.Run(context.Background(), &models.AlertGroup{ID: 1}, chain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"slack:alice", "slack:bob"}
+	if got := sender.recipients(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected sends %v, got %v", expected, got)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected engine to wait out alice's ack window, took %s", elapsed)
+	}
+}
+
+func TestEngine_CancelDuringWait(t *testing.T) {
+	engine := newTestEngine(&mockSender{}, &mockStatus{status: "firing"})
+
+	chain := &models.EscalationChain{
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyWait, WaitSeconds: 60},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := engine.Run(ctx, &models.AlertGroup{ID: 1}, chain); err == nil {
+		t.Fatal("expected context error")
+	}
+}
+
+func TestEngine_ProgressKeptOnCancel(t *testing.T) {
+	sender := &mockSender{}
+	progress := newMockProgress()
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+	engine.SetProgressStore(progress)
+
+	chain := &models.EscalationChain{
+		ID: 4,
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "email:alice"},
+			{StepNumber: 2, PolicyType: models.PolicyWait, WaitSeconds: 60},
+			{StepNumber: 3, PolicyType: models.PolicyNotifyUser, Target: "email:bob"},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := engine.Run(ctx, &models.AlertGroup{ID: 1}, chain); err == nil {
+		t.Fatal("expected context error")
+	}
+
+	p := progress.get(1)
+	if p == nil {
+		t.Fatal("expected progress to survive the interrupted escalation")
+	}
+	if p.ChainID != 4 || p.NextStep != 2 {
+		t.Errorf("expected chain 4 at step 2, got chain %d at step %d", p.ChainID, p.NextStep)
+	}
+}
+
+func TestEngine_CheckpointAfterAckWindowPage(t *testing.T) {
+	sender := &mockSender{}
+	progress := newMockProgress()
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+	engine.SetProgressStore(progress)
+
+	chain := &models.EscalationChain{
+		ID: 4,
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "email:alice", AckTimeoutSeconds: 60},
+			{StepNumber: 2, PolicyType: models.PolicyNotifyUser, Target: "email:bob"},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := engine.Run(ctx, &models.AlertGroup{ID: 1}, chain); err == nil {
+		t.Fatal("expected context error")
+	}
+
+	// alice was paged before the cancel, so a restart goes on to bob
+	if p := progress.get(1); p == nil || p.NextStep != 2 {
+		t.Fatalf("expected step 2 checkpointed, got %+v", p)
+	}
+	if got := sender.recipients(); !reflect.DeepEqual(got, []string{"email:alice"}) {
+		t.Errorf("expected only alice paged, got %v", got)
+	}
+}
+
+func TestEngine_ProgressClearedWhenDone(t *testing.T) {
+	progress := newMockProgress()
+	status := &mockStatus{status: "firing"}
+	engine := newTestEngine(&mockSender{}, status)
+	engine.SetProgressStore(progress)
+
+	chain := &models.EscalationChain{Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyUser, Target: "email:alice"},
+	}}
+	if err := engine.Run(context.Background(), &models.AlertGroup{ID: 1}, chain); err != nil {
+		t.Fatal(err)
+	}
+	if progress.get(1) != nil {
+		t.Error("expected progress cleared after the chain completed")
+	}
+
+	// Stopping early because the alert was acked also ends the escalation
+	progress.SaveEscalationProgress(context.Background(), &models.EscalationProgress{AlertGroupID: 2, NextStep: 1})
+	status.set("acknowledged")
+	if err := engine.Run(context.Background(), &models.AlertGroup{ID: 2}, chain); err != nil {
+		t.Fatal(err)
+	}
+	if progress.get(2) != nil {
+		t.Error("expected progress cleared after the alert was acknowledged")
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	channel, recipient, err := parseTarget("slack:#incidents")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if channel != "slack" || recipient != "#incidents" {
+		t.Errorf("unexpected parse result %q %q", channel, recipient)
+	}
+
+	if _, _, err := parseTarget("alice"); err == nil {
+		t.Error("expected error for target without channel")
+	}
+}
+
+func TestEngine_SeverityWaitMultiplier(t *testing.T) {
+	engine := newTestEngine(&mockSender{}, &mockStatus{status: "firing"})
+	engine.SetSeverityMultipliers(map[string]float64{"critical": 0.5, "info": 2})
+
+	wait := models.EscalationPolicy{StepNumber: 1, PolicyType: models.PolicyWait, WaitSeconds: 600}
+
+	tests := []struct {
+		severity string
+		want     time.Duration
+	}{
+		{"critical", 5 * time.Minute},
+		{"warning", 10 * time.Minute},
+		{"info", 20 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := engine.effectiveWait(&models.AlertGroup{Severity: tt.severity}, wait); got != tt.want {
+			t.Errorf("%s: expected wait %s, got %s", tt.severity, tt.want, got)
+		}
+	}
+}
+
+func TestEngine_NoSeverityMultipliersByDefault(t *testing.T) {
+	engine := newTestEngine(&mockSender{}, &mockStatus{status: "firing"})
+	wait := models.EscalationPolicy{StepNumber: 1, PolicyType: models.PolicyWait, WaitSeconds: 600}
+	if got := engine.effectiveWait(&models.AlertGroup{Severity: "critical"}, wait); got != 10*time.Minute {
+		t.Errorf("expected critical alerts to wait as configured, got %s", got)
+	}
+}
+
+func TestEngine_CriticalEscalatesFaster(t *testing.T) {
+	chain := &models.EscalationChain{
+		Policies: []models.EscalationPolicy{
+			{StepNumber: 1, PolicyType: models.PolicyWait, WaitSeconds: 1},
+			{StepNumber: 2, PolicyType: models.PolicyNotifyUser, Target: "slack:bob"},
+		},
+	}
+
+	elapsed := func(severity string) time.Duration {
+		engine := newTestEngine(&mockSender{}, &mockStatus{status: "firing"})
+		engine.SetSeverityMultipliers(map[string]float64{"critical": 0.2})
+
+		start := time.Now()
+		if err := engine.Run(context.Background(), &models.AlertGroup{ID: 1, Severity: severity}, chain); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return time.Since(start)
+	}
+
+	critical, warning := elapsed("critical"), elapsed("warning")
+	if critical >= warning {
+		t.Errorf("expected critical (%s) to escalate faster than warning (%s)", critical, warning)
+	}
+	if warning < time.Second {
+		t.Errorf("expected warning to wait the full second, took %s", warning)
+	}
+}
+
+func TestEngine_ResolveNotifiesPagedTargets(t *testing.T) {
+	sender := &mockSender{}
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+
+	chain := &models.EscalationChain{Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "slack:#incidents"},
+		{StepNumber: 2, PolicyType: models.PolicyNotifyUser, Target: "email:alice@example.com"},
+		{StepNumber: 3, PolicyType: models.PolicyNotifyChannel, Target: "slack:#incidents"},
+	}}
+	alert := &models.AlertGroup{ID: 1, Fingerprint: "abc"}
+	if err := engine.Run(context.Background(), alert, chain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	engine.Resolve(context.Background(), alert)
+
+	want := []string{"slack:#incidents", "email:alice@example.com", "slack:#incidents", "slack:#incidents", "email:alice@example.com"}
+	if got := sender.recipients(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Targets are forgotten once told
+	engine.Resolve(context.Background(), alert)
+	if got := len(sender.recipients()); got != len(want) {
+		t.Errorf("expected no further notifications, got %d total", got)
+	}
+}
+
+// mockSchedules serves schedules by ID
+type mockSchedules map[int64]*models.Schedule
+
+func (m mockSchedules) GetSchedule(ctx context.Context, id int64) (*models.Schedule, error) {
+	schedule, ok := m[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return schedule, nil
+}
+
+func TestEngine_NotifySchedule(t *testing.T) {
+	sender := &mockSender{}
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+
+	now := time.Now()
+	engine.SetSchedules(mockSchedules{
+		1: {ID: 1, Timezone: "UTC", Layers: []models.Layer{{
+			RotationType:  "weekly",
+			RotationStart: now.Add(-time.Hour),
+			Users:         []string{"alice@example.com"},
+		}}},
+		2: {ID: 2, Timezone: "UTC", Overrides: []models.Override{{
+			ID: 1, User: "bob", Start: now.Add(-time.Hour), End: now.Add(time.Hour),
+		}}},
+		// Only covered by an override that has ended
+		3: {ID: 3, Timezone: "UTC", Overrides: []models.Override{{
+			ID: 2, User: "carol", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour),
+		}}},
+		4: {ID: 4, Timezone: "UTC", Layers: []models.Layer{
+			{RotationType: "weekly", RotationStart: now.Add(-time.Hour), Users: []string{"dave"}},
+			{RotationType: "weekly", RotationStart: now.Add(-time.Hour), Users: []string{"erin"}, Role: models.RoleSecondary},
+		}},
+	})
+	engine.SetUserChannels(map[string]string{"bob": "slack"})
+
+	chain := &models.EscalationChain{Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifySchedule, Target: "1"},
+		{StepNumber: 2, PolicyType: models.PolicyNotifySchedule, Target: "3", AckTimeoutSeconds: 60},
+		{StepNumber: 3, PolicyType: models.PolicyNotifySchedule, Target: "99"},
+		{StepNumber: 4, PolicyType: models.PolicyNotifySchedule, Target: "2"},
+		{StepNumber: 5, PolicyType: models.PolicyNotifySchedule, Target: "4:secondary"},
+		{StepNumber: 6, PolicyType: models.PolicyNotifySchedule, Target: "4:tertiary"},
+		// Nobody fills the secondary role of schedule 1
+		{StepNumber: 7, PolicyType: models.PolicyNotifySchedule, Target: "1:secondary"},
+	}}
+
+	start := time.Now()
+	if err := engine.Run(context.Background(), &models.AlertGroup{ID: 1}, chain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Nobody is on call for schedule 3, schedule 99 doesn't exist and
+	// tertiary isn't a role, so those steps are skipped, ack window included
+	want := []string{"email:alice@example.com", "slack:bob", "email:erin"}
+	if got := sender.recipients(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected skipped step not to wait for an ack, took %s", elapsed)
+	}
+}
+
+func TestEngine_NotifyScheduleWithoutDefaultChannel(t *testing.T) {
+	sender := &mockSender{}
+	engine := newTestEngine(sender, &mockStatus{status: "firing"})
+
+	now := time.Now()
+	engine.SetSchedules(mockSchedules{
+		1: {ID: 1, Timezone: "UTC", Layers: []models.Layer{{
+			RotationType: "weekly", RotationStart: now.Add(-time.Hour), Users: []string{"alice"},
+		}}},
+		2: {ID: 2, Timezone: "UTC", Layers: []models.Layer{{
+			RotationType: "weekly", RotationStart: now.Add(-time.Hour), Users: []string{"bob"},
+		}}},
+	})
+	engine.SetUserChannels(map[string]string{"bob": "slack"})
+	engine.SetDefaultUserChannel("")
+
+	chain := &models.EscalationChain{Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifySchedule, Target: "1", AckTimeoutSeconds: 60},
+		{StepNumber: 2, PolicyType: models.PolicyNotifySchedule, Target: "2"},
+	}}
+	if err := engine.Run(context.Background(), &models.AlertGroup{ID: 1}, chain); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Nothing pages alice without a default channel, so that step is skipped
+	if got, want := sender.recipients(), []string{"slack:bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,138 @@
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func newImportCommand() *cobra.Command {
+	var serverURL string
+	var apiKey string
+	var file string
+	var name string
+	var timezone string
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Create a schedule from an iCalendar feed",
+		Long: `Upload an iCalendar feed, such as a PagerDuty schedule export, to a
+running oncall server, which creates a schedule from it. Shifts handed
+between users in a repeating order at a regular cadence become a rotation
+layer; otherwise each shift becomes an override.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return fmt.Errorf("--file is required")
+			}
+			var feed io.Reader = cmd.InOrStdin()
+			if file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return fmt.Errorf("failed to open calendar: %w", err)
+				}
+				defer f.Close()
+				feed = f
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			client := oncallClient{serverURL: serverURL, apiKey: apiKey, http: http.DefaultClient}
+			schedule, err := client.importSchedule(ctx, feed, name, timezone)
+			if err != nil {
+				return err
+			}
+			renderImported(cmd.OutOrStdout(), schedule)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "server", "http://localhost:8080",
+		"Oncall server URL")
+	cmd.Flags().StringVar(&apiKey, "api-key", "",
+		"API key for servers that require one")
+	cmd.Flags().StringVarP(&file, "file", "f", "",
+		`iCalendar file to import, or "-" for standard input`)
+	cmd.Flags().StringVar(&name, "name", "",
+		"Schedule name instead of the feed's")
+	cmd.Flags().StringVar(&timezone, "timezone", "",
+		"Schedule timezone instead of the feed's")
+	cmd.Flags().DurationVar(&timeout, "timeout", 30*time.Second,
+		"Time limit for the request")
+
+	return cmd
+}
+
+// importSchedule posts feed to POST /schedules/import and returns the
+// schedule created from it
+func (c oncallClient) importSchedule(ctx context.Context, feed io.Reader, name, timezone string) (*models.Schedule, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	if timezone != "" {
+		query.Set("timezone", timezone)
+	}
+	endpoint := strings.TrimSuffix(c.serverURL, "/") + "/api/v1/schedules/import"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, feed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/calendar")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach oncall server at %s: %w", c.serverURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("server rejected the request (status %d): check --api-key", resp.StatusCode)
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var schedule models.Schedule
+	if err := json.NewDecoder(resp.Body).Decode(&schedule); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %w", err)
+	}
+	return &schedule, nil
+}
+
+// renderImported describes the schedule an import created
+func renderImported(w io.Writer, schedule *models.Schedule) {
+	fmt.Fprintf(w, "Created schedule %d %q (%s)\n", schedule.ID, schedule.Name, schedule.Timezone)
+	for _, layer := range schedule.Layers {
+		cadence := layer.RotationType
+		if cadence == "custom" {
+			cadence = fmt.Sprintf("every %dh", layer.DurationHours)
+		}
+		fmt.Fprintf(w, "  layer %q: %s from %s, %s\n", layer.Name, cadence,
+			layer.RotationStart.Format(time.RFC3339), strings.Join(layer.Users, ", "))
+	}
+	if len(schedule.Overrides) > 0 {
+		fmt.Fprintf(w, "  %d overrides: the shifts don't form a rotation\n", len(schedule.Overrides))
+	}
+}
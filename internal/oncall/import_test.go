@@ -0,0 +1,82 @@
+package oncall
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runImport(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := newImportCommand()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestImport(t *testing.T) {
+	const feed = "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"
+	var body, query, contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/schedules/import" {
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		body, query, contentType = string(b), r.URL.RawQuery, r.Header.Get("Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 4, "name": "Platform", "timezone": "America/New_York",
+			"layers": [{"name": "Imported rotation", "rotation_type": "weekly",
+				"rotation_start": "2024-02-26T09:00:00-05:00", "users": ["alice", "bob"]}]}`))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "schedule.ics")
+	if err := os.WriteFile(path, []byte(feed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runImport(t, "--server", srv.URL, "--file", path, "--name", "Platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != feed || contentType != "text/calendar" || query != "name=Platform" {
+		t.Errorf("expected the feed posted with its name, got %q (%s) with query %q", body, contentType, query)
+	}
+	for _, want := range []string{`Created schedule 4 "Platform"`, "weekly from 2024-02-26T09:00:00-05:00, alice, bob"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+
+	if _, err := runImport(t, "--server", srv.URL); err == nil || err.Error() != "--file is required" {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+}
+
+func TestImport_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid calendar: line 2: invalid content line", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "bad.ics")
+	if err := os.WriteFile(path, []byte("nonsense"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runImport(t, "--server", srv.URL, "--file", path); err == nil || !strings.Contains(err.Error(), "invalid calendar") {
+		t.Errorf("expected the server's error, got %v", err)
+	}
+	if _, err := runImport(t, "--server", srv.URL, "--file", filepath.Join(t.TempDir(), "missing.ics")); err == nil || !strings.Contains(err.Error(), "failed to open calendar") {
+		t.Errorf("expected an open error, got %v", err)
+	}
+}
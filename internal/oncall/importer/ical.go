@@ -0,0 +1,270 @@
+// Package importer rebuilds on-call schedules from iCalendar feeds, such as
+// those PagerDuty publishes for its schedules or the oncall API's own
+// calendar.ics export
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event is one on-call shift read from a feed
+type Event struct {
+	UID   string
+	User  string
+	Start time.Time
+	End   time.Time
+}
+
+// Calendar is what Parse reads from a feed: its name, its timezone and its
+// events sorted by start
+type Calendar struct {
+	Name     string
+	Timezone string // IANA name, or empty if the feed doesn't say
+	Events   []Event
+}
+
+// Parse reads an RFC 5545 iCalendar feed. Each VEVENT needs a DTSTART, a
+// DTEND and an ATTENDEE naming the user on call. Components other than
+// VEVENT, such as VTIMEZONE, are skipped, so TZID parameters must be IANA
+// zone names. The calendar's timezone is X-WR-TIMEZONE if set, otherwise
+// the first TZID an event uses.
+func Parse(r io.Reader) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cal := &Calendar{}
+	var raws []*rawEvent
+	var event *rawEvent
+	depth := 0 // nesting inside components other than VCALENDAR and VEVENT
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := splitProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		component := strings.ToUpper(prop.value)
+		switch {
+		case prop.name == "BEGIN" && component == "VEVENT" && depth == 0:
+			if event != nil {
+				return nil, fmt.Errorf("line %d: VEVENT inside VEVENT", i+1)
+			}
+			event = &rawEvent{line: i + 1, props: make(map[string]property)}
+		case prop.name == "END" && component == "VEVENT" && depth == 0:
+			if event == nil {
+				return nil, fmt.Errorf("line %d: END:VEVENT without BEGIN", i+1)
+			}
+			raws = append(raws, event)
+			event = nil
+		case prop.name == "BEGIN" && component != "VCALENDAR":
+			depth++
+		case prop.name == "END" && component != "VCALENDAR":
+			depth--
+		case depth > 0:
+			// Inside VTIMEZONE, VALARM and the like
+		case event != nil:
+			// The first ATTENDEE is the one on call
+			if _, seen := event.props[prop.name]; !seen || prop.name != "ATTENDEE" {
+				event.props[prop.name] = prop
+			}
+		case prop.name == "X-WR-CALNAME":
+			cal.Name = unescapeText(prop.value)
+		case prop.name == "X-WR-TIMEZONE":
+			cal.Timezone = prop.value
+		}
+	}
+	if event != nil {
+		return nil, fmt.Errorf("VEVENT starting on line %d is not closed", event.line)
+	}
+
+	// Times without a zone are read in the calendar's timezone
+	floating := time.UTC
+	if cal.Timezone != "" {
+		if floating, err = time.LoadLocation(cal.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown X-WR-TIMEZONE %q", cal.Timezone)
+		}
+	}
+
+	for _, raw := range raws {
+		if cal.Timezone == "" {
+			cal.Timezone = raw.props["DTSTART"].params["TZID"]
+		}
+		e, err := raw.event(floating)
+		if err != nil {
+			return nil, fmt.Errorf("VEVENT on line %d: %w", raw.line, err)
+		}
+		cal.Events = append(cal.Events, e)
+	}
+	sort.SliceStable(cal.Events, func(i, j int) bool {
+		return cal.Events[i].Start.Before(cal.Events[j].Start)
+	})
+	return cal, nil
+}
+
+// property is a content line split into its parts. Names and parameter
+// names are upper-cased.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// rawEvent holds a VEVENT's properties until the calendar's timezone is
+// known
+type rawEvent struct {
+	line  int
+	props map[string]property
+}
+
+func (e *rawEvent) event(floating *time.Location) (Event, error) {
+	start, ok := e.props["DTSTART"]
+	if !ok {
+		return Event{}, fmt.Errorf("missing DTSTART")
+	}
+	end, ok := e.props["DTEND"]
+	if !ok {
+		return Event{}, fmt.Errorf("missing DTEND")
+	}
+	attendee, ok := e.props["ATTENDEE"]
+	if !ok {
+		return Event{}, fmt.Errorf("missing ATTENDEE")
+	}
+
+	event := Event{UID: e.props["UID"].value, User: attendeeUser(attendee)}
+	if event.User == "" {
+		return Event{}, fmt.Errorf("ATTENDEE names no user")
+	}
+	var err error
+	if event.Start, err = parseTime(start, floating); err != nil {
+		return Event{}, fmt.Errorf("invalid DTSTART: %w", err)
+	}
+	if event.End, err = parseTime(end, floating); err != nil {
+		return Event{}, fmt.Errorf("invalid DTEND: %w", err)
+	}
+	if !event.End.After(event.Start) {
+		return Event{}, fmt.Errorf("DTEND must be after DTSTART")
+	}
+	return event, nil
+}
+
+// attendeeUser returns the user an ATTENDEE names: the address of a mailto
+// URI, the user of one written by the calendar export, or else the common
+// name
+func attendeeUser(p property) string {
+	value := strings.TrimSpace(p.value)
+	lower := strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(lower, "mailto:"):
+		return value[len("mailto:"):]
+	case strings.HasPrefix(lower, exportUserURN):
+		return value[len(exportUserURN):]
+	case p.params["CN"] != "":
+		return p.params["CN"]
+	}
+	return value
+}
+
+// exportUserURN prefixes the ATTENDEE of users without an email address in
+// the calendar export
+const exportUserURN = "urn:x-grafana-ops:user:"
+
+// parseTime reads a DATE-TIME in UTC, in its TZID zone or floating, or a
+// DATE, which starts at midnight
+func parseTime(p property, floating *time.Location) (time.Time, error) {
+	loc := floating
+	if tzid := p.params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(strings.TrimPrefix(tzid, "/")); err != nil {
+			return time.Time{}, fmt.Errorf("unknown TZID %q", tzid)
+		}
+	}
+
+	switch {
+	case p.params["VALUE"] == "DATE" || len(p.value) == len("20060102"):
+		return time.ParseInLocation("20060102", p.value, loc)
+	case strings.HasSuffix(p.value, "Z"):
+		return time.Parse("20060102T150405Z", p.value)
+	default:
+		return time.ParseInLocation("20060102T150405", p.value, loc)
+	}
+}
+
+// unfold reads the feed's content lines, joining folded continuations
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+	return lines, nil
+}
+
+// splitProperty splits a content line, name *(";" param) ":" value, where
+// parameter values may be double-quoted
+func splitProperty(line string) (property, error) {
+	p := property{params: make(map[string]string)}
+
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return p, fmt.Errorf("invalid content line %q", line)
+	}
+	p.name = strings.ToUpper(line[:i])
+
+	for line[i] == ';' {
+		rest := line[i+1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return p, fmt.Errorf("invalid parameter in %s", p.name)
+		}
+		key := strings.ToUpper(rest[:eq])
+		j := eq + 1
+		var value string
+		if j < len(rest) && rest[j] == '"' {
+			end := strings.IndexByte(rest[j+1:], '"')
+			if end < 0 {
+				return p, fmt.Errorf("unterminated quote in %s", p.name)
+			}
+			value = rest[j+1 : j+1+end]
+			j += end + 2
+		} else {
+			end := strings.IndexAny(rest[j:], ";:")
+			if end < 0 {
+				return p, fmt.Errorf("%s has no value", p.name)
+			}
+			value = rest[j : j+end]
+			j += end
+		}
+		p.params[key] = value
+
+		i += 1 + j
+		if i >= len(line) || (line[i] != ';' && line[i] != ':') {
+			return p, fmt.Errorf("invalid parameter in %s", p.name)
+		}
+	}
+
+	p.value = line[i+1:]
+	return p, nil
+}
+
+// unescapeText reverses the escaping of a TEXT value
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
@@ -0,0 +1,151 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagerDutyFeed is a weekly rotation of three users handing off Mondays at
+// 09:00 New York time, across the March DST change, in the shape
+// PagerDuty exports
+const pagerDutyFeed = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//PagerDuty//Schedule//EN\r\n" +
+	"X-WR-CALNAME:Platform Primary\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:America/New_York\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:19701101T020000\r\n" +
+	"TZOFFSETFROM:-0400\r\n" +
+	"TZOFFSETTO:-0500\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:Q1\r\n" +
+	"DTSTART;TZID=America/New_York:20240226T090000\r\n" +
+	"DTEND;TZID=America/New_York:20240304T090000\r\n" +
+	"SUMMARY:On Call - Alice\r\n" +
+	"ATTENDEE;CN=Alice Smith;ROLE=REQ-PARTICIPANT:mailto:alice@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:Q2\r\n" +
+	"DTSTART;TZID=America/New_York:20240304T090000\r\n" +
+	"DTEND;TZID=America/New_York:20240311T090000\r\n" +
+	"SUMMARY:On Call - Bob\r\n" +
+	"ATTENDEE;CN=\"Bob Jones, SRE\":mailto:bob@example\r\n" +
+	" .com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:Q3\r\n" +
+	"DTSTART;TZID=America/New_York:20240311T090000\r\n" +
+	"DTEND;TZID=America/New_York:20240318T090000\r\n" +
+	"ATTENDEE;CN=Carol:mailto:carol@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:Q4\r\n" +
+	"DTSTART;TZID=America/New_York:20240318T090000\r\n" +
+	"DTEND;TZID=America/New_York:20240325T090000\r\n" +
+	"ATTENDEE;CN=Alice Smith:mailto:alice@example.com\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:Q5\r\n" +
+	"DTSTART;TZID=America/New_York:20240325T090000\r\n" +
+	"DTEND;TZID=America/New_York:20240401T090000\r\n" +
+	"ATTENDEE;CN=Bob Jones:mailto:bob@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	cal, err := Parse(strings.NewReader(pagerDutyFeed))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cal.Name != "Platform Primary" || cal.Timezone != "America/New_York" {
+		t.Errorf("expected the name and the events' timezone, got %q and %q", cal.Name, cal.Timezone)
+	}
+	if len(cal.Events) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(cal.Events))
+	}
+
+	ny, _ := time.LoadLocation("America/New_York")
+	first := cal.Events[0]
+	if first.UID != "Q1" || first.User != "alice@example.com" ||
+		!first.Start.Equal(time.Date(2024, 2, 26, 9, 0, 0, 0, ny)) || !first.End.Equal(time.Date(2024, 3, 4, 9, 0, 0, 0, ny)) {
+		t.Errorf("unexpected first event %+v", first)
+	}
+	if cal.Events[1].User != "bob@example.com" {
+		t.Errorf("expected a folded attendee with a quoted name, got %q", cal.Events[1].User)
+	}
+}
+
+func TestParse_TimeForms(t *testing.T) {
+	feed := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"X-WR-TIMEZONE:Europe/Berlin",
+		"BEGIN:VEVENT",
+		"DTSTART:20240102T080000Z",
+		"DTEND:20240102T200000",
+		"ATTENDEE;CN=ops:urn:x-grafana-ops:user:ops",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20240101",
+		"DTEND;VALUE=DATE:20240102",
+		"ATTENDEE;CN=dave:",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\n")
+
+	cal, err := Parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	want := []Event{
+		{User: "dave", Start: time.Date(2024, 1, 1, 0, 0, 0, 0, berlin), End: time.Date(2024, 1, 2, 0, 0, 0, 0, berlin)},
+		{User: "ops", Start: time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 2, 20, 0, 0, 0, berlin)},
+	}
+	if len(cal.Events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), cal.Events)
+	}
+	for i, e := range cal.Events {
+		if e.User != want[i].User || !e.Start.Equal(want[i].Start) || !e.End.Equal(want[i].End) {
+			t.Errorf("event %d: expected %+v, got %+v", i, want[i], e)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	event := func(lines ...string) string {
+		return "BEGIN:VCALENDAR\nBEGIN:VEVENT\n" + strings.Join(lines, "\n") + "\nEND:VEVENT\nEND:VCALENDAR\n"
+	}
+	attendee := "ATTENDEE:mailto:a@example.com"
+
+	tests := []struct {
+		name string
+		feed string
+		want string
+	}{
+		{"missing attendee", event("DTSTART:20240101T000000Z", "DTEND:20240102T000000Z"), "missing ATTENDEE"},
+		{"missing end", event("DTSTART:20240101T000000Z", attendee), "missing DTEND"},
+		{"end before start", event("DTSTART:20240102T000000Z", "DTEND:20240101T000000Z", attendee), "DTEND must be after DTSTART"},
+		{"bad time", event("DTSTART:2024-01-01", "DTEND:20240102T000000Z", attendee), "invalid DTSTART"},
+		{"unknown tzid", event("DTSTART;TZID=Mars/Olympus:20240101T000000", "DTEND:20240102T000000Z", attendee), "unknown TZID"},
+		{"unclosed event", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20240101T000000Z\n", "not closed"},
+		{"unterminated quote", event(`ATTENDEE;CN="Alice:mailto:a@example.com`), "unterminated quote"},
+		{"not a content line", "BEGIN:VCALENDAR\nnonsense\nEND:VCALENDAR\n", "invalid content line"},
+		{"unknown calendar timezone", "BEGIN:VCALENDAR\nX-WR-TIMEZONE:Nowhere\nEND:VCALENDAR\n", "unknown X-WR-TIMEZONE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.feed))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package importer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// Names BuildSchedule gives what it creates when the feed doesn't say
+const (
+	DefaultScheduleName = "Imported schedule"
+	ImportedLayerName   = "Imported rotation"
+)
+
+// BuildSchedule reconstructs a schedule from cal's events. If they form a
+// rotation — back-to-back shifts of one cadence, handed between users in a
+// repeating order — the schedule gets one layer reproducing it. Otherwise
+// each event becomes an override, which reproduces the feed exactly but
+// doesn't continue past its end.
+func BuildSchedule(cal *Calendar) (*models.Schedule, error) {
+	if len(cal.Events) == 0 {
+		return nil, fmt.Errorf("calendar has no events to import")
+	}
+
+	tz, err := models.NormalizeTimezone(cal.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+
+	name := cal.Name
+	if name == "" {
+		name = DefaultScheduleName
+	}
+	schedule := &models.Schedule{
+		Name:        name,
+		Description: fmt.Sprintf("Imported from an iCalendar feed of %d shifts", len(cal.Events)),
+		Timezone:    tz,
+	}
+	if layer, ok := inferLayer(cal.Events, loc); ok {
+		schedule.Layers = []models.Layer{*layer}
+		return schedule, nil
+	}
+
+	for _, e := range cal.Events {
+		schedule.Overrides = append(schedule.Overrides, models.Override{
+			User:  e.User,
+			Start: e.Start,
+			End:   e.End,
+		})
+	}
+	return schedule, nil
+}
+
+// inferLayer reports the rotation events follow, if they follow one. It
+// takes at least two shifts to tell a cadence.
+func inferLayer(events []Event, loc *time.Location) (*models.Layer, bool) {
+	for i := 1; i < len(events); i++ {
+		if !events[i].Start.Equal(events[i-1].End) {
+			return nil, false
+		}
+	}
+	events = mergeShifts(events)
+	if len(events) < 2 {
+		return nil, false
+	}
+
+	// Feeds cut the shifts in progress at their edges, so the first and
+	// last may be shorter than the rest
+	full := events
+	if len(events) > 2 {
+		full = events[1 : len(events)-1]
+	}
+	c, ok := cadenceOf(full, loc)
+	if !ok || !c.covers(events[0], loc) || !c.covers(events[len(events)-1], loc) {
+		return nil, false
+	}
+	users, ok := userOrder(events)
+	if !ok {
+		return nil, false
+	}
+
+	return &models.Layer{
+		Name:         ImportedLayerName,
+		RotationType: c.rotationType,
+		// The handoff that began the first shift, even if the feed starts
+		// after it
+		RotationStart: c.before(events[0].End, loc),
+		DurationHours: c.hours,
+		Users:         users,
+	}, true
+}
+
+// cadence is how long each shift of a rotation lasts: whole calendar days
+// in the schedule's timezone, which DST changes don't disturb, for daily
+// and weekly rotations, or a number of hours for custom ones
+type cadence struct {
+	rotationType string
+	days         int
+	hours        int
+}
+
+// before returns the handoff a shift before end
+func (c cadence) before(end time.Time, loc *time.Location) time.Time {
+	if c.days > 0 {
+		return end.In(loc).AddDate(0, 0, -c.days)
+	}
+	return end.Add(-time.Duration(c.hours) * time.Hour)
+}
+
+// covers reports whether e fits in a single shift
+func (c cadence) covers(e Event, loc *time.Location) bool {
+	return !e.Start.Before(c.before(e.End, loc))
+}
+
+// cadenceOf returns the cadence every event's length matches: daily or
+// weekly if each starts and ends at the same local time a calendar day or
+// week apart in loc, or else custom if each lasts the same whole number
+// of hours
+func cadenceOf(events []Event, loc *time.Location) (cadence, bool) {
+	for _, c := range []cadence{{"daily", 1, 24}, {"weekly", 7, 168}} {
+		matches := true
+		for _, e := range events {
+			if !e.Start.Equal(c.before(e.End, loc)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return c, true
+		}
+	}
+
+	length := events[0].End.Sub(events[0].Start)
+	if length%time.Hour != 0 {
+		return cadence{}, false
+	}
+	for _, e := range events[1:] {
+		if e.End.Sub(e.Start) != length {
+			return cadence{}, false
+		}
+	}
+	return cadence{rotationType: "custom", hours: int(length / time.Hour)}, true
+}
+
+// userOrder returns the shortest list of distinct users that, repeated,
+// gives the order events are handed over in
+func userOrder(events []Event) ([]string, bool) {
+	for period := 1; period <= len(events); period++ {
+		if !distinct(events[:period]) {
+			// Longer periods would repeat this user too
+			return nil, false
+		}
+		repeats := true
+		for i := period; i < len(events); i++ {
+			if events[i].User != events[i-period].User {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			users := make([]string, period)
+			for i := range users {
+				users[i] = events[i].User
+			}
+			return users, true
+		}
+	}
+	return nil, false
+}
+
+// mergeShifts joins back-to-back events of the same user, as feeds may
+// split a shift at day boundaries
+func mergeShifts(events []Event) []Event {
+	merged := []Event{events[0]}
+	for _, e := range events[1:] {
+		last := &merged[len(merged)-1]
+		if e.User == last.User && e.Start.Equal(last.End) {
+			last.End = e.End
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+func distinct(events []Event) bool {
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		if seen[e.User] {
+			return false
+		}
+		seen[e.User] = true
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildSchedule_WeeklyRotation(t *testing.T) {
+	cal, err := Parse(strings.NewReader(pagerDutyFeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := BuildSchedule(cal)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if schedule.Name != "Platform Primary" || schedule.Timezone != "America/New_York" {
+		t.Errorf("unexpected schedule %+v", schedule)
+	}
+	if len(schedule.Overrides) != 0 || len(schedule.Layers) != 1 {
+		t.Fatalf("expected a single layer and no overrides, got %+v", schedule)
+	}
+	layer := schedule.Layers[0]
+	if layer.RotationType != "weekly" {
+		t.Errorf("expected a weekly rotation, got %q", layer.RotationType)
+	}
+	ny, _ := time.LoadLocation("America/New_York")
+	if !layer.RotationStart.Equal(time.Date(2024, 2, 26, 9, 0, 0, 0, ny)) {
+		t.Errorf("expected the rotation to start with the first shift, got %s", layer.RotationStart)
+	}
+	if want := []string{"alice@example.com", "bob@example.com", "carol@example.com"}; !reflect.DeepEqual(layer.Users, want) {
+		t.Errorf("expected users %v, got %v", want, layer.Users)
+	}
+	if err := schedule.Validate(); err != nil {
+		t.Errorf("expected a valid schedule, got %v", err)
+	}
+
+	// The layer reproduces every imported shift, DST change included, and
+	// carries on after the feed ends
+	for _, e := range cal.Events {
+		for _, at := range []time.Time{e.Start, e.End.Add(-time.Minute)} {
+			user, err := schedule.GetPrimaryOnCall(at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user != e.User {
+				t.Errorf("%s: expected %s on call, got %s", at, e.User, user)
+			}
+		}
+	}
+	if user, _ := schedule.GetPrimaryOnCall(time.Date(2024, 4, 2, 9, 0, 0, 0, ny)); user != "carol@example.com" {
+		t.Errorf("expected the rotation to continue with carol, got %q", user)
+	}
+}
+
+func shift(user string, start time.Time, d time.Duration) Event {
+	return Event{User: user, Start: start, End: start.Add(d)}
+}
+
+func TestBuildSchedule_Cadences(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name     string
+		events   []Event
+		wantType string
+		wantHrs  int
+		wantFrom time.Time
+		users    []string
+	}{
+		{"daily", []Event{
+			shift("a", start, day), shift("b", start.Add(day), day), shift("a", start.Add(2*day), day),
+		}, "daily", 24, start, []string{"a", "b"}},
+		{"custom twelve hours", []Event{
+			shift("a", start, 12*time.Hour), shift("b", start.Add(12*time.Hour), 12*time.Hour),
+			shift("c", start.Add(day), 12*time.Hour),
+		}, "custom", 12, start, []string{"a", "b", "c"}},
+		{"shifts split by day are merged", []Event{
+			shift("a", start, day), shift("a", start.Add(day), 6*day),
+			shift("b", start.Add(7*day), 3*day), shift("b", start.Add(10*day), 4*day),
+		}, "weekly", 168, start, []string{"a", "b"}},
+		{"edges cut by the feed window", []Event{
+			shift("a", start.Add(3*day), 4*day), shift("b", start.Add(7*day), 7*day),
+			shift("c", start.Add(14*day), 7*day), shift("a", start.Add(21*day), 2*day),
+		}, "weekly", 168, start, []string{"a", "b", "c"}},
+		{"single user", []Event{
+			shift("a", start, day), shift("a", start.Add(day), day),
+		}, "", 0, time.Time{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := BuildSchedule(&Calendar{Events: tt.events})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if schedule.Name != DefaultScheduleName || schedule.Timezone != "UTC" {
+				t.Errorf("expected defaults for name and timezone, got %q and %q", schedule.Name, schedule.Timezone)
+			}
+			if tt.wantType == "" {
+				if len(schedule.Layers) != 0 || len(schedule.Overrides) != len(tt.events) {
+					t.Errorf("expected overrides only, got %+v", schedule)
+				}
+				return
+			}
+			if len(schedule.Layers) != 1 {
+				t.Fatalf("expected a layer, got %+v", schedule)
+			}
+			layer := schedule.Layers[0]
+			if layer.RotationType != tt.wantType || layer.DurationHours != tt.wantHrs ||
+				!layer.RotationStart.Equal(tt.wantFrom) || !reflect.DeepEqual(layer.Users, tt.users) {
+				t.Errorf("expected %s rotation of %dh from %s for %v, got %+v",
+					tt.wantType, tt.wantHrs, tt.wantFrom, tt.users, layer)
+			}
+		})
+	}
+}
+
+func TestBuildSchedule_FallsBackToOverrides(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name   string
+		events []Event
+	}{
+		{"one event", []Event{shift("a", start, 7*day)}},
+		{"gap between shifts", []Event{shift("a", start, day), shift("b", start.Add(2*day), day)}},
+		{"uneven lengths", []Event{
+			shift("a", start, day), shift("b", start.Add(day), 2*day), shift("c", start.Add(3*day), day), shift("a", start.Add(4*day), day),
+		}},
+		{"no repeating order", []Event{
+			shift("a", start, day), shift("b", start.Add(day), day), shift("a", start.Add(2*day), day), shift("c", start.Add(3*day), day),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := BuildSchedule(&Calendar{Name: "Ad hoc", Events: tt.events})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(schedule.Layers) != 0 || len(schedule.Overrides) != len(tt.events) {
+				t.Fatalf("expected one override per event, got %+v", schedule)
+			}
+			for i, o := range schedule.Overrides {
+				e := tt.events[i]
+				if o.User != e.User || !o.Start.Equal(e.Start) || !o.End.Equal(e.End) {
+					t.Errorf("override %d: expected %+v, got %+v", i, e, o)
+				}
+			}
+		})
+	}
+
+	if _, err := BuildSchedule(&Calendar{}); err == nil {
+		t.Error("expected an error for a calendar without events")
+	}
+	if _, err := BuildSchedule(&Calendar{Timezone: "Nowhere", Events: tests[0].events}); err == nil {
+		t.Error("expected an error for an unknown timezone")
+	}
+}
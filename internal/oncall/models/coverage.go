@@ -0,0 +1,220 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxProjection bounds how far Coverage will project a schedule
+const MaxProjection = 90 * 24 * time.Hour
+
+// Shift is a span of time during which User is on call. An empty User
+// means nobody is.
+type Shift struct {
+	User  string    `json:"user"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Coverage projects who is primary on call over [from, to), with
+// overrides and restrictions applied. Consecutive spans with the same user are merged.
+func (s *Schedule) Coverage(from, to time.Time) ([]Shift, error) {
+	var shifts []Shift
+	err := s.walk(from, to, func(start, end time.Time, oncall OnCall) {
+		if n := len(shifts); n > 0 && shifts[n-1].User == oncall.User {
+			shifts[n-1].End = end
+			return
+		}
+		shifts = append(shifts, Shift{User: oncall.User, Start: start, End: end})
+	})
+	return shifts, err
+}
+
+// OnCallShift is a span during which one layer or override puts User on
+// call
+type OnCallShift struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	User       string    `json:"user"`
+	LayerID    *int64    `json:"layer_id"`
+	OverrideID *int64    `json:"override_id,omitempty"`
+}
+
+// Shifts projects the on-call shifts over [from, to) like Coverage, but
+// keeps apart consecutive spans decided by different layers or overrides,
+// and leaves out the spans where nobody is on call
+func (s *Schedule) Shifts(from, to time.Time) ([]OnCallShift, error) {
+	shifts := []OnCallShift{}
+	err := s.walk(from, to, func(start, end time.Time, oncall OnCall) {
+		if oncall.User == "" {
+			return
+		}
+		if n := len(shifts); n > 0 {
+			last := &shifts[n-1]
+			if last.End.Equal(start) && last.User == oncall.User &&
+				sameID(last.LayerID, oncall.LayerID) && sameID(last.OverrideID, oncall.OverrideID) {
+				last.End = end
+				return
+			}
+		}
+		shifts = append(shifts, OnCallShift{
+			Start:      start,
+			End:        end,
+			User:       oncall.User,
+			LayerID:    oncall.LayerID,
+			OverrideID: oncall.OverrideID,
+		})
+	})
+	return shifts, err
+}
+
+func sameID(a, b *int64) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+// walk calls fn for each span of [from, to) between consecutive
+// boundaries, in order, with who is on call during it
+func (s *Schedule) walk(from, to time.Time, fn func(start, end time.Time, oncall OnCall)) error {
+	if !to.After(from) {
+		return fmt.Errorf("end of range must be after start")
+	}
+	if to.Sub(from) > MaxProjection {
+		return fmt.Errorf("range exceeds maximum of %s", MaxProjection)
+	}
+
+	boundaries, err := s.boundaries(from, to)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(boundaries)-1; i++ {
+		start, end := boundaries[i], boundaries[i+1]
+		oncall, err := s.OnCallAt(start)
+		if err != nil {
+			return err
+		}
+		fn(start, end, oncall)
+	}
+	return nil
+}
+
+// NextHandoff returns when the on-call user next changes after t, looking
+// up to MaxProjection ahead. It returns nil if nobody takes over within
+// that window.
+func (s *Schedule) NextHandoff(t time.Time) (*time.Time, error) {
+	shifts, err := s.Coverage(t, t.Add(MaxProjection))
+	if err != nil {
+		return nil, err
+	}
+	if len(shifts) < 2 {
+		return nil, nil
+	}
+	handoff := shifts[0].End
+	return &handoff, nil
+}
+
+// Gaps returns the spans in [from, to) where nobody is on call
+func (s *Schedule) Gaps(from, to time.Time) ([]Shift, error) {
+	shifts, err := s.Coverage(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	gaps := []Shift{}
+	for _, shift := range shifts {
+		if shift.User == "" {
+			gaps = append(gaps, shift)
+		}
+	}
+	return gaps, nil
+}
+
+// boundaries returns every instant in [from, to] at which the on-call user
+// can change: rotation handoffs, restriction window edges and override
+// edges, sorted and deduplicated
+func (s *Schedule) boundaries(from, to time.Time) ([]time.Time, error) {
+	loc, err := s.location()
+	if err != nil {
+		return nil, err
+	}
+
+	points := []time.Time{from, to}
+	add := func(t time.Time) {
+		if t.After(from) && t.Before(to) {
+			points = append(points, t)
+		}
+	}
+
+	for _, layer := range s.Layers {
+		for _, t := range layer.handoffs(from, to, loc) {
+			add(t)
+		}
+
+		for _, r := range layer.Restrictions {
+			start, err := parseClock(r.Start)
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseClock(r.End)
+			if err != nil {
+				return nil, err
+			}
+
+			// Start a day early to catch windows wrapping past midnight
+			day := from.In(loc).AddDate(0, 0, -1)
+			for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+				add(time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc))
+				add(time.Date(day.Year(), day.Month(), day.Day(), end/60, end%60, 0, 0, loc))
+			}
+		}
+	}
+
+	for _, o := range s.Overrides {
+		add(o.Start)
+		add(o.End)
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	unique := points[:1]
+	for _, t := range points[1:] {
+		if !t.Equal(unique[len(unique)-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique, nil
+}
+
+// handoffs returns the layer's rotation handoffs before to, starting with
+// the one that began the shift in progress at from. Daily and weekly
+// handoffs fall on calendar days in loc; the rotation start is included
+// since it needn't be one of them.
+func (l *Layer) handoffs(from, to time.Time, loc *time.Location) []time.Time {
+	var points []time.Time
+
+	if days := l.rotationDays(); days > 0 {
+		points = append(points, l.RotationStart)
+		day := l.shiftDay(from.In(loc))
+		offset := daysBetween(l.startDay(loc), day) % days
+		if offset < 0 {
+			offset += days
+		}
+		for day = day.AddDate(0, 0, -offset); ; day = day.AddDate(0, 0, days) {
+			t := l.handoffOn(day, loc)
+			if !t.Before(to) {
+				break
+			}
+			points = append(points, t)
+		}
+		return points
+	}
+
+	if interval := l.rotationInterval(); interval > 0 {
+		n := from.Sub(l.RotationStart) / interval
+		for t := l.RotationStart.Add(n * interval); t.Before(to); t = t.Add(interval) {
+			points = append(points, t)
+		}
+	}
+	return points
+}
@@ -0,0 +1,278 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSchedule_Gaps_Restriction(t *testing.T) {
+	monday := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Timezone: "UTC",
+		Layers: []Layer{
+			{
+				RotationType:  "daily",
+				RotationStart: monday.AddDate(0, 0, -7),
+				Users:         []string{"alice", "bob"},
+				Restrictions:  []Restriction{{Start: "08:00", End: "20:00"}},
+			},
+		},
+	}
+
+	gaps, err := schedule.Gaps(monday, monday.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Shift{
+		{Start: monday, End: monday.Add(8 * time.Hour)},
+		{Start: monday.Add(20 * time.Hour), End: monday.Add(32 * time.Hour)},
+		{Start: monday.Add(44 * time.Hour), End: monday.Add(48 * time.Hour)},
+	}
+	if !reflect.DeepEqual(gaps, expected) {
+		t.Errorf("expected gaps %v, got %v", expected, gaps)
+	}
+}
+
+func TestSchedule_Gaps_FullyCovered(t *testing.T) {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Layers: []Layer{
+			{RotationType: "weekly", RotationStart: start.AddDate(0, 0, -3), Users: []string{"alice", "bob"}},
+		},
+	}
+
+	gaps, err := schedule.Gaps(start, start.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(gaps) != 0 {
+		t.Errorf("expected no gaps, got %v", gaps)
+	}
+}
+
+func TestSchedule_Coverage(t *testing.T) {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Layers: []Layer{
+			{RotationType: "daily", RotationStart: start, Users: []string{"alice", "bob"}},
+		},
+		Overrides: []Override{
+			{ID: 1, User: "carol", Start: start.Add(30 * time.Hour), End: start.Add(36 * time.Hour)},
+		},
+	}
+
+	shifts, err := schedule.Coverage(start, start.AddDate(0, 0, 2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Shift{
+		{User: "alice", Start: start, End: start.Add(24 * time.Hour)},
+		{User: "bob", Start: start.Add(24 * time.Hour), End: start.Add(30 * time.Hour)},
+		{User: "carol", Start: start.Add(30 * time.Hour), End: start.Add(36 * time.Hour)},
+		{User: "bob", Start: start.Add(36 * time.Hour), End: start.Add(48 * time.Hour)},
+	}
+	if !reflect.DeepEqual(shifts, expected) {
+		t.Errorf("expected shifts %v, got %v", expected, shifts)
+	}
+}
+
+func TestSchedule_Coverage_SpringForward(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	start := time.Date(2024, 3, 9, 0, 0, 0, 0, loc)
+	schedule := Schedule{
+		Timezone: "America/New_York",
+		Layers: []Layer{
+			{RotationType: "daily", RotationStart: start, Users: []string{"alice", "bob", "carol"}},
+		},
+	}
+
+	shifts, err := schedule.Coverage(start, time.Date(2024, 3, 12, 0, 0, 0, 0, loc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Every shift starts at local midnight; the one over the change is
+	// 23 hours long and nobody is skipped or on twice
+	expected := []struct {
+		user  string
+		day   int
+		hours float64
+	}{
+		{"alice", 9, 24},
+		{"bob", 10, 23},
+		{"carol", 11, 24},
+	}
+	if len(shifts) != len(expected) {
+		t.Fatalf("expected %d shifts, got %v", len(expected), shifts)
+	}
+	for i, want := range expected {
+		shift := shifts[i]
+		if shift.User != want.user {
+			t.Errorf("shift %d: expected %s, got %s", i, want.user, shift.User)
+		}
+		if !shift.Start.Equal(time.Date(2024, 3, want.day, 0, 0, 0, 0, loc)) {
+			t.Errorf("shift %d: expected start at local midnight on the %dth, got %s", i, want.day, shift.Start.In(loc))
+		}
+		if got := shift.End.Sub(shift.Start).Hours(); got != want.hours {
+			t.Errorf("shift %d: expected %v hours, got %v", i, want.hours, got)
+		}
+	}
+}
+
+func TestSchedule_Coverage_HandoffTime(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	hour := 10
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, loc)
+	schedule := Schedule{
+		Timezone: "Europe/Berlin",
+		Layers: []Layer{
+			{RotationType: "weekly", RotationStart: start, HandoffHour: &hour, Users: []string{"alice", "bob"}},
+		},
+	}
+
+	shifts, err := schedule.Coverage(start, start.AddDate(0, 0, 21))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	handoff := func(day int) time.Time { return time.Date(2024, 1, day, 10, 0, 0, 0, loc) }
+	expected := []Shift{
+		{User: "alice", Start: start, End: handoff(8)},
+		{User: "bob", Start: handoff(8), End: handoff(15)},
+		{User: "alice", Start: handoff(15), End: start.AddDate(0, 0, 21)},
+	}
+	if len(shifts) != len(expected) {
+		t.Fatalf("expected shifts %v, got %v", expected, shifts)
+	}
+	for i, want := range expected {
+		got := shifts[i]
+		if got.User != want.User || !got.Start.Equal(want.Start) || !got.End.Equal(want.End) {
+			t.Errorf("shift %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestSchedule_Coverage_InvalidRange(t *testing.T) {
+	schedule := Schedule{}
+	now := time.Now()
+
+	if _, err := schedule.Coverage(now, now); err == nil {
+		t.Error("expected error for empty range")
+	}
+	if _, err := schedule.Coverage(now, now.Add(MaxProjection+time.Hour)); err == nil {
+		t.Error("expected error for range beyond MaxProjection")
+	}
+}
+
+func TestSchedule_NextHandoff(t *testing.T) {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Timezone: "UTC",
+		Layers: []Layer{
+			{ID: 7, RotationType: "daily", RotationStart: start, Users: []string{"alice", "bob"}},
+		},
+		Overrides: []Override{
+			{ID: 3, User: "carol", Start: start.Add(30 * time.Hour), End: start.Add(36 * time.Hour)},
+		},
+	}
+
+	tests := []struct {
+		at       time.Time
+		user     string
+		layer    *int64
+		override *int64
+		handoff  time.Time
+	}{
+		{start.Add(2 * time.Hour), "alice", ptr(int64(7)), nil, start.Add(24 * time.Hour)},
+		{start.Add(26 * time.Hour), "bob", ptr(int64(7)), nil, start.Add(30 * time.Hour)},
+		{start.Add(31 * time.Hour), "carol", nil, ptr(int64(3)), start.Add(36 * time.Hour)},
+	}
+	for _, tt := range tests {
+		oncall, err := schedule.OnCallAt(tt.at)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := OnCall{User: tt.user, LayerID: tt.layer, OverrideID: tt.override}
+		if !reflect.DeepEqual(oncall, want) {
+			t.Errorf("%s: expected %+v, got %+v", tt.at, want, oncall)
+		}
+
+		handoff, err := schedule.NextHandoff(tt.at)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if handoff == nil || !handoff.Equal(tt.handoff) {
+			t.Errorf("%s: expected handoff at %s, got %v", tt.at, tt.handoff, handoff)
+		}
+	}
+
+	// A single-user rotation never hands off
+	solo := Schedule{Layers: []Layer{{RotationType: "daily", RotationStart: start, Users: []string{"alice"}}}}
+	if handoff, err := solo.NextHandoff(start); err != nil || handoff != nil {
+		t.Errorf("expected no handoff, got %v (%v)", handoff, err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSchedule_Shifts(t *testing.T) {
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Layers: []Layer{
+			{ID: 1, RotationType: "daily", RotationStart: start, Users: []string{"alice", "alice", "bob"},
+				Restrictions: []Restriction{{Start: "00:00", End: "20:00"}}},
+		},
+		Overrides: []Override{
+			{ID: 5, User: "alice", Start: start.Add(12 * time.Hour), End: start.Add(14 * time.Hour)},
+		},
+	}
+
+	shifts, err := schedule.Shifts(start, start.AddDate(0, 0, 3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The override splits alice's first day even though she stays on
+	// call, and the nightly gaps are left out
+	expected := []struct {
+		user       string
+		start, end time.Duration
+		override   bool
+	}{
+		{"alice", 0, 12 * time.Hour, false},
+		{"alice", 12 * time.Hour, 14 * time.Hour, true},
+		{"alice", 14 * time.Hour, 20 * time.Hour, false},
+		{"alice", 24 * time.Hour, 44 * time.Hour, false},
+		{"bob", 48 * time.Hour, 68 * time.Hour, false},
+	}
+	if len(shifts) != len(expected) {
+		t.Fatalf("expected %d shifts, got %+v", len(expected), shifts)
+	}
+	for i, want := range expected {
+		got := shifts[i]
+		if got.User != want.user || !got.Start.Equal(start.Add(want.start)) || !got.End.Equal(start.Add(want.end)) {
+			t.Errorf("shift %d: expected %s %s-%s, got %+v", i, want.user, want.start, want.end, got)
+		}
+		if (got.OverrideID != nil) != want.override || (got.LayerID != nil) == want.override {
+			t.Errorf("shift %d: expected override=%v, got layer %v override %v", i, want.override, got.LayerID, got.OverrideID)
+		}
+	}
+
+	empty, err := (&Schedule{}).Shifts(start, start.AddDate(0, 0, 1))
+	if err != nil || empty == nil || len(empty) != 0 {
+		t.Errorf("expected no shifts for an empty schedule, got %v (%v)", empty, err)
+	}
+}
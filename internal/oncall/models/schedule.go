@@ -1,67 +1,377 @@
 package models
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
 // Schedule represents an on-call schedule
 type Schedule struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Timezone    string    `json:"timezone"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Layers      []Layer   `json:"layers,omitempty"`
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Timezone    string     `json:"timezone"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Layers      []Layer    `json:"layers,omitempty"`
+	Overrides   []Override `json:"overrides,omitempty"`
 }
 
 // Layer represents a schedule layer (rotation)
 type Layer struct {
-	ID             int64     `json:"id"`
-	ScheduleID     int64     `json:"schedule_id"`
-	Name           string    `json:"name"`
-	RotationType   string    `json:"rotation_type"` // daily, weekly, custom
-	RotationStart  time.Time `json:"rotation_start"`
-	DurationHours  int       `json:"duration_hours"`
-	Users          []string  `json:"users"` // User IDs in rotation
-}
-
-// GetCurrentOnCall returns the user currently on-call for this schedule
-func (s *Schedule) GetCurrentOnCall(t time.Time) (string, error) {
-	// Simple rotation logic
-	for _, layer := range s.Layers {
-		user, err := layer.GetOnCallUser(t)
+	ID            int64     `json:"id"`
+	ScheduleID    int64     `json:"schedule_id"`
+	Name          string    `json:"name"`
+	RotationType  string    `json:"rotation_type"` // daily, weekly, custom
+	RotationStart time.Time `json:"rotation_start"`
+	DurationHours int       `json:"duration_hours"`
+	// HandoffHour and HandoffMinute are the time of day, in the schedule's
+	// timezone, at which daily and weekly rotations hand off. RotationStart
+	// anchors the cycle: the first handoff is at this time on the day a
+	// full rotation after it. Unset means the time of day of RotationStart.
+	HandoffHour   *int     `json:"handoff_hour,omitempty"`
+	HandoffMinute int      `json:"handoff_minute,omitempty"`
+	Users         []string `json:"users"` // User IDs in rotation
+	// Restrictions limit the layer to the given windows. A layer without
+	// restrictions is on call around the clock.
+	Restrictions []Restriction `json:"restrictions,omitempty"`
+	// Priority orders stacked layers: while a layer is active and has
+	// someone on call it overrides every layer of lower priority. Layers
+	// of equal priority keep their order in the schedule.
+	Priority int `json:"priority"`
+	// Role is who the layer puts on call: RolePrimary, the default, or
+	// RoleSecondary for a shadow paged alongside or after the primary
+	Role string `json:"role,omitempty"`
+}
+
+// On-call roles a layer can fill
+const (
+	RolePrimary   = "primary"
+	RoleSecondary = "secondary"
+)
+
+// Roles lists the on-call roles, primary first
+var Roles = []string{RolePrimary, RoleSecondary}
+
+// ValidRole reports whether role names one of Roles
+func ValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// role returns the layer's role, defaulting to RolePrimary
+func (l *Layer) role() string {
+	if l.Role == "" {
+		return RolePrimary
+	}
+	return l.Role
+}
+
+// Restriction is a recurring window, in the schedule's timezone, during
+// which a layer is active. End before Start wraps past midnight.
+type Restriction struct {
+	Days  []string `json:"days,omitempty"` // mon, tue, ...; empty means every day
+	Start string   `json:"start"`          // HH:MM
+	End   string   `json:"end"`            // HH:MM
+}
+
+// Override puts User on call for [Start, End), taking precedence over the
+// schedule's layers
+type Override struct {
+	ID         int64     `json:"id"`
+	ScheduleID int64     `json:"schedule_id"`
+	User       string    `json:"user"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Covers reports whether the override is in effect at t
+func (o *Override) Covers(t time.Time) bool {
+	return !t.Before(o.Start) && t.Before(o.End)
+}
+
+// GetCurrentOnCall returns who is on call for this schedule at t in each
+// role, leaving out roles nobody fills. See RoleOnCallAt for how each is
+// resolved.
+func (s *Schedule) GetCurrentOnCall(t time.Time) (map[string]string, error) {
+	users := make(map[string]string)
+	for _, role := range Roles {
+		oncall, err := s.RoleOnCallAt(t, role)
+		if err != nil {
+			return nil, err
+		}
+		if oncall.User != "" {
+			users[role] = oncall.User
+		}
+	}
+	return users, nil
+}
+
+// GetPrimaryOnCall returns the primary on-call user for this schedule at
+// t, or "" if there is none
+func (s *Schedule) GetPrimaryOnCall(t time.Time) (string, error) {
+	oncall, err := s.OnCallAt(t)
+	return oncall.User, err
+}
+
+// OnCall is who is on call at an instant and what put them there. User is
+// empty, and both IDs nil, when nobody is.
+type OnCall struct {
+	User       string
+	LayerID    *int64
+	OverrideID *int64
+}
+
+// OnCallAt resolves the primary on-call user at t, also reporting the
+// layer or override that decided
+func (s *Schedule) OnCallAt(t time.Time) (OnCall, error) {
+	return s.RoleOnCallAt(t, RolePrimary)
+}
+
+// RoleOnCallAt resolves who is on call in role at t. For the primary role
+// an override covering t wins, the most recently added one if several do.
+// Otherwise the highest-priority layer of the role whose restrictions
+// allow t and that has someone on call decides, falling through to lower
+// layers.
+func (s *Schedule) RoleOnCallAt(t time.Time, role string) (OnCall, error) {
+	if role == RolePrimary {
+		var override *Override
+		for i := range s.Overrides {
+			o := &s.Overrides[i]
+			if o.Covers(t) && (override == nil || o.ID > override.ID) {
+				override = o
+			}
+		}
+		if override != nil {
+			id := override.ID
+			return OnCall{User: override.User, OverrideID: &id}, nil
+		}
+	}
+
+	loc, err := s.location()
+	if err != nil {
+		return OnCall{}, err
+	}
+	local := t.In(loc)
+
+	for _, layer := range s.layersByPriority() {
+		if layer.role() != role {
+			continue
+		}
+		active, err := layer.ActiveAt(local)
+		if err != nil {
+			return OnCall{}, err
+		}
+		if !active {
+			continue
+		}
+
+		user, err := layer.GetOnCallUser(local)
 		if err == nil && user != "" {
-			return user, nil
+			id := layer.ID
+			return OnCall{User: user, LayerID: &id}, nil
 		}
 	}
-	return "", nil
+	return OnCall{}, nil
 }
 
-// GetOnCallUser returns the on-call user for this layer at time t
+// layersByPriority returns the schedule's layers, highest priority first
+func (s *Schedule) layersByPriority() []Layer {
+	layers := make([]Layer, len(s.Layers))
+	copy(layers, s.Layers)
+	sort.SliceStable(layers, func(i, j int) bool {
+		return layers[i].Priority > layers[j].Priority
+	})
+	return layers
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %q: %w", s.Timezone, err)
+	}
+	return loc, nil
+}
+
+// ActiveAt reports whether the layer's restrictions allow t, which should
+// already be in the schedule's timezone
+func (l *Layer) ActiveAt(t time.Time) (bool, error) {
+	if len(l.Restrictions) == 0 {
+		return true, nil
+	}
+	for _, r := range l.Restrictions {
+		ok, err := r.Contains(t)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// Contains reports whether t falls inside the restriction window. For
+// windows that wrap past midnight the day filter applies to the day the
+// window starts.
+func (r *Restriction) Contains(t time.Time) (bool, error) {
+	start, err := parseClock(r.Start)
+	if err != nil {
+		return false, err
+	}
+	end, err := parseClock(r.End)
+	if err != nil {
+		return false, err
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if start < end {
+		return minute >= start && minute < end && r.onDay(day), nil
+	}
+	// Wrapping window, e.g. 22:00-06:00: either the evening part today or
+	// the early-morning tail of yesterday's window
+	if minute >= start {
+		return r.onDay(day), nil
+	}
+	if minute < end {
+		return r.onDay((day + 6) % 7), nil
+	}
+	return false, nil
+}
+
+func (r *Restriction) onDay(day time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+	name := strings.ToLower(day.String()[:3])
+	for _, d := range r.Days {
+		if strings.ToLower(d) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock converts "HH:MM" into minutes since midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// GetOnCallUser returns the on-call user for this layer at t, or "" if t
+// is outside the layer's restrictions. Daily and weekly rotations hand off
+// on calendar days in t's location, so a shift spanning a DST change is 23
+// or 25 hours long; pass t in the schedule's timezone. Custom rotations
+// are fixed multiples of DurationHours.
 func (l *Layer) GetOnCallUser(t time.Time) (string, error) {
 	if len(l.Users) == 0 {
 		return "", nil
 	}
 
-	// Calculate duration since rotation start
-	duration := t.Sub(l.RotationStart)
+	// Nobody is on call before the rotation begins
+	if t.Before(l.RotationStart) {
+		return "", nil
+	}
+
+	// The rotation keeps turning outside the windows; it just leaves
+	// nobody on call
+	active, err := l.ActiveAt(t)
+	if err != nil || !active {
+		return "", err
+	}
+
+	rotations, err := l.rotationsAt(t)
+	if err != nil {
+		return "", err
+	}
+	return l.Users[rotations%len(l.Users)], nil
+}
+
+// rotationsAt returns how many handoffs have happened between the start
+// of the rotation and t
+func (l *Layer) rotationsAt(t time.Time) (int, error) {
+	if days := l.rotationDays(); days > 0 {
+		if l.HandoffHour != nil && (*l.HandoffHour < 0 || *l.HandoffHour > 23 || l.HandoffMinute < 0 || l.HandoffMinute > 59) {
+			return 0, fmt.Errorf("layer %q has invalid handoff time %02d:%02d", l.Name, *l.HandoffHour, l.HandoffMinute)
+		}
+		elapsed := daysBetween(l.startDay(t.Location()), l.shiftDay(t))
+		if elapsed < 0 {
+			// Before the first handoff on the start day
+			elapsed = 0
+		}
+		return elapsed / days, nil
+	}
 
-	var rotationInterval time.Duration
+	interval := l.rotationInterval()
+	if interval <= 0 {
+		return 0, fmt.Errorf("layer %q has no rotation length", l.Name)
+	}
+	return int(t.Sub(l.RotationStart) / interval), nil
+}
+
+// rotationDays returns the length in calendar days of a daily or weekly
+// rotation, and zero for custom rotations
+func (l *Layer) rotationDays() int {
 	switch l.RotationType {
 	case "daily":
-		rotationInterval = 24 * time.Hour
+		return 1
 	case "weekly":
-		rotationInterval = 7 * 24 * time.Hour
+		return 7
 	default:
-		rotationInterval = time.Duration(l.DurationHours) * time.Hour
+		return 0
 	}
+}
 
-	// Find current position in rotation
-	rotations := int(duration / rotationInterval)
-	userIndex := rotations % len(l.Users)
+func (l *Layer) rotationInterval() time.Duration {
+	return time.Duration(l.DurationHours) * time.Hour
+}
+
+// handoffOn returns the instant the layer hands off on day, a UTC midnight
+// naming a calendar date in loc. A handoff time skipped by a DST change
+// falls just after the gap.
+func (l *Layer) handoffOn(day time.Time, loc *time.Location) time.Time {
+	hour, min, sec := l.RotationStart.In(loc).Clock()
+	if l.HandoffHour != nil {
+		hour, min, sec = *l.HandoffHour, l.HandoffMinute, 0
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, min, sec, 0, loc)
+}
+
+// startDay returns the calendar date in loc of RotationStart, as a UTC
+// midnight. It counts as the first shift's day even if RotationStart is
+// earlier than that day's handoff.
+func (l *Layer) startDay(loc *time.Location) time.Time {
+	year, month, date := l.RotationStart.In(loc).Date()
+	return time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+}
+
+// shiftDay returns the calendar date, as a UTC midnight, of the handoff
+// that began the shift containing t: t's own date in its location, or the
+// day before if t is earlier than that day's handoff
+func (l *Layer) shiftDay(t time.Time) time.Time {
+	year, month, date := t.Date()
+	day := time.Date(year, month, date, 0, 0, 0, 0, time.UTC)
+	if t.Before(l.handoffOn(day, t.Location())) {
+		day = day.AddDate(0, 0, -1)
+	}
+	return day
+}
 
-	return l.Users[userIndex], nil
+// daysBetween counts calendar days from a to b, both UTC midnights
+func daysBetween(a, b time.Time) int {
+	return int(b.Sub(a) / (24 * time.Hour))
 }
 
 // EscalationChain represents an escalation policy
@@ -78,27 +388,58 @@ type EscalationPolicy struct {
 	ID          int64  `json:"id"`
 	ChainID     int64  `json:"chain_id"`
 	StepNumber  int    `json:"step_number"`
-	PolicyType  string `json:"policy_type"` // notify_user, notify_channel, wait
-	Target      string `json:"target"`      // user ID, channel name, or wait duration
+	PolicyType  string `json:"policy_type"` // notify_user, notify_channel, notify_schedule, wait
+	Target      string `json:"target"`      // user ID, channel name, schedule ID, or wait duration
 	WaitSeconds int    `json:"wait_seconds"`
+	// AckTimeoutSeconds is how long a notify step waits for an ack before
+	// the chain moves on. Zero moves on immediately.
+	AckTimeoutSeconds int `json:"ack_timeout_seconds"`
 }
 
+// EscalationProgress records how far an alert's escalation has got so it
+// can pick up where it left off after a restart
+type EscalationProgress struct {
+	AlertGroupID int64       `json:"alert_group_id"`
+	ChainID      int64       `json:"chain_id"`
+	NextStep     int         `json:"next_step"` // step number to run next
+	Alert        *AlertGroup `json:"alert"`     // the alert as dispatched
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// Escalation policy types
+const (
+	PolicyNotifyUser     = "notify_user"
+	PolicyNotifyChannel  = "notify_channel"
+	PolicyNotifySchedule = "notify_schedule" // pages whoever is on call for the schedule in Target, as "ID" or "ID:role"
+	PolicyWait           = "wait"
+)
+
 // AlertGroup represents a group of related alerts
 type AlertGroup struct {
-	ID                 int64             `json:"id"`
-	Fingerprint        string            `json:"fingerprint"`
-	Status             string            `json:"status"` // firing, acknowledged, resolved
-	Severity           string            `json:"severity"`
-	Summary            string            `json:"summary"`
-	Description        string            `json:"description"`
-	Labels             map[string]string `json:"labels"`
-	Annotations        map[string]string `json:"annotations"`
-	EscalationChainID  *int64            `json:"escalation_chain_id,omitempty"`
-	AcknowledgedBy     *string           `json:"acknowledged_by,omitempty"`
-	AcknowledgedAt     *time.Time        `json:"acknowledged_at,omitempty"`
-	ResolvedAt         *time.Time        `json:"resolved_at,omitempty"`
-	CreatedAt          time.Time         `json:"created_at"`
-	UpdatedAt          time.Time         `json:"updated_at"`
+	ID                int64             `json:"id"`
+	Fingerprint       string            `json:"fingerprint"`
+	Status            string            `json:"status"` // firing, acknowledged, resolved
+	Severity          string            `json:"severity"`
+	Summary           string            `json:"summary"`
+	Description       string            `json:"description"`
+	Labels            map[string]string `json:"labels"`
+	Annotations       map[string]string `json:"annotations"`
+	Images            []string          `json:"images,omitempty"`  // screenshot URLs, e.g. Grafana panel renders
+	Sources           []string          `json:"sources,omitempty"` // integrations that reported the alert, e.g. prometheus, grafana
+	EscalationChainID *int64            `json:"escalation_chain_id,omitempty"`
+	AcknowledgedBy    *string           `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt    *time.Time        `json:"acknowledged_at,omitempty"`
+	ResolvedAt        *time.Time        `json:"resolved_at,omitempty"`
+	StartsAt          time.Time         `json:"starts_at"`
+	EndsAt            *time.Time        `json:"ends_at,omitempty"`
+	FiringCount       int               `json:"firing_count"`          // times the alert has (re)started firing
+	NotifiedAt        *time.Time        `json:"notified_at,omitempty"` // last time ingestion triggered a notification
+	CreatedAt         time.Time         `json:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at"`
+	// Notify is set on alerts returned from ingestion when the report
+	// should send a notification rather than being deduplicated. It isn't
+	// stored.
+	Notify bool `json:"notify,omitempty"`
 }
 
 // Notification represents a notification sent for an alert
@@ -113,12 +454,50 @@ type Notification struct {
 	CreatedAt    time.Time  `json:"created_at"`
 }
 
+// Notification delivery statuses
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed"
+)
+
+// AlertNote is a comment a responder left on an alert
+type AlertNote struct {
+	ID           int64     `json:"id"`
+	AlertGroupID int64     `json:"alert_group_id"`
+	Author       string    `json:"author"`
+	Text         string    `json:"text"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AlertEvent records an alert changing status
+type AlertEvent struct {
+	ID           int64  `json:"id"`
+	AlertGroupID int64  `json:"alert_group_id"`
+	FromStatus   string `json:"from_status,omitempty"` // empty when the alert was created
+	ToStatus     string `json:"to_status"`
+	// Actor is who acknowledged or resolved the alert, or the integration
+	// that reported it; empty if unknown
+	Actor string    `json:"actor,omitempty"`
+	At    time.Time `json:"at"`
+}
+
 // Integration represents an alert source integration
 type Integration struct {
-	ID                 int64             `json:"id"`
-	Name               string            `json:"name"`
-	Type               string            `json:"type"` // prometheus, grafana, webhook
-	Config             map[string]string `json:"config"`
-	EscalationChainID  *int64            `json:"escalation_chain_id,omitempty"`
-	CreatedAt          time.Time         `json:"created_at"`
+	ID                int64             `json:"id"`
+	Name              string            `json:"name"`
+	Type              string            `json:"type"` // prometheus, grafana, webhook
+	Config            map[string]string `json:"config"`
+	EscalationChainID *int64            `json:"escalation_chain_id,omitempty"`
+	// Token is generated on creation and identifies the integration in
+	// its inbound webhook URL
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
 }
+
+// Integration types
+const (
+	IntegrationPrometheus = "prometheus"
+	IntegrationGrafana    = "grafana"
+	IntegrationWebhook    = "webhook"
+)
@@ -1,17 +1,18 @@
 package models
 
 import (
+	"reflect"
 	"testing"
 	"time"
 )
 
 func TestLayer_GetOnCallUser(t *testing.T) {
 	tests := []struct {
-		name          string
-		layer         Layer
-		queryTime     time.Time
-		expectedUser  string
-		shouldError   bool
+		name         string
+		layer        Layer
+		queryTime    time.Time
+		expectedUser string
+		shouldError  bool
 	}{
 		{
 			name: "daily rotation - first user",
@@ -102,6 +103,50 @@ func TestLayer_GetOnCallUser(t *testing.T) {
 	}
 }
 
+func TestLayer_GetOnCallUser_Restrictions(t *testing.T) {
+	layer := Layer{
+		RotationType:  "daily",
+		RotationStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Users:         []string{"alice", "bob"},
+		Restrictions: []Restriction{
+			{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"},
+			// Friday night into Saturday morning
+			{Days: []string{"fri"}, Start: "22:00", End: "02:00"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"inside weekday window", time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC), "alice"},
+		{"end is exclusive", time.Date(2024, 1, 3, 17, 0, 0, 0, time.UTC), ""},
+		{"weekday night", time.Date(2024, 1, 3, 23, 0, 0, 0, time.UTC), ""},
+		{"friday night window", time.Date(2024, 1, 5, 23, 30, 0, 0, time.UTC), "alice"},
+		{"past midnight into saturday", time.Date(2024, 1, 6, 1, 59, 0, 0, time.UTC), "bob"},
+		{"saturday daytime", time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC), ""},
+		{"thursday night doesn't wrap", time.Date(2024, 1, 5, 1, 0, 0, 0, time.UTC), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := layer.GetOnCallUser(tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, user)
+			}
+		})
+	}
+
+	layer.Restrictions = []Restriction{{Start: "9am", End: "17:00"}}
+	if _, err := layer.GetOnCallUser(time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)); err == nil {
+		t.Error("expected an error for a malformed restriction")
+	}
+}
+
 func TestSchedule_GetCurrentOnCall(t *testing.T) {
 	queryTime := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
 
@@ -118,7 +163,7 @@ func TestSchedule_GetCurrentOnCall(t *testing.T) {
 		},
 	}
 
-	user, err := schedule.GetCurrentOnCall(queryTime)
+	user, err := schedule.GetPrimaryOnCall(queryTime)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -139,7 +184,7 @@ func TestSchedule_GetCurrentOnCall_NoLayers(t *testing.T) {
 		Layers: []Layer{},
 	}
 
-	user, err := schedule.GetCurrentOnCall(time.Now())
+	user, err := schedule.GetPrimaryOnCall(time.Now())
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -148,3 +193,415 @@ func TestSchedule_GetCurrentOnCall_NoLayers(t *testing.T) {
 		t.Errorf("expected empty user, got %q", user)
 	}
 }
+
+func TestSchedule_GetCurrentOnCall_Overrides(t *testing.T) {
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Layers: []Layer{
+			{RotationType: "daily", RotationStart: base, Users: []string{"alice"}},
+		},
+		Overrides: []Override{
+			{ID: 1, User: "bob", Start: base.Add(10 * time.Hour), End: base.Add(14 * time.Hour)},
+			{ID: 2, User: "carol", Start: base.Add(12 * time.Hour), End: base.Add(13 * time.Hour)},
+		},
+	}
+
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{base.Add(9 * time.Hour), "alice"},
+		{base.Add(10 * time.Hour), "bob"},
+		{base.Add(12*time.Hour + 30*time.Minute), "carol"},
+		{base.Add(13 * time.Hour), "bob"},
+		{base.Add(14 * time.Hour), "alice"},
+	}
+
+	for _, tt := range tests {
+		user, err := schedule.GetPrimaryOnCall(tt.at)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user != tt.want {
+			t.Errorf("at %s: expected %q, got %q", tt.at.Format(time.Kitchen), tt.want, user)
+		}
+	}
+}
+
+func TestSchedule_GetCurrentOnCall_Restrictions(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Timezone: "America/New_York",
+		Layers: []Layer{
+			{
+				RotationType:  "weekly",
+				RotationStart: start,
+				Users:         []string{"daytime"},
+				Restrictions:  []Restriction{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}},
+			},
+			{
+				RotationType:  "weekly",
+				RotationStart: start,
+				Users:         []string{"overnight"},
+				Restrictions:  []Restriction{{Start: "22:00", End: "06:00"}},
+			},
+		},
+	}
+	ny, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"weekday business hours", time.Date(2024, 3, 6, 10, 0, 0, 0, ny), "daytime"},
+		{"weekend business hours", time.Date(2024, 3, 9, 10, 0, 0, 0, ny), ""},
+		{"late evening", time.Date(2024, 3, 6, 23, 0, 0, 0, ny), "overnight"},
+		{"early morning", time.Date(2024, 3, 7, 5, 59, 0, 0, ny), "overnight"},
+		{"restriction in schedule timezone", time.Date(2024, 3, 6, 14, 30, 0, 0, time.UTC), "daytime"},
+		{"gap", time.Date(2024, 3, 6, 19, 0, 0, 0, ny), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := schedule.GetPrimaryOnCall(tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, user)
+			}
+		})
+	}
+}
+
+func TestSchedule_GetCurrentOnCall_LayerPriority(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Layers: []Layer{
+			{
+				ID:            1,
+				RotationType:  "weekly",
+				RotationStart: start,
+				Users:         []string{"alice", "bob"},
+			},
+			{
+				ID:            2,
+				RotationType:  "daily",
+				RotationStart: start,
+				Users:         []string{"carol"},
+				Restrictions:  []Restriction{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}},
+				Priority:      10,
+			},
+			{
+				// Higher still, but its rotation hasn't started
+				ID:            3,
+				RotationType:  "daily",
+				RotationStart: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+				Users:         []string{"dave"},
+				Priority:      20,
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		at    time.Time
+		want  string
+		layer int64
+	}{
+		{"higher layer overrides base while active", time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC), "carol", 2},
+		{"falls through outside higher layer's window", time.Date(2024, 1, 3, 20, 0, 0, 0, time.UTC), "alice", 1},
+		{"falls through on the weekend", time.Date(2024, 1, 13, 10, 0, 0, 0, time.UTC), "bob", 1},
+		{"highest layer once its rotation starts", time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC), "dave", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oncall, err := schedule.OnCallAt(tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if oncall.User != tt.want || oncall.LayerID == nil || *oncall.LayerID != tt.layer {
+				t.Errorf("expected %q from layer %d, got %+v", tt.want, tt.layer, oncall)
+			}
+		})
+	}
+
+	// Equal priorities keep the schedule's order
+	schedule.Layers[1].Priority = 0
+	schedule.Layers[2].Priority = 0
+	user, err := schedule.GetPrimaryOnCall(time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user != "alice" {
+		t.Errorf("expected the first layer to win a tie, got %q", user)
+	}
+}
+
+func TestSchedule_GetCurrentOnCall_Roles(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	schedule := Schedule{
+		Layers: []Layer{
+			{
+				ID:            1,
+				RotationType:  "weekly",
+				RotationStart: start,
+				Users:         []string{"alice", "bob"},
+			},
+			{
+				ID:            2,
+				RotationType:  "weekly",
+				RotationStart: start,
+				Users:         []string{"carol", "dave"},
+				Role:          RoleSecondary,
+			},
+			{
+				// Shadows weekdays only, ahead of the base secondary
+				ID:            3,
+				RotationType:  "daily",
+				RotationStart: start,
+				Users:         []string{"erin"},
+				Role:          RoleSecondary,
+				Restrictions:  []Restriction{{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "09:00", End: "17:00"}},
+				Priority:      10,
+			},
+		},
+		Overrides: []Override{
+			{ID: 1, User: "frank", Start: time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want map[string]string
+	}{
+		{"both roles", time.Date(2024, 1, 6, 20, 0, 0, 0, time.UTC),
+			map[string]string{RolePrimary: "alice", RoleSecondary: "carol"}},
+		{"rotations advance independently", time.Date(2024, 1, 13, 20, 0, 0, 0, time.UTC),
+			map[string]string{RolePrimary: "bob", RoleSecondary: "dave"}},
+		{"higher secondary layer while active", time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC),
+			map[string]string{RolePrimary: "alice", RoleSecondary: "erin"}},
+		{"override replaces only the primary", time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC),
+			map[string]string{RolePrimary: "frank", RoleSecondary: "carol"}},
+		{"before any rotation", time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+			map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := schedule.GetCurrentOnCall(tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+
+			primary, err := schedule.GetPrimaryOnCall(tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if primary != tt.want[RolePrimary] {
+				t.Errorf("expected primary %q, got %q", tt.want[RolePrimary], primary)
+			}
+		})
+	}
+}
+
+func TestSchedule_GetCurrentOnCall_OffHours(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	weekdays := []string{"mon", "tue", "wed", "thu", "fri"}
+	schedule := Schedule{
+		Timezone: "America/New_York",
+		Layers: []Layer{
+			{
+				ID:            1,
+				RotationType:  "weekly",
+				RotationStart: start,
+				Users:         []string{"oncall-night"},
+				Restrictions:  []Restriction{{Days: weekdays, Start: "17:00", End: "09:00"}},
+			},
+			{
+				ID:            2,
+				RotationType:  "weekly",
+				RotationStart: start,
+				Users:         []string{"daytime"},
+				Restrictions:  []Restriction{{Days: weekdays, Start: "09:00", End: "17:00"}},
+				Priority:      10,
+			},
+		},
+	}
+	ny, _ := time.LoadLocation("America/New_York")
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"weekday business hours", time.Date(2024, 3, 6, 9, 0, 0, 0, ny), "daytime"},
+		{"weekday evening falls through", time.Date(2024, 3, 6, 17, 0, 0, 0, ny), "oncall-night"},
+		{"overnight crosses midnight", time.Date(2024, 3, 7, 8, 59, 0, 0, ny), "oncall-night"},
+		{"friday night into saturday", time.Date(2024, 3, 9, 8, 0, 0, 0, ny), "oncall-night"},
+		{"weekend gap", time.Date(2024, 3, 9, 12, 0, 0, 0, ny), ""},
+		{"sunday night isn't covered", time.Date(2024, 3, 11, 8, 0, 0, 0, ny), ""},
+		{"windows in schedule timezone", time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC), "daytime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := schedule.GetPrimaryOnCall(tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if user != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, user)
+			}
+		})
+	}
+
+	gaps, err := schedule.Gaps(time.Date(2024, 3, 8, 0, 0, 0, 0, ny), time.Date(2024, 3, 12, 0, 0, 0, 0, ny))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(gaps) != 1 || !gaps[0].Start.Equal(time.Date(2024, 3, 9, 9, 0, 0, 0, ny)) ||
+		!gaps[0].End.Equal(time.Date(2024, 3, 11, 9, 0, 0, 0, ny)) {
+		t.Errorf("expected one weekend gap from saturday 09:00 to monday 09:00, got %+v", gaps)
+	}
+}
+
+func TestSchedule_GetCurrentOnCall_SpringForward(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	// Clocks jump from 02:00 to 03:00 on 2024-03-10, making that day 23
+	// hours long
+	schedule := Schedule{
+		Timezone: "America/New_York",
+		Layers: []Layer{{
+			RotationType:  "daily",
+			RotationStart: time.Date(2024, 3, 8, 0, 0, 0, 0, loc),
+			Users:         []string{"alice", "bob", "carol"},
+		}},
+	}
+
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2024, 3, 8, 23, 59, 0, 0, loc), "alice"},
+		{time.Date(2024, 3, 9, 0, 0, 0, 0, loc), "bob"},
+		{time.Date(2024, 3, 10, 0, 0, 0, 0, loc), "carol"},
+		{time.Date(2024, 3, 10, 23, 30, 0, 0, loc), "carol"},
+		// 24 hours after carol's handoff is 01:00 local; alice takes over
+		// at midnight, not an hour late
+		{time.Date(2024, 3, 11, 0, 0, 0, 0, loc), "alice"},
+		{time.Date(2024, 3, 11, 0, 30, 0, 0, loc), "alice"},
+		{time.Date(2024, 3, 12, 0, 0, 0, 0, loc), "bob"},
+	}
+	for _, tt := range tests {
+		// Queried in UTC to show the schedule's timezone decides
+		got, err := schedule.GetPrimaryOnCall(tt.at.UTC())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.at, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.at, tt.want, got)
+		}
+	}
+}
+
+func TestLayer_GetOnCallUser_HandoffHour(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	hour := 9
+	layer := Layer{
+		RotationType:  "weekly",
+		RotationStart: time.Date(2024, 3, 4, 9, 0, 0, 0, loc),
+		HandoffHour:   &hour,
+		Users:         []string{"alice", "bob"},
+	}
+
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2024, 3, 11, 8, 59, 0, 0, loc), "alice"},
+		// A week after the start spans the spring-forward change, so is
+		// only 167 hours, yet the handoff still lands at 09:00 local
+		{time.Date(2024, 3, 11, 9, 0, 0, 0, loc), "bob"},
+		{time.Date(2024, 3, 18, 8, 59, 0, 0, loc), "bob"},
+		{time.Date(2024, 3, 18, 9, 0, 0, 0, loc), "alice"},
+	}
+	for _, tt := range tests {
+		got, err := layer.GetOnCallUser(tt.at)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.at, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.at, tt.want, got)
+		}
+	}
+
+	hour = 24
+	if _, err := layer.GetOnCallUser(layer.RotationStart); err == nil {
+		t.Error("expected error for out of range handoff hour")
+	}
+}
+
+func TestLayer_GetOnCallUser_HandoffTime(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	// The cycle starts Monday at midnight but hands off Mondays at 10:30
+	hour := 10
+	weekly := Layer{
+		RotationType:  "weekly",
+		RotationStart: time.Date(2024, 1, 1, 0, 0, 0, 0, loc),
+		HandoffHour:   &hour,
+		HandoffMinute: 30,
+		Users:         []string{"alice", "bob"},
+	}
+	daily := weekly
+	daily.RotationType = "daily"
+
+	tests := []struct {
+		layer Layer
+		at    time.Time
+		want  string
+	}{
+		{weekly, time.Date(2024, 1, 1, 0, 0, 0, 0, loc), "alice"},
+		{weekly, time.Date(2024, 1, 1, 10, 30, 0, 0, loc), "alice"},
+		{weekly, time.Date(2024, 1, 8, 0, 0, 0, 0, loc), "alice"},
+		{weekly, time.Date(2024, 1, 8, 10, 29, 0, 0, loc), "alice"},
+		{weekly, time.Date(2024, 1, 8, 10, 30, 0, 0, loc), "bob"},
+		{weekly, time.Date(2024, 1, 15, 10, 30, 0, 0, loc), "alice"},
+		{daily, time.Date(2024, 1, 1, 9, 0, 0, 0, loc), "alice"},
+		{daily, time.Date(2024, 1, 2, 10, 29, 0, 0, loc), "alice"},
+		{daily, time.Date(2024, 1, 2, 10, 30, 0, 0, loc), "bob"},
+		{daily, time.Date(2024, 1, 3, 10, 30, 0, 0, loc), "alice"},
+	}
+	for _, tt := range tests {
+		got, err := tt.layer.GetOnCallUser(tt.at)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %v", tt.layer.RotationType, tt.at, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s %s: expected %s, got %s", tt.layer.RotationType, tt.at, tt.want, got)
+		}
+	}
+
+	weekly.HandoffMinute = 60
+	if _, err := weekly.GetOnCallUser(weekly.RotationStart); err == nil {
+		t.Error("expected error for out of range handoff minute")
+	}
+}
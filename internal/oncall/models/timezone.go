@@ -0,0 +1,58 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timezoneAliases maps common legacy and abbreviated zone names to their
+// canonical IANA names
+var timezoneAliases = map[string]string{
+	"utc":                  "UTC",
+	"etc/utc":              "UTC",
+	"etc/universal":        "UTC",
+	"universal":            "UTC",
+	"zulu":                 "UTC",
+	"gmt":                  "UTC",
+	"etc/gmt":              "UTC",
+	"us/eastern":           "America/New_York",
+	"us/central":           "America/Chicago",
+	"us/mountain":          "America/Denver",
+	"us/arizona":           "America/Phoenix",
+	"us/pacific":           "America/Los_Angeles",
+	"us/alaska":            "America/Anchorage",
+	"us/hawaii":            "Pacific/Honolulu",
+	"canada/eastern":       "America/Toronto",
+	"canada/pacific":       "America/Vancouver",
+	"asia/calcutta":        "Asia/Kolkata",
+	"asia/saigon":          "Asia/Ho_Chi_Minh",
+	"asia/katmandu":        "Asia/Kathmandu",
+	"europe/kiev":          "Europe/Kyiv",
+	"australia/act":        "Australia/Sydney",
+	"australia/nsw":        "Australia/Sydney",
+	"america/buenos_aires": "America/Argentina/Buenos_Aires",
+}
+
+// NormalizeTimezone validates tz as an IANA zone name and returns its
+// canonical form. Empty means UTC. Legacy aliases such as "US/Eastern" are
+// rewritten to their canonical names.
+func NormalizeTimezone(tz string) (string, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		return "UTC", nil
+	}
+	if canonical, ok := timezoneAliases[strings.ToLower(tz)]; ok {
+		tz = canonical
+	}
+
+	// "Local" loads successfully but depends on the server's zone
+	if tz == "Local" {
+		return "", fmt.Errorf("unknown timezone %q", tz)
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return "", fmt.Errorf("unknown timezone %q", tz)
+	}
+
+	return tz, nil
+}
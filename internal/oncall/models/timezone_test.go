@@ -0,0 +1,41 @@
+package models
+
+import "testing"
+
+func TestNormalizeTimezone(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{input: "America/New_York", expected: "America/New_York"},
+		{input: "Europe/Berlin", expected: "Europe/Berlin"},
+		{input: "", expected: "UTC"},
+		{input: "utc", expected: "UTC"},
+		{input: "Etc/UTC", expected: "UTC"},
+		{input: "US/Eastern", expected: "America/New_York"},
+		{input: "Asia/Calcutta", expected: "Asia/Kolkata"},
+		{input: " America/Chicago ", expected: "America/Chicago"},
+		{input: "Mars/Phobos", wantErr: true},
+		{input: "Local", wantErr: true},
+		{input: "EST5EDT+garbage", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := NormalizeTimezone(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
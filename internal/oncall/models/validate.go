@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is a problem with one field of a schedule, named by its JSON
+// path, e.g. "layers[1].users"
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists every problem Validate found
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Rotation types a layer can have
+var rotationTypes = []string{"daily", "weekly", "custom"}
+
+// Validate checks that the schedule and its layers make sense, returning
+// a ValidationError listing every problem, or nil
+func (s *Schedule) Validate() error {
+	var errs ValidationError
+	if _, err := NormalizeTimezone(s.Timezone); err != nil {
+		errs = append(errs, FieldError{Field: "timezone", Message: err.Error()})
+	}
+	for i := range s.Layers {
+		if err := s.Layers[i].Validate(); err != nil {
+			for _, fe := range err.(ValidationError) {
+				fe.Field = fmt.Sprintf("layers[%d].%s", i, fe.Field)
+				errs = append(errs, fe)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the layer's rotation, users, role, handoff time and
+// restrictions, returning a ValidationError with fields named relative to
+// the layer, or nil
+func (l *Layer) Validate() error {
+	var errs ValidationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch l.RotationType {
+	case "daily", "weekly":
+	case "custom":
+		if l.DurationHours <= 0 {
+			add("duration_hours", "must be positive for custom rotations")
+		}
+	default:
+		add("rotation_type", "must be one of %s, got %q", strings.Join(rotationTypes, ", "), l.RotationType)
+	}
+
+	if len(l.Users) == 0 {
+		add("users", "must list at least one user")
+	}
+	seen := make(map[string]bool)
+	for i, user := range l.Users {
+		switch {
+		case strings.TrimSpace(user) == "":
+			add(fmt.Sprintf("users[%d]", i), "must not be empty")
+		case seen[user]:
+			add(fmt.Sprintf("users[%d]", i), "duplicate user %q", user)
+		}
+		seen[user] = true
+	}
+
+	if l.Role != "" && !ValidRole(l.Role) {
+		add("role", "invalid role %q (want %s)", l.Role, strings.Join(Roles, " or "))
+	}
+
+	if l.HandoffHour != nil && (*l.HandoffHour < 0 || *l.HandoffHour > 23) {
+		add("handoff_hour", "must be between 0 and 23")
+	}
+	if l.HandoffMinute < 0 || l.HandoffMinute > 59 {
+		add("handoff_minute", "must be between 0 and 59")
+	}
+
+	for i, r := range l.Restrictions {
+		field := fmt.Sprintf("restrictions[%d]", i)
+		if _, err := parseClock(r.Start); err != nil {
+			add(field+".start", "%v", err)
+		}
+		if _, err := parseClock(r.End); err != nil {
+			add(field+".end", "%v", err)
+		}
+		for j, day := range r.Days {
+			if !validDay(day) {
+				add(fmt.Sprintf("%s.days[%d]", field, j), "unknown day %q (want mon, tue, ...)", day)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validDay reports whether day is a three-letter weekday name, as used in
+// restrictions
+func validDay(day string) bool {
+	switch strings.ToLower(day) {
+	case "mon", "tue", "wed", "thu", "fri", "sat", "sun":
+		return true
+	}
+	return false
+}
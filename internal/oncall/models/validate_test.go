@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func validLayer() Layer {
+	return Layer{
+		Name:          "Primary",
+		RotationType:  "weekly",
+		RotationStart: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		Users:         []string{"alice", "bob"},
+	}
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	hour := func(h int) *int { return &h }
+
+	tests := []struct {
+		name     string
+		timezone string
+		modify   func(l *Layer)
+		want     []string // fields with errors
+	}{
+		{name: "valid", timezone: "Europe/Berlin", modify: func(l *Layer) {}},
+		{name: "empty timezone means UTC", modify: func(l *Layer) {}},
+		{name: "valid custom rotation", modify: func(l *Layer) { l.RotationType = "custom"; l.DurationHours = 12 }},
+		{name: "unknown timezone", timezone: "Mars/Phobos", modify: func(l *Layer) {},
+			want: []string{"timezone"}},
+		{name: "local timezone", timezone: "Local", modify: func(l *Layer) {},
+			want: []string{"timezone"}},
+		{name: "unknown rotation type", modify: func(l *Layer) { l.RotationType = "monthly" },
+			want: []string{"layers[0].rotation_type"}},
+		{name: "missing rotation type", modify: func(l *Layer) { l.RotationType = "" },
+			want: []string{"layers[0].rotation_type"}},
+		{name: "custom rotation without duration", modify: func(l *Layer) { l.RotationType = "custom" },
+			want: []string{"layers[0].duration_hours"}},
+		{name: "custom rotation with negative duration", modify: func(l *Layer) { l.RotationType = "custom"; l.DurationHours = -1 },
+			want: []string{"layers[0].duration_hours"}},
+		{name: "no users", modify: func(l *Layer) { l.Users = nil },
+			want: []string{"layers[0].users"}},
+		{name: "blank user", modify: func(l *Layer) { l.Users = []string{"alice", " "} },
+			want: []string{"layers[0].users[1]"}},
+		{name: "duplicate user", modify: func(l *Layer) { l.Users = []string{"alice", "bob", "alice"} },
+			want: []string{"layers[0].users[2]"}},
+		{name: "unknown role", modify: func(l *Layer) { l.Role = "tertiary" },
+			want: []string{"layers[0].role"}},
+		{name: "handoff hour out of range", modify: func(l *Layer) { l.HandoffHour = hour(24) },
+			want: []string{"layers[0].handoff_hour"}},
+		{name: "handoff minute out of range", modify: func(l *Layer) { l.HandoffHour = hour(9); l.HandoffMinute = 60 },
+			want: []string{"layers[0].handoff_minute"}},
+		{name: "malformed restriction", modify: func(l *Layer) {
+			l.Restrictions = []Restriction{{Days: []string{"mon", "funday"}, Start: "9am", End: "17:00"}}
+		}, want: []string{"layers[0].restrictions[0].start", "layers[0].restrictions[0].days[1]"}},
+		{name: "several problems", timezone: "Nowhere", modify: func(l *Layer) { l.RotationType = "custom"; l.Users = nil },
+			want: []string{"timezone", "layers[0].duration_hours", "layers[0].users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layer := validLayer()
+			tt.modify(&layer)
+			schedule := Schedule{Name: "Platform", Timezone: tt.timezone, Layers: []Layer{layer, validLayer()}}
+
+			err := schedule.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+
+			var verr ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			var fields []string
+			for _, fe := range verr {
+				if fe.Message == "" {
+					t.Errorf("%s: expected a message", fe.Field)
+				}
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("expected errors for %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLayer_Validate(t *testing.T) {
+	layer := validLayer()
+	if err := layer.Validate(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	layer.Users = append(layer.Users, "bob")
+	err := layer.Validate()
+	if err == nil || err.Error() != `users[2]: duplicate user "bob"` {
+		t.Errorf("expected a duplicate user error named relative to the layer, got %v", err)
+	}
+}
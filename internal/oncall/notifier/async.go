@@ -0,0 +1,126 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// Defaults for an async sender created with non-positive settings
+const (
+	DefaultAsyncWorkers   = 4
+	DefaultAsyncQueueSize = 1000
+)
+
+// ErrQueueFull is returned by EnqueueSend when the queue has no room
+var ErrQueueFull = errors.New("notification queue is full")
+
+// AsyncSender delivers notifications in the background, so callers such as
+// the alert webhook handlers don't wait on a slow receiver. Sends go onto a
+// buffered queue served by a fixed number of workers, in no particular
+// order.
+//
+// Each job goes through the wrapped sender once. With a Manager that means
+// the Slack and webhook notifiers retry per their RetryConfig and the final
+// outcome is recorded as the notification's status.
+type AsyncSender struct {
+	sender Sender
+	jobs   chan *sendJob
+
+	// mu guards closed against sends racing Close; EnqueueSend holds it
+	// for reading so enqueues don't serialize
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewAsyncSender starts workers delivering through sender from a queue of
+// queueSize jobs
+func NewAsyncSender(sender Sender, workers, queueSize int) *AsyncSender {
+	if workers <= 0 {
+		workers = DefaultAsyncWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultAsyncQueueSize
+	}
+	a := &AsyncSender{
+		sender: sender,
+		jobs:   make(chan *sendJob, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.work()
+		}()
+	}
+	return a
+}
+
+// EnqueueSend queues a notification and returns without waiting for it.
+// The send keeps ctx's values but not its cancellation, so it outlives the
+// request that queued it. It returns ErrQueueFull rather than block when
+// the queue is full, and ErrPoolClosed after Close.
+func (a *AsyncSender) EnqueueSend(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error {
+	job := &sendJob{
+		ctx:       context.WithoutCancel(ctx),
+		channel:   channel,
+		alert:     alert,
+		recipient: recipient,
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case a.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Backlog returns the number of sends waiting for a worker
+func (a *AsyncSender) Backlog() int {
+	return len(a.jobs)
+}
+
+// Close stops taking sends and waits until the queued ones are delivered
+// or ctx is done, whichever comes first. Sends still queued when ctx ends
+// are delivered in the background regardless.
+func (a *AsyncSender) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.jobs)
+	}
+	a.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *AsyncSender) work() {
+	for job := range a.jobs {
+		if err := a.sender.Send(job.ctx, job.channel, job.alert, job.recipient); err != nil {
+			slog.ErrorContext(job.ctx, "failed to send queued notification",
+				"channel", job.channel,
+				"alert", job.alert.Fingerprint,
+				"error", err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/store"
+)
+
+func TestAsyncSender_DeliversEveryJob(t *testing.T) {
+	sender := &recordingSender{}
+	async := NewAsyncSender(sender, 4, 100)
+
+	var want []string
+	for i := 0; i < 40; i++ {
+		recipient := fmt.Sprintf("user-%02d", i)
+		want = append(want, "slack:"+recipient)
+		if err := async.EnqueueSend(context.Background(), "slack", &models.AlertGroup{}, recipient); err != nil {
+			t.Fatalf("enqueue %d: %v", i, err)
+		}
+	}
+	if err := async.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Workers deliver concurrently, so only the set of sends is fixed
+	sender.mu.Lock()
+	got := append([]string(nil), sender.sent...)
+	sender.mu.Unlock()
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if sender.peak > 4 {
+		t.Errorf("expected at most 4 concurrent sends, saw %d", sender.peak)
+	}
+}
+
+func TestAsyncSender_CloseDrainsQueue(t *testing.T) {
+	sender := &recordingSender{release: make(chan struct{})}
+	async := NewAsyncSender(sender, 1, 10)
+
+	// A cancelled request context doesn't cancel the queued send
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < 5; i++ {
+		if err := async.EnqueueSend(ctx, "slack", &models.AlertGroup{}, "oncall"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cancel()
+
+	closed := make(chan error, 1)
+	go func() { closed <- async.Close(context.Background()) }()
+
+	for i := 0; i < 4; i++ {
+		sender.release <- struct{}{}
+	}
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the last queued send")
+	case <-time.After(20 * time.Millisecond):
+	}
+	sender.release <- struct{}{}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sender.sent) != 5 {
+		t.Errorf("expected all 5 sends delivered, got %d", len(sender.sent))
+	}
+	if err := async.EnqueueSend(context.Background(), "slack", &models.AlertGroup{}, "oncall"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected ErrPoolClosed after Close, got %v", err)
+	}
+}
+
+func TestAsyncSender_StuckReceiverDoesNotBlockEnqueue(t *testing.T) {
+	sender := &recordingSender{release: make(chan struct{})}
+	defer close(sender.release)
+	async := NewAsyncSender(sender, 1, 5)
+
+	start := time.Now()
+	queued := 0
+	for {
+		err := async.EnqueueSend(context.Background(), "slack", &models.AlertGroup{}, "oncall")
+		if errors.Is(err, ErrQueueFull) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued++
+		if queued > 10 {
+			t.Fatal("expected the queue to fill up")
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected enqueueing to return immediately, took %s", elapsed)
+	}
+	if queued < 5 {
+		t.Errorf("expected at least the queue size to be accepted, got %d", queued)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := async.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Close to give up with the receiver stuck, got %v", err)
+	}
+}
+
+func TestAsyncSender_RecordsFailures(t *testing.T) {
+	st, err := store.New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	manager := NewManager()
+	manager.SetRecorder(st)
+	manager.Register(&mockNotifier{channel: "webhook", sendFn: func(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+		return errors.New("webhook returned status 503")
+	}})
+
+	async := NewAsyncSender(manager, 2, 10)
+	if err := async.EnqueueSend(context.Background(), "webhook", &models.AlertGroup{ID: 7, Fingerprint: "abc"}, "https://hooks.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := async.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := st.ListNotificationsByAlert(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Status != models.NotificationFailed {
+		t.Errorf("expected one failed notification, got %+v", history)
+	}
+}
@@ -0,0 +1,218 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// DefaultEndpointCooldown is how long a balanced endpoint is skipped after
+// a failed send
+const DefaultEndpointCooldown = 30 * time.Second
+
+// Balancing strategies for BalancedNotifier
+const (
+	BalanceRoundRobin = "round-robin"
+	BalanceWeighted   = "weighted"
+)
+
+// Endpoint is one recipient URL in a balanced pool. Weight only matters for
+// the weighted strategy; zero counts as 1.
+type Endpoint struct {
+	URL    string
+	Weight int
+}
+
+// ParseEndpoint parses "URL" or "URL;weight", e.g.
+// "https://hooks-2.example.com/alert;3"
+func ParseEndpoint(s string) (Endpoint, error) {
+	endpoint := Endpoint{URL: s, Weight: 1}
+	if i := strings.LastIndex(s, ";"); i >= 0 {
+		weight, err := strconv.Atoi(s[i+1:])
+		if err != nil || weight <= 0 {
+			return Endpoint{}, fmt.Errorf("invalid endpoint %q: weight must be a positive integer", s)
+		}
+		endpoint.URL, endpoint.Weight = s[:i], weight
+	}
+
+	u, err := url.Parse(endpoint.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Endpoint{}, fmt.Errorf("invalid endpoint %q: expected an http(s) URL", s)
+	}
+	return endpoint, nil
+}
+
+// BalancedNotifier spreads sends across a pool of identical receivers,
+// delivering each one through an underlying notifier with the endpoint URL
+// as recipient. The recipient passed to Send is ignored.
+//
+// An endpoint whose send fails is skipped for a cooldown and the send moves
+// on to the next healthy one. If every endpoint is cooling down they are
+// all tried anyway, so a send is never dropped for lack of candidates.
+type BalancedNotifier struct {
+	channel  string
+	notifier Notifier
+	strategy string
+	cooldown time.Duration
+	now      func() time.Time
+	rand     *rand.Rand
+
+	mu        sync.Mutex
+	endpoints []*balancedEndpoint
+	next      int
+}
+
+type balancedEndpoint struct {
+	Endpoint
+	downUntil time.Time
+}
+
+// NewBalancedNotifier registers as channel and sends through notifier,
+// typically a WebhookNotifier. strategy is BalanceRoundRobin or
+// BalanceWeighted; empty means round-robin.
+func NewBalancedNotifier(channel string, notifier Notifier, endpoints []Endpoint, strategy string) (*BalancedNotifier, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("balanced notifier needs at least one endpoint")
+	}
+	switch strategy {
+	case "":
+		strategy = BalanceRoundRobin
+	case BalanceRoundRobin, BalanceWeighted:
+	default:
+		return nil, fmt.Errorf("unknown balancing strategy %q", strategy)
+	}
+
+	b := &BalancedNotifier{
+		channel:  channel,
+		notifier: notifier,
+		strategy: strategy,
+		cooldown: DefaultEndpointCooldown,
+		now:      time.Now,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, e := range endpoints {
+		if e.Weight <= 0 {
+			e.Weight = 1
+		}
+		b.endpoints = append(b.endpoints, &balancedEndpoint{Endpoint: e})
+	}
+	return b, nil
+}
+
+func (b *BalancedNotifier) Channel() string {
+	return b.channel
+}
+
+func (b *BalancedNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	var errs []error
+	for _, endpoint := range b.order() {
+		err := b.notifier.Send(ctx, alert, endpoint.URL)
+		if err == nil {
+			b.markUp(endpoint)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		b.markDown(endpoint)
+		slog.WarnContext(ctx, "balanced endpoint failed, trying next",
+			"channel", b.channel,
+			"endpoint", redactURL(endpoint.URL),
+			"error", err)
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("all %d endpoints failed: %w", len(errs), errors.Join(errs...))
+}
+
+// order returns the endpoints to try for one send: the strategy's pick
+// first, then the other healthy endpoints, then those cooling down
+// soonest-recovering first
+func (b *BalancedNotifier) order() []*balancedEndpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	var healthy, down []*balancedEndpoint
+	for _, e := range b.endpoints {
+		if now.Before(e.downUntil) {
+			down = append(down, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+
+	if len(healthy) > 0 {
+		first := b.pick(healthy)
+		healthy[0], healthy[first] = healthy[first], healthy[0]
+	}
+	for i := 1; i < len(down); i++ {
+		for j := i; j > 0 && down[j].downUntil.Before(down[j-1].downUntil); j-- {
+			down[j], down[j-1] = down[j-1], down[j]
+		}
+	}
+	return append(healthy, down...)
+}
+
+// pick returns the index in healthy of the endpoint to try first
+func (b *BalancedNotifier) pick(healthy []*balancedEndpoint) int {
+	if b.strategy == BalanceWeighted {
+		total := 0
+		for _, e := range healthy {
+			total += e.Weight
+		}
+		n := b.rand.Intn(total)
+		for i, e := range healthy {
+			if n < e.Weight {
+				return i
+			}
+			n -= e.Weight
+		}
+	}
+
+	// Round-robin over the full pool so skipping a dead endpoint doesn't
+	// shift the rotation of the others
+	for range b.endpoints {
+		candidate := b.endpoints[b.next%len(b.endpoints)]
+		b.next++
+		for i, e := range healthy {
+			if e == candidate {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func (b *BalancedNotifier) markDown(e *balancedEndpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.downUntil = b.now().Add(b.cooldown)
+}
+
+func (b *BalancedNotifier) markUp(e *balancedEndpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.downUntil = time.Time{}
+}
+
+// redactURL drops credentials and the query string, which webhook URLs
+// often use for tokens
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid url>"
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
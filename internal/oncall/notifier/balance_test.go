@@ -0,0 +1,186 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// endpointNotifier counts sends per recipient and fails for recipients in
+// down
+type endpointNotifier struct {
+	mu    sync.Mutex
+	sends map[string]int
+	down  map[string]bool
+}
+
+func newEndpointNotifier(down ...string) *endpointNotifier {
+	n := &endpointNotifier{sends: make(map[string]int), down: make(map[string]bool)}
+	for _, url := range down {
+		n.down[url] = true
+	}
+	return n
+}
+
+func (n *endpointNotifier) Channel() string { return "webhook" }
+
+func (n *endpointNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sends[recipient]++
+	if n.down[recipient] {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+var balancedURLs = []string{
+	"https://hooks-1.example.com/alert",
+	"https://hooks-2.example.com/alert",
+	"https://hooks-3.example.com/alert",
+}
+
+func balancedEndpoints(weights ...int) []Endpoint {
+	endpoints := make([]Endpoint, len(balancedURLs))
+	for i, url := range balancedURLs {
+		endpoints[i] = Endpoint{URL: url, Weight: 1}
+		if i < len(weights) {
+			endpoints[i].Weight = weights[i]
+		}
+	}
+	return endpoints
+}
+
+func TestBalancedNotifier_RoundRobinIsEven(t *testing.T) {
+	inner := newEndpointNotifier()
+	b, err := NewBalancedNotifier("webhook-pool", inner, balancedEndpoints(), BalanceRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 30; i++ {
+		if err := b.Send(context.Background(), &models.AlertGroup{}, "ignored"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, url := range balancedURLs {
+		if inner.sends[url] != 10 {
+			t.Errorf("expected 10 sends to %s, got %d", url, inner.sends[url])
+		}
+	}
+	if inner.sends["ignored"] != 0 {
+		t.Error("expected the send's own recipient to be ignored")
+	}
+}
+
+func TestBalancedNotifier_WeightedDistribution(t *testing.T) {
+	inner := newEndpointNotifier()
+	b, err := NewBalancedNotifier("webhook-pool", inner, balancedEndpoints(1, 1, 2), BalanceWeighted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.rand = rand.New(rand.NewSource(1))
+
+	const sends = 4000
+	for i := 0; i < sends; i++ {
+		if err := b.Send(context.Background(), &models.AlertGroup{}, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Expect a quarter, a quarter and a half, within 10%
+	for i, share := range []float64{0.25, 0.25, 0.5} {
+		want := share * sends
+		got := float64(inner.sends[balancedURLs[i]])
+		if got < want*0.9 || got > want*1.1 {
+			t.Errorf("expected about %.0f sends to %s, got %.0f", want, balancedURLs[i], got)
+		}
+	}
+}
+
+func TestBalancedNotifier_SkipsUnhealthyEndpoint(t *testing.T) {
+	dead := balancedURLs[1]
+	inner := newEndpointNotifier(dead)
+	b, err := NewBalancedNotifier("webhook-pool", inner, balancedEndpoints(), BalanceRoundRobin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 30; i++ {
+		if err := b.Send(context.Background(), &models.AlertGroup{}, ""); err != nil {
+			t.Fatalf("send %d: expected failover to a healthy endpoint, got %v", i, err)
+		}
+	}
+	if inner.sends[dead] != 1 {
+		t.Errorf("expected the dead endpoint to be tried once, got %d", inner.sends[dead])
+	}
+	if inner.sends[balancedURLs[0]]+inner.sends[balancedURLs[2]] != 30 {
+		t.Errorf("expected all sends delivered by healthy endpoints, got %v", inner.sends)
+	}
+
+	// Once the cooldown passes the endpoint is tried again
+	now = now.Add(DefaultEndpointCooldown)
+	for i := 0; i < 3; i++ {
+		b.Send(context.Background(), &models.AlertGroup{}, "")
+	}
+	if inner.sends[dead] != 2 {
+		t.Errorf("expected the dead endpoint to be retried after cooldown, got %d", inner.sends[dead])
+	}
+}
+
+func TestBalancedNotifier_AllEndpointsDown(t *testing.T) {
+	inner := newEndpointNotifier(balancedURLs...)
+	b, err := NewBalancedNotifier("webhook-pool", inner, balancedEndpoints(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Send(context.Background(), &models.AlertGroup{}, ""); err == nil {
+		t.Fatal("expected error when every endpoint fails")
+	}
+	// Cooling-down endpoints are still tried rather than dropping the send
+	inner.down = map[string]bool{}
+	if err := b.Send(context.Background(), &models.AlertGroup{}, ""); err != nil {
+		t.Errorf("expected send to recovered endpoint, got %v", err)
+	}
+}
+
+func TestNewBalancedNotifier_Invalid(t *testing.T) {
+	if _, err := NewBalancedNotifier("webhook-pool", newEndpointNotifier(), nil, ""); err == nil {
+		t.Error("expected error for empty pool")
+	}
+	if _, err := NewBalancedNotifier("webhook-pool", newEndpointNotifier(), balancedEndpoints(), "random"); err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Endpoint
+		wantErr bool
+	}{
+		{in: "https://hooks.example.com/alert", want: Endpoint{URL: "https://hooks.example.com/alert", Weight: 1}},
+		{in: "https://hooks.example.com/alert?token=a;3", want: Endpoint{URL: "https://hooks.example.com/alert?token=a", Weight: 3}},
+		{in: "https://hooks.example.com/alert;0", wantErr: true},
+		{in: "https://hooks.example.com/alert;x", wantErr: true},
+		{in: "hooks.example.com/alert", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEndpoint(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected error=%v, got %v", tt.in, tt.wantErr, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
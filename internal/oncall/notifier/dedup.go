@@ -0,0 +1,82 @@
+package notifier
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// DefaultDedupTTL is used when a deduplicator is created with a
+// non-positive TTL
+const DefaultDedupTTL = 5 * time.Minute
+
+// Deduplicator suppresses repeat notifications for the same alert, channel,
+// recipient and status within a TTL. Status is part of the key so a resolve
+// right after a firing notification still goes out, and recipient so a
+// fan-out to several people on one channel reaches each of them.
+type Deduplicator struct {
+	ttl        time.Duration
+	now        func() time.Time
+	mu         sync.Mutex
+	sent       map[dedupKey]time.Time
+	suppressed atomic.Int64
+}
+
+type dedupKey struct {
+	fingerprint string
+	channel     string
+	recipient   string
+	status      string
+}
+
+func NewDeduplicator(ttl time.Duration) *Deduplicator {
+	if ttl <= 0 {
+		ttl = DefaultDedupTTL
+	}
+	return &Deduplicator{
+		ttl:  ttl,
+		now:  time.Now,
+		sent: make(map[dedupKey]time.Time),
+	}
+}
+
+// Allow records a send of alert to recipient on channel and reports whether
+// it should go out. A send within the TTL of the previous one is counted as
+// suppressed.
+func (d *Deduplicator) Allow(channel, recipient string, alert *models.AlertGroup) bool {
+	key := dedupKey{
+		fingerprint: alert.Fingerprint,
+		channel:     channel,
+		recipient:   recipient,
+		status:      alert.Status,
+	}
+	now := d.now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.sent[key]; ok && now.Sub(last) < d.ttl {
+		d.suppressed.Add(1)
+		return false
+	}
+	d.sent[key] = now
+	d.prune(now)
+	return true
+}
+
+// Suppressed returns how many sends have been suppressed so far
+func (d *Deduplicator) Suppressed() int64 {
+	return d.suppressed.Load()
+}
+
+// prune drops expired entries so the map doesn't grow with every alert ever
+// seen. Callers hold d.mu.
+func (d *Deduplicator) prune(now time.Time) {
+	for key, last := range d.sent {
+		if now.Sub(last) >= d.ttl {
+			delete(d.sent, key)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package notifier
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+type countingNotifier struct {
+	mu    sync.Mutex
+	sends int
+}
+
+func (n *countingNotifier) Channel() string { return "slack" }
+
+func (n *countingNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	n.mu.Lock()
+	n.sends++
+	n.mu.Unlock()
+	return nil
+}
+
+func TestManager_SuppressesDuplicatesWithinTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dedup := NewDeduplicator(time.Minute)
+	dedup.now = func() time.Time { return now }
+
+	notifier := &countingNotifier{}
+	manager := NewManager()
+	manager.Register(notifier)
+	manager.SetDeduplicator(dedup)
+
+	alert := &models.AlertGroup{Fingerprint: "fp1", Status: "firing"}
+	send := func() {
+		t.Helper()
+		if err := manager.Send(context.Background(), "slack", alert, "#oncall"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	send()
+	now = now.Add(30 * time.Second)
+	send()
+
+	if notifier.sends != 1 {
+		t.Errorf("expected second send within TTL to be suppressed, got %d sends", notifier.sends)
+	}
+	if dedup.Suppressed() != 1 {
+		t.Errorf("expected 1 suppressed send, got %d", dedup.Suppressed())
+	}
+
+	now = now.Add(31 * time.Second)
+	send()
+
+	if notifier.sends != 2 {
+		t.Errorf("expected send after TTL to go out, got %d sends", notifier.sends)
+	}
+}
+
+func TestDeduplicator_KeyedByStatusChannelAndRecipient(t *testing.T) {
+	dedup := NewDeduplicator(time.Minute)
+
+	firing := &models.AlertGroup{Fingerprint: "fp1", Status: "firing"}
+	resolved := &models.AlertGroup{Fingerprint: "fp1", Status: "resolved"}
+
+	if !dedup.Allow("slack", "#oncall", firing) {
+		t.Fatal("expected first send to be allowed")
+	}
+	if !dedup.Allow("email", "#oncall", firing) {
+		t.Error("expected send on a different channel to be allowed")
+	}
+	if !dedup.Allow("slack", "#oncall", resolved) {
+		t.Error("expected send for a new status to be allowed")
+	}
+	if !dedup.Allow("slack", "#db", firing) {
+		t.Error("expected send to a different recipient to be allowed")
+	}
+	if dedup.Allow("slack", "#oncall", firing) {
+		t.Error("expected repeat send to be suppressed")
+	}
+}
+
+func TestManager_DedupDeliversToEveryRecipient(t *testing.T) {
+	notifier := &countingNotifier{}
+	manager := NewManager()
+	manager.Register(notifier)
+	manager.SetDeduplicator(NewDeduplicator(time.Minute))
+
+	alert := &models.AlertGroup{Fingerprint: "fp1", Status: "firing"}
+	for _, recipient := range []string{"#team-a", "#team-b"} {
+		if err := manager.Send(context.Background(), "slack", alert, recipient); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if notifier.sends != 2 {
+		t.Errorf("expected both recipients to be notified, got %d sends", notifier.sends)
+	}
+}
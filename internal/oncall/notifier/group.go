@@ -0,0 +1,203 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// GroupNotifier is implemented by notifiers that can fold several alerts
+// into a single message
+type GroupNotifier interface {
+	SendGroup(ctx context.Context, alerts []*models.AlertGroup, recipient string) error
+}
+
+// SendGroup notifies recipient about several alerts at once. Channels that
+// can't group get one Send per alert. Duplicates are dropped, a group
+// counts as one message against the throttle, and every alert gets its own
+// notification record, as with Send.
+func (m *Manager) SendGroup(ctx context.Context, channel string, alerts []*models.AlertGroup, recipient string) error {
+	notifier, ok := m.notifiers[channel]
+	if !ok {
+		return fmt.Errorf("unknown notification channel: %s", channel)
+	}
+
+	group, ok := notifier.(GroupNotifier)
+	if !ok {
+		var errs []error
+		for _, alert := range alerts {
+			errs = append(errs, m.Send(ctx, channel, alert, recipient))
+		}
+		return errors.Join(errs...)
+	}
+
+	var pending []*models.AlertGroup
+	for _, alert := range alerts {
+		if m.dedup != nil && !m.dedup.Allow(channel, recipient, alert) {
+			continue
+		}
+		pending = append(pending, alert)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if m.throttle != nil {
+		ok, summaryIn, first := m.throttle.admit(channel, recipient)
+		if !ok {
+			slog.InfoContext(ctx, "throttling grouped notification",
+				"channel", channel,
+				"recipient", recipient,
+				"alerts", len(pending))
+			if first {
+				m.throttle.after(summaryIn, func() { m.sendThrottleSummary(notifier, channel, recipient) })
+			}
+			return nil
+		}
+	}
+
+	slog.InfoContext(ctx, "sending grouped notification",
+		"channel", channel,
+		"recipient", recipient,
+		"alerts", len(pending))
+
+	records := make([]*models.Notification, len(pending))
+	for i, alert := range pending {
+		records[i] = m.recordPending(ctx, channel, alert, recipient)
+	}
+	err := group.SendGroup(ctx, pending, recipient)
+	for _, record := range records {
+		m.recordOutcome(ctx, record, err)
+	}
+	return err
+}
+
+// Slack rejects messages with more blocks than this, or section text
+// longer than this many characters
+const (
+	slackMaxBlocks      = 50
+	slackMaxSectionText = 3000
+
+	// slackMaxGroupAlerts caps how many alerts a grouped message lists
+	// before summarizing the rest, so an alert storm stays readable
+	slackMaxGroupAlerts = 20
+)
+
+// SendGroup posts one Slack message listing alerts. Groups too large for a
+// single message list the first alerts and end with "and N more".
+// Templates apply to single alerts only, so a group of one is sent with
+// Send.
+func (n *SlackNotifier) SendGroup(ctx context.Context, alerts []*models.AlertGroup, recipient string) error {
+	if len(alerts) == 1 {
+		return n.Send(ctx, alerts[0], recipient)
+	}
+
+	if err := n.post(ctx, n.buildSlackGroupMessage(alerts), recipient); err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "slack grouped notification sent successfully",
+		"alerts", len(alerts))
+	return nil
+}
+
+func (n *SlackNotifier) buildSlackGroupMessage(alerts []*models.AlertGroup) *SlackMessage {
+	header := groupHeader(alerts, n.theme)
+	message := &SlackMessage{
+		Text: header,
+		Blocks: []SlackBlock{{
+			Type: "section",
+			Text: &SlackTextObj{Type: "mrkdwn", Text: header},
+		}},
+	}
+
+	listed := 0
+	var section strings.Builder
+	flush := func() {
+		if section.Len() == 0 {
+			return
+		}
+		message.Blocks = append(message.Blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackTextObj{Type: "mrkdwn", Text: section.String()},
+		})
+		section.Reset()
+	}
+
+	for _, alert := range alerts {
+		if listed == slackMaxGroupAlerts {
+			break
+		}
+		line := truncateText(fmt.Sprintf("%s *%s* - %s", n.theme.Icon(alert), alert.Severity, alert.Summary), slackMaxSectionText)
+		if section.Len() > 0 && section.Len()+1+len(line) > slackMaxSectionText {
+			flush()
+		}
+		// Leave room for this alert's section and the remainder line
+		if section.Len() == 0 && len(message.Blocks)+2 > slackMaxBlocks {
+			break
+		}
+		if section.Len() > 0 {
+			section.WriteByte('\n')
+		}
+		section.WriteString(line)
+		listed++
+	}
+	flush()
+
+	if remaining := len(alerts) - listed; remaining > 0 {
+		message.Blocks = append(message.Blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackTextObj{Type: "mrkdwn", Text: fmt.Sprintf("_…and %d more %s_", remaining, plural(remaining, "alert"))},
+		})
+	}
+	return message
+}
+
+// groupHeader summarizes a group, e.g. "🔥 *50 alerts*: 48 firing, 2 resolved"
+func groupHeader(alerts []*models.AlertGroup, theme NotificationTheme) string {
+	counts := make(map[string]int)
+	var order []string
+	for _, alert := range alerts {
+		if counts[alert.Status] == 0 {
+			order = append(order, alert.Status)
+		}
+		counts[alert.Status]++
+	}
+
+	parts := make([]string, 0, len(order))
+	for _, status := range order {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+	}
+
+	icon := theme.Icon(&models.AlertGroup{Status: "firing"})
+	if counts["firing"] == 0 && len(alerts) > 0 {
+		icon = theme.Icon(alerts[0])
+	}
+	return fmt.Sprintf("%s *%d %s*: %s", icon, len(alerts), plural(len(alerts), "alert"), strings.Join(parts, ", "))
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// truncateText cuts s to at most max bytes on a UTF-8 boundary, ending it
+// with an ellipsis if anything was dropped
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	const ellipsis = "…"
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
@@ -0,0 +1,156 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func alertStorm(n int, summary func(i int) string) []*models.AlertGroup {
+	alerts := make([]*models.AlertGroup, n)
+	for i := range alerts {
+		alerts[i] = &models.AlertGroup{
+			ID:          int64(i + 1),
+			Fingerprint: fmt.Sprintf("fp%d", i),
+			Status:      "firing",
+			Severity:    "critical",
+			Summary:     summary(i),
+		}
+	}
+	return alerts
+}
+
+func checkSlackLimits(t *testing.T, msg *SlackMessage) {
+	t.Helper()
+	if len(msg.Blocks) > slackMaxBlocks {
+		t.Errorf("expected at most %d blocks, got %d", slackMaxBlocks, len(msg.Blocks))
+	}
+	for i, block := range msg.Blocks {
+		if block.Text != nil && len(block.Text.Text) > slackMaxSectionText {
+			t.Errorf("block %d: text of %d bytes exceeds %d", i, len(block.Text.Text), slackMaxSectionText)
+		}
+	}
+}
+
+func TestSlackNotifier_buildSlackGroupMessage_LongList(t *testing.T) {
+	alerts := alertStorm(50, func(i int) string { return fmt.Sprintf("Disk full on db%d", i) })
+	alerts[49].Status = "resolved"
+
+	msg := NewSlackNotifier("").buildSlackGroupMessage(alerts)
+	checkSlackLimits(t, msg)
+
+	if want := "🔥 *50 alerts*: 49 firing, 1 resolved"; msg.Text != want || msg.Blocks[0].Text.Text != want {
+		t.Errorf("expected header %q, got %q", want, msg.Text)
+	}
+
+	var listed int
+	for _, block := range msg.Blocks[1 : len(msg.Blocks)-1] {
+		listed += strings.Count(block.Text.Text, "Disk full on")
+	}
+	if listed != slackMaxGroupAlerts {
+		t.Errorf("expected %d alerts listed, got %d", slackMaxGroupAlerts, listed)
+	}
+	if last := msg.Blocks[len(msg.Blocks)-1].Text.Text; last != "_…and 30 more alerts_" {
+		t.Errorf("expected the remainder to be summarized, got %q", last)
+	}
+}
+
+func TestSlackNotifier_buildSlackGroupMessage_HugeSummaries(t *testing.T) {
+	alerts := alertStorm(50, func(i int) string { return strings.Repeat("é", 2000) })
+
+	msg := NewSlackNotifier("").buildSlackGroupMessage(alerts)
+	checkSlackLimits(t, msg)
+
+	for _, block := range msg.Blocks {
+		if !utf8.ValidString(block.Text.Text) {
+			t.Fatal("expected truncation to keep text valid UTF-8")
+		}
+	}
+	if last := msg.Blocks[len(msg.Blocks)-1].Text.Text; last != "_…and 30 more alerts_" {
+		t.Errorf("expected the remainder to be summarized, got %q", last)
+	}
+}
+
+func TestSlackNotifier_buildSlackGroupMessage_FitsWithoutRemainder(t *testing.T) {
+	alerts := alertStorm(3, func(i int) string { return fmt.Sprintf("Alert %d", i) })
+
+	msg := NewSlackNotifier("").buildSlackGroupMessage(alerts)
+	if len(msg.Blocks) != 2 {
+		t.Fatalf("expected a header and one section, got %d blocks", len(msg.Blocks))
+	}
+	if strings.Contains(msg.Blocks[1].Text.Text, "more") || strings.Count(msg.Blocks[1].Text.Text, "\n") != 2 {
+		t.Errorf("expected all three alerts listed, got %q", msg.Blocks[1].Text.Text)
+	}
+}
+
+func TestManager_SendGroup(t *testing.T) {
+	var posts atomic.Int32
+	received := make(chan SlackMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		var msg SlackMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer server.Close()
+
+	var webhookSends atomic.Int32
+	manager := NewManager()
+	manager.Register(NewSlackNotifier(server.URL))
+	manager.Register(&mockNotifier{channel: "webhook", sendFn: func(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+		webhookSends.Add(1)
+		return nil
+	}})
+
+	alerts := alertStorm(50, func(i int) string { return fmt.Sprintf("Alert %d", i) })
+	if err := manager.SendGroup(context.Background(), "slack", alerts, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := posts.Load(); n != 1 {
+		t.Errorf("expected one Slack message for the group, got %d", n)
+	}
+	if msg := <-received; !strings.Contains(msg.Blocks[len(msg.Blocks)-1].Text.Text, "30 more") {
+		t.Errorf("expected the posted message to summarize the remainder, got %+v", msg.Blocks)
+	}
+
+	// Channels without grouping get one send per alert
+	if err := manager.SendGroup(context.Background(), "webhook", alerts[:5], "https://hooks.example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := webhookSends.Load(); n != 5 {
+		t.Errorf("expected 5 webhook sends, got %d", n)
+	}
+}
+
+func TestManager_SendGroupThrottled(t *testing.T) {
+	var posts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+	}))
+	defer server.Close()
+
+	manager := NewManager()
+	manager.Register(NewSlackNotifier(server.URL))
+	throttle := NewThrottle(1, time.Hour)
+	throttle.after = func(time.Duration, func()) {}
+	manager.SetThrottle(throttle)
+
+	alerts := alertStorm(10, func(i int) string { return fmt.Sprintf("Alert %d", i) })
+	for i := 0; i < 2; i++ {
+		if err := manager.SendGroup(context.Background(), "slack", alerts, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := posts.Load(); n != 1 {
+		t.Errorf("expected the second group to be throttled, got %d posts", n)
+	}
+}
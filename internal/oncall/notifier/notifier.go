@@ -3,10 +3,14 @@ package notifier
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/vjranagit/grafana/internal/oncall/models"
@@ -18,9 +22,19 @@ type Notifier interface {
 	Channel() string
 }
 
+// Recorder keeps a delivery history of notifications. store.Store
+// implements it.
+type Recorder interface {
+	CreateNotification(ctx context.Context, n *models.Notification) error
+	UpdateNotificationStatus(ctx context.Context, id int64, status, errMsg string) error
+}
+
 // Manager manages multiple notification channels
 type Manager struct {
 	notifiers map[string]Notifier
+	dedup     *Deduplicator
+	throttle  *Throttle
+	recorder  Recorder
 }
 
 func NewManager() *Manager {
@@ -33,32 +47,194 @@ func (m *Manager) Register(notifier Notifier) {
 	m.notifiers[notifier.Channel()] = notifier
 }
 
+// Notifier returns the notifier registered for channel
+func (m *Manager) Notifier(channel string) (Notifier, bool) {
+	n, ok := m.notifiers[channel]
+	return n, ok
+}
+
+// SetDeduplicator enables suppression of repeat sends. Pass nil to disable.
+func (m *Manager) SetDeduplicator(d *Deduplicator) {
+	m.dedup = d
+}
+
+// SetThrottle caps notifications per channel and recipient, see Throttle.
+// Pass nil to disable.
+func (m *Manager) SetThrottle(t *Throttle) {
+	m.throttle = t
+}
+
+// SetRecorder records every send as a notification row: pending before
+// the notifier runs, then sent or failed. Pass nil to disable.
+func (m *Manager) SetRecorder(r Recorder) {
+	m.recorder = r
+}
+
 func (m *Manager) Send(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error {
 	notifier, ok := m.notifiers[channel]
 	if !ok {
 		return fmt.Errorf("unknown notification channel: %s", channel)
 	}
 
-	slog.Info("sending notification",
+	if m.dedup != nil && !m.dedup.Allow(channel, recipient, alert) {
+		slog.InfoContext(ctx, "suppressing duplicate notification",
+			"channel", channel,
+			"alert", alert.Fingerprint,
+			"status", alert.Status)
+		return nil
+	}
+
+	if m.throttle != nil {
+		ok, summaryIn, first := m.throttle.admit(channel, recipient)
+		if !ok {
+			slog.InfoContext(ctx, "throttling notification",
+				"channel", channel,
+				"recipient", recipient,
+				"alert", alert.Fingerprint)
+			if first {
+				m.throttle.after(summaryIn, func() { m.sendThrottleSummary(notifier, channel, recipient) })
+			}
+			return nil
+		}
+	}
+
+	slog.InfoContext(ctx, "sending notification",
 		"channel", channel,
 		"recipient", recipient,
 		"alert", alert.Fingerprint)
 
-	return notifier.Send(ctx, alert, recipient)
+	record := m.recordPending(ctx, channel, alert, recipient)
+	err := notifier.Send(ctx, alert, recipient)
+	m.recordOutcome(ctx, record, err)
+	return err
+}
+
+// sendThrottleSummary tells recipient how many notifications the throttle
+// held back since it last heard from channel
+func (m *Manager) sendThrottleSummary(notifier Notifier, channel, recipient string) {
+	held := m.throttle.drain(channel, recipient)
+	if held == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	noun := "alerts"
+	if held == 1 {
+		noun = "alert"
+	}
+	summary := &models.AlertGroup{
+		Fingerprint: "throttled:" + channel,
+		Status:      "firing",
+		Severity:    "warning",
+		Summary:     fmt.Sprintf("%d more %s suppressed", held, noun),
+		Description: fmt.Sprintf("Notifications were limited to %d per %s; check the alert list for the rest.",
+			m.throttle.limit, m.throttle.window),
+		Labels:    map[string]string{"alertname": "NotificationsThrottled"},
+		StartsAt:  now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	slog.Info("sending throttle summary",
+		"channel", channel,
+		"recipient", recipient,
+		"suppressed", held)
+	if err := notifier.Send(ctx, summary, recipient); err != nil {
+		slog.Error("failed to send throttle summary",
+			"channel", channel,
+			"suppressed", held,
+			"error", err)
+	}
+}
+
+// recordPending stores a pending notification and returns it, or nil if
+// there is no recorder or the alert isn't stored. History is best effort:
+// a failed write is logged and the send goes ahead.
+func (m *Manager) recordPending(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) *models.Notification {
+	if m.recorder == nil || alert.ID == 0 {
+		return nil
+	}
+	n := &models.Notification{
+		AlertGroupID: alert.ID,
+		Channel:      channel,
+		Recipient:    recipient,
+		Status:       models.NotificationPending,
+	}
+	if err := m.recorder.CreateNotification(ctx, n); err != nil {
+		slog.WarnContext(ctx, "failed to record notification",
+			"channel", channel,
+			"alert", alert.Fingerprint,
+			"error", err)
+		return nil
+	}
+	return n
+}
+
+func (m *Manager) recordOutcome(ctx context.Context, n *models.Notification, sendErr error) {
+	if n == nil {
+		return
+	}
+	status, errMsg := models.NotificationSent, ""
+	if sendErr != nil {
+		status, errMsg = models.NotificationFailed, sendErr.Error()
+	}
+	// Record the outcome even if the send was cut short by cancellation
+	if err := m.recorder.UpdateNotificationStatus(context.WithoutCancel(ctx), n.ID, status, errMsg); err != nil {
+		slog.WarnContext(ctx, "failed to update notification status",
+			"notification", n.ID,
+			"status", status,
+			"error", err)
+	}
 }
 
 // SlackNotifier sends notifications via Slack webhook
 type SlackNotifier struct {
 	webhookURL string
 	httpClient *http.Client
+	theme      NotificationTheme
+	retry      RetryConfig
+
+	// Template, if set, is a text/template rendered into the message text
+	// in place of the default summary line. See RenderTemplate.
+	Template string
+	// Interactive adds Acknowledge and Resolve buttons to unresolved
+	// alerts. Slack sends clicks to the app's interactivity URL, which
+	// must point at the server's /api/v1/slack/interactions.
+	Interactive bool
 }
 
+// Action IDs of the Slack buttons. Their value is the alert fingerprint.
+const (
+	SlackActionAcknowledge = "oncall_acknowledge"
+	SlackActionResolve     = "oncall_resolve"
+)
+
 func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return NewSlackNotifierWithTheme(webhookURL, DefaultTheme())
+}
+
+// NewSlackNotifierWithTheme creates a Slack notifier that renders alerts
+// with custom colors and icons
+func NewSlackNotifierWithTheme(webhookURL string, theme NotificationTheme) *SlackNotifier {
+	return newSlackNotifier(webhookURL, theme, DefaultRetryConfig())
+}
+
+// NewSlackNotifierWithRetry creates a Slack notifier that retries failed
+// deliveries according to retry
+func NewSlackNotifierWithRetry(webhookURL string, retry RetryConfig) *SlackNotifier {
+	return newSlackNotifier(webhookURL, DefaultTheme(), retry)
+}
+
+func newSlackNotifier(webhookURL string, theme NotificationTheme, retry RetryConfig) *SlackNotifier {
 	return &SlackNotifier{
 		webhookURL: webhookURL,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		theme: theme,
+		retry: retry.withDefaults(),
 	}
 }
 
@@ -69,7 +245,32 @@ func (n *SlackNotifier) Channel() string {
 func (n *SlackNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
 	// Build Slack message with rich formatting
 	message := n.buildSlackMessage(alert)
+	if n.Template != "" {
+		text, err := RenderTemplate(n.Template, alert)
+		if err != nil {
+			return err
+		}
+		message.Text = text
+		if len(message.Blocks) > 0 {
+			message.Blocks[0].Text.Text = text
+		}
+	}
+
+	if err := n.post(ctx, message, recipient); err != nil {
+		return err
+	}
 
+	slog.InfoContext(ctx, "slack notification sent successfully",
+		"alert", alert.Fingerprint,
+		"severity", alert.Severity,
+		"status", alert.Status)
+
+	return nil
+}
+
+// post delivers message to recipient, or to the default webhook URL if
+// recipient is empty
+func (n *SlackNotifier) post(ctx context.Context, message *SlackMessage, recipient string) error {
 	payload, err := json.Marshal(message)
 	if err != nil {
 		return fmt.Errorf("failed to marshal slack message: %w", err)
@@ -81,14 +282,14 @@ func (n *SlackNotifier) Send(ctx context.Context, alert *models.AlertGroup, reci
 		webhookURL = recipient
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewReader(payload))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := n.httpClient.Do(req)
+	resp, err := doWithRetry(ctx, n.httpClient, n.retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to send slack notification: %w", err)
 	}
@@ -97,12 +298,6 @@ func (n *SlackNotifier) Send(ctx context.Context, alert *models.AlertGroup, reci
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("slack webhook returned status %d", resp.StatusCode)
 	}
-
-	slog.Info("slack notification sent successfully",
-		"alert", alert.Fingerprint,
-		"severity", alert.Severity,
-		"status", alert.Status)
-
 	return nil
 }
 
@@ -114,9 +309,23 @@ type SlackMessage struct {
 }
 
 type SlackBlock struct {
-	Type string         `json:"type"`
-	Text *SlackTextObj  `json:"text,omitempty"`
-	Fields []SlackTextObj `json:"fields,omitempty"`
+	Type     string         `json:"type"`
+	BlockID  string         `json:"block_id,omitempty"`
+	Text     *SlackTextObj  `json:"text,omitempty"`
+	Fields   []SlackTextObj `json:"fields,omitempty"`
+	ImageURL string         `json:"image_url,omitempty"`
+	AltText  string         `json:"alt_text,omitempty"`
+	// Elements holds the buttons of an actions block
+	Elements []SlackElement `json:"elements,omitempty"`
+}
+
+// SlackElement is a Block Kit button
+type SlackElement struct {
+	Type     string        `json:"type"`
+	Text     *SlackTextObj `json:"text,omitempty"`
+	ActionID string        `json:"action_id,omitempty"`
+	Value    string        `json:"value,omitempty"`
+	Style    string        `json:"style,omitempty"`
 }
 
 type SlackTextObj struct {
@@ -125,7 +334,7 @@ type SlackTextObj struct {
 }
 
 type SlackAttachment struct {
-	Color  string   `json:"color,omitempty"`
+	Color  string       `json:"color,omitempty"`
 	Fields []SlackField `json:"fields,omitempty"`
 }
 
@@ -136,26 +345,8 @@ type SlackField struct {
 }
 
 func (n *SlackNotifier) buildSlackMessage(alert *models.AlertGroup) *SlackMessage {
-	// Determine color based on severity
-	color := "#808080" // gray for info
-	switch alert.Severity {
-	case "critical":
-		color = "#FF0000" // red
-	case "warning":
-		color = "#FFA500" // orange
-	case "info":
-		color = "#0000FF" // blue
-	}
-
-	// Build status icon
-	statusIcon := "🔥"
-	if alert.Status == "resolved" {
-		statusIcon = "✅"
-		color = "#00FF00" // green
-	} else if alert.Status == "acknowledged" {
-		statusIcon = "👀"
-		color = "#FFFF00" // yellow
-	}
+	color := n.theme.Color(alert)
+	statusIcon := n.theme.Icon(alert)
 
 	// Build main text
 	text := fmt.Sprintf("%s *%s* - %s", statusIcon, alert.Severity, alert.Summary)
@@ -194,7 +385,7 @@ func (n *SlackNotifier) buildSlackMessage(alert *models.AlertGroup) *SlackMessag
 		}
 	}
 
-	return &SlackMessage{
+	message := &SlackMessage{
 		Text: text,
 		Attachments: []SlackAttachment{
 			{
@@ -203,6 +394,58 @@ func (n *SlackNotifier) buildSlackMessage(alert *models.AlertGroup) *SlackMessag
 			},
 		},
 	}
+
+	buttons := n.Interactive && alert.Status != "resolved"
+
+	// Slack shows blocks instead of the top-level text, so repeat it in a
+	// section before the images and buttons
+	if len(alert.Images) > 0 || buttons {
+		message.Blocks = append(message.Blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackTextObj{Type: "mrkdwn", Text: text},
+		})
+	}
+	if len(alert.Images) > 0 {
+		altText := alert.Summary
+		if altText == "" {
+			altText = "Alert screenshot"
+		}
+		for _, image := range alert.Images {
+			message.Blocks = append(message.Blocks, SlackBlock{
+				Type:     "image",
+				ImageURL: image,
+				AltText:  altText,
+			})
+		}
+	}
+	if buttons {
+		message.Blocks = append(message.Blocks, slackActions(alert))
+	}
+
+	return message
+}
+
+// slackActions returns the buttons for alert. An acknowledged alert can
+// only be resolved.
+func slackActions(alert *models.AlertGroup) SlackBlock {
+	block := SlackBlock{Type: "actions", BlockID: "oncall_actions"}
+	if alert.Status != "acknowledged" {
+		block.Elements = append(block.Elements, SlackElement{
+			Type:     "button",
+			Text:     &SlackTextObj{Type: "plain_text", Text: "Acknowledge"},
+			ActionID: SlackActionAcknowledge,
+			Value:    alert.Fingerprint,
+			Style:    "primary",
+		})
+	}
+	block.Elements = append(block.Elements, SlackElement{
+		Type:     "button",
+		Text:     &SlackTextObj{Type: "plain_text", Text: "Resolve"},
+		ActionID: SlackActionResolve,
+		Value:    alert.Fingerprint,
+		Style:    "danger",
+	})
+	return block
 }
 
 // EmailNotifier sends notifications via SMTP
@@ -226,7 +469,7 @@ func (n *EmailNotifier) Channel() string {
 
 func (n *EmailNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
 	// TODO: Implement actual SMTP send with net/smtp
-	slog.Info("email notification sent",
+	slog.InfoContext(ctx, "email notification sent",
 		"recipient", recipient,
 		"from", n.from,
 		"alert", alert.Fingerprint)
@@ -237,9 +480,52 @@ func (n *EmailNotifier) Send(ctx context.Context, alert *models.AlertGroup, reci
 type WebhookNotifier struct {
 	timeout    time.Duration
 	httpClient *http.Client
+	retry      RetryConfig
+
+	// Template, if set, is a text/template rendered into the payload's
+	// "message" field. See RenderTemplate.
+	Template string
+
+	// SigningSecret, if set, signs each request so receivers can check it
+	// came from us: the body's HMAC-SHA256 goes in WebhookSignatureHeader
+	// and the send time in WebhookTimestampHeader
+	SigningSecret string
+
+	// Headers are set on every request, e.g. a tenant ID or static token a
+	// gateway requires. They can't replace Content-Type or the signature
+	// headers.
+	Headers map[string]string
+}
+
+// Headers of signed webhook requests
+const (
+	WebhookSignatureHeader = "X-Grafana-Ops-Signature" // sha256=<hex HMAC of the body>
+	WebhookTimestampHeader = "X-Grafana-Ops-Timestamp" // Unix seconds
+)
+
+// SignWebhookPayload returns the WebhookSignatureHeader value for body
+// signed with secret
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
 }
 
 func NewWebhookNotifier(timeout string) *WebhookNotifier {
+	return NewWebhookNotifierWithRetry(timeout, DefaultRetryConfig())
+}
+
+// NewWebhookNotifierWithHeaders creates a webhook notifier that sets
+// headers on every request
+func NewWebhookNotifierWithHeaders(timeout string, headers map[string]string) *WebhookNotifier {
+	n := NewWebhookNotifier(timeout)
+	n.Headers = headers
+	return n
+}
+
+// NewWebhookNotifierWithRetry creates a webhook notifier that retries
+// failed deliveries according to retry. timeout applies to each attempt.
+func NewWebhookNotifierWithRetry(timeout string, retry RetryConfig) *WebhookNotifier {
 	duration, _ := time.ParseDuration(timeout)
 	if duration == 0 {
 		duration = 10 * time.Second
@@ -250,6 +536,7 @@ func NewWebhookNotifier(timeout string) *WebhookNotifier {
 		httpClient: &http.Client{
 			Timeout: duration,
 		},
+		retry: retry.withDefaults(),
 	}
 }
 
@@ -270,20 +557,38 @@ func (n *WebhookNotifier) Send(ctx context.Context, alert *models.AlertGroup, re
 		"annotations": alert.Annotations,
 		"created_at":  alert.CreatedAt,
 	}
+	if n.Template != "" {
+		message, err := RenderTemplate(n.Template, alert)
+		if err != nil {
+			return err
+		}
+		payload["message"] = message
+	}
 
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal webhook payload: %w", err)
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", recipient, bytes.NewReader(payloadJSON))
-	if err != nil {
-		return fmt.Errorf("failed to create webhook request: %w", err)
+	var signature string
+	if n.SigningSecret != "" {
+		signature = SignWebhookPayload(n.SigningSecret, payloadJSON)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := n.httpClient.Do(req)
+	resp, err := doWithRetry(ctx, n.httpClient, n.retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", recipient, bytes.NewReader(payloadJSON))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create webhook request: %w", err)
+		}
+		for name, value := range n.Headers {
+			req.Header.Set(name, value)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if n.SigningSecret != "" {
+			req.Header.Set(WebhookSignatureHeader, signature)
+			req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+		}
+		return req, nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to send webhook: %w", err)
 	}
@@ -293,8 +598,8 @@ func (n *WebhookNotifier) Send(ctx context.Context, alert *models.AlertGroup, re
 		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
 	}
 
-	slog.Info("webhook notification sent successfully",
-		"url", recipient,
+	slog.InfoContext(ctx, "webhook notification sent successfully",
+		"webhook_url", recipient,
 		"alert", alert.Fingerprint)
 
 	return nil
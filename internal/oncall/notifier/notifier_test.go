@@ -3,13 +3,16 @@ package notifier
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/store"
 )
 
 func TestSlackNotifier_buildSlackMessage(t *testing.T) {
@@ -179,6 +182,71 @@ func TestSlackNotifier_Send(t *testing.T) {
 	}
 }
 
+func TestSlackNotifier_buildSlackMessage_Images(t *testing.T) {
+	notifier := NewSlackNotifier("https://hooks.slack.com/test")
+
+	msg := notifier.buildSlackMessage(&models.AlertGroup{Status: "firing", Severity: "warning", Summary: "High latency"})
+	if len(msg.Blocks) != 0 {
+		t.Errorf("expected no blocks without images, got %+v", msg.Blocks)
+	}
+
+	msg = notifier.buildSlackMessage(&models.AlertGroup{
+		Status:   "firing",
+		Severity: "warning",
+		Summary:  "High latency",
+		Images:   []string{"https://grafana.example.com/render/1.png", "https://grafana.example.com/render/2.png"},
+	})
+	if len(msg.Blocks) != 3 {
+		t.Fatalf("expected a section and 2 image blocks, got %+v", msg.Blocks)
+	}
+	if msg.Blocks[0].Type != "section" || msg.Blocks[0].Text == nil || msg.Blocks[0].Text.Text != msg.Text {
+		t.Errorf("expected the alert text in a leading section, got %+v", msg.Blocks[0])
+	}
+	for i, block := range msg.Blocks[1:] {
+		if block.Type != "image" || block.ImageURL == "" || block.AltText != "High latency" {
+			t.Errorf("block %d: unexpected image block %+v", i+1, block)
+		}
+	}
+}
+
+func TestSlackNotifier_buildSlackMessage_Interactive(t *testing.T) {
+	notifier := NewSlackNotifier("https://hooks.slack.com/test")
+	notifier.Interactive = true
+
+	actions := func(msg *SlackMessage) []SlackElement {
+		for _, block := range msg.Blocks {
+			if block.Type == "actions" {
+				return block.Elements
+			}
+		}
+		return nil
+	}
+
+	msg := notifier.buildSlackMessage(&models.AlertGroup{Fingerprint: "abc123", Status: "firing", Summary: "High latency"})
+	if len(msg.Blocks) != 2 || msg.Blocks[0].Type != "section" {
+		t.Fatalf("expected a section and an actions block, got %+v", msg.Blocks)
+	}
+	buttons := actions(msg)
+	if len(buttons) != 2 {
+		t.Fatalf("expected 2 buttons, got %+v", buttons)
+	}
+	for i, want := range []string{SlackActionAcknowledge, SlackActionResolve} {
+		if buttons[i].ActionID != want || buttons[i].Value != "abc123" {
+			t.Errorf("button %d: expected %s carrying the fingerprint, got %+v", i, want, buttons[i])
+		}
+	}
+
+	msg = notifier.buildSlackMessage(&models.AlertGroup{Fingerprint: "abc123", Status: "acknowledged"})
+	if buttons := actions(msg); len(buttons) != 1 || buttons[0].ActionID != SlackActionResolve {
+		t.Errorf("expected only a resolve button once acknowledged, got %+v", buttons)
+	}
+
+	msg = notifier.buildSlackMessage(&models.AlertGroup{Fingerprint: "abc123", Status: "resolved"})
+	if len(msg.Blocks) != 0 {
+		t.Errorf("expected no buttons on a resolved alert, got %+v", msg.Blocks)
+	}
+}
+
 func TestSlackNotifier_Send_Failure(t *testing.T) {
 	// Create a test server that returns error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -186,7 +254,7 @@ func TestSlackNotifier_Send_Failure(t *testing.T) {
 	}))
 	defer server.Close()
 
-	notifier := NewSlackNotifier(server.URL)
+	notifier := NewSlackNotifierWithRetry(server.URL, RetryConfig{BaseDelay: time.Millisecond})
 
 	alert := &models.AlertGroup{
 		Fingerprint: "test123",
@@ -247,6 +315,81 @@ func TestWebhookNotifier_Send(t *testing.T) {
 	}
 }
 
+func TestSignWebhookPayload(t *testing.T) {
+	got := SignWebhookPayload("key", []byte("The quick brown fox jumps over the lazy dog"))
+	want := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestWebhookNotifier_Signing(t *testing.T) {
+	type request struct {
+		body      []byte
+		signature string
+		timestamp string
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{
+			body:      body,
+			signature: r.Header.Get(WebhookSignatureHeader),
+			timestamp: r.Header.Get(WebhookTimestampHeader),
+		}
+	}))
+	defer server.Close()
+
+	alert := &models.AlertGroup{ID: 1, Fingerprint: "signed", Status: "firing"}
+
+	notifier := NewWebhookNotifier("10s")
+	notifier.SigningSecret = "s3cret"
+	if err := notifier.Send(context.Background(), alert, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	req := <-received
+	if want := SignWebhookPayload("s3cret", req.body); req.signature != want {
+		t.Errorf("expected signature %s for the body, got %q", want, req.signature)
+	}
+	if ts, err := strconv.ParseInt(req.timestamp, 10, 64); err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("expected a current Unix timestamp, got %q", req.timestamp)
+	}
+
+	// Without a secret requests go out unsigned
+	notifier.SigningSecret = ""
+	if err := notifier.Send(context.Background(), alert, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-received; req.signature != "" || req.timestamp != "" {
+		t.Errorf("expected no signature headers, got %q and %q", req.signature, req.timestamp)
+	}
+}
+
+func TestWebhookNotifier_Headers(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifierWithHeaders("10s", map[string]string{
+		"X-Tenant-ID":   "payments",
+		"Authorization": "Token abc123",
+		"Content-Type":  "text/plain",
+	})
+	if err := notifier.Send(context.Background(), &models.AlertGroup{Fingerprint: "headers"}, server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	header := <-received
+	if header.Get("X-Tenant-ID") != "payments" || header.Get("Authorization") != "Token abc123" {
+		t.Errorf("expected the custom headers, got %v", header)
+	}
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("expected Content-Type kept as application/json, got %q", got)
+	}
+}
+
 func TestManager_Register_and_Send(t *testing.T) {
 	manager := NewManager()
 
@@ -292,3 +435,56 @@ func (m *mockNotifier) Channel() string {
 func (m *mockNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
 	return m.sendFn(ctx, alert, recipient)
 }
+
+func TestManager_RecordsNotifications(t *testing.T) {
+	st, err := store.New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	manager := NewManager()
+	manager.SetRecorder(st)
+	manager.Register(&mockNotifier{channel: "slack", sendFn: func(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+		return nil
+	}})
+	manager.Register(&mockNotifier{channel: "webhook", sendFn: func(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+		return errors.New("webhook returned status 503")
+	}})
+
+	ctx := context.Background()
+	alert := &models.AlertGroup{ID: 3, Fingerprint: "abc"}
+	if err := manager.Send(ctx, "slack", alert, "#ops"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := manager.Send(ctx, "webhook", alert, "https://hooks.example.com"); err == nil {
+		t.Fatal("expected the webhook failure to be returned")
+	}
+	// Alerts that were never stored have nothing to attach history to
+	if err := manager.Send(ctx, "slack", &models.AlertGroup{Fingerprint: "unstored"}, "#ops"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	history, err := st.ListNotificationsByAlert(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(history))
+	}
+	if got := history[0]; got.Channel != "slack" || got.Recipient != "#ops" || got.Status != models.NotificationSent || got.SentAt == nil {
+		t.Errorf("unexpected slack notification %+v", got)
+	}
+	if got := history[1]; got.Channel != "webhook" || got.Status != models.NotificationFailed ||
+		got.Error == nil || *got.Error != "webhook returned status 503" {
+		t.Errorf("unexpected webhook notification %+v", got)
+	}
+
+	var total int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM notifications`).Scan(&total); err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("expected 2 notifications stored in total, got %d", total)
+	}
+}
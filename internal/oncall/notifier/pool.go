@@ -0,0 +1,235 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// DefaultPoolWorkers is used when a pool is created with a non-positive
+// worker count
+const DefaultPoolWorkers = 8
+
+// ErrPoolClosed is returned for sends submitted after the pool stopped
+var ErrPoolClosed = errors.New("notification pool is closed")
+
+// Sender dispatches a notification on a named channel. Manager implements
+// it.
+type Sender interface {
+	Send(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error
+}
+
+// GroupSender dispatches several alerts to one recipient together.
+// Manager implements it with SendGroup.
+type GroupSender interface {
+	SendGroup(ctx context.Context, channel string, alerts []*models.AlertGroup, recipient string) error
+}
+
+// Pool caps the number of concurrent notification sends. Sends beyond
+// capacity wait in a per-channel queue, and idle workers take from the
+// channels in round-robin order so one noisy channel can't starve the rest.
+// If the sender is a GroupSender, a worker takes every send queued for the
+// same channel and recipient at once and delivers them as one group, so a
+// backlog built up during an alert storm drains as a few messages.
+type Pool struct {
+	sender  Sender
+	workers int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  map[string][]*sendJob
+	pending []string // channels with queued jobs, in service order
+	sending int      // jobs taken by a worker and not yet finished
+	closed  bool
+}
+
+type sendJob struct {
+	ctx       context.Context
+	channel   string
+	alert     *models.AlertGroup
+	recipient string
+	done      chan error
+}
+
+func NewPool(sender Sender, workers int) *Pool {
+	if workers <= 0 {
+		workers = DefaultPoolWorkers
+	}
+	p := &Pool{
+		sender:  sender,
+		workers: workers,
+		queues:  make(map[string][]*sendJob),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Run starts the workers and blocks until ctx is cancelled. Queued sends
+// that haven't started by then fail with ErrPoolClosed.
+func (p *Pool) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work()
+		}()
+	}
+
+	<-ctx.Done()
+
+	p.mu.Lock()
+	p.closed = true
+	for _, queue := range p.queues {
+		for _, job := range queue {
+			job.done <- ErrPoolClosed
+		}
+	}
+	p.queues = make(map[string][]*sendJob)
+	p.pending = nil
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	wg.Wait()
+	return nil
+}
+
+// Send queues a notification and waits for a worker to deliver it
+func (p *Pool) Send(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error {
+	job := &sendJob{
+		ctx:       ctx,
+		channel:   channel,
+		alert:     alert,
+		recipient: recipient,
+		done:      make(chan error, 1),
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	if len(p.queues[channel]) == 0 {
+		p.pending = append(p.pending, channel)
+	}
+	p.queues[channel] = append(p.queues[channel], job)
+	p.cond.Signal()
+	p.mu.Unlock()
+
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		// A worker that picks the job up later sees the cancelled context
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work() {
+	for {
+		jobs, ok := p.next()
+		if !ok {
+			return
+		}
+
+		var live []*sendJob
+		for _, job := range jobs {
+			if err := job.ctx.Err(); err != nil {
+				job.done <- err
+			} else {
+				live = append(live, job)
+			}
+		}
+		p.deliver(live)
+
+		p.mu.Lock()
+		p.sending -= len(jobs)
+		p.mu.Unlock()
+	}
+}
+
+// deliver sends jobs, which share a channel and recipient, as one group
+// when there are several, and reports the outcome to each
+func (p *Pool) deliver(jobs []*sendJob) {
+	if len(jobs) == 0 {
+		return
+	}
+	first := jobs[0]
+	if len(jobs) == 1 {
+		first.done <- p.sender.Send(first.ctx, first.channel, first.alert, first.recipient)
+		return
+	}
+
+	alerts := make([]*models.AlertGroup, len(jobs))
+	for i, job := range jobs {
+		alerts[i] = job.alert
+	}
+	err := p.sender.(GroupSender).SendGroup(first.ctx, first.channel, alerts, first.recipient)
+	for _, job := range jobs {
+		job.done <- err
+	}
+}
+
+// QueueDepths returns the number of sends waiting for a worker, per
+// channel
+func (p *Pool) QueueDepths() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	depths := make(map[string]int, len(p.queues))
+	for channel, queue := range p.queues {
+		depths[channel] = len(queue)
+	}
+	return depths
+}
+
+// Backlog returns the number of sends queued or in progress
+func (p *Pool) Backlog() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	backlog := p.sending
+	for _, queue := range p.queues {
+		backlog += len(queue)
+	}
+	return backlog
+}
+
+// next blocks until a job is queued and pops it from the channel at the
+// head of the rotation, moving that channel to the back if it has more.
+// With a GroupSender the jobs queued behind it for the same recipient are
+// popped along with it.
+func (p *Pool) next() ([]*sendJob, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.pending) == 0 && !p.closed {
+		p.cond.Wait()
+	}
+	if p.closed {
+		return nil, false
+	}
+
+	channel := p.pending[0]
+	p.pending = p.pending[1:]
+
+	queue := p.queues[channel]
+	jobs := []*sendJob{queue[0]}
+	var rest []*sendJob
+	_, grouping := p.sender.(GroupSender)
+	for _, job := range queue[1:] {
+		if grouping && job.recipient == jobs[0].recipient {
+			jobs = append(jobs, job)
+		} else {
+			rest = append(rest, job)
+		}
+	}
+	if len(rest) == 0 {
+		delete(p.queues, channel)
+	} else {
+		p.queues[channel] = rest
+		p.pending = append(p.pending, channel)
+	}
+	p.sending += len(jobs)
+	return jobs, true
+}
@@ -0,0 +1,266 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+type recordingSender struct {
+	mu      sync.Mutex
+	active  int
+	peak    int
+	sent    []string
+	release chan struct{}
+}
+
+func (s *recordingSender) Send(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error {
+	s.mu.Lock()
+	s.active++
+	if s.active > s.peak {
+		s.peak = s.active
+	}
+	s.sent = append(s.sent, channel+":"+recipient)
+	s.mu.Unlock()
+
+	if s.release != nil {
+		<-s.release
+	} else {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	return nil
+}
+
+func (p *Pool) queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, queue := range p.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPool_BoundsConcurrency(t *testing.T) {
+	sender := &recordingSender{}
+	pool := NewPool(sender, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.Run(ctx)
+
+	var wg sync.WaitGroup
+	channels := []string{"slack", "email", "webhook"}
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := pool.Send(ctx, channels[i%len(channels)], &models.AlertGroup{ID: int64(i)}, "oncall"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if len(sender.sent) != 60 {
+		t.Errorf("expected 60 sends, got %d", len(sender.sent))
+	}
+	if sender.peak > 3 {
+		t.Errorf("expected at most 3 concurrent sends, saw %d", sender.peak)
+	}
+}
+
+func TestPool_RoundRobinAcrossChannels(t *testing.T) {
+	sender := &recordingSender{release: make(chan struct{})}
+	pool := NewPool(sender, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.Run(ctx)
+
+	var wg sync.WaitGroup
+	send := func(channel, recipient string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.Send(ctx, channel, &models.AlertGroup{}, recipient)
+		}()
+	}
+
+	// Occupy the only worker, then queue a burst on slack ahead of email
+	send("slack", "first")
+	waitFor(t, func() bool {
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+		return sender.active == 1
+	})
+
+	for i, recipient := range []string{"a", "b", "c"} {
+		send("slack", recipient)
+		waitFor(t, func() bool { return pool.queued() == i+1 })
+	}
+	send("email", "d")
+	waitFor(t, func() bool { return pool.queued() == 4 })
+
+	for i := 0; i < 5; i++ {
+		sender.release <- struct{}{}
+	}
+	wg.Wait()
+
+	expected := []string{"slack:first", "slack:a", "email:d", "slack:b", "slack:c"}
+	if !reflect.DeepEqual(sender.sent, expected) {
+		t.Errorf("expected order %v, got %v", expected, sender.sent)
+	}
+}
+
+func TestPool_ClosedRejectsQueued(t *testing.T) {
+	sender := &recordingSender{release: make(chan struct{})}
+	pool := NewPool(sender, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(stopped)
+	}()
+
+	errs := make(chan error, 2)
+	go func() { errs <- pool.Send(context.Background(), "slack", &models.AlertGroup{}, "a") }()
+	waitFor(t, func() bool {
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+		return sender.active == 1
+	})
+	go func() { errs <- pool.Send(context.Background(), "slack", &models.AlertGroup{}, "b") }()
+	waitFor(t, func() bool { return pool.queued() == 1 })
+
+	cancel()
+	if err := <-errs; err != ErrPoolClosed {
+		t.Errorf("expected queued send to fail with ErrPoolClosed, got %v", err)
+	}
+
+	close(sender.release)
+	if err := <-errs; err != nil {
+		t.Errorf("expected in-flight send to complete, got %v", err)
+	}
+	<-stopped
+
+	if err := pool.Send(context.Background(), "slack", &models.AlertGroup{}, "c"); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed after shutdown, got %v", err)
+	}
+}
+
+func TestPool_QueueDepthsAndBacklog(t *testing.T) {
+	sender := &recordingSender{release: make(chan struct{})}
+	pool := NewPool(sender, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.Run(ctx)
+
+	var wg sync.WaitGroup
+	for _, channel := range []string{"slack", "slack", "slack", "email"} {
+		wg.Add(1)
+		go func(channel string) {
+			defer wg.Done()
+			pool.Send(ctx, channel, &models.AlertGroup{}, "oncall")
+		}(channel)
+	}
+	// One send is held by the only worker, the rest wait in the queues
+	waitFor(t, func() bool { return pool.queued() == 3 })
+
+	depths := pool.QueueDepths()
+	if depths["slack"]+depths["email"] != 3 || depths["email"] > 1 {
+		t.Errorf("unexpected queue depths %v", depths)
+	}
+	if got := pool.Backlog(); got != 4 {
+		t.Errorf("expected backlog of 4, got %d", got)
+	}
+
+	close(sender.release)
+	wg.Wait()
+	waitFor(t, func() bool { return pool.Backlog() == 0 })
+	if depths := pool.QueueDepths(); len(depths) != 0 {
+		t.Errorf("expected empty queues, got %v", depths)
+	}
+}
+
+// groupingSender records grouped sends alongside single ones
+type groupingSender struct {
+	recordingSender
+	groups []string
+}
+
+func (s *groupingSender) SendGroup(ctx context.Context, channel string, alerts []*models.AlertGroup, recipient string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = append(s.groups, fmt.Sprintf("%s:%s x%d", channel, recipient, len(alerts)))
+	return nil
+}
+
+func TestPool_GroupsQueuedSendsPerRecipient(t *testing.T) {
+	sender := &groupingSender{recordingSender: recordingSender{release: make(chan struct{})}}
+	pool := NewPool(sender, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pool.Run(ctx)
+
+	var wg sync.WaitGroup
+	send := func(channel, recipient string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pool.Send(ctx, channel, &models.AlertGroup{}, recipient); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+
+	// Occupy the only worker, then build a backlog
+	send("slack", "ops")
+	waitFor(t, func() bool {
+		sender.mu.Lock()
+		defer sender.mu.Unlock()
+		return sender.active == 1
+	})
+	for i, target := range [][2]string{{"slack", "ops"}, {"slack", "dev"}, {"slack", "ops"}, {"slack", "ops"}, {"email", "ops"}} {
+		send(target[0], target[1])
+		waitFor(t, func() bool { return pool.queued() == i+1 })
+	}
+
+	// The first send, then slack:dev and email:ops, go singly
+	for i := 0; i < 3; i++ {
+		sender.release <- struct{}{}
+	}
+	wg.Wait()
+
+	if expected := []string{"slack:ops x3"}; !reflect.DeepEqual(sender.groups, expected) {
+		t.Errorf("expected groups %v, got %v", expected, sender.groups)
+	}
+	if expected := []string{"slack:ops", "email:ops", "slack:dev"}; !reflect.DeepEqual(sender.sent, expected) {
+		t.Errorf("expected single sends %v, got %v", expected, sender.sent)
+	}
+}
@@ -0,0 +1,147 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+
+	// maxRetryDelay caps both the backoff and any Retry-After the
+	// receiver asks for
+	maxRetryDelay = 30 * time.Second
+)
+
+// RetryConfig controls how HTTP notifiers retry failed deliveries.
+// Connection errors, 429 and 5xx responses are retried with exponential
+// backoff starting at BaseDelay. Zero fields take the defaults.
+type RetryConfig struct {
+	// MaxAttempts is the total number of tries, including the first.
+	// Set it to 1 to disable retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+}
+
+// DefaultRetryConfig returns 3 attempts with a 500ms base delay
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxAttempts: defaultRetryAttempts,
+		BaseDelay:   defaultRetryBaseDelay,
+	}
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultRetryAttempts
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = defaultRetryBaseDelay
+	}
+	return c
+}
+
+// backoff returns the delay before the attempt following attempt
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	delay := c.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// doWithRetry sends the request built by newRequest until it gets a
+// response that isn't worth retrying or attempts run out. newRequest is
+// called for every attempt so the body can be re-read. The final response
+// is returned for the caller to check; the caller closes its body.
+func doWithRetry(ctx context.Context, client *http.Client, cfg RetryConfig, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	cfg = cfg.withDefaults()
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if attempt >= cfg.MaxAttempts {
+			return resp, err
+		}
+
+		delay := cfg.backoff(attempt)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("status %d", resp.StatusCode)
+			if after, ok := retryAfter(resp); ok {
+				delay = after
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		slog.WarnContext(ctx, "notification delivery failed, retrying",
+			"url", req.URL.Redacted(),
+			"attempt", attempt,
+			"max_attempts", cfg.MaxAttempts,
+			"delay", delay,
+			"reason", reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryAfter parses the Retry-After header of a 429 or 503 response, given
+// either in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = time.Until(at)
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay, true
+}
@@ -0,0 +1,171 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// flakyServer fails the first failures requests with the given statuses,
+// in order, and accepts the rest
+func flakyServer(t *testing.T, failures ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(failures) {
+			if failures[n-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(failures[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func fastRetry() RetryConfig {
+	return RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond}
+}
+
+func TestNotifiers_RetryTransientFailures(t *testing.T) {
+	alert := &models.AlertGroup{Fingerprint: "abc", Status: "firing", Severity: "critical", Summary: "Flaky"}
+
+	slackServer, slackRequests := flakyServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	slack := NewSlackNotifierWithRetry(slackServer.URL, fastRetry())
+	if err := slack.Send(context.Background(), alert, ""); err != nil {
+		t.Errorf("slack: expected success on the third attempt, got %v", err)
+	}
+	if n := slackRequests.Load(); n != 3 {
+		t.Errorf("slack: expected 3 requests, got %d", n)
+	}
+
+	hookServer, hookRequests := flakyServer(t, http.StatusBadGateway, http.StatusInternalServerError)
+	webhook := NewWebhookNotifierWithRetry("", fastRetry())
+	if err := webhook.Send(context.Background(), alert, hookServer.URL); err != nil {
+		t.Errorf("webhook: expected success on the third attempt, got %v", err)
+	}
+	if n := hookRequests.Load(); n != 3 {
+		t.Errorf("webhook: expected 3 requests, got %d", n)
+	}
+}
+
+func TestNotifiers_RetryGivesUp(t *testing.T) {
+	alert := &models.AlertGroup{Fingerprint: "abc"}
+
+	server, requests := flakyServer(t, 500, 500, 500, 500)
+	webhook := NewWebhookNotifierWithRetry("", fastRetry())
+	if err := webhook.Send(context.Background(), alert, server.URL); err == nil {
+		t.Error("expected an error once attempts run out")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+
+	// Client errors other than 429 are not retried
+	server, requests = flakyServer(t, http.StatusBadRequest)
+	if err := webhook.Send(context.Background(), alert, server.URL); err == nil {
+		t.Error("expected an error for a 400")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected a single attempt for a 400, got %d", n)
+	}
+}
+
+func TestNotifiers_RetryConnectionErrors(t *testing.T) {
+	// Grab a free port and close it so connections are refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	var attempts int
+	client := &http.Client{Timeout: time.Second}
+	_, err = doWithRetry(context.Background(), client, fastRetry(), func() (*http.Request, error) {
+		attempts++
+		return http.NewRequest("POST", "http://"+addr, nil)
+	})
+	if err == nil {
+		t.Fatal("expected a connection error")
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestNotifiers_RetryRespectsContext(t *testing.T) {
+	server, _ := flakyServer(t, 500, 500, 500)
+	slack := NewSlackNotifierWithRetry(server.URL, RetryConfig{MaxAttempts: 3, BaseDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := slack.Send(ctx, &models.AlertGroup{Fingerprint: "abc"}, "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop retries, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected send to return promptly, took %v", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		status int
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{http.StatusTooManyRequests, "2", 2 * time.Second, true},
+		{http.StatusServiceUnavailable, "0", 0, true},
+		{http.StatusTooManyRequests, "3600", maxRetryDelay, true},
+		{http.StatusTooManyRequests, "", 0, false},
+		{http.StatusTooManyRequests, "soon", 0, false},
+		{http.StatusInternalServerError, "2", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		got, ok := retryAfter(resp)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%d %q: expected (%v, %v), got (%v, %v)", tt.status, tt.header, tt.want, tt.ok, got, ok)
+		}
+	}
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", time.Now().Add(10*time.Second).UTC().Format(http.TimeFormat))
+	if got, ok := retryAfter(resp); !ok || got <= 8*time.Second || got > 10*time.Second {
+		t.Errorf("expected about 10s from an HTTP date, got %v", got)
+	}
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	cfg := RetryConfig{}.withDefaults()
+	if cfg != DefaultRetryConfig() {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+	for attempt, want := range map[int]time.Duration{
+		1:  500 * time.Millisecond,
+		2:  time.Second,
+		3:  2 * time.Second,
+		20: maxRetryDelay,
+	} {
+		if got := cfg.backoff(attempt); got != want {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, want, got)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// Target is one destination for a routed notification
+type Target struct {
+	Channel   string
+	Recipient string
+}
+
+// ParseTarget parses a "channel:recipient" target such as
+// "email:payments-oncall@example.com" or "webhook:https://example.com/hook".
+// The recipient may be empty for channels that don't need one.
+func ParseTarget(s string) (Target, error) {
+	channel, recipient, ok := strings.Cut(s, ":")
+	if !ok || channel == "" {
+		return Target{}, fmt.Errorf("invalid target %q: expected channel:recipient", s)
+	}
+	return Target{Channel: channel, Recipient: recipient}, nil
+}
+
+func (t Target) String() string {
+	return t.Channel + ":" + t.Recipient
+}
+
+// Route sends alerts whose labels include every Matchers pair to Targets.
+// A route without matchers is a default route: it matches every alert, but
+// only applies when no route with matchers does.
+type Route struct {
+	Matchers map[string]string
+	Targets  []Target
+}
+
+func (r Route) matches(alert *models.AlertGroup) bool {
+	for name, value := range r.Matchers {
+		if alert.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// RoutingTree resolves where an alert is sent from its labels. Of the
+// routes that match, only the most specific apply, those with the most
+// matchers, so team=payments,severity=critical wins over team=payments.
+// Matching routes that tie all apply.
+type RoutingTree struct {
+	routes []Route
+}
+
+func NewRoutingTree(routes []Route) *RoutingTree {
+	return &RoutingTree{routes: routes}
+}
+
+// Resolve returns the targets for alert in route order, without duplicates.
+// It returns nil if no route matches.
+func (t *RoutingTree) Resolve(alert *models.AlertGroup) []Target {
+	best := -1
+	var matched []Route
+	for _, route := range t.routes {
+		if !route.matches(alert) {
+			continue
+		}
+		switch n := len(route.Matchers); {
+		case n > best:
+			best, matched = n, []Route{route}
+		case n == best:
+			matched = append(matched, route)
+		}
+	}
+
+	var targets []Target
+	seen := make(map[Target]bool)
+	for _, route := range matched {
+		for _, target := range route.Targets {
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// Notify sends alert to each of its targets through sender concurrently
+// and returns the failures joined
+func (t *RoutingTree) Notify(ctx context.Context, sender Sender, alert *models.AlertGroup) error {
+	targets := t.Resolve(alert)
+	errs := make([]error, len(targets))
+
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			if err := sender.Send(ctx, target.Channel, alert, target.Recipient); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", target.Channel, err)
+			}
+		}(i, target)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,142 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// failingSender fails sends on one channel and passes the rest to Sender
+type failingSender struct {
+	Sender
+	channel string
+}
+
+func (s failingSender) Send(ctx context.Context, channel string, alert *models.AlertGroup, recipient string) error {
+	err := s.Sender.Send(ctx, channel, alert, recipient)
+	if channel == s.channel {
+		return errors.New("send failed")
+	}
+	return err
+}
+
+func testRoutingTree() *RoutingTree {
+	return NewRoutingTree([]Route{
+		{Targets: []Target{{Channel: "webhook", Recipient: "https://default.example.com"}}},
+		{
+			Matchers: map[string]string{"team": "payments"},
+			Targets:  []Target{{Channel: "email", Recipient: "payments@example.com"}},
+		},
+		{
+			Matchers: map[string]string{"team": "payments", "severity": "critical"},
+			Targets: []Target{
+				{Channel: "slack", Recipient: "https://hooks.slack.com/payments"},
+				{Channel: "email", Recipient: "payments-oncall@example.com"},
+			},
+		},
+		{
+			Matchers: map[string]string{"severity": "critical", "env": "prod"},
+			Targets: []Target{
+				{Channel: "slack", Recipient: "https://hooks.slack.com/payments"},
+				{Channel: "webhook", Recipient: "https://pager.example.com"},
+			},
+		},
+	})
+}
+
+func TestRoutingTree_Resolve(t *testing.T) {
+	tree := testRoutingTree()
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   []string
+	}{
+		{
+			name:   "default route",
+			labels: map[string]string{"team": "search"},
+			want:   []string{"webhook:https://default.example.com"},
+		},
+		{
+			name:   "team route",
+			labels: map[string]string{"team": "payments", "severity": "warning"},
+			want:   []string{"email:payments@example.com"},
+		},
+		{
+			name:   "most specific route wins",
+			labels: map[string]string{"team": "payments", "severity": "critical"},
+			want:   []string{"slack:https://hooks.slack.com/payments", "email:payments-oncall@example.com"},
+		},
+		{
+			name:   "tied routes fan out without duplicates",
+			labels: map[string]string{"team": "payments", "severity": "critical", "env": "prod"},
+			want: []string{
+				"slack:https://hooks.slack.com/payments",
+				"email:payments-oncall@example.com",
+				"webhook:https://pager.example.com",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, target := range tree.Resolve(&models.AlertGroup{Labels: tt.labels}) {
+				got = append(got, target.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRoutingTree_ResolveWithoutDefault(t *testing.T) {
+	tree := NewRoutingTree([]Route{{
+		Matchers: map[string]string{"team": "payments"},
+		Targets:  []Target{{Channel: "email", Recipient: "payments@example.com"}},
+	}})
+	if targets := tree.Resolve(&models.AlertGroup{Labels: map[string]string{"team": "search"}}); targets != nil {
+		t.Errorf("expected no targets, got %v", targets)
+	}
+}
+
+func TestRoutingTree_Notify(t *testing.T) {
+	tree := testRoutingTree()
+	sender := &recordingSender{}
+
+	alert := &models.AlertGroup{Labels: map[string]string{"team": "payments", "severity": "critical", "env": "prod"}}
+	err := tree.Notify(context.Background(), failingSender{Sender: sender, channel: "webhook"}, alert)
+	if err == nil {
+		t.Error("expected the failed webhook send to be reported")
+	}
+
+	sort.Strings(sender.sent)
+	want := []string{
+		"email:payments-oncall@example.com",
+		"slack:https://hooks.slack.com/payments",
+		"webhook:https://pager.example.com",
+	}
+	if !reflect.DeepEqual(sender.sent, want) {
+		t.Errorf("expected sends to %v, got %v", want, sender.sent)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	target, err := ParseTarget("webhook:https://example.com/hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != (Target{Channel: "webhook", Recipient: "https://example.com/hook"}) {
+		t.Errorf("unexpected target %+v", target)
+	}
+	for _, bad := range []string{"", "webhook", ":https://example.com"} {
+		if _, err := ParseTarget(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// DefaultTelegramAPIURL is the Bot API the Telegram notifier calls
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// TelegramNotifier sends notifications through a Telegram bot. The
+// recipient is the chat ID, e.g. -1001234567890 for a group or @channel
+// for a public channel the bot can post in.
+type TelegramNotifier struct {
+	botToken   string
+	apiURL     string
+	httpClient *http.Client
+	retry      RetryConfig
+}
+
+// NewTelegramNotifier creates a notifier that posts as the bot with
+// botToken
+func NewTelegramNotifier(botToken string) *TelegramNotifier {
+	return &TelegramNotifier{
+		botToken: botToken,
+		apiURL:   DefaultTelegramAPIURL,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		retry: DefaultRetryConfig().withDefaults(),
+	}
+}
+
+func (n *TelegramNotifier) Channel() string {
+	return "telegram"
+}
+
+// telegramResponse is the envelope of every Bot API response
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+func (n *TelegramNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	if recipient == "" {
+		return errors.New("telegram recipient must be a chat ID")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"chat_id":                  recipient,
+		"text":                     formatTelegramMessage(alert),
+		"parse_mode":               "MarkdownV2",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram message: %w", err)
+	}
+
+	endpoint := n.apiURL + "/bot" + n.botToken + "/sendMessage"
+	resp, err := doWithRetry(ctx, n.httpClient, n.retry, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		// The token is part of the URL, which url.Error includes
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = strings.ReplaceAll(urlErr.URL, n.botToken, "<token>")
+		}
+		return fmt.Errorf("failed to send telegram message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Failures come back as ok: false with a description, whatever the
+	// status code
+	var result telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram API returned status %d", resp.StatusCode)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram API error %d: %s", result.ErrorCode, result.Description)
+	}
+
+	slog.InfoContext(ctx, "telegram notification sent successfully",
+		"alert", alert.Fingerprint,
+		"chat", recipient)
+
+	return nil
+}
+
+// telegramSeverityEmoji marks unresolved alerts by severity
+var telegramSeverityEmoji = map[string]string{
+	"critical": "🔴",
+	"warning":  "🟠",
+	"info":     "🔵",
+}
+
+// telegramKeyLabels are the labels shown in messages, as in Slack
+var telegramKeyLabels = map[string]bool{"alertname": true, "instance": true, "job": true}
+
+// formatTelegramMessage renders alert as MarkdownV2
+func formatTelegramMessage(alert *models.AlertGroup) string {
+	emoji, ok := telegramSeverityEmoji[alert.Severity]
+	if !ok {
+		emoji = DefaultTheme().DefaultIcon
+	}
+	if icon, ok := DefaultTheme().StatusIcons[alert.Status]; ok {
+		emoji = icon
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s *%s* %s\n", emoji,
+		EscapeMarkdownV2(strings.ToUpper(alert.Severity)), EscapeMarkdownV2(alert.Summary))
+	fmt.Fprintf(&b, "Status: %s\n", EscapeMarkdownV2(alert.Status))
+	if alert.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", EscapeMarkdownV2(alert.Description))
+	}
+
+	var names []string
+	for name := range alert.Labels {
+		if telegramKeyLabels[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		b.WriteString("\n")
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "*%s:* `%s`\n", EscapeMarkdownV2(name), escapeMarkdownV2Code(alert.Labels[name]))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// markdownV2Special are the characters Telegram's MarkdownV2 requires to
+// be escaped in ordinary text
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// EscapeMarkdownV2 escapes s for use as plain text in a MarkdownV2
+// message
+func EscapeMarkdownV2(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(markdownV2Special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// escapeMarkdownV2Code escapes s for use inside a MarkdownV2 code span,
+// where only ` and \ are special
+func escapeMarkdownV2Code(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(s)
+}
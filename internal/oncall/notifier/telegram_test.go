@@ -0,0 +1,120 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	tests := map[string]string{
+		"plain text":               "plain text",
+		"disk_usage > 90%":         `disk\_usage \> 90%`,
+		"[prod] api-1.example.com": `\[prod\] api\-1\.example\.com`,
+		"a*b~c`d|e{f}g#h+i=j!":     "a\\*b\\~c\\`d\\|e\\{f\\}g\\#h\\+i\\=j\\!",
+		`C:\tmp (copy)`:            `C:\\tmp \(copy\)`,
+		"héllo 🔥":                  "héllo 🔥",
+	}
+	for in, want := range tests {
+		if got := EscapeMarkdownV2(in); got != want {
+			t.Errorf("EscapeMarkdownV2(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := escapeMarkdownV2Code("a`b\\c_d.e"); got != "a\\`b\\\\c_d.e" {
+		t.Errorf("expected only ` and \\ escaped in code, got %q", got)
+	}
+}
+
+func TestFormatTelegramMessage(t *testing.T) {
+	text := formatTelegramMessage(&models.AlertGroup{
+		Status:      "firing",
+		Severity:    "critical",
+		Summary:     "Disk full on db-1.prod",
+		Description: "Usage is 99.5%!",
+		Labels: map[string]string{
+			"alertname": "Disk_Full",
+			"instance":  "db-1:9100",
+			"team":      "storage",
+		},
+	})
+
+	want := "🔴 *CRITICAL* Disk full on db\\-1\\.prod\n" +
+		"Status: firing\n" +
+		"\n" +
+		"Usage is 99\\.5%\\!\n" +
+		"\n" +
+		"*alertname:* `Disk_Full`\n" +
+		"*instance:* `db-1:9100`"
+	if text != want {
+		t.Errorf("unexpected message:\n%s\nwant:\n%s", text, want)
+	}
+
+	resolved := formatTelegramMessage(&models.AlertGroup{Status: "resolved", Severity: "critical", Summary: "x"})
+	if !strings.HasPrefix(resolved, "✅") {
+		t.Errorf("expected resolved alerts marked as such, got %q", resolved)
+	}
+}
+
+func TestTelegramNotifier_Send(t *testing.T) {
+	var path string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"ok": true, "result": {"message_id": 1}}`))
+	}))
+	defer server.Close()
+
+	n := NewTelegramNotifier("123:secret")
+	n.apiURL = server.URL
+	if n.Channel() != "telegram" {
+		t.Errorf("expected channel telegram, got %s", n.Channel())
+	}
+
+	alert := &models.AlertGroup{Fingerprint: "fp", Status: "firing", Severity: "warning", Summary: "Latency high"}
+	if err := n.Send(context.Background(), alert, "-100123"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "/bot123:secret/sendMessage" {
+		t.Errorf("unexpected request path %s", path)
+	}
+	if body["chat_id"] != "-100123" || body["parse_mode"] != "MarkdownV2" {
+		t.Errorf("unexpected request body %+v", body)
+	}
+	if text, _ := body["text"].(string); !strings.HasPrefix(text, "🟠 *WARNING* Latency high") {
+		t.Errorf("unexpected text %q", text)
+	}
+
+	if err := n.Send(context.Background(), alert, ""); err == nil {
+		t.Error("expected an error without a chat ID")
+	}
+}
+
+func TestTelegramNotifier_Send_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`))
+	}))
+	defer server.Close()
+
+	n := NewTelegramNotifier("123:secret")
+	n.apiURL = server.URL
+	n.retry = RetryConfig{BaseDelay: time.Millisecond}.withDefaults()
+	err := n.Send(context.Background(), &models.AlertGroup{Status: "firing"}, "42")
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("expected the API's description in the error, got %v", err)
+	}
+
+	server.Close()
+	err = n.Send(context.Background(), &models.AlertGroup{Status: "firing"}, "42")
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected a connection error without the bot token, got %v", err)
+	}
+}
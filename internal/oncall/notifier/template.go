@@ -0,0 +1,114 @@
+package notifier
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// TemplateData is what notification templates are executed against
+type TemplateData struct {
+	Alert       *models.AlertGroup
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	"toUpper":          strings.ToUpper,
+	"toLower":          strings.ToLower,
+	"humanizeDuration": humanizeDuration,
+	"since":            time.Since,
+}
+
+// CheckTemplate reports whether text parses as a notification template,
+// so a broken one is caught at startup rather than on the first send
+func CheckTemplate(text string) error {
+	_, err := parseTemplate(text)
+	return err
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("notification").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// RenderTemplate executes a notification template such as
+//
+//	{{ .Alert.Severity | toUpper }}: {{ .Labels.alertname }} firing for {{ since .Alert.StartsAt | humanizeDuration }}
+//
+// against alert
+func RenderTemplate(text string, alert *models.AlertGroup) (string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, TemplateData{
+		Alert:       alert,
+		Labels:      alert.Labels,
+		Annotations: alert.Annotations,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to execute notification template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// humanizeDuration formats a time.Duration, or a number of seconds, as a
+// short readable string like "2h 5m" or "45s"
+func humanizeDuration(v interface{}) (string, error) {
+	var d time.Duration
+	switch v := v.(type) {
+	case time.Duration:
+		d = v
+	case int:
+		d = time.Duration(v) * time.Second
+	case int64:
+		d = time.Duration(v) * time.Second
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v), nil
+		}
+		d = time.Duration(v * float64(time.Second))
+	default:
+		return "", fmt.Errorf("humanizeDuration: unsupported type %T", v)
+	}
+
+	if d < 0 {
+		return "-" + formatDuration(-d), nil
+	}
+	return formatDuration(d), nil
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	seconds := (d - minutes*time.Minute) / time.Second
+
+	var parts []string
+	for _, p := range []struct {
+		n    time.Duration
+		unit string
+	}{{days, "d"}, {hours, "h"}, {minutes, "m"}, {seconds, "s"}} {
+		if p.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d%s", p.n, p.unit))
+		}
+	}
+	return strings.Join(parts, " ")
+}
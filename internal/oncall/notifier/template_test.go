@@ -0,0 +1,140 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func templateAlert() *models.AlertGroup {
+	return &models.AlertGroup{
+		Fingerprint: "abc123",
+		Status:      "firing",
+		Severity:    "critical",
+		Summary:     "Disk almost full",
+		Labels:      map[string]string{"alertname": "DiskFull", "instance": "db1"},
+		Annotations: map[string]string{"runbook": "https://runbooks.example.com/disk"},
+		StartsAt:    time.Now().Add(-90 * time.Minute),
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	got, err := RenderTemplate(
+		`{{ .Alert.Severity | toUpper }}: {{ .Labels.alertname }} on {{ .Labels.instance }} for {{ since .Alert.StartsAt | humanizeDuration }} ({{ .Annotations.runbook }}){{ .Labels.missing }}`,
+		templateAlert())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "CRITICAL: DiskFull on db1 for 1h 30m (https://runbooks.example.com/disk)"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRenderTemplate_Errors(t *testing.T) {
+	if _, err := RenderTemplate(`{{ .Alert.Summary `, templateAlert()); err == nil || !strings.Contains(err.Error(), "invalid notification template") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+	if _, err := RenderTemplate(`{{ humanizeDuration "soon" }}`, templateAlert()); err == nil {
+		t.Error("expected an execution error")
+	}
+}
+
+func TestHumanizeDuration(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{45 * time.Second, "45s"},
+		{2*time.Hour + 5*time.Minute, "2h 5m"},
+		{26*time.Hour + 3*time.Second, "1d 2h 3s"},
+		{90, "1m 30s"},
+		{0.25, "250ms"},
+		{-30 * time.Second, "-30s"},
+	}
+	for _, tt := range tests {
+		got, err := humanizeDuration(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("humanizeDuration(%v): expected %q, got %q (%v)", tt.in, tt.want, got, err)
+		}
+	}
+}
+
+func TestSlackNotifier_Template(t *testing.T) {
+	received := make(chan SlackMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg SlackMessage
+		json.NewDecoder(r.Body).Decode(&msg)
+		received <- msg
+	}))
+	defer server.Close()
+
+	notifier := NewSlackNotifier(server.URL)
+	notifier.Template = `[{{ .Alert.Status }}] {{ .Labels.alertname }}`
+
+	if err := notifier.Send(context.Background(), templateAlert(), ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg := <-received; msg.Text != "[firing] DiskFull" {
+		t.Errorf("expected templated text, got %q", msg.Text)
+	}
+}
+
+func TestNotifier_TemplateParseErrorFromSend(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	slack := NewSlackNotifier(server.URL)
+	slack.Template = `{{ if .Alert }}unterminated`
+	webhook := NewWebhookNotifier("")
+	webhook.Template = `{{ .Labels.alertname`
+
+	for name, send := range map[string]func() error{
+		"slack":   func() error { return slack.Send(context.Background(), templateAlert(), "") },
+		"webhook": func() error { return webhook.Send(context.Background(), templateAlert(), server.URL) },
+	} {
+		err := send()
+		if err == nil || !strings.Contains(err.Error(), "invalid notification template") {
+			t.Errorf("%s: expected a template error, got %v", name, err)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected nothing sent with a broken template, got %d requests", n)
+	}
+}
+
+func TestWebhookNotifier_Template(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier("")
+	if err := notifier.Send(context.Background(), templateAlert(), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := (<-received)["message"]; ok {
+		t.Error("expected no message without a template")
+	}
+
+	notifier.Template = `{{ .Alert.Summary }} ({{ .Alert.Severity }})`
+	if err := notifier.Send(context.Background(), templateAlert(), server.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := (<-received)["message"]; got != "Disk almost full (critical)" {
+		t.Errorf("expected templated message, got %v", got)
+	}
+}
@@ -0,0 +1,83 @@
+package notifier
+
+import "github.com/vjranagit/grafana/internal/oncall/models"
+
+// NotificationTheme controls the colors and icons notifiers use to render
+// alerts. Entries missing from a custom theme fall back to DefaultTheme.
+type NotificationTheme struct {
+	// SeverityColors maps severity to a hex color
+	SeverityColors map[string]string
+	// StatusColors maps status to a hex color, taking precedence over the
+	// severity color (e.g. resolved alerts are always green)
+	StatusColors map[string]string
+	// SeverityIcons maps severity to an icon for alerts whose status has
+	// no icon of its own
+	SeverityIcons map[string]string
+	// StatusIcons maps status to an icon
+	StatusIcons map[string]string
+
+	DefaultColor string
+	DefaultIcon  string
+}
+
+// DefaultTheme returns the built-in colors and icons
+func DefaultTheme() NotificationTheme {
+	return NotificationTheme{
+		SeverityColors: map[string]string{
+			"critical": "#FF0000", // red
+			"warning":  "#FFA500", // orange
+			"info":     "#0000FF", // blue
+		},
+		StatusColors: map[string]string{
+			"resolved":     "#00FF00", // green
+			"acknowledged": "#FFFF00", // yellow
+		},
+		SeverityIcons: map[string]string{},
+		StatusIcons: map[string]string{
+			"resolved":     "✅",
+			"acknowledged": "👀",
+		},
+		DefaultColor: "#808080", // gray
+		DefaultIcon:  "🔥",
+	}
+}
+
+// Color returns the color for an alert, preferring its status color over
+// its severity color
+func (t NotificationTheme) Color(alert *models.AlertGroup) string {
+	def := DefaultTheme()
+	if c, ok := lookup(t.StatusColors, def.StatusColors, alert.Status); ok {
+		return c
+	}
+	if c, ok := lookup(t.SeverityColors, def.SeverityColors, alert.Severity); ok {
+		return c
+	}
+	if t.DefaultColor != "" {
+		return t.DefaultColor
+	}
+	return def.DefaultColor
+}
+
+// Icon returns the icon for an alert, preferring its status icon over its
+// severity icon
+func (t NotificationTheme) Icon(alert *models.AlertGroup) string {
+	def := DefaultTheme()
+	if i, ok := lookup(t.StatusIcons, def.StatusIcons, alert.Status); ok {
+		return i
+	}
+	if i, ok := lookup(t.SeverityIcons, def.SeverityIcons, alert.Severity); ok {
+		return i
+	}
+	if t.DefaultIcon != "" {
+		return t.DefaultIcon
+	}
+	return def.DefaultIcon
+}
+
+func lookup(custom, fallback map[string]string, key string) (string, bool) {
+	if v, ok := custom[key]; ok {
+		return v, true
+	}
+	v, ok := fallback[key]
+	return v, ok
+}
@@ -0,0 +1,74 @@
+package notifier
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func TestNotificationTheme_Defaults(t *testing.T) {
+	theme := DefaultTheme()
+
+	tests := []struct {
+		alert *models.AlertGroup
+		color string
+		icon  string
+	}{
+		{&models.AlertGroup{Status: "firing", Severity: "critical"}, "#FF0000", "🔥"},
+		{&models.AlertGroup{Status: "firing", Severity: "unknown"}, "#808080", "🔥"},
+		{&models.AlertGroup{Status: "resolved", Severity: "critical"}, "#00FF00", "✅"},
+		{&models.AlertGroup{Status: "acknowledged", Severity: "warning"}, "#FFFF00", "👀"},
+	}
+
+	for _, tt := range tests {
+		if got := theme.Color(tt.alert); got != tt.color {
+			t.Errorf("%s/%s: expected color %s, got %s", tt.alert.Status, tt.alert.Severity, tt.color, got)
+		}
+		if got := theme.Icon(tt.alert); got != tt.icon {
+			t.Errorf("%s/%s: expected icon %s, got %s", tt.alert.Status, tt.alert.Severity, tt.icon, got)
+		}
+	}
+}
+
+func TestSlackNotifier_CustomTheme(t *testing.T) {
+	theme := NotificationTheme{
+		SeverityColors: map[string]string{"critical": "#8B0000"},
+		SeverityIcons:  map[string]string{"critical": "🚨"},
+		StatusIcons:    map[string]string{"resolved": "🎉"},
+	}
+	notifier := NewSlackNotifierWithTheme("https://hooks.slack.com/test", theme)
+
+	critical := notifier.buildSlackMessage(&models.AlertGroup{
+		Status:   "firing",
+		Severity: "critical",
+		Summary:  "Database down",
+	})
+	if critical.Attachments[0].Color != "#8B0000" {
+		t.Errorf("expected custom critical color, got %s", critical.Attachments[0].Color)
+	}
+	if !strings.HasPrefix(critical.Text, "🚨") {
+		t.Errorf("expected custom critical icon, got %q", critical.Text)
+	}
+
+	resolved := notifier.buildSlackMessage(&models.AlertGroup{
+		Status:   "resolved",
+		Severity: "critical",
+		Summary:  "Database back",
+	})
+	if !strings.HasPrefix(resolved.Text, "🎉") {
+		t.Errorf("expected custom resolved icon, got %q", resolved.Text)
+	}
+	// Entries not overridden fall back to the defaults
+	if resolved.Attachments[0].Color != "#00FF00" {
+		t.Errorf("expected default resolved color, got %s", resolved.Attachments[0].Color)
+	}
+
+	warning := notifier.buildSlackMessage(&models.AlertGroup{
+		Status:   "firing",
+		Severity: "warning",
+	})
+	if warning.Attachments[0].Color != "#FFA500" || !strings.HasPrefix(warning.Text, "🔥") {
+		t.Errorf("expected default warning rendering, got %s %q", warning.Attachments[0].Color, warning.Text)
+	}
+}
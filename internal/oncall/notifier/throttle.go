@@ -0,0 +1,135 @@
+package notifier
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults for a throttle created with non-positive settings
+const (
+	DefaultThrottleLimit  = 10
+	DefaultThrottleWindow = time.Minute
+)
+
+// Throttle caps notifications to each channel and recipient at a limit per
+// rolling window, so an alert storm doesn't page a responder once per
+// alert. Notifications over the limit are counted instead of sent, and a
+// single summary of how many were held back goes out once the window has
+// room again.
+type Throttle struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+	// after runs f once d has passed, time.AfterFunc outside tests
+	after func(d time.Duration, f func())
+
+	mu         sync.Mutex
+	targets    map[throttleKey]*throttleState
+	suppressed atomic.Int64
+}
+
+type throttleKey struct {
+	channel   string
+	recipient string
+}
+
+type throttleState struct {
+	// sent holds the send times within the window, oldest first
+	sent []time.Time
+	// held counts notifications suppressed since the last summary
+	held int
+}
+
+func NewThrottle(limit int, window time.Duration) *Throttle {
+	if limit <= 0 {
+		limit = DefaultThrottleLimit
+	}
+	if window <= 0 {
+		window = DefaultThrottleWindow
+	}
+	return &Throttle{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		after:   func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+		targets: make(map[throttleKey]*throttleState),
+	}
+}
+
+// admit records a notification to recipient on channel and reports whether
+// it may be sent. For the first one held back since the last summary it
+// also returns how long until the summary is due.
+func (t *Throttle) admit(channel, recipient string) (ok bool, summaryIn time.Duration, first bool) {
+	key := throttleKey{channel: channel, recipient: recipient}
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.targets[key]
+	if state == nil {
+		t.prune(now)
+		state = &throttleState{}
+		t.targets[key] = state
+	}
+	state.expire(now, t.window)
+
+	if len(state.sent) < t.limit && state.held == 0 {
+		state.sent = append(state.sent, now)
+		return true, 0, false
+	}
+
+	t.suppressed.Add(1)
+	state.held++
+	if state.held > 1 {
+		return false, 0, false
+	}
+	// The window is full, so the summary can go once its oldest send expires
+	return false, state.sent[0].Add(t.window).Sub(now), true
+}
+
+// drain returns how many notifications were held back for recipient on
+// channel and counts the summary that reports them as a send
+func (t *Throttle) drain(channel, recipient string) int {
+	key := throttleKey{channel: channel, recipient: recipient}
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := t.targets[key]
+	if state == nil || state.held == 0 {
+		return 0
+	}
+	held := state.held
+	state.held = 0
+	state.expire(now, t.window)
+	state.sent = append(state.sent, now)
+	return held
+}
+
+// Suppressed returns how many notifications have been held back so far
+func (t *Throttle) Suppressed() int64 {
+	return t.suppressed.Load()
+}
+
+// expire drops sends that have left the window
+func (s *throttleState) expire(now time.Time, window time.Duration) {
+	i := 0
+	for i < len(s.sent) && now.Sub(s.sent[i]) >= window {
+		i++
+	}
+	s.sent = s.sent[i:]
+}
+
+// prune drops idle recipients so the map doesn't grow with every recipient
+// ever notified. Callers hold t.mu.
+func (t *Throttle) prune(now time.Time) {
+	for key, state := range t.targets {
+		state.expire(now, t.window)
+		if len(state.sent) == 0 && state.held == 0 {
+			delete(t.targets, key)
+		}
+	}
+}
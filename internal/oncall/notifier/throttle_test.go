@@ -0,0 +1,140 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+type capturingNotifier struct {
+	mu   sync.Mutex
+	sent map[string][]string // recipient -> alert summaries
+}
+
+func (n *capturingNotifier) Channel() string { return "slack" }
+
+func (n *capturingNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.sent == nil {
+		n.sent = make(map[string][]string)
+	}
+	n.sent[recipient] = append(n.sent[recipient], alert.Summary)
+	return nil
+}
+
+func (n *capturingNotifier) to(recipient string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.sent[recipient]...)
+}
+
+func TestManager_ThrottleCoalescesStorm(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var pending []func()
+	var delays []time.Duration
+
+	throttle := NewThrottle(3, time.Minute)
+	throttle.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	throttle.after = func(d time.Duration, f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		delays = append(delays, d)
+		pending = append(pending, f)
+	}
+
+	notifier := &capturingNotifier{}
+	manager := NewManager()
+	manager.Register(notifier)
+	manager.SetThrottle(throttle)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			alert := &models.AlertGroup{Fingerprint: fmt.Sprintf("fp%d", i), Status: "firing", Summary: "storm"}
+			if err := manager.Send(context.Background(), "slack", alert, "#oncall"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := notifier.to("#oncall"); len(got) != 3 {
+		t.Fatalf("expected 3 notifications within the limit, got %d", len(got))
+	}
+	if got := throttle.Suppressed(); got != 47 {
+		t.Errorf("expected 47 suppressed, got %d", got)
+	}
+	if len(pending) != 1 || delays[0] != time.Minute {
+		t.Fatalf("expected one summary scheduled a window out, got %v", delays)
+	}
+
+	// Another recipient has a budget of its own
+	if err := manager.Send(context.Background(), "slack", &models.AlertGroup{Summary: "other"}, "#payments"); err != nil {
+		t.Fatal(err)
+	}
+	if got := notifier.to("#payments"); len(got) != 1 {
+		t.Errorf("expected #payments to be notified, got %v", got)
+	}
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	pending[0]()
+
+	got := notifier.to("#oncall")
+	if len(got) != 4 || got[3] != "47 more alerts suppressed" {
+		t.Fatalf("expected a single summary after the storm, got %v", got)
+	}
+
+	// The window has room again, less the slot the summary took
+	for i := 0; i < 3; i++ {
+		manager.Send(context.Background(), "slack", &models.AlertGroup{Summary: "later"}, "#oncall")
+	}
+	if got := notifier.to("#oncall"); len(got) != 6 {
+		t.Errorf("expected 2 more notifications after the summary, got %v", got)
+	}
+	if len(pending) != 2 {
+		t.Errorf("expected the next overflow to schedule another summary, got %d", len(pending))
+	}
+}
+
+func TestThrottle_SlidingWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	throttle := NewThrottle(2, time.Minute)
+	throttle.now = func() time.Time { return now }
+
+	admit := func() bool {
+		ok, _, _ := throttle.admit("slack", "#oncall")
+		return ok
+	}
+
+	if !admit() {
+		t.Fatal("expected the first send through")
+	}
+	now = now.Add(30 * time.Second)
+	if !admit() {
+		t.Fatal("expected the second send through")
+	}
+	ok, summaryIn, first := throttle.admit("slack", "#oncall")
+	if ok || !first || summaryIn != 30*time.Second {
+		t.Fatalf("expected the third held with a summary due in 30s, got %v %v %v", ok, summaryIn, first)
+	}
+	if n := throttle.drain("slack", "#oncall"); n != 1 {
+		t.Errorf("expected 1 held, got %d", n)
+	}
+	if n := throttle.drain("slack", "#oncall"); n != 0 {
+		t.Errorf("expected nothing held after draining, got %d", n)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/vjranagit/grafana/internal/oncall/api"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+)
+
+// routedDispatcher queues notifications to the targets the routing tree
+// picks for an alert when it fires or resolves, then hands it on to
+// escalation, if any
+type routedDispatcher struct {
+	tree  *notifier.RoutingTree
+	async *notifier.AsyncSender
+	next  api.Dispatcher
+}
+
+func (d *routedDispatcher) Dispatch(ctx context.Context, alert *models.AlertGroup) bool {
+	routed := d.notify(ctx, alert)
+	if d.next != nil && d.next.Dispatch(ctx, alert) {
+		return true
+	}
+	return routed
+}
+
+func (d *routedDispatcher) Resolve(ctx context.Context, alert *models.AlertGroup) {
+	d.notify(ctx, alert)
+	if d.next != nil {
+		d.next.Resolve(ctx, alert)
+	}
+}
+
+// notify queues alert for its routed targets and reports whether it has
+// any. The queued sends keep ctx's log attributes.
+func (d *routedDispatcher) notify(ctx context.Context, alert *models.AlertGroup) bool {
+	targets := d.tree.Resolve(alert)
+	for _, target := range targets {
+		if err := d.async.EnqueueSend(ctx, target.Channel, alert, target.Recipient); err != nil {
+			slog.ErrorContext(ctx, "failed to queue routed notification",
+				"alert", alert.Fingerprint,
+				"target", target.Channel,
+				"error", err)
+		}
+	}
+	return len(targets) > 0
+}
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -9,19 +11,131 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/vjranagit/grafana/internal/oncall/api"
+	"github.com/vjranagit/grafana/internal/oncall/escalation"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
 	"github.com/vjranagit/grafana/internal/oncall/store"
 )
 
 type Config struct {
 	Listen   string
 	Database string
+
+	// AllowLabels and DenyLabels filter alert labels before storage, see
+	// api.LabelFilter
+	AllowLabels []string
+	DenyLabels  []string
+
+	// StoreWebhooks keeps raw incoming webhooks so they can be replayed
+	StoreWebhooks bool
+
+	// StoreDeadLetters keeps webhooks that fail to decode in the
+	// dead_letter table
+	StoreDeadLetters bool
+
+	// MaxWebhookBytes caps alert webhook bodies. Zero uses
+	// api.DefaultMaxWebhookBytes.
+	MaxWebhookBytes int64
+
+	// MaxAnnotationLength truncates alert annotation values longer than
+	// this many bytes. Zero keeps them whole.
+	MaxAnnotationLength int
+
+	// DedupInterval is how long resends of a firing alert are suppressed
+	// before it notifies again. Zero notifies only when it starts firing.
+	DedupInterval time.Duration
+
+	// DefaultEscalationChain is the ID of the chain that escalates alerts
+	// whose integration has no chain of its own. Zero leaves them passive.
+	DefaultEscalationChain int64
+
+	// WebhookPool, if set, registers the "webhook-pool" channel, which
+	// spreads sends across these identical receivers using
+	// WebhookPoolStrategy, see notifier.BalancedNotifier
+	WebhookPool         []notifier.Endpoint
+	WebhookPoolStrategy string
+
+	// UserChannels maps user IDs to the channel notify_schedule steps page
+	// them on. Users not listed are paged on DefaultUserChannel, or skipped
+	// if it is empty. Every channel must be registered.
+	UserChannels       map[string]string
+	DefaultUserChannel string
+
+	// SeverityMultipliers scale the wait steps of escalation chains by
+	// alert severity, e.g. {"critical": 0.5} halves them for critical
+	// alerts. Severities not listed wait as configured.
+	SeverityMultipliers map[string]float64
+
+	// WebhookRateLimit, if positive, limits each client (or integration,
+	// per WebhookRateLimitBy) to this many alert webhook requests per
+	// second, with bursts of WebhookRateBurst. See api.RateLimiter.
+	WebhookRateLimit   float64
+	WebhookRateBurst   int
+	WebhookRateLimitBy string
+
+	// NotifyThrottleLimit, if positive, caps notifications to each channel
+	// and recipient at this many per NotifyThrottleWindow, with the excess
+	// summed up in one message. See notifier.Throttle.
+	NotifyThrottleLimit  int
+	NotifyThrottleWindow time.Duration
+
+	// NotifyDedupWindow, if positive, suppresses a notification for an
+	// alert, channel, recipient and status sent within this long of an
+	// identical one.
+	// See notifier.Deduplicator.
+	NotifyDedupWindow time.Duration
+
+	// NotifyWorkers and NotifyQueueSize size the background queue routed
+	// notifications go through, see notifier.AsyncSender. Zero uses the
+	// defaults.
+	NotifyWorkers   int
+	NotifyQueueSize int
+
+	// Routes send alerts to notification targets picked by their labels,
+	// alongside any escalation. See notifier.RoutingTree.
+	Routes []notifier.Route
+
+	// APIKeys, if set, are required on every /api/v1 request, see
+	// api.RequireAPIKey. /health and /metrics stay open.
+	APIKeys []api.APIKey
+
+	// SlackSigningSecret, if set, adds Acknowledge and Resolve buttons to
+	// Slack alerts and accepts their clicks on /api/v1/slack/interactions,
+	// which is exempt from APIKeys since Slack signs its requests instead
+	SlackSigningSecret string
+
+	// WebhookSigningSecret, if set, signs the requests of the webhook and
+	// webhook-pool channels. See notifier.WebhookNotifier.SigningSecret.
+	WebhookSigningSecret string
+
+	// WebhookHeaders are added to every request of the webhook and
+	// webhook-pool channels
+	WebhookHeaders map[string]string
+
+	// SlackTemplate and WebhookTemplate, if set, replace the summary line
+	// of Slack messages and set the "message" field of webhook payloads.
+	// See notifier.RenderTemplate.
+	SlackTemplate   string
+	WebhookTemplate string
+
+	// TelegramBotToken, if set, registers the "telegram" channel, which
+	// posts as this bot to the chat ID given as the recipient
+	TelegramBotToken string
 }
 
 type Server struct {
-	cfg    *Config
-	router *chi.Mux
-	store  *store.Store
+	cfg        *Config
+	router     *chi.Mux
+	store      *store.Store
+	dispatcher *escalation.Dispatcher
+	stopPool   context.CancelFunc
+	// async queues routed notifications so alert ingestion doesn't wait
+	// on them
+	async *notifier.AsyncSender
+	// testAlerts holds the pending auto-resolves of test alerts
+	testAlerts *api.TestAlerts
 }
 
 func New(cfg *Config) (*Server, error) {
@@ -31,13 +145,78 @@ func New(cfg *Config) (*Server, error) {
 		return nil, fmt.Errorf("failed to initialize store: %w", err)
 	}
 
+	labelFilter, err := api.NewLabelFilter(cfg.AllowLabels, cfg.DenyLabels)
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+
+	var requireKey func(http.Handler) http.Handler
+	if len(cfg.APIKeys) > 0 {
+		requireKey, err = api.RequireAPIKey(cfg.APIKeys)
+		if err != nil {
+			st.Close()
+			return nil, err
+		}
+	}
+
+	var rateLimit *api.RateLimiter
+	if cfg.WebhookRateLimit > 0 {
+		by := cfg.WebhookRateLimitBy
+		if by == "" {
+			by = api.RateLimitByIP
+		}
+		rateLimit, err = api.NewRateLimiter(cfg.WebhookRateLimit, cfg.WebhookRateBurst, by)
+		if err != nil {
+			st.Close()
+			return nil, err
+		}
+	}
+
+	manager, err := newManager(cfg)
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+	manager.SetRecorder(st)
+	if err := checkUserChannels(cfg, manager); err != nil {
+		st.Close()
+		return nil, err
+	}
+	pool := newPool(manager)
+	dispatcher, err := newDispatcher(cfg, st, pool)
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+
+	// Load reporting for operators and autoscalers
+	ingestion := api.NewIngestionRate(api.DefaultIngestionWindow)
+	testAlerts := api.NewTestAlerts()
+	load := api.LoadSources{
+		Ingestion:     ingestion,
+		Escalations:   dispatcher,
+		Notifications: pool,
+	}
+	poolCtx, cancelPool := context.WithCancel(context.Background())
+	poolDone := make(chan struct{})
+	go func() {
+		defer close(poolDone)
+		pool.Run(poolCtx)
+	}()
+	// stopPool waits for sends in flight so none outlive the store
+	stopPool := func() {
+		cancelPool()
+		<-poolDone
+	}
+
 	// Setup router
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(api.LogRequests)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(skipAlertStream(middleware.Timeout(requestTimeout)))
 
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -45,16 +224,184 @@ func New(cfg *Config) (*Server, error) {
 		w.Write([]byte("OK"))
 	})
 
+	// Metrics
+	r.Handle("/metrics", promhttp.Handler())
+	r.Get("/debug/load", api.LoadHandler(load))
+
 	// API routes
-	r.Mount("/api/v1", api.NewRouter(st))
+	opts := api.RouterOptions{
+		LabelFilter:            labelFilter,
+		StoreWebhooks:          cfg.StoreWebhooks,
+		StoreDeadLetters:       cfg.StoreDeadLetters,
+		MaxWebhookBytes:        cfg.MaxWebhookBytes,
+		IngestionRate:          ingestion,
+		TestAlerts:             testAlerts,
+		MaxAnnotationLength:    cfg.MaxAnnotationLength,
+		DedupInterval:          cfg.DedupInterval,
+		DefaultEscalationChain: cfg.DefaultEscalationChain,
+		WebhookRateLimit:       rateLimit,
+		Notifiers:              manager,
+		SlackSigningSecret:     cfg.SlackSigningSecret,
+		Dispatcher:             dispatcher,
+	}
+	var async *notifier.AsyncSender
+	if len(cfg.Routes) > 0 {
+		async = notifier.NewAsyncSender(pool, cfg.NotifyWorkers, cfg.NotifyQueueSize)
+		opts.Dispatcher = &routedDispatcher{tree: notifier.NewRoutingTree(cfg.Routes), async: async, next: dispatcher}
+	}
+	r.Route("/api/v1", func(r chi.Router) {
+		if requireKey != nil {
+			r.Use(skipSlackInteractions(requireKey))
+		}
+		r.Mount("/", api.NewRouterWithOptions(st, opts))
+	})
 
 	return &Server{
-		cfg:    cfg,
-		router: r,
-		store:  st,
+		cfg:        cfg,
+		router:     r,
+		store:      st,
+		dispatcher: dispatcher,
+		stopPool:   stopPool,
+		async:      async,
+		testAlerts: testAlerts,
 	}, nil
 }
 
+// requestTimeout bounds every request but the alert stream
+var requestTimeout = 60 * time.Second
+
+// skipAlertStream applies timeout to every request but the alert stream,
+// which stays open until the client disconnects
+func skipAlertStream(timeout func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		bounded := timeout(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v1/alerts/stream" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			bounded.ServeHTTP(w, r)
+		})
+	}
+}
+
+// skipSlackInteractions applies auth to every request but Slack's button
+// clicks, which the interactions handler verifies by signature
+func skipSlackInteractions(auth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authed := auth(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v1/slack/interactions" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			authed.ServeHTTP(w, r)
+		})
+	}
+}
+
+// newManager sets up the notification channels
+func newManager(cfg *Config) (*notifier.Manager, error) {
+	// Targets carry their own destination, e.g. webhook:https://... or
+	// slack:https://hooks.slack.com/...
+	for name, text := range map[string]string{"slack": cfg.SlackTemplate, "webhook": cfg.WebhookTemplate} {
+		if err := notifier.CheckTemplate(text); err != nil {
+			return nil, fmt.Errorf("%s template: %w", name, err)
+		}
+	}
+
+	manager := notifier.NewManager()
+	slack := notifier.NewSlackNotifier("")
+	slack.Interactive = cfg.SlackSigningSecret != ""
+	slack.Template = cfg.SlackTemplate
+	manager.Register(slack)
+	webhook := notifier.NewWebhookNotifierWithHeaders("", cfg.WebhookHeaders)
+	webhook.SigningSecret = cfg.WebhookSigningSecret
+	webhook.Template = cfg.WebhookTemplate
+	manager.Register(webhook)
+	if cfg.TelegramBotToken != "" {
+		manager.Register(notifier.NewTelegramNotifier(cfg.TelegramBotToken))
+	}
+	if len(cfg.WebhookPool) > 0 {
+		balanced, err := notifier.NewBalancedNotifier("webhook-pool", webhook,
+			cfg.WebhookPool, cfg.WebhookPoolStrategy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook pool: %w", err)
+		}
+		manager.Register(balanced)
+	}
+	if cfg.NotifyDedupWindow > 0 {
+		manager.SetDeduplicator(notifier.NewDeduplicator(cfg.NotifyDedupWindow))
+	}
+	if cfg.NotifyThrottleLimit > 0 {
+		manager.SetThrottle(notifier.NewThrottle(cfg.NotifyThrottleLimit, cfg.NotifyThrottleWindow))
+	}
+	return manager, nil
+}
+
+// checkUserChannels makes sure notify_schedule steps can page users on the
+// channels configured for them
+func checkUserChannels(cfg *Config, manager *notifier.Manager) error {
+	if cfg.DefaultUserChannel != "" {
+		if _, ok := manager.Notifier(cfg.DefaultUserChannel); !ok {
+			return fmt.Errorf("default user channel %q is not a configured notification channel", cfg.DefaultUserChannel)
+		}
+	}
+	for user, channel := range cfg.UserChannels {
+		if _, ok := manager.Notifier(channel); !ok {
+			return fmt.Errorf("channel %q for user %s is not a configured notification channel", channel, user)
+		}
+	}
+	return nil
+}
+
+// newPool returns the pool notifications go through
+func newPool(manager *notifier.Manager) *notifier.Pool {
+	return notifier.NewPool(manager, notifier.DefaultPoolWorkers)
+}
+
+// newDispatcher sets up escalation with notifications sent through pool.
+// Alerts run their integration's chain; the configured default chain, if
+// any, is the fallback for those without one.
+func newDispatcher(cfg *Config, st *store.Store, pool *notifier.Pool) (*escalation.Dispatcher, error) {
+	var fallback *models.EscalationChain
+	if cfg.DefaultEscalationChain != 0 {
+		chain, err := st.GetEscalationChain(context.Background(), cfg.DefaultEscalationChain)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("default escalation chain %d does not exist", cfg.DefaultEscalationChain)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load default escalation chain: %w", err)
+		}
+
+		slog.Info("escalating unrouted alerts with default chain",
+			"chain", chain.ID,
+			"name", chain.Name)
+		fallback = chain
+	}
+
+	engine := escalation.NewEngine(pool, st)
+	engine.SetProgressStore(st)
+	engine.SetSchedules(st)
+	engine.SetUserChannels(cfg.UserChannels)
+	engine.SetDefaultUserChannel(cfg.DefaultUserChannel)
+	engine.SetSeverityMultipliers(cfg.SeverityMultipliers)
+	dispatcher := escalation.NewDispatcher(escalation.NewRouter(nil, fallback), engine)
+	dispatcher.SetChainSource(st)
+
+	// Pick up escalations a previous run left unfinished
+	resumed, err := dispatcher.Resume(context.Background())
+	if err != nil {
+		dispatcher.Close()
+		return nil, err
+	}
+	if resumed > 0 {
+		slog.Info("resumed escalations", "count", resumed)
+	}
+
+	return dispatcher, nil
+}
+
 func (s *Server) Run(ctx context.Context) error {
 	srv := &http.Server{
 		Addr:    s.cfg.Listen,
@@ -71,13 +418,43 @@ func (s *Server) Run(ctx context.Context) error {
 	}()
 
 	// Wait for shutdown signal or error
+	var err error
 	select {
 	case <-ctx.Done():
 		slog.Info("shutting down server")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		return srv.Shutdown(shutdownCtx)
-	case err := <-errCh:
-		return err
+	case err = <-errCh:
+		slog.Error("server failed, shutting down", "error", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if shutdownErr := srv.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+	s.shutdown(shutdownCtx)
+	return err
+}
+
+// shutdown stops escalation and notification delivery, then closes the
+// store once nothing writes to it any more
+func (s *Server) shutdown(ctx context.Context) {
+	if drills := s.testAlerts.Stop(); len(drills) > 0 {
+		slog.Warn("shut down before test alerts auto-resolved; resolve them by hand",
+			"drill_ids", drills)
+	}
+	// Escalations checkpoint their progress so the next start resumes them
+	if err := s.dispatcher.Shutdown(ctx); err != nil {
+		slog.Warn("shut down before escalations were checkpointed",
+			"active", s.dispatcher.ActiveEscalations())
+	}
+	// Deliver queued notifications before the pool they go through stops
+	if s.async != nil {
+		if err := s.async.Close(ctx); err != nil {
+			slog.Warn("shut down with notifications still queued", "queued", s.async.Backlog())
+		}
+	}
+	s.stopPool()
+	if err := s.store.Close(); err != nil {
+		slog.Error("failed to close store", "error", err)
 	}
 }
@@ -0,0 +1,504 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/api"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+	"github.com/vjranagit/grafana/internal/oncall/notifier"
+	"github.com/vjranagit/grafana/internal/oncall/store"
+)
+
+// newTestConfig creates a database holding one escalation chain that
+// notifies target, and returns a config pointing at it with the chain ID
+func newTestConfig(t *testing.T, target string) (*Config, int64) {
+	t.Helper()
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+
+	st, err := store.New(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &models.EscalationChain{Name: "Default", Policies: []models.EscalationPolicy{
+		{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: target},
+	}}
+	if err := st.CreateEscalationChain(context.Background(), chain); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	return &Config{Listen: ":0", Database: dsn}, chain.ID
+}
+
+func postAlert(t *testing.T, s *Server) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/alerts/prometheus", strings.NewReader(
+		`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "Unrouted"}}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServer_DefaultEscalationChain(t *testing.T) {
+	notified := make(chan map[string]interface{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		notified <- payload
+	}))
+	defer hook.Close()
+
+	cfg, chainID := newTestConfig(t, "webhook:"+hook.URL)
+	cfg.DefaultEscalationChain = chainID
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	defer s.stopPool()
+	defer s.dispatcher.Close()
+
+	postAlert(t, s)
+
+	select {
+	case payload := <-notified:
+		if payload["summary"] != "Unrouted" {
+			t.Errorf("unexpected notification %v", payload)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the unrouted alert to escalate via the default chain")
+	}
+}
+
+func TestServer_NoDefaultEscalationChain(t *testing.T) {
+	notified := make(chan struct{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified <- struct{}{}
+	}))
+	defer hook.Close()
+
+	cfg, _ := newTestConfig(t, "webhook:"+hook.URL)
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	defer s.stopPool()
+	defer s.dispatcher.Close()
+
+	postAlert(t, s)
+
+	select {
+	case <-notified:
+		t.Error("expected the unrouted alert to stay passive")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestServer_IntegrationChainWithoutDefault(t *testing.T) {
+	notified := make(chan struct{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified <- struct{}{}
+	}))
+	defer hook.Close()
+
+	cfg, chainID := newTestConfig(t, "webhook:"+hook.URL)
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	defer s.stopPool()
+	defer s.dispatcher.Close()
+
+	integration := &models.Integration{Name: "am", Type: models.IntegrationPrometheus, EscalationChainID: &chainID}
+	if err := s.store.CreateIntegration(context.Background(), integration); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/alerts/integrations/"+integration.Token, strings.NewReader(
+		`{"status": "firing", "alerts": [{"status": "firing", "labels": {"alertname": "Routed"}}]}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	select {
+	case <-notified:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the integration's chain to escalate without a default chain")
+	}
+}
+
+func TestServer_Routes(t *testing.T) {
+	notified := make(chan string, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified <- r.URL.Path
+	}))
+	defer hook.Close()
+
+	cfg, _ := newTestConfig(t, "webhook:"+hook.URL)
+	cfg.Routes = []notifier.Route{
+		{
+			Matchers: map[string]string{"alertname": "Unrouted"},
+			Targets: []notifier.Target{
+				{Channel: "webhook", Recipient: hook.URL + "/team"},
+				{Channel: "webhook", Recipient: hook.URL + "/pager"},
+			},
+		},
+		{Targets: []notifier.Target{{Channel: "webhook", Recipient: hook.URL + "/default"}}},
+	}
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	defer s.stopPool()
+
+	postAlert(t, s)
+
+	got := map[string]bool{}
+	for len(got) < 2 {
+		select {
+		case path := <-notified:
+			got[path] = true
+		case <-time.After(3 * time.Second):
+			t.Fatalf("expected the alert at both routed targets, got %v", got)
+		}
+	}
+	if !got["/team"] || !got["/pager"] {
+		t.Errorf("expected /team and /pager, got %v", got)
+	}
+}
+
+func TestServer_WebhookTemplate(t *testing.T) {
+	messages := make(chan string, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		messages <- payload.Message
+	}))
+	defer hook.Close()
+
+	cfg, _ := newTestConfig(t, "webhook:"+hook.URL)
+	cfg.Routes = []notifier.Route{{Targets: []notifier.Target{{Channel: "webhook", Recipient: hook.URL}}}}
+	cfg.WebhookTemplate = `{{ .Labels.alertname }} is {{ .Alert.Status }}`
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	defer s.stopPool()
+
+	postAlert(t, s)
+
+	select {
+	case got := <-messages:
+		if got != "Unrouted is firing" {
+			t.Errorf("expected the templated message, got %q", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected a webhook notification")
+	}
+}
+
+func TestServer_InvalidTemplate(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+	_, err := New(&Config{Listen: ":0", Database: dsn, SlackTemplate: "{{ .Alert.Summary"})
+	if err == nil || !strings.Contains(err.Error(), "slack template") {
+		t.Fatalf("expected a slack template error, got %v", err)
+	}
+}
+
+func TestServer_UnknownDefaultEscalationChain(t *testing.T) {
+	cfg, _ := newTestConfig(t, "webhook:http://localhost")
+	cfg.DefaultEscalationChain = 999
+
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expected an error for a missing default chain")
+	}
+}
+
+func TestServer_WebhookPool(t *testing.T) {
+	notified := make(chan struct{}, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified <- struct{}{}
+	}))
+	defer hook.Close()
+
+	cfg, chainID := newTestConfig(t, "webhook-pool:")
+	cfg.DefaultEscalationChain = chainID
+	cfg.WebhookPool = []notifier.Endpoint{{URL: hook.URL}}
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	defer s.stopPool()
+	defer s.dispatcher.Close()
+
+	postAlert(t, s)
+
+	select {
+	case <-notified:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the alert to be delivered through the webhook pool")
+	}
+}
+
+func TestServer_InvalidWebhookPool(t *testing.T) {
+	cfg, chainID := newTestConfig(t, "webhook-pool:")
+	cfg.DefaultEscalationChain = chainID
+	cfg.WebhookPool = []notifier.Endpoint{{URL: "http://localhost"}}
+	cfg.WebhookPoolStrategy = "random"
+
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expected an error for an unknown pool strategy")
+	}
+}
+
+func TestServer_DebugLoad(t *testing.T) {
+	cfg, _ := newTestConfig(t, "webhook:http://localhost")
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	defer s.stopPool()
+	defer s.dispatcher.Close()
+
+	postAlert(t, s)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/load", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if rate, _ := report["ingestion_rate"].(float64); rate <= 0 {
+		t.Errorf("expected the posted alert to count towards ingestion, got %v", report)
+	}
+	if report["active_escalations"] != float64(0) || report["notification_backlog"] != float64(0) {
+		t.Errorf("expected no escalation load for a passive alert, got %v", report)
+	}
+}
+
+func TestServer_APIKeys(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+	s, err := New(&Config{Listen: ":0", Database: dsn, APIKeys: []api.APIKey{
+		{Name: "dashboard", Key: "read-key", Scopes: []string{api.ScopeRead}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+
+	serve := func(method, path, key string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve("GET", "/health", ""); code != http.StatusOK {
+		t.Errorf("expected /health to stay open, got %d", code)
+	}
+	if code := serve("GET", "/api/v1/schedules", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a key, got %d", code)
+	}
+	if code := serve("GET", "/api/v1/schedules", "read-key"); code != http.StatusOK {
+		t.Errorf("expected 200 with a valid key, got %d", code)
+	}
+	if code := serve("POST", "/api/v1/schedules", "read-key"); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a write with a read-only key, got %d", code)
+	}
+}
+
+func TestServer_SlackInteractionsSkipAPIKeys(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+	s, err := New(&Config{Listen: ":0", Database: dsn, SlackSigningSecret: "secret",
+		APIKeys: []api.APIKey{{Name: "admin", Key: "admin-key"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+
+	// Unsigned, so the handler rejects it rather than the key check
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/slack/interactions", strings.NewReader("payload={}")))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Errorf("expected the signature check to answer, got %d %q", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "slack signature") {
+		t.Errorf("expected a signature error, got %q", rec.Body.String())
+	}
+}
+
+func TestServer_AlertStreamOutlivesRequestTimeout(t *testing.T) {
+	defer func(d time.Duration) { requestTimeout = d }(requestTimeout)
+	requestTimeout = 100 * time.Millisecond
+
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+	s, err := New(&Config{Listen: ":0", Database: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/v1/alerts/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// An alert fired after the timeout still reaches the stream
+	time.Sleep(3 * requestTimeout)
+	postAlert(t, s)
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "event: "+api.EventAlert) {
+			return
+		}
+	}
+	t.Fatalf("expected the stream to stay open past the request timeout: %v", scanner.Err())
+}
+
+func TestServer_InvalidAPIKeys(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+	_, err := New(&Config{Listen: ":0", Database: dsn, APIKeys: []api.APIKey{
+		{Name: "dashboard", Key: "k", Scopes: []string{"admin"}},
+	}})
+	if err == nil {
+		t.Fatal("expected an error for an unknown scope")
+	}
+}
+
+func TestServer_InvalidWebhookRateLimit(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+	_, err := New(&Config{Listen: ":0", Database: dsn, WebhookRateLimit: 10, WebhookRateLimitBy: "user"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown rate limit key")
+	}
+}
+
+func TestServer_UnknownUserChannel(t *testing.T) {
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "oncall.db")
+	for _, cfg := range []*Config{
+		{Listen: ":0", Database: dsn, DefaultUserChannel: "email"},
+		{Listen: ":0", Database: dsn, UserChannels: map[string]string{"alice": "sms"}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("expected an error for unregistered channels in %+v", cfg)
+		}
+	}
+
+	s, err := New(&Config{Listen: ":0", Database: dsn, DefaultUserChannel: "webhook",
+		UserChannels: map[string]string{"alice": "slack"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.dispatcher.Close()
+	s.stopPool()
+	s.store.Close()
+}
+
+func TestServer_RunClosesStore(t *testing.T) {
+	for name, listen := range map[string]string{
+		"shutdown":      "127.0.0.1:0",
+		"listen failed": "127.0.0.1:-1",
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, _ := newTestConfig(t, "webhook:http://localhost")
+			cfg.Listen = listen
+			s, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- s.Run(ctx) }()
+			if name == "shutdown" {
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}
+			defer cancel()
+
+			select {
+			case err := <-done:
+				if (err != nil) != (name == "listen failed") {
+					t.Errorf("unexpected error %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected Run to return")
+			}
+			if err := s.store.DB().Ping(); err == nil {
+				t.Error("expected the store to be closed")
+			}
+		})
+	}
+}
+
+// countingNotifier counts the sends it gets
+type countingNotifier struct{ sends int }
+
+func (n *countingNotifier) Channel() string { return "counting" }
+
+func (n *countingNotifier) Send(ctx context.Context, alert *models.AlertGroup, recipient string) error {
+	n.sends++
+	return nil
+}
+
+func TestNewManager_NotifyDedupWindow(t *testing.T) {
+	alert := &models.AlertGroup{Fingerprint: "abc", Status: "firing"}
+	for window, want := range map[time.Duration]int{0: 2, time.Minute: 1} {
+		manager, err := newManager(&Config{NotifyDedupWindow: window})
+		if err != nil {
+			t.Fatal(err)
+		}
+		counting := &countingNotifier{}
+		manager.Register(counting)
+
+		for i := 0; i < 2; i++ {
+			if err := manager.Send(context.Background(), "counting", alert, "ops"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if counting.sends != want {
+			t.Errorf("window %s: expected %d sends, got %d", window, want, counting.sends)
+		}
+	}
+}
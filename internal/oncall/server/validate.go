@@ -0,0 +1,56 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vjranagit/grafana/internal/oncall/api"
+	"github.com/vjranagit/grafana/internal/oncall/store"
+)
+
+// Validate checks cfg the way New would, without opening the database or
+// starting anything, and returns every problem it finds joined into one
+// error. Checks that need the database, such as whether the default
+// escalation chain exists, are left to New.
+func Validate(cfg *Config) error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(cfg.Listen); err != nil {
+		errs = append(errs, fmt.Errorf("invalid listen address %q: %w", cfg.Listen, err))
+	}
+	if err := store.ValidateDSN(cfg.Database); err != nil {
+		errs = append(errs, fmt.Errorf("invalid database: %w", err))
+	}
+	if _, err := api.NewLabelFilter(cfg.AllowLabels, cfg.DenyLabels); err != nil {
+		errs = append(errs, err)
+	}
+	if len(cfg.APIKeys) > 0 {
+		if _, err := api.RequireAPIKey(cfg.APIKeys); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.WebhookRateLimit > 0 {
+		by := cfg.WebhookRateLimitBy
+		if by == "" {
+			by = api.RateLimitByIP
+		}
+		if _, err := api.NewRateLimiter(cfg.WebhookRateLimit, cfg.WebhookRateBurst, by); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	manager, err := newManager(cfg)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for i, route := range cfg.Routes {
+		for _, target := range route.Targets {
+			if _, ok := manager.Notifier(target.Channel); !ok {
+				errs = append(errs, fmt.Errorf("route %d: target %s uses unknown channel %q", i+1, target, target.Channel))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
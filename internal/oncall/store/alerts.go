@@ -0,0 +1,473 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// ErrAlertResolved is returned when acting on an alert that has already
+// resolved
+var ErrAlertResolved = errors.New("alert is already resolved")
+
+// querier is the part of *sql.DB and *sql.Tx the repositories use
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// AlertRepository reads and updates stored alert groups, returning them
+// with their JSON columns decoded
+type AlertRepository struct {
+	db querier
+}
+
+// Alerts returns the store's alert repository
+func (s *Store) Alerts() *AlertRepository {
+	return &AlertRepository{db: s.db}
+}
+
+// WithTx returns a repository that runs its queries in tx
+func (r *AlertRepository) WithTx(tx *sql.Tx) *AlertRepository {
+	return &AlertRepository{db: tx}
+}
+
+// alertColumns lists the alert_groups columns read by scanAlert
+const alertColumns = `id, fingerprint, status, severity, summary, description, labels, annotations, images, sources,
+	escalation_chain_id, acknowledged_by, acknowledged_at, resolved_at, starts_at, ends_at, firing_count, notified_at, created_at, updated_at`
+
+// GetByID loads an alert, returning sql.ErrNoRows if it doesn't exist
+func (r *AlertRepository) GetByID(ctx context.Context, id int64) (*models.AlertGroup, error) {
+	return scanAlert(r.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alert_groups WHERE id = ?`, id))
+}
+
+// GetByFingerprint loads the alert with fingerprint, returning
+// sql.ErrNoRows if there is none
+func (r *AlertRepository) GetByFingerprint(ctx context.Context, fingerprint string) (*models.AlertGroup, error) {
+	return scanAlert(r.db.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alert_groups WHERE fingerprint = ?`, fingerprint))
+}
+
+// Orders for AlertFilter.SortBy
+const (
+	// AlertSortUpdated lists the most recently updated alerts first, the
+	// default
+	AlertSortUpdated = "updated_at"
+	// AlertSortFiringCount lists the noisiest alerts first
+	AlertSortFiringCount = "firing_count"
+	// AlertSortOldestUpdate lists the least recently updated alerts first
+	AlertSortOldestUpdate = "oldest_update"
+)
+
+// DefaultAlertLimit is how many alerts List returns when the filter sets
+// no limit
+const DefaultAlertLimit = 100
+
+// AlertFilter narrows down List results. The zero value lists the most
+// recently updated alerts.
+type AlertFilter struct {
+	Status string
+	// Unresolved keeps only firing and acknowledged alerts
+	Unresolved     bool
+	Severity       string
+	MinFiringCount int
+	// IDs, if set, keeps only these alerts
+	IDs []int64
+	// StartedFrom and StartedTo, if set, bound starts_at inclusively
+	StartedFrom time.Time
+	StartedTo   time.Time
+	SortBy      string
+	// Limit caps the results at DefaultAlertLimit when zero; negative
+	// returns every match
+	Limit int
+}
+
+// List returns the alerts matching filter
+func (r *AlertRepository) List(ctx context.Context, filter AlertFilter) ([]*models.AlertGroup, error) {
+	var where []string
+	var args []interface{}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Unresolved {
+		where = append(where, "status != 'resolved'")
+	}
+	if len(filter.IDs) > 0 {
+		where = append(where, "id IN ("+placeholders(len(filter.IDs))+")")
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	}
+	if filter.Severity != "" {
+		where = append(where, "severity = ?")
+		args = append(args, filter.Severity)
+	}
+	if filter.MinFiringCount > 0 {
+		where = append(where, "firing_count >= ?")
+		args = append(args, filter.MinFiringCount)
+	}
+	if !filter.StartedFrom.IsZero() {
+		where = append(where, "starts_at >= ?")
+		args = append(args, filter.StartedFrom.UTC())
+	}
+	if !filter.StartedTo.IsZero() {
+		where = append(where, "starts_at <= ?")
+		args = append(args, filter.StartedTo.UTC())
+	}
+
+	query := `SELECT ` + alertColumns + ` FROM alert_groups`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+
+	switch filter.SortBy {
+	case "", AlertSortUpdated:
+		query += ` ORDER BY updated_at DESC`
+	case AlertSortFiringCount:
+		query += ` ORDER BY firing_count DESC, updated_at DESC`
+	case AlertSortOldestUpdate:
+		query += ` ORDER BY updated_at`
+	default:
+		return nil, fmt.Errorf("unknown alert sort %q", filter.SortBy)
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = DefaultAlertLimit
+	}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := []*models.AlertGroup{}
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// CountByStatus returns how many alerts have each status. Statuses without
+// alerts are left out.
+func (r *AlertRepository) CountByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM alert_groups GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count alerts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		counts[status] = n
+	}
+	return counts, rows.Err()
+}
+
+// CountBySeverity returns how many alerts have each severity. Alerts
+// without one are counted under "".
+func (r *AlertRepository) CountBySeverity(ctx context.Context) (map[string]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT COALESCE(severity, ''), COUNT(*) FROM alert_groups GROUP BY COALESCE(severity, '')`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count alerts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var severity string
+		var n int
+		if err := rows.Scan(&severity, &n); err != nil {
+			return nil, err
+		}
+		counts[severity] = n
+	}
+	return counts, rows.Err()
+}
+
+// OldestUnacknowledged returns when the longest-firing unacknowledged alert
+// started, or the zero time if no alert is firing
+func (r *AlertRepository) OldestUnacknowledged(ctx context.Context) (time.Time, error) {
+	var startsAt time.Time
+	err := r.db.QueryRowContext(ctx, `
+		SELECT starts_at FROM alert_groups
+		WHERE status = 'firing' AND starts_at IS NOT NULL
+		ORDER BY starts_at LIMIT 1
+	`).Scan(&startsAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return startsAt, err
+}
+
+// RecordEvent adds alert id's move from one status to another to its
+// history. from is empty for a new alert.
+func (r *AlertRepository) RecordEvent(ctx context.Context, id int64, from, to, actor string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO alert_events (alert_group_id, from_status, to_status, actor, at) VALUES (?, ?, ?, ?, ?)
+	`, id, nullString(from), to, nullString(actor), at.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record alert %d moving to %s: %w", id, to, err)
+	}
+	return nil
+}
+
+// History returns alert id's status changes, oldest first
+func (r *AlertRepository) History(ctx context.Context, id int64) ([]models.AlertEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, alert_group_id, from_status, to_status, actor, at FROM alert_events
+		WHERE alert_group_id = ? ORDER BY at, id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert history: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AlertEvent{}
+	for rows.Next() {
+		var event models.AlertEvent
+		var from, actor sql.NullString
+		if err := rows.Scan(&event.ID, &event.AlertGroupID, &from, &event.ToStatus, &actor, &event.At); err != nil {
+			return nil, err
+		}
+		event.FromStatus = from.String
+		event.Actor = actor.String
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// Transition moves alert id to status on behalf of by, records the change
+// in its history and returns the updated alert:
+//   - acknowledged records by as the acknowledger; acknowledging again
+//     replaces them
+//   - resolved stamps resolved_at; resolving a resolved alert returns it
+//     unchanged
+//   - firing clears the acknowledgement of an acknowledged alert
+//
+// Acknowledging or re-firing a resolved alert returns ErrAlertResolved. A
+// missing alert returns sql.ErrNoRows.
+func (r *AlertRepository) Transition(ctx context.Context, id int64, status, by string) (*models.AlertGroup, error) {
+	alert, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	switch status {
+	case "acknowledged":
+		if alert.Status == "resolved" {
+			return nil, ErrAlertResolved
+		}
+		_, err = r.db.ExecContext(ctx, `
+			UPDATE alert_groups SET status = 'acknowledged', acknowledged_by = ?, acknowledged_at = ?, updated_at = ?
+			WHERE id = ?
+		`, by, now, now, id)
+		alert.AcknowledgedBy = &by
+		alert.AcknowledgedAt = &now
+	case "resolved":
+		if alert.Status == "resolved" {
+			return alert, nil
+		}
+		_, err = r.db.ExecContext(ctx, `UPDATE alert_groups SET status = 'resolved', resolved_at = ?, updated_at = ? WHERE id = ?`,
+			now, now, id)
+		alert.ResolvedAt = &now
+	case "firing":
+		if alert.Status == "resolved" {
+			return nil, ErrAlertResolved
+		}
+		if alert.Status == "firing" {
+			return alert, nil
+		}
+		_, err = r.db.ExecContext(ctx, `
+			UPDATE alert_groups SET status = 'firing', acknowledged_by = NULL, acknowledged_at = NULL, updated_at = ?
+			WHERE id = ?
+		`, now, id)
+		alert.AcknowledgedBy = nil
+		alert.AcknowledgedAt = nil
+	default:
+		return nil, fmt.Errorf("invalid alert status %q", status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to move alert %d to %s: %w", id, status, err)
+	}
+	if alert.Status != status {
+		if err := r.RecordEvent(ctx, id, alert.Status, status, by, now); err != nil {
+			return nil, err
+		}
+	}
+
+	alert.Status = status
+	alert.UpdatedAt = now
+	return alert, nil
+}
+
+// TransitionMany acknowledges or resolves the alerts in ids with a single
+// UPDATE, recording each change in the alerts' history. Acknowledging
+// replaces the acknowledger of alerts that already were, as Transition
+// does. It returns the updated alerts, and the ids that were skipped
+// because they have resolved or don't exist, both in the order of ids.
+// Run it on a repository from WithTx to make the batch atomic with other
+// changes.
+func (r *AlertRepository) TransitionMany(ctx context.Context, ids []int64, status, by string) ([]*models.AlertGroup, []int64, error) {
+	if status != "acknowledged" && status != "resolved" {
+		return nil, nil, fmt.Errorf("invalid bulk alert status %q", status)
+	}
+	if len(ids) == 0 {
+		return nil, nil, nil
+	}
+
+	found, err := r.List(ctx, AlertFilter{IDs: ids, Unresolved: true, Limit: -1})
+	if err != nil {
+		return nil, nil, err
+	}
+	active := make(map[int64]*models.AlertGroup, len(found))
+	for _, alert := range found {
+		active[alert.ID] = alert
+	}
+
+	var updated []*models.AlertGroup
+	var skipped []int64
+	args := []interface{}{}
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		alert, ok := active[id]
+		if !ok {
+			skipped = append(skipped, id)
+			continue
+		}
+		updated = append(updated, alert)
+		args = append(args, id)
+	}
+	if len(updated) == 0 {
+		return nil, skipped, nil
+	}
+
+	now := time.Now().UTC()
+	var query string
+	if status == "acknowledged" {
+		query = `UPDATE alert_groups SET status = 'acknowledged', acknowledged_by = ?, acknowledged_at = ?, updated_at = ?`
+		args = append([]interface{}{by, now, now}, args...)
+	} else {
+		query = `UPDATE alert_groups SET status = 'resolved', resolved_at = ?, updated_at = ?`
+		args = append([]interface{}{now, now}, args...)
+	}
+	query += ` WHERE status != 'resolved' AND id IN (` + placeholders(len(updated)) + `)`
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return nil, nil, fmt.Errorf("failed to move %d alerts to %s: %w", len(updated), status, err)
+	}
+
+	for _, alert := range updated {
+		if alert.Status != status {
+			if err := r.RecordEvent(ctx, alert.ID, alert.Status, status, by, now); err != nil {
+				return nil, nil, err
+			}
+		}
+		if status == "acknowledged" {
+			alert.AcknowledgedBy = &by
+			alert.AcknowledgedAt = &now
+		} else {
+			alert.ResolvedAt = &now
+		}
+		alert.Status = status
+		alert.UpdatedAt = now
+	}
+	return updated, skipped, nil
+}
+
+// placeholders returns n comma-separated ? placeholders for an IN list
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func scanAlert(row interface{ Scan(...interface{}) error }) (*models.AlertGroup, error) {
+	var (
+		alert                   models.AlertGroup
+		severity, summary, desc sql.NullString
+		labels, annotations     []byte
+		images, sources         []byte
+		escalationChainID       sql.NullInt64
+		acknowledgedBy          sql.NullString
+		acknowledgedAt          sql.NullTime
+		resolvedAt              sql.NullTime
+		startsAt, endsAt        sql.NullTime
+		notifiedAt              sql.NullTime
+	)
+	if err := row.Scan(&alert.ID, &alert.Fingerprint, &alert.Status, &severity, &summary, &desc,
+		&labels, &annotations, &images, &sources, &escalationChainID, &acknowledgedBy, &acknowledgedAt, &resolvedAt, &startsAt, &endsAt,
+		&alert.FiringCount, &notifiedAt, &alert.CreatedAt, &alert.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	alert.Severity = severity.String
+	alert.Summary = summary.String
+	alert.Description = desc.String
+	alert.StartsAt = startsAt.Time
+	if escalationChainID.Valid {
+		alert.EscalationChainID = &escalationChainID.Int64
+	}
+	if acknowledgedBy.Valid {
+		alert.AcknowledgedBy = &acknowledgedBy.String
+	}
+	if acknowledgedAt.Valid {
+		alert.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if resolvedAt.Valid {
+		alert.ResolvedAt = &resolvedAt.Time
+	}
+	if endsAt.Valid {
+		alert.EndsAt = &endsAt.Time
+	}
+	if notifiedAt.Valid {
+		alert.NotifiedAt = &notifiedAt.Time
+	}
+
+	for _, field := range []struct {
+		name string
+		raw  []byte
+		dest interface{}
+	}{
+		{"labels", labels, &alert.Labels},
+		{"annotations", annotations, &alert.Annotations},
+		{"images", images, &alert.Images},
+		{"sources", sources, &alert.Sources},
+	} {
+		if len(field.raw) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(field.raw, field.dest); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", field.name, err)
+		}
+	}
+
+	return &alert, nil
+}
@@ -0,0 +1,316 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// insertAlert stores an alert the way ingestion does, with JSON columns
+func insertAlert(t *testing.T, st *Store, alert models.AlertGroup) int64 {
+	t.Helper()
+	labels, _ := json.Marshal(alert.Labels)
+	annotations, _ := json.Marshal(alert.Annotations)
+	if alert.UpdatedAt.IsZero() {
+		alert.UpdatedAt = alert.StartsAt
+	}
+	var id int64
+	err := st.DB().QueryRow(`
+		INSERT INTO alert_groups (fingerprint, status, severity, summary, labels, annotations, starts_at, firing_count, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, alert.Fingerprint, alert.Status, alert.Severity, alert.Summary, labels, annotations,
+		alert.StartsAt, alert.FiringCount, alert.UpdatedAt, alert.UpdatedAt).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func newAlertTestStore(t *testing.T) *Store {
+	t.Helper()
+	st, err := New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestAlertRepository_GetRoundTripsJSON(t *testing.T) {
+	st := newAlertTestStore(t)
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	labels := map[string]string{"alertname": "HighCPU", "instance": "db-1", "team": "storage"}
+	annotations := map[string]string{"runbook": "https://runbooks/cpu"}
+	id := insertAlert(t, st, models.AlertGroup{Fingerprint: "fp-1", Status: "firing", Severity: "critical",
+		Summary: "CPU high", Labels: labels, Annotations: annotations, StartsAt: start, FiringCount: 2})
+
+	alerts := st.Alerts()
+	got, err := alerts.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Labels, labels) || !reflect.DeepEqual(got.Annotations, annotations) {
+		t.Errorf("expected labels and annotations decoded, got %v and %v", got.Labels, got.Annotations)
+	}
+	if got.Fingerprint != "fp-1" || got.Severity != "critical" || got.FiringCount != 2 || !got.StartsAt.Equal(start) {
+		t.Errorf("unexpected alert %+v", got)
+	}
+
+	byFingerprint, err := alerts.GetByFingerprint(ctx, "fp-1")
+	if err != nil || byFingerprint.ID != id {
+		t.Errorf("expected fingerprint lookup to find alert %d, got %+v (%v)", id, byFingerprint, err)
+	}
+
+	if _, err := alerts.GetByID(ctx, id+100); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing ID, got %v", err)
+	}
+	if _, err := alerts.GetByFingerprint(ctx, "nope"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing fingerprint, got %v", err)
+	}
+}
+
+func TestAlertRepository_List(t *testing.T) {
+	st := newAlertTestStore(t)
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, a := range []models.AlertGroup{
+		{Fingerprint: "a", Status: "firing", Severity: "critical", FiringCount: 1},
+		{Fingerprint: "b", Status: "acknowledged", Severity: "warning", FiringCount: 5},
+		{Fingerprint: "c", Status: "resolved", Severity: "critical", FiringCount: 3},
+		{Fingerprint: "d", Status: "firing", Severity: "warning", FiringCount: 2},
+	} {
+		a.StartsAt = start.Add(time.Duration(i) * time.Hour)
+		insertAlert(t, st, a)
+	}
+
+	fingerprints := func(alerts []*models.AlertGroup) []string {
+		out := []string{}
+		for _, a := range alerts {
+			out = append(out, a.Fingerprint)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		filter AlertFilter
+		want   []string
+	}{
+		{"default newest first", AlertFilter{}, []string{"d", "c", "b", "a"}},
+		{"status", AlertFilter{Status: "firing"}, []string{"d", "a"}},
+		{"unresolved", AlertFilter{Unresolved: true, SortBy: AlertSortOldestUpdate}, []string{"a", "b", "d"}},
+		{"severity", AlertFilter{Severity: "critical"}, []string{"c", "a"}},
+		{"min firing count", AlertFilter{MinFiringCount: 3, SortBy: AlertSortFiringCount}, []string{"b", "c"}},
+		{"started window", AlertFilter{StartedFrom: start.Add(time.Hour), StartedTo: start.Add(2 * time.Hour)}, []string{"c", "b"}},
+		{"limit", AlertFilter{Limit: 2}, []string{"d", "c"}},
+		{"unlimited", AlertFilter{Limit: -1, SortBy: AlertSortOldestUpdate}, []string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts, err := st.Alerts().List(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fingerprints(alerts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := st.Alerts().List(ctx, AlertFilter{SortBy: "bogus"}); err == nil {
+		t.Error("expected an error for an unknown sort")
+	}
+}
+
+func TestAlertRepository_CountByStatus(t *testing.T) {
+	st := newAlertTestStore(t)
+	ctx := context.Background()
+
+	if counts, err := st.Alerts().CountByStatus(ctx); err != nil || len(counts) != 0 {
+		t.Fatalf("expected no counts for an empty store, got %v (%v)", counts, err)
+	}
+
+	for i, status := range []string{"firing", "firing", "acknowledged", "resolved", "firing"} {
+		insertAlert(t, st, models.AlertGroup{Fingerprint: string(rune('a' + i)), Status: status, StartsAt: time.Now()})
+	}
+	counts, err := st.Alerts().CountByStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"firing": 3, "acknowledged": 1, "resolved": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("expected %v, got %v", want, counts)
+	}
+}
+
+func TestAlertRepository_Transition(t *testing.T) {
+	st := newAlertTestStore(t)
+	ctx := context.Background()
+	alerts := st.Alerts()
+	labels := map[string]string{"alertname": "Disk"}
+	id := insertAlert(t, st, models.AlertGroup{Fingerprint: "fp", Status: "firing", Labels: labels, StartsAt: time.Now()})
+
+	acked, err := alerts.Transition(ctx, id, "acknowledged", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acked.Status != "acknowledged" || acked.AcknowledgedBy == nil || *acked.AcknowledgedBy != "alice" || acked.AcknowledgedAt == nil {
+		t.Errorf("unexpected acknowledged alert %+v", acked)
+	}
+	stored, err := alerts.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "acknowledged" || *stored.AcknowledgedBy != "alice" || !reflect.DeepEqual(stored.Labels, labels) {
+		t.Errorf("expected the ack stored, got %+v", stored)
+	}
+
+	// Back to firing drops the acknowledgement
+	fired, err := alerts.Transition(ctx, id, "firing", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := alerts.GetByID(ctx, id); fired.Status != "firing" || stored.AcknowledgedBy != nil || stored.AcknowledgedAt != nil {
+		t.Errorf("expected the ack cleared, got %+v", stored)
+	}
+
+	resolved, err := alerts.Transition(ctx, id, "resolved", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Status != "resolved" || resolved.ResolvedAt == nil {
+		t.Errorf("unexpected resolved alert %+v", resolved)
+	}
+	again, err := alerts.Transition(ctx, id, "resolved", "carol")
+	if err != nil || !again.ResolvedAt.Equal(*resolved.ResolvedAt) {
+		t.Errorf("expected resolving twice to leave the alert unchanged, got %+v (%v)", again, err)
+	}
+
+	if _, err := alerts.Transition(ctx, id, "acknowledged", "alice"); !errors.Is(err, ErrAlertResolved) {
+		t.Errorf("expected ErrAlertResolved acknowledging a resolved alert, got %v", err)
+	}
+	if _, err := alerts.Transition(ctx, id, "firing", "alice"); !errors.Is(err, ErrAlertResolved) {
+		t.Errorf("expected ErrAlertResolved re-firing a resolved alert, got %v", err)
+	}
+	if _, err := alerts.Transition(ctx, id, "snoozed", "alice"); err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+	if _, err := alerts.Transition(ctx, id+100, "resolved", "alice"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing alert, got %v", err)
+	}
+}
+
+func TestAlertRepository_TransitionMany(t *testing.T) {
+	st := newAlertTestStore(t)
+	ctx := context.Background()
+	alerts := st.Alerts()
+	now := time.Now()
+	a := insertAlert(t, st, models.AlertGroup{Fingerprint: "a", Status: "firing", StartsAt: now})
+	b := insertAlert(t, st, models.AlertGroup{Fingerprint: "b", Status: "acknowledged", StartsAt: now})
+	c := insertAlert(t, st, models.AlertGroup{Fingerprint: "c", Status: "resolved", StartsAt: now})
+	untouched := insertAlert(t, st, models.AlertGroup{Fingerprint: "d", Status: "firing", StartsAt: now})
+
+	acked, skipped, err := alerts.TransitionMany(ctx, []int64{a, b, c, a, 999}, "acknowledged", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acked) != 2 || acked[0].ID != a || acked[1].ID != b {
+		t.Fatalf("expected alerts %d and %d acknowledged, got %+v", a, b, acked)
+	}
+	if !reflect.DeepEqual(skipped, []int64{c, 999}) {
+		t.Errorf("expected the resolved and missing alerts skipped, got %v", skipped)
+	}
+	for _, id := range []int64{a, b} {
+		stored, _ := alerts.GetByID(ctx, id)
+		if stored.Status != "acknowledged" || stored.AcknowledgedBy == nil || *stored.AcknowledgedBy != "alice" {
+			t.Errorf("expected alert %d acknowledged by alice, got %+v", id, stored)
+		}
+	}
+	if stored, _ := alerts.GetByID(ctx, untouched); stored.Status != "firing" {
+		t.Errorf("expected an alert not listed to stay firing, got %s", stored.Status)
+	}
+	// Only the alert that changed status gains a history entry
+	if history, _ := alerts.History(ctx, a); len(history) != 1 || history[0].Actor != "alice" {
+		t.Errorf("expected one history entry for %d, got %+v", a, history)
+	}
+	if history, _ := alerts.History(ctx, b); len(history) != 0 {
+		t.Errorf("expected no history entry re-acknowledging %d, got %+v", b, history)
+	}
+
+	resolved, skipped, err := alerts.TransitionMany(ctx, []int64{a, c}, "resolved", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resolved) != 1 || resolved[0].ResolvedAt == nil || !reflect.DeepEqual(skipped, []int64{c}) {
+		t.Errorf("expected only %d resolved, got %+v skipped %v", a, resolved, skipped)
+	}
+
+	if _, _, err := alerts.TransitionMany(ctx, []int64{a}, "firing", "bob"); err == nil {
+		t.Error("expected an error for a status bulk changes don't support")
+	}
+}
+
+func TestAlertRepository_History(t *testing.T) {
+	st := newAlertTestStore(t)
+	ctx := context.Background()
+	alerts := st.Alerts()
+	id := insertAlert(t, st, models.AlertGroup{Fingerprint: "fp", Status: "firing", StartsAt: time.Now()})
+
+	for _, step := range []struct{ status, by string }{
+		{"acknowledged", "alice"},
+		{"acknowledged", "bob"}, // same status, not a transition
+		{"resolved", "bob"},
+		{"resolved", "carol"},
+	} {
+		if _, err := alerts.Transition(ctx, id, step.status, step.by); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := alerts.History(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		got = append(got, e.FromStatus+">"+e.ToStatus+" by "+e.Actor)
+	}
+	want := []string{"firing>acknowledged by alice", "acknowledged>resolved by bob"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if events, err := alerts.History(ctx, id+100); err != nil || len(events) != 0 {
+		t.Errorf("expected no history for a missing alert, got %v (%v)", events, err)
+	}
+}
+
+func TestAlertRepository_WithTx(t *testing.T) {
+	st := newAlertTestStore(t)
+	ctx := context.Background()
+	id := insertAlert(t, st, models.AlertGroup{Fingerprint: "fp", Status: "firing", StartsAt: time.Now()})
+
+	tx, err := st.DB().BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Alerts().WithTx(tx).Transition(ctx, id, "acknowledged", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored, err := st.Alerts().GetByID(ctx, id); err != nil || stored.Status != "firing" {
+		t.Errorf("expected a rolled back transition to leave the alert firing, got %+v (%v)", stored, err)
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Connection settings applied to SQLite DSNs that don't set their own. WAL
+// lets readers carry on while a webhook burst writes, and the busy timeout
+// makes a writer wait for the lock instead of failing at once.
+const (
+	DefaultSQLiteBusyTimeout = 5 * time.Second
+	DefaultSQLiteJournalMode = "WAL"
+)
+
+// sqliteDSN returns dsn with the default busy timeout and journal mode
+// added where it sets neither, under any of the names go-sqlite3 accepts.
+// In-memory databases keep their journal mode.
+func sqliteDSN(dsn string) string {
+	path, rawQuery, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Leave DSNs we can't read for the driver to report
+		return dsn
+	}
+
+	var add []string
+	if !params.Has("_busy_timeout") && !params.Has("_timeout") {
+		add = append(add, "_busy_timeout="+strconv.FormatInt(DefaultSQLiteBusyTimeout.Milliseconds(), 10))
+	}
+	inMemory := path == ":memory:" || params.Get("mode") == "memory"
+	if !inMemory && !params.Has("_journal_mode") && !params.Has("_journal") {
+		add = append(add, "_journal_mode="+DefaultSQLiteJournalMode)
+	}
+	if len(add) == 0 {
+		return dsn
+	}
+	if rawQuery == "" {
+		return path + "?" + strings.Join(add, "&")
+	}
+	return dsn + "&" + strings.Join(add, "&")
+}
+
+// Limits on RetryBusy
+const (
+	busyAttempts = 5
+	busyBackoff  = 50 * time.Millisecond
+)
+
+// IsBusy reports whether err is SQLite giving up on a lock: the database
+// busy or a table locked after the busy timeout
+func IsBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
+
+// RetryBusy runs write, and runs it again with growing pauses while it
+// fails because SQLite is busy, until it succeeds, fails otherwise, runs
+// out of attempts or ctx is done. write must be safe to repeat: a single
+// statement, or a whole transaction it begins and commits itself.
+func RetryBusy(ctx context.Context, write func() error) error {
+	delay := busyBackoff
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if err == nil || !IsBusy(err) || attempt == busyAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := map[string]string{
+		"oncall.db":                                 "oncall.db?_busy_timeout=5000&_journal_mode=WAL",
+		"oncall.db?_journal_mode=DELETE":            "oncall.db?_journal_mode=DELETE&_busy_timeout=5000",
+		"oncall.db?_timeout=100&_journal=WAL":       "oncall.db?_timeout=100&_journal=WAL",
+		":memory:":                                  ":memory:?_busy_timeout=5000",
+		"file:test?mode=memory&cache=shared":        "file:test?mode=memory&cache=shared&_busy_timeout=5000",
+		"oncall.db?_busy_timeout=1&_foreign_keys=1": "oncall.db?_busy_timeout=1&_foreign_keys=1&_journal_mode=WAL",
+	}
+	for in, want := range tests {
+		if got := sqliteDSN(in); got != want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNew_SQLiteDefaults(t *testing.T) {
+	st, err := New("sqlite://" + filepath.Join(t.TempDir(), "oncall.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	var mode string
+	var timeout int
+	st.DB().QueryRow(`PRAGMA journal_mode`).Scan(&mode)
+	st.DB().QueryRow(`PRAGMA busy_timeout`).Scan(&timeout)
+	if mode != "wal" || timeout != 5000 {
+		t.Errorf("expected WAL with a 5s busy timeout, got %s and %dms", mode, timeout)
+	}
+	if max := st.DB().Stats().MaxOpenConnections; max != 1 {
+		t.Errorf("expected writers serialized on one connection, got %d", max)
+	}
+}
+
+func TestRetryBusy(t *testing.T) {
+	busy := fmt.Errorf("failed to store alert: %w", sqlite3.Error{Code: sqlite3.ErrBusy})
+	if !IsBusy(busy) || !IsBusy(sqlite3.Error{Code: sqlite3.ErrLocked}) || IsBusy(errors.New("disk I/O error")) {
+		t.Fatal("IsBusy misclassifies errors")
+	}
+
+	calls := 0
+	err := RetryBusy(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return busy
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success on the third attempt, got %v after %d", err, calls)
+	}
+
+	calls = 0
+	other := errors.New("constraint failed")
+	if err := RetryBusy(context.Background(), func() error { calls++; return other }); err != other || calls != 1 {
+		t.Errorf("expected other errors returned at once, got %v after %d attempts", err, calls)
+	}
+
+	calls = 0
+	if err := RetryBusy(context.Background(), func() error { calls++; return busy }); !IsBusy(err) || calls != busyAttempts {
+		t.Errorf("expected to give up after %d attempts, got %v after %d", busyAttempts, err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	if err := RetryBusy(ctx, func() error { calls++; return busy }); !IsBusy(err) || calls != 1 {
+		t.Errorf("expected a done context to stop retrying, got %v after %d attempts", err, calls)
+	}
+}
@@ -0,0 +1,21 @@
+package store
+
+import "context"
+
+// MaxDeadLetterPayload caps how much of a rejected payload is kept
+const MaxDeadLetterPayload = 4096
+
+// InsertDeadLetter records a payload that could not be processed so
+// misconfigured senders can be diagnosed later. Payloads longer than
+// MaxDeadLetterPayload are truncated.
+func (s *Store) InsertDeadLetter(ctx context.Context, source string, payload []byte, reason string) error {
+	if len(payload) > MaxDeadLetterPayload {
+		payload = payload[:MaxDeadLetterPayload]
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO dead_letter (source, payload, error)
+		VALUES (?, ?, ?)
+	`, source, string(payload), reason)
+	return err
+}
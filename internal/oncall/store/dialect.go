@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+
+	// Registers the "pgx" driver for postgres:// DSNs
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// dialect covers what differs between the databases the store runs on.
+// Queries are written for SQLite with ? placeholders; dialects adapt them.
+type dialect interface {
+	// open connects to the database named by dsn, with the scheme removed
+	// for SQLite
+	open(dsn string) (*sql.DB, error)
+	// schema rewrites SQLite DDL for the database
+	schema(ddl string) string
+	// tablesQuery lists the names of the tables in the current schema
+	tablesQuery() string
+	// lockMigrations, if not empty, is run at the start of each migration
+	// transaction to keep concurrent starts from applying a step twice
+	lockMigrations() string
+	// checkpoint flushes write-ahead state to the database file, if the
+	// database has any to flush
+	checkpoint(db *sql.DB) error
+}
+
+// parseDSN picks the dialect for dsn by its scheme. A DSN without one is a
+// SQLite file path.
+func parseDSN(dsn string) (dialect, string, error) {
+	scheme, rest, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return sqliteDialect{}, dsn, nil
+	}
+	switch scheme {
+	case "sqlite":
+		return sqliteDialect{}, rest, nil
+	case "postgres", "postgresql":
+		return postgresDialect{}, dsn, nil
+	}
+	return nil, "", fmt.Errorf("unsupported database scheme %q (want sqlite or postgres)", scheme)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", sqliteDSN(dsn))
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers, which SQLite allows only one of
+	// at a time anyway, so they queue in Go rather than contend for the
+	// file lock
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func (sqliteDialect) schema(ddl string) string {
+	return ddl
+}
+
+func (sqliteDialect) tablesQuery() string {
+	return `SELECT name FROM sqlite_master WHERE type = 'table'`
+}
+
+func (sqliteDialect) lockMigrations() string {
+	// SQLite allows one writer at a time already
+	return ""
+}
+
+func (sqliteDialect) checkpoint(db *sql.DB) error {
+	_, err := db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+// postgresDrivers are the database/sql driver names tried for Postgres.
+// pgx is always registered; a binary that also imports github.com/lib/pq
+// still gets pgx.
+var postgresDrivers = []string{"pgx", "postgres"}
+
+type postgresDialect struct{}
+
+var postgresSchema = strings.NewReplacer(
+	"INTEGER PRIMARY KEY AUTOINCREMENT", "BIGSERIAL PRIMARY KEY",
+	"DATETIME", "TIMESTAMPTZ",
+)
+
+func (postgresDialect) open(dsn string) (*sql.DB, error) {
+	registered := make(map[string]bool)
+	for _, name := range sql.Drivers() {
+		registered[name] = true
+	}
+	for _, name := range postgresDrivers {
+		if registered[name] {
+			return openRebound(name, dsn, rebindDollar)
+		}
+	}
+	return nil, fmt.Errorf("no postgres driver is registered (want one of %s)",
+		strings.Join(postgresDrivers, ", "))
+}
+
+func (postgresDialect) schema(ddl string) string {
+	return postgresSchema.Replace(ddl)
+}
+
+func (postgresDialect) tablesQuery() string {
+	return `SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema()`
+}
+
+func (postgresDialect) lockMigrations() string {
+	return `LOCK TABLE schema_migrations IN SHARE ROW EXCLUSIVE MODE`
+}
+
+func (postgresDialect) checkpoint(*sql.DB) error {
+	return nil
+}
+
+// rebindDollar rewrites ? placeholders outside quotes as $1, $2, ...
+func rebindDollar(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	var quote rune
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// openRebound opens dsn with the named driver, rewriting every query with
+// rebind on its way to the driver. This keeps queries, including those run
+// through Store.DB, in one placeholder style.
+func openRebound(driverName, dsn string, rebind func(string) string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	var connector driver.Connector = dsnConnector{dsn: dsn, driver: d}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(reboundConnector{Connector: connector, rebind: rebind}), nil
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type reboundConnector struct {
+	driver.Connector
+	rebind func(string) string
+}
+
+func (c reboundConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &reboundConn{Conn: conn, rebind: c.rebind}, nil
+}
+
+// reboundConn rewrites queries before passing them to Conn. Optional
+// interfaces the wrapped connection lacks fall back to what database/sql
+// would do without them.
+type reboundConn struct {
+	driver.Conn
+	rebind func(string) string
+}
+
+func (c *reboundConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(c.rebind(query))
+}
+
+func (c *reboundConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, c.rebind(query))
+	}
+	return c.Conn.Prepare(c.rebind(query))
+}
+
+func (c *reboundConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, c.rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *reboundConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, c.rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *reboundConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	if opts.ReadOnly || opts.Isolation != 0 {
+		return nil, fmt.Errorf("driver does not support transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *reboundConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *reboundConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *reboundConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *reboundConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if ch, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return ch.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		dialect dialect
+		want    string
+	}{
+		{"sqlite://oncall.db", sqliteDialect{}, "oncall.db"},
+		{"sqlite://file:x?mode=memory", sqliteDialect{}, "file:x?mode=memory"},
+		{"/var/lib/oncall.db", sqliteDialect{}, "/var/lib/oncall.db"},
+		{"postgres://u:p@db:5432/oncall", postgresDialect{}, "postgres://u:p@db:5432/oncall"},
+		{"postgresql://db/oncall?sslmode=disable", postgresDialect{}, "postgresql://db/oncall?sslmode=disable"},
+	}
+	for _, tt := range tests {
+		d, dsn, err := parseDSN(tt.dsn)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.dsn, err)
+			continue
+		}
+		if d != tt.dialect || dsn != tt.want {
+			t.Errorf("%s: expected %T %q, got %T %q", tt.dsn, tt.dialect, tt.want, d, dsn)
+		}
+	}
+
+	if _, _, err := parseDSN("mysql://db/oncall"); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
+
+func TestRebindDollar(t *testing.T) {
+	tests := map[string]string{
+		`SELECT 1`:                                     `SELECT 1`,
+		`SELECT id FROM t WHERE a = ? AND b = ?`:       `SELECT id FROM t WHERE a = $1 AND b = $2`,
+		`UPDATE t SET a = '?' WHERE b = ? AND c = "?"`: `UPDATE t SET a = '?' WHERE b = $1 AND c = "?"`,
+		`SELECT 'it''s ?', ?`:                          `SELECT 'it''s ?', $1`,
+	}
+	for query, want := range tests {
+		if got := rebindDollar(query); got != want {
+			t.Errorf("rebindDollar(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestPostgresDialect_Schema(t *testing.T) {
+	ddl := postgresDialect{}.schema(`CREATE TABLE t (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if strings.Contains(ddl, "AUTOINCREMENT") || strings.Contains(ddl, "DATETIME") {
+		t.Errorf("expected SQLite types rewritten, got %s", ddl)
+	}
+	if !strings.Contains(ddl, "id BIGSERIAL PRIMARY KEY") || !strings.Contains(ddl, "created_at TIMESTAMPTZ") {
+		t.Errorf("expected Postgres types, got %s", ddl)
+	}
+}
+
+// TestPostgresDialect_Driver checks the store registers its own Postgres
+// driver, so a postgres:// DSN gets as far as dialing the server
+func TestPostgresDialect_Driver(t *testing.T) {
+	_, err := New("postgres://oncall@127.0.0.1:1/oncall?connect_timeout=1")
+	if err == nil {
+		t.Fatal("expected a connection error")
+	}
+	if strings.Contains(err.Error(), "no postgres driver") {
+		t.Errorf("expected the pgx driver to be registered, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "failed to ping database") {
+		t.Errorf("expected a ping error, got %v", err)
+	}
+}
+
+// TestOpenRebound runs $n-style queries through SQLite, which accepts both
+// placeholder styles, to check the rewrite reaches every query path
+func TestOpenRebound(t *testing.T) {
+	db, err := openRebound("sqlite3", filepath.Join(t.TempDir(), "rebound.db"), rebindDollar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	if _, err := db.Exec(`CREATE TABLE t (a TEXT, b INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO t (a, b) VALUES (?, ?)`, "x", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, err := db.PrepareContext(ctx, `INSERT INTO t (a, b) VALUES (?, ?)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stmt.Exec("y", 2); err != nil {
+		t.Fatal(err)
+	}
+	stmt.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO t (a, b) VALUES (?, ?)`, "z", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var a string
+	if err := db.QueryRow(`SELECT a FROM t WHERE b = ? AND a != ?`, 2, "?").Scan(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a != "y" {
+		t.Errorf("expected y, got %q", a)
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM t`).Scan(&count); err != nil || count != 3 {
+		t.Errorf("expected 3 rows, got %d (%v)", count, err)
+	}
+}
+
+// testDSNs returns the databases to run backend tests against: SQLite
+// always, and Postgres when POSTGRES_DSN is set
+func testDSNs(t *testing.T) map[string]string {
+	dsns := map[string]string{
+		"sqlite": "sqlite://" + filepath.Join(t.TempDir(), "oncall.db"),
+	}
+	if dsn := os.Getenv("POSTGRES_DSN"); dsn != "" {
+		dsns["postgres"] = dsn
+	}
+	return dsns
+}
+
+func TestStore_Backends(t *testing.T) {
+	for name, dsn := range testDSNs(t) {
+		t.Run(name, func(t *testing.T) {
+			st, err := New(dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer st.Close()
+			ctx := context.Background()
+
+			if missing, err := st.MissingTables(ctx); err != nil || len(missing) != 0 {
+				t.Fatalf("expected a fully migrated schema, got %v (%v)", missing, err)
+			}
+
+			start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+			schedule := &models.Schedule{Name: t.Name(), Timezone: "UTC", Layers: []models.Layer{
+				{Name: "Primary", RotationType: "weekly", RotationStart: start, DurationHours: 168, Users: []string{"alice"}},
+			}}
+			if err := st.CreateSchedule(ctx, schedule); err != nil {
+				t.Fatal(err)
+			}
+			got, err := st.GetSchedule(ctx, schedule.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Layers) != 1 || !got.Layers[0].RotationStart.Equal(start) {
+				t.Errorf("unexpected schedule %+v", got)
+			}
+
+			override := &models.Override{ScheduleID: schedule.ID, User: "bob", Start: start, End: start.Add(time.Hour)}
+			if err := st.CreateOverride(ctx, override); err != nil {
+				t.Fatal(err)
+			}
+			if overrides, err := st.ListOverrides(ctx, schedule.ID); err != nil || len(overrides) != 1 || overrides[0].User != "bob" {
+				t.Errorf("expected bob's override, got %+v (%v)", overrides, err)
+			}
+
+			chain := &models.EscalationChain{Name: t.Name(), Policies: []models.EscalationPolicy{
+				{StepNumber: 1, PolicyType: models.PolicyNotifyChannel, Target: "webhook:http://localhost"},
+			}}
+			if err := st.CreateEscalationChain(ctx, chain); err != nil {
+				t.Fatal(err)
+			}
+			integration := &models.Integration{Name: t.Name(), Type: models.IntegrationPrometheus, EscalationChainID: &chain.ID}
+			if err := st.CreateIntegration(ctx, integration); err != nil {
+				t.Fatal(err)
+			}
+			if byToken, err := st.GetIntegrationByToken(ctx, integration.Token); err != nil || byToken.ID != integration.ID {
+				t.Errorf("expected token lookup to find the integration, got %+v (%v)", byToken, err)
+			}
+
+			if err := st.DeleteSchedule(ctx, schedule.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.DeleteIntegration(ctx, integration.ID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// CreateEscalationChain inserts a chain and its policies, setting their IDs
+func (s *Store) CreateEscalationChain(ctx context.Context, chain *models.EscalationChain) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO escalation_chains (name, description, created_at)
+		VALUES (?, ?, ?)
+		RETURNING id
+	`, chain.Name, chain.Description, now).Scan(&chain.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert escalation chain: %w", err)
+	}
+	chain.CreatedAt = now
+
+	for i := range chain.Policies {
+		policy := &chain.Policies[i]
+		policy.ChainID = chain.ID
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO escalation_policies (chain_id, step_number, policy_type, target, wait_seconds, ack_timeout_seconds)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, policy.ChainID, policy.StepNumber, policy.PolicyType, policy.Target, policy.WaitSeconds, policy.AckTimeoutSeconds).Scan(&policy.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert escalation policy: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetEscalationChain loads a chain with its policies in step order. It
+// returns sql.ErrNoRows if the chain doesn't exist.
+func (s *Store) GetEscalationChain(ctx context.Context, id int64) (*models.EscalationChain, error) {
+	chain := &models.EscalationChain{}
+	var description sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, description, created_at FROM escalation_chains WHERE id = ?
+	`, id).Scan(&chain.ID, &chain.Name, &description, &chain.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	chain.Description = description.String
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, chain_id, step_number, policy_type, target, wait_seconds, ack_timeout_seconds
+		FROM escalation_policies WHERE chain_id = ?
+		ORDER BY step_number, id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query escalation policies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.EscalationPolicy
+		var target sql.NullString
+		if err := rows.Scan(&p.ID, &p.ChainID, &p.StepNumber, &p.PolicyType, &target, &p.WaitSeconds, &p.AckTimeoutSeconds); err != nil {
+			return nil, err
+		}
+		p.Target = target.String
+		chain.Policies = append(chain.Policies, p)
+	}
+	return chain, rows.Err()
+}
+
+// SaveEscalationProgress records the next step of an alert's escalation,
+// replacing any earlier progress for the alert
+func (s *Store) SaveEscalationProgress(ctx context.Context, progress *models.EscalationProgress) error {
+	alert, err := json.Marshal(progress.Alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	progress.UpdatedAt = time.Now().UTC()
+	err = RetryBusy(ctx, func() error {
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO escalation_progress (alert_group_id, chain_id, next_step, alert, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (alert_group_id) DO UPDATE SET
+				chain_id = excluded.chain_id,
+				next_step = excluded.next_step,
+				alert = excluded.alert,
+				updated_at = excluded.updated_at
+		`, progress.AlertGroupID, progress.ChainID, progress.NextStep, string(alert), progress.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save escalation progress: %w", err)
+	}
+	return nil
+}
+
+// DeleteEscalationProgress forgets an alert's escalation once it has
+// finished. Deleting progress that doesn't exist is not an error.
+func (s *Store) DeleteEscalationProgress(ctx context.Context, alertGroupID int64) error {
+	return RetryBusy(ctx, func() error {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM escalation_progress WHERE alert_group_id = ?`, alertGroupID)
+		return err
+	})
+}
+
+// ListEscalationProgress returns the escalations that were still running,
+// oldest first
+func (s *Store) ListEscalationProgress(ctx context.Context) ([]*models.EscalationProgress, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT alert_group_id, chain_id, next_step, alert, updated_at
+		FROM escalation_progress
+		ORDER BY updated_at, alert_group_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query escalation progress: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*models.EscalationProgress
+	for rows.Next() {
+		p := &models.EscalationProgress{}
+		var alert string
+		if err := rows.Scan(&p.AlertGroupID, &p.ChainID, &p.NextStep, &alert, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(alert), &p.Alert); err != nil {
+			return nil, fmt.Errorf("invalid alert in escalation progress %d: %w", p.AlertGroupID, err)
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+const integrationColumns = `id, name, type, config, escalation_chain_id, token, created_at`
+
+// CreateIntegration inserts an integration, setting its ID and generating
+// its inbound token
+func (s *Store) CreateIntegration(ctx context.Context, integration *models.Integration) error {
+	token, err := newIntegrationToken()
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(integration.Config)
+	if err != nil {
+		return fmt.Errorf("failed to encode integration config: %w", err)
+	}
+
+	now := time.Now().UTC()
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO integrations (name, type, config, escalation_chain_id, token, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, integration.Name, integration.Type, string(config), integration.EscalationChainID, token, now).Scan(&integration.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert integration: %w", err)
+	}
+	integration.Token = token
+	integration.CreatedAt = now
+	return nil
+}
+
+// GetIntegration returns the integration with the given ID, or
+// sql.ErrNoRows if it doesn't exist
+func (s *Store) GetIntegration(ctx context.Context, id int64) (*models.Integration, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+integrationColumns+` FROM integrations WHERE id = ?`, id)
+	return scanIntegration(row)
+}
+
+// GetIntegrationByToken returns the integration an inbound webhook token
+// belongs to, or sql.ErrNoRows if none does
+func (s *Store) GetIntegrationByToken(ctx context.Context, token string) (*models.Integration, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+integrationColumns+` FROM integrations WHERE token = ?`, token)
+	return scanIntegration(row)
+}
+
+// ListIntegrations returns every integration, ordered by name
+func (s *Store) ListIntegrations(ctx context.Context) ([]*models.Integration, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+integrationColumns+` FROM integrations ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query integrations: %w", err)
+	}
+	defer rows.Close()
+
+	integrations := []*models.Integration{}
+	for rows.Next() {
+		integration, err := scanIntegration(rows)
+		if err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, integration)
+	}
+	return integrations, rows.Err()
+}
+
+// DeleteIntegration removes an integration. It returns sql.ErrNoRows if
+// the integration doesn't exist.
+func (s *Store) DeleteIntegration(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM integrations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete integration: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func scanIntegration(row interface{ Scan(...interface{}) error }) (*models.Integration, error) {
+	integration := &models.Integration{}
+	var config string
+	var chainID sql.NullInt64
+	err := row.Scan(&integration.ID, &integration.Name, &integration.Type, &config,
+		&chainID, &integration.Token, &integration.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if chainID.Valid {
+		integration.EscalationChainID = &chainID.Int64
+	}
+	if err := json.Unmarshal([]byte(config), &integration.Config); err != nil {
+		return nil, fmt.Errorf("invalid config for integration %d: %w", integration.ID, err)
+	}
+	return integration, nil
+}
+
+// newIntegrationToken returns a random token that is hard to guess, since
+// it is all a sender needs to post alerts for the integration
+func newIntegrationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate integration token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
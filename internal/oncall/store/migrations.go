@@ -0,0 +1,309 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is one step of the schema. Steps are applied once each, in
+// version order, and recorded in schema_migrations. Never edit a released
+// step; append a new one instead. DDL is written for SQLite and adapted by
+// the dialect.
+type migration struct {
+	version     int
+	description string
+	up          string
+}
+
+var migrations = []migration{
+	{
+		version:     1,
+		description: "initial schema",
+		// IF NOT EXISTS lets databases created before migrations were
+		// tracked adopt this step
+		up: `
+		CREATE TABLE IF NOT EXISTS schedules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			description TEXT,
+			timezone TEXT NOT NULL DEFAULT 'UTC',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS schedule_layers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			schedule_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			rotation_type TEXT NOT NULL, -- daily, weekly, custom
+			rotation_start DATETIME NOT NULL,
+			duration_hours INTEGER NOT NULL,
+			handoff_hour INTEGER, -- local time daily/weekly rotations hand off at
+			handoff_minute INTEGER NOT NULL DEFAULT 0,
+			users TEXT NOT NULL, -- JSON array of user IDs
+			restrictions TEXT, -- JSON array of restriction windows
+			FOREIGN KEY (schedule_id) REFERENCES schedules(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS schedule_overrides (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			schedule_id INTEGER NOT NULL,
+			user_id TEXT NOT NULL,
+			start_time DATETIME NOT NULL,
+			end_time DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (schedule_id) REFERENCES schedules(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS escalation_chains (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			description TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS escalation_policies (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chain_id INTEGER NOT NULL,
+			step_number INTEGER NOT NULL,
+			policy_type TEXT NOT NULL, -- notify_user, notify_channel, notify_schedule, wait
+			target TEXT, -- user ID, channel name, schedule ID, or wait duration
+			wait_seconds INTEGER DEFAULT 0,
+			ack_timeout_seconds INTEGER DEFAULT 0, -- notify steps wait this long for an ack
+			FOREIGN KEY (chain_id) REFERENCES escalation_chains(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS escalation_progress (
+			alert_group_id INTEGER PRIMARY KEY,
+			chain_id INTEGER NOT NULL,
+			next_step INTEGER NOT NULL,
+			alert TEXT NOT NULL, -- JSON snapshot of the dispatched alert
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS alert_groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			fingerprint TEXT UNIQUE NOT NULL,
+			status TEXT NOT NULL, -- firing, acknowledged, resolved
+			severity TEXT,
+			summary TEXT,
+			description TEXT,
+			labels TEXT, -- JSON
+			annotations TEXT, -- JSON
+			images TEXT, -- JSON list of image URLs
+			sources TEXT, -- JSON list of integrations that reported the alert
+			escalation_chain_id INTEGER,
+			acknowledged_by TEXT,
+			acknowledged_at DATETIME,
+			resolved_at DATETIME,
+			starts_at DATETIME,
+			ends_at DATETIME,
+			last_event_at DATETIME, -- StartsAt of firing or EndsAt of resolved, used to order updates
+			firing_count INTEGER NOT NULL DEFAULT 0, -- incremented on each resolved -> firing transition
+			notified_at DATETIME, -- last time ingestion triggered a notification, for deduplication
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (escalation_chain_id) REFERENCES escalation_chains(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alert_group_id INTEGER NOT NULL,
+			channel TEXT NOT NULL, -- slack, email, webhook
+			recipient TEXT NOT NULL,
+			status TEXT NOT NULL, -- pending, sent, failed
+			error TEXT,
+			sent_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (alert_group_id) REFERENCES alert_groups(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS integrations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL, -- prometheus, grafana, webhook
+			config TEXT NOT NULL, -- JSON
+			escalation_chain_id INTEGER,
+			token TEXT UNIQUE NOT NULL, -- identifies the integration in inbound webhook URLs
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (escalation_chain_id) REFERENCES escalation_chains(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			action TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			details TEXT, -- JSON
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS alert_notes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alert_group_id INTEGER NOT NULL,
+			author TEXT NOT NULL,
+			text TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (alert_group_id) REFERENCES alert_groups(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS webhook_payloads (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source TEXT NOT NULL, -- prometheus, grafana
+			payload TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS dead_letter (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			error TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_alert_groups_fingerprint ON alert_groups(fingerprint);
+		CREATE INDEX IF NOT EXISTS idx_alert_groups_status ON alert_groups(status);
+		CREATE INDEX IF NOT EXISTS idx_schedule_overrides_schedule ON schedule_overrides(schedule_id);
+		CREATE INDEX IF NOT EXISTS idx_notifications_alert_group ON notifications(alert_group_id);
+		CREATE INDEX IF NOT EXISTS idx_alert_notes_alert_group ON alert_notes(alert_group_id);
+	`,
+	},
+	{
+		version:     2,
+		description: "alert status history",
+		up: `
+		CREATE TABLE IF NOT EXISTS alert_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alert_group_id INTEGER NOT NULL,
+			from_status TEXT, -- NULL when the alert was created
+			to_status TEXT NOT NULL,
+			actor TEXT, -- who acknowledged or resolved, or the reporting integration
+			at DATETIME NOT NULL,
+			FOREIGN KEY (alert_group_id) REFERENCES alert_groups(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_alert_events_alert_group ON alert_events(alert_group_id);
+	`,
+	},
+	{
+		version:     3,
+		description: "layer priority",
+		up: `
+		ALTER TABLE schedule_layers ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+	`,
+	},
+	{
+		version:     4,
+		description: "layer role",
+		up: `
+		ALTER TABLE schedule_layers ADD COLUMN role TEXT NOT NULL DEFAULT 'primary'; -- primary, secondary
+	`,
+	},
+	{
+		version:     5,
+		description: "webhook payload integration",
+		up: `
+		ALTER TABLE webhook_payloads ADD COLUMN integration_id INTEGER; -- NULL when received without one
+	`,
+	},
+}
+
+// migrate applies the pending schema migrations
+func (s *Store) migrate() error {
+	return s.applyMigrations(context.Background(), migrations)
+}
+
+// applyMigrations applies each step of steps not yet recorded, each in its
+// own transaction. It stops at the first failure, leaving that step
+// unapplied and unrecorded.
+func (s *Store) applyMigrations(ctx context.Context, steps []migration) error {
+	for i := 1; i < len(steps); i++ {
+		if steps[i].version <= steps[i-1].version {
+			return fmt.Errorf("migration %d is out of order after %d", steps[i].version, steps[i-1].version)
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, s.dialect.schema(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)
+	`))
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if applied[step.version] {
+			continue
+		}
+		if err := s.applyMigration(ctx, step); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", step.version, step.description, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) applyMigration(ctx context.Context, step migration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Another replica may have applied the step since we looked
+	if lock := s.dialect.lockMigrations(); lock != "" {
+		if _, err := tx.ExecContext(ctx, lock); err != nil {
+			return err
+		}
+	}
+	var done int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, step.version).Scan(&done); err != nil {
+		return err
+	}
+	if done > 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, s.dialect.schema(step.up)); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`,
+		step.version, step.description, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the highest applied migration, 0 for none
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	return int(version.Int64), err
+}
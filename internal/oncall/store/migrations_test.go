@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func countMigrations(t *testing.T, st *Store) int {
+	t.Helper()
+	var n int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func tableExists(t *testing.T, st *Store, table string) bool {
+	t.Helper()
+	var n int
+	err := st.DB().QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func latestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func TestMigrations_FromEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oncall.db")
+	st, err := New("sqlite://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if version, err := st.SchemaVersion(ctx); err != nil || version != latestVersion() {
+		t.Errorf("expected schema version %d, got %d (%v)", latestVersion(), version, err)
+	}
+	if n := countMigrations(t, st); n != len(migrations) {
+		t.Errorf("expected %d recorded migrations, got %d", len(migrations), n)
+	}
+
+	// Re-running applies nothing new
+	if err := st.migrate(); err != nil {
+		t.Fatalf("unexpected error re-running migrations: %v", err)
+	}
+	st.Close()
+
+	st, err = New("sqlite://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if n := countMigrations(t, st); n != len(migrations) {
+		t.Errorf("expected migrations recorded once, got %d", n)
+	}
+}
+
+func TestMigrations_NewStepOnExistingDatabase(t *testing.T) {
+	st, err := New("sqlite://" + filepath.Join(t.TempDir(), "oncall.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	if _, err := st.DB().Exec(`INSERT INTO schedules (name) VALUES (?)`, "primary"); err != nil {
+		t.Fatal(err)
+	}
+
+	next := latestVersion() + 1
+	steps := append(append([]migration(nil), migrations...), migration{
+		version:     next,
+		description: "add schedule color",
+		up:          `ALTER TABLE schedules ADD COLUMN color TEXT NOT NULL DEFAULT 'blue'`,
+	})
+	if err := st.applyMigrations(ctx, steps); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := st.SchemaVersion(ctx); err != nil || version != next {
+		t.Errorf("expected schema version %d, got %d (%v)", next, version, err)
+	}
+	var color string
+	if err := st.DB().QueryRow(`SELECT color FROM schedules WHERE name = ?`, "primary").Scan(&color); err != nil || color != "blue" {
+		t.Errorf("expected existing rows to get the new column, got %q (%v)", color, err)
+	}
+
+	// Applying the same steps again must not re-run the ALTER
+	if err := st.applyMigrations(ctx, steps); err != nil {
+		t.Fatalf("unexpected error re-running migrations: %v", err)
+	}
+}
+
+func TestMigrations_FailureStopsAndRollsBack(t *testing.T) {
+	st, err := New("sqlite://" + filepath.Join(t.TempDir(), "oncall.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	next := latestVersion() + 1
+	steps := append(append([]migration(nil), migrations...),
+		migration{version: next, description: "add widgets", up: `CREATE TABLE widgets (id INTEGER PRIMARY KEY)`},
+		migration{version: next + 1, description: "broken", up: `
+			CREATE TABLE gadgets (id INTEGER PRIMARY KEY);
+			ALTER TABLE missing ADD COLUMN x TEXT;
+		`},
+		migration{version: next + 2, description: "after broken", up: `CREATE TABLE gizmos (id INTEGER PRIMARY KEY)`},
+	)
+	if err := st.applyMigrations(ctx, steps); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+
+	if version, err := st.SchemaVersion(ctx); err != nil || version != next {
+		t.Errorf("expected steps before the failure applied, got version %d (%v)", version, err)
+	}
+	if !tableExists(t, st, "widgets") {
+		t.Error("expected the step before the failure to be applied")
+	}
+	if tableExists(t, st, "gadgets") {
+		t.Error("expected the failed step to be rolled back")
+	}
+	if tableExists(t, st, "gizmos") {
+		t.Error("expected steps after the failure to be skipped")
+	}
+}
+
+func TestMigrations_OutOfOrder(t *testing.T) {
+	st, err := New("sqlite://" + filepath.Join(t.TempDir(), "oncall.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	steps := []migration{{version: 2, up: `SELECT 1`}, {version: 2, up: `SELECT 1`}}
+	if err := st.applyMigrations(context.Background(), steps); err == nil {
+		t.Error("expected an error for duplicate versions")
+	}
+}
+
+func TestMigrations_AdoptsUntrackedDatabase(t *testing.T) {
+	// A database created before migrations were tracked has the initial
+	// schema but no record of it
+	saved := migrations
+	migrations = saved[:1]
+	path := filepath.Join(t.TempDir(), "oncall.db")
+	st, err := New("sqlite://" + path)
+	migrations = saved
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.DB().Exec(`DROP TABLE schema_migrations`); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	st, err = New("sqlite://" + path)
+	if err != nil {
+		t.Fatalf("expected an untracked database to be adopted, got %v", err)
+	}
+	defer st.Close()
+	if n := countMigrations(t, st); n != len(migrations) {
+		t.Errorf("expected %d recorded migrations, got %d", len(migrations), n)
+	}
+}
+
+func TestNew_RefusesFailedMigration(t *testing.T) {
+	saved := migrations
+	defer func() { migrations = saved }()
+	migrations = append(append([]migration(nil), saved...),
+		migration{version: latestVersion() + 1, description: "broken", up: `ALTER TABLE missing ADD COLUMN x TEXT`})
+
+	if _, err := New("sqlite://" + filepath.Join(t.TempDir(), "oncall.db")); err == nil {
+		t.Fatal("expected New to fail on a broken migration")
+	}
+}
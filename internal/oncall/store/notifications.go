@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// CreateNotification records a delivery attempt, filling in its ID and
+// creation time. An empty status is stored as pending.
+func (s *Store) CreateNotification(ctx context.Context, n *models.Notification) error {
+	if n.Status == "" {
+		n.Status = models.NotificationPending
+	}
+	n.CreatedAt = time.Now().UTC()
+
+	return RetryBusy(ctx, func() error {
+		return s.db.QueryRowContext(ctx, `
+			INSERT INTO notifications (alert_group_id, channel, recipient, status, error, sent_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, n.AlertGroupID, n.Channel, n.Recipient, n.Status, n.Error, n.SentAt, n.CreatedAt).Scan(&n.ID)
+	})
+}
+
+// UpdateNotificationStatus sets the outcome of a delivery. Marking it sent
+// stamps sent_at; errMsg is stored for failures and cleared otherwise. It
+// returns sql.ErrNoRows if there is no notification with that ID.
+func (s *Store) UpdateNotificationStatus(ctx context.Context, id int64, status, errMsg string) error {
+	var sentAt *time.Time
+	if status == models.NotificationSent {
+		now := time.Now().UTC()
+		sentAt = &now
+	}
+	var errText *string
+	if errMsg != "" {
+		errText = &errMsg
+	}
+
+	var res sql.Result
+	err := RetryBusy(ctx, func() (err error) {
+		res, err = s.db.ExecContext(ctx, `
+			UPDATE notifications SET status = ?, error = ?, sent_at = COALESCE(?, sent_at)
+			WHERE id = ?
+		`, status, errText, sentAt, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListNotificationsByAlert returns an alert group's delivery history,
+// oldest first
+func (s *Store) ListNotificationsByAlert(ctx context.Context, alertGroupID int64) ([]*models.Notification, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, alert_group_id, channel, recipient, status, error, sent_at, created_at
+		FROM notifications
+		WHERE alert_group_id = ?
+		ORDER BY created_at, id
+	`, alertGroupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*models.Notification
+	for rows.Next() {
+		var n models.Notification
+		var errText sql.NullString
+		var sentAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.AlertGroupID, &n.Channel, &n.Recipient, &n.Status, &errText, &sentAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		if errText.Valid {
+			n.Error = &errText.String
+		}
+		if sentAt.Valid {
+			n.SentAt = &sentAt.Time
+		}
+		notifications = append(notifications, &n)
+	}
+	return notifications, rows.Err()
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+// ScheduleRepository is the schedule storage used by the API. Store
+// implements it.
+type ScheduleRepository interface {
+	CreateSchedule(ctx context.Context, schedule *models.Schedule) error
+	GetSchedule(ctx context.Context, id int64) (*models.Schedule, error)
+	ListSchedules(ctx context.Context) ([]*models.Schedule, error)
+	UpdateSchedule(ctx context.Context, schedule *models.Schedule) error
+	DeleteSchedule(ctx context.Context, id int64) error
+}
+
+var _ ScheduleRepository = (*Store)(nil)
+
+// CreateSchedule inserts a schedule and its layers, setting their IDs
+func (s *Store) CreateSchedule(ctx context.Context, schedule *models.Schedule) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO schedules (name, description, timezone, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, schedule.Name, schedule.Description, schedule.Timezone, now, now).Scan(&schedule.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert schedule: %w", err)
+	}
+	schedule.CreatedAt = now
+	schedule.UpdatedAt = now
+
+	if err := insertLayers(ctx, tx, schedule); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetSchedule loads a schedule with its layers and overrides. It returns
+// sql.ErrNoRows if the schedule doesn't exist.
+func (s *Store) GetSchedule(ctx context.Context, id int64) (*models.Schedule, error) {
+	schedule := &models.Schedule{}
+	var description sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, description, timezone, created_at, updated_at
+		FROM schedules WHERE id = ?
+	`, id).Scan(&schedule.ID, &schedule.Name, &description, &schedule.Timezone, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Description = description.String
+
+	if schedule.Layers, err = s.scheduleLayers(ctx, id); err != nil {
+		return nil, err
+	}
+	if schedule.Overrides, err = s.ListOverrides(ctx, id); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// ListSchedules returns every schedule with its layers, ordered by name.
+// Overrides are only loaded by GetSchedule.
+func (s *Store) ListSchedules(ctx context.Context) ([]*models.Schedule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, description, timezone, created_at, updated_at
+		FROM schedules
+		ORDER BY name, id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []*models.Schedule{}
+	for rows.Next() {
+		schedule := &models.Schedule{}
+		var description sql.NullString
+		if err := rows.Scan(&schedule.ID, &schedule.Name, &description, &schedule.Timezone,
+			&schedule.CreatedAt, &schedule.UpdatedAt); err != nil {
+			return nil, err
+		}
+		schedule.Description = description.String
+		schedules = append(schedules, schedule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, schedule := range schedules {
+		if schedule.Layers, err = s.scheduleLayers(ctx, schedule.ID); err != nil {
+			return nil, err
+		}
+	}
+	return schedules, nil
+}
+
+// CountSchedules returns the number of schedules
+func (s *Store) CountSchedules(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schedules`).Scan(&n)
+	return n, err
+}
+
+// DeleteSchedule removes a schedule along with its layers and overrides.
+// It returns sql.ErrNoRows if the schedule doesn't exist.
+func (s *Store) DeleteSchedule(ctx context.Context, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"schedule_layers", "schedule_overrides"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE schedule_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM schedules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) scheduleLayers(ctx context.Context, scheduleID int64) ([]models.Layer, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, schedule_id, name, rotation_type, rotation_start, duration_hours, handoff_hour, handoff_minute, users, restrictions, priority, role
+		FROM schedule_layers WHERE schedule_id = ?
+		ORDER BY id
+	`, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query layers: %w", err)
+	}
+	defer rows.Close()
+
+	var layers []models.Layer
+	for rows.Next() {
+		var layer models.Layer
+		var users string
+		var handoffHour sql.NullInt64
+		var restrictions sql.NullString
+		if err := rows.Scan(&layer.ID, &layer.ScheduleID, &layer.Name, &layer.RotationType,
+			&layer.RotationStart, &layer.DurationHours, &handoffHour, &layer.HandoffMinute, &users, &restrictions, &layer.Priority, &layer.Role); err != nil {
+			return nil, err
+		}
+		if handoffHour.Valid {
+			hour := int(handoffHour.Int64)
+			layer.HandoffHour = &hour
+		}
+		if err := json.Unmarshal([]byte(users), &layer.Users); err != nil {
+			return nil, fmt.Errorf("failed to decode layer users: %w", err)
+		}
+		if restrictions.Valid {
+			if err := json.Unmarshal([]byte(restrictions.String), &layer.Restrictions); err != nil {
+				return nil, fmt.Errorf("failed to decode layer restrictions: %w", err)
+			}
+		}
+		layers = append(layers, layer)
+	}
+	return layers, rows.Err()
+}
+
+// CreateOverride inserts an override for an existing schedule. It returns
+// sql.ErrNoRows if the schedule doesn't exist.
+func (s *Store) CreateOverride(ctx context.Context, override *models.Override) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Postgres can't infer the types of placeholders in an INSERT ... SELECT
+	// list, so check the schedule separately
+	var scheduleID int64
+	if err := tx.QueryRowContext(ctx, `SELECT id FROM schedules WHERE id = ?`, override.ScheduleID).Scan(&scheduleID); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO schedule_overrides (schedule_id, user_id, start_time, end_time, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, scheduleID, override.User, override.Start.UTC(), override.End.UTC(), now).Scan(&override.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	override.CreatedAt = now
+	return nil
+}
+
+// ListOverrides returns a schedule's overrides ordered by start time
+func (s *Store) ListOverrides(ctx context.Context, scheduleID int64) ([]models.Override, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, schedule_id, user_id, start_time, end_time, created_at
+		FROM schedule_overrides WHERE schedule_id = ?
+		ORDER BY start_time, id
+	`, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query overrides: %w", err)
+	}
+	defer rows.Close()
+
+	var overrides []models.Override
+	for rows.Next() {
+		var o models.Override
+		if err := rows.Scan(&o.ID, &o.ScheduleID, &o.User, &o.Start, &o.End, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// UpdateSchedule replaces a schedule's fields and layers. It returns
+// sql.ErrNoRows if the schedule doesn't exist.
+func (s *Store) UpdateSchedule(ctx context.Context, schedule *models.Schedule) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	err = tx.QueryRowContext(ctx, `
+		UPDATE schedules SET name = ?, description = ?, timezone = ?, updated_at = ?
+		WHERE id = ?
+		RETURNING created_at
+	`, schedule.Name, schedule.Description, schedule.Timezone, now, schedule.ID).Scan(&schedule.CreatedAt)
+	if err != nil {
+		return err
+	}
+	schedule.UpdatedAt = now
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schedule_layers WHERE schedule_id = ?`, schedule.ID); err != nil {
+		return fmt.Errorf("failed to delete layers: %w", err)
+	}
+	if err := insertLayers(ctx, tx, schedule); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertLayers(ctx context.Context, tx *sql.Tx, schedule *models.Schedule) error {
+	for i := range schedule.Layers {
+		layer := &schedule.Layers[i]
+		layer.ScheduleID = schedule.ID
+		if layer.Role == "" {
+			layer.Role = models.RolePrimary
+		}
+
+		users, err := json.Marshal(layer.Users)
+		if err != nil {
+			return fmt.Errorf("failed to encode layer users: %w", err)
+		}
+		restrictions, err := json.Marshal(layer.Restrictions)
+		if err != nil {
+			return fmt.Errorf("failed to encode layer restrictions: %w", err)
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO schedule_layers (schedule_id, name, rotation_type, rotation_start, duration_hours, handoff_hour, handoff_minute, users, restrictions, priority, role)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, layer.ScheduleID, layer.Name, layer.RotationType, layer.RotationStart.UTC(), layer.DurationHours, layer.HandoffHour, layer.HandoffMinute, users, restrictions, layer.Priority, layer.Role).Scan(&layer.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert layer: %w", err)
+		}
+	}
+	return nil
+}
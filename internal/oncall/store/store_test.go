@@ -0,0 +1,408 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func walSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path + "-wal")
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestStore_CheckpointTruncatesWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oncall.db")
+	st, err := New("sqlite://" + path + "?_journal_mode=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if _, err := st.DB().Exec(`INSERT INTO schedules (name) VALUES (?)`, "primary"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if walSize(t, path) == 0 {
+		t.Fatal("expected writes to land in the WAL")
+	}
+
+	if err := st.Checkpoint(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if size := walSize(t, path); size != 0 {
+		t.Errorf("expected WAL truncated by checkpoint, got %d bytes", size)
+	}
+
+	if _, err := st.DB().Exec(`INSERT INTO schedules (name) VALUES (?)`, "secondary"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %v", err)
+	}
+	if size := walSize(t, path); size != 0 {
+		t.Errorf("expected WAL checkpointed on close, got %d bytes", size)
+	}
+
+	// Checkpointed data survives reopening
+	st, err = New("sqlite://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	var count int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM schedules`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 51 {
+		t.Errorf("expected 51 schedules, got %d", count)
+	}
+}
+
+func TestStore_CancelledContextAbortsQueries(t *testing.T) {
+	st, err := New("sqlite://" + filepath.Join(t.TempDir(), "oncall.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	schedule := &models.Schedule{
+		Name:     "Primary",
+		Timezone: "UTC",
+		Layers: []models.Layer{{
+			Name:          "Week",
+			RotationType:  "weekly",
+			RotationStart: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			DurationHours: 168,
+			Users:         []string{"alice"},
+		}},
+	}
+	if err := st.CreateSchedule(context.Background(), schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := st.GetSchedule(ctx, schedule.ID); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetSchedule: expected context.Canceled, got %v", err)
+	}
+	if _, err := st.AlertStatus(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("AlertStatus: expected context.Canceled, got %v", err)
+	}
+
+	// A cancelled write leaves nothing behind
+	if err := st.CreateSchedule(ctx, &models.Schedule{Name: "Secondary", Timezone: "UTC"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateSchedule: expected context.Canceled, got %v", err)
+	}
+	var count int
+	if err := st.DB().QueryRow(`SELECT COUNT(*) FROM schedules`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected only the first schedule stored, got %d", count)
+	}
+}
+
+func TestStore_NotificationHistory(t *testing.T) {
+	st, err := New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	sent := &models.Notification{AlertGroupID: 7, Channel: "slack", Recipient: "#ops"}
+	failed := &models.Notification{AlertGroupID: 7, Channel: "webhook", Recipient: "https://hooks.example.com"}
+	other := &models.Notification{AlertGroupID: 8, Channel: "slack", Recipient: "#ops"}
+	for _, n := range []*models.Notification{sent, failed, other} {
+		if err := st.CreateNotification(ctx, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sent.ID == 0 || sent.Status != models.NotificationPending || sent.CreatedAt.IsZero() {
+		t.Fatalf("expected a pending notification with ID, got %+v", sent)
+	}
+
+	if err := st.UpdateNotificationStatus(ctx, sent.ID, models.NotificationSent, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.UpdateNotificationStatus(ctx, failed.ID, models.NotificationFailed, "webhook returned status 500"); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.UpdateNotificationStatus(ctx, 999, models.NotificationSent, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for a missing notification, got %v", err)
+	}
+
+	history, err := st.ListNotificationsByAlert(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 notifications for the alert, got %d", len(history))
+	}
+	if got := history[0]; got.ID != sent.ID || got.Status != models.NotificationSent || got.SentAt == nil || got.Error != nil {
+		t.Errorf("unexpected sent notification %+v", got)
+	}
+	if got := history[1]; got.ID != failed.ID || got.Status != models.NotificationFailed || got.SentAt != nil ||
+		got.Error == nil || *got.Error != "webhook returned status 500" {
+		t.Errorf("unexpected failed notification %+v", got)
+	}
+
+	if history, err := st.ListNotificationsByAlert(ctx, 42); err != nil || len(history) != 0 {
+		t.Errorf("expected no history for an unknown alert, got %v (%v)", history, err)
+	}
+}
+
+func TestScheduleRepository_RoundTripsLayers(t *testing.T) {
+	var repo ScheduleRepository
+	st, err := New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	repo = st
+	ctx := context.Background()
+
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	handoffHour := 10
+	tests := []struct {
+		name   string
+		layers []models.Layer
+	}{
+		{"no layers", nil},
+		{"single layer", []models.Layer{
+			{Name: "Primary", RotationType: "weekly", RotationStart: start, DurationHours: 168, Users: []string{"alice", "bob"}},
+		}},
+		{"single layer with handoff hour", []models.Layer{
+			{Name: "Primary", RotationType: "daily", RotationStart: start, HandoffHour: &handoffHour, HandoffMinute: 30, Users: []string{"alice"}},
+		}},
+		{"restricted layers", []models.Layer{
+			{Name: "Business hours", RotationType: "daily", RotationStart: start, DurationHours: 24, Users: []string{"carol"},
+				Restrictions: []models.Restriction{{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00"}}},
+			{Name: "Nights", RotationType: "custom", RotationStart: start.Add(8 * time.Hour), DurationHours: 12, Users: []string{"dave"},
+				Restrictions: []models.Restriction{{Start: "22:00", End: "06:00"}}},
+		}},
+		{"stacked layers", []models.Layer{
+			{Name: "Base", RotationType: "weekly", RotationStart: start, Users: []string{"alice", "bob"}},
+			{Name: "Business hours", RotationType: "daily", RotationStart: start, Users: []string{"carol"}, Priority: 10,
+				Restrictions: []models.Restriction{{Days: []string{"mon", "tue"}, Start: "09:00", End: "17:00"}}},
+		}},
+		{"primary and secondary layers", []models.Layer{
+			{Name: "Primary", RotationType: "weekly", RotationStart: start, Users: []string{"alice", "bob"}, Role: models.RolePrimary},
+			{Name: "Shadow", RotationType: "weekly", RotationStart: start, Users: []string{"carol"}, Role: models.RoleSecondary},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := &models.Schedule{Name: tt.name, Timezone: "Europe/Berlin", Layers: tt.layers}
+			if err := repo.CreateSchedule(ctx, schedule); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := repo.GetSchedule(ctx, schedule.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.name || got.Timezone != "Europe/Berlin" {
+				t.Errorf("unexpected schedule %+v", got)
+			}
+			if len(got.Layers) != len(tt.layers) {
+				t.Fatalf("expected %d layers, got %d", len(tt.layers), len(got.Layers))
+			}
+			for i, layer := range got.Layers {
+				want := tt.layers[i]
+				if layer.Role == "" {
+					t.Errorf("layer %d: expected the role to default to primary", i)
+				}
+				if layer.ID == 0 || layer.ScheduleID != schedule.ID {
+					t.Errorf("layer %d: expected IDs to be set, got %+v", i, layer)
+				}
+				if layer.Name != want.Name || layer.RotationType != want.RotationType ||
+					!layer.RotationStart.Equal(want.RotationStart) || layer.DurationHours != want.DurationHours ||
+					!reflect.DeepEqual(layer.HandoffHour, want.HandoffHour) || layer.HandoffMinute != want.HandoffMinute ||
+					!reflect.DeepEqual(layer.Users, want.Users) || !reflect.DeepEqual(layer.Restrictions, want.Restrictions) ||
+					layer.Priority != want.Priority || layer.Role != want.Role {
+					t.Errorf("layer %d: expected %+v, got %+v", i, want, layer)
+				}
+			}
+		})
+	}
+
+	schedules, err := repo.ListSchedules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range schedules {
+		names = append(names, s.Name)
+	}
+	if want := []string{"no layers", "primary and secondary layers", "restricted layers", "single layer", "single layer with handoff hour", "stacked layers"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected schedules %v, got %v", want, names)
+	}
+	if len(schedules[1].Layers) != 2 {
+		t.Errorf("expected listed schedules to carry layers, got %+v", schedules[1])
+	}
+}
+
+func TestScheduleRepository_DeleteCascades(t *testing.T) {
+	st, err := New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	schedule := &models.Schedule{Name: "Primary", Timezone: "UTC", Layers: []models.Layer{
+		{Name: "Week", RotationType: "weekly", RotationStart: time.Now(), DurationHours: 168, Users: []string{"alice"}},
+	}}
+	if err := st.CreateSchedule(ctx, schedule); err != nil {
+		t.Fatal(err)
+	}
+	override := &models.Override{ScheduleID: schedule.ID, User: "bob", Start: time.Now(), End: time.Now().Add(time.Hour)}
+	if err := st.CreateOverride(ctx, override); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.DeleteSchedule(ctx, schedule.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetSchedule(ctx, schedule.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the schedule gone, got %v", err)
+	}
+	for _, table := range []string{"schedule_layers", "schedule_overrides"} {
+		var count int
+		if err := st.DB().QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("expected %s emptied, got %d rows", table, count)
+		}
+	}
+
+	if err := st.DeleteSchedule(ctx, schedule.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows deleting again, got %v", err)
+	}
+}
+
+func TestStore_MissingTables(t *testing.T) {
+	st, err := New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	if missing, err := st.MissingTables(ctx); err != nil || len(missing) != 0 {
+		t.Fatalf("expected a fully migrated schema, got %v (%v)", missing, err)
+	}
+
+	if _, err := st.DB().Exec(`DROP TABLE dead_letter`); err != nil {
+		t.Fatal(err)
+	}
+	if missing, err := st.MissingTables(ctx); err != nil || !reflect.DeepEqual(missing, []string{"dead_letter"}) {
+		t.Errorf("expected dead_letter missing, got %v (%v)", missing, err)
+	}
+}
+
+func TestStore_EscalationProgress(t *testing.T) {
+	st, err := New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	alert := &models.AlertGroup{ID: 7, Fingerprint: "abc", Severity: "critical", Labels: map[string]string{"team": "db"}}
+	if err := st.SaveEscalationProgress(ctx, &models.EscalationProgress{AlertGroupID: 7, ChainID: 1, NextStep: 1, Alert: alert}); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again moves the escalation on rather than adding a row
+	if err := st.SaveEscalationProgress(ctx, &models.EscalationProgress{AlertGroupID: 7, ChainID: 1, NextStep: 3, Alert: alert}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := st.ListEscalationProgress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("expected 1 escalation in progress, got %d", len(list))
+	}
+	if got := list[0]; got.NextStep != 3 || got.ChainID != 1 || !reflect.DeepEqual(got.Alert, alert) {
+		t.Errorf("unexpected progress %+v (alert %+v)", got, got.Alert)
+	}
+
+	if err := st.DeleteEscalationProgress(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := st.ListEscalationProgress(ctx); err != nil || len(list) != 0 {
+		t.Errorf("expected no progress after delete, got %v (%v)", list, err)
+	}
+}
+
+func TestStore_Integrations(t *testing.T) {
+	st, err := New("sqlite://file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	chainID := int64(3)
+	prom := &models.Integration{Name: "prod-alertmanager", Type: models.IntegrationPrometheus,
+		Config: map[string]string{"cluster": "prod"}, EscalationChainID: &chainID}
+	grafana := &models.Integration{Name: "grafana", Type: models.IntegrationGrafana}
+	for _, integration := range []*models.Integration{prom, grafana} {
+		if err := st.CreateIntegration(ctx, integration); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if prom.ID == 0 || len(prom.Token) != 32 || prom.Token == grafana.Token {
+		t.Fatalf("expected ID and distinct tokens, got %+v and %+v", prom, grafana)
+	}
+
+	got, err := st.GetIntegration(ctx, prom.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != prom.Name || got.Config["cluster"] != "prod" || got.EscalationChainID == nil || *got.EscalationChainID != 3 {
+		t.Errorf("unexpected integration %+v", got)
+	}
+	if byToken, err := st.GetIntegrationByToken(ctx, grafana.Token); err != nil || byToken.ID != grafana.ID {
+		t.Errorf("expected token lookup to find grafana, got %+v (%v)", byToken, err)
+	}
+
+	list, err := st.ListIntegrations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "grafana" || list[1].Name != "prod-alertmanager" {
+		t.Errorf("expected integrations ordered by name, got %+v", list)
+	}
+
+	if err := st.DeleteIntegration(ctx, prom.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetIntegration(ctx, prom.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows after delete, got %v", err)
+	}
+	if err := st.DeleteIntegration(ctx, prom.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows deleting twice, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WebhookPayload is a raw webhook body kept for replay
+type WebhookPayload struct {
+	ID     int64
+	Source string
+	// IntegrationID is the integration the webhook came through, if any
+	IntegrationID *int64
+	Payload       []byte
+}
+
+// InsertWebhookPayload keeps a raw webhook body received through
+// integrationID, which may be nil, so it can be replayed later, and returns
+// its ID
+func (s *Store) InsertWebhookPayload(ctx context.Context, source string, integrationID *int64, payload []byte) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO webhook_payloads (source, integration_id, payload, created_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, source, integrationID, string(payload), time.Now().UTC()).Scan(&id)
+	return id, err
+}
+
+// GetWebhookPayload returns a stored webhook. It returns sql.ErrNoRows if
+// there is no payload with that ID.
+func (s *Store) GetWebhookPayload(ctx context.Context, id int64) (*WebhookPayload, error) {
+	stored := &WebhookPayload{ID: id}
+	var integrationID sql.NullInt64
+	var payload string
+	err := s.db.QueryRowContext(ctx, `SELECT source, integration_id, payload FROM webhook_payloads WHERE id = ?`, id).
+		Scan(&stored.Source, &integrationID, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if integrationID.Valid {
+		stored.IntegrationID = &integrationID.Int64
+	}
+	stored.Payload = []byte(payload)
+	return stored, nil
+}
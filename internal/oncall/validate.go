@@ -0,0 +1,94 @@
+package oncall
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/spf13/cobra"
+	"github.com/vjranagit/grafana/internal/oncall/server"
+)
+
+// errInvalidConfig is returned by config validate after the problems it
+// found have been printed
+var errInvalidConfig = errors.New("config is invalid")
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Work with oncall config files",
+	}
+	cmd.AddCommand(newValidateCommand())
+	return cmd
+}
+
+func newValidateCommand() *cobra.Command {
+	var configFile string
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check an oncall config without starting the server",
+		Long: `Parse the oncall config and check its settings, API keys and routes
+the way the server would, without connecting to the database. Prints OK or
+every problem found, and exits non-zero if there are any.`,
+		// The problems are printed above and main reports the error
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return validateConfig(cmd.OutOrStdout(), configFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&configFile, "config", "c", "oncall.hcl",
+		"Configuration file path")
+
+	return cmd
+}
+
+// validateConfig checks the config at path, which unlike at startup must
+// exist, and prints the result to out
+func validateConfig(out io.Writer, path string) error {
+	err := checkConfig(path)
+	if err == nil {
+		fmt.Fprintln(out, "OK")
+		return nil
+	}
+	for _, problem := range configProblems(err) {
+		fmt.Fprintln(out, problem)
+	}
+	return errInvalidConfig
+}
+
+func checkConfig(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	return server.Validate(cfg)
+}
+
+// configProblems splits err into one line per problem: each HCL diagnostic,
+// which carries its file and line, and each joined error
+func configProblems(err error) []string {
+	var diags hcl.Diagnostics
+	if errors.As(err, &diags) {
+		problems := make([]string, 0, len(diags))
+		for _, diag := range diags {
+			problems = append(problems, diag.Error())
+		}
+		return problems
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var problems []string
+		for _, err := range joined.Unwrap() {
+			problems = append(problems, configProblems(err)...)
+		}
+		return problems
+	}
+	return []string{err.Error()}
+}
@@ -0,0 +1,124 @@
+package oncall
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig_OK(t *testing.T) {
+	path := writeConfig(t, `
+oncall {
+  listen   = ":9090"
+  database = "postgres://oncall@db/oncall"
+
+  webhook_pool = ["https://hooks-1.example.com/alert"]
+
+  api_key "dashboard" {
+    key    = "read-only"
+    scopes = ["read"]
+  }
+
+  route {
+    match   = { team = "payments" }
+    targets = ["slack:https://hooks.slack.com/services/T0/B0/x", "webhook-pool:"]
+  }
+}
+`)
+	var out bytes.Buffer
+	if err := validateConfig(&out, path); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, out.String())
+	}
+	if out.String() != "OK\n" {
+		t.Errorf("expected OK, got %q", out.String())
+	}
+}
+
+func TestValidateCommand_Example(t *testing.T) {
+	// The example needs no environment variables set
+	for _, name := range []string{"ONCALL_ADMIN_KEY", "ONCALL_DASHBOARD_KEY", "SLACK_SIGNING_SECRET", "WEBHOOK_SIGNING_SECRET", "SLACK_WEBHOOK_URL"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	var out, errOut bytes.Buffer
+	cmd := newValidateCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetArgs([]string{"-c", filepath.Join("..", "..", "examples", "oncall.hcl")})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected the example config to validate, got %v:\n%s", err, out.String())
+	}
+	if out.String() != "OK\n" {
+		t.Errorf("expected OK, got %q", out.String())
+	}
+}
+
+func TestValidateCommand_PrintsProblemsOnce(t *testing.T) {
+	path := writeConfig(t, `oncall { listen = "9090" }`)
+	var out, errOut bytes.Buffer
+	cmd := newValidateCommand()
+	cmd.SetOut(&out)
+	cmd.SetErr(&errOut)
+	cmd.SetArgs([]string{"-c", path})
+	if err := cmd.Execute(); !errors.Is(err, errInvalidConfig) {
+		t.Fatalf("expected errInvalidConfig, got %v", err)
+	}
+	if strings.Count(out.String(), "listen address") != 1 || errOut.Len() != 0 {
+		t.Errorf("expected the problem once and nothing else, got %q and %q", out.String(), errOut.String())
+	}
+}
+
+func TestValidateConfig_ReportsEveryProblem(t *testing.T) {
+	path := writeConfig(t, `
+oncall {
+  listen   = "9090"
+  database = "mysql://oncall@db/oncall"
+
+  api_key "dashboard" {
+    key    = "read-only"
+    scopes = ["admin"]
+  }
+
+  route {
+    targets = ["pagerduty:team-a"]
+  }
+}
+`)
+	var out bytes.Buffer
+	if err := validateConfig(&out, path); !errors.Is(err, errInvalidConfig) {
+		t.Fatalf("expected errInvalidConfig, got %v", err)
+	}
+	problems := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(problems) != 4 {
+		t.Fatalf("expected 4 problems, got:\n%s", out.String())
+	}
+	for i, want := range []string{"listen address", "mysql", `unknown scope "admin"`, `unknown channel "pagerduty"`} {
+		if !strings.Contains(problems[i], want) {
+			t.Errorf("expected problem %d to mention %s, got %q", i+1, want, problems[i])
+		}
+	}
+}
+
+func TestValidateConfig_SyntaxErrorHasPosition(t *testing.T) {
+	path := writeConfig(t, `
+oncall {
+  listen =
+}
+`)
+	var out bytes.Buffer
+	if err := validateConfig(&out, path); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if !strings.HasPrefix(out.String(), path+":3,") {
+		t.Errorf("expected the problem to point at line 3, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := validateConfig(&out, filepath.Join(t.TempDir(), "missing.hcl")); err == nil {
+		t.Error("expected a missing file to be reported")
+	}
+}
@@ -0,0 +1,315 @@
+package oncall
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vjranagit/grafana/internal/oncall/api"
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func newWatchCommand() *cobra.Command {
+	var serverURL string
+	var apiKey string
+	var severities []string
+	var statuses []string
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Tail live alerts from a running oncall server",
+		Long: `Connect to the oncall server's alert stream and render a live,
+color-coded table of current alerts in the terminal.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(context.Background(),
+				os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			table := newAlertTable(alertFilter{
+				severities: severities,
+				statuses:   statuses,
+			})
+
+			client := oncallClient{serverURL: serverURL, apiKey: apiKey, http: http.DefaultClient}
+			return watchAlerts(ctx, client, table, cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "server", "http://localhost:8080",
+		"Oncall server URL")
+	cmd.Flags().StringVar(&apiKey, "api-key", "",
+		"API key for servers that require one")
+	cmd.Flags().StringSliceVar(&severities, "severity", nil,
+		"Only show alerts with these severities (comma-separated)")
+	cmd.Flags().StringSliceVar(&statuses, "status", nil,
+		"Only show alerts with these statuses (comma-separated)")
+
+	return cmd
+}
+
+// errRejected is returned when the server refuses the stream's credentials,
+// which reconnecting won't fix
+var errRejected = errors.New("server rejected the request")
+
+// watchAlerts follows the alert stream until ctx is cancelled, reconnecting
+// whenever the server closes the connection. It gives up if the server
+// rejects the API key.
+func watchAlerts(ctx context.Context, client oncallClient, table *alertTable, out, errOut io.Writer) error {
+	for {
+		err := client.followStream(ctx, func(event, data string) error {
+			if event != api.EventAlert {
+				return nil
+			}
+			var alert models.AlertGroup
+			if err := json.Unmarshal([]byte(data), &alert); err != nil {
+				return fmt.Errorf("failed to decode alert event: %w", err)
+			}
+			table.apply(&alert)
+
+			// Clear the screen and redraw from the top
+			fmt.Fprint(out, "\033[H\033[2J")
+			renderAlertTable(out, table.rows(), time.Now())
+			return nil
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, errRejected) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(errOut, "stream error: %v (reconnecting)\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// followStream reads the server's alert stream until it ends, calling
+// handle for each event
+func (c oncallClient) followStream(ctx context.Context, handle func(event, data string) error) error {
+	streamURL := strings.TrimSuffix(c.serverURL, "/") + "/api/v1/alerts/stream"
+	req, err := http.NewRequestWithContext(ctx, "GET", streamURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w (status %d): check --api-key", errRejected, resp.StatusCode)
+	default:
+		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	return readEvents(resp.Body, handle)
+}
+
+// readEvents parses a Server-Sent Events stream, calling handle for each
+// complete event.
+func readEvents(r io.Reader, handle func(event, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := handle(event, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// Comment, used for keepalives
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	return scanner.Err()
+}
+
+type alertFilter struct {
+	severities []string
+	statuses   []string
+}
+
+func (f alertFilter) matches(alert *models.AlertGroup) bool {
+	return matchesAny(f.severities, alert.Severity) && matchesAny(f.statuses, alert.Status)
+}
+
+func matchesAny(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// alertTable holds the latest known state of each alert by fingerprint
+type alertTable struct {
+	filter alertFilter
+	alerts map[string]*models.AlertGroup
+}
+
+func newAlertTable(filter alertFilter) *alertTable {
+	return &alertTable{
+		filter: filter,
+		alerts: make(map[string]*models.AlertGroup),
+	}
+}
+
+func (t *alertTable) apply(alert *models.AlertGroup) {
+	t.alerts[alert.Fingerprint] = alert
+}
+
+// rows returns the alerts matching the filter, most severe first and then
+// most recently started.
+func (t *alertTable) rows() []*models.AlertGroup {
+	rows := make([]*models.AlertGroup, 0, len(t.alerts))
+	for _, alert := range t.alerts {
+		if t.filter.matches(alert) {
+			rows = append(rows, alert)
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		ri, rj := severityRank(rows[i].Severity), severityRank(rows[j].Severity)
+		if ri != rj {
+			return ri < rj
+		}
+		if !rows[i].StartsAt.Equal(rows[j].StartsAt) {
+			return rows[i].StartsAt.After(rows[j].StartsAt)
+		}
+		return rows[i].Fingerprint < rows[j].Fingerprint
+	})
+
+	return rows
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 0
+	case "warning":
+		return 1
+	case "info":
+		return 2
+	default:
+		return 3
+	}
+}
+
+const (
+	colorReset   = "\033[0m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorBlue    = "\033[34m"
+	colorMagenta = "\033[35m"
+)
+
+// rowColor picks the ANSI color for an alert row. Status wins over severity
+// so resolved and acknowledged alerts stand out from active ones.
+func rowColor(alert *models.AlertGroup) string {
+	switch alert.Status {
+	case "resolved":
+		return colorGreen
+	case "acknowledged":
+		return colorMagenta
+	}
+	switch alert.Severity {
+	case "critical":
+		return colorRed
+	case "warning":
+		return colorYellow
+	case "info":
+		return colorBlue
+	}
+	return ""
+}
+
+const maxSummaryWidth = 60
+
+// renderAlertTable writes the rows as an aligned, color-coded table
+func renderAlertTable(w io.Writer, rows []*models.AlertGroup, now time.Time) {
+	header := []string{"SEVERITY", "STATUS", "SUMMARY", "FINGERPRINT", "SINCE"}
+
+	cells := make([][]string, len(rows))
+	for i, alert := range rows {
+		summary := alert.Summary
+		if len(summary) > maxSummaryWidth {
+			summary = summary[:maxSummaryWidth-3] + "..."
+		}
+		since := "-"
+		if !alert.StartsAt.IsZero() {
+			since = now.Sub(alert.StartsAt).Truncate(time.Second).String()
+		}
+		cells[i] = []string{alert.Severity, alert.Status, summary, alert.Fingerprint, since}
+	}
+
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = len(h)
+	}
+	for _, row := range cells {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	fmt.Fprintln(w, formatRow(header, widths))
+	for i, row := range cells {
+		line := formatRow(row, widths)
+		if color := rowColor(rows[i]); color != "" {
+			line = color + line + colorReset
+		}
+		fmt.Fprintln(w, line)
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "no alerts")
+	}
+}
+
+func formatRow(cells []string, widths []int) string {
+	parts := make([]string, len(cells))
+	for i, cell := range cells {
+		parts[i] = fmt.Sprintf("%-*s", widths[i], cell)
+	}
+	return strings.TrimRight(strings.Join(parts, "  "), " ")
+}
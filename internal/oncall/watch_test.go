@@ -0,0 +1,179 @@
+package oncall
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vjranagit/grafana/internal/oncall/models"
+)
+
+func TestAlertTable_RowsFilteredAndOrdered(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	table := newAlertTable(alertFilter{})
+	table.apply(&models.AlertGroup{Fingerprint: "a", Status: "firing", Severity: "warning", StartsAt: now.Add(-time.Hour)})
+	table.apply(&models.AlertGroup{Fingerprint: "b", Status: "firing", Severity: "critical", StartsAt: now.Add(-time.Hour)})
+	table.apply(&models.AlertGroup{Fingerprint: "c", Status: "firing", Severity: "critical", StartsAt: now.Add(-time.Minute)})
+
+	rows := table.rows()
+	var order []string
+	for _, row := range rows {
+		order = append(order, row.Fingerprint)
+	}
+	if got := strings.Join(order, ","); got != "c,b,a" {
+		t.Errorf("expected order c,b,a, got %s", got)
+	}
+
+	// A later event for the same fingerprint replaces the row
+	table.apply(&models.AlertGroup{Fingerprint: "b", Status: "resolved", Severity: "critical"})
+	if len(table.rows()) != 3 {
+		t.Errorf("expected 3 rows after update, got %d", len(table.rows()))
+	}
+
+	table.filter = alertFilter{statuses: []string{"firing"}}
+	if len(table.rows()) != 2 {
+		t.Errorf("expected 2 firing rows, got %d", len(table.rows()))
+	}
+
+	table.filter = alertFilter{severities: []string{"WARNING"}}
+	rows = table.rows()
+	if len(rows) != 1 || rows[0].Fingerprint != "a" {
+		t.Errorf("expected only warning alert a, got %v", rows)
+	}
+}
+
+func TestRenderAlertTable(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := []*models.AlertGroup{
+		{Fingerprint: "abc", Status: "firing", Severity: "critical", Summary: "Disk full", StartsAt: now.Add(-90 * time.Second)},
+		{Fingerprint: "def", Status: "resolved", Severity: "warning", Summary: strings.Repeat("x", 100)},
+	}
+
+	var buf bytes.Buffer
+	renderAlertTable(&buf, rows, now)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 rows, got %d lines:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "SEVERITY") {
+		t.Errorf("expected header first, got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], colorRed) || !strings.HasSuffix(lines[1], colorReset) {
+		t.Errorf("expected critical firing row in red, got %q", lines[1])
+	}
+	if !strings.Contains(lines[1], "1m30s") {
+		t.Errorf("expected age 1m30s in row, got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], colorGreen) {
+		t.Errorf("expected resolved row in green, got %q", lines[2])
+	}
+	if !strings.Contains(lines[2], strings.Repeat("x", maxSummaryWidth-3)+"...") {
+		t.Errorf("expected long summary to be truncated, got %q", lines[2])
+	}
+
+	// Columns are aligned: the status column starts at the same offset
+	header := lines[0]
+	row := strings.TrimPrefix(lines[1], colorRed)
+	if strings.Index(header, "STATUS") != strings.Index(row, "firing") {
+		t.Errorf("status column misaligned:\n%s\n%s", header, row)
+	}
+}
+
+func TestRenderAlertTable_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	renderAlertTable(&buf, nil, time.Now())
+
+	if !strings.Contains(buf.String(), "no alerts") {
+		t.Errorf("expected empty table message, got %q", buf.String())
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := ": keepalive\n\n" +
+		"event: alert\ndata: {\"fingerprint\":\"a\"}\n\n" +
+		"event: alert\ndata: {\"fingerprint\":\n" +
+		"data: \"b\"}\n\n"
+
+	type event struct{ name, data string }
+	var events []event
+	err := readEvents(strings.NewReader(stream), func(name, data string) error {
+		events = append(events, event{name, data})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].name != "alert" || events[0].data != `{"fingerprint":"a"}` {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if events[1].data != "{\"fingerprint\":\n\"b\"}" {
+		t.Errorf("expected multi-line data to be joined, got %q", events[1].data)
+	}
+}
+
+// cancelOnWrite cancels the watch once it has rendered something
+type cancelOnWrite struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelOnWrite) Write(p []byte) (int, error) {
+	defer w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func TestWatchAlerts_APIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/alerts/stream" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("event: alert\ndata: {\"fingerprint\":\"a\",\"severity\":\"critical\"}\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A rejected key is terminal rather than retried every two seconds
+	var errOut bytes.Buffer
+	client := oncallClient{serverURL: srv.URL, apiKey: "wrong", http: srv.Client()}
+	err := watchAlerts(ctx, client, newAlertTable(alertFilter{}), &bytes.Buffer{}, &errOut)
+	if !errors.Is(err, errRejected) || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("expected a rejected key error, got %v", err)
+	}
+	if errOut.Len() != 0 {
+		t.Errorf("expected no reconnect attempts, got %q", errOut.String())
+	}
+
+	watchCtx, stop := context.WithCancel(ctx)
+	out := &cancelOnWrite{cancel: stop}
+	client.apiKey = "secret"
+	if err := watchAlerts(watchCtx, client, newAlertTable(alertFilter{}), out, &errOut); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("timed out waiting for the alert to render")
+	}
+	if !strings.Contains(out.String(), "critical") {
+		t.Errorf("expected the streamed alert rendered, got %q", out.String())
+	}
+}
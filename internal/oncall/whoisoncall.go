@@ -0,0 +1,161 @@
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newWhoIsOnCallCommand() *cobra.Command {
+	var serverURL string
+	var apiKey string
+	var scheduleID int64
+	var at string
+	var asJSON bool
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "whoisoncall",
+		Short: "Show who is on call for a schedule",
+		Long: `Ask a running oncall server who is on call for a schedule, now or at
+the time given with --at, and when the next handoff is.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if scheduleID <= 0 {
+				return fmt.Errorf("--schedule is required")
+			}
+			var atTime time.Time
+			if at != "" {
+				parsed, err := time.Parse(time.RFC3339, at)
+				if err != nil {
+					return fmt.Errorf("invalid --at %q: expected an RFC 3339 time such as 2024-01-01T09:00:00Z", at)
+				}
+				atTime = parsed
+			}
+
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+
+			client := oncallClient{serverURL: serverURL, apiKey: apiKey, http: http.DefaultClient}
+			oncall, err := client.currentOnCall(ctx, scheduleID, atTime)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(oncall)
+			}
+			renderOnCall(cmd.OutOrStdout(), oncall)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&serverURL, "server", "http://localhost:8080",
+		"Oncall server URL")
+	cmd.Flags().StringVar(&apiKey, "api-key", "",
+		"API key for servers that require one")
+	cmd.Flags().Int64Var(&scheduleID, "schedule", 0,
+		"ID of the schedule to look up")
+	cmd.Flags().StringVar(&at, "at", "",
+		"Look up who is on call at this RFC 3339 time instead of now")
+	cmd.Flags().BoolVar(&asJSON, "json", false,
+		"Print the server's answer as JSON")
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second,
+		"Time limit for the request")
+
+	return cmd
+}
+
+// currentOnCall is the server's answer to GET /schedules/{id}/oncall
+type currentOnCall struct {
+	ScheduleID  int64      `json:"schedule_id"`
+	OnCallUser  string     `json:"oncall_user"`
+	LayerID     *int64     `json:"layer_id,omitempty"`
+	OverrideID  *int64     `json:"override_id,omitempty"`
+	NextHandoff *time.Time `json:"next_handoff"`
+	At          time.Time  `json:"at"`
+}
+
+// oncallClient calls a running oncall server's API
+type oncallClient struct {
+	serverURL string
+	apiKey    string
+	http      *http.Client
+}
+
+// currentOnCall asks who is on call for the schedule at at, or now if at is
+// zero
+func (c oncallClient) currentOnCall(ctx context.Context, scheduleID int64, at time.Time) (*currentOnCall, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/schedules/%d/oncall", strings.TrimSuffix(c.serverURL, "/"), scheduleID)
+	if !at.IsZero() {
+		endpoint += "?at=" + url.QueryEscape(at.Format(time.RFC3339))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach oncall server at %s: %w", c.serverURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("schedule %d not found", scheduleID)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("server rejected the request (status %d): check --api-key", resp.StatusCode)
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var oncall currentOnCall
+	if err := json.NewDecoder(resp.Body).Decode(&oncall); err != nil {
+		return nil, fmt.Errorf("failed to decode server response: %w", err)
+	}
+	return &oncall, nil
+}
+
+// renderOnCall writes oncall as an aligned table
+func renderOnCall(w io.Writer, oncall *currentOnCall) {
+	user := oncall.OnCallUser
+	if user == "" {
+		user = "nobody"
+	}
+	via := "-"
+	switch {
+	case oncall.OverrideID != nil:
+		via = fmt.Sprintf("override %d", *oncall.OverrideID)
+	case oncall.LayerID != nil:
+		via = fmt.Sprintf("layer %d", *oncall.LayerID)
+	}
+	handoff := "-"
+	if oncall.NextHandoff != nil {
+		handoff = fmt.Sprintf("%s (in %s)", oncall.NextHandoff.UTC().Format(time.RFC3339),
+			oncall.NextHandoff.Sub(oncall.At).Truncate(time.Minute))
+	}
+
+	header := []string{"SCHEDULE", "ON CALL", "VIA", "NEXT HANDOFF"}
+	row := []string{fmt.Sprint(oncall.ScheduleID), user, via, handoff}
+	widths := make([]int, len(header))
+	for i := range header {
+		widths[i] = max(len(header[i]), len(row[i]))
+	}
+	fmt.Fprintln(w, formatRow(header, widths))
+	fmt.Fprintln(w, formatRow(row, widths))
+}
@@ -0,0 +1,89 @@
+package oncall
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func runWhoIsOnCall(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := newWhoIsOnCallCommand()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestWhoIsOnCall(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/schedules/3/oncall" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"schedule_id": 3, "oncall_user": "alice", "layer_id": 7, "override_id": null,
+			"next_handoff": "2024-01-01T17:00:00Z", "at": "2024-01-01T09:00:00Z"}`))
+	}))
+	defer srv.Close()
+
+	out, err := runWhoIsOnCall(t, "--server", srv.URL, "--schedule", "3", "--at", "2024-01-01T09:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "at=2024-01-01T09%3A00%3A00Z" {
+		t.Errorf("expected the time passed on, got query %q", query)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "SCHEDULE") {
+		t.Fatalf("expected a header and one row, got:\n%s", out)
+	}
+	for _, want := range []string{"alice", "layer 7", "2024-01-01T17:00:00Z (in 8h0m0s)"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("expected %q in row %q", want, lines[1])
+		}
+	}
+
+	out, err = runWhoIsOnCall(t, "--server", srv.URL, "--schedule", "3", "--json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got currentOnCall
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", out, err)
+	}
+	if got.OnCallUser != "alice" || got.NextHandoff == nil {
+		t.Errorf("unexpected JSON output %+v", got)
+	}
+}
+
+func TestWhoIsOnCall_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if _, err := runWhoIsOnCall(t, "--server", srv.URL, "--schedule", "42"); err == nil || err.Error() != "schedule 42 not found" {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	if _, err := runWhoIsOnCall(t, "--server", closed.URL, "--schedule", "1"); err == nil || !strings.Contains(err.Error(), "failed to reach oncall server") {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+
+	if _, err := runWhoIsOnCall(t, "--server", srv.URL); err == nil {
+		t.Error("expected --schedule to be required")
+	}
+	if _, err := runWhoIsOnCall(t, "--server", srv.URL, "--schedule", "1", "--at", "tomorrow"); err == nil {
+		t.Error("expected an invalid --at to be rejected")
+	}
+}